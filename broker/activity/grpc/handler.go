@@ -36,7 +36,28 @@ type Handler struct {
 	db activity.DAO
 }
 
+// PostActivity stores activities posted by other services in the inbox of the user they are addressed to.
 func (h *Handler) PostActivity(ctx context.Context, stream proto.ActivityService_PostActivityStream) error {
+
+	dao := servicecontext.GetDAO(ctx).(activity.DAO)
+
+	defer stream.Close()
+	for {
+		request, err := stream.Recv()
+		if request == nil || err != nil {
+			break
+		}
+		ac := request.Object
+		if ac == nil || ac.To == nil || ac.To.Type != proto.ObjectType_Person || ac.To.Id == "" {
+			log.Logger(ctx).Debug("Ignoring posted activity without a recipient", zap.Any("activity", ac))
+			continue
+		}
+		if err := dao.PostActivity(proto.OwnerType_USER, ac.To.Id, activity.BoxInbox, ac); err != nil {
+			return err
+		}
+		publishActivityEvent(ctx, proto.OwnerType_USER, ac.To.Id, activity.BoxInbox, ac)
+	}
+
 	return nil
 }
 
@@ -33,6 +33,7 @@ import (
 	"github.com/pmker/yux/common"
 	"github.com/pmker/yux/common/log"
 	activity2 "github.com/pmker/yux/common/proto/activity"
+	"github.com/pmker/yux/common/proto/docstore"
 	"github.com/pmker/yux/common/proto/tree"
 	"github.com/pmker/yux/common/service/context"
 	"github.com/pmker/yux/common/utils"
@@ -75,6 +76,20 @@ func (e *MicroEventsSubscriber) Handle(ctx context.Context, msg *tree.NodeChange
 
 	// Create Activities and post them to associated inboxes
 	ac, Node := activity.DocumentActivity(author, msg)
+
+	// Downloads from public links are attributed to the link rather than to its hidden user
+	var linkDownload docstore.ShareLinkDownload
+	if msg.Type == tree.NodeChangeEvent_READ && msg.Target != nil {
+		msg.Target.GetMeta(common.META_NAMESPACE_SHARE_LINK_DOWNLOAD, &linkDownload)
+	}
+	if linkDownload.LinkHash != "" {
+		ac.Actor = &activity2.Object{
+			Type: activity2.ObjectType_Link,
+			Name: linkDownload.LinkHash,
+			Id:   linkDownload.LinkHash,
+		}
+	}
+
 	if Node != nil && Node.Uuid != "" {
 
 		// Ignore hidden files
@@ -160,8 +175,8 @@ func (e *MicroEventsSubscriber) Handle(ctx context.Context, msg *tree.NodeChange
 			if len(subscription.Events) == 0 {
 				continue
 			}
-			// Ignore if author is user
-			if subscription.UserId == author {
+			// Ignore if author is user, or if user is the link owner notified below
+			if subscription.UserId == author || subscription.UserId == linkDownload.OwnerId {
 				continue
 			}
 			dao.PostActivity(activity2.OwnerType_USER, subscription.UserId, activity.BoxInbox, ac)
@@ -169,6 +184,15 @@ func (e *MicroEventsSubscriber) Handle(ctx context.Context, msg *tree.NodeChange
 
 		}
 
+		//
+		// Notify the link owner of the download
+		//
+		if linkDownload.OwnerId != "" && linkDownload.OwnerId != author {
+			log.Logger(ctx).Debug("Posting public link download to owner inbox", zap.String(common.KEY_USER, linkDownload.OwnerId))
+			dao.PostActivity(activity2.OwnerType_USER, linkDownload.OwnerId, activity.BoxInbox, ac)
+			publishActivityEvent(ctx, activity2.OwnerType_USER, linkDownload.OwnerId, activity.BoxInbox, ac)
+		}
+
 	}
 
 	return nil
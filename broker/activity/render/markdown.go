@@ -199,6 +199,14 @@ func Markdown(object *activity.Object, pointOfView activity.SummaryPointOfView,
 		}
 		return userIdentifier
 
+	case activity.ObjectType_Link:
+
+		return T("PublicLink") + " " + object.Id
+
+	case activity.ObjectType_Note:
+
+		return object.Summary
+
 	default:
 
 		return ""
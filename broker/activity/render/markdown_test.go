@@ -201,4 +201,27 @@ func TestMarkdown(t *testing.T) {
 
 	})
 
+	Convey("Test public link download rendering", t, func() {
+
+		download := &activity.Object{
+			Id:   uuid.NewUUID().String(),
+			Name: "File Event",
+			Type: activity.ObjectType_Read,
+			Actor: &activity.Object{
+				Type: activity.ObjectType_Link,
+				Id:   "7d9f2ac61b03",
+				Name: "7d9f2ac61b03",
+			},
+			Object: &activity.Object{
+				Type: activity.ObjectType_Document,
+				Name: "path/to/document.txt",
+				Id:   "doc1",
+			},
+		}
+
+		md := Markdown(download, activity.SummaryPointOfView_GENERIC, "")
+		So(md, ShouldEqual, "Document document.txt was accessed by public link 7d9f2ac61b03")
+
+	})
+
 }
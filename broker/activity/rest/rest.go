@@ -82,6 +82,14 @@ func (a *ActivityHandler) Stream(req *restful.Request, rsp *restful.Response) {
 		service.RestError500(req, rsp, err)
 		return
 	}
+	// Visitors of a file drop cannot see what happens in the drop folder
+	if drop, e := views.IsFileDropVisitor(ctx); e != nil {
+		service.RestError500(req, rsp, e)
+		return
+	} else if drop {
+		service.RestError403(req, rsp, errors.New("this link only accepts uploads"))
+		return
+	}
 	if inputReq.BoxName == "" {
 		inputReq.BoxName = "outbox"
 	}
@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/pmker/yux/common/utils"
+)
+
+var (
+	accessKeyLogin string
+	accessKeyLabel string
+	accessKeyId    string
+)
+
+// accessKeyCreateCmd creates an access key for a user
+var accessKeyCreateCmd = &cobra.Command{
+	Use:   "access-key-create",
+	Short: "Create an access key for a user",
+	Long: `Generate a new access key ID and secret for a user
+
+Access keys are used by S3 clients to sign their requests to the S3 gateway.
+The secret is only displayed once.
+
+EXAMPLE
+=======
+$ cells admin access-key-create -u LOGIN -l "rclone on my laptop"
+
+`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if accessKeyLogin == "" {
+			cmd.Usage()
+			return fmt.Errorf("Missing arguments")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx := context.Background()
+		if _, err := utils.SearchUniqueUser(ctx, accessKeyLogin, ""); err != nil {
+			fmt.Printf("Cannot find user %s: %s\n", accessKeyLogin, err.Error())
+			return
+		}
+		key, err := utils.CreateAccessKey(ctx, accessKeyLogin, accessKeyLabel)
+		if err != nil {
+			fmt.Printf("Could not create access key: %s\n", err.Error())
+			return
+		}
+		fmt.Printf("Access Key ID: %s\nSecret Access Key: %s\n", key.ID, key.Secret)
+	},
+}
+
+// accessKeyListCmd lists the access keys of a user
+var accessKeyListCmd = &cobra.Command{
+	Use:   "access-key-list",
+	Short: "List access keys of a user",
+	Long: `List the access keys IDs of a user, without their secrets
+
+EXAMPLE
+=======
+$ cells admin access-key-list -u LOGIN
+
+`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if accessKeyLogin == "" {
+			cmd.Usage()
+			return fmt.Errorf("Missing arguments")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		keys, err := utils.ListAccessKeys(context.Background(), accessKeyLogin)
+		if err != nil {
+			fmt.Printf("Cannot list access keys for %s: %s\n", accessKeyLogin, err.Error())
+			return
+		}
+		if len(keys) == 0 {
+			fmt.Printf("No access keys found for %s\n", accessKeyLogin)
+			return
+		}
+		for _, key := range keys {
+			fmt.Printf("%s\t%s\t%s\n", key.ID, time.Unix(key.Created, 0).Format(time.RFC3339), key.Label)
+		}
+	},
+}
+
+// accessKeyDeleteCmd revokes an access key
+var accessKeyDeleteCmd = &cobra.Command{
+	Use:   "access-key-delete",
+	Short: "Revoke an access key",
+	Long: `Delete an access key of a user
+
+EXAMPLE
+=======
+$ cells admin access-key-delete -u LOGIN -k ACCESS_KEY_ID
+
+`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if accessKeyLogin == "" || accessKeyId == "" {
+			cmd.Usage()
+			return fmt.Errorf("Missing arguments")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := utils.DeleteAccessKey(context.Background(), accessKeyLogin, accessKeyId); err != nil {
+			fmt.Printf("Could not delete access key %s: %s\n", accessKeyId, err.Error())
+			return
+		}
+		fmt.Printf("Successfully deleted access key %s\n", accessKeyId)
+	},
+}
+
+func init() {
+	accessKeyCreateCmd.Flags().StringVarP(&accessKeyLogin, "username", "u", "", "Login of the key owner")
+	accessKeyCreateCmd.Flags().StringVarP(&accessKeyLabel, "label", "l", "", "Optional description of the key usage")
+	accessKeyListCmd.Flags().StringVarP(&accessKeyLogin, "username", "u", "", "Login of the keys owner")
+	accessKeyDeleteCmd.Flags().StringVarP(&accessKeyLogin, "username", "u", "", "Login of the key owner")
+	accessKeyDeleteCmd.Flags().StringVarP(&accessKeyId, "key", "k", "", "ID of the access key to delete")
+	adminCmd.AddCommand(accessKeyCreateCmd)
+	adminCmd.AddCommand(accessKeyListCmd)
+	adminCmd.AddCommand(accessKeyDeleteCmd)
+}
@@ -31,15 +31,29 @@ import (
 	"github.com/pmker/yux/common/micro"
 )
 
-// metaCmd represents the meta command
+var (
+	syncUsersConfigId      string
+	syncUsersDeleteMissing bool
+)
+
+// jobsSyncUsersCmd represents the sync-users command
 var jobsSyncUsersCmd = &cobra.Command{
 	Use:   "sync-users",
 	Short: "Trigger a sync between LDAP and internal directory",
-	Long:  `Uses default configs for the moment`,
-	Run:   newJob,
+	Long: `Synchronises the users of the LDAP servers declared in the auth connectors.
+
+Users that are no longer found in the directory are locked, or deleted if --delete-missing is set.`,
+	Run: newJob,
 }
 
 func newJob(cmd *cobra.Command, args []string) {
+	parameters := make(map[string]string)
+	if syncUsersConfigId != "" {
+		parameters["configId"] = syncUsersConfigId
+	}
+	if syncUsersDeleteMissing {
+		parameters["deleteMissing"] = "true"
+	}
 	jobClient := jobs.NewJobServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_JOBS, defaults.NewClient())
 	jobClient.PutJob(context.Background(), &jobs.PutJobRequest{
 		Job: &jobs.Job{
@@ -48,7 +62,7 @@ func newJob(cmd *cobra.Command, args []string) {
 			ID:    uuid2.NewUUID().String(),
 			Actions: []*jobs.Action{{
 				ID:         "actions.auth.sync-users",
-				Parameters: make(map[string]string),
+				Parameters: parameters,
 			}},
 			AutoStart: true,
 			// HasProgress:    true,
@@ -59,5 +73,7 @@ func newJob(cmd *cobra.Command, args []string) {
 }
 
 func init() {
+	jobsSyncUsersCmd.Flags().StringVarP(&syncUsersConfigId, "config", "c", "", "Only synchronise the LDAP server with this ConfigId")
+	jobsSyncUsersCmd.Flags().BoolVar(&syncUsersDeleteMissing, "delete-missing", false, "Delete users that are no longer found in the directory instead of locking them")
 	jobsCmd.AddCommand(jobsSyncUsersCmd)
 }
@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/proto/encryption"
+)
+
+var (
+	keyRotateDataSource string
+	keyRotateKeyID      string
+	keyRotateLabel      string
+	keyRotateKeepOld    bool
+)
+
+// keyRotateCmd represents the key rotate command
+var keyRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Rotate the master key of an encrypted datasource",
+	Long: `Replaces the key of a datasource encrypted in MASTER mode.
+
+A new key is created in the key store, then all file keys are rewrapped with it in background:
+files content is not encrypted again. The old key is deleted once done, unless --keep-old-key is set.
+Running the command again on a datasource whose rotation was interrupted resumes it.
+
+EXAMPLES
+========
+$ pydioctl key rotate -d pydiods1
+$ pydioctl key rotate -d pydiods1 --key-id pydiods1-2019 --keep-old-key
+`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if keyRotateDataSource == "" {
+			return fmt.Errorf("Missing argument: please provide a datasource name")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client := encryption.NewNodeKeyManagerClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_ENC_KEY, defaults.NewClient())
+		rsp, err := client.RotateKey(context.Background(), &encryption.RotateKeyRequest{
+			DataSource:  keyRotateDataSource,
+			NewKeyID:    keyRotateKeyID,
+			NewKeyLabel: keyRotateLabel,
+			KeepOldKey:  keyRotateKeepOld,
+		})
+		if err != nil {
+			return err
+		}
+		printKeyRotation(rsp.Rotation)
+		return nil
+	},
+}
+
+// keyRotationCmd represents the key rotation command
+var keyRotationCmd = &cobra.Command{
+	Use:   "rotation",
+	Short: "Display the status of the last key rotation of a datasource",
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if keyRotateDataSource == "" {
+			return fmt.Errorf("Missing argument: please provide a datasource name")
+		}
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client := encryption.NewNodeKeyManagerClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_ENC_KEY, defaults.NewClient())
+		rsp, err := client.GetKeyRotation(context.Background(), &encryption.GetKeyRotationRequest{
+			DataSource: keyRotateDataSource,
+		})
+		if err != nil {
+			return err
+		}
+		printKeyRotation(rsp.Rotation)
+		return nil
+	},
+}
+
+func printKeyRotation(r *encryption.KeyRotation) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Datasource", "Old Key", "New Key", "Status", "Progress", "Updated", "Error"})
+	table.Append([]string{
+		r.DataSource,
+		r.OldKeyID,
+		r.NewKeyID,
+		r.Status.String(),
+		fmt.Sprintf("%d/%d", r.Rewrapped, r.Total),
+		time.Unix(int64(r.UpdateTime), 0).Format(time.RFC822),
+		r.Error,
+	})
+	table.Render()
+}
+
+func init() {
+	keyRotateCmd.Flags().StringVarP(&keyRotateDataSource, "datasource", "d", "", "Name of the datasource")
+	keyRotateCmd.Flags().StringVar(&keyRotateKeyID, "key-id", "", "Id of the key to create, generated from the datasource name if empty")
+	keyRotateCmd.Flags().StringVar(&keyRotateLabel, "label", "", "Label of the key to create")
+	keyRotateCmd.Flags().BoolVar(&keyRotateKeepOld, "keep-old-key", false, "Keep the old key in the key store once all file keys are rewrapped")
+	keyRotationCmd.Flags().StringVarP(&keyRotateDataSource, "datasource", "d", "", "Name of the datasource")
+	keyCmd.AddCommand(keyRotateCmd)
+	keyCmd.AddCommand(keyRotationCmd)
+}
@@ -209,7 +209,7 @@ func promptDB(c *install.InstallConfig) error {
 
 	connType := p.Select{
 		Label: "Database Connection Type",
-		Items: []string{"TCP", "Socket", "Manual"},
+		Items: []string{"TCP", "Socket", "Manual", "PostgreSQL (TCP)"},
 	}
 	dbTcpHost := p.Prompt{Label: "Database Hostname", Validate: notEmpty, Default: "localhost"}
 	dbTcpPort := p.Prompt{Label: "Database Port", Validate: validPortNumber, Default: "3306"}
@@ -224,12 +224,17 @@ func promptDB(c *install.InstallConfig) error {
 	uConnIdx, _, _ := connType.Run()
 	var e error
 	if uConnIdx == 2 {
+		c.DbConnectionType = "manual"
 		if c.DbManualDSN, e = dbDSN.Run(); e != nil {
 			return e
 		}
 	} else {
-		if uConnIdx == 0 {
+		if uConnIdx == 0 || uConnIdx == 3 {
 			c.DbConnectionType = "tcp"
+			if uConnIdx == 3 {
+				c.DbConnectionType = "postgres"
+				dbTcpPort.Default = "5432"
+			}
 			if c.DbTCPHostname, e = dbTcpHost.Run(); e != nil {
 				return e
 			}
@@ -252,7 +257,7 @@ func promptDB(c *install.InstallConfig) error {
 		if pass, e = dbPass.Run(); e != nil {
 			return e
 		}
-		if uConnIdx == 0 {
+		if uConnIdx == 0 || uConnIdx == 3 {
 			c.DbTCPName = name
 			c.DbTCPUser = user
 			c.DbTCPPassword = pass
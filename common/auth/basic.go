@@ -29,6 +29,7 @@ import (
 
 	"github.com/pmker/yux/common"
 	"github.com/pmker/yux/common/auth/claim"
+	"github.com/pmker/yux/idm/key"
 )
 
 func NewBasicAuthenticator(realm string, ttl time.Duration) *BasicAuthenticator {
@@ -55,6 +56,16 @@ func (b *BasicAuthenticator) Wrap(handler http.Handler) http.HandlerFunc {
 
 		if user, pass, ok := r.BasicAuth(); ok {
 
+			// Personal access tokens can be used instead of the password. They are not kept in the
+			// connexion cache, so that a revocation is effective shortly. If the verification fails,
+			// the value is checked as a password that happens to look like a token.
+			if IsPersonalAccessToken(pass) {
+				if newCtx, claims, err := DefaultJWTVerifier().Verify(r.Context(), pass); err == nil && claims.Name == user {
+					handler.ServeHTTP(w, r.WithContext(newCtx))
+					return
+				}
+			}
+
 			ctx := r.Context()
 
 			if valid, vOk := b.cache[user]; vOk && time.Now().Sub(valid.Connexion) <= time.Duration(time.Minute*10) && valid.Hash == pass {
@@ -68,7 +79,9 @@ func (b *BasicAuthenticator) Wrap(handler http.Handler) http.HandlerFunc {
 				md[common.PYDIO_CONTEXT_USER_KEY] = valid.Claims.Name
 				ctx = metadata.NewContext(ctx, md)
 
-				r = r.WithContext(context.WithValue(ctx, claim.ContextKey, valid.Claims))
+				ctx = context.WithValue(ctx, claim.ContextKey, valid.Claims)
+				// The password was verified against the account, it can unlock the user key
+				r = r.WithContext(key.WithPassword(ctx, []byte(pass)))
 
 				valid.Connexion = time.Now()
 				handler.ServeHTTP(w, r)
@@ -78,13 +91,14 @@ func (b *BasicAuthenticator) Wrap(handler http.Handler) http.HandlerFunc {
 			jwtHelper := DefaultJWTVerifier()
 			newCtx, claims, err := jwtHelper.PasswordCredentialsToken(ctx, user, pass)
 			if err == nil {
-				r = r.WithContext(newCtx)
+				r = r.WithContext(key.WithPassword(newCtx, []byte(pass)))
 				b.cache[user] = &validBasicUser{
 					Hash:      pass,
 					Connexion: time.Now(),
 					Claims:    claims,
 				}
 				handler.ServeHTTP(w, r)
+				return
 			}
 		}
 
@@ -23,6 +23,7 @@ package claim
 
 import (
 	"encoding/base64"
+	"strings"
 	"time"
 
 	"github.com/coreos/go-oidc/jose"
@@ -34,6 +35,20 @@ const (
 	MetadataContextKey = "x-pydio-claims"
 )
 
+// Authentication methods that can be listed in the "amr" claim
+const (
+	AuthMethodPassword      = "pwd"
+	AuthMethodOTP           = "otp"
+	AuthMethodAccessKey     = "key"
+	AuthMethodPublicKey     = "ssh"
+	AuthMethodPersonalToken = "pat"
+
+	// AuthMethodGroupPrefix marks the "groups" entries carrying additional authentication methods:
+	// identities issued by the OIDC service cannot hold custom claims, so a second factor is
+	// reported as an "amr:otp" group.
+	AuthMethodGroupPrefix = "amr:"
+)
+
 type IDTokenSubject struct {
 	UserId string `protobuf:"bytes,1,opt,name=user_id,json=userId" json:"user_id,omitempty"`
 	ConnId string `protobuf:"bytes,2,opt,name=conn_id,json=connId" json:"conn_id,omitempty"`
@@ -57,6 +72,53 @@ type Claims struct {
 	AuthSource  string    `json:"authSource"`
 	DisplayName string    `json:"displayName"`
 	GroupPath   string    `json:"groupPath"`
+	AuthMethods []string  `json:"amr,omitempty"`
+	Groups      []string  `json:"groups,omitempty"`
+
+	Restrictions *Restrictions `json:"restrictions,omitempty"`
+}
+
+// Restrictions narrows down the accesses of claims obtained with a personal access token.
+type Restrictions struct {
+	// TokenUuid is the identifier of the personal access token
+	TokenUuid string `json:"token"`
+	// ReadOnly forbids any modification
+	ReadOnly bool `json:"readOnly,omitempty"`
+	// Workspaces restricts the accessible workspaces, all workspaces if empty
+	Workspaces []string `json:"workspaces,omitempty"`
+	// Resources restricts the REST resources that can be called, all resources if empty
+	Resources []string `json:"resources,omitempty"`
+}
+
+// Methods returns the authentication methods used to obtain these claims.
+// Tokens issued without any "amr" claim are considered as password-based.
+func (c *Claims) Methods() []string {
+	var methods []string
+	if len(c.AuthMethods) == 0 {
+		methods = append(methods, AuthMethodPassword)
+	} else {
+		methods = append(methods, c.AuthMethods...)
+	}
+	for _, g := range c.Groups {
+		if strings.HasPrefix(g, AuthMethodGroupPrefix) {
+			methods = append(methods, strings.TrimPrefix(g, AuthMethodGroupPrefix))
+		}
+	}
+	return methods
+}
+
+// MFALevel returns the number of distinct authentication methods used to obtain these claims.
+func (c *Claims) MFALevel() int {
+	distinct := make(map[string]struct{})
+	for _, m := range c.Methods() {
+		distinct[m] = struct{}{}
+	}
+	return len(distinct)
+}
+
+// MFA tells if these claims were obtained with a second authentication factor.
+func (c *Claims) MFA() bool {
+	return c.MFALevel() > 1
 }
 
 // Decode Subject field of the claims
@@ -37,6 +37,7 @@ var (
 
 func init() {
 	RegisterDexPydioConnector("pydio-api", func() PydioConnectorConfig { return new(ApiConfig) })
+	RegisterDexPydioConnector("ldap", func() PydioConnectorConfig { return new(LdapConfig) })
 }
 
 func RegisterDexPydioConnector(name string, configProvider func() PydioConnectorConfig) {
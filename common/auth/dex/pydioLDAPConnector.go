@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package dex
+
+import (
+	"context"
+
+	"github.com/coreos/dex/connector"
+	"github.com/sirupsen/logrus"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/auth/ldap"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/proto/auth"
+	"github.com/pmker/yux/common/utils"
+)
+
+// LdapConfig configures a connector binding users on an LDAP server. Users are synchronised
+// into the idm services each time they log in.
+type LdapConfig struct {
+	auth.LdapServerConfig
+}
+
+func (c *LdapConfig) Open(logger logrus.FieldLogger) (connector.Connector, error) {
+	return c.OpenConnector(logger)
+}
+
+func (c *LdapConfig) OpenConnector(logger logrus.FieldLogger) (interface {
+	connector.Connector
+	connector.PasswordConnector
+	connector.RefreshConnector
+}, error) {
+	return c.openConnector(logger)
+}
+
+func (c *LdapConfig) openConnector(logger logrus.FieldLogger) (*pydioLDAPConnector, error) {
+	return &pydioLDAPConnector{LdapConfig: *c, logger: logger}, nil
+}
+
+type pydioLDAPConnector struct {
+	LdapConfig
+	logger logrus.FieldLogger
+}
+
+var (
+	_ connector.PasswordConnector = (*pydioLDAPConnector)(nil)
+	_ connector.RefreshConnector  = (*pydioLDAPConnector)(nil)
+)
+
+// Login binds the user on the LDAP server, then creates or updates the corresponding idm user.
+func (p *pydioLDAPConnector) Login(ctx context.Context, s connector.Scopes, username, password string) (identity connector.Identity, validPassword bool, err error) {
+
+	server := ldap.NewServer(&p.LdapServerConfig)
+	defer server.Close()
+
+	entry, err := server.Authenticate(username, password)
+	if err == ldap.ErrUserNotFound || err == ldap.ErrInvalidCredentials {
+		return connector.Identity{}, false, nil
+	} else if err != nil {
+		log.Logger(ctx).Error("cannot authenticate user on ldap server", zap.String(common.KEY_USERNAME, username), zap.String(common.KEY_CONNECTOR, p.ConfigId), zap.Error(err))
+		return connector.Identity{}, false, err
+	}
+
+	user, err := ldap.NewSyncer(server).SyncEntry(ctx, entry)
+	if err != nil {
+		log.Logger(ctx).Error("cannot synchronise ldap user", zap.String(common.KEY_USERNAME, username), zap.Error(err))
+		return connector.Identity{}, false, err
+	}
+	if utils.IsUserLocked(user) {
+		return connector.Identity{}, false, nil
+	}
+	return ConvertUserApiToIdentity(user, p.ConfigId), true, nil
+
+}
+
+func (p *pydioLDAPConnector) Refresh(ctx context.Context, s connector.Scopes, ident connector.Identity) (connector.Identity, error) {
+	return ident, nil
+}
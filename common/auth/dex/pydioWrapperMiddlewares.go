@@ -5,12 +5,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/coreos/dex/connector"
 	"github.com/micro/go-micro/errors"
+	"github.com/micro/go-micro/metadata"
 	"go.uber.org/zap"
 
 	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/auth/claim"
+	"github.com/pmker/yux/common/auth/mfa"
 	"github.com/pmker/yux/common/log"
 	"github.com/pmker/yux/common/micro"
 	"github.com/pmker/yux/common/proto/idm"
@@ -29,6 +34,8 @@ type WrapperConnectorOperation struct {
 	AuthSource    string
 	User          *idm.User
 	Identity      connector.Identity
+	// AuthMethods lists the additional authentication methods verified during this operation
+	AuthMethods []string
 }
 
 type WrapperConnectorProvider func(ctx context.Context, in *WrapperConnectorOperation) (*WrapperConnectorOperation, error)
@@ -144,13 +151,34 @@ func WrapWithUserLocks(middleware WrapperConnectorProvider) WrapperConnectorProv
 				return op, errors.Unauthorized(common.SERVICE_USER, "User "+user.Login+" has been blocked. Contact your sysadmin.")
 			}
 
+			// Public links users stay locked for a while, even with a valid password
+			if op.OperationType == "Login" && isHiddenUser(user) {
+				if remaining := linkLockoutRemaining(user, time.Now()); remaining > 0 {
+					log.Auditer(ctx).Error(
+						"Locked public link user ["+user.Login+"] tried to log in.",
+						log.GetAuditId(common.AUDIT_LOGIN_POLICY_DENIAL),
+						zap.String(common.KEY_USER_UUID, user.Uuid),
+					)
+					return op, linkLockedError(remaining)
+				}
+			}
+
 			// Reset failed connections
-			if user.Attributes != nil {
-				if _, ok := user.Attributes["failedConnections"]; ok {
+			if opE == nil && user.Attributes != nil {
+				_, hasFailed := user.Attributes["failedConnections"]
+				_, hasLast := user.Attributes["lastFailedConnection"]
+				if hasFailed || hasLast {
 					log.Logger(ctx).Info("[WrapWithUserLocks] Resetting user failedConnections", user.ZapLogin())
-					userClient := idm.NewUserServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_USER, defaults.NewClient())
-					delete(user.Attributes, "failedConnections")
-					userClient.CreateUser(ctx, &idm.CreateUserRequest{User: user})
+					// Reload the user under lock, not to overwrite a concurrent change of its attributes
+					unlock := mfa.LockUser(user.Login)
+					if u, e := utils.SearchUniqueUser(ctx, user.Login, ""); e == nil && u != nil && u.Attributes != nil {
+						userClient := idm.NewUserServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_USER, defaults.NewClient())
+						delete(u.Attributes, "failedConnections")
+						delete(u.Attributes, "lastFailedConnection")
+						userClient.CreateUser(ctx, &idm.CreateUserRequest{User: u})
+						op.User = u
+					}
+					unlock()
 				}
 			}
 		}
@@ -162,6 +190,13 @@ func WrapWithUserLocks(middleware WrapperConnectorProvider) WrapperConnectorProv
 
 			if u, e := utils.SearchUniqueUser(ctx, op.Login, ""); e == nil && u != nil {
 
+				// Reload the user under lock, not to overwrite a concurrent change of its attributes
+				unlock := mfa.LockUser(u.Login)
+				defer unlock()
+				if u, e = utils.SearchUniqueUser(ctx, u.Login, ""); e != nil || u == nil {
+					return op, opE
+				}
+
 				// double check if user was already locked to reduce work load
 				if utils.IsUserLocked(u) {
 					msg := fmt.Sprintf("locked user %s is still trying to connect", u.GetLogin())
@@ -169,6 +204,17 @@ func WrapWithUserLocks(middleware WrapperConnectorProvider) WrapperConnectorProv
 					return op, opE
 				}
 
+				// Public links are throttled rather than locked, as anyone knowing the link could block it.
+				// Attempts made while locked are refused with the same error whatever the password.
+				hidden := isHiddenUser(u)
+				now := time.Now()
+				if hidden {
+					if remaining := linkLockoutRemaining(u, now); remaining > 0 {
+						log.Logger(ctx).Warn(fmt.Sprintf("locked public link user %s is still trying to connect", u.GetLogin()), u.ZapLogin())
+						return op, linkLockedError(remaining)
+					}
+				}
+
 				var failedInt int64
 				if u.Attributes == nil {
 					u.Attributes = make(map[string]string)
@@ -179,7 +225,19 @@ func WrapWithUserLocks(middleware WrapperConnectorProvider) WrapperConnectorProv
 				failedInt++
 				u.Attributes["failedConnections"] = fmt.Sprintf("%d", failedInt)
 
-				if failedInt >= maxFailedLogins {
+				if hidden {
+					u.Attributes["lastFailedConnection"] = fmt.Sprintf("%d", now.Unix())
+					if delay := linkLockoutDelay(failedInt); delay > 0 {
+						msg := fmt.Sprintf("Locked public link user [%s] for %s after %d failed connections", u.GetLogin(), delay, failedInt)
+						log.Logger(ctx).Error(msg, u.ZapLogin())
+						log.Auditer(ctx).Error(
+							msg,
+							log.GetAuditId(common.AUDIT_LOCK_USER),
+							u.ZapLogin(),
+							zap.String(common.KEY_USER_UUID, u.GetUuid()),
+						)
+					}
+				} else if failedInt >= maxFailedLogins {
 					// Set lock via attributes
 					var locks []string
 					if l, ok := u.Attributes["locks"]; ok {
@@ -232,7 +290,157 @@ func WrapWithIdentity(middleware WrapperConnectorProvider) WrapperConnectorProvi
 			return op, e
 		}
 
+		// Methods verified at login are kept when refreshing the identity
+		var methods []string
+		if op.OperationType == "Refresh" {
+			for _, g := range op.Identity.Groups {
+				if strings.HasPrefix(g, claim.AuthMethodGroupPrefix) {
+					methods = append(methods, g)
+				}
+			}
+		}
+		for _, m := range op.AuthMethods {
+			methods = append(methods, claim.AuthMethodGroupPrefix+m)
+		}
+
 		op.Identity = ConvertUserApiToIdentity(op.User, op.AuthSource)
+		op.Identity.Groups = append(op.Identity.Groups, methods...)
+		return op, nil
+	}
+}
+
+// WrapWithMFA requires a one-time password from users who enrolled a second factor, or whose profile
+// or roles enforce one. The code is read from the X-Pydio-Otp header of the token request. Users who
+// must enroll are refused until they confirm a first code against the secret set up by the frontend.
+// Refreshing a token is refused for enforced users if it was not obtained with a second factor.
+func WrapWithMFA(middleware WrapperConnectorProvider) WrapperConnectorProvider {
+
+	return func(ctx context.Context, op *WrapperConnectorOperation) (*WrapperConnectorOperation, error) {
+
+		var e error
+		op, e = middleware(ctx, op)
+		if e != nil || op.User == nil {
+			return op, e
+		}
+		user := op.User
+		if op.OperationType == "Refresh" {
+			if mfa.IsEnforced(user) && !hasAuthMethod(op.Identity, claim.AuthMethodOTP) {
+				log.Logger(ctx).Info("refusing to refresh a token obtained without second factor", user.ZapLogin())
+				return op, errors.Unauthorized(mfa.ErrorOTPRequired, "User "+user.Login+" must log in again with a second authentication factor")
+			}
+			return op, nil
+		}
+		if op.OperationType != "Login" {
+			return op, nil
+		}
+		state := mfa.LoadState(user)
+		if !state.Enrolled() && !mfa.IsEnforced(user) {
+			return op, nil
+		}
+
+		var code string
+		if meta, ok := metadata.FromContext(ctx); ok {
+			code = meta[mfa.OTPHeader]
+		}
+		if code == "" {
+			if state.Enrolled() {
+				return op, errors.Unauthorized(mfa.ErrorOTPRequired, "A one-time password is required for user "+user.Login)
+			}
+			return op, errors.Unauthorized(mfa.ErrorEnrollRequired, "User "+user.Login+" must set up a second authentication factor")
+		}
+
+		// Codes are checked and consumed against a fresh copy of the user, under lock
+		var valid, recovery bool
+		updated, er := mfa.Update(ctx, user.Login, func(_ *idm.User, s *mfa.State) (bool, error) {
+			if s.Enrolled() {
+				valid, recovery = s.Verify(code, time.Now())
+			} else {
+				valid = s.Confirm(code, time.Now())
+			}
+			return valid, nil
+		})
+		if er != nil {
+			log.Logger(ctx).Error("could not store second factor state", user.ZapLogin(), zap.Error(er))
+			return op, er
+		}
+		if !valid {
+			log.Auditer(ctx).Error(
+				"Invalid one-time password for ["+user.Login+"]",
+				log.GetAuditId(common.AUDIT_LOGIN_FAILED),
+				zap.String(common.KEY_USER_UUID, user.Uuid),
+			)
+			op.LoginError = true
+			return op, errors.Unauthorized(mfa.ErrorOTPInvalid, "Invalid one-time password")
+		}
+		op.User = updated
+		if recovery {
+			log.Auditer(ctx).Info(
+				"User ["+user.Login+"] logged in with a recovery code",
+				log.GetAuditId(common.AUDIT_LOGIN_SUCCEED),
+				zap.String(common.KEY_USER_UUID, user.Uuid),
+			)
+		}
+		op.AuthMethods = append(op.AuthMethods, claim.AuthMethodOTP)
 		return op, nil
 	}
 }
+
+// hasAuthMethod checks if an identity was obtained with the given authentication method.
+func hasAuthMethod(identity connector.Identity, method string) bool {
+	for _, g := range identity.Groups {
+		if g == claim.AuthMethodGroupPrefix+method {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// maxFailedLinkLogins is the number of wrong passwords accepted on a public link before locking it.
+	maxFailedLinkLogins = 5
+	// maxLinkLockout caps the time a public link stays locked.
+	maxLinkLockout = time.Hour
+)
+
+// isHiddenUser checks if the user was created along with a public link.
+func isHiddenUser(user *idm.User) bool {
+	return user.Attributes != nil && user.Attributes["hidden"] == "true"
+}
+
+// linkLockoutDelay computes how long a public link is locked after a given number of failed logins:
+// one minute once the limit is reached, doubled on each further failure.
+func linkLockoutDelay(failed int64) time.Duration {
+	if failed < maxFailedLinkLogins {
+		return 0
+	}
+	delay := time.Minute
+	for i := int64(maxFailedLinkLogins); i < failed && delay < maxLinkLockout; i++ {
+		delay *= 2
+	}
+	if delay > maxLinkLockout {
+		delay = maxLinkLockout
+	}
+	return delay
+}
+
+// linkLockoutRemaining reads the failed logins attributes of a public link user and returns
+// how long it is still locked.
+func linkLockoutRemaining(user *idm.User, now time.Time) time.Duration {
+	if user.Attributes == nil {
+		return 0
+	}
+	failed, _ := strconv.ParseInt(user.Attributes["failedConnections"], 10, 32)
+	last, _ := strconv.ParseInt(user.Attributes["lastFailedConnection"], 10, 64)
+	delay := linkLockoutDelay(failed)
+	if delay == 0 || last == 0 {
+		return 0
+	}
+	if until := time.Unix(last, 0).Add(delay); now.Before(until) {
+		return until.Sub(now)
+	}
+	return 0
+}
+
+func linkLockedError(remaining time.Duration) error {
+	return errors.Unauthorized(common.SERVICE_USER, fmt.Sprintf("Too many failed attempts on this link, please retry in %s", remaining.Round(time.Second)))
+}
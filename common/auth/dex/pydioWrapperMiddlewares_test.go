@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package dex
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/coreos/dex/connector"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/auth/claim"
+	"github.com/pmker/yux/common/proto/idm"
+)
+
+func TestLinkLockout(t *testing.T) {
+
+	Convey("Lockout delay grows with failed logins", t, func() {
+		So(linkLockoutDelay(0), ShouldEqual, 0)
+		So(linkLockoutDelay(maxFailedLinkLogins-1), ShouldEqual, 0)
+		So(linkLockoutDelay(maxFailedLinkLogins), ShouldEqual, time.Minute)
+		So(linkLockoutDelay(maxFailedLinkLogins+1), ShouldEqual, 2*time.Minute)
+		So(linkLockoutDelay(maxFailedLinkLogins+3), ShouldEqual, 8*time.Minute)
+		So(linkLockoutDelay(maxFailedLinkLogins+100), ShouldEqual, maxLinkLockout)
+	})
+
+	Convey("Remaining lockout is computed from the last failed login", t, func() {
+		now := time.Unix(time.Now().Unix(), 0)
+		user := &idm.User{Login: "link-user", Attributes: map[string]string{
+			"hidden":               "true",
+			"failedConnections":    fmt.Sprintf("%d", maxFailedLinkLogins),
+			"lastFailedConnection": fmt.Sprintf("%d", now.Add(-20*time.Second).Unix()),
+		}}
+		So(isHiddenUser(user), ShouldBeTrue)
+		So(linkLockoutRemaining(user, now), ShouldEqual, 40*time.Second)
+		So(linkLockoutRemaining(user, now.Add(time.Minute)), ShouldEqual, 0)
+
+		user.Attributes["failedConnections"] = fmt.Sprintf("%d", maxFailedLinkLogins-1)
+		So(linkLockoutRemaining(user, now), ShouldEqual, 0)
+
+		So(isHiddenUser(&idm.User{Login: "user"}), ShouldBeFalse)
+		So(linkLockoutRemaining(&idm.User{Login: "user"}, now), ShouldEqual, 0)
+	})
+
+}
+
+func TestHasAuthMethod(t *testing.T) {
+
+	Convey("Authentication methods are read from the identity groups", t, func() {
+		identity := connector.Identity{Groups: []string{"group", claim.AuthMethodGroupPrefix + claim.AuthMethodOTP}}
+		So(hasAuthMethod(identity, claim.AuthMethodOTP), ShouldBeTrue)
+		So(hasAuthMethod(identity, claim.AuthMethodPublicKey), ShouldBeFalse)
+		So(hasAuthMethod(connector.Identity{}, claim.AuthMethodOTP), ShouldBeFalse)
+	})
+
+}
@@ -38,6 +38,7 @@ import (
 
 	"github.com/pmker/yux/common"
 	"github.com/pmker/yux/common/auth/claim"
+	"github.com/pmker/yux/common/auth/mfa"
 	"github.com/pmker/yux/common/config"
 	"github.com/pmker/yux/common/log"
 	"github.com/pmker/yux/common/micro"
@@ -82,9 +83,14 @@ type JWTVerifier struct {
 	defaultClientSecret string
 }
 
-// Verify validates an existing JWT token against the OIDC service that issued it
+// Verify validates an existing JWT token against the OIDC service that issued it.
+// Personal access tokens are checked against the auth service instead.
 func (j *JWTVerifier) Verify(ctx context.Context, rawIDToken string) (context.Context, claim.Claims, error) {
 
+	if IsPersonalAccessToken(rawIDToken) {
+		return verifyPersonalAccessToken(ctx, rawIDToken)
+	}
+
 	claims := claim.Claims{}
 
 	ctx = oidc.ClientContext(ctx, &http.Client{
@@ -159,9 +165,16 @@ func (j *JWTVerifier) Verify(ctx context.Context, rawIDToken string) (context.Co
 }
 
 // PasswordCredentialsToken will perform a call to the OIDC service with grantType "password"
-// to get a valid token from a given user/pass credentials
+// to get a valid token from a given user/pass credentials. Users having a second factor must
+// send their one-time password in the X-Pydio-Otp header, that is forwarded to the OIDC service.
 func (j *JWTVerifier) PasswordCredentialsToken(ctx context.Context, userName string, password string) (context.Context, claim.Claims, error) {
 
+	if meta, ok := metadata.FromContext(ctx); ok && meta[mfa.OTPHeader] != "" {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{
+			Transport: &otpTransport{code: meta[mfa.OTPHeader], base: http.DefaultTransport},
+		})
+	}
+
 	// Get JWT From Dex
 	provider, _ := oidc.NewProvider(ctx, j.IssuerUrl)
 	// Configure an OpenID Connect aware OAuth2 client.
@@ -171,7 +184,7 @@ func (j *JWTVerifier) PasswordCredentialsToken(ctx context.Context, userName str
 		// Discovery returns the OAuth2 endpoints.
 		Endpoint: provider.Endpoint(),
 		// "openid" is a required scope for OpenID Connect flows.
-		Scopes: []string{oidc.ScopeOpenID, "profile", "email", "pydio"},
+		Scopes: []string{oidc.ScopeOpenID, "profile", "email", "pydio", "groups"},
 	}
 
 	claims := claim.Claims{}
@@ -207,6 +220,23 @@ func (j *JWTVerifier) PasswordCredentialsToken(ctx context.Context, userName str
 
 }
 
+// otpTransport adds the one-time password header to the token requests.
+type otpTransport struct {
+	code string
+	base http.RoundTripper
+}
+
+func (t *otpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set(mfa.OTPHeader, t.code)
+	return t.base.RoundTrip(r)
+}
+
 // Add a fake Claims in context to impersonate user
 func WithImpersonate(ctx context.Context, user *idm.User) context.Context {
 	roles := make([]string, len(user.Roles))
@@ -222,6 +252,38 @@ func WithImpersonate(ctx context.Context, user *idm.User) context.Context {
 	return context.WithValue(ctx, claim.ContextKey, c)
 }
 
+// ClaimsFromUser builds the claims of a user authenticated without going through the OIDC
+// service, e.g. with access keys or SSH keys. Methods lists the authentication methods used.
+func ClaimsFromUser(user *idm.User, methods ...string) claim.Claims {
+	var roles []string
+	for _, r := range user.Roles {
+		roles = append(roles, r.Uuid)
+	}
+	return claim.Claims{
+		Name:        user.Login,
+		Profile:     user.Attributes["profile"],
+		DisplayName: user.Attributes["displayName"],
+		Roles:       strings.Join(roles, ","),
+		GroupPath:   user.GroupPath,
+		AuthMethods: methods,
+	}
+}
+
+// WithClaims registers the claims in context along with the user metadata, as done after a token verification.
+func WithClaims(ctx context.Context, claims claim.Claims) context.Context {
+	ctx = context.WithValue(ctx, claim.ContextKey, claims)
+	md := make(map[string]string)
+	if existing, ok := metadata.FromContext(ctx); ok {
+		for k, v := range existing {
+			md[k] = v
+		}
+	}
+	md[common.PYDIO_CONTEXT_USER_KEY] = claims.Name
+	jsonClaims, _ := json.Marshal(claims)
+	md[claim.MetadataContextKey] = string(jsonClaims)
+	return metadata.NewContext(ctx, md)
+}
+
 // SubjectsForResourcePolicyQuery prepares a slice of strings that will be used to check for resource ownership.
 // Can be extracted either from context or by loading a given user ID from database.
 func SubjectsForResourcePolicyQuery(ctx context.Context, q *rest.ResourcePolicyQuery) (subjects []string, err error) {
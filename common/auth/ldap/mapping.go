@@ -0,0 +1,363 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package ldap
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	goldap "gopkg.in/ldap.v2"
+
+	"github.com/pmker/yux/common/auth"
+	proto "github.com/pmker/yux/common/proto/auth"
+	"github.com/pmker/yux/common/proto/idm"
+)
+
+const (
+	// RightAttributeRoles is the reserved mapping target assigning roles to users
+	RightAttributeRoles = "Roles"
+	// RightAttributeGroupPath is the reserved mapping target placing users in a group
+	RightAttributeGroupPath = "GroupPath"
+
+	// Active Directory flags disabled accounts in this attribute
+	adControlAttribute = "userAccountControl"
+	adAccountDisable   = 0x2
+)
+
+// User is a directory entry converted by the mapping rules.
+type User struct {
+	DN         string
+	Login      string
+	GroupPath  string
+	Attributes map[string]string
+	Roles      []*idm.Role
+	// Disabled is set for Active Directory accounts flagged as disabled
+	Disabled bool
+}
+
+// group is a directory group, linked to its parent groups.
+type group struct {
+	dn      string
+	id      string
+	label   string
+	members []string
+	parents []*group
+}
+
+// Mapper converts user entries using the mapping rules of a server configuration. In mapping rules,
+// the left attribute is the directory attribute and the right attribute is the pydio user attribute,
+// or one of the reserved Roles and GroupPath targets.
+type Mapper struct {
+	Config *proto.LdapServerConfig
+	byDN   map[string]*group
+	byID   map[string]*group
+}
+
+// Mapper loads the directory groups needed by the memberOf mapping and returns a Mapper.
+func (s *Server) Mapper() (*Mapper, error) {
+
+	m := &Mapper{Config: s.Config, byDN: map[string]*group{}, byID: map[string]*group{}}
+	memberOf := s.Config.MemberOfMapping
+	if memberOf == nil || memberOf.GroupFilter == nil || len(memberOf.GroupFilter.DNs) == 0 {
+		return m, nil
+	}
+	idAttribute := memberOf.GroupFilter.IDAttribute
+	if idAttribute == "" {
+		idAttribute = "cn"
+	}
+	var entries []*goldap.Entry
+	attributes := []string{"*", memberOfAttribute(memberOf)}
+	err := s.Search(memberOf.GroupFilter, "", attributes, func(entry *goldap.Entry) error {
+		g := &group{
+			dn:      entry.DN,
+			id:      entry.GetAttributeValue(idAttribute),
+			label:   entry.GetAttributeValue(memberOf.GroupFilter.DisplayAttribute),
+			members: entry.GetAttributeValues(memberAttribute(memberOf)),
+		}
+		if g.id == "" {
+			g.id = firstRDNValue(g.dn)
+		}
+		if g.label == "" {
+			g.label = g.id
+		}
+		m.byDN[strings.ToLower(g.dn)] = g
+		m.byID[g.id] = g
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Link groups to their parents
+	if memberOf.RealMemberOf {
+		for _, entry := range entries {
+			g := m.byDN[strings.ToLower(entry.DN)]
+			for _, value := range entry.GetAttributeValues(memberOfAttribute(memberOf)) {
+				if parent := m.lookup(value, memberOf.RealMemberOfValueFormat); parent != nil && parent != g {
+					g.parents = append(g.parents, parent)
+				}
+			}
+		}
+	} else {
+		for _, parent := range m.byDN {
+			for _, member := range parent.members {
+				if g := m.lookup(member, memberOf.PydioMemberOfValueFormat); g != nil && g != parent {
+					g.parents = append(g.parents, parent)
+				}
+			}
+		}
+	}
+	return m, nil
+
+}
+
+// User converts a directory entry to a User.
+func (m *Mapper) User(entry *goldap.Entry) *User {
+
+	idAttribute := defaultIDAttribute
+	if m.Config.User != nil && m.Config.User.IDAttribute != "" {
+		idAttribute = m.Config.User.IDAttribute
+	}
+	u := &User{
+		DN:         entry.DN,
+		Login:      entry.GetAttributeValue(idAttribute),
+		Attributes: map[string]string{},
+	}
+	if m.Config.User != nil && m.Config.User.DisplayAttribute != "" {
+		if display := entry.GetAttributeValue(m.Config.User.DisplayAttribute); display != "" {
+			u.Attributes["displayName"] = display
+		}
+	}
+	for _, mapping := range m.Config.MappingRules {
+		m.apply(u, mapping, entry.GetAttributeValues(mapping.LeftAttribute), nil)
+	}
+	if memberOf := m.Config.MemberOfMapping; memberOf != nil && memberOf.Mapping != nil {
+		var ids []string
+		labels := map[string]string{}
+		for _, g := range m.memberOf(entry, u.Login) {
+			ids = append(ids, g.id)
+			labels[g.id] = g.label
+		}
+		m.apply(u, memberOf.Mapping, ids, labels)
+	}
+	if control, err := strconv.Atoi(entry.GetAttributeValue(adControlAttribute)); err == nil {
+		u.Disabled = control&adAccountDisable != 0
+	}
+	return u
+
+}
+
+// apply converts values with a mapping rule and stores them in the user. Labels optionally
+// give the display names of roles.
+func (m *Mapper) apply(u *User, mapping *proto.LdapMapping, values []string, labels map[string]string) {
+
+	rule := auth.MappingRule{
+		LeftAttribute:  mapping.LeftAttribute,
+		RightAttribute: mapping.RightAttribute,
+		RuleString:     mapping.RuleString,
+		RolePrefix:     mapping.RolePrefix,
+	}
+	values = rule.SanitizeValues(values)
+	switch mapping.RightAttribute {
+	case RightAttributeRoles:
+		values = filterValues(rule, rule.ConvertDNtoName(values))
+		prefix := rolePrefix(m.Config, mapping)
+		for _, value := range values {
+			label := value
+			if l, ok := labels[value]; ok {
+				label = l
+			}
+			u.Roles = append(u.Roles, &idm.Role{Uuid: prefix + value, Label: label})
+		}
+	case RightAttributeGroupPath:
+		if values = filterValues(rule, values); len(values) > 0 {
+			u.GroupPath = groupPath(rule, values[0])
+		}
+	default:
+		if values = filterValues(rule, values); len(values) > 0 {
+			u.Attributes[mapping.RightAttribute] = strings.Join(values, ",")
+		}
+	}
+
+}
+
+// memberOf lists the groups of a user entry, including parent groups if nested groups are supported.
+func (m *Mapper) memberOf(entry *goldap.Entry, login string) []*group {
+
+	memberOf := m.Config.MemberOfMapping
+	var direct []*group
+	if memberOf.RealMemberOf {
+		for _, value := range entry.GetAttributeValues(memberOfAttribute(memberOf)) {
+			if g := m.lookup(value, memberOf.RealMemberOfValueFormat); g != nil {
+				direct = append(direct, g)
+			} else {
+				// Group is outside of the groups filter, use its name
+				id := value
+				if !strings.EqualFold(memberOf.RealMemberOfValueFormat, "id") {
+					id = firstRDNValue(value)
+				}
+				direct = append(direct, &group{dn: value, id: id, label: id})
+			}
+		}
+	} else {
+		userValue := entry.DN
+		if strings.EqualFold(memberOf.PydioMemberOfValueFormat, "id") {
+			userValue = login
+		}
+		for _, g := range m.byDN {
+			for _, member := range g.members {
+				if strings.EqualFold(member, userValue) {
+					direct = append(direct, g)
+					break
+				}
+			}
+		}
+	}
+	sort.Slice(direct, func(i, j int) bool {
+		return direct[i].id < direct[j].id
+	})
+	if !memberOf.SupportNestedGroup {
+		return direct
+	}
+	var all []*group
+	seen := map[*group]bool{}
+	queue := direct
+	for len(queue) > 0 {
+		g := queue[0]
+		queue = queue[1:]
+		if seen[g] {
+			continue
+		}
+		seen[g] = true
+		all = append(all, g)
+		queue = append(queue, g.parents...)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].id < all[j].id
+	})
+	return all
+
+}
+
+// lookup finds a loaded group by DN or ID, depending on the value format.
+func (m *Mapper) lookup(value string, format string) *group {
+	if strings.EqualFold(format, "id") {
+		return m.byID[value]
+	}
+	return m.byDN[strings.ToLower(value)]
+}
+
+// RolePrefixes lists the prefixes of the roles managed by a server configuration.
+func RolePrefixes(config *proto.LdapServerConfig) []string {
+	var prefixes []string
+	mappings := append([]*proto.LdapMapping{}, config.MappingRules...)
+	if config.MemberOfMapping != nil && config.MemberOfMapping.Mapping != nil {
+		mappings = append(mappings, config.MemberOfMapping.Mapping)
+	}
+	for _, mapping := range mappings {
+		if mapping.RightAttribute != RightAttributeRoles {
+			continue
+		}
+		if prefix := rolePrefix(config, mapping); prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+func rolePrefix(config *proto.LdapServerConfig, mapping *proto.LdapMapping) string {
+	if mapping.RolePrefix != "" {
+		return mapping.RolePrefix
+	}
+	return config.RolePrefix
+}
+
+// filterValues keeps the values accepted by the rule string, either a "preg:" regexp or a comma separated list.
+func filterValues(rule auth.MappingRule, values []string) []string {
+	if rule.RuleString == "" {
+		return values
+	}
+	if strings.HasPrefix(rule.RuleString, "preg:") {
+		return rule.FilterPreg(rule.RuleString, values)
+	}
+	return rule.FilterList(rule.SanitizeValues(strings.Split(rule.RuleString, ",")), values)
+}
+
+// groupPath converts a value to a group path. DNs are converted by reversing their RDNs, ignoring
+// domain components, so that "ou=sales,ou=people,dc=example,dc=com" becomes "/people/sales".
+func groupPath(rule auth.MappingRule, value string) string {
+	if !rule.IsDnFormat(value) {
+		return "/" + strings.Trim(value, "/")
+	}
+	var parts []string
+	for _, rdn := range splitDN(value) {
+		kv := strings.SplitN(rdn, "=", 2)
+		if len(kv) != 2 || strings.EqualFold(strings.TrimSpace(kv[0]), "dc") {
+			continue
+		}
+		parts = append([]string{strings.TrimSpace(kv[1])}, parts...)
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// splitDN splits a DN on its unescaped commas.
+func splitDN(dn string) []string {
+	var parts []string
+	var current []rune
+	escaped := false
+	for _, r := range dn {
+		switch {
+		case escaped:
+			current = append(current, r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ',':
+			parts = append(parts, string(current))
+			current = current[:0]
+		default:
+			current = append(current, r)
+		}
+	}
+	return append(parts, string(current))
+}
+
+func firstRDNValue(dn string) string {
+	if names := (auth.MappingRule{}).ConvertDNtoName([]string{dn}); len(names) > 0 {
+		return names[0]
+	}
+	return dn
+}
+
+func memberOfAttribute(m *proto.LdapMemberOfMapping) string {
+	if m.RealMemberOfAttribute != "" {
+		return m.RealMemberOfAttribute
+	}
+	return defaultMemberOf
+}
+
+func memberAttribute(m *proto.LdapMemberOfMapping) string {
+	if m.PydioMemberOfAttribute != "" {
+		return m.PydioMemberOfAttribute
+	}
+	return defaultMember
+}
@@ -0,0 +1,284 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+// Package ldap connects to LDAP and Active Directory servers described by an LdapServerConfig,
+// maps their entries to pydio users, groups and roles, and synchronises them with the idm services.
+package ldap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+
+	goldap "gopkg.in/ldap.v2"
+
+	"github.com/pmker/yux/common/proto/auth"
+)
+
+const (
+	defaultPageSize    = 500
+	defaultIDAttribute = "uid"
+	defaultMemberOf    = "memberOf"
+	defaultMember      = "member"
+)
+
+var (
+	// ErrUserNotFound is returned when no entry matches a login.
+	ErrUserNotFound = errors.New("user not found in directory")
+	// ErrInvalidCredentials is returned when the server refuses the user password.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Server is a connection to the directory described by its Config.
+type Server struct {
+	Config *auth.LdapServerConfig
+	conn   *goldap.Conn
+}
+
+// NewServer creates a Server for the given configuration. The ConfigId identifies the users
+// synchronised from this server and defaults to the DomainName.
+func NewServer(config *auth.LdapServerConfig) *Server {
+	if config.ConfigId == "" {
+		config.ConfigId = config.DomainName
+	}
+	return &Server{Config: config}
+}
+
+// Connect dials the server using the configured connection type ("normal", "ssl" or "starttls")
+// and binds with the service account, if any.
+func (s *Server) Connect() error {
+
+	if s.conn != nil {
+		return nil
+	}
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return err
+	}
+	var conn *goldap.Conn
+	switch strings.ToLower(s.Config.Connection) {
+	case "ssl":
+		conn, err = goldap.DialTLS("tcp", s.Config.Host, tlsConfig)
+	case "starttls":
+		if conn, err = goldap.Dial("tcp", s.Config.Host); err == nil {
+			if err = conn.StartTLS(tlsConfig); err != nil {
+				conn.Close()
+			}
+		}
+	default:
+		conn, err = goldap.Dial("tcp", s.Config.Host)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot connect to %s: %v", s.Config.Host, err)
+	}
+	s.conn = conn
+	if err := s.bindService(); err != nil {
+		s.Close()
+		return fmt.Errorf("cannot bind to %s as %s: %v", s.Config.Host, s.Config.BindDN, err)
+	}
+	return nil
+
+}
+
+// Close closes the connection.
+func (s *Server) Close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// Search pages through the entries matching the filter under each of its DNs, restricted by an
+// optional extra filter, and calls callback for each entry.
+func (s *Server) Search(filter *auth.LdapSearchFilter, extraFilter string, attributes []string, callback func(entry *goldap.Entry) error) error {
+
+	if filter == nil {
+		return fmt.Errorf("missing search filter")
+	}
+	if err := s.Connect(); err != nil {
+		return err
+	}
+	query := combineFilters(filter.Filter, extraFilter)
+	pageSize := uint32(defaultPageSize)
+	if s.Config.PageSize > 0 {
+		pageSize = uint32(s.Config.PageSize)
+	}
+	for _, dn := range filter.DNs {
+		paging := goldap.NewControlPaging(pageSize)
+		for {
+			request := goldap.NewSearchRequest(dn, searchScope(filter.Scope), goldap.NeverDerefAliases, 0, 0, false, query, attributes, []goldap.Control{paging})
+			result, err := s.conn.Search(request)
+			if err != nil {
+				return fmt.Errorf("cannot search %s: %v", dn, err)
+			}
+			for _, entry := range result.Entries {
+				if err := callback(entry); err != nil {
+					return err
+				}
+			}
+			control, ok := goldap.FindControl(result.Controls, goldap.ControlTypePaging).(*goldap.ControlPaging)
+			if !ok || len(control.Cookie) == 0 {
+				break
+			}
+			paging.SetCookie(control.Cookie)
+		}
+	}
+	return nil
+
+}
+
+// FindUser loads the user entry matching a login.
+func (s *Server) FindUser(login string) (*goldap.Entry, error) {
+
+	var found []*goldap.Entry
+	extraFilter := fmt.Sprintf("(%s=%s)", s.idAttribute(), goldap.EscapeFilter(login))
+	err := s.Search(s.Config.User, extraFilter, s.userAttributes(), func(entry *goldap.Entry) error {
+		found = append(found, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, ErrUserNotFound
+	} else if len(found) > 1 {
+		return nil, fmt.Errorf("login %s matches %d entries", login, len(found))
+	}
+	return found[0], nil
+
+}
+
+// Authenticate checks a login and password by binding with the user DN, then restores the
+// service account binding.
+func (s *Server) Authenticate(login, password string) (*goldap.Entry, error) {
+
+	// An empty password would be an unauthenticated bind, accepted by most servers
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	entry, err := s.FindUser(login)
+	if err != nil {
+		return nil, err
+	}
+	bindErr := s.conn.Bind(entry.DN, password)
+	if s.Config.BindDN == "" {
+		// There is no way back to an anonymous binding: reconnect on next call
+		s.Close()
+	} else if err := s.bindService(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	if bindErr != nil {
+		if e, ok := bindErr.(*goldap.Error); ok && e.ResultCode == goldap.LDAPResultInvalidCredentials {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, bindErr
+	}
+	return entry, nil
+
+}
+
+func (s *Server) bindService() error {
+	if s.Config.BindDN == "" {
+		return nil
+	}
+	return s.conn.Bind(s.Config.BindDN, s.Config.BindPW)
+}
+
+func (s *Server) tlsConfig() (*tls.Config, error) {
+
+	host := s.Config.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	config := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: s.Config.SkipVerifyCertificate,
+	}
+	var caData []byte
+	if s.Config.RootCAData != "" {
+		if decoded, err := base64.StdEncoding.DecodeString(s.Config.RootCAData); err == nil {
+			caData = decoded
+		} else {
+			caData = []byte(s.Config.RootCAData)
+		}
+	} else if s.Config.RootCA != "" {
+		data, err := ioutil.ReadFile(s.Config.RootCA)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read root CA %s: %v", s.Config.RootCA, err)
+		}
+		caData = data
+	}
+	if caData != nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("no valid certificate found in root CA")
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+
+}
+
+func (s *Server) idAttribute() string {
+	if s.Config.User != nil && s.Config.User.IDAttribute != "" {
+		return s.Config.User.IDAttribute
+	}
+	return defaultIDAttribute
+}
+
+// userAttributes requests all user attributes, plus the memberOf attribute that is operational on some servers.
+func (s *Server) userAttributes() []string {
+	attributes := []string{"*"}
+	if m := s.Config.MemberOfMapping; m != nil && m.RealMemberOf {
+		attributes = append(attributes, memberOfAttribute(m))
+	}
+	return attributes
+}
+
+// searchScope converts the configured scope, defaulting to the whole subtree.
+func searchScope(scope string) int {
+	switch strings.ToLower(scope) {
+	case "base":
+		return goldap.ScopeBaseObject
+	case "one":
+		return goldap.ScopeSingleLevel
+	}
+	return goldap.ScopeWholeSubtree
+}
+
+// combineFilters ANDs an optional extra filter with the configured one.
+func combineFilters(filter string, extra string) string {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		filter = "(objectClass=*)"
+	} else if !strings.HasPrefix(filter, "(") {
+		filter = "(" + filter + ")"
+	}
+	if extra == "" {
+		return filter
+	}
+	return "(&" + filter + extra + ")"
+}
@@ -0,0 +1,270 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	goldap "gopkg.in/ldap.v2"
+
+	commonauth "github.com/pmker/yux/common/auth"
+	"github.com/pmker/yux/common/proto/auth"
+)
+
+const (
+	peopleDN = "ou=people,dc=example,dc=com"
+	groupsDN = "ou=groups,dc=example,dc=com"
+)
+
+func testDirectory() []*testEntry {
+	person := func(uid, cn string, extra map[string][]string) *testEntry {
+		attributes := map[string][]string{
+			"objectClass": {"inetOrgPerson"},
+			"uid":         {uid},
+			"cn":          {cn},
+			"mail":        {uid + "@example.com"},
+		}
+		for k, v := range extra {
+			attributes[k] = v
+		}
+		return &testEntry{dn: "uid=" + uid + "," + peopleDN, attributes: attributes}
+	}
+	group := func(cn, description string, members []string, memberOf []string) *testEntry {
+		return &testEntry{dn: "cn=" + cn + "," + groupsDN, attributes: map[string][]string{
+			"objectClass": {"groupOfNames"},
+			"cn":          {cn},
+			"description": {description},
+			"member":      members,
+			"memberOf":    memberOf,
+		}}
+	}
+	return []*testEntry{
+		person("alice", "Alice Liddell", map[string][]string{
+			"employeeType": {"teacher", "visitor"},
+			"ou":           {"sales"},
+			"memberOf":     {"cn=staff," + groupsDN, "cn=admins," + groupsDN},
+		}),
+		person("bob", "Bob Morane", map[string][]string{
+			"employeeType": {"researcher"},
+			"memberOf":     {"cn=staff," + groupsDN},
+		}),
+		person("carol", "Carol Danvers", map[string][]string{"userAccountControl": {"514"}}),
+		person("dave", "Dave Bowman", nil),
+		person("eve", "Eve Polastri", nil),
+		group("staff", "Staff", []string{"uid=alice," + peopleDN, "uid=bob," + peopleDN}, []string{"cn=everyone," + groupsDN}),
+		group("admins", "Administrators", []string{"uid=alice," + peopleDN}, nil),
+		group("everyone", "Everyone", []string{"cn=staff," + groupsDN}, nil),
+	}
+}
+
+func testConfig(host string) *auth.LdapServerConfig {
+	return &auth.LdapServerConfig{
+		DomainName: "example.com",
+		Host:       host,
+		BindDN:     "cn=admin,dc=example,dc=com",
+		BindPW:     "secret",
+		PageSize:   2,
+		User: &auth.LdapSearchFilter{
+			DNs:              []string{peopleDN},
+			Filter:           "(objectClass=inetOrgPerson)",
+			IDAttribute:      "uid",
+			DisplayAttribute: "cn",
+		},
+		MappingRules: []*auth.LdapMapping{
+			{LeftAttribute: "mail", RightAttribute: "email"},
+			{LeftAttribute: "employeeType", RightAttribute: RightAttributeRoles, RuleString: "teacher,researcher", RolePrefix: "ldap_"},
+			{LeftAttribute: "ou", RightAttribute: RightAttributeGroupPath},
+		},
+		MemberOfMapping: &auth.LdapMemberOfMapping{
+			Mapping: &auth.LdapMapping{LeftAttribute: "memberOf", RightAttribute: RightAttributeRoles, RolePrefix: "group_"},
+			GroupFilter: &auth.LdapSearchFilter{
+				DNs:              []string{groupsDN},
+				Filter:           "(objectClass=groupOfNames)",
+				IDAttribute:      "cn",
+				DisplayAttribute: "description",
+			},
+		},
+	}
+}
+
+func testPasswords() map[string]string {
+	return map[string]string{
+		"cn=admin,dc=example,dc=com": "secret",
+		"uid=alice," + peopleDN:      "alice-pw",
+	}
+}
+
+func TestSearch(t *testing.T) {
+
+	Convey("Page through all users", t, func() {
+		ts := startTestServer(t, testDirectory(), testPasswords())
+		defer ts.Close()
+		server := NewServer(testConfig(ts.Addr()))
+		defer server.Close()
+
+		So(server.Config.ConfigId, ShouldEqual, "example.com")
+		var logins []string
+		err := server.Search(server.Config.User, "", server.userAttributes(), func(entry *goldap.Entry) error {
+			logins = append(logins, entry.GetAttributeValue("uid"))
+			return nil
+		})
+		So(err, ShouldBeNil)
+		So(logins, ShouldResemble, []string{"alice", "bob", "carol", "dave", "eve"})
+		So(ts.searches, ShouldEqual, 3)
+	})
+
+	Convey("Refuse a wrong service account", t, func() {
+		ts := startTestServer(t, testDirectory(), testPasswords())
+		defer ts.Close()
+		config := testConfig(ts.Addr())
+		config.BindPW = "wrong"
+		server := NewServer(config)
+		So(server.Connect(), ShouldNotBeNil)
+	})
+
+}
+
+func TestAuthenticate(t *testing.T) {
+
+	Convey("Bind users with their password", t, func() {
+		ts := startTestServer(t, testDirectory(), testPasswords())
+		defer ts.Close()
+		server := NewServer(testConfig(ts.Addr()))
+		defer server.Close()
+
+		entry, err := server.Authenticate("alice", "alice-pw")
+		So(err, ShouldBeNil)
+		So(entry.DN, ShouldEqual, "uid=alice,"+peopleDN)
+
+		_, err = server.Authenticate("alice", "wrong")
+		So(err, ShouldEqual, ErrInvalidCredentials)
+		_, err = server.Authenticate("alice", "")
+		So(err, ShouldEqual, ErrInvalidCredentials)
+		_, err = server.Authenticate("nobody", "pw")
+		So(err, ShouldEqual, ErrUserNotFound)
+
+		// Service binding is restored after a user bind
+		entry, err = server.FindUser("bob")
+		So(err, ShouldBeNil)
+		So(entry.GetAttributeValue("cn"), ShouldEqual, "Bob Morane")
+	})
+
+}
+
+func TestMapper(t *testing.T) {
+
+	Convey("Map attributes, roles and group path", t, func() {
+		ts := startTestServer(t, testDirectory(), testPasswords())
+		defer ts.Close()
+		server := NewServer(testConfig(ts.Addr()))
+		defer server.Close()
+		mapper, err := server.Mapper()
+		So(err, ShouldBeNil)
+
+		entry, _ := server.FindUser("alice")
+		u := mapper.User(entry)
+		So(u.Login, ShouldEqual, "alice")
+		So(u.Attributes["displayName"], ShouldEqual, "Alice Liddell")
+		So(u.Attributes["email"], ShouldEqual, "alice@example.com")
+		So(u.GroupPath, ShouldEqual, "/sales")
+		So(roleIds(u), ShouldResemble, []string{"ldap_teacher", "group_admins", "group_staff"})
+		So(u.Roles[1].Label, ShouldEqual, "Administrators")
+		So(u.Disabled, ShouldBeFalse)
+
+		entry, _ = server.FindUser("carol")
+		u = mapper.User(entry)
+		So(u.Disabled, ShouldBeTrue)
+		So(u.Roles, ShouldBeEmpty)
+		So(u.GroupPath, ShouldEqual, "")
+	})
+
+	Convey("Resolve nested groups from members", t, func() {
+		ts := startTestServer(t, testDirectory(), testPasswords())
+		defer ts.Close()
+		config := testConfig(ts.Addr())
+		config.MemberOfMapping.SupportNestedGroup = true
+		server := NewServer(config)
+		defer server.Close()
+		mapper, err := server.Mapper()
+		So(err, ShouldBeNil)
+
+		entry, _ := server.FindUser("bob")
+		So(roleIds(mapper.User(entry)), ShouldResemble, []string{"ldap_researcher", "group_everyone", "group_staff"})
+	})
+
+	Convey("Resolve nested groups from the memberOf attribute", t, func() {
+		ts := startTestServer(t, testDirectory(), testPasswords())
+		defer ts.Close()
+		config := testConfig(ts.Addr())
+		config.MemberOfMapping.RealMemberOf = true
+		config.MemberOfMapping.SupportNestedGroup = true
+		config.MemberOfMapping.Mapping.RuleString = "preg:^(staff|everyone)$"
+		server := NewServer(config)
+		defer server.Close()
+		mapper, err := server.Mapper()
+		So(err, ShouldBeNil)
+
+		entry, _ := server.FindUser("alice")
+		u := mapper.User(entry)
+		So(roleIds(u), ShouldResemble, []string{"ldap_teacher", "group_everyone", "group_staff"})
+		So(u.Roles[1].Label, ShouldEqual, "Everyone")
+	})
+
+	Convey("List managed role prefixes", t, func() {
+		config := testConfig("")
+		config.RolePrefix = "dir_"
+		config.MappingRules = append(config.MappingRules, &auth.LdapMapping{LeftAttribute: "title", RightAttribute: RightAttributeRoles})
+		So(RolePrefixes(config), ShouldResemble, []string{"ldap_", "dir_", "group_"})
+		So(config.MappingRules, ShouldHaveLength, 4)
+	})
+
+}
+
+func TestHelpers(t *testing.T) {
+
+	Convey("Combine filters", t, func() {
+		So(combineFilters("", ""), ShouldEqual, "(objectClass=*)")
+		So(combineFilters("objectClass=person", ""), ShouldEqual, "(objectClass=person)")
+		So(combineFilters("(objectClass=person)", "(uid=a)"), ShouldEqual, "(&(objectClass=person)(uid=a))")
+	})
+
+	Convey("Convert values to group paths", t, func() {
+		rule := testMappingRule()
+		So(groupPath(rule, "sales"), ShouldEqual, "/sales")
+		So(groupPath(rule, "/sales/emea/"), ShouldEqual, "/sales/emea")
+		So(groupPath(rule, "ou=emea,ou=sales,dc=example,dc=com"), ShouldEqual, "/sales/emea")
+		So(groupPath(rule, `ou=a\,b,dc=example,dc=com`), ShouldEqual, "/a,b")
+	})
+
+}
+
+func testMappingRule() commonauth.MappingRule {
+	return commonauth.MappingRule{RightAttribute: RightAttributeGroupPath}
+}
+
+func roleIds(u *User) []string {
+	var ids []string
+	for _, r := range u.Roles {
+		ids = append(ids, r.Uuid)
+	}
+	return ids
+}
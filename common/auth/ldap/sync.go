@@ -0,0 +1,346 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package ldap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+	"go.uber.org/zap"
+	goldap "gopkg.in/ldap.v2"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/proto/idm"
+	service "github.com/pmker/yux/common/service/proto"
+)
+
+const (
+	// AttributeAuthSource stores the ConfigId of the directory a user is synchronised from.
+	AttributeAuthSource = "authSource"
+	// attributeSyncLock flags users locked by the synchronisation, to unlock them when they come back.
+	// It is "true" if the synchronisation set the logout lock, or "kept" if the user was already locked.
+	attributeSyncLock = "authSourceLocked"
+	syncLockSet       = "true"
+	syncLockKept      = "kept"
+	logoutLock        = "logout"
+)
+
+var errMissingConfigId = errors.New("ldap server configuration requires a ConfigId or a DomainName")
+
+// SyncReport counts the changes applied by a synchronisation.
+type SyncReport struct {
+	Created int
+	Updated int
+	Locked  int
+	Deleted int
+	Errors  int
+}
+
+// Syncer writes directory users to the idm services.
+type Syncer struct {
+	Server     *Server
+	UserClient idm.UserServiceClient
+	RoleClient idm.RoleServiceClient
+	// DeleteMissing deletes users that are no longer found in the directory, instead of locking them.
+	DeleteMissing bool
+
+	mapper *Mapper
+	roles  map[string]bool
+}
+
+// NewSyncer creates a Syncer using the default idm clients.
+func NewSyncer(server *Server) *Syncer {
+	return &Syncer{
+		Server:     server,
+		UserClient: idm.NewUserServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_USER, defaults.NewClient()),
+		RoleClient: idm.NewRoleServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_ROLE, defaults.NewClient()),
+		roles:      map[string]bool{},
+	}
+}
+
+// Sync pages through all directory users, creates or updates them, and locks or deletes the users
+// previously synchronised from this directory that have disappeared.
+func (s *Syncer) Sync(ctx context.Context) (*SyncReport, error) {
+
+	report := &SyncReport{}
+	if s.Server.Config.ConfigId == "" {
+		return report, errMissingConfigId
+	}
+	defer s.Server.Close()
+	mapper, err := s.Server.Mapper()
+	if err != nil {
+		return report, err
+	}
+	s.mapper = mapper
+
+	seen := map[string]bool{}
+	err = s.Server.Search(s.Server.Config.User, "", s.Server.userAttributes(), func(entry *goldap.Entry) error {
+		u := mapper.User(entry)
+		if u.Login == "" {
+			return nil
+		}
+		seen[u.Login] = true
+		_, created, e := s.save(ctx, u)
+		if e != nil {
+			log.Logger(ctx).Error("Cannot synchronise user", zap.String(common.KEY_USERNAME, u.Login), zap.Error(e))
+			report.Errors++
+		} else if created {
+			report.Created++
+		} else {
+			report.Updated++
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	existing, err := s.searchUsers(ctx, &idm.UserSingleQuery{AttributeName: AttributeAuthSource, AttributeValue: s.Server.Config.ConfigId})
+	if err != nil {
+		return report, err
+	}
+	for _, user := range existing {
+		if seen[user.Login] {
+			continue
+		}
+		if s.DeleteMissing {
+			query, _ := ptypes.MarshalAny(&idm.UserSingleQuery{Uuid: user.Uuid})
+			if _, e := s.UserClient.DeleteUser(ctx, &idm.DeleteUserRequest{Query: &service.Query{SubQueries: []*any.Any{query}}}); e != nil {
+				log.Logger(ctx).Error("Cannot delete user", zap.String(common.KEY_USERNAME, user.Login), zap.Error(e))
+				report.Errors++
+			} else {
+				report.Deleted++
+			}
+		} else if setLock(user, true) {
+			if _, e := s.UserClient.CreateUser(ctx, &idm.CreateUserRequest{User: user}); e != nil {
+				log.Logger(ctx).Error("Cannot lock user", zap.String(common.KEY_USERNAME, user.Login), zap.Error(e))
+				report.Errors++
+			} else {
+				report.Locked++
+			}
+		}
+	}
+	return report, nil
+
+}
+
+// SyncEntry creates or updates a single user from its directory entry.
+func (s *Syncer) SyncEntry(ctx context.Context, entry *goldap.Entry) (*idm.User, error) {
+	if s.Server.Config.ConfigId == "" {
+		return nil, errMissingConfigId
+	}
+	if s.mapper == nil {
+		mapper, err := s.Server.Mapper()
+		if err != nil {
+			return nil, err
+		}
+		s.mapper = mapper
+	}
+	user, _, err := s.save(ctx, s.mapper.User(entry))
+	return user, err
+}
+
+// save creates the user roles if necessary, then creates or updates the user.
+func (s *Syncer) save(ctx context.Context, u *User) (*idm.User, bool, error) {
+
+	found, err := s.searchUsers(ctx, &idm.UserSingleQuery{Login: u.Login})
+	if err != nil {
+		return nil, false, err
+	}
+	var existing *idm.User
+	if len(found) > 0 {
+		existing = found[0]
+		if source := existing.Attributes[AttributeAuthSource]; source != s.Server.Config.ConfigId {
+			return nil, false, fmt.Errorf("login %s is already used by another authentication source", u.Login)
+		}
+	}
+	for _, role := range u.Roles {
+		if err := s.ensureRole(ctx, role); err != nil {
+			return nil, false, err
+		}
+	}
+	resp, err := s.UserClient.CreateUser(ctx, &idm.CreateUserRequest{
+		User: mergeUser(existing, u, s.Server.Config.ConfigId, RolePrefixes(s.Server.Config)),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return resp.User, existing == nil, nil
+
+}
+
+// ensureRole creates a role if it does not exist yet.
+func (s *Syncer) ensureRole(ctx context.Context, role *idm.Role) error {
+
+	if s.roles[role.Uuid] {
+		return nil
+	}
+	query, _ := ptypes.MarshalAny(&idm.RoleSingleQuery{Uuid: []string{role.Uuid}})
+	stream, err := s.RoleClient.SearchRole(ctx, &idm.SearchRoleRequest{Query: &service.Query{SubQueries: []*any.Any{query}}})
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	exists := false
+	for {
+		resp, e := stream.Recv()
+		if e != nil {
+			break
+		}
+		if resp != nil && resp.Role != nil {
+			exists = true
+		}
+	}
+	if !exists {
+		if _, err := s.RoleClient.CreateRole(ctx, &idm.CreateRoleRequest{Role: &idm.Role{Uuid: role.Uuid, Label: role.Label}}); err != nil {
+			return err
+		}
+	}
+	s.roles[role.Uuid] = true
+	return nil
+
+}
+
+func (s *Syncer) searchUsers(ctx context.Context, q *idm.UserSingleQuery) ([]*idm.User, error) {
+
+	query, _ := ptypes.MarshalAny(q)
+	stream, err := s.UserClient.SearchUser(ctx, &idm.SearchUserRequest{Query: &service.Query{SubQueries: []*any.Any{query}}})
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	var users []*idm.User
+	for {
+		resp, e := stream.Recv()
+		if e != nil {
+			break
+		}
+		if resp != nil && resp.User != nil && !resp.User.IsGroup {
+			users = append(users, resp.User)
+		}
+	}
+	return users, nil
+
+}
+
+// mergeUser applies a directory user on top of the existing idm user, if any. Roles that are not
+// managed by the directory and attributes that are not mapped are preserved.
+func mergeUser(existing *idm.User, u *User, configId string, rolePrefixes []string) *idm.User {
+
+	user := &idm.User{
+		Login:      u.Login,
+		GroupPath:  u.GroupPath,
+		Attributes: map[string]string{},
+	}
+	if existing != nil {
+		user.Uuid = existing.Uuid
+		user.Policies = existing.Policies
+		if user.GroupPath == "" {
+			user.GroupPath = existing.GroupPath
+		}
+		for k, v := range existing.Attributes {
+			user.Attributes[k] = v
+		}
+		for _, role := range existing.Roles {
+			if role.UserRole || role.GroupRole || managedRole(role.Uuid, rolePrefixes) {
+				continue
+			}
+			user.Roles = append(user.Roles, role)
+		}
+	}
+	if user.GroupPath == "" {
+		user.GroupPath = "/"
+	}
+	for k, v := range u.Attributes {
+		user.Attributes[k] = v
+	}
+	if user.Attributes["profile"] == "" {
+		user.Attributes["profile"] = common.PYDIO_PROFILE_STANDARD
+	}
+	user.Attributes[AttributeAuthSource] = configId
+	user.Roles = append(user.Roles, u.Roles...)
+	setLock(user, u.Disabled)
+	return user
+
+}
+
+func managedRole(uuid string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(uuid, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// setLock adds or removes the logout lock set by the synchronisation, and reports whether the user changed.
+// Locks set by administrators are left untouched.
+func setLock(user *idm.User, locked bool) bool {
+
+	if user.Attributes == nil {
+		user.Attributes = map[string]string{}
+	}
+	syncLock, syncLocked := user.Attributes[attributeSyncLock]
+	if locked == syncLocked {
+		return false
+	}
+	var locks []string
+	if l, ok := user.Attributes["locks"]; ok {
+		json.Unmarshal([]byte(l), &locks)
+	}
+	if locked {
+		for _, lock := range locks {
+			if lock == logoutLock {
+				user.Attributes[attributeSyncLock] = syncLockKept
+				return true
+			}
+		}
+		locks = append(locks, logoutLock)
+		user.Attributes[attributeSyncLock] = syncLockSet
+	} else {
+		delete(user.Attributes, attributeSyncLock)
+		if syncLock != syncLockSet {
+			return true
+		}
+		var newLocks []string
+		for _, lock := range locks {
+			if lock != logoutLock {
+				newLocks = append(newLocks, lock)
+			}
+		}
+		locks = newLocks
+	}
+	if len(locks) == 0 {
+		delete(user.Attributes, "locks")
+	} else {
+		data, _ := json.Marshal(locks)
+		user.Attributes["locks"] = string(data)
+	}
+	return true
+
+}
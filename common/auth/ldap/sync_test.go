@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package ldap
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/proto/idm"
+)
+
+func TestMergeUser(t *testing.T) {
+
+	Convey("Create a new user", t, func() {
+		u := &User{
+			Login:      "alice",
+			Attributes: map[string]string{"displayName": "Alice"},
+			Roles:      []*idm.Role{{Uuid: "ldap_teacher"}},
+		}
+		user := mergeUser(nil, u, "example.com", []string{"ldap_"})
+		So(user.Uuid, ShouldBeEmpty)
+		So(user.GroupPath, ShouldEqual, "/")
+		So(user.Attributes["displayName"], ShouldEqual, "Alice")
+		So(user.Attributes["profile"], ShouldEqual, "standard")
+		So(user.Attributes[AttributeAuthSource], ShouldEqual, "example.com")
+		So(user.Roles, ShouldHaveLength, 1)
+		So(user.Attributes["locks"], ShouldBeEmpty)
+	})
+
+	Convey("Update an existing user", t, func() {
+		existing := &idm.User{
+			Uuid:      "uuid-alice",
+			Login:     "alice",
+			GroupPath: "/sales",
+			Attributes: map[string]string{
+				"displayName":       "Old",
+				"profile":           "admin",
+				"parameter:lang":    "fr",
+				AttributeAuthSource: "example.com",
+			},
+			Roles: []*idm.Role{
+				{Uuid: "editors"},
+				{Uuid: "ldap_old"},
+				{Uuid: "uuid-alice", UserRole: true},
+			},
+		}
+		u := &User{
+			Login:      "alice",
+			Attributes: map[string]string{"displayName": "Alice"},
+			Roles:      []*idm.Role{{Uuid: "ldap_teacher"}},
+		}
+		user := mergeUser(existing, u, "example.com", []string{"ldap_"})
+		So(user.Uuid, ShouldEqual, "uuid-alice")
+		So(user.GroupPath, ShouldEqual, "/sales")
+		So(user.Attributes["displayName"], ShouldEqual, "Alice")
+		So(user.Attributes["profile"], ShouldEqual, "admin")
+		So(user.Attributes["parameter:lang"], ShouldEqual, "fr")
+		So(user.Roles, ShouldHaveLength, 2)
+		So(user.Roles[0].Uuid, ShouldEqual, "editors")
+		So(user.Roles[1].Uuid, ShouldEqual, "ldap_teacher")
+	})
+
+	Convey("Lock disabled users and unlock them when enabled again", t, func() {
+		existing := &idm.User{
+			Login:      "carol",
+			Attributes: map[string]string{"locks": `["pass_change"]`},
+		}
+		user := mergeUser(existing, &User{Login: "carol", Disabled: true}, "example.com", nil)
+		So(user.Attributes["locks"], ShouldEqual, `["pass_change","logout"]`)
+		So(user.Attributes[attributeSyncLock], ShouldEqual, "true")
+
+		user = mergeUser(user, &User{Login: "carol"}, "example.com", nil)
+		So(user.Attributes["locks"], ShouldEqual, `["pass_change"]`)
+		So(user.Attributes, ShouldNotContainKey, attributeSyncLock)
+	})
+
+	Convey("Leave administrator locks untouched", t, func() {
+		user := &idm.User{Attributes: map[string]string{"locks": `["logout"]`}}
+		So(setLock(user, false), ShouldBeFalse)
+		So(user.Attributes["locks"], ShouldEqual, `["logout"]`)
+
+		// Users locked by an administrator stay locked when enabled again
+		So(setLock(user, true), ShouldBeTrue)
+		So(user.Attributes["locks"], ShouldEqual, `["logout"]`)
+		So(user.Attributes[attributeSyncLock], ShouldEqual, syncLockKept)
+		So(setLock(user, true), ShouldBeFalse)
+		So(setLock(user, false), ShouldBeTrue)
+		So(user.Attributes["locks"], ShouldEqual, `["logout"]`)
+		So(user.Attributes, ShouldNotContainKey, attributeSyncLock)
+	})
+
+}
@@ -0,0 +1,265 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package ldap
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	ber "gopkg.in/asn1-ber.v1"
+)
+
+const (
+	appBindRequest    = 0
+	appBindResponse   = 1
+	appUnbindRequest  = 2
+	appSearchRequest  = 3
+	appSearchEntry    = 4
+	appSearchDone     = 5
+	resultSuccess     = 0
+	resultInvalidCred = 49
+	resultUnsupported = 53
+	pagingControlType = "1.2.840.113556.1.4.319"
+)
+
+type testEntry struct {
+	dn         string
+	attributes map[string][]string
+}
+
+// testServer is a minimal in-process LDAP server supporting simple binds and paged searches.
+type testServer struct {
+	sync.Mutex
+	entries   []*testEntry
+	passwords map[string]string
+	listener  net.Listener
+	searches  int
+}
+
+func startTestServer(t *testing.T, entries []*testEntry, passwords map[string]string) *testServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{entries: entries, passwords: passwords, listener: l}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *testServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *testServer) Close() {
+	s.listener.Close()
+}
+
+func (s *testServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		var responses []*ber.Packet
+		switch op.Tag {
+		case appBindRequest:
+			dn := op.Children[1].Data.String()
+			password := op.Children[2].Data.String()
+			code := resultSuccess
+			if expected, ok := s.passwords[strings.ToLower(dn)]; !ok || expected != password {
+				code = resultInvalidCred
+			}
+			responses = append(responses, message(id, result(appBindResponse, code), nil))
+		case appUnbindRequest:
+			return
+		case appSearchRequest:
+			responses = s.search(id, packet, op)
+		default:
+			responses = append(responses, message(id, result(appSearchDone, resultUnsupported), nil))
+		}
+		for _, r := range responses {
+			if _, err := conn.Write(r.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *testServer) search(id int64, packet *ber.Packet, op *ber.Packet) []*ber.Packet {
+
+	s.Lock()
+	s.searches++
+	s.Unlock()
+
+	base := strings.ToLower(op.Children[0].Data.String())
+	scope := op.Children[1].Value.(int64)
+	filter := op.Children[6]
+	var matches []*testEntry
+	for _, e := range s.entries {
+		dn := strings.ToLower(e.dn)
+		switch scope {
+		case 0:
+			if dn != base {
+				continue
+			}
+		case 1:
+			if !strings.HasSuffix(dn, ","+base) || strings.Contains(strings.TrimSuffix(dn, ","+base), ",") {
+				continue
+			}
+		default:
+			if dn != base && !strings.HasSuffix(dn, ","+base) {
+				continue
+			}
+		}
+		if matchFilter(e, filter) {
+			matches = append(matches, e)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].dn < matches[j].dn })
+
+	// Paging control
+	var pageSize, offset int
+	paged := false
+	if len(packet.Children) > 2 {
+		for _, control := range packet.Children[2].Children {
+			if control.Children[0].Data.String() != pagingControlType {
+				continue
+			}
+			value := ber.DecodePacket(control.Children[len(control.Children)-1].Data.Bytes())
+			pageSize = int(value.Children[0].Value.(int64))
+			offset, _ = strconv.Atoi(value.Children[1].Data.String())
+			paged = true
+		}
+	}
+	end := len(matches)
+	if paged && pageSize > 0 && offset+pageSize < end {
+		end = offset + pageSize
+	}
+	var responses []*ber.Packet
+	for _, e := range matches[offset:end] {
+		entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, appSearchEntry, nil, "Entry")
+		entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "DN"))
+		attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+		for name, values := range e.attributes {
+			attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+			attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+			set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+			for _, v := range values {
+				set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+			}
+			attribute.AppendChild(set)
+			attributes.AppendChild(attribute)
+		}
+		entry.AppendChild(attributes)
+		responses = append(responses, message(id, entry, nil))
+	}
+	var controls *ber.Packet
+	if paged {
+		cookie := ""
+		if end < len(matches) {
+			cookie = strconv.Itoa(end)
+		}
+		inner := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Paging")
+		inner.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, int64(0), "Size"))
+		inner.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, cookie, "Cookie"))
+		control := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Control")
+		control.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, pagingControlType, "Type"))
+		control.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, string(inner.Bytes()), "Value"))
+		controls = ber.Encode(ber.ClassContext, ber.TypeConstructed, 0, nil, "Controls")
+		controls.AppendChild(control)
+	}
+	return append(responses, message(id, result(appSearchDone, resultSuccess), controls))
+
+}
+
+// matchFilter evaluates and, or, not, equality and presence filters.
+func matchFilter(e *testEntry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case 0:
+		for _, child := range filter.Children {
+			if !matchFilter(e, child) {
+				return false
+			}
+		}
+		return true
+	case 1:
+		for _, child := range filter.Children {
+			if matchFilter(e, child) {
+				return true
+			}
+		}
+		return false
+	case 2:
+		return !matchFilter(e, filter.Children[0])
+	case 3:
+		for _, v := range attributeValues(e, filter.Children[0].Data.String()) {
+			if strings.EqualFold(v, filter.Children[1].Data.String()) {
+				return true
+			}
+		}
+		return false
+	case 7:
+		return len(attributeValues(e, filter.Data.String())) > 0
+	}
+	return false
+}
+
+func attributeValues(e *testEntry, name string) []string {
+	for k, v := range e.attributes {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+func message(id int64, op *ber.Packet, controls *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+	packet.AppendChild(op)
+	if controls != nil {
+		packet.AppendChild(controls)
+	}
+	return packet
+}
+
+func result(tag ber.Tag, code int) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Message"))
+	return op
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package mfa
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	// RecoveryCodesCount is the number of recovery codes generated at once.
+	RecoveryCodesCount = 10
+	// recoveryCodeSize is the number of random bytes of a recovery code (80 bits).
+	recoveryCodeSize = 10
+)
+
+// GenerateRecoveryCodes creates a set of random recovery codes. The codes are returned in clear
+// to be displayed once to the user, along with their hashes to be stored.
+func GenerateRecoveryCodes(count int) (codes []string, hashes []string, err error) {
+	enc := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for i := 0; i < count; i++ {
+		b := make([]byte, recoveryCodeSize)
+		if _, err = rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		c := strings.ToLower(enc.EncodeToString(b))
+		c = c[:8] + "-" + c[8:]
+		codes = append(codes, c)
+		hashes = append(hashes, hashRecoveryCode(c))
+	}
+	return
+}
+
+// UseRecoveryCode looks for a code among the stored hashes. If found, it is removed from the
+// returned hashes, as a recovery code can be used only once.
+func UseRecoveryCode(hashes []string, value string) ([]string, bool) {
+	h := []byte(hashRecoveryCode(value))
+	for i, stored := range hashes {
+		if subtle.ConstantTimeCompare([]byte(stored), h) == 1 {
+			remaining := make([]string, 0, len(hashes)-1)
+			remaining = append(remaining, hashes[:i]...)
+			return append(remaining, hashes[i+1:]...), true
+		}
+	}
+	return hashes, false
+}
+
+// hashRecoveryCode normalizes a code (case, separators) before hashing it.
+func hashRecoveryCode(value string) string {
+	value = strings.ToLower(value)
+	value = strings.NewReplacer("-", "", " ", "").Replace(value)
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package mfa
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/config"
+	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/proto/idm"
+)
+
+const (
+	// UserAttribute is the user attribute storing the second factor state. Attributes prefixed
+	// with "pydio:" are neither exposed nor editable through the REST API.
+	UserAttribute = "pydio:mfa"
+	// OTPHeader is the HTTP header carrying the one-time password along with a password grant request.
+	OTPHeader = "X-Pydio-Otp"
+
+	// Error IDs returned by the authentication service when a second factor is required.
+	ErrorOTPRequired    = "mfa.otp.required"
+	ErrorOTPInvalid     = "mfa.otp.invalid"
+	ErrorEnrollRequired = "mfa.enroll.required"
+)
+
+var (
+	// Secrets are stored in the vault, and only referenced by their key in the user attributes.
+	getSecret = func(key string) string { return config.GetSecret(key).String("") }
+	setSecret = config.SetSecret
+	delSecret = config.DelSecret
+)
+
+// State is the second factor configuration of a user.
+type State struct {
+	// SecretKey references the active TOTP secret
+	SecretKey string `json:"secret,omitempty"`
+	// PendingKey references a TOTP secret waiting for a first code to be confirmed
+	PendingKey string `json:"pending,omitempty"`
+	// LastCounter is the counter of the last accepted code
+	LastCounter int64 `json:"last,omitempty"`
+	// Recovery stores the hashes of the unused recovery codes
+	Recovery []string `json:"recovery,omitempty"`
+}
+
+// LoadState reads the second factor state from the user attributes.
+func LoadState(user *idm.User) *State {
+	s := &State{}
+	if user.Attributes != nil {
+		if v, ok := user.Attributes[UserAttribute]; ok {
+			json.Unmarshal([]byte(v), s)
+		}
+	}
+	return s
+}
+
+// Save writes the state in the user attributes. The user must then be stored.
+func (s *State) Save(user *idm.User) {
+	if user.Attributes == nil {
+		user.Attributes = make(map[string]string)
+	}
+	if s.SecretKey == "" && s.PendingKey == "" {
+		delete(user.Attributes, UserAttribute)
+		return
+	}
+	data, _ := json.Marshal(s)
+	user.Attributes[UserAttribute] = string(data)
+}
+
+// Enrolled tells if the user has an active second factor.
+func (s *State) Enrolled() bool {
+	return s.SecretKey != ""
+}
+
+// Setup generates a new secret, replacing any previous pending one. The secret becomes active
+// once a first code is confirmed.
+func (s *State) Setup() (string, error) {
+	secret, e := GenerateSecret()
+	if e != nil {
+		return "", e
+	}
+	if s.PendingKey != "" {
+		delSecret(s.PendingKey)
+	}
+	s.PendingKey = config.NewKeyForSecret()
+	setSecret(s.PendingKey, secret)
+	return secret, nil
+}
+
+// Confirm checks a code against the pending secret, and makes it the active secret on success.
+// Recovery codes of a previous secret are dropped.
+func (s *State) Confirm(code string, t time.Time) bool {
+	if s.PendingKey == "" {
+		return false
+	}
+	counter, ok := Validate(getSecret(s.PendingKey), code, t, 0)
+	if !ok {
+		return false
+	}
+	if s.SecretKey != "" {
+		delSecret(s.SecretKey)
+	}
+	s.SecretKey = s.PendingKey
+	s.PendingKey = ""
+	s.LastCounter = counter
+	s.Recovery = nil
+	return true
+}
+
+// Verify checks a one-time password or a recovery code against the active secret. Accepted
+// codes are consumed, the state must be saved afterwards.
+func (s *State) Verify(code string, t time.Time) (valid bool, recovery bool) {
+	if !s.Enrolled() {
+		return false, false
+	}
+	if counter, ok := Validate(getSecret(s.SecretKey), code, t, s.LastCounter); ok {
+		s.LastCounter = counter
+		return true, false
+	}
+	if remaining, ok := UseRecoveryCode(s.Recovery, code); ok {
+		s.Recovery = remaining
+		return true, true
+	}
+	return false, false
+}
+
+// NewRecoveryCodes replaces the recovery codes and returns them in clear.
+func (s *State) NewRecoveryCodes() ([]string, error) {
+	codes, hashes, e := GenerateRecoveryCodes(RecoveryCodesCount)
+	if e != nil {
+		return nil, e
+	}
+	s.Recovery = hashes
+	return codes, nil
+}
+
+// Reset removes the secrets and recovery codes.
+func (s *State) Reset() {
+	if s.SecretKey != "" {
+		delSecret(s.SecretKey)
+	}
+	if s.PendingKey != "" {
+		delSecret(s.PendingKey)
+	}
+	*s = State{}
+}
+
+// IsEnforced tells if the administrator requires a second factor for this user, based on the
+// profiles and roles listed in the mfa configuration of the authentication service.
+func IsEnforced(user *idm.User) bool {
+	authService := common.SERVICE_GRPC_NAMESPACE_ + common.SERVICE_AUTH
+	profiles := config.Get("services", authService, "mfa", "enforceProfiles").StringSlice(nil)
+	roles := config.Get("services", authService, "mfa", "enforceRoles").StringSlice(nil)
+	return isEnforced(user, profiles, roles)
+}
+
+func isEnforced(user *idm.User, profiles []string, roles []string) bool {
+	if user.Attributes != nil {
+		for _, p := range profiles {
+			if user.Attributes["profile"] == p {
+				return true
+			}
+		}
+	}
+	for _, r := range user.Roles {
+		for _, enforced := range roles {
+			if r.Uuid == enforced {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Issuer is the name displayed by authenticator applications along with the account.
+func Issuer() string {
+	return config.Get("frontend", "plugin", "core.pydio", "APPLICATION_TITLE").String("Pydio Cells")
+}
+
+// StoreUser saves the user after a change of its second factor state.
+func StoreUser(ctx context.Context, user *idm.User) error {
+	userClient := idm.NewUserServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_USER, defaults.NewClient())
+	_, e := userClient.CreateUser(ctx, &idm.CreateUserRequest{User: user})
+	return e
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package mfa
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/proto/idm"
+)
+
+func init() {
+	secrets := make(map[string]string)
+	getSecret = func(key string) string { return secrets[key] }
+	setSecret = func(key string, val string) { secrets[key] = val }
+	delSecret = func(key string) { delete(secrets, key) }
+}
+
+func TestState(t *testing.T) {
+
+	Convey("Test enrollment", t, func() {
+		user := &idm.User{Login: "john"}
+		s := LoadState(user)
+		So(s.Enrolled(), ShouldBeFalse)
+
+		secret, e := s.Setup()
+		So(e, ShouldBeNil)
+		So(s.Enrolled(), ShouldBeFalse)
+		So(getSecret(s.PendingKey), ShouldEqual, secret)
+
+		now := time.Now()
+		So(s.Confirm("000000", now.Add(-time.Hour)), ShouldBeFalse)
+		c, _ := Code(secret, now)
+		So(s.Confirm(c, now), ShouldBeTrue)
+		So(s.Enrolled(), ShouldBeTrue)
+		So(s.PendingKey, ShouldBeEmpty)
+
+		s.Save(user)
+		So(user.Attributes[UserAttribute], ShouldNotBeEmpty)
+		So(user.Attributes[UserAttribute], ShouldNotContainSubstring, secret)
+		loaded := LoadState(user)
+		So(loaded.SecretKey, ShouldEqual, s.SecretKey)
+
+		// Code used for confirmation cannot be reused
+		valid, _ := loaded.Verify(c, now)
+		So(valid, ShouldBeFalse)
+		next, _ := Code(secret, now.Add(Period))
+		valid, recovery := loaded.Verify(next, now.Add(Period))
+		So(valid, ShouldBeTrue)
+		So(recovery, ShouldBeFalse)
+
+		key := loaded.SecretKey
+		loaded.Reset()
+		loaded.Save(user)
+		So(getSecret(key), ShouldBeEmpty)
+		_, ok := user.Attributes[UserAttribute]
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Test recovery codes are single use", t, func() {
+		s := &State{}
+		secret, _ := s.Setup()
+		now := time.Now()
+		c, _ := Code(secret, now)
+		So(s.Confirm(c, now), ShouldBeTrue)
+
+		codes, e := s.NewRecoveryCodes()
+		So(e, ShouldBeNil)
+		So(codes, ShouldHaveLength, RecoveryCodesCount)
+		So(s.Recovery, ShouldNotContain, codes[0])
+
+		valid, recovery := s.Verify(codes[3], now)
+		So(valid, ShouldBeTrue)
+		So(recovery, ShouldBeTrue)
+		So(s.Recovery, ShouldHaveLength, RecoveryCodesCount-1)
+
+		valid, _ = s.Verify(codes[3], now)
+		So(valid, ShouldBeFalse)
+
+		// Case and separators are ignored
+		valid, recovery = s.Verify(" "+strings.ToUpper(strings.Replace(codes[4], "-", "", 1)), now)
+		So(valid, ShouldBeTrue)
+		So(recovery, ShouldBeTrue)
+	})
+
+	Convey("Test enforcement", t, func() {
+		user := &idm.User{
+			Attributes: map[string]string{"profile": "admin"},
+			Roles:      []*idm.Role{{Uuid: "ROOT_GROUP"}, {Uuid: "role-1"}},
+		}
+		So(isEnforced(user, nil, nil), ShouldBeFalse)
+		So(isEnforced(user, []string{"standard"}, nil), ShouldBeFalse)
+		So(isEnforced(user, []string{"standard", "admin"}, nil), ShouldBeTrue)
+		So(isEnforced(user, nil, []string{"role-1"}), ShouldBeTrue)
+		So(isEnforced(&idm.User{}, []string{"admin"}, []string{"role-1"}), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+// Package mfa provides the second authentication factor of users: time-based one-time passwords
+// (TOTP, RFC 6238) generated by an authenticator application, and single-use recovery codes.
+package mfa
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// SecretSize is the number of random bytes of a TOTP secret.
+	SecretSize = 20
+	// CodeDigits is the number of digits of a one-time password.
+	CodeDigits = 6
+	// Period is the validity period of a one-time password.
+	Period = 30 * time.Second
+	// Skew is the number of periods accepted before and after the current one, to tolerate clock drifts.
+	Skew = 1
+)
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret creates a new random TOTP secret, encoded in base32 as expected by authenticator applications.
+func GenerateSecret() (string, error) {
+	b := make([]byte, SecretSize)
+	if _, e := rand.Read(b); e != nil {
+		return "", e
+	}
+	return secretEncoding.EncodeToString(b), nil
+}
+
+// Code computes the one-time password of a secret at a given time.
+func Code(secret string, t time.Time) (string, error) {
+	key, e := decodeSecret(secret)
+	if e != nil {
+		return "", e
+	}
+	return code(key, counterAt(t)), nil
+}
+
+// Validate checks a one-time password against a secret at a given time. Codes whose counter is not
+// strictly greater than lastCounter are refused, so that a code cannot be used twice.
+// It returns the counter of the matching code, to be stored as the new lastCounter.
+func Validate(secret string, value string, t time.Time, lastCounter int64) (int64, bool) {
+	value = strings.Replace(value, " ", "", -1)
+	if len(value) != CodeDigits {
+		return 0, false
+	}
+	key, e := decodeSecret(secret)
+	if e != nil {
+		return 0, false
+	}
+	current := counterAt(t)
+	for i := -Skew; i <= Skew; i++ {
+		c := current + int64(i)
+		if c <= lastCounter {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(code(key, c)), []byte(value)) == 1 {
+			return c, true
+		}
+	}
+	return 0, false
+}
+
+// ProvisioningURI builds the otpauth:// URI that authenticator applications read, usually from a QR code.
+func ProvisioningURI(issuer string, account string, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("digits", fmt.Sprintf("%d", CodeDigits))
+	params.Set("period", fmt.Sprintf("%d", int(Period.Seconds())))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.Replace(secret, " ", "", -1))
+	return secretEncoding.DecodeString(strings.TrimRight(secret, "="))
+}
+
+func counterAt(t time.Time) int64 {
+	return t.Unix() / int64(Period.Seconds())
+}
+
+// code implements the HOTP algorithm (RFC 4226) for a given counter.
+func code(key []byte, counter int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < CodeDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", CodeDigits, bin%mod)
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package mfa
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// RFC 6238 test secret for HMAC-SHA1
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+
+	Convey("Test RFC 6238 vectors", t, func() {
+		vectors := map[int64]string{
+			59:         "287082",
+			1111111109: "081804",
+			1111111111: "050471",
+			1234567890: "005924",
+			2000000000: "279037",
+		}
+		for ts, expected := range vectors {
+			c, e := Code(rfcSecret, time.Unix(ts, 0))
+			So(e, ShouldBeNil)
+			So(c, ShouldEqual, expected)
+		}
+	})
+
+	Convey("Test invalid secret", t, func() {
+		_, e := Code("not-base32!", time.Now())
+		So(e, ShouldNotBeNil)
+	})
+}
+
+func TestValidate(t *testing.T) {
+
+	Convey("Test validation window", t, func() {
+		secret, e := GenerateSecret()
+		So(e, ShouldBeNil)
+		now := time.Unix(1500000000, 0)
+
+		current, _ := Code(secret, now)
+		counter, ok := Validate(secret, current, now, 0)
+		So(ok, ShouldBeTrue)
+		So(counter, ShouldEqual, now.Unix()/30)
+
+		previous, _ := Code(secret, now.Add(-Period))
+		_, ok = Validate(secret, previous, now, 0)
+		So(ok, ShouldBeTrue)
+
+		old, _ := Code(secret, now.Add(-3*Period))
+		_, ok = Validate(secret, old, now, 0)
+		So(ok, ShouldBeFalse)
+
+		_, ok = Validate(secret, "12345", now, 0)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Test codes cannot be replayed", t, func() {
+		secret, _ := GenerateSecret()
+		now := time.Unix(1500000000, 0)
+		current, _ := Code(secret, now)
+		counter, ok := Validate(secret, current, now, 0)
+		So(ok, ShouldBeTrue)
+		_, ok = Validate(secret, current, now, counter)
+		So(ok, ShouldBeFalse)
+		previous, _ := Code(secret, now.Add(-Period))
+		_, ok = Validate(secret, previous, now, counter)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Test provisioning URI", t, func() {
+		uri := ProvisioningURI("Pydio Cells", "admin", "ABCDEF")
+		So(strings.HasPrefix(uri, "otpauth://totp/Pydio%20Cells:admin?"), ShouldBeTrue)
+		So(uri, ShouldContainSubstring, "secret=ABCDEF")
+		So(uri, ShouldContainSubstring, "issuer=Pydio+Cells")
+	})
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+package mfa
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pmker/yux/common/proto/idm"
+	"github.com/pmker/yux/common/utils"
+)
+
+var (
+	loadUser = func(ctx context.Context, login string) (*idm.User, error) {
+		return utils.SearchUniqueUser(ctx, login, "")
+	}
+	storeUser = StoreUser
+
+	userLocks = struct {
+		sync.Mutex
+		locks map[string]*userLock
+	}{locks: make(map[string]*userLock)}
+)
+
+type userLock struct {
+	sync.Mutex
+	refs int
+}
+
+// LockUser serializes the changes made to the attributes of a user. It returns the function
+// releasing the lock.
+func LockUser(login string) func() {
+	userLocks.Lock()
+	l, ok := userLocks.locks[login]
+	if !ok {
+		l = &userLock{}
+		userLocks.locks[login] = l
+	}
+	l.refs++
+	userLocks.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		userLocks.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(userLocks.locks, login)
+		}
+		userLocks.Unlock()
+	}
+}
+
+// Update reloads a user and applies f to its second factor state while holding the user lock, so
+// that concurrent requests see the codes consumed by each other and a code is accepted only once.
+// The state is saved and the user stored when f returns true.
+func Update(ctx context.Context, login string, f func(user *idm.User, s *State) (bool, error)) (*idm.User, error) {
+	unlock := LockUser(login)
+	defer unlock()
+
+	user, e := loadUser(ctx, login)
+	if e != nil {
+		return nil, e
+	}
+	s := LoadState(user)
+	if save, e := f(user, s); e != nil || !save {
+		return user, e
+	}
+	s.Save(user)
+	if e := storeUser(ctx, user); e != nil {
+		return user, e
+	}
+	return user, nil
+}
+
+// AcceptsCredentials tells if a user may authenticate with credentials that cannot carry a one-time
+// password: SSH public keys, S3 access keys and personal access tokens. Users for whom a second
+// factor is enforced are refused until they enroll one, as they may have created these credentials
+// before the enforcement. Once enrolled, credentials are accepted like the sessions they were
+// created from.
+func AcceptsCredentials(user *idm.User) bool {
+	return LoadState(user).Enrolled() || !IsEnforced(user)
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+package mfa
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/proto/idm"
+)
+
+func TestUpdate(t *testing.T) {
+
+	// Users are stored as copies, like the user service does
+	var mu sync.Mutex
+	stored := make(map[string]map[string]string)
+	defer func(l func(context.Context, string) (*idm.User, error), s func(context.Context, *idm.User) error) {
+		loadUser = l
+		storeUser = s
+	}(loadUser, storeUser)
+	loadUser = func(ctx context.Context, login string) (*idm.User, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		attributes := make(map[string]string)
+		for k, v := range stored[login] {
+			attributes[k] = v
+		}
+		return &idm.User{Login: login, Attributes: attributes}, nil
+	}
+	storeUser = func(ctx context.Context, user *idm.User) error {
+		// Leave time for concurrent requests to load a stale copy
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		stored[user.Login] = user.Attributes
+		return nil
+	}
+
+	user := &idm.User{Login: "john"}
+	s := LoadState(user)
+	secret, _ := s.Setup()
+	now := time.Now()
+	c, _ := Code(secret, now)
+	s.Confirm(c, now)
+	codes, _ := s.NewRecoveryCodes()
+	s.Save(user)
+	stored["john"] = user.Attributes
+
+	verify := func(code string) bool {
+		var valid bool
+		_, e := Update(context.Background(), "john", func(u *idm.User, s *State) (bool, error) {
+			valid, _ = s.Verify(code, now.Add(Period))
+			return valid, nil
+		})
+		So(e, ShouldBeNil)
+		return valid
+	}
+
+	Convey("A code is accepted once by concurrent requests", t, func() {
+		next, _ := Code(secret, now.Add(Period))
+		for _, code := range []string{next, codes[0]} {
+			var wg sync.WaitGroup
+			var accepted int
+			var am sync.Mutex
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					var valid bool
+					Update(context.Background(), "john", func(u *idm.User, s *State) (bool, error) {
+						valid, _ = s.Verify(code, now.Add(Period))
+						return valid, nil
+					})
+					if valid {
+						am.Lock()
+						accepted++
+						am.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			So(accepted, ShouldEqual, 1)
+		}
+		So(verify(codes[1]), ShouldBeTrue)
+		So(LoadState(&idm.User{Attributes: stored["john"]}).Recovery, ShouldHaveLength, RecoveryCodesCount-2)
+	})
+
+	Convey("Locks are released", t, func() {
+		unlock := LockUser("john")
+		unlock()
+		userLocks.Lock()
+		So(userLocks.locks, ShouldBeEmpty)
+		userLocks.Unlock()
+	})
+
+	Convey("Enrolled users may use other credentials", t, func() {
+		So(AcceptsCredentials(&idm.User{Attributes: stored["john"]}), ShouldBeTrue)
+	})
+}
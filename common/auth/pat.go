@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/auth/claim"
+	"github.com/pmker/yux/common/auth/mfa"
+	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/proto/auth"
+	"github.com/pmker/yux/common/proto/idm"
+	"github.com/pmker/yux/common/utils"
+)
+
+// PersonalAccessTokenPrefix starts all personal access tokens values, telling them apart from JWT.
+const PersonalAccessTokenPrefix = "pat_"
+
+var (
+	// verifiedPats keeps recently verified tokens for a short time, a revoked token is refused after this delay.
+	verifiedPats = cache.New(10*time.Second, time.Minute)
+	// patService returns the client of the service storing the tokens.
+	patService = func() auth.PersonalAccessTokenServiceClient {
+		return auth.NewPersonalAccessTokenServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_AUTH, defaults.NewClient())
+	}
+	// patOwner loads the user owning a token.
+	patOwner = func(ctx context.Context, userUuid string) (*idm.User, error) {
+		return utils.SearchUniqueUser(ctx, "", userUuid)
+	}
+	// patAccepted applies the second factor policy to the owner of a token.
+	patAccepted = mfa.AcceptsCredentials
+)
+
+// IsPersonalAccessToken tells if a credential value is a personal access token.
+func IsPersonalAccessToken(value string) bool {
+	return strings.HasPrefix(value, PersonalAccessTokenPrefix)
+}
+
+// verifyPersonalAccessToken checks the token against the auth service and builds the claims of its owner,
+// narrowed down by the token restrictions.
+func verifyPersonalAccessToken(ctx context.Context, value string) (context.Context, claim.Claims, error) {
+
+	sum := sha256.Sum256([]byte(value))
+	key := hex.EncodeToString(sum[:])
+	if c, ok := verifiedPats.Get(key); ok {
+		return WithClaims(ctx, c.(claim.Claims)), c.(claim.Claims), nil
+	}
+
+	rsp, e := patService().Verify(ctx, &auth.PatVerifyRequest{AccessToken: value})
+	if e != nil {
+		return ctx, claim.Claims{}, e
+	}
+	if !rsp.Success || rsp.Token == nil {
+		return ctx, claim.Claims{}, errors.New("invalid or expired personal access token")
+	}
+	token := rsp.Token
+
+	user, e := patOwner(ctx, token.UserUuid)
+	if e != nil {
+		return ctx, claim.Claims{}, e
+	}
+	if utils.IsUserLocked(user) {
+		return ctx, claim.Claims{}, errors.New("user " + user.Login + " is locked")
+	}
+	if !patAccepted(user) {
+		return ctx, claim.Claims{}, errors.New("user " + user.Login + " must set up a second authentication factor")
+	}
+
+	claims := ClaimsFromUser(user, claim.AuthMethodPersonalToken)
+	claims.Expiry = time.Unix(token.ExpiresAt, 0)
+	claims.Restrictions = &claim.Restrictions{
+		TokenUuid:  token.Uuid,
+		ReadOnly:   token.ReadOnly,
+		Workspaces: token.Workspaces,
+		Resources:  token.Resources,
+	}
+	verifiedPats.Set(key, claims, cache.DefaultExpiration)
+
+	return WithClaims(ctx, claims), claims, nil
+}
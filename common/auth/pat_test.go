@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/client"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/auth/claim"
+	"github.com/pmker/yux/common/proto/auth"
+	"github.com/pmker/yux/common/proto/idm"
+)
+
+// patServiceMock knows a fixed set of tokens, indexed by value.
+type patServiceMock struct {
+	auth.PersonalAccessTokenServiceClient
+	tokens map[string]*auth.PersonalAccessToken
+	calls  int
+}
+
+func (p *patServiceMock) Verify(ctx context.Context, in *auth.PatVerifyRequest, opts ...client.CallOption) (*auth.PatVerifyResponse, error) {
+	p.calls++
+	if token, ok := p.tokens[in.AccessToken]; ok {
+		return &auth.PatVerifyResponse{Success: true, Token: token}, nil
+	}
+	return &auth.PatVerifyResponse{Success: false}, nil
+}
+
+func TestVerifyPersonalAccessToken(t *testing.T) {
+
+	expiry := time.Now().Add(time.Hour).Unix()
+	service := &patServiceMock{tokens: map[string]*auth.PersonalAccessToken{
+		"pat_valid":  {Uuid: "token-1", UserUuid: "user-1", ExpiresAt: expiry, ReadOnly: true, Workspaces: []string{"ws-1"}},
+		"pat_locked": {Uuid: "token-2", UserUuid: "user-2", ExpiresAt: expiry},
+		"pat_no_mfa": {Uuid: "token-3", UserUuid: "user-3", ExpiresAt: expiry},
+	}}
+	users := map[string]*idm.User{
+		"user-1": {Uuid: "user-1", Login: "john", Attributes: map[string]string{"profile": "standard"}},
+		"user-2": {Uuid: "user-2", Login: "jane", Attributes: map[string]string{"profile": "standard", "locks": `["logout"]`}},
+		"user-3": {Uuid: "user-3", Login: "jack", Attributes: map[string]string{"profile": "admin"}},
+	}
+	defer func(s func() auth.PersonalAccessTokenServiceClient, o func(context.Context, string) (*idm.User, error), a func(*idm.User) bool) {
+		patService = s
+		patOwner = o
+		patAccepted = a
+	}(patService, patOwner, patAccepted)
+	patService = func() auth.PersonalAccessTokenServiceClient { return service }
+	patOwner = func(ctx context.Context, userUuid string) (*idm.User, error) { return users[userUuid], nil }
+	patAccepted = func(user *idm.User) bool { return user.Login != "jack" }
+
+	Convey("Valid tokens give the claims of their owner, with the token restrictions", t, func() {
+		verifiedPats.Flush()
+		ctx, claims, e := verifyPersonalAccessToken(context.Background(), "pat_valid")
+		So(e, ShouldBeNil)
+		So(claims.Name, ShouldEqual, "john")
+		So(claims.AuthMethods, ShouldContain, claim.AuthMethodPersonalToken)
+		So(claims.Expiry.Unix(), ShouldEqual, expiry)
+		So(claims.Restrictions, ShouldNotBeNil)
+		So(claims.Restrictions.TokenUuid, ShouldEqual, "token-1")
+		So(claims.Restrictions.ReadOnly, ShouldBeTrue)
+		So(claims.Restrictions.Workspaces, ShouldResemble, []string{"ws-1"})
+		So(ctx.Value(claim.ContextKey), ShouldResemble, claims)
+	})
+
+	Convey("Verified tokens are cached for a short time", t, func() {
+		verifiedPats.Flush()
+		service.calls = 0
+		verifyPersonalAccessToken(context.Background(), "pat_valid")
+		verifyPersonalAccessToken(context.Background(), "pat_valid")
+		So(service.calls, ShouldEqual, 1)
+	})
+
+	Convey("Unknown tokens and tokens of locked users are refused", t, func() {
+		verifiedPats.Flush()
+		_, _, e := verifyPersonalAccessToken(context.Background(), "pat_unknown")
+		So(e, ShouldNotBeNil)
+		_, _, e = verifyPersonalAccessToken(context.Background(), "pat_locked")
+		So(e, ShouldNotBeNil)
+	})
+
+	Convey("Tokens of users who must set up a second factor are refused", t, func() {
+		verifiedPats.Flush()
+		_, _, e := verifyPersonalAccessToken(context.Background(), "pat_no_mfa")
+		So(e, ShouldNotBeNil)
+	})
+
+}
@@ -44,8 +44,13 @@ type AESGCMMaterials struct {
 	nonceBuffer      *bytes.Buffer
 	blockCount       int
 	totalRead        int64
+	skip             int64
+	limit            int64
 }
 
+// gcmTagSize is the size of the authentication tag appended to each encrypted block
+const gcmTagSize = 16
+
 // NewAESGCMMaterials creates an encryption materials that use AES GCM
 func NewAESGCMMaterials(key []byte, t *encryption.Params) *AESGCMMaterials {
 	m := new(AESGCMMaterials)
@@ -77,7 +82,17 @@ func (m *AESGCMMaterials) Read(b []byte) (int, error) {
 	case 1:
 		return m.encryptRead(b)
 	case 2:
-		return m.decryptRead(b)
+		if m.limit == 0 {
+			return 0, io.EOF
+		}
+		if m.limit > 0 && int64(len(b)) > m.limit {
+			b = b[:m.limit]
+		}
+		n, err := m.decryptRead(b)
+		if m.limit > 0 {
+			m.limit -= int64(n)
+		}
+		return n, err
 	default:
 		return 0, errors.New("mode not set")
 	}
@@ -130,6 +145,51 @@ func (m *AESGCMMaterials) SetupDecryptMode(stream io.Reader, iv string, key stri
 	m.mode = 2
 	m.blockCount = 0
 	m.totalRead = 0
+	m.skip = 0
+	m.limit = -1
+	return nil
+}
+
+// EncryptedRange computes the range of the encrypted object holding the plain bytes starting at @offset.
+// A negative @length means until the end of the object, and so does the returned encrypted length.
+func (m *AESGCMMaterials) EncryptedRange(offset int64, length int64) (int64, int64) {
+	if m.initialBlockSize <= 0 {
+		// Blocks are unknown, the whole object is required
+		return 0, -1
+	}
+	plainBlock := int64(m.initialBlockSize)
+	encBlock := plainBlock + gcmTagSize
+	first := offset / plainBlock
+	if length < 0 {
+		return first * encBlock, -1
+	}
+	last := (offset + length - 1) / plainBlock
+	if last < first {
+		last = first
+	}
+	return first * encBlock, (last - first + 1) * encBlock
+}
+
+// SetupDecryptRangeMode set underlying read function in decrypt mode for a @stream starting at the encrypted
+// offset given by EncryptedRange. Nonces of the skipped blocks are ignored and the output is trimmed to the
+// plain bytes starting at @offset. A negative @length reads until the end of the stream.
+func (m *AESGCMMaterials) SetupDecryptRangeMode(stream io.Reader, offset int64, length int64) error {
+	if err := m.SetupDecryptMode(stream, "", ""); err != nil {
+		return err
+	}
+	if m.initialBlockSize > 0 {
+		first := offset / int64(m.initialBlockSize)
+		if first*12 > int64(len(m.nonceBytes)) {
+			return errors.New("range is out of encrypted blocks")
+		}
+		m.nonceBuffer = bytes.NewBuffer(m.nonceBytes[first*12:])
+		m.skip = offset - first*int64(m.initialBlockSize)
+	} else {
+		m.skip = offset
+	}
+	if length >= 0 {
+		m.limit = length
+	}
 	return nil
 }
 
@@ -227,6 +287,14 @@ func (m *AESGCMMaterials) decryptRead(b []byte) (int, error) {
 				return 0, err
 			}
 			cursor = 0
+			if m.skip > 0 {
+				drop := m.skip
+				if drop > int64(len(opened)) {
+					drop = int64(len(opened))
+				}
+				opened = opened[drop:]
+				m.skip -= drop
+			}
 			m.bufferedRead.Write(opened)
 		}
 	}
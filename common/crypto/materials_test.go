@@ -21,6 +21,7 @@
 package crypto
 
 import (
+	"bytes"
 	"crypto/md5"
 	"crypto/rand"
 	"encoding/hex"
@@ -31,6 +32,8 @@ import (
 	"testing"
 
 	"github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/proto/encryption"
 )
 
 func TestMaterials(t *testing.T) {
@@ -136,6 +139,69 @@ func TestMaterials(t *testing.T) {
 	})
 }
 
+func TestMaterialsRange(t *testing.T) {
+
+	key := KeyFromPassword([]byte("password"), 32)
+	plain := make([]byte, 10*1000+123)
+	rand.Read(plain)
+
+	var encrypted []byte
+	var params *encryption.Params
+
+	convey.Convey("Encrypt with small blocks", t, func() {
+		materials := NewAESGCMMaterials(key, &encryption.Params{BlockSize: 1000})
+		materials.SetupEncryptMode(bytes.NewReader(plain))
+		var err error
+		encrypted, err = ioutil.ReadAll(materials)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(len(encrypted), convey.ShouldEqual, len(plain)+11*16)
+		params = materials.GetEncryptedParameters()
+		convey.So(len(params.Nonce), convey.ShouldEqual, 11*12)
+	})
+
+	readRange := func(offset, length int64) []byte {
+		materials := NewAESGCMMaterials(key, params)
+		encOffset, encLength := materials.EncryptedRange(offset, length)
+		end := int64(len(encrypted))
+		if encLength >= 0 && encOffset+encLength < end {
+			end = encOffset + encLength
+		}
+		convey.So(materials.SetupDecryptRangeMode(bytes.NewReader(encrypted[encOffset:end]), offset, length), convey.ShouldBeNil)
+		data, err := ioutil.ReadAll(materials)
+		convey.So(err, convey.ShouldBeNil)
+		return data
+	}
+
+	convey.Convey("Compute encrypted ranges", t, func() {
+		materials := NewAESGCMMaterials(key, params)
+		off, l := materials.EncryptedRange(0, 10)
+		convey.So(off, convey.ShouldEqual, 0)
+		convey.So(l, convey.ShouldEqual, 1016)
+		off, l = materials.EncryptedRange(1500, 1000)
+		convey.So(off, convey.ShouldEqual, 1016)
+		convey.So(l, convey.ShouldEqual, 2032)
+		off, l = materials.EncryptedRange(5000, -1)
+		convey.So(off, convey.ShouldEqual, 5080)
+		convey.So(l, convey.ShouldEqual, -1)
+	})
+
+	convey.Convey("Decrypt ranges", t, func() {
+		convey.So(readRange(0, 10), convey.ShouldResemble, plain[0:10])
+		convey.So(readRange(1500, 1000), convey.ShouldResemble, plain[1500:2500])
+		convey.So(readRange(2000, 1000), convey.ShouldResemble, plain[2000:3000])
+		convey.So(readRange(3999, 2), convey.ShouldResemble, plain[3999:4001])
+		convey.So(readRange(9990, -1), convey.ShouldResemble, plain[9990:])
+		convey.So(readRange(10000, 500), convey.ShouldResemble, plain[10000:])
+		convey.So(readRange(0, int64(len(plain))), convey.ShouldResemble, plain)
+	})
+
+	convey.Convey("Reject ranges out of the encrypted blocks", t, func() {
+		materials := NewAESGCMMaterials(key, params)
+		err := materials.SetupDecryptRangeMode(bytes.NewReader([]byte{}), 20*1000, 10)
+		convey.So(err, convey.ShouldNotBeNil)
+	})
+}
+
 func hash_file_md5(filePath string) (string, error) {
 	//Initialize variable returnMD5String now in case an error has to be returned
 	var returnMD5String string
@@ -72,6 +72,7 @@ const (
 	SERVICE_CHANGES   = "changes"
 	SERVICE_SYNC      = "sync"
 	SERVICE_TEMPLATES = "templates"
+	SERVICE_QUOTA     = "quota"
 
 	SERVICE_ACTIVITY      = "activity"
 	SERVICE_MAILER        = "mailer"
@@ -104,6 +105,9 @@ const (
 	SERVICE_GATEWAY_DATA  = SERVICE_GATEWAY_NAMESPACE_ + "data"
 	SERVICE_GATEWAY_DAV   = SERVICE_GATEWAY_NAMESPACE_ + "dav"
 	SERVICE_GATEWAY_WOPI  = SERVICE_GATEWAY_NAMESPACE_ + "wopi"
+	SERVICE_GATEWAY_S3    = SERVICE_GATEWAY_NAMESPACE_ + "s3"
+	SERVICE_GATEWAY_SFTP  = SERVICE_GATEWAY_NAMESPACE_ + "sftp"
+	SERVICE_GATEWAY_TUS   = SERVICE_GATEWAY_NAMESPACE_ + "tus"
 	SERVICE_MICRO_API     = SERVICE_GATEWAY_NAMESPACE_ + "rest"
 )
 
@@ -116,7 +120,7 @@ const (
 	TOPIC_META_CHANGES     = "topic.pydio.meta.nodes.changes"
 	TOPIC_TIMER_EVENT      = "topic.pydio.meta.timer.event"
 	TOPIC_JOB_CONFIG_EVENT = "topic.pydio.jobconfig.event"
-	TOPIC_JOB_TASK_EVENT   = "topic.pydio.jobconfig.event"
+	TOPIC_JOB_TASK_EVENT   = "topic.pydio.jobtask.event"
 	TOPIC_IDM_EVENT        = "topic.pydio.idm.event"
 	TOPIC_ACTIVITY_EVENT   = "topic.pydio.activity.event"
 	TOPIC_CHAT_EVENT       = "topic.pydio.chat.event"
@@ -129,7 +133,11 @@ const (
 	META_NAMESPACE_DATASOURCE_PATH        = "pydio:meta-data-source-path"
 	META_NAMESPACE_NODE_TEST_LOCAL_FOLDER = "pydio:test:local-folder-storage"
 	META_NAMESPACE_RECYCLE_RESTORE        = "pydio:recycle_restore"
+	META_NAMESPACE_RECYCLE_OWNER          = "pydio:recycle_owner"
+	META_NAMESPACE_RECYCLE_TIME           = "pydio:recycle_time"
+	META_NAMESPACE_SHARE_LINK_DOWNLOAD    = "pydio:share_link_download"
 	META_NAMESPACE_NODENAME               = "name"
+	META_NAMESPACE_SEARCH_HIGHLIGHTS      = "search_highlights"
 	RECYCLE_BIN_NAME                      = "recycle_bin"
 
 	PYDIO_THUMBSTORE_NAMESPACE        = "pydio-thumbstore"
@@ -146,6 +154,10 @@ const (
 	PYDIO_SYNC_HIDDEN_FILE_META = ".pydio"
 	X_AMZ_META_CLEAR_SIZE       = "X-Amz-Meta-Pydio-Clear-Size"
 	X_AMZ_META_NODE_UUID        = "X-Amz-Meta-Pydio-Node-Uuid"
+	X_AMZ_META_BLOB_HASH        = "X-Amz-Meta-Pydio-Blob-Hash"
+	X_AMZ_META_BLOB_SOURCE      = "X-Amz-Meta-Pydio-Blob-Source"
+	X_AMZ_META_BLOB_REF         = "X-Amz-Meta-Pydio-Blob-Ref"
+	PYDIO_DEDUP_BLOBS_FOLDER    = ".pydio_blobs"
 
 	PYDIO_PROFILE_ADMIN    = "admin"
 	PYDIO_PROFILE_STANDARD = "standard"
@@ -169,6 +181,8 @@ const (
 	DOCSTORE_ID_VERSIONING_POLICIES = "versioningPolicies"
 	DOCSTORE_ID_SHARES              = "share"
 	DOCSTORE_ID_RESET_PASS_KEYS     = "resetPasswordKeys"
+	DOCSTORE_ID_BLOB_REFS           = "blobRefs"
+	DOCSTORE_ID_ACCESS_KEYS         = "accessKeys"
 )
 
 // Define constants for Loggging configuration
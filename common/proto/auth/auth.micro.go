@@ -16,6 +16,15 @@ It has these top-level messages:
 	RevokeTokenResponse
 	PruneTokensRequest
 	PruneTokensResponse
+	PersonalAccessToken
+	PatGenerateRequest
+	PatGenerateResponse
+	PatVerifyRequest
+	PatVerifyResponse
+	PatListRequest
+	PatListResponse
+	PatRevokeRequest
+	PatRevokeResponse
 	LdapSearchFilter
 	LdapMapping
 	LdapMemberOfMapping
@@ -138,3 +147,111 @@ func (h *AuthTokenRevoker) Revoke(ctx context.Context, in *RevokeTokenRequest, o
 func (h *AuthTokenRevoker) PruneTokens(ctx context.Context, in *PruneTokensRequest, out *PruneTokensResponse) error {
 	return h.AuthTokenRevokerHandler.PruneTokens(ctx, in, out)
 }
+
+// Client API for PersonalAccessTokenService service
+
+type PersonalAccessTokenServiceClient interface {
+	// Generate creates a new token. Its value is returned only once.
+	Generate(ctx context.Context, in *PatGenerateRequest, opts ...client.CallOption) (*PatGenerateResponse, error)
+	// Verify finds a valid token by its value and records its usage
+	Verify(ctx context.Context, in *PatVerifyRequest, opts ...client.CallOption) (*PatVerifyResponse, error)
+	// List the tokens of a user
+	List(ctx context.Context, in *PatListRequest, opts ...client.CallOption) (*PatListResponse, error)
+	// Revoke deletes a token
+	Revoke(ctx context.Context, in *PatRevokeRequest, opts ...client.CallOption) (*PatRevokeResponse, error)
+}
+
+type personalAccessTokenServiceClient struct {
+	c           client.Client
+	serviceName string
+}
+
+func NewPersonalAccessTokenServiceClient(serviceName string, c client.Client) PersonalAccessTokenServiceClient {
+	if c == nil {
+		c = client.NewClient()
+	}
+	if len(serviceName) == 0 {
+		serviceName = "auth"
+	}
+	return &personalAccessTokenServiceClient{
+		c:           c,
+		serviceName: serviceName,
+	}
+}
+
+func (c *personalAccessTokenServiceClient) Generate(ctx context.Context, in *PatGenerateRequest, opts ...client.CallOption) (*PatGenerateResponse, error) {
+	req := c.c.NewRequest(c.serviceName, "PersonalAccessTokenService.Generate", in)
+	out := new(PatGenerateResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *personalAccessTokenServiceClient) Verify(ctx context.Context, in *PatVerifyRequest, opts ...client.CallOption) (*PatVerifyResponse, error) {
+	req := c.c.NewRequest(c.serviceName, "PersonalAccessTokenService.Verify", in)
+	out := new(PatVerifyResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *personalAccessTokenServiceClient) List(ctx context.Context, in *PatListRequest, opts ...client.CallOption) (*PatListResponse, error) {
+	req := c.c.NewRequest(c.serviceName, "PersonalAccessTokenService.List", in)
+	out := new(PatListResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *personalAccessTokenServiceClient) Revoke(ctx context.Context, in *PatRevokeRequest, opts ...client.CallOption) (*PatRevokeResponse, error) {
+	req := c.c.NewRequest(c.serviceName, "PersonalAccessTokenService.Revoke", in)
+	out := new(PatRevokeResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for PersonalAccessTokenService service
+
+type PersonalAccessTokenServiceHandler interface {
+	// Generate creates a new token. Its value is returned only once.
+	Generate(context.Context, *PatGenerateRequest, *PatGenerateResponse) error
+	// Verify finds a valid token by its value and records its usage
+	Verify(context.Context, *PatVerifyRequest, *PatVerifyResponse) error
+	// List the tokens of a user
+	List(context.Context, *PatListRequest, *PatListResponse) error
+	// Revoke deletes a token
+	Revoke(context.Context, *PatRevokeRequest, *PatRevokeResponse) error
+}
+
+func RegisterPersonalAccessTokenServiceHandler(s server.Server, hdlr PersonalAccessTokenServiceHandler, opts ...server.HandlerOption) {
+	s.Handle(s.NewHandler(&PersonalAccessTokenService{hdlr}, opts...))
+}
+
+type PersonalAccessTokenService struct {
+	PersonalAccessTokenServiceHandler
+}
+
+func (h *PersonalAccessTokenService) Generate(ctx context.Context, in *PatGenerateRequest, out *PatGenerateResponse) error {
+	return h.PersonalAccessTokenServiceHandler.Generate(ctx, in, out)
+}
+
+func (h *PersonalAccessTokenService) Verify(ctx context.Context, in *PatVerifyRequest, out *PatVerifyResponse) error {
+	return h.PersonalAccessTokenServiceHandler.Verify(ctx, in, out)
+}
+
+func (h *PersonalAccessTokenService) List(ctx context.Context, in *PatListRequest, out *PatListResponse) error {
+	return h.PersonalAccessTokenServiceHandler.List(ctx, in, out)
+}
+
+func (h *PersonalAccessTokenService) Revoke(ctx context.Context, in *PatRevokeRequest, out *PatRevokeResponse) error {
+	return h.PersonalAccessTokenServiceHandler.Revoke(ctx, in, out)
+}
@@ -16,6 +16,15 @@ It has these top-level messages:
 	RevokeTokenResponse
 	PruneTokensRequest
 	PruneTokensResponse
+	PersonalAccessToken
+	PatGenerateRequest
+	PatGenerateResponse
+	PatVerifyRequest
+	PatVerifyResponse
+	PatListRequest
+	PatListResponse
+	PatRevokeRequest
+	PatRevokeResponse
 	LdapSearchFilter
 	LdapMapping
 	LdapMemberOfMapping
@@ -179,6 +188,293 @@ func (m *PruneTokensResponse) GetTokens() []string {
 	return nil
 }
 
+type PersonalAccessToken struct {
+	Uuid      string `protobuf:"bytes,1,opt,name=Uuid" json:"Uuid,omitempty"`
+	Label     string `protobuf:"bytes,2,opt,name=Label" json:"Label,omitempty"`
+	UserUuid  string `protobuf:"bytes,3,opt,name=UserUuid" json:"UserUuid,omitempty"`
+	UserLogin string `protobuf:"bytes,4,opt,name=UserLogin" json:"UserLogin,omitempty"`
+	// Login of the user who generated this token, can be an admin for service accounts
+	CreatedBy  string `protobuf:"bytes,5,opt,name=CreatedBy" json:"CreatedBy,omitempty"`
+	CreatedAt  int64  `protobuf:"varint,6,opt,name=CreatedAt" json:"CreatedAt,omitempty"`
+	ExpiresAt  int64  `protobuf:"varint,7,opt,name=ExpiresAt" json:"ExpiresAt,omitempty"`
+	LastUsedAt int64  `protobuf:"varint,8,opt,name=LastUsedAt" json:"LastUsedAt,omitempty"`
+	// Token cannot be used to modify data
+	ReadOnly bool `protobuf:"varint,9,opt,name=ReadOnly" json:"ReadOnly,omitempty"`
+	// Restrict access to these workspaces UUIDs
+	Workspaces []string `protobuf:"bytes,10,rep,name=Workspaces" json:"Workspaces,omitempty"`
+	// Restrict access to these REST resources, e.g. "/tree/<.*>"
+	Resources []string `protobuf:"bytes,11,rep,name=Resources" json:"Resources,omitempty"`
+}
+
+func (m *PersonalAccessToken) Reset()         { *m = PersonalAccessToken{} }
+func (m *PersonalAccessToken) String() string { return proto.CompactTextString(m) }
+func (*PersonalAccessToken) ProtoMessage()    {}
+
+func (m *PersonalAccessToken) GetUuid() string {
+	if m != nil {
+		return m.Uuid
+	}
+	return ""
+}
+
+func (m *PersonalAccessToken) GetLabel() string {
+	if m != nil {
+		return m.Label
+	}
+	return ""
+}
+
+func (m *PersonalAccessToken) GetUserUuid() string {
+	if m != nil {
+		return m.UserUuid
+	}
+	return ""
+}
+
+func (m *PersonalAccessToken) GetUserLogin() string {
+	if m != nil {
+		return m.UserLogin
+	}
+	return ""
+}
+
+func (m *PersonalAccessToken) GetCreatedBy() string {
+	if m != nil {
+		return m.CreatedBy
+	}
+	return ""
+}
+
+func (m *PersonalAccessToken) GetCreatedAt() int64 {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return 0
+}
+
+func (m *PersonalAccessToken) GetExpiresAt() int64 {
+	if m != nil {
+		return m.ExpiresAt
+	}
+	return 0
+}
+
+func (m *PersonalAccessToken) GetLastUsedAt() int64 {
+	if m != nil {
+		return m.LastUsedAt
+	}
+	return 0
+}
+
+func (m *PersonalAccessToken) GetReadOnly() bool {
+	if m != nil {
+		return m.ReadOnly
+	}
+	return false
+}
+
+func (m *PersonalAccessToken) GetWorkspaces() []string {
+	if m != nil {
+		return m.Workspaces
+	}
+	return nil
+}
+
+func (m *PersonalAccessToken) GetResources() []string {
+	if m != nil {
+		return m.Resources
+	}
+	return nil
+}
+
+type PatGenerateRequest struct {
+	Label string `protobuf:"bytes,1,opt,name=Label" json:"Label,omitempty"`
+	// Login of the token owner, defaults to the current user. Only admins can generate tokens for other users.
+	UserLogin string `protobuf:"bytes,2,opt,name=UserLogin" json:"UserLogin,omitempty"`
+	UserUuid  string `protobuf:"bytes,3,opt,name=UserUuid" json:"UserUuid,omitempty"`
+	// Expiration timestamp, a default lifetime is applied if empty
+	ExpiresAt  int64    `protobuf:"varint,4,opt,name=ExpiresAt" json:"ExpiresAt,omitempty"`
+	ReadOnly   bool     `protobuf:"varint,5,opt,name=ReadOnly" json:"ReadOnly,omitempty"`
+	Workspaces []string `protobuf:"bytes,6,rep,name=Workspaces" json:"Workspaces,omitempty"`
+	Resources  []string `protobuf:"bytes,7,rep,name=Resources" json:"Resources,omitempty"`
+}
+
+func (m *PatGenerateRequest) Reset()         { *m = PatGenerateRequest{} }
+func (m *PatGenerateRequest) String() string { return proto.CompactTextString(m) }
+func (*PatGenerateRequest) ProtoMessage()    {}
+
+func (m *PatGenerateRequest) GetLabel() string {
+	if m != nil {
+		return m.Label
+	}
+	return ""
+}
+
+func (m *PatGenerateRequest) GetUserLogin() string {
+	if m != nil {
+		return m.UserLogin
+	}
+	return ""
+}
+
+func (m *PatGenerateRequest) GetUserUuid() string {
+	if m != nil {
+		return m.UserUuid
+	}
+	return ""
+}
+
+func (m *PatGenerateRequest) GetExpiresAt() int64 {
+	if m != nil {
+		return m.ExpiresAt
+	}
+	return 0
+}
+
+func (m *PatGenerateRequest) GetReadOnly() bool {
+	if m != nil {
+		return m.ReadOnly
+	}
+	return false
+}
+
+func (m *PatGenerateRequest) GetWorkspaces() []string {
+	if m != nil {
+		return m.Workspaces
+	}
+	return nil
+}
+
+func (m *PatGenerateRequest) GetResources() []string {
+	if m != nil {
+		return m.Resources
+	}
+	return nil
+}
+
+type PatGenerateResponse struct {
+	// Token value, to be used as a Bearer token or as a basic auth password
+	AccessToken string               `protobuf:"bytes,1,opt,name=AccessToken" json:"AccessToken,omitempty"`
+	Token       *PersonalAccessToken `protobuf:"bytes,2,opt,name=Token" json:"Token,omitempty"`
+}
+
+func (m *PatGenerateResponse) Reset()         { *m = PatGenerateResponse{} }
+func (m *PatGenerateResponse) String() string { return proto.CompactTextString(m) }
+func (*PatGenerateResponse) ProtoMessage()    {}
+
+func (m *PatGenerateResponse) GetAccessToken() string {
+	if m != nil {
+		return m.AccessToken
+	}
+	return ""
+}
+
+func (m *PatGenerateResponse) GetToken() *PersonalAccessToken {
+	if m != nil {
+		return m.Token
+	}
+	return nil
+}
+
+type PatVerifyRequest struct {
+	AccessToken string `protobuf:"bytes,1,opt,name=AccessToken" json:"AccessToken,omitempty"`
+}
+
+func (m *PatVerifyRequest) Reset()         { *m = PatVerifyRequest{} }
+func (m *PatVerifyRequest) String() string { return proto.CompactTextString(m) }
+func (*PatVerifyRequest) ProtoMessage()    {}
+
+func (m *PatVerifyRequest) GetAccessToken() string {
+	if m != nil {
+		return m.AccessToken
+	}
+	return ""
+}
+
+type PatVerifyResponse struct {
+	Success bool                 `protobuf:"varint,1,opt,name=Success" json:"Success,omitempty"`
+	Token   *PersonalAccessToken `protobuf:"bytes,2,opt,name=Token" json:"Token,omitempty"`
+}
+
+func (m *PatVerifyResponse) Reset()         { *m = PatVerifyResponse{} }
+func (m *PatVerifyResponse) String() string { return proto.CompactTextString(m) }
+func (*PatVerifyResponse) ProtoMessage()    {}
+
+func (m *PatVerifyResponse) GetSuccess() bool {
+	if m != nil {
+		return m.Success
+	}
+	return false
+}
+
+func (m *PatVerifyResponse) GetToken() *PersonalAccessToken {
+	if m != nil {
+		return m.Token
+	}
+	return nil
+}
+
+type PatListRequest struct {
+	// List tokens of this user, defaults to the current user
+	UserLogin string `protobuf:"bytes,1,opt,name=UserLogin" json:"UserLogin,omitempty"`
+}
+
+func (m *PatListRequest) Reset()         { *m = PatListRequest{} }
+func (m *PatListRequest) String() string { return proto.CompactTextString(m) }
+func (*PatListRequest) ProtoMessage()    {}
+
+func (m *PatListRequest) GetUserLogin() string {
+	if m != nil {
+		return m.UserLogin
+	}
+	return ""
+}
+
+type PatListResponse struct {
+	Tokens []*PersonalAccessToken `protobuf:"bytes,1,rep,name=Tokens" json:"Tokens,omitempty"`
+}
+
+func (m *PatListResponse) Reset()         { *m = PatListResponse{} }
+func (m *PatListResponse) String() string { return proto.CompactTextString(m) }
+func (*PatListResponse) ProtoMessage()    {}
+
+func (m *PatListResponse) GetTokens() []*PersonalAccessToken {
+	if m != nil {
+		return m.Tokens
+	}
+	return nil
+}
+
+type PatRevokeRequest struct {
+	Uuid string `protobuf:"bytes,1,opt,name=Uuid" json:"Uuid,omitempty"`
+}
+
+func (m *PatRevokeRequest) Reset()         { *m = PatRevokeRequest{} }
+func (m *PatRevokeRequest) String() string { return proto.CompactTextString(m) }
+func (*PatRevokeRequest) ProtoMessage()    {}
+
+func (m *PatRevokeRequest) GetUuid() string {
+	if m != nil {
+		return m.Uuid
+	}
+	return ""
+}
+
+type PatRevokeResponse struct {
+	Success bool `protobuf:"varint,1,opt,name=Success" json:"Success,omitempty"`
+}
+
+func (m *PatRevokeResponse) Reset()         { *m = PatRevokeResponse{} }
+func (m *PatRevokeResponse) String() string { return proto.CompactTextString(m) }
+func (*PatRevokeResponse) ProtoMessage()    {}
+
+func (m *PatRevokeResponse) GetSuccess() bool {
+	if m != nil {
+		return m.Success
+	}
+	return false
+}
+
 func init() {
 	proto.RegisterType((*Token)(nil), "auth.Token")
 	proto.RegisterType((*MatchInvalidTokenRequest)(nil), "auth.MatchInvalidTokenRequest")
@@ -187,6 +483,15 @@ func init() {
 	proto.RegisterType((*RevokeTokenResponse)(nil), "auth.RevokeTokenResponse")
 	proto.RegisterType((*PruneTokensRequest)(nil), "auth.PruneTokensRequest")
 	proto.RegisterType((*PruneTokensResponse)(nil), "auth.PruneTokensResponse")
+	proto.RegisterType((*PersonalAccessToken)(nil), "auth.PersonalAccessToken")
+	proto.RegisterType((*PatGenerateRequest)(nil), "auth.PatGenerateRequest")
+	proto.RegisterType((*PatGenerateResponse)(nil), "auth.PatGenerateResponse")
+	proto.RegisterType((*PatVerifyRequest)(nil), "auth.PatVerifyRequest")
+	proto.RegisterType((*PatVerifyResponse)(nil), "auth.PatVerifyResponse")
+	proto.RegisterType((*PatListRequest)(nil), "auth.PatListRequest")
+	proto.RegisterType((*PatListResponse)(nil), "auth.PatListResponse")
+	proto.RegisterType((*PatRevokeRequest)(nil), "auth.PatRevokeRequest")
+	proto.RegisterType((*PatRevokeResponse)(nil), "auth.PatRevokeResponse")
 	proto.RegisterEnum("auth.State", State_name, State_value)
 }
 
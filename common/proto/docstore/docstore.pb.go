@@ -5,9 +5,11 @@
 Package docstore is a generated protocol buffer package.
 
 It is generated from these files:
+
 	docstore.proto
 
 It has these top-level messages:
+
 	Document
 	DocumentQuery
 	PutDocumentRequest
@@ -142,6 +144,10 @@ type PutDocumentRequest struct {
 	StoreID    string    `protobuf:"bytes,1,opt,name=StoreID" json:"StoreID,omitempty"`
 	DocumentID string    `protobuf:"bytes,2,opt,name=DocumentID" json:"DocumentID,omitempty"`
 	Document   *Document `protobuf:"bytes,3,opt,name=Document" json:"Document,omitempty"`
+	// If set, the document is only replaced if its current data is equal to this value
+	ExpectedData string `protobuf:"bytes,4,opt,name=ExpectedData" json:"ExpectedData,omitempty"`
+	// If set, the document is only created if it does not exist yet
+	CreateOnly bool `protobuf:"varint,5,opt,name=CreateOnly" json:"CreateOnly,omitempty"`
 }
 
 func (m *PutDocumentRequest) Reset()                    { *m = PutDocumentRequest{} }
@@ -170,6 +176,20 @@ func (m *PutDocumentRequest) GetDocument() *Document {
 	return nil
 }
 
+func (m *PutDocumentRequest) GetExpectedData() string {
+	if m != nil {
+		return m.ExpectedData
+	}
+	return ""
+}
+
+func (m *PutDocumentRequest) GetCreateOnly() bool {
+	if m != nil {
+		return m.CreateOnly
+	}
+	return false
+}
+
 type PutDocumentResponse struct {
 	Document *Document `protobuf:"bytes,1,opt,name=Document" json:"Document,omitempty"`
 }
@@ -8,6 +8,7 @@ type TargetUserEntry struct {
 // HashDocument is a Json Marshallable representation of a document, compatible with legacy.
 type ShareDocument struct {
 	ShareType             string                      `json:"SHARE_TYPE"`
+	StartTime             int64                       `json:"START_TIME"`
 	ExpireTime            int64                       `json:"EXPIRE_TIME"`
 	ShortFormUrl          string                      `json:"SHORT_FORM_URL"`
 	RepositoryId          string                      `json:"REPOSITORY"`
@@ -24,4 +25,16 @@ type ShareDocument struct {
 	RestrictToTargetUsers bool                        `json:"RESTRICT_TO_TARGET_USERS"`
 	OwnerId               string                      `json:"OWNER_ID"`
 	PreUserUuid           string                      `json:"USER_UUID"`
+	FileDrop              bool                        `json:"FILE_DROP"`
+	FileDropMaxSize       int64                       `json:"FILE_DROP_MAX_SIZE"`
+	FileDropExtensions    []string                    `json:"FILE_DROP_EXTENSIONS"`
+}
+
+// ShareLinkDownload is attached to the nodes of the READ events triggered by public links downloads,
+// for dispatching a notification to the link owner.
+type ShareLinkDownload struct {
+	LinkHash      string `json:"linkHash"`
+	OwnerId       string `json:"ownerId"`
+	DownloadCount int64  `json:"downloadCount"`
+	DownloadLimit int64  `json:"downloadLimit"`
 }
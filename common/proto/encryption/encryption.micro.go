@@ -79,6 +79,7 @@ type UserKeyStoreClient interface {
 	AdminDeleteKey(ctx context.Context, in *AdminDeleteKeyRequest, opts ...client.CallOption) (*AdminDeleteKeyResponse, error)
 	AdminExportKey(ctx context.Context, in *AdminExportKeyRequest, opts ...client.CallOption) (*AdminExportKeyResponse, error)
 	AdminImportKey(ctx context.Context, in *AdminImportKeyRequest, opts ...client.CallOption) (*AdminImportKeyResponse, error)
+	UpdateKeysPassword(ctx context.Context, in *UpdateKeysPasswordRequest, opts ...client.CallOption) (*UpdateKeysPasswordResponse, error)
 }
 
 type userKeyStoreClient struct {
@@ -169,6 +170,16 @@ func (c *userKeyStoreClient) AdminImportKey(ctx context.Context, in *AdminImport
 	return out, nil
 }
 
+func (c *userKeyStoreClient) UpdateKeysPassword(ctx context.Context, in *UpdateKeysPasswordRequest, opts ...client.CallOption) (*UpdateKeysPasswordResponse, error) {
+	req := c.c.NewRequest(c.serviceName, "UserKeyStore.UpdateKeysPassword", in)
+	out := new(UpdateKeysPasswordResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for UserKeyStore service
 
 type UserKeyStoreHandler interface {
@@ -179,6 +190,7 @@ type UserKeyStoreHandler interface {
 	AdminDeleteKey(context.Context, *AdminDeleteKeyRequest, *AdminDeleteKeyResponse) error
 	AdminExportKey(context.Context, *AdminExportKeyRequest, *AdminExportKeyResponse) error
 	AdminImportKey(context.Context, *AdminImportKeyRequest, *AdminImportKeyResponse) error
+	UpdateKeysPassword(context.Context, *UpdateKeysPasswordRequest, *UpdateKeysPasswordResponse) error
 }
 
 func RegisterUserKeyStoreHandler(s server.Server, hdlr UserKeyStoreHandler, opts ...server.HandlerOption) {
@@ -217,6 +229,10 @@ func (h *UserKeyStore) AdminImportKey(ctx context.Context, in *AdminImportKeyReq
 	return h.UserKeyStoreHandler.AdminImportKey(ctx, in, out)
 }
 
+func (h *UserKeyStore) UpdateKeysPassword(ctx context.Context, in *UpdateKeysPasswordRequest, out *UpdateKeysPasswordResponse) error {
+	return h.UserKeyStoreHandler.UpdateKeysPassword(ctx, in, out)
+}
+
 // Client API for NodeKeyManager service
 
 type NodeKeyManagerClient interface {
@@ -226,6 +242,8 @@ type NodeKeyManagerClient interface {
 	SetNodeKey(ctx context.Context, in *SetNodeKeyRequest, opts ...client.CallOption) (*SetNodeKeyResponse, error)
 	DeleteNodeKey(ctx context.Context, in *DeleteNodeKeyRequest, opts ...client.CallOption) (*DeleteNodeKeyResponse, error)
 	DeleteNodeSharedKey(ctx context.Context, in *DeleteNodeSharedKeyRequest, opts ...client.CallOption) (*DeleteNodeSharedKeyResponse, error)
+	RotateKey(ctx context.Context, in *RotateKeyRequest, opts ...client.CallOption) (*RotateKeyResponse, error)
+	GetKeyRotation(ctx context.Context, in *GetKeyRotationRequest, opts ...client.CallOption) (*GetKeyRotationResponse, error)
 }
 
 type nodeKeyManagerClient struct {
@@ -306,6 +324,26 @@ func (c *nodeKeyManagerClient) DeleteNodeSharedKey(ctx context.Context, in *Dele
 	return out, nil
 }
 
+func (c *nodeKeyManagerClient) RotateKey(ctx context.Context, in *RotateKeyRequest, opts ...client.CallOption) (*RotateKeyResponse, error) {
+	req := c.c.NewRequest(c.serviceName, "NodeKeyManager.RotateKey", in)
+	out := new(RotateKeyResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nodeKeyManagerClient) GetKeyRotation(ctx context.Context, in *GetKeyRotationRequest, opts ...client.CallOption) (*GetKeyRotationResponse, error) {
+	req := c.c.NewRequest(c.serviceName, "NodeKeyManager.GetKeyRotation", in)
+	out := new(GetKeyRotationResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for NodeKeyManager service
 
 type NodeKeyManagerHandler interface {
@@ -315,6 +353,8 @@ type NodeKeyManagerHandler interface {
 	SetNodeKey(context.Context, *SetNodeKeyRequest, *SetNodeKeyResponse) error
 	DeleteNodeKey(context.Context, *DeleteNodeKeyRequest, *DeleteNodeKeyResponse) error
 	DeleteNodeSharedKey(context.Context, *DeleteNodeSharedKeyRequest, *DeleteNodeSharedKeyResponse) error
+	RotateKey(context.Context, *RotateKeyRequest, *RotateKeyResponse) error
+	GetKeyRotation(context.Context, *GetKeyRotationRequest, *GetKeyRotationResponse) error
 }
 
 func RegisterNodeKeyManagerHandler(s server.Server, hdlr NodeKeyManagerHandler, opts ...server.HandlerOption) {
@@ -348,3 +388,11 @@ func (h *NodeKeyManager) DeleteNodeKey(ctx context.Context, in *DeleteNodeKeyReq
 func (h *NodeKeyManager) DeleteNodeSharedKey(ctx context.Context, in *DeleteNodeSharedKeyRequest, out *DeleteNodeSharedKeyResponse) error {
 	return h.NodeKeyManagerHandler.DeleteNodeSharedKey(ctx, in, out)
 }
+
+func (h *NodeKeyManager) RotateKey(ctx context.Context, in *RotateKeyRequest, out *RotateKeyResponse) error {
+	return h.NodeKeyManagerHandler.RotateKey(ctx, in, out)
+}
+
+func (h *NodeKeyManager) GetKeyRotation(ctx context.Context, in *GetKeyRotationRequest, out *GetKeyRotationResponse) error {
+	return h.NodeKeyManagerHandler.GetKeyRotation(ctx, in, out)
+}
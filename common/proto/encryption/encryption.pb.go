@@ -40,6 +40,13 @@ It has these top-level messages:
 	DeleteNodeKeyResponse
 	DeleteNodeSharedKeyRequest
 	DeleteNodeSharedKeyResponse
+	KeyRotation
+	RotateKeyRequest
+	RotateKeyResponse
+	GetKeyRotationRequest
+	GetKeyRotationResponse
+	UpdateKeysPasswordRequest
+	UpdateKeysPasswordResponse
 */
 package encryption
 
@@ -58,6 +65,34 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
+type KeyRotationStatus int32
+
+const (
+	// Node keys are being rewrapped with the new key
+	KeyRotationStatus_RotationRunning KeyRotationStatus = 0
+	// Datasource uses the new key, remaining node keys are being swept
+	KeyRotationStatus_RotationFinalizing KeyRotationStatus = 1
+	KeyRotationStatus_RotationDone       KeyRotationStatus = 2
+	KeyRotationStatus_RotationError      KeyRotationStatus = 3
+)
+
+var KeyRotationStatus_name = map[int32]string{
+	0: "RotationRunning",
+	1: "RotationFinalizing",
+	2: "RotationDone",
+	3: "RotationError",
+}
+var KeyRotationStatus_value = map[string]int32{
+	"RotationRunning":    0,
+	"RotationFinalizing": 1,
+	"RotationDone":       2,
+	"RotationError":      3,
+}
+
+func (x KeyRotationStatus) String() string {
+	return proto.EnumName(KeyRotationStatus_name, int32(x))
+}
+
 type Export struct {
 	By   string `protobuf:"bytes,1,opt,name=By" json:"By,omitempty"`
 	Date int32  `protobuf:"varint,2,opt,name=Date" json:"Date,omitempty"`
@@ -770,6 +805,242 @@ func (m *DeleteNodeSharedKeyResponse) String() string            { return proto.
 func (*DeleteNodeSharedKeyResponse) ProtoMessage()               {}
 func (*DeleteNodeSharedKeyResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{31} }
 
+type KeyRotation struct {
+	DataSource string            `protobuf:"bytes,1,opt,name=DataSource" json:"DataSource,omitempty"`
+	OldKeyID   string            `protobuf:"bytes,2,opt,name=OldKeyID" json:"OldKeyID,omitempty"`
+	NewKeyID   string            `protobuf:"bytes,3,opt,name=NewKeyID" json:"NewKeyID,omitempty"`
+	Status     KeyRotationStatus `protobuf:"varint,4,opt,name=Status,enum=encryption.KeyRotationStatus" json:"Status,omitempty"`
+	// Last node whose key was rewrapped, used to resume an interrupted rotation
+	Cursor       string `protobuf:"bytes,5,opt,name=Cursor" json:"Cursor,omitempty"`
+	Rewrapped    int64  `protobuf:"varint,6,opt,name=Rewrapped" json:"Rewrapped,omitempty"`
+	Total        int64  `protobuf:"varint,7,opt,name=Total" json:"Total,omitempty"`
+	RetireOldKey bool   `protobuf:"varint,8,opt,name=RetireOldKey" json:"RetireOldKey,omitempty"`
+	StartTime    int32  `protobuf:"varint,9,opt,name=StartTime" json:"StartTime,omitempty"`
+	UpdateTime   int32  `protobuf:"varint,10,opt,name=UpdateTime" json:"UpdateTime,omitempty"`
+	Error        string `protobuf:"bytes,11,opt,name=Error" json:"Error,omitempty"`
+}
+
+func (m *KeyRotation) Reset()         { *m = KeyRotation{} }
+func (m *KeyRotation) String() string { return proto.CompactTextString(m) }
+func (*KeyRotation) ProtoMessage()    {}
+
+func (m *KeyRotation) GetDataSource() string {
+	if m != nil {
+		return m.DataSource
+	}
+	return ""
+}
+
+func (m *KeyRotation) GetOldKeyID() string {
+	if m != nil {
+		return m.OldKeyID
+	}
+	return ""
+}
+
+func (m *KeyRotation) GetNewKeyID() string {
+	if m != nil {
+		return m.NewKeyID
+	}
+	return ""
+}
+
+func (m *KeyRotation) GetStatus() KeyRotationStatus {
+	if m != nil {
+		return m.Status
+	}
+	return KeyRotationStatus_RotationRunning
+}
+
+func (m *KeyRotation) GetCursor() string {
+	if m != nil {
+		return m.Cursor
+	}
+	return ""
+}
+
+func (m *KeyRotation) GetRewrapped() int64 {
+	if m != nil {
+		return m.Rewrapped
+	}
+	return 0
+}
+
+func (m *KeyRotation) GetTotal() int64 {
+	if m != nil {
+		return m.Total
+	}
+	return 0
+}
+
+func (m *KeyRotation) GetRetireOldKey() bool {
+	if m != nil {
+		return m.RetireOldKey
+	}
+	return false
+}
+
+func (m *KeyRotation) GetStartTime() int32 {
+	if m != nil {
+		return m.StartTime
+	}
+	return 0
+}
+
+func (m *KeyRotation) GetUpdateTime() int32 {
+	if m != nil {
+		return m.UpdateTime
+	}
+	return 0
+}
+
+func (m *KeyRotation) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+type RotateKeyRequest struct {
+	DataSource string `protobuf:"bytes,1,opt,name=DataSource" json:"DataSource,omitempty"`
+	// Id and label of the key to create, generated if empty
+	NewKeyID    string `protobuf:"bytes,2,opt,name=NewKeyID" json:"NewKeyID,omitempty"`
+	NewKeyLabel string `protobuf:"bytes,3,opt,name=NewKeyLabel" json:"NewKeyLabel,omitempty"`
+	// Keep the old key in the key store once all node keys are rewrapped
+	KeepOldKey bool `protobuf:"varint,4,opt,name=KeepOldKey" json:"KeepOldKey,omitempty"`
+}
+
+func (m *RotateKeyRequest) Reset()         { *m = RotateKeyRequest{} }
+func (m *RotateKeyRequest) String() string { return proto.CompactTextString(m) }
+func (*RotateKeyRequest) ProtoMessage()    {}
+
+func (m *RotateKeyRequest) GetDataSource() string {
+	if m != nil {
+		return m.DataSource
+	}
+	return ""
+}
+
+func (m *RotateKeyRequest) GetNewKeyID() string {
+	if m != nil {
+		return m.NewKeyID
+	}
+	return ""
+}
+
+func (m *RotateKeyRequest) GetNewKeyLabel() string {
+	if m != nil {
+		return m.NewKeyLabel
+	}
+	return ""
+}
+
+func (m *RotateKeyRequest) GetKeepOldKey() bool {
+	if m != nil {
+		return m.KeepOldKey
+	}
+	return false
+}
+
+type RotateKeyResponse struct {
+	Rotation *KeyRotation `protobuf:"bytes,1,opt,name=Rotation" json:"Rotation,omitempty"`
+}
+
+func (m *RotateKeyResponse) Reset()         { *m = RotateKeyResponse{} }
+func (m *RotateKeyResponse) String() string { return proto.CompactTextString(m) }
+func (*RotateKeyResponse) ProtoMessage()    {}
+
+func (m *RotateKeyResponse) GetRotation() *KeyRotation {
+	if m != nil {
+		return m.Rotation
+	}
+	return nil
+}
+
+type GetKeyRotationRequest struct {
+	DataSource string `protobuf:"bytes,1,opt,name=DataSource" json:"DataSource,omitempty"`
+}
+
+func (m *GetKeyRotationRequest) Reset()         { *m = GetKeyRotationRequest{} }
+func (m *GetKeyRotationRequest) String() string { return proto.CompactTextString(m) }
+func (*GetKeyRotationRequest) ProtoMessage()    {}
+
+func (m *GetKeyRotationRequest) GetDataSource() string {
+	if m != nil {
+		return m.DataSource
+	}
+	return ""
+}
+
+type GetKeyRotationResponse struct {
+	Rotation *KeyRotation `protobuf:"bytes,1,opt,name=Rotation" json:"Rotation,omitempty"`
+}
+
+func (m *GetKeyRotationResponse) Reset()         { *m = GetKeyRotationResponse{} }
+func (m *GetKeyRotationResponse) String() string { return proto.CompactTextString(m) }
+func (*GetKeyRotationResponse) ProtoMessage()    {}
+
+func (m *GetKeyRotationResponse) GetRotation() *KeyRotation {
+	if m != nil {
+		return m.Rotation
+	}
+	return nil
+}
+
+type UpdateKeysPasswordRequest struct {
+	Owner       string `protobuf:"bytes,1,opt,name=Owner" json:"Owner,omitempty"`
+	OldPassword string `protobuf:"bytes,2,opt,name=OldPassword" json:"OldPassword,omitempty"`
+	NewPassword string `protobuf:"bytes,3,opt,name=NewPassword" json:"NewPassword,omitempty"`
+}
+
+func (m *UpdateKeysPasswordRequest) Reset()         { *m = UpdateKeysPasswordRequest{} }
+func (m *UpdateKeysPasswordRequest) String() string { return proto.CompactTextString(m) }
+func (*UpdateKeysPasswordRequest) ProtoMessage()    {}
+
+func (m *UpdateKeysPasswordRequest) GetOwner() string {
+	if m != nil {
+		return m.Owner
+	}
+	return ""
+}
+
+func (m *UpdateKeysPasswordRequest) GetOldPassword() string {
+	if m != nil {
+		return m.OldPassword
+	}
+	return ""
+}
+
+func (m *UpdateKeysPasswordRequest) GetNewPassword() string {
+	if m != nil {
+		return m.NewPassword
+	}
+	return ""
+}
+
+type UpdateKeysPasswordResponse struct {
+	Success bool  `protobuf:"varint,1,opt,name=Success" json:"Success,omitempty"`
+	Updated int32 `protobuf:"varint,2,opt,name=Updated" json:"Updated,omitempty"`
+}
+
+func (m *UpdateKeysPasswordResponse) Reset()         { *m = UpdateKeysPasswordResponse{} }
+func (m *UpdateKeysPasswordResponse) String() string { return proto.CompactTextString(m) }
+func (*UpdateKeysPasswordResponse) ProtoMessage()    {}
+
+func (m *UpdateKeysPasswordResponse) GetSuccess() bool {
+	if m != nil {
+		return m.Success
+	}
+	return false
+}
+
+func (m *UpdateKeysPasswordResponse) GetUpdated() int32 {
+	if m != nil {
+		return m.Updated
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*Export)(nil), "encryption.Export")
 	proto.RegisterType((*Import)(nil), "encryption.Import")
@@ -803,6 +1074,14 @@ func init() {
 	proto.RegisterType((*DeleteNodeKeyResponse)(nil), "encryption.DeleteNodeKeyResponse")
 	proto.RegisterType((*DeleteNodeSharedKeyRequest)(nil), "encryption.DeleteNodeSharedKeyRequest")
 	proto.RegisterType((*DeleteNodeSharedKeyResponse)(nil), "encryption.DeleteNodeSharedKeyResponse")
+	proto.RegisterType((*KeyRotation)(nil), "encryption.KeyRotation")
+	proto.RegisterType((*RotateKeyRequest)(nil), "encryption.RotateKeyRequest")
+	proto.RegisterType((*RotateKeyResponse)(nil), "encryption.RotateKeyResponse")
+	proto.RegisterType((*GetKeyRotationRequest)(nil), "encryption.GetKeyRotationRequest")
+	proto.RegisterType((*GetKeyRotationResponse)(nil), "encryption.GetKeyRotationResponse")
+	proto.RegisterType((*UpdateKeysPasswordRequest)(nil), "encryption.UpdateKeysPasswordRequest")
+	proto.RegisterType((*UpdateKeysPasswordResponse)(nil), "encryption.UpdateKeysPasswordResponse")
+	proto.RegisterEnum("encryption.KeyRotationStatus", KeyRotationStatus_name, KeyRotationStatus_value)
 }
 
 func init() { proto.RegisterFile("encryption.proto", fileDescriptor0) }
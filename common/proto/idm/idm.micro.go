@@ -66,6 +66,12 @@ It has these top-level messages:
 	DeletePolicyGroupResponse
 	ListPolicyGroupsRequest
 	ListPolicyGroupsResponse
+	PolicyExplainRequest
+	PolicyConditionExplanation
+	PolicyExplanation
+	PolicyExplainResponse
+	IsAllowedManyRequest
+	IsAllowedManyResponse
 */
 package idm
 
@@ -1311,9 +1317,11 @@ func (x *userMetaServiceListUserMetaNamespaceStream) Send(m *ListUserMetaNamespa
 
 type PolicyEngineServiceClient interface {
 	IsAllowed(ctx context.Context, in *PolicyEngineRequest, opts ...client.CallOption) (*PolicyEngineResponse, error)
+	IsAllowedMany(ctx context.Context, in *IsAllowedManyRequest, opts ...client.CallOption) (*IsAllowedManyResponse, error)
 	StorePolicyGroup(ctx context.Context, in *StorePolicyGroupRequest, opts ...client.CallOption) (*StorePolicyGroupResponse, error)
 	ListPolicyGroups(ctx context.Context, in *ListPolicyGroupsRequest, opts ...client.CallOption) (*ListPolicyGroupsResponse, error)
 	DeletePolicyGroup(ctx context.Context, in *DeletePolicyGroupRequest, opts ...client.CallOption) (*DeletePolicyGroupResponse, error)
+	ExplainPolicies(ctx context.Context, in *PolicyExplainRequest, opts ...client.CallOption) (*PolicyExplainResponse, error)
 }
 
 type policyEngineServiceClient struct {
@@ -1344,6 +1352,16 @@ func (c *policyEngineServiceClient) IsAllowed(ctx context.Context, in *PolicyEng
 	return out, nil
 }
 
+func (c *policyEngineServiceClient) IsAllowedMany(ctx context.Context, in *IsAllowedManyRequest, opts ...client.CallOption) (*IsAllowedManyResponse, error) {
+	req := c.c.NewRequest(c.serviceName, "PolicyEngineService.IsAllowedMany", in)
+	out := new(IsAllowedManyResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *policyEngineServiceClient) StorePolicyGroup(ctx context.Context, in *StorePolicyGroupRequest, opts ...client.CallOption) (*StorePolicyGroupResponse, error) {
 	req := c.c.NewRequest(c.serviceName, "PolicyEngineService.StorePolicyGroup", in)
 	out := new(StorePolicyGroupResponse)
@@ -1374,13 +1392,25 @@ func (c *policyEngineServiceClient) DeletePolicyGroup(ctx context.Context, in *D
 	return out, nil
 }
 
+func (c *policyEngineServiceClient) ExplainPolicies(ctx context.Context, in *PolicyExplainRequest, opts ...client.CallOption) (*PolicyExplainResponse, error) {
+	req := c.c.NewRequest(c.serviceName, "PolicyEngineService.ExplainPolicies", in)
+	out := new(PolicyExplainResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for PolicyEngineService service
 
 type PolicyEngineServiceHandler interface {
 	IsAllowed(context.Context, *PolicyEngineRequest, *PolicyEngineResponse) error
+	IsAllowedMany(context.Context, *IsAllowedManyRequest, *IsAllowedManyResponse) error
 	StorePolicyGroup(context.Context, *StorePolicyGroupRequest, *StorePolicyGroupResponse) error
 	ListPolicyGroups(context.Context, *ListPolicyGroupsRequest, *ListPolicyGroupsResponse) error
 	DeletePolicyGroup(context.Context, *DeletePolicyGroupRequest, *DeletePolicyGroupResponse) error
+	ExplainPolicies(context.Context, *PolicyExplainRequest, *PolicyExplainResponse) error
 }
 
 func RegisterPolicyEngineServiceHandler(s server.Server, hdlr PolicyEngineServiceHandler, opts ...server.HandlerOption) {
@@ -1395,6 +1425,10 @@ func (h *PolicyEngineService) IsAllowed(ctx context.Context, in *PolicyEngineReq
 	return h.PolicyEngineServiceHandler.IsAllowed(ctx, in, out)
 }
 
+func (h *PolicyEngineService) IsAllowedMany(ctx context.Context, in *IsAllowedManyRequest, out *IsAllowedManyResponse) error {
+	return h.PolicyEngineServiceHandler.IsAllowedMany(ctx, in, out)
+}
+
 func (h *PolicyEngineService) StorePolicyGroup(ctx context.Context, in *StorePolicyGroupRequest, out *StorePolicyGroupResponse) error {
 	return h.PolicyEngineServiceHandler.StorePolicyGroup(ctx, in, out)
 }
@@ -1406,3 +1440,7 @@ func (h *PolicyEngineService) ListPolicyGroups(ctx context.Context, in *ListPoli
 func (h *PolicyEngineService) DeletePolicyGroup(ctx context.Context, in *DeletePolicyGroupRequest, out *DeletePolicyGroupResponse) error {
 	return h.PolicyEngineServiceHandler.DeletePolicyGroup(ctx, in, out)
 }
+
+func (h *PolicyEngineService) ExplainPolicies(ctx context.Context, in *PolicyExplainRequest, out *PolicyExplainResponse) error {
+	return h.PolicyEngineServiceHandler.ExplainPolicies(ctx, in, out)
+}
@@ -66,6 +66,12 @@ It has these top-level messages:
 	DeletePolicyGroupResponse
 	ListPolicyGroupsRequest
 	ListPolicyGroupsResponse
+	PolicyExplainRequest
+	PolicyConditionExplanation
+	PolicyExplanation
+	PolicyExplainResponse
+	IsAllowedManyRequest
+	IsAllowedManyResponse
 */
 package idm
 
@@ -1633,13 +1639,14 @@ func (m *ListUserMetaNamespaceResponse) GetUserMetaNamespace() *UserMetaNamespac
 
 // Global Event message for IDM
 type ChangeEvent struct {
-	JsonType   string            `protobuf:"bytes,1,opt,name=jsonType,json=@type" json:"jsonType,omitempty"`
-	Type       ChangeEventType   `protobuf:"varint,2,opt,name=Type,enum=idm.ChangeEventType" json:"Type,omitempty"`
-	User       *User             `protobuf:"bytes,3,opt,name=User" json:"User,omitempty"`
-	Role       *Role             `protobuf:"bytes,4,opt,name=Role" json:"Role,omitempty"`
-	Workspace  *Workspace        `protobuf:"bytes,5,opt,name=Workspace" json:"Workspace,omitempty"`
-	Acl        *ACL              `protobuf:"bytes,6,opt,name=Acl" json:"Acl,omitempty"`
-	Attributes map[string]string `protobuf:"bytes,7,rep,name=Attributes" json:"Attributes,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	JsonType    string            `protobuf:"bytes,1,opt,name=jsonType,json=@type" json:"jsonType,omitempty"`
+	Type        ChangeEventType   `protobuf:"varint,2,opt,name=Type,enum=idm.ChangeEventType" json:"Type,omitempty"`
+	User        *User             `protobuf:"bytes,3,opt,name=User" json:"User,omitempty"`
+	Role        *Role             `protobuf:"bytes,4,opt,name=Role" json:"Role,omitempty"`
+	Workspace   *Workspace        `protobuf:"bytes,5,opt,name=Workspace" json:"Workspace,omitempty"`
+	Acl         *ACL              `protobuf:"bytes,6,opt,name=Acl" json:"Acl,omitempty"`
+	Attributes  map[string]string `protobuf:"bytes,7,rep,name=Attributes" json:"Attributes,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	PolicyGroup *PolicyGroup      `protobuf:"bytes,8,opt,name=PolicyGroup" json:"PolicyGroup,omitempty"`
 }
 
 func (m *ChangeEvent) Reset()                    { *m = ChangeEvent{} }
@@ -1696,6 +1703,13 @@ func (m *ChangeEvent) GetAttributes() map[string]string {
 	return nil
 }
 
+func (m *ChangeEvent) GetPolicyGroup() *PolicyGroup {
+	if m != nil {
+		return m.PolicyGroup
+	}
+	return nil
+}
+
 // ************************************
 // Messages Structures
 // ************************************
@@ -2020,6 +2034,273 @@ func (m *ListPolicyGroupsResponse) GetTotal() int32 {
 	return 0
 }
 
+type PolicyExplainRequest struct {
+	Resource string            `protobuf:"bytes,1,opt,name=Resource" json:"Resource,omitempty"`
+	Action   string            `protobuf:"bytes,2,opt,name=Action" json:"Action,omitempty"`
+	Subjects []string          `protobuf:"bytes,3,rep,name=Subjects" json:"Subjects,omitempty"`
+	Context  map[string]string `protobuf:"bytes,4,rep,name=Context" json:"Context,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Login of a user whose own, profile and roles subjects are added to Subjects
+	Login string `protobuf:"bytes,5,opt,name=Login" json:"Login,omitempty"`
+	// Unsaved policy groups, evaluated in place of the stored groups with the same Uuid
+	DryRunGroups []*PolicyGroup `protobuf:"bytes,6,rep,name=DryRunGroups" json:"DryRunGroups,omitempty"`
+}
+
+func (m *PolicyExplainRequest) Reset()         { *m = PolicyExplainRequest{} }
+func (m *PolicyExplainRequest) String() string { return proto.CompactTextString(m) }
+func (*PolicyExplainRequest) ProtoMessage()    {}
+
+func (m *PolicyExplainRequest) GetResource() string {
+	if m != nil {
+		return m.Resource
+	}
+	return ""
+}
+
+func (m *PolicyExplainRequest) GetAction() string {
+	if m != nil {
+		return m.Action
+	}
+	return ""
+}
+
+func (m *PolicyExplainRequest) GetSubjects() []string {
+	if m != nil {
+		return m.Subjects
+	}
+	return nil
+}
+
+func (m *PolicyExplainRequest) GetContext() map[string]string {
+	if m != nil {
+		return m.Context
+	}
+	return nil
+}
+
+func (m *PolicyExplainRequest) GetLogin() string {
+	if m != nil {
+		return m.Login
+	}
+	return ""
+}
+
+func (m *PolicyExplainRequest) GetDryRunGroups() []*PolicyGroup {
+	if m != nil {
+		return m.DryRunGroups
+	}
+	return nil
+}
+
+type PolicyConditionExplanation struct {
+	Key  string `protobuf:"bytes,1,opt,name=Key" json:"Key,omitempty"`
+	Type string `protobuf:"bytes,2,opt,name=Type" json:"Type,omitempty"`
+	// Value found in the request context for this key
+	Value     string `protobuf:"bytes,3,opt,name=Value" json:"Value,omitempty"`
+	Fulfilled bool   `protobuf:"varint,4,opt,name=Fulfilled" json:"Fulfilled,omitempty"`
+}
+
+func (m *PolicyConditionExplanation) Reset()         { *m = PolicyConditionExplanation{} }
+func (m *PolicyConditionExplanation) String() string { return proto.CompactTextString(m) }
+func (*PolicyConditionExplanation) ProtoMessage()    {}
+
+func (m *PolicyConditionExplanation) GetKey() string {
+	if m != nil {
+		return m.Key
+	}
+	return ""
+}
+
+func (m *PolicyConditionExplanation) GetType() string {
+	if m != nil {
+		return m.Type
+	}
+	return ""
+}
+
+func (m *PolicyConditionExplanation) GetValue() string {
+	if m != nil {
+		return m.Value
+	}
+	return ""
+}
+
+func (m *PolicyConditionExplanation) GetFulfilled() bool {
+	if m != nil {
+		return m.Fulfilled
+	}
+	return false
+}
+
+type PolicyExplanation struct {
+	GroupUuid     string                        `protobuf:"bytes,1,opt,name=GroupUuid" json:"GroupUuid,omitempty"`
+	GroupName     string                        `protobuf:"bytes,2,opt,name=GroupName" json:"GroupName,omitempty"`
+	Policy        *Policy                       `protobuf:"bytes,3,opt,name=Policy" json:"Policy,omitempty"`
+	Subject       string                        `protobuf:"bytes,4,opt,name=Subject" json:"Subject,omitempty"`
+	SubjectMatch  bool                          `protobuf:"varint,5,opt,name=SubjectMatch" json:"SubjectMatch,omitempty"`
+	ResourceMatch bool                          `protobuf:"varint,6,opt,name=ResourceMatch" json:"ResourceMatch,omitempty"`
+	ActionMatch   bool                          `protobuf:"varint,7,opt,name=ActionMatch" json:"ActionMatch,omitempty"`
+	Conditions    []*PolicyConditionExplanation `protobuf:"bytes,8,rep,name=Conditions" json:"Conditions,omitempty"`
+	// Subject, resource, action and conditions all match: the policy effect applies
+	Applies bool `protobuf:"varint,9,opt,name=Applies" json:"Applies,omitempty"`
+	// Policy comes from a dry-run group
+	DryRun bool `protobuf:"varint,10,opt,name=DryRun" json:"DryRun,omitempty"`
+	// Error raised while matching the policy patterns
+	Error string `protobuf:"bytes,11,opt,name=Error" json:"Error,omitempty"`
+}
+
+func (m *PolicyExplanation) Reset()         { *m = PolicyExplanation{} }
+func (m *PolicyExplanation) String() string { return proto.CompactTextString(m) }
+func (*PolicyExplanation) ProtoMessage()    {}
+
+func (m *PolicyExplanation) GetGroupUuid() string {
+	if m != nil {
+		return m.GroupUuid
+	}
+	return ""
+}
+
+func (m *PolicyExplanation) GetGroupName() string {
+	if m != nil {
+		return m.GroupName
+	}
+	return ""
+}
+
+func (m *PolicyExplanation) GetPolicy() *Policy {
+	if m != nil {
+		return m.Policy
+	}
+	return nil
+}
+
+func (m *PolicyExplanation) GetSubject() string {
+	if m != nil {
+		return m.Subject
+	}
+	return ""
+}
+
+func (m *PolicyExplanation) GetSubjectMatch() bool {
+	if m != nil {
+		return m.SubjectMatch
+	}
+	return false
+}
+
+func (m *PolicyExplanation) GetResourceMatch() bool {
+	if m != nil {
+		return m.ResourceMatch
+	}
+	return false
+}
+
+func (m *PolicyExplanation) GetActionMatch() bool {
+	if m != nil {
+		return m.ActionMatch
+	}
+	return false
+}
+
+func (m *PolicyExplanation) GetConditions() []*PolicyConditionExplanation {
+	if m != nil {
+		return m.Conditions
+	}
+	return nil
+}
+
+func (m *PolicyExplanation) GetApplies() bool {
+	if m != nil {
+		return m.Applies
+	}
+	return false
+}
+
+func (m *PolicyExplanation) GetDryRun() bool {
+	if m != nil {
+		return m.DryRun
+	}
+	return false
+}
+
+func (m *PolicyExplanation) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+type PolicyExplainResponse struct {
+	Decision *PolicyEngineResponse `protobuf:"bytes,1,opt,name=Decision" json:"Decision,omitempty"`
+	// Subjects that were evaluated
+	Subjects     []string             `protobuf:"bytes,2,rep,name=Subjects" json:"Subjects,omitempty"`
+	Explanations []*PolicyExplanation `protobuf:"bytes,3,rep,name=Explanations" json:"Explanations,omitempty"`
+	// Policy that decided the outcome, empty when denied by default
+	DecidingPolicy *PolicyExplanation `protobuf:"bytes,4,opt,name=DecidingPolicy" json:"DecidingPolicy,omitempty"`
+}
+
+func (m *PolicyExplainResponse) Reset()         { *m = PolicyExplainResponse{} }
+func (m *PolicyExplainResponse) String() string { return proto.CompactTextString(m) }
+func (*PolicyExplainResponse) ProtoMessage()    {}
+
+func (m *PolicyExplainResponse) GetDecision() *PolicyEngineResponse {
+	if m != nil {
+		return m.Decision
+	}
+	return nil
+}
+
+func (m *PolicyExplainResponse) GetSubjects() []string {
+	if m != nil {
+		return m.Subjects
+	}
+	return nil
+}
+
+func (m *PolicyExplainResponse) GetExplanations() []*PolicyExplanation {
+	if m != nil {
+		return m.Explanations
+	}
+	return nil
+}
+
+func (m *PolicyExplainResponse) GetDecidingPolicy() *PolicyExplanation {
+	if m != nil {
+		return m.DecidingPolicy
+	}
+	return nil
+}
+
+// Check many requests at once, responses are returned in the same order
+type IsAllowedManyRequest struct {
+	Requests []*PolicyEngineRequest `protobuf:"bytes,1,rep,name=Requests" json:"Requests,omitempty"`
+}
+
+func (m *IsAllowedManyRequest) Reset()         { *m = IsAllowedManyRequest{} }
+func (m *IsAllowedManyRequest) String() string { return proto.CompactTextString(m) }
+func (*IsAllowedManyRequest) ProtoMessage()    {}
+
+func (m *IsAllowedManyRequest) GetRequests() []*PolicyEngineRequest {
+	if m != nil {
+		return m.Requests
+	}
+	return nil
+}
+
+type IsAllowedManyResponse struct {
+	Responses []*PolicyEngineResponse `protobuf:"bytes,1,rep,name=Responses" json:"Responses,omitempty"`
+}
+
+func (m *IsAllowedManyResponse) Reset()         { *m = IsAllowedManyResponse{} }
+func (m *IsAllowedManyResponse) String() string { return proto.CompactTextString(m) }
+func (*IsAllowedManyResponse) ProtoMessage()    {}
+
+func (m *IsAllowedManyResponse) GetResponses() []*PolicyEngineResponse {
+	if m != nil {
+		return m.Responses
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*CreateRoleRequest)(nil), "idm.CreateRoleRequest")
 	proto.RegisterType((*CreateRoleResponse)(nil), "idm.CreateRoleResponse")
@@ -2079,6 +2360,12 @@ func init() {
 	proto.RegisterType((*DeletePolicyGroupResponse)(nil), "idm.DeletePolicyGroupResponse")
 	proto.RegisterType((*ListPolicyGroupsRequest)(nil), "idm.ListPolicyGroupsRequest")
 	proto.RegisterType((*ListPolicyGroupsResponse)(nil), "idm.ListPolicyGroupsResponse")
+	proto.RegisterType((*PolicyExplainRequest)(nil), "idm.PolicyExplainRequest")
+	proto.RegisterType((*PolicyConditionExplanation)(nil), "idm.PolicyConditionExplanation")
+	proto.RegisterType((*PolicyExplanation)(nil), "idm.PolicyExplanation")
+	proto.RegisterType((*PolicyExplainResponse)(nil), "idm.PolicyExplainResponse")
+	proto.RegisterType((*IsAllowedManyRequest)(nil), "idm.IsAllowedManyRequest")
+	proto.RegisterType((*IsAllowedManyResponse)(nil), "idm.IsAllowedManyResponse")
 	proto.RegisterEnum("idm.NodeType", NodeType_name, NodeType_value)
 	proto.RegisterEnum("idm.WorkspaceScope", WorkspaceScope_name, WorkspaceScope_value)
 	proto.RegisterEnum("idm.ChangeEventType", ChangeEventType_name, ChangeEventType_value)
@@ -25,9 +25,18 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/pmker/yux/common/proto/idm"
 	"github.com/pmker/yux/common/proto/tree"
 )
 
+// Object types that can be used in IDM event names
+const (
+	IdmObjectUser      = "USER"
+	IdmObjectRole      = "ROLE"
+	IdmObjectWorkspace = "WORKSPACE"
+	IdmObjectAcl       = "ACL"
+)
+
 // NodeChangeEventName builds a simple string from a given event type
 func NodeChangeEventName(event tree.NodeChangeEvent_EventType) string {
 	return fmt.Sprintf("NODE_CHANGE:%v", int32(event))
@@ -50,3 +59,23 @@ func ParseNodeChangeEventName(eventName string) (tree.NodeChangeEvent_EventType,
 	}
 	return -1, false
 }
+
+// IdmChangeEventName builds a simple string from a given IDM object type and event type
+func IdmChangeEventName(objectType string, event idm.ChangeEventType) string {
+	return fmt.Sprintf("IDM_CHANGE:%s:%v", objectType, int32(event))
+}
+
+// IdmChangeEventObjectType finds which type of object is carried by an idm.ChangeEvent, or an empty string
+func IdmChangeEventObjectType(event *idm.ChangeEvent) string {
+	switch {
+	case event.User != nil:
+		return IdmObjectUser
+	case event.Role != nil:
+		return IdmObjectRole
+	case event.Workspace != nil:
+		return IdmObjectWorkspace
+	case event.Acl != nil:
+		return IdmObjectAcl
+	}
+	return ""
+}
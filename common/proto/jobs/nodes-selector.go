@@ -93,7 +93,6 @@ func (n *NodesSelector) Select(cl client.Client, ctx context.Context, objects ch
 			objects <- resp.Node
 		}
 	}
-	done <- true
 	return nil
 }
 
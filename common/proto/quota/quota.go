@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package quota
+
+import (
+	"strings"
+)
+
+/* quota.go file enriches default generated proto structs with some custom pydio methods to ease development */
+
+// SubjectsFor lists the subjects a write is charged to: the user, each group of its group path (from the
+// top-level group down to its own group) and the datasource. Empty values are skipped.
+func SubjectsFor(login string, groupPath string, dataSource string) (subjects []*Subject) {
+	if login != "" {
+		subjects = append(subjects, &Subject{Type: SubjectType_USER, Id: login})
+	}
+	var current string
+	for _, part := range strings.Split(strings.Trim(groupPath, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		current += "/" + part
+		subjects = append(subjects, &Subject{Type: SubjectType_GROUP, Id: current})
+	}
+	if dataSource != "" {
+		subjects = append(subjects, &Subject{Type: SubjectType_DATASOURCE, Id: dataSource})
+	}
+	return
+}
+
+// Exceeds tells if adding size bytes to this usage goes over its hard limit.
+func (u *Usage) Exceeds(size int64) bool {
+	return u.HardLimit > 0 && u.Bytes+size > u.HardLimit
+}
+
+// CrossedSoftLimit tells if the last change of delta bytes brought this usage over its soft limit.
+func (u *Usage) CrossedSoftLimit(delta int64) bool {
+	return u.SoftLimit > 0 && delta > 0 && u.Bytes >= u.SoftLimit && u.Bytes-delta < u.SoftLimit
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package quota
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSubjectsFor(t *testing.T) {
+
+	Convey("Subjects of a write", t, func() {
+		subjects := SubjectsFor("john", "/corp/rd/", "pydiods1")
+		So(subjects, ShouldHaveLength, 4)
+		So(subjects[0], ShouldResemble, &Subject{Type: SubjectType_USER, Id: "john"})
+		So(subjects[1], ShouldResemble, &Subject{Type: SubjectType_GROUP, Id: "/corp"})
+		So(subjects[2], ShouldResemble, &Subject{Type: SubjectType_GROUP, Id: "/corp/rd"})
+		So(subjects[3], ShouldResemble, &Subject{Type: SubjectType_DATASOURCE, Id: "pydiods1"})
+
+		So(SubjectsFor("", "/", "pydiods1"), ShouldHaveLength, 1)
+		So(SubjectsFor("", "", ""), ShouldBeEmpty)
+	})
+
+	Convey("Limits", t, func() {
+		u := &Usage{Bytes: 900, HardLimit: 1000, SoftLimit: 800}
+		So(u.Exceeds(100), ShouldBeFalse)
+		So(u.Exceeds(101), ShouldBeTrue)
+		So((&Usage{Bytes: 900}).Exceeds(1<<40), ShouldBeFalse)
+
+		So(u.CrossedSoftLimit(150), ShouldBeTrue)
+		So(u.CrossedSoftLimit(50), ShouldBeFalse)
+		So(u.CrossedSoftLimit(-150), ShouldBeFalse)
+	})
+
+}
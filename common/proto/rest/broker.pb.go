@@ -60,6 +60,13 @@ It has these top-level messages:
 	DeleteNodesResponse
 	RestoreNodesRequest
 	RestoreNodesResponse
+	ListRecycleRequest
+	RecycleItem
+	RecycleCollection
+	PurgeRecycleRequest
+	PurgeRecycleResponse
+	QuotaUsageRequest
+	QuotaUsageCollection
 	ListDocstoreRequest
 	DocstoreCollection
 	ChangeRequest
@@ -119,6 +126,7 @@ It has these top-level messages:
 	Cell
 	ShareLinkTargetUser
 	ShareLink
+	ShareLinkFileDrop
 	PutCellRequest
 	GetCellRequest
 	DeleteCellRequest
@@ -8,6 +8,7 @@ import fmt "fmt"
 import math "math"
 import tree "github.com/pmker/yux/common/proto/tree"
 import docstore "github.com/pmker/yux/common/proto/docstore"
+import quota "github.com/pmker/yux/common/proto/quota"
 
 // Reference imports to suppress errors if they are not otherwise used.
 var _ = proto.Marshal
@@ -15,8 +16,9 @@ var _ = fmt.Errorf
 var _ = math.Inf
 
 type SearchResults struct {
-	Results []*tree.Node `protobuf:"bytes,1,rep,name=Results" json:"Results,omitempty"`
-	Total   int32        `protobuf:"varint,2,opt,name=Total" json:"Total,omitempty"`
+	Results []*tree.Node        `protobuf:"bytes,1,rep,name=Results" json:"Results,omitempty"`
+	Total   int32               `protobuf:"varint,2,opt,name=Total" json:"Total,omitempty"`
+	Facets  []*tree.SearchFacet `protobuf:"bytes,3,rep,name=Facets" json:"Facets,omitempty"`
 }
 
 func (m *SearchResults) Reset()                    { *m = SearchResults{} }
@@ -38,6 +40,13 @@ func (m *SearchResults) GetTotal() int32 {
 	return 0
 }
 
+func (m *SearchResults) GetFacets() []*tree.SearchFacet {
+	if m != nil {
+		return m.Facets
+	}
+	return nil
+}
+
 // Generic container for responses sending pagination information
 type Pagination struct {
 	// Current Limit parameter, either passed by request or default value
@@ -502,6 +511,147 @@ func (m *RestoreNodesResponse) GetRestoreJobs() []*BackgroundJobResult {
 	return nil
 }
 
+type ListRecycleRequest struct {
+	// Path of the workspace or cell holding the recycle bin
+	Path string `protobuf:"bytes,1,opt,name=Path" json:"Path,omitempty"`
+}
+
+func (m *ListRecycleRequest) Reset()         { *m = ListRecycleRequest{} }
+func (m *ListRecycleRequest) String() string { return proto.CompactTextString(m) }
+func (*ListRecycleRequest) ProtoMessage()    {}
+
+func (m *ListRecycleRequest) GetPath() string {
+	if m != nil {
+		return m.Path
+	}
+	return ""
+}
+
+type RecycleItem struct {
+	Node         *tree.Node `protobuf:"bytes,1,opt,name=Node" json:"Node,omitempty"`
+	OriginalPath string     `protobuf:"bytes,2,opt,name=OriginalPath" json:"OriginalPath,omitempty"`
+	Owner        string     `protobuf:"bytes,3,opt,name=Owner" json:"Owner,omitempty"`
+	DeletionTime int32      `protobuf:"varint,4,opt,name=DeletionTime" json:"DeletionTime,omitempty"`
+}
+
+func (m *RecycleItem) Reset()         { *m = RecycleItem{} }
+func (m *RecycleItem) String() string { return proto.CompactTextString(m) }
+func (*RecycleItem) ProtoMessage()    {}
+
+func (m *RecycleItem) GetNode() *tree.Node {
+	if m != nil {
+		return m.Node
+	}
+	return nil
+}
+
+func (m *RecycleItem) GetOriginalPath() string {
+	if m != nil {
+		return m.OriginalPath
+	}
+	return ""
+}
+
+func (m *RecycleItem) GetOwner() string {
+	if m != nil {
+		return m.Owner
+	}
+	return ""
+}
+
+func (m *RecycleItem) GetDeletionTime() int32 {
+	if m != nil {
+		return m.DeletionTime
+	}
+	return 0
+}
+
+type RecycleCollection struct {
+	Items []*RecycleItem `protobuf:"bytes,1,rep,name=Items" json:"Items,omitempty"`
+}
+
+func (m *RecycleCollection) Reset()         { *m = RecycleCollection{} }
+func (m *RecycleCollection) String() string { return proto.CompactTextString(m) }
+func (*RecycleCollection) ProtoMessage()    {}
+
+func (m *RecycleCollection) GetItems() []*RecycleItem {
+	if m != nil {
+		return m.Items
+	}
+	return nil
+}
+
+type PurgeRecycleRequest struct {
+	// Path of the workspace or cell whose recycle bin is emptied
+	Path string `protobuf:"bytes,1,opt,name=Path" json:"Path,omitempty"`
+	// Purge only these nodes, that must be inside a recycle bin
+	Nodes []*tree.Node `protobuf:"bytes,2,rep,name=Nodes" json:"Nodes,omitempty"`
+}
+
+func (m *PurgeRecycleRequest) Reset()         { *m = PurgeRecycleRequest{} }
+func (m *PurgeRecycleRequest) String() string { return proto.CompactTextString(m) }
+func (*PurgeRecycleRequest) ProtoMessage()    {}
+
+func (m *PurgeRecycleRequest) GetPath() string {
+	if m != nil {
+		return m.Path
+	}
+	return ""
+}
+
+func (m *PurgeRecycleRequest) GetNodes() []*tree.Node {
+	if m != nil {
+		return m.Nodes
+	}
+	return nil
+}
+
+type PurgeRecycleResponse struct {
+	PurgeJobs []*BackgroundJobResult `protobuf:"bytes,1,rep,name=PurgeJobs" json:"PurgeJobs,omitempty"`
+}
+
+func (m *PurgeRecycleResponse) Reset()         { *m = PurgeRecycleResponse{} }
+func (m *PurgeRecycleResponse) String() string { return proto.CompactTextString(m) }
+func (*PurgeRecycleResponse) ProtoMessage()    {}
+
+func (m *PurgeRecycleResponse) GetPurgeJobs() []*BackgroundJobResult {
+	if m != nil {
+		return m.PurgeJobs
+	}
+	return nil
+}
+
+type QuotaUsageRequest struct {
+	// Subjects to report, defaults to the current user and its groups
+	Subjects []*quota.Subject `protobuf:"bytes,1,rep,name=Subjects" json:"Subjects,omitempty"`
+}
+
+func (m *QuotaUsageRequest) Reset()         { *m = QuotaUsageRequest{} }
+func (m *QuotaUsageRequest) String() string { return proto.CompactTextString(m) }
+func (*QuotaUsageRequest) ProtoMessage()    {}
+
+func (m *QuotaUsageRequest) GetSubjects() []*quota.Subject {
+	if m != nil {
+		return m.Subjects
+	}
+	return nil
+}
+
+type QuotaUsageCollection struct {
+	Usages []*quota.Usage `protobuf:"bytes,1,rep,name=Usages" json:"Usages,omitempty"`
+}
+
+func (m *QuotaUsageCollection) Reset()         { *m = QuotaUsageCollection{} }
+func (m *QuotaUsageCollection) String() string { return proto.CompactTextString(m) }
+func (*QuotaUsageCollection) ProtoMessage()    {}
+
+func (m *QuotaUsageCollection) GetUsages() []*quota.Usage {
+	if m != nil {
+		return m.Usages
+	}
+	return nil
+}
+
 type ListDocstoreRequest struct {
 	StoreID   string                  `protobuf:"bytes,1,opt,name=StoreID" json:"StoreID,omitempty"`
 	Query     *docstore.DocumentQuery `protobuf:"bytes,2,opt,name=Query" json:"Query,omitempty"`
@@ -641,6 +791,13 @@ func init() {
 	proto.RegisterType((*DeleteNodesResponse)(nil), "rest.DeleteNodesResponse")
 	proto.RegisterType((*RestoreNodesRequest)(nil), "rest.RestoreNodesRequest")
 	proto.RegisterType((*RestoreNodesResponse)(nil), "rest.RestoreNodesResponse")
+	proto.RegisterType((*ListRecycleRequest)(nil), "rest.ListRecycleRequest")
+	proto.RegisterType((*RecycleItem)(nil), "rest.RecycleItem")
+	proto.RegisterType((*RecycleCollection)(nil), "rest.RecycleCollection")
+	proto.RegisterType((*PurgeRecycleRequest)(nil), "rest.PurgeRecycleRequest")
+	proto.RegisterType((*PurgeRecycleResponse)(nil), "rest.PurgeRecycleResponse")
+	proto.RegisterType((*QuotaUsageRequest)(nil), "rest.QuotaUsageRequest")
+	proto.RegisterType((*QuotaUsageCollection)(nil), "rest.QuotaUsageCollection")
 	proto.RegisterType((*ListDocstoreRequest)(nil), "rest.ListDocstoreRequest")
 	proto.RegisterType((*DocstoreCollection)(nil), "rest.DocstoreCollection")
 	proto.RegisterType((*ChangeRequest)(nil), "rest.ChangeRequest")
@@ -380,7 +380,7 @@ func (m *FrontEnrollAuthResponse) GetInfo() map[string]string {
 
 // Donwload binary
 type FrontBinaryRequest struct {
-	// Currently supported values are USER and GLOBAL
+	// Currently supported values are USER, GLOBAL and THUMB
 	BinaryType string `protobuf:"bytes,1,opt,name=BinaryType" json:"BinaryType,omitempty"`
 	// Id of the binary
 	Uuid string `protobuf:"bytes,2,opt,name=Uuid" json:"Uuid,omitempty"`
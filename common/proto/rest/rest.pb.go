@@ -17,6 +17,8 @@ import _ "github.com/pmker/yux/common/proto/object"
 import _ "github.com/pmker/yux/common/proto/install"
 import _ "github.com/pmker/yux/common/proto/ctl"
 import _ "github.com/pmker/yux/common/proto/update"
+import _ "github.com/pmker/yux/common/proto/quota"
+import _ "github.com/pmker/yux/common/proto/auth"
 import _ "google.golang.org/genproto/googleapis/api/annotations"
 import _ "github.com/grpc-ecosystem/grpc-gateway/protoc-gen-swagger/options"
 
@@ -236,6 +236,7 @@ type ShareLink struct {
 	Permissions             []ShareLinkAccessType           `protobuf:"varint,17,rep,packed,name=Permissions,enum=rest.ShareLinkAccessType" json:"Permissions,omitempty"`
 	Policies                []*service.ResourcePolicy       `protobuf:"bytes,18,rep,name=Policies" json:"Policies,omitempty"`
 	PoliciesContextEditable bool                            `protobuf:"varint,19,opt,name=PoliciesContextEditable" json:"PoliciesContextEditable,omitempty"`
+	FileDrop                *ShareLinkFileDrop              `protobuf:"bytes,20,opt,name=FileDrop" json:"FileDrop,omitempty"`
 }
 
 func (m *ShareLink) Reset()                    { *m = ShareLink{} }
@@ -376,6 +377,45 @@ func (m *ShareLink) GetPoliciesContextEditable() bool {
 	return false
 }
 
+func (m *ShareLink) GetFileDrop() *ShareLinkFileDrop {
+	if m != nil {
+		return m.FileDrop
+	}
+	return nil
+}
+
+// Options of a file drop link, where visitors can only upload files
+type ShareLinkFileDrop struct {
+	Enabled           bool     `protobuf:"varint,1,opt,name=Enabled" json:"Enabled,omitempty"`
+	MaxFileSize       int64    `protobuf:"varint,2,opt,name=MaxFileSize" json:"MaxFileSize,omitempty"`
+	AllowedExtensions []string `protobuf:"bytes,3,rep,name=AllowedExtensions" json:"AllowedExtensions,omitempty"`
+}
+
+func (m *ShareLinkFileDrop) Reset()         { *m = ShareLinkFileDrop{} }
+func (m *ShareLinkFileDrop) String() string { return proto.CompactTextString(m) }
+func (*ShareLinkFileDrop) ProtoMessage()    {}
+
+func (m *ShareLinkFileDrop) GetEnabled() bool {
+	if m != nil {
+		return m.Enabled
+	}
+	return false
+}
+
+func (m *ShareLinkFileDrop) GetMaxFileSize() int64 {
+	if m != nil {
+		return m.MaxFileSize
+	}
+	return 0
+}
+
+func (m *ShareLinkFileDrop) GetAllowedExtensions() []string {
+	if m != nil {
+		return m.AllowedExtensions
+	}
+	return nil
+}
+
 type PutCellRequest struct {
 	Room            *Cell `protobuf:"bytes,1,opt,name=Room" json:"Room,omitempty"`
 	CreateEmptyRoot bool  `protobuf:"varint,2,opt,name=CreateEmptyRoot" json:"CreateEmptyRoot,omitempty"`
@@ -683,6 +723,7 @@ func init() {
 	proto.RegisterType((*Cell)(nil), "rest.Cell")
 	proto.RegisterType((*ShareLinkTargetUser)(nil), "rest.ShareLinkTargetUser")
 	proto.RegisterType((*ShareLink)(nil), "rest.ShareLink")
+	proto.RegisterType((*ShareLinkFileDrop)(nil), "rest.ShareLinkFileDrop")
 	proto.RegisterType((*PutCellRequest)(nil), "rest.PutCellRequest")
 	proto.RegisterType((*GetCellRequest)(nil), "rest.GetCellRequest")
 	proto.RegisterType((*DeleteCellRequest)(nil), "rest.DeleteCellRequest")
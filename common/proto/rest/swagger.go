@@ -259,6 +259,81 @@ var SwaggerJson = `{
         ]
       }
     },
+    "/auth/token/personal": {
+      "get": {
+        "summary": "List personal access tokens of the current user, or of any user for admins",
+        "operationId": "ListPersonalAccessTokens",
+        "responses": {
+          "200": {
+            "description": "",
+            "schema": {
+              "$ref": "#/definitions/authPatListResponse"
+            }
+          }
+        },
+        "parameters": [
+          {
+            "name": "UserLogin",
+            "in": "query",
+            "required": false,
+            "type": "string"
+          }
+        ],
+        "tags": [
+          "TokenService"
+        ]
+      },
+      "post": {
+        "summary": "Generate a personal access token, to be used instead of a password by scripts and integrations",
+        "operationId": "GeneratePersonalAccessToken",
+        "responses": {
+          "200": {
+            "description": "",
+            "schema": {
+              "$ref": "#/definitions/authPatGenerateResponse"
+            }
+          }
+        },
+        "parameters": [
+          {
+            "name": "body",
+            "in": "body",
+            "required": true,
+            "schema": {
+              "$ref": "#/definitions/authPatGenerateRequest"
+            }
+          }
+        ],
+        "tags": [
+          "TokenService"
+        ]
+      }
+    },
+    "/auth/token/personal/{Uuid}": {
+      "delete": {
+        "summary": "Revoke a personal access token",
+        "operationId": "RevokePersonalAccessToken",
+        "responses": {
+          "200": {
+            "description": "",
+            "schema": {
+              "$ref": "#/definitions/authPatRevokeResponse"
+            }
+          }
+        },
+        "parameters": [
+          {
+            "name": "Uuid",
+            "in": "path",
+            "required": true,
+            "type": "string"
+          }
+        ],
+        "tags": [
+          "TokenService"
+        ]
+      }
+    },
     "/auth/token/revoke": {
       "post": {
         "summary": "Revoke a JWT token",
@@ -1029,7 +1104,7 @@ var SwaggerJson = `{
     },
     "/frontend/binaries/{BinaryType}/{Uuid}": {
       "get": {
-        "summary": "Serve frontend binaries directly (avatars / logos / bg images)",
+        "summary": "Serve frontend binaries directly (avatars / logos / bg images / images previews)",
         "operationId": "FrontServeBinary",
         "responses": {
           "200": {
@@ -1705,6 +1780,150 @@ var SwaggerJson = `{
         ]
       }
     },
+    "/policy/explain": {
+      "post": {
+        "summary": "Explain how security policies apply to a request, optionally evaluating unsaved policy groups",
+        "operationId": "ExplainPolicies",
+        "responses": {
+          "200": {
+            "description": "",
+            "schema": {
+              "$ref": "#/definitions/idmPolicyExplainResponse"
+            }
+          }
+        },
+        "parameters": [
+          {
+            "name": "body",
+            "in": "body",
+            "required": true,
+            "schema": {
+              "$ref": "#/definitions/idmPolicyExplainRequest"
+            }
+          }
+        ],
+        "tags": [
+          "PolicyService"
+        ]
+      }
+    },
+    "/quota": {
+      "put": {
+        "summary": "Create or update the quota of a subject",
+        "operationId": "PutQuota",
+        "responses": {
+          "200": {
+            "description": "",
+            "schema": {
+              "$ref": "#/definitions/quotaQuota"
+            }
+          }
+        },
+        "parameters": [
+          {
+            "name": "body",
+            "in": "body",
+            "required": true,
+            "schema": {
+              "$ref": "#/definitions/quotaQuota"
+            }
+          }
+        ],
+        "tags": [
+          "QuotaService"
+        ]
+      }
+    },
+    "/quota/list": {
+      "post": {
+        "summary": "List usage and limits of all subjects of a given type",
+        "operationId": "ListQuotaUsage",
+        "responses": {
+          "200": {
+            "description": "",
+            "schema": {
+              "$ref": "#/definitions/restQuotaUsageCollection"
+            }
+          }
+        },
+        "parameters": [
+          {
+            "name": "body",
+            "in": "body",
+            "required": true,
+            "schema": {
+              "$ref": "#/definitions/quotaListUsageRequest"
+            }
+          }
+        ],
+        "tags": [
+          "QuotaService"
+        ]
+      }
+    },
+    "/quota/usage": {
+      "post": {
+        "summary": "Report usage and limits of the current user and its groups, or of the given subjects",
+        "operationId": "QuotaUsage",
+        "responses": {
+          "200": {
+            "description": "",
+            "schema": {
+              "$ref": "#/definitions/restQuotaUsageCollection"
+            }
+          }
+        },
+        "parameters": [
+          {
+            "name": "body",
+            "in": "body",
+            "required": true,
+            "schema": {
+              "$ref": "#/definitions/restQuotaUsageRequest"
+            }
+          }
+        ],
+        "tags": [
+          "QuotaService"
+        ]
+      }
+    },
+    "/quota/{Type}/{Id}": {
+      "delete": {
+        "summary": "Remove the quota of a subject, its usage is kept",
+        "operationId": "DeleteQuota",
+        "responses": {
+          "200": {
+            "description": "",
+            "schema": {
+              "$ref": "#/definitions/restDeleteResponse"
+            }
+          }
+        },
+        "parameters": [
+          {
+            "name": "Type",
+            "in": "path",
+            "required": true,
+            "type": "string",
+            "enum": [
+              "USER",
+              "GROUP",
+              "DATASOURCE"
+            ]
+          },
+          {
+            "name": "Id",
+            "in": "path",
+            "required": true,
+            "type": "string"
+          }
+        ],
+        "tags": [
+          "QuotaService"
+        ]
+      }
+    },
     "/role": {
       "post": {
         "summary": "Search Roles",
@@ -2190,6 +2409,60 @@ var SwaggerJson = `{
         ]
       }
     },
+    "/tree/recycle": {
+      "post": {
+        "summary": "List the content of a recycle bin with the original location of each item",
+        "operationId": "ListRecycle",
+        "responses": {
+          "200": {
+            "description": "",
+            "schema": {
+              "$ref": "#/definitions/restRecycleCollection"
+            }
+          }
+        },
+        "parameters": [
+          {
+            "name": "body",
+            "in": "body",
+            "required": true,
+            "schema": {
+              "$ref": "#/definitions/restListRecycleRequest"
+            }
+          }
+        ],
+        "tags": [
+          "TreeService"
+        ]
+      }
+    },
+    "/tree/recycle/purge": {
+      "post": {
+        "summary": "Definitively remove nodes from a recycle bin",
+        "operationId": "PurgeRecycle",
+        "responses": {
+          "200": {
+            "description": "",
+            "schema": {
+              "$ref": "#/definitions/restPurgeRecycleResponse"
+            }
+          }
+        },
+        "parameters": [
+          {
+            "name": "body",
+            "in": "body",
+            "required": true,
+            "schema": {
+              "$ref": "#/definitions/restPurgeRecycleRequest"
+            }
+          }
+        ],
+        "tags": [
+          "TreeService"
+        ]
+      }
+    },
     "/tree/restore": {
       "post": {
         "summary": "Handle nodes restoration from recycle bin",
@@ -3329,6 +3602,116 @@ var SwaggerJson = `{
       ],
       "default": "GENERIC"
     },
+    "authPatGenerateRequest": {
+      "type": "object",
+      "properties": {
+        "Label": {
+          "type": "string"
+        },
+        "UserLogin": {
+          "type": "string"
+        },
+        "UserUuid": {
+          "type": "string"
+        },
+        "ExpiresAt": {
+          "type": "string",
+          "format": "int64"
+        },
+        "ReadOnly": {
+          "type": "boolean"
+        },
+        "Workspaces": {
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        },
+        "Resources": {
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        }
+      }
+    },
+    "authPatGenerateResponse": {
+      "type": "object",
+      "properties": {
+        "AccessToken": {
+          "type": "string"
+        },
+        "Token": {
+          "$ref": "#/definitions/authPersonalAccessToken"
+        }
+      }
+    },
+    "authPatListResponse": {
+      "type": "object",
+      "properties": {
+        "Tokens": {
+          "type": "array",
+          "items": {
+            "$ref": "#/definitions/authPersonalAccessToken"
+          }
+        }
+      }
+    },
+    "authPatRevokeResponse": {
+      "type": "object",
+      "properties": {
+        "Success": {
+          "type": "boolean"
+        }
+      }
+    },
+    "authPersonalAccessToken": {
+      "type": "object",
+      "properties": {
+        "Uuid": {
+          "type": "string"
+        },
+        "Label": {
+          "type": "string"
+        },
+        "UserUuid": {
+          "type": "string"
+        },
+        "UserLogin": {
+          "type": "string"
+        },
+        "CreatedBy": {
+          "type": "string"
+        },
+        "CreatedAt": {
+          "type": "string",
+          "format": "int64"
+        },
+        "ExpiresAt": {
+          "type": "string",
+          "format": "int64"
+        },
+        "LastUsedAt": {
+          "type": "string",
+          "format": "int64"
+        },
+        "ReadOnly": {
+          "type": "boolean"
+        },
+        "Workspaces": {
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        },
+        "Resources": {
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        }
+      }
+    },
     "ctlPeer": {
       "type": "object",
       "properties": {
@@ -3698,6 +4081,24 @@ var SwaggerJson = `{
         }
       }
     },
+    "idmPolicyConditionExplanation": {
+      "type": "object",
+      "properties": {
+        "Key": {
+          "type": "string"
+        },
+        "Type": {
+          "type": "string"
+        },
+        "Value": {
+          "type": "string",
+          "title": "Value found in the request context for this key"
+        },
+        "Fulfilled": {
+          "type": "boolean"
+        }
+      }
+    },
     "idmPolicyEffect": {
       "type": "string",
       "enum": [
@@ -3707,6 +4108,124 @@ var SwaggerJson = `{
       ],
       "default": "unknown"
     },
+    "idmPolicyEngineResponse": {
+      "type": "object",
+      "properties": {
+        "Allowed": {
+          "type": "boolean"
+        },
+        "ExplicitDeny": {
+          "type": "boolean"
+        },
+        "DefaultDeny": {
+          "type": "boolean"
+        }
+      }
+    },
+    "idmPolicyExplainRequest": {
+      "type": "object",
+      "properties": {
+        "Resource": {
+          "type": "string"
+        },
+        "Action": {
+          "type": "string"
+        },
+        "Subjects": {
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        },
+        "Context": {
+          "type": "object",
+          "additionalProperties": {
+            "type": "string"
+          }
+        },
+        "Login": {
+          "type": "string",
+          "title": "Login of a user whose own, profile and roles subjects are added to Subjects"
+        },
+        "DryRunGroups": {
+          "type": "array",
+          "items": {
+            "$ref": "#/definitions/idmPolicyGroup"
+          },
+          "title": "Unsaved policy groups, evaluated in place of the stored groups with the same Uuid"
+        }
+      },
+      "title": "Explain the decision of the policy engine for a request"
+    },
+    "idmPolicyExplainResponse": {
+      "type": "object",
+      "properties": {
+        "Decision": {
+          "$ref": "#/definitions/idmPolicyEngineResponse"
+        },
+        "Subjects": {
+          "type": "array",
+          "items": {
+            "type": "string"
+          },
+          "title": "Subjects that were evaluated"
+        },
+        "Explanations": {
+          "type": "array",
+          "items": {
+            "$ref": "#/definitions/idmPolicyExplanation"
+          }
+        },
+        "DecidingPolicy": {
+          "$ref": "#/definitions/idmPolicyExplanation",
+          "title": "Policy that decided the outcome, empty when denied by default"
+        }
+      }
+    },
+    "idmPolicyExplanation": {
+      "type": "object",
+      "properties": {
+        "GroupUuid": {
+          "type": "string"
+        },
+        "GroupName": {
+          "type": "string"
+        },
+        "Policy": {
+          "$ref": "#/definitions/idmPolicy"
+        },
+        "Subject": {
+          "type": "string"
+        },
+        "SubjectMatch": {
+          "type": "boolean"
+        },
+        "ResourceMatch": {
+          "type": "boolean"
+        },
+        "ActionMatch": {
+          "type": "boolean"
+        },
+        "Conditions": {
+          "type": "array",
+          "items": {
+            "$ref": "#/definitions/idmPolicyConditionExplanation"
+          }
+        },
+        "Applies": {
+          "type": "boolean",
+          "title": "Subject, resource, action and conditions all match: the policy effect applies"
+        },
+        "DryRun": {
+          "type": "boolean",
+          "title": "Policy comes from a dry-run group"
+        },
+        "Error": {
+          "type": "string",
+          "title": "Error raised while matching the policy patterns"
+        }
+      }
+    },
     "idmPolicyGroup": {
       "type": "object",
       "properties": {
@@ -5071,6 +5590,79 @@ var SwaggerJson = `{
       },
       "description": "Any contains an arbitrary serialized protocol buffer message along with a\nURL that describes the type of the serialized message.\n\nProtobuf library provides support to pack/unpack Any values in the form\nof utility functions or additional generated methods of the Any type.\n\nExample 1: Pack and unpack a message in C++.\n\n    Foo foo = ...;\n    Any any;\n    any.PackFrom(foo);\n    ...\n    if (any.UnpackTo(\u0026foo)) {\n      ...\n    }\n\nExample 2: Pack and unpack a message in Java.\n\n    Foo foo = ...;\n    Any any = Any.pack(foo);\n    ...\n    if (any.is(Foo.class)) {\n      foo = any.unpack(Foo.class);\n    }\n\n Example 3: Pack and unpack a message in Python.\n\n    foo = Foo(...)\n    any = Any()\n    any.Pack(foo)\n    ...\n    if any.Is(Foo.DESCRIPTOR):\n      any.Unpack(foo)\n      ...\n\n Example 4: Pack and unpack a message in Go\n\n     foo := \u0026pb.Foo{...}\n     any, err := ptypes.MarshalAny(foo)\n     ...\n     foo := \u0026pb.Foo{}\n     if err := ptypes.UnmarshalAny(any, foo); err != nil {\n       ...\n     }\n\nThe pack methods provided by protobuf library will by default use\n'type.googleapis.com/full.type.name' as the type URL and the unpack\nmethods only use the fully qualified type name after the last '/'\nin the type URL, for example \"foo.bar.com/x/y.z\" will yield type\nname \"y.z\".\n\n\nJSON\n====\nThe JSON representation of an Any value uses the regular\nrepresentation of the deserialized, embedded message, with an\nadditional field @type which contains the type URL. Example:\n\n    package google.profile;\n    message Person {\n      string first_name = 1;\n      string last_name = 2;\n    }\n\n    {\n      \"@type\": \"type.googleapis.com/google.profile.Person\",\n      \"firstName\": \u003cstring\u003e,\n      \"lastName\": \u003cstring\u003e\n    }\n\nIf the embedded message type is well-known and has a custom JSON\nrepresentation, that representation will be embedded adding a field\nvalue which holds the custom JSON in addition to the @type\nfield. Example (for message [google.protobuf.Duration][]):\n\n    {\n      \"@type\": \"type.googleapis.com/google.protobuf.Duration\",\n      \"value\": \"1.212s\"\n    }"
     },
+    "quotaListUsageRequest": {
+      "type": "object",
+      "properties": {
+        "Type": {
+          "$ref": "#/definitions/quotaSubjectType"
+        },
+        "OnlyLimited": {
+          "type": "boolean",
+          "format": "boolean",
+          "title": "Only list subjects having a quota set"
+        }
+      }
+    },
+    "quotaQuota": {
+      "type": "object",
+      "properties": {
+        "Subject": {
+          "$ref": "#/definitions/quotaSubject"
+        },
+        "HardLimit": {
+          "type": "string",
+          "format": "int64"
+        },
+        "SoftLimit": {
+          "type": "string",
+          "format": "int64"
+        }
+      },
+      "title": "Quota limits the number of bytes charged to a subject. Zero means no limit."
+    },
+    "quotaSubject": {
+      "type": "object",
+      "properties": {
+        "Type": {
+          "$ref": "#/definitions/quotaSubjectType"
+        },
+        "Id": {
+          "type": "string"
+        }
+      },
+      "title": "Subject identifies a user by its login, a group by its path or a datasource by its name"
+    },
+    "quotaSubjectType": {
+      "type": "string",
+      "enum": [
+        "USER",
+        "GROUP",
+        "DATASOURCE"
+      ],
+      "default": "USER",
+      "title": "SubjectType lists the kinds of subjects usage is charged to"
+    },
+    "quotaUsage": {
+      "type": "object",
+      "properties": {
+        "Subject": {
+          "$ref": "#/definitions/quotaSubject"
+        },
+        "Bytes": {
+          "type": "string",
+          "format": "int64"
+        },
+        "HardLimit": {
+          "type": "string",
+          "format": "int64"
+        },
+        "SoftLimit": {
+          "type": "string",
+          "format": "int64"
+        }
+      },
+      "title": "Usage reports the bytes currently charged to a subject, along with its limits"
+    },
     "restACLCollection": {
       "type": "object",
       "properties": {
@@ -5443,7 +6035,7 @@ var SwaggerJson = `{
       "properties": {
         "BinaryType": {
           "type": "string",
-          "title": "Currently supported values are USER and GLOBAL"
+          "title": "Currently supported values are USER, GLOBAL and THUMB"
         },
         "Uuid": {
           "type": "string",
@@ -5618,6 +6210,14 @@ var SwaggerJson = `{
         }
       }
     },
+    "restListRecycleRequest": {
+      "type": "object",
+      "properties": {
+        "Path": {
+          "type": "string"
+        }
+      }
+    },
     "restListSharedResourcesRequest": {
       "type": "object",
       "properties": {
@@ -5800,6 +6400,31 @@ var SwaggerJson = `{
       },
       "title": "Generic container for responses sending pagination information"
     },
+    "restPurgeRecycleRequest": {
+      "type": "object",
+      "properties": {
+        "Path": {
+          "type": "string"
+        },
+        "Nodes": {
+          "type": "array",
+          "items": {
+            "$ref": "#/definitions/treeNode"
+          }
+        }
+      }
+    },
+    "restPurgeRecycleResponse": {
+      "type": "object",
+      "properties": {
+        "PurgeJobs": {
+          "type": "array",
+          "items": {
+            "$ref": "#/definitions/restBackgroundJobResult"
+          }
+        }
+      }
+    },
     "restPutCellRequest": {
       "type": "object",
       "properties": {
@@ -5853,6 +6478,58 @@ var SwaggerJson = `{
         }
       }
     },
+    "restQuotaUsageCollection": {
+      "type": "object",
+      "properties": {
+        "Usages": {
+          "type": "array",
+          "items": {
+            "$ref": "#/definitions/quotaUsage"
+          }
+        }
+      }
+    },
+    "restQuotaUsageRequest": {
+      "type": "object",
+      "properties": {
+        "Subjects": {
+          "type": "array",
+          "items": {
+            "$ref": "#/definitions/quotaSubject"
+          },
+          "title": "Subjects to report, defaults to the current user and its groups"
+        }
+      }
+    },
+    "restRecycleCollection": {
+      "type": "object",
+      "properties": {
+        "Items": {
+          "type": "array",
+          "items": {
+            "$ref": "#/definitions/restRecycleItem"
+          }
+        }
+      }
+    },
+    "restRecycleItem": {
+      "type": "object",
+      "properties": {
+        "Node": {
+          "$ref": "#/definitions/treeNode"
+        },
+        "OriginalPath": {
+          "type": "string"
+        },
+        "Owner": {
+          "type": "string"
+        },
+        "DeletionTime": {
+          "type": "integer",
+          "format": "int32"
+        }
+      }
+    },
     "restRelationResponse": {
       "type": "object",
       "properties": {
@@ -6019,6 +6696,12 @@ var SwaggerJson = `{
         "Total": {
           "type": "integer",
           "format": "int32"
+        },
+        "Facets": {
+          "type": "array",
+          "items": {
+            "$ref": "#/definitions/treeSearchFacet"
+          }
         }
       }
     },
@@ -6298,6 +6981,9 @@ var SwaggerJson = `{
         "PoliciesContextEditable": {
           "type": "boolean",
           "format": "boolean"
+        },
+        "FileDrop": {
+          "$ref": "#/definitions/restShareLinkFileDrop"
         }
       },
       "title": "Model for representing a public link"
@@ -6313,6 +6999,26 @@ var SwaggerJson = `{
       "default": "NoAccess",
       "title": "Known values for link permissions"
     },
+    "restShareLinkFileDrop": {
+      "type": "object",
+      "properties": {
+        "Enabled": {
+          "type": "boolean",
+          "format": "boolean"
+        },
+        "MaxFileSize": {
+          "type": "string",
+          "format": "int64"
+        },
+        "AllowedExtensions": {
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        }
+      },
+      "title": "Options of a file drop link, where visitors can only upload files"
+    },
     "restShareLinkTargetUser": {
       "type": "object",
       "properties": {
@@ -6900,7 +7606,47 @@ var SwaggerJson = `{
         },
         "Facet": {
           "type": "string",
-          "title": "Facet search"
+          "title": "Facet search: comma-separated list of facets to compute (Extension, NodeType, Size, ModifTime or any indexed metadata key)"
+        },
+        "SortField": {
+          "type": "string",
+          "title": "Sort results by relevance (default), mtime, size or name"
+        },
+        "SortDirDesc": {
+          "type": "boolean",
+          "format": "boolean",
+          "title": "Sort in descending order"
+        }
+      }
+    },
+    "treeSearchFacet": {
+      "type": "object",
+      "properties": {
+        "FieldName": {
+          "type": "string",
+          "title": "Name of the faceted field"
+        },
+        "Label": {
+          "type": "string",
+          "title": "Term value or range label"
+        },
+        "Count": {
+          "type": "integer",
+          "format": "int32",
+          "title": "Number of matching nodes"
+        },
+        "Term": {
+          "type": "string",
+          "title": "Term value, for term facets"
+        },
+        "Min": {
+          "type": "string",
+          "format": "int64",
+          "title": "Range bounds, for size (bytes) and date (unix timestamp) facets"
+        },
+        "Max": {
+          "type": "string",
+          "format": "int64"
         }
       }
     },
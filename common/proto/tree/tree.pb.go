@@ -30,6 +30,7 @@ It has these top-level messages:
 	WatchNodeResponse
 	SearchRequest
 	SearchResponse
+	SearchFacet
 	CreateVersionRequest
 	CreateVersionResponse
 	ListVersionsRequest
@@ -705,8 +706,12 @@ type SearchRequest struct {
 	From int32 `protobuf:"varint,3,opt,name=From" json:"From,omitempty"`
 	// Load node details
 	Details bool `protobuf:"varint,4,opt,name=Details" json:"Details,omitempty"`
-	// Facet search
+	// Facet search: comma-separated list of facets to compute (Extension, NodeType, Size, ModifTime or any indexed metadata key)
 	Facet string `protobuf:"bytes,5,opt,name=Facet" json:"Facet,omitempty"`
+	// Sort results by relevance (default), mtime, size or name
+	SortField string `protobuf:"bytes,6,opt,name=SortField" json:"SortField,omitempty"`
+	// Sort in descending order
+	SortDirDesc bool `protobuf:"varint,7,opt,name=SortDirDesc" json:"SortDirDesc,omitempty"`
 }
 
 func (m *SearchRequest) Reset()                    { *m = SearchRequest{} }
@@ -749,8 +754,24 @@ func (m *SearchRequest) GetFacet() string {
 	return ""
 }
 
+func (m *SearchRequest) GetSortField() string {
+	if m != nil {
+		return m.SortField
+	}
+	return ""
+}
+
+func (m *SearchRequest) GetSortDirDesc() bool {
+	if m != nil {
+		return m.SortDirDesc
+	}
+	return false
+}
+
 type SearchResponse struct {
 	Node *Node `protobuf:"bytes,1,opt,name=Node" json:"Node,omitempty"`
+	// Facets are sent along with the last response
+	Facets []*SearchFacet `protobuf:"bytes,2,rep,name=Facets" json:"Facets,omitempty"`
 }
 
 func (m *SearchResponse) Reset()                    { *m = SearchResponse{} }
@@ -765,6 +786,73 @@ func (m *SearchResponse) GetNode() *Node {
 	return nil
 }
 
+func (m *SearchResponse) GetFacets() []*SearchFacet {
+	if m != nil {
+		return m.Facets
+	}
+	return nil
+}
+
+type SearchFacet struct {
+	// Name of the faceted field
+	FieldName string `protobuf:"bytes,1,opt,name=FieldName" json:"FieldName,omitempty"`
+	// Term value or range label
+	Label string `protobuf:"bytes,2,opt,name=Label" json:"Label,omitempty"`
+	// Number of matching nodes
+	Count int32 `protobuf:"varint,3,opt,name=Count" json:"Count,omitempty"`
+	// Term value, for term facets
+	Term string `protobuf:"bytes,4,opt,name=Term" json:"Term,omitempty"`
+	// Range bounds, for size (bytes) and date (unix timestamp) facets
+	Min int64 `protobuf:"varint,5,opt,name=Min" json:"Min,omitempty"`
+	Max int64 `protobuf:"varint,6,opt,name=Max" json:"Max,omitempty"`
+}
+
+func (m *SearchFacet) Reset()         { *m = SearchFacet{} }
+func (m *SearchFacet) String() string { return proto.CompactTextString(m) }
+func (*SearchFacet) ProtoMessage()    {}
+
+func (m *SearchFacet) GetFieldName() string {
+	if m != nil {
+		return m.FieldName
+	}
+	return ""
+}
+
+func (m *SearchFacet) GetLabel() string {
+	if m != nil {
+		return m.Label
+	}
+	return ""
+}
+
+func (m *SearchFacet) GetCount() int32 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+func (m *SearchFacet) GetTerm() string {
+	if m != nil {
+		return m.Term
+	}
+	return ""
+}
+
+func (m *SearchFacet) GetMin() int64 {
+	if m != nil {
+		return m.Min
+	}
+	return 0
+}
+
+func (m *SearchFacet) GetMax() int64 {
+	if m != nil {
+		return m.Max
+	}
+	return 0
+}
+
 type CreateVersionRequest struct {
 	Node         *Node            `protobuf:"bytes,1,opt,name=Node" json:"Node,omitempty"`
 	TriggerEvent *NodeChangeEvent `protobuf:"bytes,2,opt,name=TriggerEvent" json:"TriggerEvent,omitempty"`
@@ -1734,6 +1822,7 @@ func init() {
 	proto.RegisterType((*WatchNodeResponse)(nil), "tree.WatchNodeResponse")
 	proto.RegisterType((*SearchRequest)(nil), "tree.SearchRequest")
 	proto.RegisterType((*SearchResponse)(nil), "tree.SearchResponse")
+	proto.RegisterType((*SearchFacet)(nil), "tree.SearchFacet")
 	proto.RegisterType((*CreateVersionRequest)(nil), "tree.CreateVersionRequest")
 	proto.RegisterType((*CreateVersionResponse)(nil), "tree.CreateVersionResponse")
 	proto.RegisterType((*ListVersionsRequest)(nil), "tree.ListVersionsRequest")
@@ -57,7 +57,7 @@ func HttpRequestInfoToMetadata(ctx context.Context, req *http.Request) context.C
 	meta[HttpMetaExtracted] = HttpMetaExtracted
 
 	if req.RemoteAddr != "" {
-		meta[HttpMetaRemoteAddress] = req.RemoteAddr
+		meta[HttpMetaRemoteAddress] = RemoteAddress(req, TrustedProxies(), FrontProxies())
 	}
 
 	// TODO add client time and locale via JS on the client side and retrieve it here
@@ -66,14 +66,6 @@ func HttpRequestInfoToMetadata(ctx context.Context, req *http.Request) context.C
 	meta[ServerTime] = t.Format(layout)
 	meta[ClientTime] = t.Format(layout)
 
-	if h, ok := req.Header["X-Forwarded-For"]; ok {
-		forwarded := strings.Join(h, "")
-		meta[HttpMetaRemoteAddress] = forwarded
-	}
-	// Override RemoteAddr if set by the php frontend
-	if h, ok := req.Header["X-Pydio-Front-Client"]; ok {
-		meta[HttpMetaRemoteAddress] = strings.Join(h, "")
-	}
 	if h, ok := req.Header["User-Agent"]; ok {
 		meta[HttpMetaUserAgent] = strings.Join(h, "")
 	}
@@ -86,6 +78,10 @@ func HttpRequestInfoToMetadata(ctx context.Context, req *http.Request) context.C
 	if h, ok := req.Header["X-Pydio-Session"]; ok && len(h) > 0 {
 		meta["X-Pydio-Session"] = h[0]
 	}
+	// One-time password sent along with a login when the user has a second factor
+	if h, ok := req.Header["X-Pydio-Otp"]; ok && len(h) > 0 {
+		meta["X-Pydio-Otp"] = h[0]
+	}
 	if req.RequestURI != "" {
 		meta[HttpMetaRequestURI] = req.RequestURI
 	}
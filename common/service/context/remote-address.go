@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package servicecontext
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pmker/yux/common/config"
+)
+
+var (
+	localNetworks     []*net.IPNet
+	localNetworksOnce sync.Once
+)
+
+// TrustedProxies lists the networks allowed to set forwarding headers: the addresses of this host, where the
+// gateway runs, and the ranges listed in the defaults/trustedProxies configuration, as CIDR blocks or single IPs.
+func TrustedProxies() []*net.IPNet {
+	localNetworksOnce.Do(func() {
+		localNetworks = ParseNetworks([]string{"127.0.0.0/8", "::1/128"})
+		if addrs, e := net.InterfaceAddrs(); e == nil {
+			for _, a := range addrs {
+				if ipNet, ok := a.(*net.IPNet); ok {
+					localNetworks = append(localNetworks, hostNetwork(ipNet.IP))
+				}
+			}
+		}
+	})
+	trusted := append([]*net.IPNet{}, localNetworks...)
+	return append(trusted, ParseNetworks(config.Get("defaults", "trustedProxies").StringSlice(nil))...)
+}
+
+// FrontProxies lists the networks allowed to set the X-Pydio-Front-Client header, read from the
+// defaults/frontProxies configuration. Unlike TrustedProxies, no network is trusted by default: the header is
+// not part of any standard and is passed through as is by generic proxies.
+func FrontProxies() []*net.IPNet {
+	return ParseNetworks(config.Get("defaults", "frontProxies").StringSlice(nil))
+}
+
+// ParseNetworks parses CIDR blocks or single addresses, invalid values are ignored.
+func ParseNetworks(values []string) (networks []*net.IPNet) {
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil {
+				networks = append(networks, hostNetwork(ip))
+			}
+			continue
+		}
+		if _, ipNet, e := net.ParseCIDR(v); e == nil {
+			networks = append(networks, ipNet)
+		}
+	}
+	return
+}
+
+// RemoteAddress finds the address of the client who sent the request. Forwarding headers are only considered
+// when the request comes from a trusted proxy: the X-Forwarded-For chain is then read from the right, and the
+// first hop that is not a trusted proxy is the client. Proxies append to the chain, so entries on its left can
+// be forged by the client itself. The X-Pydio-Front-Client header is only read from the fronts networks.
+func RemoteAddress(req *http.Request, trusted []*net.IPNet, fronts []*net.IPNet) string {
+
+	peer := hostOnly(req.RemoteAddr)
+	// Set by the php frontend, when explicitly declared
+	if isTrusted(net.ParseIP(peer), fronts) {
+		if front := strings.TrimSpace(req.Header.Get("X-Pydio-Front-Client")); front != "" {
+			return hostOnly(front)
+		}
+	}
+	if !isTrusted(net.ParseIP(peer), trusted) {
+		return peer
+	}
+
+	var hops []string
+	for _, h := range req.Header["X-Forwarded-For"] {
+		for _, hop := range strings.Split(h, ",") {
+			if hop = hostOnly(strings.TrimSpace(hop)); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i])
+		if ip == nil {
+			// Garbage in the chain: do not look further to the left
+			return peer
+		}
+		if !isTrusted(ip, trusted) {
+			return hops[i]
+		}
+	}
+	if len(hops) > 0 {
+		return hops[0]
+	}
+	return peer
+}
+
+func isTrusted(ip net.IP, trusted []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func hostNetwork(ip net.IP) *net.IPNet {
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+func hostOnly(addr string) string {
+	if host, _, e := net.SplitHostPort(addr); e == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
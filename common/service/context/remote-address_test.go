@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package servicecontext
+
+import (
+	"net/http"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRemoteAddress(t *testing.T) {
+
+	trusted := ParseNetworks([]string{"127.0.0.0/8", "10.0.0.0/8", "192.168.1.1", "invalid"})
+	newRequest := func(remote string, headers map[string]string) *http.Request {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.RemoteAddr = remote
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		return r
+	}
+
+	Convey("Test trusted networks parsing", t, func() {
+		So(trusted, ShouldHaveLength, 3)
+	})
+
+	Convey("Test forwarding headers are ignored from untrusted peers", t, func() {
+		r := newRequest("5.6.7.8:4356", map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Pydio-Front-Client": "1.2.3.4"})
+		So(RemoteAddress(r, trusted, nil), ShouldEqual, "5.6.7.8")
+	})
+
+	Convey("Test rightmost untrusted hop is used", t, func() {
+		r := newRequest("127.0.0.1:4356", map[string]string{"X-Forwarded-For": "1.2.3.4, 5.6.7.8, 10.0.0.3"})
+		So(RemoteAddress(r, trusted, nil), ShouldEqual, "5.6.7.8")
+
+		r = newRequest("[::1]:4356", map[string]string{"X-Forwarded-For": "1.2.3.4"})
+		So(RemoteAddress(r, ParseNetworks([]string{"::1"}), nil), ShouldEqual, "1.2.3.4")
+
+		r = newRequest("127.0.0.1:4356", map[string]string{"X-Forwarded-For": "10.0.0.4, 192.168.1.1"})
+		So(RemoteAddress(r, trusted, nil), ShouldEqual, "10.0.0.4")
+
+		r = newRequest("127.0.0.1:4356", map[string]string{"X-Forwarded-For": "1.2.3.4, garbage, 10.0.0.3"})
+		So(RemoteAddress(r, trusted, nil), ShouldEqual, "127.0.0.1")
+
+		r = newRequest("127.0.0.1:4356", nil)
+		So(RemoteAddress(r, trusted, nil), ShouldEqual, "127.0.0.1")
+	})
+
+	Convey("Test front client header is ignored from trusted proxies", t, func() {
+		// A loopback proxy forwarding a header sent by the client
+		r := newRequest("127.0.0.1:4356", map[string]string{"X-Forwarded-For": "5.6.7.8", "X-Pydio-Front-Client": "10.0.0.5"})
+		So(RemoteAddress(r, trusted, nil), ShouldEqual, "5.6.7.8")
+
+		r = newRequest("127.0.0.1:4356", map[string]string{"X-Pydio-Front-Client": "10.0.0.5"})
+		So(RemoteAddress(r, trusted, ParseNetworks([]string{"192.168.1.1"})), ShouldEqual, "127.0.0.1")
+	})
+
+	Convey("Test front client header from a declared front", t, func() {
+		fronts := ParseNetworks([]string{"192.168.1.1"})
+		r := newRequest("192.168.1.1:4356", map[string]string{"X-Forwarded-For": "5.6.7.8", "X-Pydio-Front-Client": "1.2.3.4"})
+		So(RemoteAddress(r, trusted, fronts), ShouldEqual, "1.2.3.4")
+
+		r = newRequest("192.168.1.1:4356", map[string]string{"X-Forwarded-For": "5.6.7.8"})
+		So(RemoteAddress(r, trusted, fronts), ShouldEqual, "5.6.7.8")
+	})
+
+}
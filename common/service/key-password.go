@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/auth/claim"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/proto/idm"
+	"github.com/pmker/yux/idm/key"
+)
+
+// verifiedKeyPasswords keeps a hash of recently verified login/password pairs to avoid binding on every request.
+var verifiedKeyPasswords = cache.New(time.Minute, 5*time.Minute)
+
+// KeyPasswordHttpWrapper reads the password unlocking the user key on datasources encrypted in USER_PWD mode.
+// The password is checked against the account of the authenticated user before being stored in the context:
+// keys are only ever sealed with the real user password. It must be placed after JWTHttpWrapper.
+func KeyPasswordHttpWrapper(h http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		pass := r.Header.Get(key.PasswordHeader)
+		if pass == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		// Never forward the clear password to the next handlers
+		r.Header.Del(key.PasswordHeader)
+
+		c := r.Context()
+		claims, ok := c.Value(claim.ContextKey).(claim.Claims)
+		if !ok || claims.Name == "" {
+			w.WriteHeader(401)
+			w.Write([]byte("Unauthorized.\n"))
+			return
+		}
+
+		sum := sha256.Sum256([]byte(claims.Name + ":" + pass))
+		cacheKey := hex.EncodeToString(sum[:])
+		if _, verified := verifiedKeyPasswords.Get(cacheKey); !verified {
+			cli := idm.NewUserServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_USER, defaults.NewClient())
+			if _, e := cli.BindUser(c, &idm.BindUserRequest{UserName: claims.Name, Password: pass}); e != nil {
+				log.Logger(c).Error("Refusing key password that does not match the user account", zap.String("login", claims.Name))
+				w.WriteHeader(401)
+				w.Write([]byte("Unauthorized.\n"))
+				return
+			}
+			verifiedKeyPasswords.Set(cacheKey, true, cache.DefaultExpiration)
+		}
+
+		r = r.WithContext(key.WithPassword(c, []byte(pass)))
+		h.ServeHTTP(w, r)
+	})
+}
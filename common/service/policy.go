@@ -23,20 +23,49 @@ package service
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
+	"github.com/ory/ladon/compiler"
 	"go.uber.org/zap"
 
-	"github.com/pmker/yux/common"
 	"github.com/pmker/yux/common/auth/claim"
 	"github.com/pmker/yux/common/log"
 	"github.com/pmker/yux/common/proto/idm"
-	"github.com/pmker/yux/common/micro"
 	"github.com/pmker/yux/common/utils"
 )
 
 var (
 	HttpMetaJwtClientApp = "JwtClientApp"
 	HttpMetaJwtIssuer    = "JwtIssuer"
+
+	// readOnlyPostResources lists the REST resources using POST for read-only queries,
+	// that remain accessible with read-only personal access tokens.
+	readOnlyPostResources = []string{
+		"/role",
+		"/user",
+		"/acl",
+		"/policy",
+		"/policy/explain",
+		"/workspace",
+		"/activity/stream",
+		"/activity/subscriptions",
+		"/log/sys",
+		"/search/nodes",
+		"/tree/stats",
+		"/tree/recycle",
+		"/meta/get/<.+>",
+		"/meta/bulk/get",
+		"/user-meta/search",
+		"/user-meta/bookmarks",
+		"/jobs/user",
+		"/quota/usage",
+		"/quota/list",
+		"/tree/admin/list",
+		"/tree/admin/stat",
+		"/changes/<.+>",
+		"/share/resources",
+		"/config/encryption/list",
+	}
 )
 
 // PolicyHttpWrapper applies relevant policy rules and blocks the request if necessary
@@ -53,6 +82,12 @@ func PolicyHttpWrapper(h http.Handler) http.Handler {
 		if cValue := c.Value(claim.ContextKey); cValue != nil {
 			if claims, ok := cValue.(claim.Claims); ok {
 				log.Logger(c).Debug("Got Claims", zap.Any("claims", claims))
+				if claims.Restrictions != nil && !restrictionsAllow(claims.Restrictions, r) {
+					log.Logger(c).Error(fmt.Sprintf("Personal access token %s blocked %s request at %s", claims.Restrictions.TokenUuid, r.Method, r.RequestURI))
+					w.WriteHeader(401)
+					w.Write([]byte("Unauthorized.\n"))
+					return
+				}
 				policyRequestContext[HttpMetaJwtClientApp] = claims.ClientApp
 				policyRequestContext[HttpMetaJwtIssuer] = claims.Issuer
 				subjects = utils.PolicyRequestSubjectsFromClaims(claims)
@@ -61,7 +96,6 @@ func PolicyHttpWrapper(h http.Handler) http.Handler {
 			log.Logger(c).Debug("No Claims Found", zap.Any("ctx", c))
 		}
 
-		client := idm.NewPolicyEngineServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_POLICY, defaults.NewClient())
 		request := &idm.PolicyEngineRequest{
 			Subjects: subjects,
 			Resource: "rest:" + r.RequestURI,
@@ -69,12 +103,13 @@ func PolicyHttpWrapper(h http.Handler) http.Handler {
 		}
 
 		utils.PolicyContextFromMetadata(policyRequestContext, c)
+		utils.PolicyContextFromClaims(policyRequestContext, c)
 		if len(policyRequestContext) > 0 {
 			request.Context = policyRequestContext
 		}
 
-		// Effective request to ladon
-		resp, err := client.IsAllowed(c, request)
+		// Effective request to ladon, batched with concurrent requests
+		resp, err := utils.PolicyIsAllowed(c, request)
 		// log.Logger(c).Error("Querying Policy Service", zap.Any("request", request), zap.Any("response", resp), zap.Error(err))
 
 		if err != nil || !resp.Allowed {
@@ -96,3 +131,35 @@ func PolicyHttpWrapper(h http.Handler) http.Handler {
 		h.ServeHTTP(w, r)
 	})
 }
+
+// restrictionsAllow checks a request against the restrictions of a personal access token.
+func restrictionsAllow(restrictions *claim.Restrictions, r *http.Request) bool {
+	uri := r.URL.Path
+	if len(restrictions.Resources) > 0 && !matchResources(restrictions.Resources, uri) {
+		return false
+	}
+	if !restrictions.ReadOnly {
+		return true
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	case http.MethodPost:
+		return matchResources(readOnlyPostResources, uri)
+	}
+	return false
+}
+
+// matchResources checks an URI against a list of resources, using the same syntax as policies.
+func matchResources(resources []string, uri string) bool {
+	for _, resource := range resources {
+		reg, e := compiler.CompileRegex(strings.TrimPrefix(resource, "rest:"), '<', '>')
+		if e != nil {
+			continue
+		}
+		if reg.MatchString(uri) {
+			return true
+		}
+	}
+	return false
+}
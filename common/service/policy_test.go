@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package service
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/auth/claim"
+)
+
+func TestRestrictionsAllow(t *testing.T) {
+
+	Convey("Tokens without restrictions allow all requests", t, func() {
+		r := &claim.Restrictions{}
+		So(restrictionsAllow(r, httptest.NewRequest("PUT", "/tree/create", nil)), ShouldBeTrue)
+		So(restrictionsAllow(r, httptest.NewRequest("DELETE", "/user/john", nil)), ShouldBeTrue)
+	})
+
+	Convey("Tokens restricted to resources only allow matching requests", t, func() {
+		r := &claim.Restrictions{Resources: []string{"rest:/tree/<.+>", "/meta/bulk/get"}}
+		So(restrictionsAllow(r, httptest.NewRequest("POST", "/tree/stat/file", nil)), ShouldBeTrue)
+		So(restrictionsAllow(r, httptest.NewRequest("POST", "/meta/bulk/get", nil)), ShouldBeTrue)
+		So(restrictionsAllow(r, httptest.NewRequest("GET", "/user/john", nil)), ShouldBeFalse)
+		So(restrictionsAllow(r, httptest.NewRequest("GET", "/tree", nil)), ShouldBeFalse)
+	})
+
+	Convey("Read-only tokens only allow reading methods and read-only POST queries", t, func() {
+		r := &claim.Restrictions{ReadOnly: true}
+		So(restrictionsAllow(r, httptest.NewRequest("GET", "/user/john", nil)), ShouldBeTrue)
+		So(restrictionsAllow(r, httptest.NewRequest("HEAD", "/tree/stat/file", nil)), ShouldBeTrue)
+		So(restrictionsAllow(r, httptest.NewRequest("POST", "/user", nil)), ShouldBeTrue)
+		So(restrictionsAllow(r, httptest.NewRequest("POST", "/changes/42", nil)), ShouldBeTrue)
+		So(restrictionsAllow(r, httptest.NewRequest("POST", "/tree/create", nil)), ShouldBeFalse)
+		So(restrictionsAllow(r, httptest.NewRequest("PUT", "/user/john", nil)), ShouldBeFalse)
+		So(restrictionsAllow(r, httptest.NewRequest("DELETE", "/user/john", nil)), ShouldBeFalse)
+	})
+
+	Convey("Read-only restrictions apply on top of the resources", t, func() {
+		r := &claim.Restrictions{ReadOnly: true, Resources: []string{"rest:/tree/<.+>"}}
+		So(restrictionsAllow(r, httptest.NewRequest("GET", "/tree/stat/file", nil)), ShouldBeTrue)
+		So(restrictionsAllow(r, httptest.NewRequest("POST", "/user", nil)), ShouldBeFalse)
+	})
+
+}
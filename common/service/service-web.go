@@ -185,6 +185,7 @@ func WithWebAuth() ServiceOption {
 
 		o.webHandlerWraps = append(o.webHandlerWraps, func(handler http.Handler) http.Handler {
 			wrapped := PolicyHttpWrapper(handler)
+			wrapped = KeyPasswordHttpWrapper(wrapped)
 			wrapped = JWTHttpWrapper(wrapped)
 			wrapped = servicecontext.HttpSpanHandlerWrapper(wrapped)
 			wrapped = servicecontext.HttpMetaExtractorWrapper(wrapped)
@@ -232,6 +232,10 @@ func NewService(opts ...ServiceOption) Service {
 				if c := sql.NewDAO(driver, dsn, prefix); c != nil {
 					d = s.Options().DAO(c)
 				}
+			case "postgres":
+				if c := sql.NewDAO(driver, dsn, prefix); c != nil {
+					d = s.Options().DAO(c)
+				}
 			case "boltdb":
 				if c := boltdb.NewDAO(driver, dsn, prefix); c != nil {
 					d = s.Options().DAO(c)
@@ -97,7 +97,7 @@ func (h *Handler) Prepare(key string, query interface{}) error {
 		h.funcs[key] = v
 	case string:
 		v = h.replacer.Replace(v)
-		h.stmts[key] = v
+		h.stmts[key] = Rebind(h.Driver(), v)
 	}
 
 	return nil
@@ -116,7 +116,7 @@ func (h *Handler) GetStmt(key string, args ...interface{}) *sql.Stmt {
 	if v, ok := h.ifuncs[key]; ok {
 
 		query := v(args...)
-		query = h.replacer.Replace(query)
+		query = Rebind(h.Driver(), h.replacer.Replace(query))
 
 		stmt, err := h.DB().Prepare(query)
 		if err != nil {
@@ -131,7 +131,7 @@ func (h *Handler) GetStmt(key string, args ...interface{}) *sql.Stmt {
 			sargs = append(sargs, fmt.Sprintf("%v", s))
 		}
 		query := v(sargs...)
-		query = h.replacer.Replace(query)
+		query = Rebind(h.Driver(), h.replacer.Replace(query))
 
 		stmt, err := h.DB().Prepare(query)
 		if err != nil {
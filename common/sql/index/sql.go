@@ -1625,7 +1625,7 @@ func getMPathEquals(tableAlias string, mpath []byte) string {
 	for {
 		var cnt int
 		cnt = (len(mpath) - 1) / indexLen
-		res = append(res, fmt.Sprintf(`%smpath%d LIKE "%s"`, tableAlias, cnt+1, mpath[(cnt*indexLen):]))
+		res = append(res, fmt.Sprintf(`%smpath%d LIKE '%s'`, tableAlias, cnt+1, mpath[(cnt*indexLen):]))
 
 		if idx := cnt * indexLen; idx == 0 {
 			break
@@ -1653,10 +1653,10 @@ func getMPathLike(tableAlias string, mpath []byte) string {
 		cnt = (len(mpath) - 1) / indexLen
 
 		if !done {
-			res = append(res, fmt.Sprintf(`%smpath%d LIKE "%s"`, tableAlias, cnt+1, mpath[(cnt*indexLen):]))
+			res = append(res, fmt.Sprintf(`%smpath%d LIKE '%s'`, tableAlias, cnt+1, mpath[(cnt*indexLen):]))
 			done = true
 		} else {
-			res = append(res, fmt.Sprintf(`%smpath%d LIKE "%s"`, tableAlias, cnt+1, mpath[(cnt*indexLen):]))
+			res = append(res, fmt.Sprintf(`%smpath%d LIKE '%s'`, tableAlias, cnt+1, mpath[(cnt*indexLen):]))
 		}
 
 		if idx := cnt * indexLen; idx == 0 {
@@ -1685,11 +1685,11 @@ func getMPathEqualsOrLike(tableAlias string, mpath []byte) string {
 		cnt = (len(mpath) - 1) / indexLen
 
 		if !done {
-			res = append(res, fmt.Sprintf(`%smpath%d LIKE "%s"`, tableAlias, cnt+1, mpath[(cnt*indexLen):len(mpath)-2]))
-			res = append(res, fmt.Sprintf(`%smpath%d LIKE "%s"`, tableAlias, cnt+1, mpath[(cnt*indexLen):]))
+			res = append(res, fmt.Sprintf(`%smpath%d LIKE '%s'`, tableAlias, cnt+1, mpath[(cnt*indexLen):len(mpath)-2]))
+			res = append(res, fmt.Sprintf(`%smpath%d LIKE '%s'`, tableAlias, cnt+1, mpath[(cnt*indexLen):]))
 			done = true
 		} else {
-			res = append(res, fmt.Sprintf(`%smpath%d LIKE "%s"`, tableAlias, cnt+1, mpath[(cnt*indexLen):]))
+			res = append(res, fmt.Sprintf(`%smpath%d LIKE '%s'`, tableAlias, cnt+1, mpath[(cnt*indexLen):]))
 		}
 
 		if idx := cnt * indexLen; idx == 0 {
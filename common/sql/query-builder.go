@@ -9,6 +9,7 @@ import (
 	"github.com/pmker/yux/common/service/proto"
 	"gopkg.in/doug-martin/goqu.v4"
 	_ "gopkg.in/doug-martin/goqu.v4/adapters/mysql"
+	_ "gopkg.in/doug-martin/goqu.v4/adapters/postgres"
 )
 
 // Expressioner ...
@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package sql
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Rebind transforms the "?" bind variables of a query into the syntax expected by the driver.
+// MySQL and SQLite use "?", PostgreSQL uses positional "$1", "$2"... variables. Question marks
+// appearing inside quoted literals or identifiers are left untouched.
+func Rebind(driver string, query string) string {
+	if driver != "postgres" {
+		return query
+	}
+
+	var (
+		buf   strings.Builder
+		quote rune
+		n     int
+	)
+	buf.Grow(len(query) + 10)
+	for _, r := range query {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '?':
+			n++
+			buf.WriteByte('$')
+			buf.WriteString(strconv.Itoa(n))
+			continue
+		}
+		buf.WriteRune(r)
+	}
+
+	return buf.String()
+}
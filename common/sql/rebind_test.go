@@ -0,0 +1,44 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package sql
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRebind(t *testing.T) {
+
+	Convey("Non postgres drivers keep question marks", t, func() {
+		q := `select * from t where a = ? and b = ?`
+		So(Rebind("mysql", q), ShouldEqual, q)
+		So(Rebind("sqlite3", q), ShouldEqual, q)
+	})
+
+	Convey("Postgres uses positional variables", t, func() {
+		So(Rebind("postgres", `insert into t (a, b) values (?, ?), (?, ?)`), ShouldEqual, `insert into t (a, b) values ($1, $2), ($3, $4)`)
+	})
+
+	Convey("Quoted question marks are left untouched", t, func() {
+		So(Rebind("postgres", `select '?', "col?" from t where a = ? and b LIKE 'it''s?'`), ShouldEqual, `select '?', "col?" from t where a = $1 and b LIKE 'it''s?'`)
+	})
+}
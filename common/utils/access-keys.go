@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/micro/go-micro/errors"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/proto/docstore"
+)
+
+const accessKeyIdChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+
+// AccessKey is a pair of credentials attached to a user, used by API clients signing their requests
+// (e.g. S3 clients) instead of logging in with a password. As request signatures are computed from
+// the secret itself, the secret is stored as is in the DocStore: deleting the key revokes it, after
+// a few seconds for gateways caching the keys.
+type AccessKey struct {
+	ID      string `json:"-"`
+	Login   string `json:"-"`
+	Secret  string `json:"secret"`
+	Label   string `json:"label,omitempty"`
+	Created int64  `json:"created"`
+}
+
+// CreateAccessKey generates a new access key for the given user login and stores it.
+func CreateAccessKey(ctx context.Context, login string, label string) (*AccessKey, error) {
+
+	idBytes := make([]byte, 18)
+	secretBytes := make([]byte, 30)
+	if _, e := rand.Read(idBytes); e != nil {
+		return nil, e
+	}
+	if _, e := rand.Read(secretBytes); e != nil {
+		return nil, e
+	}
+	id := []byte("PY")
+	for _, b := range idBytes {
+		id = append(id, accessKeyIdChars[int(b)%len(accessKeyIdChars)])
+	}
+	key := &AccessKey{
+		ID:      string(id),
+		Login:   login,
+		Secret:  base64.RawURLEncoding.EncodeToString(secretBytes),
+		Label:   label,
+		Created: time.Now().Unix(),
+	}
+	data, _ := json.Marshal(key)
+	store := docstore.NewDocStoreClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_DOCSTORE, defaults.NewClient())
+	if _, e := store.PutDocument(ctx, &docstore.PutDocumentRequest{StoreID: common.DOCSTORE_ID_ACCESS_KEYS, DocumentID: key.ID, Document: &docstore.Document{
+		ID:    key.ID,
+		Owner: login,
+		Data:  string(data),
+	}}); e != nil {
+		return nil, e
+	}
+	return key, nil
+}
+
+// LoadAccessKey finds an access key by its ID.
+func LoadAccessKey(ctx context.Context, id string) (*AccessKey, error) {
+
+	store := docstore.NewDocStoreClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_DOCSTORE, defaults.NewClient())
+	resp, e := store.GetDocument(ctx, &docstore.GetDocumentRequest{StoreID: common.DOCSTORE_ID_ACCESS_KEYS, DocumentID: id})
+	if e != nil {
+		return nil, e
+	}
+	if resp.Document == nil || resp.Document.Data == "" {
+		return nil, errors.NotFound(common.SERVICE_DOCSTORE, "Cannot find access key "+id)
+	}
+	return accessKeyFromDocument(id, resp.Document)
+}
+
+// ListAccessKeys lists the access keys of the given user. Secrets are not returned.
+func ListAccessKeys(ctx context.Context, login string) (keys []*AccessKey, err error) {
+
+	store := docstore.NewDocStoreClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_DOCSTORE, defaults.NewClient())
+	streamer, err := store.ListDocuments(ctx, &docstore.ListDocumentsRequest{StoreID: common.DOCSTORE_ID_ACCESS_KEYS, Query: &docstore.DocumentQuery{Owner: login}})
+	if err != nil {
+		return
+	}
+	defer streamer.Close()
+	for {
+		resp, e := streamer.Recv()
+		if e != nil {
+			break
+		}
+		if resp == nil || resp.Document == nil {
+			continue
+		}
+		if key, e := accessKeyFromDocument(resp.Document.ID, resp.Document); e == nil {
+			key.Secret = ""
+			keys = append(keys, key)
+		}
+	}
+	return
+}
+
+// DeleteAccessKey revokes an access key, checking that it belongs to the given user.
+func DeleteAccessKey(ctx context.Context, login string, id string) error {
+
+	key, e := LoadAccessKey(ctx, id)
+	if e != nil {
+		return e
+	}
+	if key.Login != login {
+		return errors.NotFound(common.SERVICE_DOCSTORE, "Cannot find access key "+id)
+	}
+	store := docstore.NewDocStoreClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_DOCSTORE, defaults.NewClient())
+	_, e = store.DeleteDocuments(ctx, &docstore.DeleteDocumentsRequest{StoreID: common.DOCSTORE_ID_ACCESS_KEYS, DocumentID: id})
+	return e
+}
+
+func accessKeyFromDocument(id string, doc *docstore.Document) (*AccessKey, error) {
+	key := &AccessKey{}
+	if e := json.Unmarshal([]byte(doc.Data), key); e != nil {
+		return nil, e
+	}
+	key.ID = id
+	key.Login = doc.Owner
+	return key, nil
+}
@@ -67,12 +67,13 @@ var (
 		FLAG_POLICY: "policy",
 		FLAG_QUOTA:  "quota",
 	}
-	ACL_READ         = &idm.ACLAction{Name: "read", Value: "1"}
-	ACL_WRITE        = &idm.ACLAction{Name: "write", Value: "1"}
-	ACL_DENY         = &idm.ACLAction{Name: "deny", Value: "1"}
-	ACL_POLICY       = &idm.ACLAction{Name: "policy"}
-	ACL_QUOTA        = &idm.ACLAction{Name: "quota"}
-	ACL_CONTENT_LOCK = &idm.ACLAction{Name: "content_lock"}
+	ACL_READ              = &idm.ACLAction{Name: "read", Value: "1"}
+	ACL_WRITE             = &idm.ACLAction{Name: "write", Value: "1"}
+	ACL_DENY              = &idm.ACLAction{Name: "deny", Value: "1"}
+	ACL_POLICY            = &idm.ACLAction{Name: "policy"}
+	ACL_QUOTA             = &idm.ACLAction{Name: "quota"}
+	ACL_CONTENT_LOCK      = &idm.ACLAction{Name: "content_lock"}
+	ACL_CONTENT_LOCK_INFO = &idm.ACLAction{Name: "content_lock_info"}
 	// Not used yet
 	ACL_FRONT_ACTION_      = &idm.ACLAction{Name: "action:*"}
 	ACL_FRONT_PARAM_       = &idm.ACLAction{Name: "parameter:*"}
@@ -95,6 +96,7 @@ func (f Bitmask) HasFlag(ctx context.Context, flag BitmaskFlag, ctxNode ...*tree
 		// We should first resolve the policy, given the ctx and the node
 		policyContext := make(map[string]string)
 		PolicyContextFromMetadata(policyContext, ctx)
+		PolicyContextFromClaims(policyContext, ctx)
 		if len(ctxNode) > 0 {
 			PolicyContextFromNode(policyContext, ctxNode[0])
 		}
@@ -175,6 +177,8 @@ type AccessList struct {
 	WorkspacesNodes    map[string]map[string]Bitmask
 	OrderedRoles       []*idm.Role
 	FrontPluginsValues []*idm.ACL
+
+	readOnly bool
 }
 
 // NewAccessList creates a new AccessList.
@@ -204,6 +208,27 @@ func (a *AccessList) HasPolicyBasedAcls() bool {
 	return false
 }
 
+// Restrict narrows down the ACLs to a subset of workspaces (all workspaces if empty),
+// and optionally forbids any write access. It must be called before Flatten.
+func (a *AccessList) Restrict(workspaces []string, readOnly bool) {
+	a.readOnly = readOnly
+	if len(workspaces) == 0 {
+		return
+	}
+	allowed := make(map[string]bool, len(workspaces))
+	for _, ws := range workspaces {
+		allowed[ws] = true
+	}
+	var acls []*idm.ACL
+	for _, acl := range a.Acls {
+		if acl.WorkspaceID != "" && !allowed[acl.WorkspaceID] {
+			continue
+		}
+		acls = append(acls, acl)
+	}
+	a.Acls = acls
+}
+
 // Flatten performs actual flatten.
 func (a *AccessList) Flatten(ctx context.Context) {
 	nodes, workspaces := a.flattenNodes(ctx, a.Acls)
@@ -357,6 +382,9 @@ func (a *AccessList) CanRead(ctx context.Context, nodes ...*tree.Node) bool {
 
 // CanWrite checks if a node has WRITE access.
 func (a *AccessList) CanWrite(ctx context.Context, nodes ...*tree.Node) bool {
+	if a.readOnly {
+		return false
+	}
 	deny, mask := a.ParentMaskOrDeny(ctx, nodes...)
 	return !deny && mask.HasFlag(ctx, FLAG_WRITE, nodes[0])
 }
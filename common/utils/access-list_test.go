@@ -152,3 +152,33 @@ func TestAccessList_Flatten(t *testing.T) {
 
 	})
 }
+
+func TestAccessList_Restrict(t *testing.T) {
+	Convey("Test Restrict", t, func() {
+		ctx := context.Background()
+		list := NewAccessList(roles)
+		list.Append(acls)
+		list.Restrict([]string{"ws2"}, false)
+		list.Flatten(ctx)
+		wsNodes := list.GetWorkspacesNodes()
+		So(wsNodes, ShouldHaveLength, 1)
+		So(wsNodes, ShouldContainKey, "ws2")
+
+		testReadWrite := listParents("root/folder1/subfolder2/file1")
+		So(list.CanRead(ctx, testReadWrite...), ShouldBeTrue)
+		So(list.CanWrite(ctx, testReadWrite...), ShouldBeTrue)
+	})
+
+	Convey("Test Restrict read-only", t, func() {
+		ctx := context.Background()
+		list := NewAccessList(roles)
+		list.Append(acls)
+		list.Restrict(nil, true)
+		list.Flatten(ctx)
+		So(list.GetWorkspacesNodes(), ShouldHaveLength, 2)
+
+		testReadWrite := listParents("root/folder1/subfolder2/file1")
+		So(list.CanRead(ctx, testReadWrite...), ShouldBeTrue)
+		So(list.CanWrite(ctx, testReadWrite...), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/proto/idm"
+	"github.com/pmker/yux/common/service/proto"
+)
+
+// ContentLock is a lock set on a node content. It is stored in the ACL service as a
+// "content_lock" ACL whose value is the owner login, and optionally a "content_lock_info"
+// ACL carrying the details required by WebDAV-like lock clients. As the ACL store enforces
+// a single action name per node, only one lock can be created on a given node.
+type ContentLock struct {
+	NodeUuid string
+	Owner    string
+	Info     *ContentLockInfo
+}
+
+// ContentLockInfo holds the optional details of a ContentLock.
+type ContentLockInfo struct {
+	// Source is the protocol used to create the lock (webdav, wopi)
+	Source    string `json:"source,omitempty"`
+	Token     string `json:"token,omitempty"`
+	Root      string `json:"root,omitempty"`
+	OwnerXML  string `json:"ownerXML,omitempty"`
+	ZeroDepth bool   `json:"zeroDepth,omitempty"`
+	// Expiry as a unix timestamp, zero means the lock never expires
+	Expiry int64 `json:"expiry,omitempty"`
+}
+
+type contentLockTokenKey struct{}
+
+// WithContentLockToken registers in context the lock token presented by a client. It allows
+// writing to a node locked with this token by another user, typically in a co-editing session.
+func WithContentLockToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, contentLockTokenKey{}, token)
+}
+
+// ContentLockTokenFromContext retrieves the lock token presented by the client, if any.
+func ContentLockTokenFromContext(ctx context.Context) string {
+	if token, ok := ctx.Value(contentLockTokenKey{}).(string); ok {
+		return token
+	}
+	return ""
+}
+
+// Expired checks if the lock has an expiry date and if it is passed.
+func (l *ContentLock) Expired(now time.Time) bool {
+	return l.Info != nil && l.Info.Expiry > 0 && now.Unix() >= l.Info.Expiry
+}
+
+// LoadContentLocks finds the locks registered on the given nodes, indexed by node Uuid.
+// Expired locks are returned as well, it is up to the caller to ignore or clear them.
+func LoadContentLocks(ctx context.Context, nodeUuids ...string) (map[string]*ContentLock, error) {
+	locks := make(map[string]*ContentLock)
+	if len(nodeUuids) == 0 {
+		return locks, nil
+	}
+	aclClient := idm.NewACLServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_ACL, defaults.NewClient())
+	q, _ := ptypes.MarshalAny(&idm.ACLSingleQuery{
+		NodeIDs: nodeUuids,
+		Actions: []*idm.ACLAction{{Name: ACL_CONTENT_LOCK.Name}, {Name: ACL_CONTENT_LOCK_INFO.Name}},
+	})
+	stream, err := aclClient.SearchACL(ctx, &idm.SearchACLRequest{Query: &service.Query{SubQueries: []*any.Any{q}}})
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	infos := make(map[string]*ContentLockInfo)
+	for {
+		rsp, e := stream.Recv()
+		if e != nil {
+			break
+		}
+		if rsp == nil {
+			continue
+		}
+		acl := rsp.ACL
+		switch acl.Action.Name {
+		case ACL_CONTENT_LOCK.Name:
+			locks[acl.NodeID] = &ContentLock{NodeUuid: acl.NodeID, Owner: acl.Action.Value}
+		case ACL_CONTENT_LOCK_INFO.Name:
+			info := &ContentLockInfo{}
+			if e := json.Unmarshal([]byte(acl.Action.Value), info); e == nil {
+				infos[acl.NodeID] = info
+			}
+		}
+	}
+	// Info without a main lock are leftovers and are simply ignored
+	for nodeUuid, info := range infos {
+		if lock, ok := locks[nodeUuid]; ok {
+			lock.Info = info
+		}
+	}
+	return locks, nil
+}
+
+// CreateContentLock registers a new lock. It fails if the node is already locked.
+func CreateContentLock(ctx context.Context, lock *ContentLock) error {
+	aclClient := idm.NewACLServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_ACL, defaults.NewClient())
+	if _, e := aclClient.CreateACL(ctx, &idm.CreateACLRequest{ACL: &idm.ACL{
+		NodeID: lock.NodeUuid,
+		Action: &idm.ACLAction{Name: ACL_CONTENT_LOCK.Name, Value: lock.Owner},
+	}}); e != nil {
+		return e
+	}
+	if lock.Info == nil {
+		return nil
+	}
+	return UpdateContentLockInfo(ctx, lock)
+}
+
+// UpdateContentLockInfo replaces the details of an existing lock, typically to push its expiry.
+func UpdateContentLockInfo(ctx context.Context, lock *ContentLock) error {
+	aclClient := idm.NewACLServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_ACL, defaults.NewClient())
+	q, _ := ptypes.MarshalAny(&idm.ACLSingleQuery{
+		NodeIDs: []string{lock.NodeUuid},
+		Actions: []*idm.ACLAction{{Name: ACL_CONTENT_LOCK_INFO.Name}},
+	})
+	if _, e := aclClient.DeleteACL(ctx, &idm.DeleteACLRequest{Query: &service.Query{SubQueries: []*any.Any{q}}}); e != nil {
+		return e
+	}
+	if lock.Info == nil {
+		return nil
+	}
+	data, e := json.Marshal(lock.Info)
+	if e != nil {
+		return e
+	}
+	_, e = aclClient.CreateACL(ctx, &idm.CreateACLRequest{ACL: &idm.ACL{
+		NodeID: lock.NodeUuid,
+		Action: &idm.ACLAction{Name: ACL_CONTENT_LOCK_INFO.Name, Value: string(data)},
+	}})
+	return e
+}
+
+// DeleteContentLock removes the lock and its details from a node.
+func DeleteContentLock(ctx context.Context, nodeUuid string) error {
+	aclClient := idm.NewACLServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_ACL, defaults.NewClient())
+	q, _ := ptypes.MarshalAny(&idm.ACLSingleQuery{
+		NodeIDs: []string{nodeUuid},
+		Actions: []*idm.ACLAction{{Name: ACL_CONTENT_LOCK.Name}, {Name: ACL_CONTENT_LOCK_INFO.Name}},
+	})
+	_, e := aclClient.DeleteACL(ctx, &idm.DeleteACLRequest{Query: &service.Query{SubQueries: []*any.Any{q}}})
+	return e
+}
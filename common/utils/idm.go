@@ -347,10 +347,10 @@ func AccessListFromContextClaims(ctx context.Context) (accessList *AccessList, e
 	roles := GetRoles(ctx, strings.Split(claims.Roles, ","))
 	accessList = NewAccessList(roles)
 	accessList.Append(GetACLsForRoles(ctx, roles, ACL_READ, ACL_DENY, ACL_WRITE, ACL_POLICY))
-	ResolvePolicyRequest = func(ctx context.Context, request *idm.PolicyEngineRequest) (*idm.PolicyEngineResponse, error) {
-		cli := idm.NewPolicyEngineServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_POLICY, defaults.NewClient())
-		return cli.IsAllowed(ctx, request)
+	if r := claims.Restrictions; r != nil {
+		accessList.Restrict(r.Workspaces, r.ReadOnly)
 	}
+	ResolvePolicyRequest = PolicyIsAllowed
 	accessList.Flatten(ctx)
 
 	idmWorkspaces := GetWorkspacesForACLs(ctx, accessList)
@@ -472,7 +472,7 @@ func AccessListLoadFrontValues(ctx context.Context, accessList *AccessList) erro
 	return nil
 }
 
-// CheckContentLock finds if there is a global lock registered in ACLs.
+// CheckContentLock finds if there is a global lock registered in ACLs. Expired locks are ignored.
 func CheckContentLock(ctx context.Context, node *tree.Node) error {
 	if node.Uuid == "" {
 		return nil
@@ -482,29 +482,18 @@ func CheckContentLock(ctx context.Context, node *tree.Node) error {
 		userName = claims.Name
 	}
 
-	aclClient := idm.NewACLServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_ACL, defaults.NewClient())
-	// Look for "quota" ACLs on this node
-	singleQ := &idm.ACLSingleQuery{NodeIDs: []string{node.Uuid}, Actions: []*idm.ACLAction{{Name: ACL_CONTENT_LOCK.Name}}}
-	log.Logger(ctx).Debug("SEARCHING FOR LOCKS IN ACLS", zap.Any("q", singleQ))
-	q, _ := ptypes.MarshalAny(singleQ)
-	stream, err := aclClient.SearchACL(ctx, &idm.SearchACLRequest{Query: &service.Query{SubQueries: []*any.Any{q}}})
+	log.Logger(ctx).Debug("SEARCHING FOR LOCKS IN ACLS", zap.String("node", node.Uuid))
+	locks, err := LoadContentLocks(ctx, node.Uuid)
 	if err != nil {
 		return err
 	}
-	defer stream.Close()
-	for {
-		rsp, e := stream.Recv()
-		if e != nil {
-			break
-		}
-		if rsp == nil {
-			continue
+	if lock, ok := locks[node.Uuid]; ok && !lock.Expired(time.Now()) {
+		if token := ContentLockTokenFromContext(ctx); token != "" && lock.Info != nil && lock.Info.Token == token {
+			return nil
 		}
-		acl := rsp.ACL
-		if userName == "" || acl.Action.Value != userName {
+		if userName == "" || lock.Owner != userName {
 			return errors.Forbidden("file.locked", "This file is locked by another user")
 		}
-		break
 	}
 	return nil
 }
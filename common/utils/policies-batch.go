@@ -0,0 +1,158 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/proto/idm"
+)
+
+const policyBatchMaxSize = 100
+
+var (
+	defaultPolicyBatcher = NewPolicyBatcher(func(ctx context.Context, requests []*idm.PolicyEngineRequest) ([]*idm.PolicyEngineResponse, error) {
+		cli := idm.NewPolicyEngineServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_POLICY, defaults.NewClient())
+		resp, err := cli.IsAllowedMany(ctx, &idm.IsAllowedManyRequest{Requests: requests})
+		if err != nil {
+			return nil, err
+		}
+		return resp.Responses, nil
+	})
+)
+
+type policyBatchResult struct {
+	response *idm.PolicyEngineResponse
+	err      error
+}
+
+type pendingPolicyRequest struct {
+	ctx     context.Context
+	request *idm.PolicyEngineRequest
+	done    chan policyBatchResult
+}
+
+// PolicyBatcher sends policy requests to the policy engine. While a call is in flight, incoming requests
+// are queued and sent together in a single batch, so that concurrent checks do not add up round-trips.
+// A batch is sent with the context of its first request. If it fails, its requests are sent again one
+// by one with their own context, so that an error is only returned to the request that caused it.
+type PolicyBatcher struct {
+	sync.Mutex
+	send    func(context.Context, []*idm.PolicyEngineRequest) ([]*idm.PolicyEngineResponse, error)
+	queue   []*pendingPolicyRequest
+	running bool
+}
+
+// NewPolicyBatcher creates a batcher using the send function to evaluate a batch of requests.
+func NewPolicyBatcher(send func(context.Context, []*idm.PolicyEngineRequest) ([]*idm.PolicyEngineResponse, error)) *PolicyBatcher {
+	return &PolicyBatcher{send: send}
+}
+
+// IsAllowed queues the request and waits for its decision.
+func (b *PolicyBatcher) IsAllowed(ctx context.Context, request *idm.PolicyEngineRequest) (*idm.PolicyEngineResponse, error) {
+	p := &pendingPolicyRequest{ctx: ctx, request: request, done: make(chan policyBatchResult, 1)}
+	b.Lock()
+	b.queue = append(b.queue, p)
+	if !b.running {
+		b.running = true
+		go b.run()
+	}
+	b.Unlock()
+	select {
+	case r := <-p.done:
+		return r.response, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// run sends the queued requests until the queue is empty.
+func (b *PolicyBatcher) run() {
+	for {
+		b.Lock()
+		batch := b.queue
+		if len(batch) > policyBatchMaxSize {
+			batch = batch[:policyBatchMaxSize]
+		}
+		b.queue = b.queue[len(batch):]
+		if len(batch) == 0 {
+			b.running = false
+			b.Unlock()
+			return
+		}
+		b.Unlock()
+
+		b.sendBatch(batch)
+	}
+}
+
+// sendBatch sends the requests whose caller is still waiting, and retries them one by one on failure.
+func (b *PolicyBatcher) sendBatch(batch []*pendingPolicyRequest) {
+	var pending []*pendingPolicyRequest
+	for _, p := range batch {
+		if p.ctx.Err() == nil {
+			pending = append(pending, p)
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+	requests := make([]*idm.PolicyEngineRequest, len(pending))
+	for i, p := range pending {
+		requests[i] = p.request
+	}
+	responses, err := b.sendRequests(pending[0].ctx, requests)
+	if err == nil {
+		for i, p := range pending {
+			p.done <- policyBatchResult{response: responses[i]}
+		}
+		return
+	}
+	if len(pending) == 1 {
+		pending[0].done <- policyBatchResult{err: err}
+		return
+	}
+	for _, p := range pending {
+		responses, err := b.sendRequests(p.ctx, []*idm.PolicyEngineRequest{p.request})
+		if err != nil {
+			p.done <- policyBatchResult{err: err}
+		} else {
+			p.done <- policyBatchResult{response: responses[0]}
+		}
+	}
+}
+
+func (b *PolicyBatcher) sendRequests(ctx context.Context, requests []*idm.PolicyEngineRequest) ([]*idm.PolicyEngineResponse, error) {
+	responses, err := b.send(ctx, requests)
+	if err == nil && len(responses) != len(requests) {
+		err = fmt.Errorf("policy engine returned %d responses for %d requests", len(responses), len(requests))
+	}
+	return responses, err
+}
+
+// PolicyIsAllowed checks a request against the policy engine, batching it with concurrent requests.
+func PolicyIsAllowed(ctx context.Context, request *idm.PolicyEngineRequest) (*idm.PolicyEngineResponse, error) {
+	return defaultPolicyBatcher.IsAllowed(ctx, request)
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/proto/idm"
+)
+
+func TestPolicyBatcher(t *testing.T) {
+
+	Convey("Concurrent requests are batched while a call is in flight", t, func() {
+
+		var lock sync.Mutex
+		var batches []int
+		release := make(chan struct{})
+		b := NewPolicyBatcher(func(ctx context.Context, requests []*idm.PolicyEngineRequest) ([]*idm.PolicyEngineResponse, error) {
+			lock.Lock()
+			batches = append(batches, len(requests))
+			first := len(batches) == 1
+			lock.Unlock()
+			if first {
+				<-release
+			}
+			var responses []*idm.PolicyEngineResponse
+			for _, r := range requests {
+				responses = append(responses, &idm.PolicyEngineResponse{Allowed: r.Resource == "allowed"})
+			}
+			return responses, nil
+		})
+
+		var wg sync.WaitGroup
+		results := make([]bool, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				resource := fmt.Sprintf("denied-%d", i)
+				if i%2 == 0 {
+					resource = "allowed"
+				}
+				resp, err := b.IsAllowed(context.Background(), &idm.PolicyEngineRequest{Resource: resource})
+				if err == nil {
+					results[i] = resp.Allowed
+				}
+			}(i)
+			if i == 0 {
+				// Wait for the first call to be in flight
+				time.Sleep(50 * time.Millisecond)
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		So(batches, ShouldResemble, []int{1, 9})
+		for i, allowed := range results {
+			So(allowed, ShouldEqual, i%2 == 0)
+		}
+	})
+
+	Convey("Invalid responses are returned as errors", t, func() {
+
+		b := NewPolicyBatcher(func(ctx context.Context, requests []*idm.PolicyEngineRequest) ([]*idm.PolicyEngineResponse, error) {
+			return []*idm.PolicyEngineResponse{}, nil
+		})
+		_, err := b.IsAllowed(context.Background(), &idm.PolicyEngineRequest{Resource: "any"})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("A failing request does not fail the other requests of its batch", t, func() {
+
+		release := make(chan struct{})
+		var once sync.Once
+		b := NewPolicyBatcher(func(ctx context.Context, requests []*idm.PolicyEngineRequest) ([]*idm.PolicyEngineResponse, error) {
+			once.Do(func() { <-release })
+			var responses []*idm.PolicyEngineResponse
+			for _, r := range requests {
+				if r.Resource == "failing" {
+					return nil, fmt.Errorf("cannot evaluate request")
+				}
+				responses = append(responses, &idm.PolicyEngineResponse{Allowed: true})
+			}
+			return responses, nil
+		})
+
+		var wg sync.WaitGroup
+		errs := make([]error, 5)
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				resource := "any"
+				if i == 3 {
+					resource = "failing"
+				}
+				_, errs[i] = b.IsAllowed(context.Background(), &idm.PolicyEngineRequest{Resource: resource})
+			}(i)
+			if i == 0 {
+				time.Sleep(50 * time.Millisecond)
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		for i, err := range errs {
+			if i == 3 {
+				So(err, ShouldNotBeNil)
+			} else {
+				So(err, ShouldBeNil)
+			}
+		}
+	})
+
+	Convey("Requests are sent with the context of their caller", t, func() {
+
+		type key struct{}
+		b := NewPolicyBatcher(func(ctx context.Context, requests []*idm.PolicyEngineRequest) ([]*idm.PolicyEngineResponse, error) {
+			return []*idm.PolicyEngineResponse{{Allowed: ctx.Value(key{}) == "caller"}}, nil
+		})
+		resp, err := b.IsAllowed(context.WithValue(context.Background(), key{}, "caller"), &idm.PolicyEngineRequest{Resource: "any"})
+		So(err, ShouldBeNil)
+		So(resp.Allowed, ShouldBeTrue)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = b.IsAllowed(ctx, &idm.PolicyEngineRequest{Resource: "any"})
+		So(err, ShouldEqual, context.Canceled)
+	})
+}
@@ -22,7 +22,9 @@ package utils
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/micro/go-micro/metadata"
@@ -41,6 +43,8 @@ const (
 	PolicyNodeMetaSize      = "NodeMetaSize"
 	PolicyNodeMetaMTime     = "NodeMetaMTime"
 	PolicyNodeMeta_         = "NodeMeta:"
+	PolicyAuthMethods       = "AuthMethods"
+	PolicyAuthMFALevel      = "AuthMFALevel"
 )
 
 /* Helper methods to ease management of Ladon policies */
@@ -96,6 +100,31 @@ func PolicyContextFromMetadata(policyContext map[string]string, ctx context.Cont
 	}
 }
 
+// PolicyContextFromClaims extracts the authentication methods from the claims found in context
+// (or in context metadata) and enriches the passed policyContext.
+func PolicyContextFromClaims(policyContext map[string]string, ctx context.Context) {
+	var claims claim.Claims
+	if cValue := ctx.Value(claim.ContextKey); cValue != nil {
+		c, ok := cValue.(claim.Claims)
+		if !ok {
+			return
+		}
+		claims = c
+	} else if ctxMeta, has := metadata.FromContext(ctx); has {
+		jsonClaims, ok := ctxMeta[claim.MetadataContextKey]
+		if !ok {
+			return
+		}
+		if e := json.Unmarshal([]byte(jsonClaims), &claims); e != nil {
+			return
+		}
+	} else {
+		return
+	}
+	policyContext[PolicyAuthMethods] = strings.Join(claims.Methods(), ",")
+	policyContext[PolicyAuthMFALevel] = strconv.Itoa(claims.MFALevel())
+}
+
 // PolicyContextFromNode extracts metadata from the Node and enriches the passed policyContext.
 func PolicyContextFromNode(policyContext map[string]string, node *tree.Node) {
 	// TODO: add file extension
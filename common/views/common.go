@@ -60,6 +60,8 @@ type (
 	ctxUserAccessListKey struct{}
 	ctxAdminContextKey   struct{}
 	ctxBranchInfoKey     struct{}
+	ctxShareLinkKey      struct{}
+	ctxShareLinkDocKey   struct{}
 	CtxKeepAccessListKey struct{}
 
 	LoadedSource struct {
@@ -97,6 +99,8 @@ type (
 
 	MultipartRequestData struct {
 		Metadata map[string]string
+		// Size is the total size of the upload, if it is known when the upload is created
+		Size int64
 
 		ListKeyMarker      string
 		ListUploadIDMarker string
@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package views
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/micro/go-micro/errors"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/proto/docstore"
+)
+
+// BlobRef identifies a deduplicated blob by the datasource storing it and the sha256 of its content.
+type BlobRef struct {
+	Source string `json:"BlobSource"`
+	Hash   string `json:"BlobHash"`
+}
+
+// BlobRefStore keeps track of the reference objects pointing to deduplicated blobs, so that a blob is only removed
+// when its last reference goes away. Implementations must apply each change atomically, as the store is shared
+// by all the processes writing to the datasources.
+type BlobRefStore interface {
+	// Retain registers the reference refId, pointing to the given blob. It waits while the blob is being removed.
+	Retain(ctx context.Context, refId string, blob BlobRef) error
+	// Release unregisters the reference refId. If it was the last reference, the blob is marked as being removed
+	// in the same change and Release returns true: the caller must then remove the blob and call Removed.
+	Release(ctx context.Context, refId string, blob BlobRef) (bool, error)
+	// Removed clears the blob once it is actually removed.
+	Removed(ctx context.Context, blob BlobRef) error
+}
+
+var (
+	// blobRefsRetries is the number of times a counter update is retried when the counter was concurrently modified
+	// or when the blob is being removed.
+	blobRefsRetries = 50
+	// blobRefsWait is the delay before retrying to retain a blob that is being removed.
+	blobRefsWait = 100 * time.Millisecond
+	// blobRemovalTimeout is the delay after which a removal is considered abandoned: the blob can be retained again.
+	blobRemovalTimeout = time.Minute
+)
+
+// blobCounter is the content of the counter document of a blob.
+type blobCounter struct {
+	Refs []string
+	// Removing is the time when the last reference was released, while the blob is being removed.
+	Removing int64 `json:",omitempty"`
+}
+
+func (c *blobCounter) removing() bool {
+	return c.Removing > 0 && time.Since(time.Unix(c.Removing, 0)) < blobRemovalTimeout
+}
+
+// docStoreBlobRefs stores one counter document per blob in a dedicated DocStore, listing the references to the blob.
+// Counters are only updated with the compare-and-swap operations of the DocStore.
+type docStoreBlobRefs struct {
+	client docstore.DocStoreClient
+}
+
+// NewDocStoreBlobRefs creates a BlobRefStore backed by the DocStore service.
+func NewDocStoreBlobRefs() BlobRefStore {
+	return &docStoreBlobRefs{
+		client: docstore.NewDocStoreClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_DOCSTORE, defaults.NewClient()),
+	}
+}
+
+func (d *docStoreBlobRefs) Retain(ctx context.Context, refId string, blob BlobRef) error {
+	for i := 0; i < blobRefsRetries; i++ {
+		counter, current, e := d.load(ctx, blob)
+		if e != nil {
+			return e
+		}
+		if counter.removing() {
+			log.Logger(ctx).Debug("Blob is being removed, waiting", zap.String("hash", blob.Hash))
+			time.Sleep(blobRefsWait)
+			continue
+		}
+		if counter.Removing > 0 {
+			log.Logger(ctx).Warn("Taking over an abandoned blob removal", zap.String("hash", blob.Hash))
+			counter.Removing = 0
+		}
+		counter.Refs = append(counter.Refs, refId)
+		if e := d.swap(ctx, blob, counter, current); e == nil || !d.retryable(e) {
+			return e
+		}
+		log.Logger(ctx).Debug("Blob counter was modified concurrently, retrying", zap.String("hash", blob.Hash))
+	}
+	return errors.New(VIEWS_LIBRARY_NAME, "Cannot register reference to blob "+blob.Hash, 409)
+}
+
+func (d *docStoreBlobRefs) Release(ctx context.Context, refId string, blob BlobRef) (bool, error) {
+	for i := 0; i < blobRefsRetries; i++ {
+		counter, current, e := d.load(ctx, blob)
+		if e != nil || current == "" || counter.Removing > 0 {
+			return false, e
+		}
+		refs := make([]string, 0, len(counter.Refs))
+		for _, r := range counter.Refs {
+			if r != refId {
+				refs = append(refs, r)
+			}
+		}
+		counter.Refs = refs
+		if len(refs) == 0 {
+			counter.Removing = time.Now().Unix()
+		}
+		e = d.swap(ctx, blob, counter, current)
+		if e == nil {
+			return len(refs) == 0, nil
+		} else if !d.retryable(e) {
+			return false, e
+		}
+		log.Logger(ctx).Debug("Blob counter was modified concurrently, retrying", zap.String("hash", blob.Hash))
+	}
+	return false, errors.New(VIEWS_LIBRARY_NAME, "Cannot unregister reference to blob "+blob.Hash, 409)
+}
+
+func (d *docStoreBlobRefs) Removed(ctx context.Context, blob BlobRef) error {
+	_, e := d.client.DeleteDocuments(ctx, &docstore.DeleteDocumentsRequest{
+		StoreID:    common.DOCSTORE_ID_BLOB_REFS,
+		DocumentID: d.counterId(blob),
+	})
+	return e
+}
+
+// load reads the counter of a blob, along with its raw data. The data is empty if there is no counter yet.
+func (d *docStoreBlobRefs) load(ctx context.Context, blob BlobRef) (*blobCounter, string, error) {
+	counter := &blobCounter{}
+	resp, e := d.client.GetDocument(ctx, &docstore.GetDocumentRequest{
+		StoreID:    common.DOCSTORE_ID_BLOB_REFS,
+		DocumentID: d.counterId(blob),
+	})
+	if e != nil {
+		return nil, "", e
+	}
+	if resp.Document == nil {
+		return counter, "", nil
+	}
+	if e := json.Unmarshal([]byte(resp.Document.Data), counter); e != nil {
+		return nil, "", e
+	}
+	return counter, resp.Document.Data, nil
+}
+
+// swap stores the counter of a blob if its data is still equal to current, or creates it if current is empty.
+func (d *docStoreBlobRefs) swap(ctx context.Context, blob BlobRef, counter *blobCounter, current string) error {
+	data, _ := json.Marshal(counter)
+	id := d.counterId(blob)
+	_, e := d.client.PutDocument(ctx, &docstore.PutDocumentRequest{
+		StoreID:    common.DOCSTORE_ID_BLOB_REFS,
+		DocumentID: id,
+		Document: &docstore.Document{
+			ID:   id,
+			Type: docstore.DocumentType_JSON,
+			Data: string(data),
+		},
+		ExpectedData: current,
+		CreateOnly:   current == "",
+	})
+	return e
+}
+
+// retryable tells if an update failed because the counter was concurrently modified, created or removed.
+func (d *docStoreBlobRefs) retryable(e error) bool {
+	code := errors.Parse(e.Error()).Code
+	return code == 409 || code == 404
+}
+
+func (d *docStoreBlobRefs) counterId(blob BlobRef) string {
+	return blob.Source + ":" + blob.Hash
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package views
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/client"
+	"github.com/micro/go-micro/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/proto/docstore"
+)
+
+// memoryDocStore is an in-memory DocStoreClient applying the compare-and-swap semantics of the DocStore service.
+type memoryDocStore struct {
+	sync.Mutex
+	docs map[string]*docstore.Document
+}
+
+func newMemoryDocStore() *memoryDocStore {
+	return &memoryDocStore{docs: make(map[string]*docstore.Document)}
+}
+
+func (m *memoryDocStore) PutDocument(ctx context.Context, in *docstore.PutDocumentRequest, opts ...client.CallOption) (*docstore.PutDocumentResponse, error) {
+	m.Lock()
+	defer m.Unlock()
+	current, ok := m.docs[in.Document.ID]
+	if in.ExpectedData != "" {
+		if !ok {
+			return nil, errors.NotFound("docstore", "Doc ID not found")
+		} else if current.Data != in.ExpectedData {
+			return nil, errors.New("docstore", "Document was modified", 409)
+		}
+	} else if in.CreateOnly && ok {
+		return nil, errors.New("docstore", "Document already exists", 409)
+	}
+	m.docs[in.Document.ID] = in.Document
+	return &docstore.PutDocumentResponse{Document: in.Document}, nil
+}
+
+func (m *memoryDocStore) GetDocument(ctx context.Context, in *docstore.GetDocumentRequest, opts ...client.CallOption) (*docstore.GetDocumentResponse, error) {
+	m.Lock()
+	defer m.Unlock()
+	return &docstore.GetDocumentResponse{Document: m.docs[in.DocumentID]}, nil
+}
+
+func (m *memoryDocStore) DeleteDocuments(ctx context.Context, in *docstore.DeleteDocumentsRequest, opts ...client.CallOption) (*docstore.DeleteDocumentsResponse, error) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.docs, in.DocumentID)
+	return &docstore.DeleteDocumentsResponse{Success: true}, nil
+}
+
+func (m *memoryDocStore) CountDocuments(ctx context.Context, in *docstore.ListDocumentsRequest, opts ...client.CallOption) (*docstore.CountDocumentsResponse, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (m *memoryDocStore) ListDocuments(ctx context.Context, in *docstore.ListDocumentsRequest, opts ...client.CallOption) (docstore.DocStore_ListDocumentsClient, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (m *memoryDocStore) counter(blob BlobRef) *blobCounter {
+	m.Lock()
+	defer m.Unlock()
+	doc, ok := m.docs[blob.Source+":"+blob.Hash]
+	if !ok {
+		return nil
+	}
+	counter := &blobCounter{}
+	json.Unmarshal([]byte(doc.Data), counter)
+	return counter
+}
+
+func TestDocStoreBlobRefs(t *testing.T) {
+
+	ctx := context.Background()
+	blob := BlobRef{Source: "ds", Hash: "abcdef"}
+
+	Convey("Test the last release marks the blob as being removed", t, func() {
+
+		docs := newMemoryDocStore()
+		refs := &docStoreBlobRefs{client: docs}
+		So(refs.Retain(ctx, "ref-1", blob), ShouldBeNil)
+		So(refs.Retain(ctx, "ref-2", blob), ShouldBeNil)
+		So(docs.counter(blob).Refs, ShouldResemble, []string{"ref-1", "ref-2"})
+
+		last, e := refs.Release(ctx, "ref-1", blob)
+		So(e, ShouldBeNil)
+		So(last, ShouldBeFalse)
+
+		last, e = refs.Release(ctx, "ref-2", blob)
+		So(e, ShouldBeNil)
+		So(last, ShouldBeTrue)
+		So(docs.counter(blob).Refs, ShouldBeEmpty)
+		So(docs.counter(blob).Removing, ShouldBeGreaterThan, 0)
+
+		// Releasing again does not remove the blob twice
+		last, e = refs.Release(ctx, "ref-2", blob)
+		So(e, ShouldBeNil)
+		So(last, ShouldBeFalse)
+
+		So(refs.Removed(ctx, blob), ShouldBeNil)
+		So(docs.counter(blob), ShouldBeNil)
+
+		last, e = refs.Release(ctx, "ref-3", blob)
+		So(e, ShouldBeNil)
+		So(last, ShouldBeFalse)
+
+	})
+
+	Convey("Test concurrent references are all registered", t, func() {
+
+		docs := newMemoryDocStore()
+		errs := make(chan error, 20)
+		for i := 0; i < 20; i++ {
+			go func(i int) {
+				// Each reference uses its own store, like distinct processes
+				refs := &docStoreBlobRefs{client: docs}
+				errs <- refs.Retain(ctx, fmt.Sprintf("ref-%d", i), blob)
+			}(i)
+		}
+		for i := 0; i < 20; i++ {
+			So(<-errs, ShouldBeNil)
+		}
+		So(docs.counter(blob).Refs, ShouldHaveLength, 20)
+
+	})
+
+	Convey("Test a blob cannot be retained while it is being removed", t, func() {
+
+		defer func(wait time.Duration) { blobRefsWait = wait }(blobRefsWait)
+		blobRefsWait = time.Millisecond
+		docs := newMemoryDocStore()
+		refs := &docStoreBlobRefs{client: docs}
+		So(refs.Retain(ctx, "ref-1", blob), ShouldBeNil)
+		last, _ := refs.Release(ctx, "ref-1", blob)
+		So(last, ShouldBeTrue)
+
+		e := refs.Retain(ctx, "ref-2", blob)
+		So(e, ShouldNotBeNil)
+		So(errors.Parse(e.Error()).Code, ShouldEqual, 409)
+
+		go func() {
+			time.Sleep(5 * time.Millisecond)
+			refs.Removed(ctx, blob)
+		}()
+		So(refs.Retain(ctx, "ref-2", blob), ShouldBeNil)
+		So(docs.counter(blob).Refs, ShouldResemble, []string{"ref-2"})
+		So(docs.counter(blob).Removing, ShouldEqual, 0)
+
+	})
+
+	Convey("Test an abandoned removal is taken over", t, func() {
+
+		docs := newMemoryDocStore()
+		refs := &docStoreBlobRefs{client: docs}
+		data, _ := json.Marshal(&blobCounter{Removing: time.Now().Add(-2 * blobRemovalTimeout).Unix()})
+		docs.docs["ds:abcdef"] = &docstore.Document{ID: "ds:abcdef", Data: string(data)}
+
+		So(refs.Retain(ctx, "ref-1", blob), ShouldBeNil)
+		So(docs.counter(blob).Refs, ShouldResemble, []string{"ref-1"})
+		So(docs.counter(blob).Removing, ShouldEqual, 0)
+
+	})
+
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package views
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/micro/go-micro/errors"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/proto/encryption"
+	"github.com/pmker/yux/common/proto/object"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/idm/key"
+)
+
+// NodeKeySharer gives other users access to files stored in datasources encrypted with user keys.
+// Node keys are opened with the owner key, sealed again with each target user key, and stored
+// as shared keys by the data/key service.
+type NodeKeySharer struct {
+	Pool   *ClientsPool
+	Client encryption.NodeKeyManagerClient
+}
+
+// NewNodeKeySharer creates a NodeKeySharer using the default node key manager client.
+func NewNodeKeySharer(pool *ClientsPool) *NodeKeySharer {
+	return &NodeKeySharer{
+		Pool:   pool,
+		Client: encryption.NewNodeKeyManagerClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_ENC_KEY, defaults.NewClient()),
+	}
+}
+
+// Share seals the keys owned by @owner for all files under @roots with the keys of @targets users.
+// Roots living in clear or MASTER encrypted datasources are ignored.
+func (s *NodeKeySharer) Share(ctx context.Context, owner string, roots []*tree.Node, targets []string) error {
+	ownerTool := key.GetUserKeyTool(owner, nil)
+	targetTools := make(map[string]key.UserKeyTool)
+	for _, target := range targets {
+		if target != owner {
+			targetTools[target] = key.GetUserKeyTool(target, nil)
+		}
+	}
+	if len(targetTools) == 0 {
+		return nil
+	}
+
+	return s.walk(ctx, roots, func(source LoadedSource, node *tree.Node) error {
+		if source.EncryptionMode == object.EncryptionMode_USER_PWD {
+			return errors.BadRequest("views.NodeKeySharer", fmt.Sprintf("files of datasource %s are protected by their owner password and cannot be shared", source.Name))
+		}
+		rsp, err := s.Client.GetNodeKey(ctx, &encryption.GetNodeKeyRequest{NodeId: node.Uuid, UserId: owner})
+		if err != nil {
+			return err
+		}
+		if len(rsp.EncryptedKey) == 0 || rsp.OwnerId != owner {
+			// Only keys owned by the current user can be shared
+			return nil
+		}
+		plain, err := ownerTool.GetDecrypted(ctx, source.EncryptionKey, rsp.EncryptedKey)
+		if err != nil {
+			return err
+		}
+		for target, tool := range targetTools {
+			sealed, err := tool.GetEncrypted(ctx, source.EncryptionKey, plain)
+			if err != nil {
+				return err
+			}
+			// Replace any key previously shared with this user
+			if _, err := s.Client.DeleteNodeSharedKey(ctx, &encryption.DeleteNodeSharedKeyRequest{
+				NodeId:  node.Uuid,
+				OwnerId: owner,
+				Users:   []string{target},
+			}); err != nil {
+				return err
+			}
+			if _, err := s.Client.SetNodeKey(ctx, &encryption.SetNodeKeyRequest{Key: &encryption.NodeKey{
+				NodeId:    node.Uuid,
+				OwnerId:   owner,
+				UserId:    target,
+				Nonce:     rsp.Nonce,
+				BlockSize: rsp.BlockSize,
+				Data:      sealed,
+			}}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Unshare removes the keys shared by @owner with @targets users for all files under @roots.
+func (s *NodeKeySharer) Unshare(ctx context.Context, owner string, roots []*tree.Node, targets []string) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	return s.walk(ctx, roots, func(source LoadedSource, node *tree.Node) error {
+		_, err := s.Client.DeleteNodeSharedKey(ctx, &encryption.DeleteNodeSharedKeyRequest{
+			NodeId:  node.Uuid,
+			OwnerId: owner,
+			Users:   targets,
+		})
+		return err
+	})
+}
+
+// walk calls @callback for every file under @roots that lives in a datasource encrypted with user keys.
+func (s *NodeKeySharer) walk(ctx context.Context, roots []*tree.Node, callback func(source LoadedSource, node *tree.Node) error) error {
+	treeClient := s.Pool.GetTreeClient()
+	for _, root := range roots {
+		rsp, err := treeClient.ReadNode(ctx, &tree.ReadNodeRequest{Node: &tree.Node{Uuid: root.Uuid}})
+		if err != nil {
+			return err
+		}
+		node := rsp.Node
+		dsName := node.GetStringMeta(common.META_NAMESPACE_DATASOURCE_NAME)
+		if dsName == "" {
+			continue
+		}
+		source, err := s.Pool.GetDataSourceInfo(dsName)
+		if err != nil {
+			return err
+		}
+		if source.EncryptionMode != object.EncryptionMode_USER && source.EncryptionMode != object.EncryptionMode_USER_PWD {
+			continue
+		}
+		if node.IsLeaf() {
+			if err := callback(source, node); err != nil {
+				return err
+			}
+			continue
+		}
+		stream, err := treeClient.ListNodes(ctx, &tree.ListNodesRequest{Node: node, Recursive: true})
+		if err != nil {
+			return err
+		}
+		for {
+			resp, e := stream.Recv()
+			if e != nil {
+				break
+			}
+			if resp == nil || !resp.Node.IsLeaf() {
+				continue
+			}
+			if err := callback(source, resp.Node); err != nil {
+				stream.Close()
+				return err
+			}
+		}
+		stream.Close()
+	}
+	return nil
+}
@@ -22,6 +22,7 @@ package views
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"strconv"
 	"strings"
@@ -36,6 +37,7 @@ import (
 	"github.com/pmker/yux/common/auth/claim"
 	"github.com/pmker/yux/common/log"
 	"github.com/pmker/yux/common/proto/idm"
+	"github.com/pmker/yux/common/proto/quota"
 	"github.com/pmker/yux/common/proto/tree"
 	"github.com/pmker/yux/common/micro"
 	"github.com/pmker/yux/common/service/proto"
@@ -55,11 +57,31 @@ func (a *AclQuotaFilter) PutObject(ctx context.Context, node *tree.Node, reader
 		} else if maxQuota > 0 && currentUsage+requestData.Size > maxQuota {
 			return 0, errors.Forbidden(VIEWS_LIBRARY_NAME, "Quota is reached")
 		}
+		if err := a.CheckSubjectsQuota(ctx, &branchInfo, a.overwriteDelta(ctx, node, requestData.Size)); err != nil {
+			return 0, err
+		}
 	}
 
 	return a.next.PutObject(ctx, node, reader, requestData)
 }
 
+// MultipartCreate checks quota on MultipartCreate, if the total size of the upload is announced.
+func (a *AclQuotaFilter) MultipartCreate(ctx context.Context, target *tree.Node, requestData *MultipartRequestData) (string, error) {
+
+	if branchInfo, ok := GetBranchInfo(ctx, "in"); ok && !branchInfo.Binary && requestData.Size > 0 {
+		if maxQuota, currentUsage, err := a.ComputeQuota(ctx, &branchInfo.Workspace); err != nil {
+			return "", err
+		} else if maxQuota > 0 && currentUsage+requestData.Size > maxQuota {
+			return "", errors.Forbidden(VIEWS_LIBRARY_NAME, "Quota is reached")
+		}
+		if err := a.CheckSubjectsQuota(ctx, &branchInfo, a.overwriteDelta(ctx, target, requestData.Size)); err != nil {
+			return "", err
+		}
+	}
+
+	return a.next.MultipartCreate(ctx, target, requestData)
+}
+
 // MultipartPutObjectPart checks quota on MultipartPutObjectPart.
 func (a *AclQuotaFilter) MultipartPutObjectPart(ctx context.Context, target *tree.Node, uploadID string, partNumberMarker int, reader io.Reader, requestData *PutRequestData) (minio.ObjectPart, error) {
 
@@ -69,6 +91,9 @@ func (a *AclQuotaFilter) MultipartPutObjectPart(ctx context.Context, target *tre
 		} else if maxQuota > 0 && currentUsage+requestData.Size > maxQuota {
 			return minio.ObjectPart{}, errors.Forbidden(VIEWS_LIBRARY_NAME, "Quota is reached")
 		}
+		if err := a.CheckSubjectsQuota(ctx, &branchInfo, requestData.Size); err != nil {
+			return minio.ObjectPart{}, err
+		}
 	}
 
 	return a.next.MultipartPutObjectPart(ctx, target, uploadID, partNumberMarker, reader, requestData)
@@ -83,11 +108,57 @@ func (a *AclQuotaFilter) CopyObject(ctx context.Context, from *tree.Node, to *tr
 		} else if maxQuota > 0 && currentUsage+from.Size > maxQuota {
 			return 0, errors.Forbidden(VIEWS_LIBRARY_NAME, "Quota is reached")
 		}
+		if err := a.CheckSubjectsQuota(ctx, &branchInfo, a.overwriteDelta(ctx, to, from.Size)); err != nil {
+			return 0, err
+		}
 	}
 
 	return a.next.CopyObject(ctx, from, to, requestData)
 }
 
+// CheckSubjectsQuota verifies that writing size bytes does not exceed the quotas of the current user, of its groups
+// and of the target datasource, as accounted by the quota service. Writes that do not grow the usage are always
+// accepted. Writes are not blocked if this service is not running.
+func (a *AclQuotaFilter) CheckSubjectsQuota(ctx context.Context, branchInfo *BranchInfo, size int64) error {
+
+	if size <= 0 {
+		return nil
+	}
+
+	var login, groupPath string
+	if claims, ok := ctx.Value(claim.ContextKey).(claim.Claims); ok {
+		login, groupPath = claims.Name, claims.GroupPath
+	}
+	subjects := quota.SubjectsFor(login, groupPath, branchInfo.LoadedSource.Name)
+	if len(subjects) == 0 {
+		return nil
+	}
+
+	quotaClient := quota.NewQuotaServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_QUOTA, defaults.NewClient())
+	resp, err := quotaClient.GetUsage(ctx, &quota.GetUsageRequest{Subjects: subjects})
+	if err != nil {
+		log.Logger(ctx).Debug("cannot read quota usages, ignoring", zap.Error(err))
+		return nil
+	}
+	for _, usage := range resp.Usages {
+		if usage.Exceeds(size) {
+			log.Logger(ctx).Debug("Quota reached", zap.Any("usage", usage), zap.Int64("size", size))
+			return errors.Forbidden(VIEWS_LIBRARY_NAME, fmt.Sprintf("Quota is reached for %s %s", strings.ToLower(usage.Subject.Type.String()), usage.Subject.Id))
+		}
+	}
+	return nil
+}
+
+// overwriteDelta computes the usage growth of writing size bytes to target: an existing file is replaced, so only
+// the size difference is charged.
+func (a *AclQuotaFilter) overwriteDelta(ctx context.Context, target *tree.Node, size int64) int64 {
+	resp, err := a.next.ReadNode(ctx, &tree.ReadNodeRequest{Node: target})
+	if err != nil || resp.GetNode() == nil || !resp.Node.IsLeaf() {
+		return size
+	}
+	return size - resp.Node.Size
+}
+
 func (a *AclQuotaFilter) ComputeQuota(ctx context.Context, workspace *idm.Workspace) (quota int64, usage int64, err error) {
 
 	claims, ok := ctx.Value(claim.ContextKey).(claim.Claims)
@@ -0,0 +1,53 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+package views
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/proto/tree"
+)
+
+func TestAclQuotaFilter_OverwriteDelta(t *testing.T) {
+
+	Convey("Overwrites are only charged the size difference", t, func() {
+		mock := NewHandlerMock()
+		mock.Nodes["/ws/file.txt"] = &tree.Node{Path: "/ws/file.txt", Type: tree.NodeType_LEAF, Size: 100}
+		mock.Nodes["/ws/folder"] = &tree.Node{Path: "/ws/folder", Type: tree.NodeType_COLLECTION, Size: 1000}
+		filter := &AclQuotaFilter{}
+		filter.SetNextHandler(mock)
+		ctx := context.Background()
+
+		So(filter.overwriteDelta(ctx, &tree.Node{Path: "/ws/new.txt"}, 50), ShouldEqual, 50)
+		So(filter.overwriteDelta(ctx, &tree.Node{Path: "/ws/file.txt"}, 150), ShouldEqual, 50)
+		So(filter.overwriteDelta(ctx, &tree.Node{Path: "/ws/file.txt"}, 40), ShouldEqual, -60)
+		So(filter.overwriteDelta(ctx, &tree.Node{Path: "/ws/folder"}, 40), ShouldEqual, 40)
+	})
+
+	Convey("Writes that do not grow the usage are not checked", t, func() {
+		filter := &AclQuotaFilter{}
+		So(filter.CheckSubjectsQuota(context.Background(), &BranchInfo{}, 0), ShouldBeNil)
+		So(filter.CheckSubjectsQuota(context.Background(), &BranchInfo{}, -60), ShouldBeNil)
+	})
+
+}
@@ -42,50 +42,51 @@ type UploadLimitFilter struct {
 // Check Upload Limits (size, extension) defined in the frontend on PutObject operation
 func (a *UploadLimitFilter) PutObject(ctx context.Context, node *tree.Node, reader io.Reader, requestData *PutRequestData) (int64, error) {
 
-	size, exts := a.getUploadLimits()
-	if size > 0 && requestData.Size > size {
-		return 0, errors.Forbidden(VIEWS_LIBRARY_NAME, fmt.Sprintf("Upload limit is %d", size))
+	if e := a.checkUploadLimits(node, requestData.Size); e != nil {
+		return 0, e
 	}
-	if len(exts) > 0 {
-		// Beware, Ext function includes the leading dot
-		nodeExt := filepath.Ext(node.GetPath())
-		allowed := false
-		for _, e := range exts {
-			if "."+strings.ToLower(e) == strings.ToLower(nodeExt) {
-				allowed = true
-				break
-			}
-		}
-		if !allowed {
-			return 0, errors.Forbidden(VIEWS_LIBRARY_NAME, fmt.Sprintf("Extension %s is not allowed!", nodeExt))
-		}
-	}
-
 	return a.next.PutObject(ctx, node, reader, requestData)
 }
 
+// Check Upload Limits (size, extension) defined in the frontend on MultipartCreate, if the total size is announced
+func (a *UploadLimitFilter) MultipartCreate(ctx context.Context, target *tree.Node, requestData *MultipartRequestData) (string, error) {
+
+	if e := a.checkUploadLimits(target, requestData.Size); e != nil {
+		return "", e
+	}
+	return a.next.MultipartCreate(ctx, target, requestData)
+}
+
 // Check Upload Limits (size, extension) defined in the frontend on MultipartPutObjectPart
 func (a *UploadLimitFilter) MultipartPutObjectPart(ctx context.Context, target *tree.Node, uploadID string, partNumberMarker int, reader io.Reader, requestData *PutRequestData) (minio.ObjectPart, error) {
 
-	size, exts := a.getUploadLimits()
-	if size > 0 && requestData.Size > size {
-		return minio.ObjectPart{}, errors.Forbidden(VIEWS_LIBRARY_NAME, fmt.Sprintf("Upload limit is %d", size))
+	if e := a.checkUploadLimits(target, requestData.Size); e != nil {
+		return minio.ObjectPart{}, e
+	}
+	return a.next.MultipartPutObjectPart(ctx, target, uploadID, partNumberMarker, reader, requestData)
+}
+
+func (a *UploadLimitFilter) checkUploadLimits(node *tree.Node, size int64) error {
+
+	limit, exts := a.getUploadLimits()
+	if limit > 0 && size > limit {
+		return errors.Forbidden(VIEWS_LIBRARY_NAME, fmt.Sprintf("Upload limit is %d", limit))
 	}
 	if len(exts) > 0 {
-		nodeExt := filepath.Ext(target.GetPath())
+		// Beware, Ext function includes the leading dot
+		nodeExt := filepath.Ext(node.GetPath())
 		allowed := false
 		for _, e := range exts {
-			if strings.ToLower(e) == strings.ToLower(nodeExt) {
+			if "."+strings.ToLower(e) == strings.ToLower(nodeExt) {
 				allowed = true
 				break
 			}
 		}
 		if !allowed {
-			return minio.ObjectPart{}, errors.Forbidden(VIEWS_LIBRARY_NAME, fmt.Sprintf("Extension %s is not allowed!", nodeExt))
+			return errors.Forbidden(VIEWS_LIBRARY_NAME, fmt.Sprintf("Extension %s is not allowed!", nodeExt))
 		}
 	}
-
-	return a.next.MultipartPutObjectPart(ctx, target, uploadID, partNumberMarker, reader, requestData)
+	return nil
 }
 
 // Parse Upload Limits from config
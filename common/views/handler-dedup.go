@@ -0,0 +1,411 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package views
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/micro/go-micro/client"
+	"github.com/pborman/uuid"
+	"github.com/pydio/minio-go"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/proto/object"
+	"github.com/pmker/yux/common/proto/tree"
+	context2 "github.com/pmker/yux/common/utils/context"
+)
+
+// DedupHandler stores the content of files only once per datasource. It is enabled by setting
+// "dedup" to "true" in the StorageConfiguration of a non-encrypted datasource.
+//
+// Uploaded content is hashed and stored as a blob under the PYDIO_DEDUP_BLOBS_FOLDER of the datasource,
+// and a small reference object carrying the blob hash in its metadata is written at the node location.
+// Each reference is registered in a BlobRefStore: blobs are removed when their last reference is deleted,
+// be it a node or a version in the versions store. The store applies each change atomically, so that a blob
+// being removed by a process is never referenced meanwhile by another one.
+type DedupHandler struct {
+	AbstractHandler
+	Refs BlobRefStore
+}
+
+// GetObject reads the blob content if the node is a reference object.
+func (d *DedupHandler) GetObject(ctx context.Context, node *tree.Node, requestData *GetRequestData) (io.ReadCloser, error) {
+	info, ok := GetBranchInfo(ctx, "in")
+	if !ok || !d.mayHoldRefs(info) || strings.HasSuffix(node.Path, common.PYDIO_SYNC_HIDDEN_FILE_META) {
+		return d.next.GetObject(ctx, node, requestData)
+	}
+	stat, isRef := d.statRef(ctx, info, node)
+	if !isRef {
+		return d.next.GetObject(ctx, node, requestData)
+	}
+	blobCtx, blobNode, err := d.blobLocation(ctx, "in", d.refBlob(stat))
+	if err != nil {
+		return nil, err
+	}
+	log.Logger(ctx).Debug("[HANDLER DEDUP] Reading blob", zap.String("path", node.Path), zap.String("blob", blobNode.Path))
+	return d.next.GetObject(blobCtx, blobNode, requestData)
+}
+
+// PutObject stores the content as a blob, if it does not already exist, and writes a reference object at the node location.
+func (d *DedupHandler) PutObject(ctx context.Context, node *tree.Node, reader io.Reader, requestData *PutRequestData) (int64, error) {
+	info, ok := GetBranchInfo(ctx, "in")
+	if !ok || !d.dedupEnabled(info) || strings.HasSuffix(node.Path, common.PYDIO_SYNC_HIDDEN_FILE_META) {
+		return d.next.PutObject(ctx, node, reader, requestData)
+	}
+
+	hasher := sha256.New()
+	tmpNode := d.blobsNode("tmp/" + uuid.New())
+	written, err := d.next.PutObject(ctx, tmpNode, io.TeeReader(reader, hasher), &PutRequestData{
+		Size:      requestData.Size,
+		Md5Sum:    requestData.Md5Sum,
+		Sha256Sum: requestData.Sha256Sum,
+	})
+	tmpPath := d.s3Path(info, tmpNode)
+	defer func() {
+		if e := info.Client.RemoveObjectWithContext(ctx, info.ObjectsBucket, tmpPath); e != nil {
+			log.Logger(ctx).Error("Cannot remove temporary dedup object", zap.String("path", tmpPath), zap.Error(e))
+		}
+	}()
+	if err != nil {
+		return 0, err
+	}
+
+	blob := BlobRef{Source: info.Name, Hash: hex.EncodeToString(hasher.Sum(nil))}
+	previous, _ := d.statRef(ctx, info, node)
+	refId := uuid.New()
+	if err := d.retainBlob(ctx, refId, blob, func() error {
+		return d.storeBlob(ctx, info, tmpPath, blob)
+	}); err != nil {
+		return 0, err
+	}
+	if err := d.putRef(ctx, info, node, refId, blob, written, requestData.Metadata); err != nil {
+		d.releaseRef(ctx, refId, blob)
+		return 0, err
+	}
+	if previous != nil {
+		d.releaseRef(ctx, previous.Metadata.Get(common.X_AMZ_META_BLOB_REF), d.refBlob(previous))
+	}
+	log.Logger(ctx).Debug("[HANDLER DEDUP] Stored reference", zap.String("path", node.Path), zap.String("hash", blob.Hash), zap.Int64("size", written))
+	return written, nil
+}
+
+// CopyObject writes a new reference object at the target location when the source is a reference object.
+func (d *DedupHandler) CopyObject(ctx context.Context, from *tree.Node, to *tree.Node, requestData *CopyRequestData) (int64, error) {
+	srcInfo, ok := GetBranchInfo(ctx, "from")
+	destInfo, ok2 := GetBranchInfo(ctx, "to")
+	if !ok || !ok2 || !d.mayHoldRefs(srcInfo) {
+		return d.next.CopyObject(ctx, from, to, requestData)
+	}
+	stat, isRef := d.statRef(ctx, srcInfo, from)
+	if !isRef {
+		return d.next.CopyObject(ctx, from, to, requestData)
+	}
+	blob := d.refBlob(stat)
+	size, _ := strconv.ParseInt(stat.Metadata.Get(common.X_AMZ_META_CLEAR_SIZE), 10, 64)
+	destCtx := WithBranchInfo(ctx, "in", destInfo)
+
+	if !d.mayHoldRefs(destInfo) {
+		// Target cannot resolve references: copy the actual content
+		blobCtx, blobNode, err := d.blobLocation(ctx, "in", blob)
+		if err != nil {
+			return 0, err
+		}
+		reader, err := d.next.GetObject(blobCtx, blobNode, &GetRequestData{Length: -1})
+		if err != nil {
+			return 0, err
+		}
+		defer reader.Close()
+		return d.next.PutObject(destCtx, to, reader, &PutRequestData{Size: size, Metadata: requestData.Metadata})
+	}
+
+	meta := make(map[string]string)
+	for k, values := range stat.Metadata {
+		if strings.HasPrefix(http.CanonicalHeaderKey(k), "X-Amz-Meta-") && len(values) > 0 {
+			meta[http.CanonicalHeaderKey(k)] = values[0]
+		}
+	}
+	for k, v := range requestData.Metadata {
+		meta[k] = v
+	}
+	refId := uuid.New()
+	if err := d.retainBlob(ctx, refId, blob, func() error {
+		return d.checkBlob(ctx, blob)
+	}); err != nil {
+		return 0, err
+	}
+	previous, _ := d.statRef(ctx, destInfo, to)
+	if err := d.putRef(destCtx, destInfo, to, refId, blob, size, meta); err != nil {
+		d.releaseRef(ctx, refId, blob)
+		return 0, err
+	}
+	if previous != nil {
+		d.releaseRef(ctx, previous.Metadata.Get(common.X_AMZ_META_BLOB_REF), d.refBlob(previous))
+	}
+	log.Logger(ctx).Debug("[HANDLER DEDUP] Copied reference", zap.String("from", from.Path), zap.String("to", to.Path), zap.String("hash", blob.Hash))
+	return size, nil
+}
+
+// DeleteNode removes the reference object, and the blob if it was its last reference.
+func (d *DedupHandler) DeleteNode(ctx context.Context, in *tree.DeleteNodeRequest, opts ...client.CallOption) (*tree.DeleteNodeResponse, error) {
+	info, ok := GetBranchInfo(ctx, "in")
+	if !ok || !d.mayHoldRefs(info) {
+		return d.next.DeleteNode(ctx, in, opts...)
+	}
+	stat, isRef := d.statRef(ctx, info, in.Node)
+	resp, err := d.next.DeleteNode(ctx, in, opts...)
+	if err == nil && isRef {
+		d.releaseRef(ctx, stat.Metadata.Get(common.X_AMZ_META_BLOB_REF), d.refBlob(stat))
+	}
+	return resp, err
+}
+
+// MultipartComplete replaces the assembled object with a reference object once the upload is completed.
+func (d *DedupHandler) MultipartComplete(ctx context.Context, target *tree.Node, uploadID string, uploadedParts []minio.CompletePart) (minio.ObjectInfo, error) {
+	oi, err := d.next.MultipartComplete(ctx, target, uploadID, uploadedParts)
+	info, ok := GetBranchInfo(ctx, "in")
+	if err != nil || !ok || !d.dedupEnabled(info) {
+		return oi, err
+	}
+	if e := d.dedupObject(ctx, info, target); e != nil {
+		// Object is still stored as is, just log the error
+		log.Logger(ctx).Error("Cannot deduplicate object after multipart upload", zap.String("path", target.Path), zap.Error(e))
+	}
+	return oi, nil
+}
+
+// dedupObject hashes an existing object and replaces it with a reference object.
+func (d *DedupHandler) dedupObject(ctx context.Context, info BranchInfo, node *tree.Node) error {
+	objectPath := d.s3Path(info, node)
+	stat, err := info.Client.StatObject(info.ObjectsBucket, objectPath, d.statOptions(ctx))
+	if err != nil {
+		return err
+	}
+	reader, err := info.Client.GetObjectWithContext(ctx, info.ObjectsBucket, objectPath, minio.GetObjectOptions{})
+	if err != nil {
+		return err
+	}
+	hasher := sha256.New()
+	_, err = io.Copy(hasher, reader)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+
+	blob := BlobRef{Source: info.Name, Hash: hex.EncodeToString(hasher.Sum(nil))}
+	refId := uuid.New()
+	if err := d.retainBlob(ctx, refId, blob, func() error {
+		return d.storeBlob(ctx, info, objectPath, blob)
+	}); err != nil {
+		return err
+	}
+	meta := make(map[string]string)
+	for k, values := range stat.Metadata {
+		if strings.HasPrefix(http.CanonicalHeaderKey(k), "X-Amz-Meta-") && len(values) > 0 {
+			meta[http.CanonicalHeaderKey(k)] = values[0]
+		}
+	}
+	if err := d.putRef(ctx, info, node, refId, blob, stat.Size, meta); err != nil {
+		d.releaseRef(ctx, refId, blob)
+		return err
+	}
+	return nil
+}
+
+// storeBlob copies the object at sourcePath to the blob location, unless the blob already exists.
+// Blobs are always stored in the main bucket of their datasource.
+func (d *DedupHandler) storeBlob(ctx context.Context, info BranchInfo, sourcePath string, blob BlobRef) error {
+	source, err := d.clientsPool.GetDataSourceInfo(blob.Source)
+	if err != nil {
+		return err
+	}
+	blobPath := d.s3Path(BranchInfo{LoadedSource: source}, d.blobsNode(d.blobKey(blob.Hash)))
+	if _, e := source.Client.StatObject(source.ObjectsBucket, blobPath, minio.StatObjectOptions{}); e == nil {
+		log.Logger(ctx).Debug("[HANDLER DEDUP] Blob already exists", zap.String("hash", blob.Hash))
+		return nil
+	}
+	_, err = info.Client.CopyObject(info.ObjectsBucket, sourcePath, source.ObjectsBucket, blobPath, nil)
+	return err
+}
+
+// checkBlob makes sure that a blob exists.
+func (d *DedupHandler) checkBlob(ctx context.Context, blob BlobRef) error {
+	source, err := d.clientsPool.GetDataSourceInfo(blob.Source)
+	if err != nil {
+		return err
+	}
+	blobPath := d.s3Path(BranchInfo{LoadedSource: source}, d.blobsNode(d.blobKey(blob.Hash)))
+	_, err = source.Client.StatObject(source.ObjectsBucket, blobPath, minio.StatObjectOptions{})
+	return err
+}
+
+// putRef writes a reference object to the given blob at the node location.
+func (d *DedupHandler) putRef(ctx context.Context, info BranchInfo, node *tree.Node, refId string, blob BlobRef, size int64, metadata map[string]string) error {
+	meta := make(map[string]string, len(metadata)+4)
+	for k, v := range metadata {
+		meta[k] = v
+	}
+	meta[common.X_AMZ_META_BLOB_HASH] = blob.Hash
+	meta[common.X_AMZ_META_BLOB_SOURCE] = blob.Source
+	meta[common.X_AMZ_META_BLOB_REF] = refId
+	meta[common.X_AMZ_META_CLEAR_SIZE] = fmt.Sprintf("%d", size)
+	_, err := d.next.PutObject(WithBranchInfo(ctx, "in", info), node, strings.NewReader(blob.Hash), &PutRequestData{
+		Size:     int64(len(blob.Hash)),
+		Metadata: meta,
+	})
+	return err
+}
+
+// retainBlob registers a new reference to a blob, and calls store to make sure that the blob exists.
+// The reference is removed if store fails.
+func (d *DedupHandler) retainBlob(ctx context.Context, refId string, blob BlobRef, store func() error) error {
+	if err := d.refs().Retain(ctx, refId, blob); err != nil {
+		return err
+	}
+	if err := store(); err != nil {
+		// The blob was not stored, there is nothing to remove
+		d.dropRef(ctx, refId, blob, func() error { return nil })
+		return err
+	}
+	return nil
+}
+
+// releaseRef unregisters a reference and removes the blob if it has no more references.
+func (d *DedupHandler) releaseRef(ctx context.Context, refId string, blob BlobRef) {
+	d.dropRef(ctx, refId, blob, func() error {
+		blobCtx, blobNode, e := d.blobLocation(ctx, "in", blob)
+		if e != nil {
+			return e
+		}
+		_, e = d.next.DeleteNode(blobCtx, &tree.DeleteNodeRequest{Node: blobNode})
+		return e
+	})
+}
+
+// dropRef unregisters a reference and calls remove if it was the last reference of the blob. The blob cannot be
+// referenced again until it is marked as removed in the store.
+func (d *DedupHandler) dropRef(ctx context.Context, refId string, blob BlobRef, remove func() error) {
+	last, e := d.refs().Release(ctx, refId, blob)
+	if e != nil {
+		log.Logger(ctx).Error("Cannot remove blob reference", zap.String("ref", refId), zap.Error(e))
+		return
+	}
+	if !last {
+		return
+	}
+	if e := remove(); e != nil {
+		log.Logger(ctx).Error("Cannot remove unreferenced blob", zap.String("hash", blob.Hash), zap.Error(e))
+	} else {
+		log.Logger(ctx).Debug("[HANDLER DEDUP] Removed unreferenced blob", zap.String("hash", blob.Hash))
+	}
+	if e := d.refs().Removed(ctx, blob); e != nil {
+		log.Logger(ctx).Error("Cannot clear removed blob", zap.String("hash", blob.Hash), zap.Error(e))
+	}
+}
+
+// statRef stats the object at the node location and tells if it is a reference object.
+func (d *DedupHandler) statRef(ctx context.Context, info BranchInfo, node *tree.Node) (*minio.ObjectInfo, bool) {
+	if info.Client == nil {
+		return nil, false
+	}
+	stat, err := info.Client.StatObject(info.ObjectsBucket, d.s3Path(info, node), d.statOptions(ctx))
+	if err != nil || stat.Metadata.Get(common.X_AMZ_META_BLOB_HASH) == "" {
+		return nil, false
+	}
+	return &stat, true
+}
+
+// blobLocation prepares a context and a node to access a blob in its datasource.
+func (d *DedupHandler) blobLocation(ctx context.Context, identifier string, blob BlobRef) (context.Context, *tree.Node, error) {
+	source, err := d.clientsPool.GetDataSourceInfo(blob.Source)
+	if err != nil {
+		return ctx, nil, err
+	}
+	return WithBranchInfo(ctx, identifier, BranchInfo{LoadedSource: source}), d.blobsNode(d.blobKey(blob.Hash)), nil
+}
+
+func (d *DedupHandler) refBlob(stat *minio.ObjectInfo) BlobRef {
+	return BlobRef{
+		Source: stat.Metadata.Get(common.X_AMZ_META_BLOB_SOURCE),
+		Hash:   stat.Metadata.Get(common.X_AMZ_META_BLOB_HASH),
+	}
+}
+
+// blobsNode builds a node pointing to a key inside the blobs folder of a datasource.
+func (d *DedupHandler) blobsNode(key string) *tree.Node {
+	node := &tree.Node{Path: common.PYDIO_DEDUP_BLOBS_FOLDER + "/" + key}
+	node.SetMeta(common.META_NAMESPACE_DATASOURCE_PATH, node.Path)
+	return node
+}
+
+// blobKey spreads blobs in sub-folders named after the first bytes of their hash.
+func (d *DedupHandler) blobKey(hash string) string {
+	if len(hash) < 2 {
+		return hash
+	}
+	return hash[:2] + "/" + hash
+}
+
+func (d *DedupHandler) s3Path(info BranchInfo, node *tree.Node) string {
+	return (&Executor{}).buildS3Path(info, node)
+}
+
+func (d *DedupHandler) statOptions(ctx context.Context) minio.StatObjectOptions {
+	opts := minio.StatObjectOptions{}
+	if meta, ok := context2.MinioMetaFromContext(ctx); ok {
+		for k, v := range meta {
+			opts.Set(k, v)
+		}
+	}
+	return opts
+}
+
+func (d *DedupHandler) dedupEnabled(info BranchInfo) bool {
+	return info.StorageConfiguration["dedup"] == "true" && info.EncryptionMode == object.EncryptionMode_CLEAR
+}
+
+// mayHoldRefs tells if a datasource may contain reference objects: versions of deduplicated
+// nodes are stored as references in the versions store.
+func (d *DedupHandler) mayHoldRefs(info BranchInfo) bool {
+	if d.dedupEnabled(info) {
+		return true
+	}
+	if d.clientsPool == nil {
+		return false
+	}
+	alias, ok := d.clientsPool.aliases[common.PYDIO_VERSIONS_NAMESPACE]
+	return ok && alias.dataSource == info.Name && alias.bucket == info.ObjectsBucket
+}
+
+func (d *DedupHandler) refs() BlobRefStore {
+	if d.Refs == nil {
+		d.Refs = NewDocStoreBlobRefs()
+	}
+	return d.Refs
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package views
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/proto/object"
+	"github.com/pmker/yux/common/proto/tree"
+)
+
+func newDedupBranchInfo(name string, dedup bool, mode object.EncryptionMode) BranchInfo {
+	info := BranchInfo{}
+	info.Name = name
+	info.EncryptionMode = mode
+	info.StorageConfiguration = map[string]string{}
+	if dedup {
+		info.StorageConfiguration["dedup"] = "true"
+	}
+	return info
+}
+
+func TestDedupHandler_Enabled(t *testing.T) {
+
+	Convey("Test datasources accepting deduplication", t, func() {
+
+		handler := &DedupHandler{}
+		So(handler.dedupEnabled(newDedupBranchInfo("ds", true, object.EncryptionMode_CLEAR)), ShouldBeTrue)
+		So(handler.dedupEnabled(newDedupBranchInfo("ds", false, object.EncryptionMode_CLEAR)), ShouldBeFalse)
+		So(handler.dedupEnabled(newDedupBranchInfo("ds", true, object.EncryptionMode_MASTER)), ShouldBeFalse)
+
+		So(handler.mayHoldRefs(newDedupBranchInfo("ds", false, object.EncryptionMode_CLEAR)), ShouldBeFalse)
+
+		IsUnitTestEnv = true
+		pool := NewClientsPool(false)
+		pool.aliases[common.PYDIO_VERSIONS_NAMESPACE] = sourceAlias{dataSource: "ds", bucket: "versions"}
+		handler.SetClientsPool(pool)
+		versions := newDedupBranchInfo("ds", false, object.EncryptionMode_CLEAR)
+		versions.ObjectsBucket = "versions"
+		So(handler.mayHoldRefs(versions), ShouldBeTrue)
+		So(handler.mayHoldRefs(newDedupBranchInfo("ds", false, object.EncryptionMode_CLEAR)), ShouldBeFalse)
+
+	})
+
+	Convey("Test blobs location", t, func() {
+
+		handler := &DedupHandler{}
+		node := handler.blobsNode(handler.blobKey("abcdef"))
+		So(node.Path, ShouldEqual, common.PYDIO_DEDUP_BLOBS_FOLDER+"/ab/abcdef")
+		So(node.GetStringMeta(common.META_NAMESPACE_DATASOURCE_PATH), ShouldEqual, node.Path)
+
+	})
+
+}
+
+func TestDedupHandler_Passthrough(t *testing.T) {
+
+	handler := &DedupHandler{}
+	mock := NewHandlerMock()
+	handler.SetNextHandler(mock)
+
+	Convey("Test Put Object without dedup", t, func() {
+
+		ctx := WithBranchInfo(context.Background(), "in", newDedupBranchInfo("ds", false, object.EncryptionMode_CLEAR))
+		_, e := handler.PutObject(ctx, &tree.Node{Path: "test"}, strings.NewReader("content"), &PutRequestData{})
+		So(e, ShouldBeNil)
+		So(mock.Nodes["in"], ShouldNotBeNil)
+		So(mock.Nodes["in"].Path, ShouldEqual, "test")
+
+	})
+
+	Convey("Test hidden files are never deduplicated", t, func() {
+
+		ctx := WithBranchInfo(context.Background(), "in", newDedupBranchInfo("ds", true, object.EncryptionMode_CLEAR))
+		_, e := handler.PutObject(ctx, &tree.Node{Path: "folder/" + common.PYDIO_SYNC_HIDDEN_FILE_META}, strings.NewReader("uuid"), &PutRequestData{})
+		So(e, ShouldBeNil)
+		So(mock.Nodes["in"].Path, ShouldEqual, "folder/"+common.PYDIO_SYNC_HIDDEN_FILE_META)
+
+	})
+
+	Convey("Test Get Object without reference", t, func() {
+
+		mock.Nodes["test"] = &tree.Node{Path: "test"}
+		ctx := WithBranchInfo(context.Background(), "in", newDedupBranchInfo("ds", true, object.EncryptionMode_CLEAR))
+		reader, e := handler.GetObject(ctx, &tree.Node{Path: "test"}, &GetRequestData{})
+		So(e, ShouldBeNil)
+		So(reader, ShouldNotBeNil)
+		So(mock.Nodes["in"].Path, ShouldEqual, "test")
+
+	})
+
+}
+
+func TestDedupHandler_ConcurrentRefs(t *testing.T) {
+
+	Convey("Test blobs are never removed while referenced by another process", t, func() {
+
+		defer func(wait time.Duration) { blobRefsWait = wait }(blobRefsWait)
+		blobRefsWait = time.Millisecond
+		docs := newMemoryDocStore()
+		handler := &DedupHandler{Refs: &docStoreBlobRefs{client: docs}}
+		other := &DedupHandler{Refs: &docStoreBlobRefs{client: docs}}
+		blob := BlobRef{Source: "ds", Hash: "abcdef"}
+		ctx := context.Background()
+
+		var storage sync.Mutex
+		exists := false
+		store := func() error {
+			storage.Lock()
+			defer storage.Unlock()
+			exists = true
+			return nil
+		}
+		remove := func() error {
+			// Leave room for a concurrent put between the release and the removal
+			time.Sleep(5 * time.Millisecond)
+			storage.Lock()
+			defer storage.Unlock()
+			exists = false
+			return nil
+		}
+
+		So(handler.retainBlob(ctx, "ref-1", blob, store), ShouldBeNil)
+		dropped := make(chan struct{})
+		go func() {
+			handler.dropRef(ctx, "ref-1", blob, remove)
+			close(dropped)
+		}()
+		// Put the same content while the blob is being removed
+		time.Sleep(time.Millisecond)
+		So(other.retainBlob(ctx, "ref-2", blob, store), ShouldBeNil)
+		<-dropped
+		So(exists, ShouldBeTrue)
+
+		other.dropRef(ctx, "ref-2", blob, remove)
+		So(exists, ShouldBeFalse)
+		So(docs.docs, ShouldBeEmpty)
+
+	})
+
+	Convey("Test references are removed when the blob cannot be stored", t, func() {
+
+		docs := newMemoryDocStore()
+		handler := &DedupHandler{Refs: &docStoreBlobRefs{client: docs}}
+		blob := BlobRef{Source: "ds", Hash: "abcdef"}
+		e := handler.retainBlob(context.Background(), "ref-1", blob, func() error {
+			return fmt.Errorf("cannot store")
+		})
+		So(e, ShouldNotBeNil)
+		So(docs.docs, ShouldBeEmpty)
+
+	})
+
+}
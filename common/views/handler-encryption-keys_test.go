@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package views
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micro/go-micro/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/auth/claim"
+	"github.com/pmker/yux/common/proto/encryption"
+	"github.com/pmker/yux/common/proto/object"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/idm/key"
+)
+
+func TestEncryptionHandler_KeyTool(t *testing.T) {
+
+	handler := &EncryptionHandler{}
+	newInfo := func(mode object.EncryptionMode) BranchInfo {
+		info := BranchInfo{}
+		info.EncryptionMode = mode
+		return info
+	}
+	userCtx := context.WithValue(context.Background(), claim.ContextKey, claim.Claims{Name: "alice"})
+
+	Convey("Test encrypted modes", t, func() {
+		So(encryptionEnabled(newInfo(object.EncryptionMode_CLEAR)), ShouldBeFalse)
+		So(encryptionEnabled(newInfo(object.EncryptionMode_MASTER)), ShouldBeTrue)
+		So(encryptionEnabled(newInfo(object.EncryptionMode_USER)), ShouldBeTrue)
+		So(encryptionEnabled(newInfo(object.EncryptionMode_USER_PWD)), ShouldBeTrue)
+	})
+
+	Convey("Test keys owner in MASTER mode", t, func() {
+		tool, owner, e := handler.keyTool(userCtx, newInfo(object.EncryptionMode_MASTER), "pydiods1")
+		So(e, ShouldBeNil)
+		So(tool, ShouldNotBeNil)
+		So(owner, ShouldEqual, "ds:pydiods1")
+	})
+
+	Convey("Test keys owner in USER mode", t, func() {
+		tool, owner, e := handler.keyTool(userCtx, newInfo(object.EncryptionMode_USER), "pydiods1")
+		So(e, ShouldBeNil)
+		So(tool, ShouldNotBeNil)
+		So(owner, ShouldEqual, "alice")
+
+		_, _, e = handler.keyTool(context.Background(), newInfo(object.EncryptionMode_USER), "pydiods1")
+		So(e, ShouldNotBeNil)
+		So(errors.Parse(e.Error()).Code, ShouldEqual, 403)
+	})
+
+	Convey("Test USER_PWD mode requires a password", t, func() {
+		_, _, e := handler.keyTool(userCtx, newInfo(object.EncryptionMode_USER_PWD), "pydiods1")
+		So(e, ShouldNotBeNil)
+		So(errors.Parse(e.Error()).Code, ShouldEqual, 401)
+
+		tool, owner, e := handler.keyTool(key.WithPassword(userCtx, []byte("secret")), newInfo(object.EncryptionMode_USER_PWD), "pydiods1")
+		So(e, ShouldBeNil)
+		So(tool, ShouldNotBeNil)
+		So(owner, ShouldEqual, "alice")
+	})
+
+	Convey("Test system flows use the key of the node owner", t, func() {
+		So(isSystemContext(context.Background()), ShouldBeTrue)
+		So(isSystemContext(context.WithValue(context.Background(), claim.ContextKey, claim.Claims{Name: common.PYDIO_SYSTEM_USERNAME})), ShouldBeTrue)
+		So(isSystemContext(userCtx), ShouldBeFalse)
+
+		ownerKey := &encryption.NodeKey{OwnerId: "alice", UserId: "alice", Data: []byte("sealed")}
+		tool, e := handler.ownerKeyTool(context.Background(), newInfo(object.EncryptionMode_USER), "pydiods1", ownerKey)
+		So(e, ShouldBeNil)
+		So(tool, ShouldNotBeNil)
+
+		_, e = handler.ownerKeyTool(context.Background(), newInfo(object.EncryptionMode_USER_PWD), "pydiods1", ownerKey)
+		So(e, ShouldNotBeNil)
+		So(errors.Parse(e.Error()).Code, ShouldEqual, 403)
+	})
+
+	Convey("Test writers cannot open the key of another user in USER_PWD mode", t, func() {
+		ownerKey := &encryption.NodeKey{OwnerId: "alice", UserId: "alice", Data: []byte("sealed")}
+		node := &tree.Node{Uuid: "node-uuid"}
+		_, e := handler.addWriterEncryptionKey(userCtx, node, newInfo(object.EncryptionMode_USER_PWD), ownerKey, nil, "bob")
+		So(e, ShouldNotBeNil)
+		So(errors.Parse(e.Error()).Code, ShouldEqual, 403)
+	})
+
+}
@@ -37,6 +37,7 @@ import (
 	"github.com/pmker/yux/common/proto/encryption"
 	"github.com/pmker/yux/common/proto/object"
 	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/utils"
 	"github.com/pmker/yux/idm/key"
 )
 
@@ -53,7 +54,7 @@ func (e *EncryptionHandler) GetObject(ctx context.Context, node *tree.Node, requ
 	}
 
 	info, ok := GetBranchInfo(ctx, "in")
-	if ok && info.EncryptionMode == object.EncryptionMode_MASTER {
+	if ok && encryptionEnabled(info) {
 		clone := node.Clone()
 		log.Logger(ctx).Debug("[HANDLER ENCRYPT] > Get Object", zap.String("UUID", node.Uuid), zap.String("Path", node.Path))
 
@@ -77,20 +78,36 @@ func (e *EncryptionHandler) GetObject(ctx context.Context, node *tree.Node, requ
 			dsName = info.Root.GetStringMeta(common.META_NAMESPACE_DATASOURCE_NAME)
 		}
 
-		requestData.Length = -1
-
 		clone.SetMeta(common.META_NAMESPACE_DATASOURCE_NAME, dsName)
 		var err error
-		eMat, err := e.retrieveEncryptionMaterials(ctx, clone, info.EncryptionKey, false)
+		eMat, err := e.retrieveEncryptionMaterials(ctx, clone, info, false)
 		if err != nil {
 			return nil, err
 		}
+
+		// For range requests, only fetch and decrypt the encrypted blocks covering the range
+		offset, length := requestData.StartOffset, requestData.Length
+		ranged := offset > 0 || length > 0
+		if ranged {
+			if length <= 0 {
+				length = -1
+			}
+			requestData.StartOffset, requestData.Length = eMat.EncryptedRange(offset, length)
+		} else {
+			requestData.Length = -1
+		}
+
 		reader, err := e.next.GetObject(ctx, clone, requestData)
 		if err != nil {
 			return nil, err
 		}
-		err = eMat.SetupDecryptMode(reader, eMat.GetIV(), eMat.GetKey())
+		if ranged {
+			err = eMat.SetupDecryptRangeMode(reader, offset, length)
+		} else {
+			err = eMat.SetupDecryptMode(reader, eMat.GetIV(), eMat.GetKey())
+		}
 		if err != nil {
+			reader.Close()
 			return nil, err
 		}
 		return eMat, nil
@@ -108,7 +125,7 @@ func (e *EncryptionHandler) PutObject(ctx context.Context, node *tree.Node, read
 
 	info, ok := GetBranchInfo(ctx, "in")
 	var err error
-	if !ok || info.EncryptionMode != object.EncryptionMode_MASTER {
+	if !ok || !encryptionEnabled(info) {
 		return e.next.PutObject(ctx, node, reader, requestData)
 	}
 
@@ -136,7 +153,7 @@ func (e *EncryptionHandler) PutObject(ctx context.Context, node *tree.Node, read
 
 	clone.SetMeta(common.META_NAMESPACE_DATASOURCE_NAME, dsName)
 
-	eMaterial, err := e.retrieveEncryptionMaterials(ctx, clone, info.EncryptionKey, true)
+	eMaterial, err := e.retrieveEncryptionMaterials(ctx, clone, info, true)
 	if err != nil {
 		return 0, err
 	}
@@ -168,7 +185,7 @@ func (e *EncryptionHandler) PutObject(ctx context.Context, node *tree.Node, read
 // CopyObject Enriches request metadata for CopyObject with Encryption Materials, if required by datasource
 func (e *EncryptionHandler) CopyObject(ctx context.Context, from *tree.Node, to *tree.Node, requestData *CopyRequestData) (int64, error) {
 	info, ok := GetBranchInfo(ctx, "in")
-	if !ok || info.EncryptionMode != object.EncryptionMode_MASTER {
+	if !ok || !encryptionEnabled(info) {
 		return e.next.CopyObject(ctx, from, to, requestData)
 	}
 
@@ -199,7 +216,7 @@ func (e *EncryptionHandler) CopyObject(ctx context.Context, from *tree.Node, to
 
 	cloneFrom.SetMeta(common.META_NAMESPACE_DATASOURCE_NAME, dsName)
 	cloneTo.SetMeta(common.META_NAMESPACE_DATASOURCE_NAME, dsName)
-	err := e.copyEncryptionMaterials(ctx, from, to)
+	err := e.copyEncryptionMaterials(ctx, info, cloneFrom, cloneTo)
 	if err != nil {
 		return 0, err
 	}
@@ -209,7 +226,7 @@ func (e *EncryptionHandler) CopyObject(ctx context.Context, from *tree.Node, to
 
 func (e *EncryptionHandler) MultipartPutObjectPart(ctx context.Context, target *tree.Node, uploadID string, partNumberMarker int, reader io.Reader, requestData *PutRequestData) (minio.ObjectPart, error) {
 	info, ok := GetBranchInfo(ctx, "in")
-	if ok && info.EncryptionMode == object.EncryptionMode_MASTER {
+	if ok && encryptionEnabled(info) {
 		return minio.ObjectPart{}, errors.BadRequest("handler.encryption.putObjectPart", "Encryption is not supported for multipart uploads")
 	}
 	return e.next.MultipartPutObjectPart(ctx, target, uploadID, partNumberMarker, reader, requestData)
@@ -249,16 +266,74 @@ func (e *EncryptionHandler) setNodeEncryptionParams(ctx context.Context, node *t
 	return err
 }
 
-func (e *EncryptionHandler) retrieveEncryptionMaterials(ctx context.Context, node *tree.Node, encryptionKeyName string, encrypt bool) (*crypto.AESGCMMaterials, error) {
+// encryptionEnabled checks if objects of this branch datasource must be encrypted.
+func encryptionEnabled(info BranchInfo) bool {
+	switch info.EncryptionMode {
+	case object.EncryptionMode_MASTER, object.EncryptionMode_USER, object.EncryptionMode_USER_PWD:
+		return true
+	default:
+		return false
+	}
+}
+
+// keyTool finds the tool sealing node keys for this branch, and the identifier node keys are stored for:
+// the datasource in MASTER mode, the current user in USER and USER_PWD modes.
+func (e *EncryptionHandler) keyTool(ctx context.Context, info BranchInfo, dsName string) (key.UserKeyTool, string, error) {
+
+	if !userKeysEnabled(info) {
+		tool, err := key.MasterKeyTool(ctx)
+		return tool, fmt.Sprintf("ds:%s", dsName), err
+	}
+
+	if isSystemContext(ctx) {
+		return nil, "", errors.Forbidden("views.Handler.encryption", fmt.Sprintf("datasource %s is encrypted with user keys, a user is required", dsName))
+	}
+	userName, _ := utils.FindUserNameInContext(ctx)
+
+	var pass []byte
+	if info.EncryptionMode == object.EncryptionMode_USER_PWD {
+		var ok bool
+		if pass, ok = key.PasswordFromContext(ctx); !ok {
+			return nil, "", errors.Unauthorized("views.Handler.encryption", fmt.Sprintf("datasource %s requires your password to unlock your key", dsName))
+		}
+	}
+	return key.GetUserKeyTool(userName, pass), userName, nil
+}
+
+// userKeysEnabled tells if node keys of this branch are sealed with the keys of their users.
+func userKeysEnabled(info BranchInfo) bool {
+	return info.EncryptionMode == object.EncryptionMode_USER || info.EncryptionMode == object.EncryptionMode_USER_PWD
+}
+
+// isSystemContext tells if the request is not run on behalf of a user (versioning, thumbnails, indexing...).
+func isSystemContext(ctx context.Context) bool {
+	userName, _ := utils.FindUserNameInContext(ctx)
+	return userName == "" || userName == common.PYDIO_SYSTEM_USERNAME
+}
+
+// ownerKeyTool opens the key of the node owner without any user password. It is used by system flows, and only
+// in USER mode, where user keys are sealed with the master password. Keys of USER_PWD datasources can only be
+// opened with the password of their owner: system flows cannot read or write their content.
+func (e *EncryptionHandler) ownerKeyTool(ctx context.Context, info BranchInfo, dsName string, nodeKey *encryption.NodeKey) (key.UserKeyTool, error) {
+	if info.EncryptionMode == object.EncryptionMode_USER_PWD {
+		return nil, errors.Forbidden("views.Handler.encryption", fmt.Sprintf("datasource %s is encrypted with user passwords, its content is only available to users", dsName))
+	}
+	return key.GetUserKeyTool(nodeKey.OwnerId, nil), nil
+}
+
+func (e *EncryptionHandler) retrieveEncryptionMaterials(ctx context.Context, node *tree.Node, info BranchInfo, encrypt bool) (*crypto.AESGCMMaterials, error) {
 
 	dsName := node.GetStringMeta(common.META_NAMESPACE_DATASOURCE_NAME)
-	tool, err := key.MasterKeyTool(ctx)
+	if userKeysEnabled(info) && isSystemContext(ctx) {
+		return e.ownerEncryptionMaterials(ctx, node, info, encrypt)
+	}
+
+	tool, keyOwner, err := e.keyTool(ctx, info, dsName)
 	if err != nil {
 		return nil, err
 	}
 
-	var wsUser = fmt.Sprintf("ds:%s", dsName)
-	nodeKey, err := e.getNodeEncryptionKey(ctx, wsUser, node.Uuid)
+	nodeKey, err := e.getNodeEncryptionKey(ctx, keyOwner, node.Uuid)
 	if err != nil {
 		return nil, err
 	}
@@ -266,23 +341,37 @@ func (e *EncryptionHandler) retrieveEncryptionMaterials(ctx context.Context, nod
 	if nodeKey.Data == nil || len(nodeKey.Data) == 0 {
 		//if not found
 
+		if userKeysEnabled(info) {
+			if !encrypt {
+				return nil, errors.Forbidden("views.Handler.encryption", fmt.Sprintf("no encryption key is shared with %s for this node", keyOwner))
+			}
+			// Other users may hold the key of this node: reuse it, so that their keys still open the new content
+			ownerKey, err := e.getNodeEncryptionKey(ctx, "", node.Uuid)
+			if err != nil {
+				return nil, err
+			}
+			if len(ownerKey.Data) > 0 {
+				return e.addWriterEncryptionKey(ctx, node, info, ownerKey, tool, keyOwner)
+			}
+		}
+
 		//we generate a new key
 		encKey, err := crypto.RandomBytes(32)
 		if err != nil {
 			return nil, err
 		}
 
-		//we seal the key with the ws tool
-		sealedKey, err := tool.GetEncrypted(ctx, encryptionKeyName, encKey)
+		//we seal the key with the owner tool
+		sealedKey, err := tool.GetEncrypted(ctx, info.EncryptionKey, encKey)
 		if err != nil {
 			return nil, err
 		}
 
-		//we tell the data-key service to associate the sealed key to wsUser<->node
+		//we tell the data-key service to associate the sealed key to owner<->node
 		err = e.setNodeEncryptionKey(ctx, &encryption.NodeKey{
-			UserId:    wsUser,
+			UserId:    keyOwner,
 			NodeId:    node.Uuid,
-			OwnerId:   wsUser,
+			OwnerId:   keyOwner,
 			Data:      sealedKey,
 			Nonce:     nil,
 			BlockSize: 0,
@@ -296,7 +385,10 @@ func (e *EncryptionHandler) retrieveEncryptionMaterials(ctx context.Context, nod
 	} else if encrypt {
 		nodeKey.Nonce = []byte{}
 	}
-	encKey, err := tool.GetDecrypted(ctx, encryptionKeyName, nodeKey.Data)
+	encKey, err := tool.GetDecrypted(ctx, info.EncryptionKey, nodeKey.Data)
+	if err != nil && info.EncryptionMode == object.EncryptionMode_MASTER {
+		encKey, err = e.openWithRotatingKey(ctx, tool, dsName, info.EncryptionKey, nodeKey.Data, err)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -307,23 +399,126 @@ func (e *EncryptionHandler) retrieveEncryptionMaterials(ctx context.Context, nod
 	}), nil
 }
 
-func (e *EncryptionHandler) copyEncryptionMaterials(ctx context.Context, source *tree.Node, copy *tree.Node) error {
+// addWriterEncryptionKey lets a user update a node encrypted by another user: the node key is opened with the key
+// of its owner and sealed for the writer, as a share would do. Keys stored for other users are left untouched.
+func (e *EncryptionHandler) addWriterEncryptionKey(ctx context.Context, node *tree.Node, info BranchInfo, ownerKey *encryption.NodeKey, tool key.UserKeyTool, writer string) (*crypto.AESGCMMaterials, error) {
+
+	if info.EncryptionMode == object.EncryptionMode_USER_PWD {
+		return nil, errors.Forbidden("views.Handler.encryption", fmt.Sprintf("this node is encrypted with the key of %s, it must be shared with %s before being updated", ownerKey.OwnerId, writer))
+	}
+	encKey, err := key.GetUserKeyTool(ownerKey.OwnerId, nil).GetDecrypted(ctx, info.EncryptionKey, ownerKey.Data)
+	if err != nil {
+		return nil, err
+	}
+	sealedKey, err := tool.GetEncrypted(ctx, info.EncryptionKey, encKey)
+	if err != nil {
+		return nil, err
+	}
+	err = e.setNodeEncryptionKey(ctx, &encryption.NodeKey{
+		UserId:    writer,
+		NodeId:    node.Uuid,
+		OwnerId:   ownerKey.OwnerId,
+		Data:      sealedKey,
+		Nonce:     ownerKey.Nonce,
+		BlockSize: ownerKey.BlockSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return crypto.NewAESGCMMaterials(encKey, nil), nil
+}
+
+// ownerEncryptionMaterials opens the node key of the owner for system flows on datasources encrypted with user keys.
+func (e *EncryptionHandler) ownerEncryptionMaterials(ctx context.Context, node *tree.Node, info BranchInfo, encrypt bool) (*crypto.AESGCMMaterials, error) {
+
+	dsName := node.GetStringMeta(common.META_NAMESPACE_DATASOURCE_NAME)
+	ownerKey, err := e.getNodeEncryptionKey(ctx, "", node.Uuid)
+	if err != nil {
+		return nil, err
+	}
+	if len(ownerKey.Data) == 0 {
+		return nil, errors.Forbidden("views.Handler.encryption", fmt.Sprintf("datasource %s is encrypted with user keys, a user is required to encrypt new content", dsName))
+	}
+	tool, err := e.ownerKeyTool(ctx, info, dsName, ownerKey)
+	if err != nil {
+		return nil, err
+	}
+	encKey, err := tool.GetDecrypted(ctx, info.EncryptionKey, ownerKey.Data)
+	if err != nil {
+		return nil, err
+	}
+	if encrypt {
+		ownerKey.Nonce = []byte{}
+	}
+	return crypto.NewAESGCMMaterials(encKey, &encryption.Params{
+		BlockSize: ownerKey.BlockSize,
+		Nonce:     ownerKey.Nonce,
+	}), nil
+}
+
+// openWithRotatingKey opens a node key with the other key of a rotation in progress on the datasource: while
+// node keys are rewrapped - or if the rotation failed - they may be sealed either with the old or the new key.
+func (e *EncryptionHandler) openWithRotatingKey(ctx context.Context, tool key.UserKeyTool, dsName string, keyID string, data []byte, openErr error) ([]byte, error) {
+	nodeKeyClient := encryption.NewNodeKeyManagerClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_ENC_KEY, defaults.NewClient())
+	rsp, err := nodeKeyClient.GetKeyRotation(ctx, &encryption.GetKeyRotationRequest{DataSource: dsName})
+	if err != nil {
+		return nil, openErr
+	}
+	r := rsp.Rotation
+	if r.Status == encryption.KeyRotationStatus_RotationDone {
+		return nil, openErr
+	}
+	otherKey := r.NewKeyID
+	if keyID == r.NewKeyID {
+		otherKey = r.OldKeyID
+	}
+	return tool.GetDecrypted(ctx, otherKey, data)
+}
+
+func (e *EncryptionHandler) copyEncryptionMaterials(ctx context.Context, info BranchInfo, source *tree.Node, copy *tree.Node) error {
 	//does not handle cross-copy if ever exists somewhere in pydio
 	dsName := source.GetStringMeta(common.META_NAMESPACE_DATASOURCE_NAME)
-	var wsUser = fmt.Sprintf("ds:%s", dsName)
 
-	nodeKey, err := e.getNodeEncryptionKey(ctx, wsUser, source.Uuid)
+	if userKeysEnabled(info) && isSystemContext(ctx) {
+		// System copies (e.g. versions) keep the sealed key of the source owner as is: no key needs to be opened
+		nodeKey, err := e.getNodeEncryptionKey(ctx, "", source.Uuid)
+		if err != nil {
+			return err
+		}
+		if len(nodeKey.Data) == 0 {
+			return errors.NotFound("views.Handler.encryption", fmt.Sprintf("no encryption key found for node %s", source.Uuid))
+		}
+		return e.setNodeEncryptionKey(ctx, &encryption.NodeKey{
+			BlockSize: nodeKey.BlockSize,
+			Data:      nodeKey.Data,
+			NodeId:    copy.Uuid,
+			Nonce:     nodeKey.Nonce,
+			OwnerId:   nodeKey.OwnerId,
+			UserId:    nodeKey.OwnerId,
+		})
+	}
+
+	_, keyOwner, err := e.keyTool(ctx, info, dsName)
 	if err != nil {
 		return err
 	}
 
+	nodeKey, err := e.getNodeEncryptionKey(ctx, keyOwner, source.Uuid)
+	if err != nil {
+		return err
+	}
+	if len(nodeKey.Data) == 0 && userKeysEnabled(info) {
+		return errors.Forbidden("views.Handler.encryption", fmt.Sprintf("no encryption key is shared with %s for this node", keyOwner))
+	}
+
+	// the copy belongs to the user who made it, even if the source key was only shared with them
 	copyNodeKey := &encryption.NodeKey{
 		BlockSize: nodeKey.BlockSize,
 		Data:      nodeKey.Data,
 		NodeId:    copy.Uuid,
 		Nonce:     nodeKey.Nonce,
-		OwnerId:   wsUser,
-		UserId:    wsUser,
+		OwnerId:   keyOwner,
+		UserId:    keyOwner,
 	}
 	return e.setNodeEncryptionKey(ctx, copyNodeKey)
 }
@@ -22,20 +22,15 @@ package views
 
 import (
 	"context"
-	"encoding/json"
 	"io"
 
 	"github.com/micro/go-micro/client"
 	"go.uber.org/zap"
 
-	"github.com/micro/go-micro/errors"
 	"github.com/pmker/yux/common"
 	"github.com/pmker/yux/common/log"
-	"github.com/pmker/yux/common/micro"
 	"github.com/pmker/yux/common/proto/docstore"
-	"github.com/pmker/yux/common/proto/idm"
 	"github.com/pmker/yux/common/proto/tree"
-	"github.com/pmker/yux/common/utils"
 )
 
 type HandlerEventRead struct {
@@ -78,29 +73,19 @@ func (h *HandlerEventRead) ListNodes(ctx context.Context, in *tree.ListNodesRequ
 
 func (h *HandlerEventRead) GetObject(ctx context.Context, node *tree.Node, requestData *GetRequestData) (io.ReadCloser, error) {
 
-	logger := log.Logger(ctx)
-
-	var (
-		doc      *docstore.Document
-		linkData *docstore.ShareDocument
-	)
-
-	if doc, linkData = h.sharedLinkWithDownloadLimit(ctx); doc != nil && linkData != nil {
-		// Check download limit!
-		if linkData.DownloadCount >= linkData.DownloadLimit {
-			return nil, errors.Forbidden("MaxDownloadsReached", "You are not allowed to download this document")
-		}
-	}
-
 	reader, e := h.next.GetObject(ctx, node, requestData)
 	if branchInfo, ok := GetBranchInfo(ctx, "in"); ok && branchInfo.Binary {
 		return reader, e
 	}
+	// Public links downloads are already published by the ShareLinkFilter
+	if _, linkDownload := ctx.Value(ctxShareLinkKey{}).(*docstore.ShareLinkDownload); linkDownload {
+		return reader, e
+	}
 	if e == nil {
 		eventNode := node.Clone()
 		if eventNode.Uuid == "" {
 			if e := h.feedNodeUuid(ctx, eventNode); e != nil {
-				logger.Debug("HandlerEventRead did not find Uuid!", zap.Error(e))
+				log.Logger(ctx).Debug("HandlerEventRead did not find Uuid!", zap.Error(e))
 			}
 		}
 		if eventNode.Uuid != "" {
@@ -111,83 +96,7 @@ func (h *HandlerEventRead) GetObject(ctx context.Context, node *tree.Node, reque
 				}))
 			}()
 		}
-		if doc != nil && linkData != nil {
-			go func() {
-				bgContext := context.Background()
-				linkData.DownloadCount++
-				newData, _ := json.Marshal(linkData)
-				doc.Data = string(newData)
-				store := docstore.NewDocStoreClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_DOCSTORE, defaults.NewClient())
-				_, e3 := store.PutDocument(bgContext, &docstore.PutDocumentRequest{StoreID: common.DOCSTORE_ID_SHARES, DocumentID: doc.ID, Document: doc})
-				if e3 == nil {
-					logger.Debug("Updated share download count " + doc.ID)
-				} else {
-					logger.Error("Docstore error while trying to increment link downloads count", zap.Error(e3))
-				}
-
-			}()
-		}
 	}
 	return reader, e
 
 }
-
-func (h *HandlerEventRead) sharedLinkWithDownloadLimit(ctx context.Context) (doc *docstore.Document, linkData *docstore.ShareDocument) {
-
-	userLogin, claims := utils.FindUserNameInContext(ctx)
-	// TODO - Have the 'hidden' info directly in claims => could it be a profile instead ?
-	if claims.Profile != common.PYDIO_PROFILE_SHARED {
-		return
-	}
-	bgContext := context.Background()
-	user, e := utils.SearchUniqueUser(bgContext, userLogin, "", &idm.UserSingleQuery{AttributeName: "hidden", AttributeValue: "true"})
-	if e != nil || user == nil {
-		return
-	}
-	// This is a unique hidden user - search corresponding link and update download number
-	store := docstore.NewDocStoreClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_DOCSTORE, defaults.NewClient())
-
-	// SEARCH WITH PRESET_LOGIN
-	stream, e := store.ListDocuments(bgContext, &docstore.ListDocumentsRequest{StoreID: common.DOCSTORE_ID_SHARES, Query: &docstore.DocumentQuery{
-		MetaQuery: "+SHARE_TYPE:minisite +PRESET_LOGIN:" + userLogin + "",
-	}})
-	if e != nil {
-		return
-	}
-	defer stream.Close()
-	for {
-		r, e := stream.Recv()
-		if e != nil {
-			break
-		}
-		doc = r.Document
-		break
-	}
-
-	if doc == nil {
-		// SEARCH WITH PRELOG_USER
-		stream2, e := store.ListDocuments(bgContext, &docstore.ListDocumentsRequest{StoreID: common.DOCSTORE_ID_SHARES, Query: &docstore.DocumentQuery{
-			MetaQuery: "+SHARE_TYPE:minisite +PRELOG_USER:" + userLogin + "",
-		}})
-		if e != nil {
-			return
-		}
-		defer stream2.Close()
-		for {
-			r, e := stream2.Recv()
-			if e != nil {
-				break
-			}
-			doc = r.Document
-			break
-		}
-	}
-
-	if doc != nil {
-		var data *docstore.ShareDocument
-		if e2 := json.Unmarshal([]byte(doc.Data), &data); e2 == nil && data.DownloadLimit > 0 {
-			linkData = data
-		}
-	}
-	return
-}
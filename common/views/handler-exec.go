@@ -176,6 +176,11 @@ func (e *Executor) GetObject(ctx context.Context, node *tree.Node, requestData *
 		if err := headers.SetRange(requestData.StartOffset, requestData.StartOffset+requestData.Length-1); err != nil {
 			return nil, err
 		}
+	} else if requestData.StartOffset > 0 {
+		// Read until the end of the object
+		if err := headers.SetRange(requestData.StartOffset, 0); err != nil {
+			return nil, err
+		}
 	}
 	reader, err = writer.GetObjectWithContext(newCtx, info.ObjectsBucket, s3Path, headers)
 	logger.Debug("[handler exec] Get Object", zap.String("bucket", info.ObjectsBucket), zap.String("s3path", s3Path), zap.Any("headers", headers.Header()), zap.Any("request", requestData), zap.Any("resultObject", reader))
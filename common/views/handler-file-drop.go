@@ -0,0 +1,586 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package views
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/client"
+	"github.com/micro/go-micro/errors"
+	"github.com/pydio/minio-go"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/config"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/proto/docstore"
+	"github.com/pmker/yux/common/proto/mailer"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/registry"
+	"github.com/pmker/yux/common/utils"
+	"github.com/pmker/yux/common/utils/i18n"
+)
+
+const (
+	// fileDropMaxRenames bounds the search for a free name when a dropped file collides with an existing one.
+	fileDropMaxRenames = 100
+	// fileDropNotifyDelay groups the files dropped on a link in a single notification.
+	fileDropNotifyDelay = time.Minute
+)
+
+var (
+	// fileDropNotifications is shared by all routers, so that drops are grouped per link.
+	fileDropNotifications = newFileDropNotifier(fileDropNotifyDelay, sendFileDropMail)
+)
+
+// FileDropFilter turns the public links configured as file drops into upload-only folders. Visitors can only
+// see the shared folder itself and send files at its first level: listings are empty, other nodes are hidden
+// and reading, moving or deleting is refused. A dropped file never replaces an existing one, it is renamed
+// instead, and the link owner is notified by email.
+type FileDropFilter struct {
+	AbstractHandler
+	links    shareLinksStore
+	notifier *fileDropNotifier
+}
+
+// NewFileDropFilter creates a FileDropFilter loading links from the docstore.
+func NewFileDropFilter() *FileDropFilter {
+	return &FileDropFilter{
+		links:    &docstoreShareLinks{},
+		notifier: fileDropNotifications,
+	}
+}
+
+// ReadNode only lets the shared folder be read.
+func (f *FileDropFilter) ReadNode(ctx context.Context, in *tree.ReadNodeRequest, opts ...client.CallOption) (*tree.ReadNodeResponse, error) {
+	ctx, _, drop, e := f.fileDrop(ctx)
+	if e != nil {
+		return nil, e
+	}
+	if drop == nil {
+		return f.next.ReadNode(ctx, in, opts...)
+	}
+	resp, e := f.next.ReadNode(ctx, in, opts...)
+	if e != nil {
+		return nil, e
+	}
+	if resp.Node == nil || !f.isDropRoot(ctx, drop, resp.Node.Uuid) {
+		return nil, errors.NotFound(VIEWS_LIBRARY_NAME, "Cannot find node "+in.Node.Path)
+	}
+	return resp, nil
+}
+
+// ListNodes returns an empty listing for the shared folder.
+func (f *FileDropFilter) ListNodes(ctx context.Context, in *tree.ListNodesRequest, opts ...client.CallOption) (tree.NodeProvider_ListNodesClient, error) {
+	ctx, _, drop, e := f.fileDrop(ctx)
+	if e != nil {
+		return nil, e
+	}
+	if drop == nil {
+		return f.next.ListNodes(ctx, in, opts...)
+	}
+	if root, e := f.isDropFolder(ctx, drop, in.Node); e != nil {
+		return nil, e
+	} else if !root {
+		return nil, errors.NotFound(VIEWS_LIBRARY_NAME, "Cannot find node "+in.Node.Path)
+	}
+	streamer := NewWrappingStreamer()
+	streamer.Close()
+	return streamer, nil
+}
+
+// CreateNode is refused on file drops, which only accept files at their first level.
+func (f *FileDropFilter) CreateNode(ctx context.Context, in *tree.CreateNodeRequest, opts ...client.CallOption) (*tree.CreateNodeResponse, error) {
+	ctx, _, drop, e := f.fileDrop(ctx)
+	if e != nil {
+		return nil, e
+	}
+	if drop != nil {
+		return nil, fileDropForbidden()
+	}
+	return f.next.CreateNode(ctx, in, opts...)
+}
+
+// UpdateNode is refused on file drops.
+func (f *FileDropFilter) UpdateNode(ctx context.Context, in *tree.UpdateNodeRequest, opts ...client.CallOption) (*tree.UpdateNodeResponse, error) {
+	ctx, _, drop, e := f.fileDrop(ctx)
+	if e != nil {
+		return nil, e
+	}
+	if drop != nil {
+		return nil, fileDropForbidden()
+	}
+	return f.next.UpdateNode(ctx, in, opts...)
+}
+
+// DeleteNode is refused on file drops.
+func (f *FileDropFilter) DeleteNode(ctx context.Context, in *tree.DeleteNodeRequest, opts ...client.CallOption) (*tree.DeleteNodeResponse, error) {
+	ctx, _, drop, e := f.fileDrop(ctx)
+	if e != nil {
+		return nil, e
+	}
+	if drop != nil {
+		return nil, fileDropForbidden()
+	}
+	return f.next.DeleteNode(ctx, in, opts...)
+}
+
+// GetObject is refused on file drops, dropped files cannot be read back.
+func (f *FileDropFilter) GetObject(ctx context.Context, node *tree.Node, requestData *GetRequestData) (io.ReadCloser, error) {
+	ctx, _, drop, e := f.fileDrop(ctx)
+	if e != nil {
+		return nil, e
+	}
+	if drop != nil {
+		return nil, fileDropForbidden()
+	}
+	return f.next.GetObject(ctx, node, requestData)
+}
+
+// CopyObject is refused on file drops.
+func (f *FileDropFilter) CopyObject(ctx context.Context, from *tree.Node, to *tree.Node, requestData *CopyRequestData) (int64, error) {
+	ctx, _, drop, e := f.fileDrop(ctx)
+	if e != nil {
+		return 0, e
+	}
+	if drop != nil {
+		return 0, fileDropForbidden()
+	}
+	return f.next.CopyObject(ctx, from, to, requestData)
+}
+
+// PutObject checks the dropped file and renames it if a file with the same name already exists.
+func (f *FileDropFilter) PutObject(ctx context.Context, node *tree.Node, reader io.Reader, requestData *PutRequestData) (int64, error) {
+	ctx, doc, drop, e := f.fileDrop(ctx)
+	if e != nil {
+		return 0, e
+	}
+	if drop == nil {
+		return f.next.PutObject(ctx, node, reader, requestData)
+	}
+	ctx, target, e := f.prepareDrop(ctx, drop, node, requestData.Size)
+	if e != nil {
+		return 0, e
+	}
+	if drop.FileDropMaxSize > 0 {
+		// Size may not be known in advance
+		reader = &fileDropLimitReader{Reader: reader, remaining: drop.FileDropMaxSize, maxSize: drop.FileDropMaxSize}
+	}
+	written, e := f.next.PutObject(ctx, target, reader, requestData)
+	if e == nil {
+		f.notifier.add(doc.ID, drop.OwnerId, path.Base(target.Path))
+	}
+	return written, e
+}
+
+// IsFileDropVisitor tells if the current user is the hidden user of a file drop link. Services browsing
+// the index outside of the views (search, activities) must not show anything to them.
+func IsFileDropVisitor(ctx context.Context) (bool, error) {
+	_, linkData, e := loadShareLink(ctx, &docstoreShareLinks{})
+	if e != nil {
+		return false, e
+	}
+	return linkData != nil && linkData.FileDrop, nil
+}
+
+// MultipartCreate checks the dropped file and renames it if a file with the same name already exists.
+// The name is carried by the upload ID returned to the client, so that next calls for this upload are
+// redirected to the new name by any gateway instance.
+func (f *FileDropFilter) MultipartCreate(ctx context.Context, target *tree.Node, requestData *MultipartRequestData) (string, error) {
+	ctx, _, drop, e := f.fileDrop(ctx)
+	if e != nil {
+		return "", e
+	}
+	if drop == nil {
+		return f.next.MultipartCreate(ctx, target, requestData)
+	}
+	ctx, renamed, e := f.prepareDrop(ctx, drop, target, requestData.Size)
+	if e != nil {
+		return "", e
+	}
+	uploadID, e := f.next.MultipartCreate(ctx, renamed, requestData)
+	if e != nil {
+		return uploadID, e
+	}
+	return fileDropUploadID(uploadID, path.Base(renamed.Path)), nil
+}
+
+// MultipartPutObjectPart enforces the maximum size of the dropped file over all its parts. Sizes of the
+// parts already stored are read from the storage.
+func (f *FileDropFilter) MultipartPutObjectPart(ctx context.Context, target *tree.Node, uploadID string, partNumberMarker int, reader io.Reader, requestData *PutRequestData) (minio.ObjectPart, error) {
+	ctx, _, drop, e := f.fileDrop(ctx)
+	if e != nil {
+		return minio.ObjectPart{}, e
+	}
+	if drop == nil {
+		return f.next.MultipartPutObjectPart(ctx, target, uploadID, partNumberMarker, reader, requestData)
+	}
+
+	renamed, uploadID, e := fileDropUploadTarget(target, uploadID)
+	if e != nil {
+		return minio.ObjectPart{}, e
+	}
+	if drop.FileDropMaxSize > 0 {
+		stored, e := f.uploadedSize(ctx, renamed, uploadID, partNumberMarker)
+		if e != nil {
+			return minio.ObjectPart{}, e
+		}
+		total := stored + requestData.Size
+		if total > drop.FileDropMaxSize {
+			return minio.ObjectPart{}, fileDropTooLarge(drop.FileDropMaxSize)
+		}
+		reader = &fileDropLimitReader{Reader: reader, remaining: drop.FileDropMaxSize - stored, maxSize: drop.FileDropMaxSize}
+	}
+
+	return f.next.MultipartPutObjectPart(ctx, renamed, uploadID, partNumberMarker, reader, requestData)
+}
+
+// MultipartComplete redirects the upload to the dropped file name and notifies the link owner.
+func (f *FileDropFilter) MultipartComplete(ctx context.Context, target *tree.Node, uploadID string, uploadedParts []minio.CompletePart) (minio.ObjectInfo, error) {
+	ctx, doc, drop, e := f.fileDrop(ctx)
+	if e != nil {
+		return minio.ObjectInfo{}, e
+	}
+	if drop == nil {
+		return f.next.MultipartComplete(ctx, target, uploadID, uploadedParts)
+	}
+	renamed, uploadID, e := fileDropUploadTarget(target, uploadID)
+	if e != nil {
+		return minio.ObjectInfo{}, e
+	}
+	info, e := f.next.MultipartComplete(ctx, renamed, uploadID, uploadedParts)
+	if e != nil {
+		return info, e
+	}
+	f.notifier.add(doc.ID, drop.OwnerId, path.Base(renamed.Path))
+	return info, nil
+}
+
+// MultipartAbort redirects the upload to the dropped file name.
+func (f *FileDropFilter) MultipartAbort(ctx context.Context, target *tree.Node, uploadID string, requestData *MultipartRequestData) error {
+	ctx, _, drop, e := f.fileDrop(ctx)
+	if e != nil {
+		return e
+	}
+	if drop == nil {
+		return f.next.MultipartAbort(ctx, target, uploadID, requestData)
+	}
+	renamed, uploadID, e := fileDropUploadTarget(target, uploadID)
+	if e != nil {
+		return e
+	}
+	return f.next.MultipartAbort(ctx, renamed, uploadID, requestData)
+}
+
+// MultipartList does not show the uploads in progress on file drops.
+func (f *FileDropFilter) MultipartList(ctx context.Context, prefix string, requestData *MultipartRequestData) (minio.ListMultipartUploadsResult, error) {
+	ctx, _, drop, e := f.fileDrop(ctx)
+	if e != nil {
+		return minio.ListMultipartUploadsResult{}, e
+	}
+	if drop != nil {
+		return minio.ListMultipartUploadsResult{}, nil
+	}
+	return f.next.MultipartList(ctx, prefix, requestData)
+}
+
+// MultipartListObjectParts redirects the upload to the dropped file name.
+func (f *FileDropFilter) MultipartListObjectParts(ctx context.Context, target *tree.Node, uploadID string, partNumberMarker int, maxParts int) (minio.ListObjectPartsResult, error) {
+	ctx, _, drop, e := f.fileDrop(ctx)
+	if e != nil {
+		return minio.ListObjectPartsResult{}, e
+	}
+	if drop == nil {
+		return f.next.MultipartListObjectParts(ctx, target, uploadID, partNumberMarker, maxParts)
+	}
+	renamed, uploadID, e := fileDropUploadTarget(target, uploadID)
+	if e != nil {
+		return minio.ListObjectPartsResult{}, e
+	}
+	return f.next.MultipartListObjectParts(ctx, renamed, uploadID, partNumberMarker, maxParts)
+}
+
+// fileDrop loads the link of the current user and keeps it in context for the next handlers.
+// It returns nil data if the user is not visiting a file drop.
+func (f *FileDropFilter) fileDrop(ctx context.Context) (context.Context, *docstore.Document, *docstore.ShareDocument, error) {
+	doc, linkData, e := loadShareLink(ctx, f.links)
+	if e != nil {
+		return ctx, nil, nil, e
+	}
+	ctx = withShareLink(ctx, doc, linkData)
+	if linkData == nil || !linkData.FileDrop {
+		return ctx, nil, nil, nil
+	}
+	return ctx, doc, linkData, nil
+}
+
+// isDropRoot checks if a node uuid is one of the roots of the link workspace.
+func (f *FileDropFilter) isDropRoot(ctx context.Context, drop *docstore.ShareDocument, nodeUuid string) bool {
+	accessList, ok := ctx.Value(ctxUserAccessListKey{}).(*utils.AccessList)
+	if !ok || nodeUuid == "" {
+		return false
+	}
+	_, isRoot := accessList.GetWorkspacesNodes()[drop.RepositoryId][nodeUuid]
+	return isRoot
+}
+
+// isDropFolder checks if a node, possibly only known by its path, is one of the roots of the link workspace.
+func (f *FileDropFilter) isDropFolder(ctx context.Context, drop *docstore.ShareDocument, node *tree.Node) (bool, error) {
+	if node.Uuid != "" {
+		return f.isDropRoot(ctx, drop, node.Uuid), nil
+	}
+	resp, e := f.next.ReadNode(ctx, &tree.ReadNodeRequest{Node: &tree.Node{Path: node.Path}})
+	if e != nil {
+		return false, e
+	}
+	return resp.Node != nil && f.isDropRoot(ctx, drop, resp.Node.Uuid), nil
+}
+
+// prepareDrop checks that a file can be dropped and finds a free name for it.
+func (f *FileDropFilter) prepareDrop(ctx context.Context, drop *docstore.ShareDocument, node *tree.Node, size int64) (context.Context, *tree.Node, error) {
+
+	nodePath := strings.TrimRight(node.Path, "/")
+	if root, e := f.isDropFolder(ctx, drop, &tree.Node{Path: path.Dir(nodePath)}); e != nil || !root {
+		return ctx, nil, errors.Forbidden("FileDropFolder", "Files can only be dropped in the shared folder")
+	}
+	if e := checkFileDropFile(drop, path.Base(nodePath), size); e != nil {
+		return ctx, nil, e
+	}
+	freePath, e := f.freePath(ctx, nodePath)
+	if e != nil {
+		return ctx, nil, e
+	}
+	if freePath == node.Path {
+		return ctx, node, nil
+	}
+	log.Logger(ctx).Debug("Renaming dropped file", zap.String("from", node.Path), zap.String("to", freePath))
+	// Ancestors were loaded for the existing node
+	if branchInfo, ok := GetBranchInfo(ctx, "in"); ok {
+		branchInfo.AncestorsList = nil
+		ctx = WithBranchInfo(ctx, "in", branchInfo)
+	}
+	renamed := node.Clone()
+	renamed.Path = freePath
+	renamed.Uuid = ""
+	return ctx, renamed, nil
+}
+
+// freePath appends a counter to the file name until it does not collide with an existing node. Only a
+// missing node is free: other errors are returned, an existing file must never be replaced.
+func (f *FileDropFilter) freePath(ctx context.Context, nodePath string) (string, error) {
+	dir, base := path.Split(nodePath)
+	ext := path.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+	candidate := nodePath
+	for i := 1; i <= fileDropMaxRenames; i++ {
+		resp, e := f.next.ReadNode(ctx, &tree.ReadNodeRequest{Node: &tree.Node{Path: candidate}})
+		if e != nil {
+			if errors.Parse(e.Error()).Code == 404 {
+				return candidate, nil
+			}
+			return "", e
+		}
+		if resp.Node == nil {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s%s-%d%s", dir, name, i, ext)
+	}
+	return "", errors.Forbidden("FileDropConflict", "Cannot find a free name for "+base)
+}
+
+// checkFileDropFile verifies the extension and, if it is known, the size of a dropped file.
+func checkFileDropFile(drop *docstore.ShareDocument, name string, size int64) error {
+	if len(drop.FileDropExtensions) > 0 {
+		lowerName := strings.ToLower(name)
+		var allowed bool
+		for _, ext := range drop.FileDropExtensions {
+			if strings.HasSuffix(lowerName, "."+strings.ToLower(ext)) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return errors.Forbidden("FileDropExtension", "Files of this type cannot be dropped here")
+		}
+	}
+	if drop.FileDropMaxSize > 0 && size > drop.FileDropMaxSize {
+		return fileDropTooLarge(drop.FileDropMaxSize)
+	}
+	return nil
+}
+
+// fileDropUploadID appends the name chosen for a dropped file to the upload ID. The encoding does not use
+// dots, so the last one always separates it from the upload ID of the storage.
+func fileDropUploadID(uploadID string, name string) string {
+	return uploadID + "." + base64.RawURLEncoding.EncodeToString([]byte(name))
+}
+
+// fileDropUploadTarget redirects a multipart upload call to the name chosen at creation, and returns the upload
+// ID of the storage. A forged name cannot be used for another file: the storage binds the upload to its target.
+func fileDropUploadTarget(target *tree.Node, uploadID string) (*tree.Node, string, error) {
+	i := strings.LastIndex(uploadID, ".")
+	if i < 0 {
+		return nil, "", errors.NotFound(VIEWS_LIBRARY_NAME, "Cannot find upload "+uploadID)
+	}
+	name, e := base64.RawURLEncoding.DecodeString(uploadID[i+1:])
+	if e != nil || len(name) == 0 || string(name) == "." || string(name) == ".." || strings.Contains(string(name), "/") {
+		return nil, "", errors.NotFound(VIEWS_LIBRARY_NAME, "Cannot find upload "+uploadID)
+	}
+	renamed := target.Clone()
+	renamed.Path = path.Join(path.Dir(strings.TrimRight(target.Path, "/")), string(name))
+	return renamed, uploadID[:i], nil
+}
+
+// uploadedSize sums up the sizes of the parts of an upload already stored, except the part being sent again.
+func (f *FileDropFilter) uploadedSize(ctx context.Context, target *tree.Node, uploadID string, except int) (int64, error) {
+	var size int64
+	marker := 0
+	for {
+		res, e := f.next.MultipartListObjectParts(ctx, target, uploadID, marker, 1000)
+		if e != nil {
+			return 0, e
+		}
+		for _, part := range res.ObjectParts {
+			if part.PartNumber != except {
+				size += part.Size
+			}
+		}
+		if !res.IsTruncated || res.NextPartNumberMarker <= marker {
+			return size, nil
+		}
+		marker = res.NextPartNumberMarker
+	}
+}
+
+func fileDropForbidden() error {
+	return errors.Forbidden("FileDropUploadOnly", "This link only accepts uploads")
+}
+
+func fileDropTooLarge(maxSize int64) error {
+	return errors.Forbidden("FileDropTooLarge", fmt.Sprintf("Dropped files cannot be larger than %d bytes", maxSize))
+}
+
+// fileDropLimitReader fails as soon as more than the allowed bytes are read.
+type fileDropLimitReader struct {
+	io.Reader
+	remaining int64
+	maxSize   int64
+}
+
+func (l *fileDropLimitReader) Read(p []byte) (int, error) {
+	n, e := l.Reader.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, fileDropTooLarge(l.maxSize)
+	}
+	return n, e
+}
+
+// fileDropNotifier groups the files dropped on each link during a short delay before notifying the link owner.
+type fileDropNotifier struct {
+	sync.Mutex
+	delay   time.Duration
+	send    func(ctx context.Context, linkHash string, owner string, files []string) error
+	pending map[string]*fileDropBatch
+}
+
+type fileDropBatch struct {
+	owner string
+	files []string
+}
+
+func newFileDropNotifier(delay time.Duration, send func(ctx context.Context, linkHash string, owner string, files []string) error) *fileDropNotifier {
+	return &fileDropNotifier{
+		delay:   delay,
+		send:    send,
+		pending: make(map[string]*fileDropBatch),
+	}
+}
+
+// add registers a dropped file, the first file of a batch schedules the notification.
+func (n *fileDropNotifier) add(linkHash string, owner string, file string) {
+	n.Lock()
+	defer n.Unlock()
+	if batch, ok := n.pending[linkHash]; ok {
+		batch.files = append(batch.files, file)
+		return
+	}
+	n.pending[linkHash] = &fileDropBatch{owner: owner, files: []string{file}}
+	time.AfterFunc(n.delay, func() {
+		n.flush(linkHash)
+	})
+}
+
+func (n *fileDropNotifier) flush(linkHash string) {
+	n.Lock()
+	batch, ok := n.pending[linkHash]
+	delete(n.pending, linkHash)
+	n.Unlock()
+	if !ok || batch.owner == "" {
+		return
+	}
+	ctx := context.Background()
+	if e := n.send(ctx, linkHash, batch.owner, batch.files); e != nil {
+		log.Logger(ctx).Error("Cannot notify link owner of dropped files", zap.String(common.KEY_LINK_UUID, linkHash), zap.Error(e))
+	}
+}
+
+// sendFileDropMail sends the list of dropped files to the link owner, if they have an email.
+func sendFileDropMail(ctx context.Context, linkHash string, owner string, files []string) error {
+
+	user, e := utils.SearchUniqueUser(ctx, owner, "")
+	if e != nil {
+		return e
+	}
+	email, ok := user.Attributes["email"]
+	if !ok || email == "" {
+		return nil
+	}
+	displayName, ok := user.Attributes["displayName"]
+	if !ok {
+		displayName = user.Login
+	}
+
+	_, e = mailer.NewMailerServiceClient(registry.GetClient(common.SERVICE_MAILER)).SendMail(ctx, &mailer.SendMailRequest{
+		Mail: &mailer.Mail{
+			To: []*mailer.User{{
+				Uuid:     user.Uuid,
+				Name:     displayName,
+				Address:  email,
+				Language: i18n.UserLanguage(ctx, user, config.Default()),
+			}},
+			TemplateId: "FileDrop",
+			TemplateData: map[string]string{
+				"Link":  config.Get("defaults", "url").String("") + "/public/" + linkHash,
+				"Count": fmt.Sprintf("%d", len(files)),
+				"Files": strings.Join(files, ", "),
+			},
+		},
+	})
+	return e
+}
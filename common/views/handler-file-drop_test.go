@@ -0,0 +1,282 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package views
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/client"
+	"github.com/micro/go-micro/errors"
+	"github.com/pydio/minio-go"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/auth/claim"
+	"github.com/pmker/yux/common/proto/docstore"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/utils"
+)
+
+// multipartMock records the targets of multipart calls and the parts of uploads in progress.
+type multipartMock struct {
+	*HandlerMock
+	uploads map[string]map[int]int64
+	readErr error
+}
+
+func (m *multipartMock) ReadNode(ctx context.Context, in *tree.ReadNodeRequest, opts ...client.CallOption) (*tree.ReadNodeResponse, error) {
+	if m.readErr != nil {
+		return nil, m.readErr
+	}
+	if resp, e := m.HandlerMock.ReadNode(ctx, in, opts...); e == nil {
+		return resp, nil
+	}
+	return nil, errors.NotFound("mock", "node not found")
+}
+
+func (m *multipartMock) MultipartCreate(ctx context.Context, target *tree.Node, requestData *MultipartRequestData) (string, error) {
+	m.Nodes["in"] = target
+	m.uploads["upload.id"] = make(map[int]int64)
+	return "upload.id", nil
+}
+
+func (m *multipartMock) MultipartPutObjectPart(ctx context.Context, target *tree.Node, uploadID string, partNumberMarker int, reader io.Reader, requestData *PutRequestData) (minio.ObjectPart, error) {
+	m.Nodes["in"] = target
+	parts, ok := m.uploads[uploadID]
+	if !ok {
+		return minio.ObjectPart{}, errors.NotFound("mock", "no such upload")
+	}
+	parts[partNumberMarker] = requestData.Size
+	return minio.ObjectPart{PartNumber: partNumberMarker, Size: requestData.Size}, nil
+}
+
+func (m *multipartMock) MultipartListObjectParts(ctx context.Context, target *tree.Node, uploadID string, partNumberMarker int, maxParts int) (minio.ListObjectPartsResult, error) {
+	parts, ok := m.uploads[uploadID]
+	if !ok {
+		return minio.ListObjectPartsResult{}, errors.NotFound("mock", "no such upload")
+	}
+	res := minio.ListObjectPartsResult{}
+	for number, size := range parts {
+		res.ObjectParts = append(res.ObjectParts, minio.ObjectPart{PartNumber: number, Size: size})
+	}
+	return res, nil
+}
+
+func (m *multipartMock) MultipartComplete(ctx context.Context, target *tree.Node, uploadID string, uploadedParts []minio.CompletePart) (minio.ObjectInfo, error) {
+	m.Nodes["in"] = target
+	if _, ok := m.uploads[uploadID]; !ok {
+		return minio.ObjectInfo{}, errors.NotFound("mock", "no such upload")
+	}
+	delete(m.uploads, uploadID)
+	return minio.ObjectInfo{}, nil
+}
+
+// droppedFiles records the notifications sent by the filter.
+type droppedFiles struct {
+	sync.Mutex
+	sent map[string][]string
+}
+
+func (d *droppedFiles) send(ctx context.Context, linkHash string, owner string, files []string) error {
+	d.Lock()
+	defer d.Unlock()
+	d.sent[linkHash+":"+owner] = append(d.sent[linkHash+":"+owner], files...)
+	return nil
+}
+
+func (d *droppedFiles) get(key string) []string {
+	d.Lock()
+	defer d.Unlock()
+	return d.sent[key]
+}
+
+func testFileDropResources(link *docstore.ShareDocument) (*FileDropFilter, *multipartMock, *droppedFiles, context.Context) {
+
+	link.ShareType = "minisite"
+	link.PreLogUser = "drop-user"
+	link.RepositoryId = "drop-ws"
+	link.OwnerId = "owner"
+	data, _ := json.Marshal(link)
+	store := &memoryShareLinks{
+		docs:   map[string]*docstore.Document{"abcdef": {ID: "abcdef", Data: string(data), IndexableMeta: string(data)}},
+		logins: map[string]string{"drop-user": "abcdef"},
+	}
+	mock := NewHandlerMock()
+	mock.Nodes["ds/drop"] = &tree.Node{Path: "ds/drop", Uuid: "drop-root", Type: tree.NodeType_COLLECTION}
+	mock.Nodes["ds/drop/report.pdf"] = &tree.Node{Path: "ds/drop/report.pdf", Uuid: "report"}
+	mock.Nodes["ds/drop/report-1.pdf"] = &tree.Node{Path: "ds/drop/report-1.pdf", Uuid: "report-1"}
+	mock.Nodes["ds/drop/sub"] = &tree.Node{Path: "ds/drop/sub", Uuid: "sub", Type: tree.NodeType_COLLECTION}
+
+	notifications := &droppedFiles{sent: make(map[string][]string)}
+	h := &FileDropFilter{links: store, notifier: newFileDropNotifier(10*time.Millisecond, notifications.send)}
+	next := &multipartMock{HandlerMock: mock, uploads: make(map[string]map[int]int64)}
+	h.SetNextHandler(next)
+
+	accessList := &utils.AccessList{
+		WorkspacesNodes: map[string]map[string]utils.Bitmask{"drop-ws": {"drop-root": utils.Bitmask{}}},
+	}
+	ctx := context.WithValue(context.Background(), claim.ContextKey, claim.Claims{Name: "drop-user", Profile: common.PYDIO_PROFILE_SHARED})
+	ctx = context.WithValue(ctx, ctxUserAccessListKey{}, accessList)
+	return h, next, notifications, ctx
+}
+
+func TestFileDropFilter_Browse(t *testing.T) {
+
+	Convey("Other links are not filtered", t, func() {
+		h, _, _, ctx := testFileDropResources(&docstore.ShareDocument{})
+		h.links.(*memoryShareLinks).logins = map[string]string{}
+		_, e := h.GetObject(ctx, &tree.Node{Path: "ds/drop/report.pdf"}, &GetRequestData{})
+		So(e, ShouldBeNil)
+		resp, e := h.ReadNode(ctx, &tree.ReadNodeRequest{Node: &tree.Node{Path: "ds/drop/report.pdf"}})
+		So(e, ShouldBeNil)
+		So(resp.Node.Uuid, ShouldEqual, "report")
+	})
+
+	Convey("Only the shared folder is visible", t, func() {
+		h, _, _, ctx := testFileDropResources(&docstore.ShareDocument{FileDrop: true})
+		resp, e := h.ReadNode(ctx, &tree.ReadNodeRequest{Node: &tree.Node{Path: "ds/drop"}})
+		So(e, ShouldBeNil)
+		So(resp.Node.Uuid, ShouldEqual, "drop-root")
+
+		_, e = h.ReadNode(ctx, &tree.ReadNodeRequest{Node: &tree.Node{Path: "ds/drop/report.pdf"}})
+		So(errors.Parse(e.Error()).Code, ShouldEqual, 404)
+
+		streamer, e := h.ListNodes(ctx, &tree.ListNodesRequest{Node: &tree.Node{Path: "ds/drop"}})
+		So(e, ShouldBeNil)
+		_, e = streamer.Recv()
+		So(e, ShouldEqual, io.EOF)
+
+		_, e = h.ListNodes(ctx, &tree.ListNodesRequest{Node: &tree.Node{Path: "ds/drop/sub"}})
+		So(errors.Parse(e.Error()).Code, ShouldEqual, 404)
+	})
+
+	Convey("Reading and modifying nodes is refused", t, func() {
+		h, _, _, ctx := testFileDropResources(&docstore.ShareDocument{FileDrop: true})
+		_, e := h.GetObject(ctx, &tree.Node{Path: "ds/drop/report.pdf"}, &GetRequestData{})
+		So(errors.Parse(e.Error()).Code, ShouldEqual, 403)
+		_, e = h.DeleteNode(ctx, &tree.DeleteNodeRequest{Node: &tree.Node{Path: "ds/drop/report.pdf"}})
+		So(errors.Parse(e.Error()).Code, ShouldEqual, 403)
+		_, e = h.UpdateNode(ctx, &tree.UpdateNodeRequest{From: &tree.Node{Path: "ds/drop/report.pdf"}, To: &tree.Node{Path: "ds/drop/other.pdf"}})
+		So(errors.Parse(e.Error()).Code, ShouldEqual, 403)
+		_, e = h.CreateNode(ctx, &tree.CreateNodeRequest{Node: &tree.Node{Path: "ds/drop/folder"}})
+		So(errors.Parse(e.Error()).Code, ShouldEqual, 403)
+	})
+}
+
+func TestFileDropFilter_PutObject(t *testing.T) {
+
+	Convey("Dropped files are renamed on collision and notified", t, func() {
+		h, mock, notifications, ctx := testFileDropResources(&docstore.ShareDocument{FileDrop: true})
+		_, e := h.PutObject(ctx, &tree.Node{Path: "ds/drop/new.pdf"}, strings.NewReader("content"), &PutRequestData{Size: 7})
+		So(e, ShouldBeNil)
+		So(mock.Nodes["in"].Path, ShouldEqual, "ds/drop/new.pdf")
+
+		_, e = h.PutObject(ctx, &tree.Node{Path: "ds/drop/report.pdf"}, strings.NewReader("content"), &PutRequestData{Size: 7})
+		So(e, ShouldBeNil)
+		So(mock.Nodes["in"].Path, ShouldEqual, "ds/drop/report-2.pdf")
+
+		time.Sleep(50 * time.Millisecond)
+		So(notifications.get("abcdef:owner"), ShouldResemble, []string{"new.pdf", "report-2.pdf"})
+	})
+
+	Convey("Files are not dropped when existing names cannot be checked", t, func() {
+		h, mock, _, ctx := testFileDropResources(&docstore.ShareDocument{FileDrop: true})
+		mock.readErr = errors.InternalServerError("mock", "tree is unavailable")
+		_, e := h.PutObject(ctx, &tree.Node{Path: "ds/drop/new.pdf"}, strings.NewReader("content"), &PutRequestData{Size: 7})
+		So(e, ShouldNotBeNil)
+		So(errors.Parse(e.Error()).Code, ShouldEqual, 500)
+	})
+
+	Convey("Files are only accepted at the first level", t, func() {
+		h, _, _, ctx := testFileDropResources(&docstore.ShareDocument{FileDrop: true})
+		_, e := h.PutObject(ctx, &tree.Node{Path: "ds/drop/sub/new.pdf"}, strings.NewReader("content"), &PutRequestData{Size: 7})
+		So(errors.Parse(e.Error()).Id, ShouldEqual, "FileDropFolder")
+	})
+
+	Convey("Extensions and sizes are checked", t, func() {
+		h, _, _, ctx := testFileDropResources(&docstore.ShareDocument{FileDrop: true, FileDropMaxSize: 10, FileDropExtensions: []string{"pdf", "tar.gz"}})
+		_, e := h.PutObject(ctx, &tree.Node{Path: "ds/drop/run.exe"}, strings.NewReader("content"), &PutRequestData{Size: 7})
+		So(errors.Parse(e.Error()).Id, ShouldEqual, "FileDropExtension")
+		_, e = h.PutObject(ctx, &tree.Node{Path: "ds/drop/Archive.TAR.GZ"}, strings.NewReader("content"), &PutRequestData{Size: 7})
+		So(e, ShouldBeNil)
+		_, e = h.PutObject(ctx, &tree.Node{Path: "ds/drop/big.pdf"}, strings.NewReader("much more content"), &PutRequestData{Size: 17})
+		So(errors.Parse(e.Error()).Id, ShouldEqual, "FileDropTooLarge")
+
+		reader := &fileDropLimitReader{Reader: strings.NewReader("much more content"), remaining: 10, maxSize: 10}
+		_, e = io.Copy(ioutil.Discard, reader)
+		So(errors.Parse(e.Error()).Id, ShouldEqual, "FileDropTooLarge")
+	})
+}
+
+func TestFileDropFilter_Multipart(t *testing.T) {
+
+	Convey("Multipart uploads are redirected to the free name and limited in size", t, func() {
+		h, mock, notifications, ctx := testFileDropResources(&docstore.ShareDocument{FileDrop: true, FileDropMaxSize: 10})
+		uploadID, e := h.MultipartCreate(ctx, &tree.Node{Path: "ds/drop/report.pdf"}, &MultipartRequestData{})
+		So(e, ShouldBeNil)
+		So(mock.Nodes["in"].Path, ShouldEqual, "ds/drop/report-2.pdf")
+		So(uploadID, ShouldStartWith, "upload.id.")
+
+		_, e = h.MultipartPutObjectPart(ctx, &tree.Node{Path: "ds/drop/report.pdf"}, uploadID, 1, strings.NewReader("12345"), &PutRequestData{Size: 5})
+		So(e, ShouldBeNil)
+		So(mock.Nodes["in"].Path, ShouldEqual, "ds/drop/report-2.pdf")
+		// A retried part is not counted twice
+		_, e = h.MultipartPutObjectPart(ctx, &tree.Node{Path: "ds/drop/report.pdf"}, uploadID, 1, strings.NewReader("12345"), &PutRequestData{Size: 5})
+		So(e, ShouldBeNil)
+		_, e = h.MultipartPutObjectPart(ctx, &tree.Node{Path: "ds/drop/report.pdf"}, uploadID, 2, strings.NewReader("123456"), &PutRequestData{Size: 6})
+		So(errors.Parse(e.Error()).Id, ShouldEqual, "FileDropTooLarge")
+
+		_, e = h.MultipartComplete(ctx, &tree.Node{Path: "ds/drop/report.pdf"}, uploadID, []minio.CompletePart{{PartNumber: 1}})
+		So(e, ShouldBeNil)
+		So(mock.Nodes["in"].Path, ShouldEqual, "ds/drop/report-2.pdf")
+
+		_, e = h.MultipartComplete(ctx, &tree.Node{Path: "ds/drop/report.pdf"}, uploadID, []minio.CompletePart{{PartNumber: 1}})
+		So(errors.Parse(e.Error()).Code, ShouldEqual, 404)
+
+		time.Sleep(50 * time.Millisecond)
+		So(notifications.get("abcdef:owner"), ShouldResemble, []string{"report-2.pdf"})
+	})
+
+	Convey("Upload targets do not depend on the instance that created them", t, func() {
+		h, mock, _, ctx := testFileDropResources(&docstore.ShareDocument{FileDrop: true, FileDropMaxSize: 10})
+		uploadID, e := h.MultipartCreate(ctx, &tree.Node{Path: "ds/drop/report.pdf"}, &MultipartRequestData{})
+		So(e, ShouldBeNil)
+
+		other, _, _, ctx := testFileDropResources(&docstore.ShareDocument{FileDrop: true, FileDropMaxSize: 10})
+		other.SetNextHandler(mock)
+		_, e = other.MultipartPutObjectPart(ctx, &tree.Node{Path: "ds/drop/report.pdf"}, uploadID, 1, strings.NewReader("12345"), &PutRequestData{Size: 5})
+		So(e, ShouldBeNil)
+		So(mock.Nodes["in"].Path, ShouldEqual, "ds/drop/report-2.pdf")
+		So(mock.uploads["upload.id"][1], ShouldEqual, 5)
+
+		_, e = other.MultipartPutObjectPart(ctx, &tree.Node{Path: "ds/drop/report.pdf"}, "upload.id", 2, strings.NewReader("12345"), &PutRequestData{Size: 5})
+		So(errors.Parse(e.Error()).Code, ShouldEqual, 404)
+		_, e = other.MultipartPutObjectPart(ctx, &tree.Node{Path: "ds/drop/report.pdf"}, "upload.id.Li4", 2, strings.NewReader("12345"), &PutRequestData{Size: 5})
+		So(errors.Parse(e.Error()).Code, ShouldEqual, 404)
+	})
+}
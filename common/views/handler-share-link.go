@@ -0,0 +1,386 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package views
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/client"
+	"github.com/micro/go-micro/errors"
+	"github.com/micro/go-micro/metadata"
+	"github.com/patrickmn/go-cache"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/proto/docstore"
+	"github.com/pmker/yux/common/proto/idm"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/service/context"
+	"github.com/pmker/yux/common/utils"
+)
+
+var (
+	// shareLinksCounterLock serializes the updates of links downloads counters inside this process.
+	// Updates from other processes are detected by the docstore, see countDownload.
+	shareLinksCounterLock sync.Mutex
+	// shareLinksCounterRetries is the number of times a counter update is retried when the link was concurrently modified.
+	shareLinksCounterRetries = 10
+	// shareLinksDownloads keeps track of the downloads recently counted for each client, so that the ranges
+	// requested to continue a download are not counted again.
+	shareLinksDownloads = cache.New(10*time.Minute, 20*time.Minute)
+)
+
+// shareLinksStore abstracts the accesses to the public links documents.
+type shareLinksStore interface {
+	// LinkForUser finds the link created along with a hidden user. It returns nil if there is none.
+	LinkForUser(ctx context.Context, login string) (*docstore.Document, error)
+	// GetLink loads a link document by its hash.
+	GetLink(ctx context.Context, hash string) (*docstore.Document, error)
+	// PutLink stores a link document if its current data is still equal to expectedData,
+	// and returns a Conflict error otherwise.
+	PutLink(ctx context.Context, doc *docstore.Document, expectedData string) error
+}
+
+// ShareLinkFilter enforces the restrictions of public links for the hidden users created along with them:
+// activation and expiration dates are checked on each read or write, and downloads are counted against
+// the link maximum. Each download is published as a READ event carrying the link information, so that
+// the link owner is notified.
+type ShareLinkFilter struct {
+	AbstractHandler
+	links shareLinksStore
+}
+
+// NewShareLinkFilter creates a ShareLinkFilter loading links from the docstore.
+func NewShareLinkFilter() *ShareLinkFilter {
+	return &ShareLinkFilter{
+		links: &docstoreShareLinks{},
+	}
+}
+
+// GetObject checks the link restrictions and counts the download before reading the object.
+// Ranges continuing a download recently counted for the same client are only checked against the link dates.
+func (s *ShareLinkFilter) GetObject(ctx context.Context, node *tree.Node, requestData *GetRequestData) (io.ReadCloser, error) {
+
+	doc, linkData, e := s.linkFromContext(ctx)
+	if e != nil {
+		return nil, e
+	}
+	if linkData == nil {
+		return s.next.GetObject(ctx, node, requestData)
+	}
+	downloadKey := shareLinkDownloadKey(ctx, doc.ID, node)
+	if downloadKey != "" && requestData != nil && requestData.StartOffset > 0 {
+		if _, ok := shareLinksDownloads.Get(downloadKey); ok {
+			if e := checkShareLinkAccess(linkData, time.Now(), false); e != nil {
+				return nil, e
+			}
+			return s.next.GetObject(ctx, node, requestData)
+		}
+	}
+	if e := checkShareLinkAccess(linkData, time.Now(), true); e != nil {
+		return nil, e
+	}
+	// Thumbnails and other binaries are not counted as downloads
+	if branchInfo, ok := GetBranchInfo(ctx, "in"); ok && branchInfo.Binary {
+		return s.next.GetObject(ctx, node, requestData)
+	}
+
+	counted, e := s.countDownload(ctx, doc.ID, 1)
+	if e != nil {
+		return nil, e
+	}
+	download := &docstore.ShareLinkDownload{
+		LinkHash:      doc.ID,
+		OwnerId:       counted.OwnerId,
+		DownloadCount: counted.DownloadCount,
+		DownloadLimit: counted.DownloadLimit,
+	}
+	reader, e := s.next.GetObject(context.WithValue(ctx, ctxShareLinkKey{}, download), node, requestData)
+	if e != nil {
+		// Nothing was served, give the download back
+		if _, er := s.countDownload(ctx, doc.ID, -1); er != nil {
+			log.Logger(ctx).Error("Cannot restore share link downloads count", zap.String("link", doc.ID), zap.Error(er))
+		}
+		return reader, e
+	}
+	if downloadKey != "" {
+		shareLinksDownloads.Set(downloadKey, true, cache.DefaultExpiration)
+	}
+	s.publishDownload(ctx, node, download)
+
+	return reader, nil
+}
+
+// shareLinkDownloadKey identifies the download of a node through a link by the current client, so that only this
+// client can continue it. It is empty if the client address is unknown, each request is then counted.
+func shareLinkDownloadKey(ctx context.Context, hash string, node *tree.Node) string {
+	meta, ok := metadata.FromContext(ctx)
+	if !ok || meta[servicecontext.HttpMetaRemoteAddress] == "" {
+		return ""
+	}
+	return strings.Join([]string{hash, meta[servicecontext.HttpMetaRemoteAddress], meta["X-Pydio-Session"], node.Path}, ":")
+}
+
+// CreateNode refuses modifications on links that are not active.
+func (s *ShareLinkFilter) CreateNode(ctx context.Context, in *tree.CreateNodeRequest, opts ...client.CallOption) (*tree.CreateNodeResponse, error) {
+	if e := s.checkWriteAccess(ctx); e != nil {
+		return nil, e
+	}
+	return s.next.CreateNode(ctx, in, opts...)
+}
+
+// UpdateNode refuses modifications on links that are not active.
+func (s *ShareLinkFilter) UpdateNode(ctx context.Context, in *tree.UpdateNodeRequest, opts ...client.CallOption) (*tree.UpdateNodeResponse, error) {
+	if e := s.checkWriteAccess(ctx); e != nil {
+		return nil, e
+	}
+	return s.next.UpdateNode(ctx, in, opts...)
+}
+
+// DeleteNode refuses modifications on links that are not active.
+func (s *ShareLinkFilter) DeleteNode(ctx context.Context, in *tree.DeleteNodeRequest, opts ...client.CallOption) (*tree.DeleteNodeResponse, error) {
+	if e := s.checkWriteAccess(ctx); e != nil {
+		return nil, e
+	}
+	return s.next.DeleteNode(ctx, in, opts...)
+}
+
+// PutObject refuses uploads on links that are not active.
+func (s *ShareLinkFilter) PutObject(ctx context.Context, node *tree.Node, reader io.Reader, requestData *PutRequestData) (int64, error) {
+	if e := s.checkWriteAccess(ctx); e != nil {
+		return 0, e
+	}
+	return s.next.PutObject(ctx, node, reader, requestData)
+}
+
+// CopyObject refuses modifications on links that are not active.
+func (s *ShareLinkFilter) CopyObject(ctx context.Context, from *tree.Node, to *tree.Node, requestData *CopyRequestData) (int64, error) {
+	if e := s.checkWriteAccess(ctx); e != nil {
+		return 0, e
+	}
+	return s.next.CopyObject(ctx, from, to, requestData)
+}
+
+// MultipartCreate refuses uploads on links that are not active.
+func (s *ShareLinkFilter) MultipartCreate(ctx context.Context, target *tree.Node, requestData *MultipartRequestData) (string, error) {
+	if e := s.checkWriteAccess(ctx); e != nil {
+		return "", e
+	}
+	return s.next.MultipartCreate(ctx, target, requestData)
+}
+
+// checkWriteAccess verifies the link dates if the current user is a hidden one.
+func (s *ShareLinkFilter) checkWriteAccess(ctx context.Context) error {
+	if _, linkData, e := s.linkFromContext(ctx); e != nil {
+		return e
+	} else if linkData != nil {
+		return checkShareLinkAccess(linkData, time.Now(), false)
+	}
+	return nil
+}
+
+// linkFromContext loads the link associated to the current user, if it is a hidden one.
+func (s *ShareLinkFilter) linkFromContext(ctx context.Context) (*docstore.Document, *docstore.ShareDocument, error) {
+	return loadShareLink(ctx, s.links)
+}
+
+// loadedShareLink is stored in context by the first handler loading the link of the current user.
+type loadedShareLink struct {
+	doc  *docstore.Document
+	data *docstore.ShareDocument
+}
+
+// withShareLink stores the link of the current user in context, so that next handlers do not reload it.
+func withShareLink(ctx context.Context, doc *docstore.Document, linkData *docstore.ShareDocument) context.Context {
+	return context.WithValue(ctx, ctxShareLinkDocKey{}, &loadedShareLink{doc: doc, data: linkData})
+}
+
+// loadShareLink finds the link associated to the current user, if it is a hidden one.
+func loadShareLink(ctx context.Context, links shareLinksStore) (*docstore.Document, *docstore.ShareDocument, error) {
+
+	if loaded, ok := ctx.Value(ctxShareLinkDocKey{}).(*loadedShareLink); ok {
+		return loaded.doc, loaded.data, nil
+	}
+	userLogin, claims := utils.FindUserNameInContext(ctx)
+	// TODO - Have the 'hidden' info directly in claims => could it be a profile instead ?
+	if claims.Profile != common.PYDIO_PROFILE_SHARED {
+		return nil, nil, nil
+	}
+	doc, e := links.LinkForUser(ctx, userLogin)
+	if e != nil || doc == nil {
+		return nil, nil, e
+	}
+	var linkData *docstore.ShareDocument
+	if e := json.Unmarshal([]byte(doc.Data), &linkData); e != nil {
+		return nil, nil, e
+	}
+	return doc, linkData, nil
+}
+
+// countDownload reloads the link and updates its downloads count. Incrementing fails if the link maximum is reached.
+// The link is only stored if it was not modified since it was loaded, otherwise the update is retried.
+func (s *ShareLinkFilter) countDownload(ctx context.Context, hash string, delta int64) (*docstore.ShareDocument, error) {
+
+	shareLinksCounterLock.Lock()
+	defer shareLinksCounterLock.Unlock()
+
+	for i := 0; i < shareLinksCounterRetries; i++ {
+		linkData, e := s.updateDownloadCount(ctx, hash, delta)
+		if e != nil && errors.Parse(e.Error()).Code == 409 {
+			log.Logger(ctx).Debug("Share link was modified concurrently, retrying", zap.String("link", hash))
+			continue
+		}
+		return linkData, e
+	}
+	return nil, errors.New(VIEWS_LIBRARY_NAME, "Cannot update downloads count of link "+hash, 409)
+}
+
+// updateDownloadCount loads the link, updates its downloads count and stores it back if it was not modified meanwhile.
+func (s *ShareLinkFilter) updateDownloadCount(ctx context.Context, hash string, delta int64) (*docstore.ShareDocument, error) {
+
+	doc, e := s.links.GetLink(ctx, hash)
+	if e != nil {
+		return nil, e
+	}
+	if doc == nil {
+		return nil, errors.NotFound(VIEWS_LIBRARY_NAME, "Cannot find link "+hash)
+	}
+	var linkData *docstore.ShareDocument
+	if e := json.Unmarshal([]byte(doc.Data), &linkData); e != nil {
+		return nil, e
+	}
+	if delta > 0 && linkData.DownloadLimit > 0 && linkData.DownloadCount >= linkData.DownloadLimit {
+		return nil, errors.Forbidden("MaxDownloadsReached", "You are not allowed to download this document")
+	}
+	linkData.DownloadCount += delta
+	if linkData.DownloadCount < 0 {
+		linkData.DownloadCount = 0
+	}
+	expectedData := doc.Data
+	data, _ := json.Marshal(linkData)
+	doc.Data = string(data)
+	doc.IndexableMeta = string(data)
+	if e := s.links.PutLink(ctx, doc, expectedData); e != nil {
+		return nil, e
+	}
+	return linkData, nil
+}
+
+// publishDownload sends a READ event for the downloaded node, with the link information attached.
+func (s *ShareLinkFilter) publishDownload(ctx context.Context, node *tree.Node, download *docstore.ShareLinkDownload) {
+
+	log.Auditer(ctx).Info(
+		fmt.Sprintf("Downloaded [%s] from public link [%s]", node.Path, download.LinkHash),
+		log.GetAuditId(common.AUDIT_LINK_DOWNLOAD),
+		node.ZapPath(),
+		zap.String(common.KEY_LINK_UUID, download.LinkHash),
+	)
+
+	eventNode := node.Clone()
+	if eventNode.Uuid == "" {
+		if resp, e := s.next.ReadNode(ctx, &tree.ReadNodeRequest{Node: eventNode}); e == nil && resp.Node != nil {
+			eventNode.Uuid = resp.Node.Uuid
+			eventNode.Type = resp.Node.Type
+		}
+	}
+	if eventNode.Uuid == "" {
+		log.Logger(ctx).Debug("ShareLinkFilter did not find Uuid!", node.ZapPath())
+		return
+	}
+	eventNode.SetMeta(common.META_NAMESPACE_SHARE_LINK_DOWNLOAD, download)
+	go func() {
+		client.Publish(ctx, client.NewPublication(common.TOPIC_TREE_CHANGES, &tree.NodeChangeEvent{
+			Type:   tree.NodeChangeEvent_READ,
+			Target: eventNode,
+		}))
+	}()
+}
+
+// checkShareLinkAccess verifies the link dates and, for downloads, its maximum number of downloads.
+func checkShareLinkAccess(linkData *docstore.ShareDocument, now time.Time, download bool) error {
+	if linkData.StartTime > 0 && now.Before(time.Unix(linkData.StartTime, 0)) {
+		return errors.Forbidden("LinkNotActive", "This link is not active yet")
+	}
+	if linkData.ExpireTime > 0 && now.After(time.Unix(linkData.ExpireTime, 0)) {
+		return errors.Forbidden("LinkExpired", "This link has expired")
+	}
+	if download && linkData.DownloadLimit > 0 && linkData.DownloadCount >= linkData.DownloadLimit {
+		return errors.Forbidden("MaxDownloadsReached", "You are not allowed to download this document")
+	}
+	return nil
+}
+
+// docstoreShareLinks loads links from the shares store of the docstore service.
+type docstoreShareLinks struct{}
+
+func (d *docstoreShareLinks) client() docstore.DocStoreClient {
+	return docstore.NewDocStoreClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_DOCSTORE, defaults.NewClient())
+}
+
+// LinkForUser checks that the user is hidden and searches the link by its preset or prelog login.
+func (d *docstoreShareLinks) LinkForUser(ctx context.Context, login string) (*docstore.Document, error) {
+
+	bgContext := context.Background()
+	user, e := utils.SearchUniqueUser(bgContext, login, "", &idm.UserSingleQuery{AttributeName: "hidden", AttributeValue: "true"})
+	if e != nil || user == nil {
+		return nil, nil
+	}
+	for _, field := range []string{"PRESET_LOGIN", "PRELOG_USER"} {
+		stream, e := d.client().ListDocuments(bgContext, &docstore.ListDocumentsRequest{StoreID: common.DOCSTORE_ID_SHARES, Query: &docstore.DocumentQuery{
+			MetaQuery: "+SHARE_TYPE:minisite +" + field + ":" + login,
+		}})
+		if e != nil {
+			return nil, e
+		}
+		r, e := stream.Recv()
+		stream.Close()
+		if e == nil && r.Document != nil {
+			return r.Document, nil
+		}
+	}
+	return nil, nil
+}
+
+func (d *docstoreShareLinks) GetLink(ctx context.Context, hash string) (*docstore.Document, error) {
+	resp, e := d.client().GetDocument(context.Background(), &docstore.GetDocumentRequest{StoreID: common.DOCSTORE_ID_SHARES, DocumentID: hash})
+	if e != nil {
+		return nil, e
+	}
+	return resp.Document, nil
+}
+
+func (d *docstoreShareLinks) PutLink(ctx context.Context, doc *docstore.Document, expectedData string) error {
+	_, e := d.client().PutDocument(context.Background(), &docstore.PutDocumentRequest{
+		StoreID:      common.DOCSTORE_ID_SHARES,
+		DocumentID:   doc.ID,
+		Document:     doc,
+		ExpectedData: expectedData,
+	})
+	return e
+}
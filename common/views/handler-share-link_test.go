@@ -0,0 +1,309 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package views
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/client"
+	"github.com/micro/go-micro/errors"
+	"github.com/micro/go-micro/metadata"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/auth/claim"
+	"github.com/pmker/yux/common/proto/docstore"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/service/context"
+)
+
+// memoryShareLinks keeps links documents in memory, indexed by their hidden user login.
+// The concurrent field simulates another process counting downloads between a GetLink and a PutLink.
+type memoryShareLinks struct {
+	sync.Mutex
+	docs       map[string]*docstore.Document
+	logins     map[string]string
+	concurrent int
+}
+
+func (m *memoryShareLinks) LinkForUser(ctx context.Context, login string) (*docstore.Document, error) {
+	if hash, ok := m.logins[login]; ok {
+		return m.GetLink(ctx, hash)
+	}
+	return nil, nil
+}
+
+func (m *memoryShareLinks) GetLink(ctx context.Context, hash string) (*docstore.Document, error) {
+	m.Lock()
+	defer m.Unlock()
+	if doc, ok := m.docs[hash]; ok {
+		return &docstore.Document{ID: doc.ID, Data: doc.Data, IndexableMeta: doc.IndexableMeta}, nil
+	}
+	return nil, nil
+}
+
+func (m *memoryShareLinks) PutLink(ctx context.Context, doc *docstore.Document, expectedData string) error {
+	m.Lock()
+	defer m.Unlock()
+	if m.concurrent > 0 {
+		m.concurrent--
+		var data *docstore.ShareDocument
+		json.Unmarshal([]byte(m.docs[doc.ID].Data), &data)
+		data.DownloadCount++
+		d, _ := json.Marshal(data)
+		m.docs[doc.ID] = &docstore.Document{ID: doc.ID, Data: string(d), IndexableMeta: string(d)}
+	}
+	if current, ok := m.docs[doc.ID]; ok && current.Data != expectedData {
+		return errors.New("docstore", "Document was modified", 409)
+	}
+	m.docs[doc.ID] = doc
+	return nil
+}
+
+func (m *memoryShareLinks) linkData(hash string) *docstore.ShareDocument {
+	doc, _ := m.GetLink(context.Background(), hash)
+	var data *docstore.ShareDocument
+	json.Unmarshal([]byte(doc.Data), &data)
+	return data
+}
+
+// lockedMock serializes calls to the HandlerMock, which is not safe for concurrent use.
+type lockedMock struct {
+	*HandlerMock
+	sync.Mutex
+}
+
+func (l *lockedMock) ReadNode(ctx context.Context, in *tree.ReadNodeRequest, opts ...client.CallOption) (*tree.ReadNodeResponse, error) {
+	l.Lock()
+	defer l.Unlock()
+	return l.HandlerMock.ReadNode(ctx, in, opts...)
+}
+
+func (l *lockedMock) GetObject(ctx context.Context, node *tree.Node, requestData *GetRequestData) (io.ReadCloser, error) {
+	l.Lock()
+	defer l.Unlock()
+	return l.HandlerMock.GetObject(ctx, node, requestData)
+}
+
+func testShareLinkResources(link *docstore.ShareDocument) (*ShareLinkFilter, *memoryShareLinks, context.Context) {
+
+	link.ShareType = "minisite"
+	link.PreLogUser = "link-user"
+	data, _ := json.Marshal(link)
+	store := &memoryShareLinks{
+		docs:   map[string]*docstore.Document{"abcdef": {ID: "abcdef", Data: string(data), IndexableMeta: string(data)}},
+		logins: map[string]string{"link-user": "abcdef"},
+	}
+	mock := NewHandlerMock()
+	mock.Nodes["/test/file"] = &tree.Node{Path: "/test/file"}
+	h := &ShareLinkFilter{links: store}
+	h.SetNextHandler(&lockedMock{HandlerMock: mock})
+	shareLinksDownloads.Flush()
+
+	ctx := context.WithValue(context.Background(), claim.ContextKey, claim.Claims{Name: "link-user", Profile: common.PYDIO_PROFILE_SHARED})
+	ctx = testShareLinkClient(ctx, "1.2.3.4")
+	return h, store, ctx
+}
+
+// testShareLinkClient sets the remote address of the client in the request metadata.
+func testShareLinkClient(ctx context.Context, address string) context.Context {
+	return metadata.NewContext(ctx, map[string]string{servicecontext.HttpMetaRemoteAddress: address})
+}
+
+func TestShareLinkFilter_GetObject(t *testing.T) {
+
+	Convey("Other users are not filtered", t, func() {
+		h, store, _ := testShareLinkResources(&docstore.ShareDocument{DownloadLimit: 1, DownloadCount: 1})
+		ctx := context.WithValue(context.Background(), claim.ContextKey, claim.Claims{Name: "link-user", Profile: common.PYDIO_PROFILE_STANDARD})
+		_, e := h.GetObject(ctx, &tree.Node{Path: "/test/file"}, &GetRequestData{})
+		So(e, ShouldBeNil)
+		So(store.linkData("abcdef").DownloadCount, ShouldEqual, 1)
+	})
+
+	Convey("Downloads are counted up to the link limit", t, func() {
+		h, store, ctx := testShareLinkResources(&docstore.ShareDocument{DownloadLimit: 2, OwnerId: "owner"})
+		_, e := h.GetObject(ctx, &tree.Node{Path: "/test/file"}, &GetRequestData{})
+		So(e, ShouldBeNil)
+		_, e = h.GetObject(ctx, &tree.Node{Path: "/test/file"}, &GetRequestData{})
+		So(e, ShouldBeNil)
+		So(store.linkData("abcdef").DownloadCount, ShouldEqual, 2)
+
+		_, e = h.GetObject(ctx, &tree.Node{Path: "/test/file"}, &GetRequestData{})
+		So(e, ShouldNotBeNil)
+		So(errors.Parse(e.Error()).Code, ShouldEqual, 403)
+		So(store.linkData("abcdef").DownloadCount, ShouldEqual, 2)
+	})
+
+	Convey("Failed reads do not consume downloads", t, func() {
+		h, store, ctx := testShareLinkResources(&docstore.ShareDocument{DownloadLimit: 1})
+		_, e := h.GetObject(ctx, &tree.Node{Path: "/test/missing"}, &GetRequestData{})
+		So(e, ShouldNotBeNil)
+		So(store.linkData("abcdef").DownloadCount, ShouldEqual, 0)
+	})
+
+	Convey("Concurrent downloads cannot go over the limit", t, func() {
+		h, store, ctx := testShareLinkResources(&docstore.ShareDocument{DownloadLimit: 5})
+		var wg sync.WaitGroup
+		var lock sync.Mutex
+		success := 0
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, e := h.GetObject(ctx, &tree.Node{Path: "/test/file"}, &GetRequestData{}); e == nil {
+					lock.Lock()
+					success++
+					lock.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		So(success, ShouldEqual, 5)
+		So(store.linkData("abcdef").DownloadCount, ShouldEqual, 5)
+	})
+
+	Convey("Links are only readable between their start and expiration dates", t, func() {
+		h, store, ctx := testShareLinkResources(&docstore.ShareDocument{StartTime: time.Now().Add(time.Hour).Unix()})
+		_, e := h.GetObject(ctx, &tree.Node{Path: "/test/file"}, &GetRequestData{})
+		So(e, ShouldNotBeNil)
+		So(errors.Parse(e.Error()).Id, ShouldEqual, "LinkNotActive")
+
+		h, store, ctx = testShareLinkResources(&docstore.ShareDocument{ExpireTime: time.Now().Add(-time.Hour).Unix()})
+		_, e = h.GetObject(ctx, &tree.Node{Path: "/test/file"}, &GetRequestData{})
+		So(e, ShouldNotBeNil)
+		So(errors.Parse(e.Error()).Id, ShouldEqual, "LinkExpired")
+		So(store.linkData("abcdef").DownloadCount, ShouldEqual, 0)
+
+		_, e = h.PutObject(ctx, &tree.Node{Path: "/test/upload"}, nil, &PutRequestData{})
+		So(e, ShouldNotBeNil)
+		So(errors.Parse(e.Error()).Id, ShouldEqual, "LinkExpired")
+	})
+
+	Convey("Downloads counted by other processes are not overwritten", t, func() {
+		h, store, ctx := testShareLinkResources(&docstore.ShareDocument{DownloadLimit: 3})
+		store.concurrent = 2
+		_, e := h.GetObject(ctx, &tree.Node{Path: "/test/file"}, &GetRequestData{})
+		So(e, ShouldBeNil)
+		So(store.linkData("abcdef").DownloadCount, ShouldEqual, 3)
+
+		store.concurrent = 0
+		_, e = h.GetObject(ctx, &tree.Node{Path: "/test/file"}, &GetRequestData{})
+		So(e, ShouldNotBeNil)
+		So(errors.Parse(e.Error()).Id, ShouldEqual, "MaxDownloadsReached")
+	})
+
+	Convey("Ranges continuing a download are not counted again", t, func() {
+		h, store, ctx := testShareLinkResources(&docstore.ShareDocument{DownloadLimit: 1})
+		_, e := h.GetObject(ctx, &tree.Node{Path: "/test/file"}, &GetRequestData{StartOffset: 0, Length: 10})
+		So(e, ShouldBeNil)
+		_, e = h.GetObject(ctx, &tree.Node{Path: "/test/file"}, &GetRequestData{StartOffset: 10, Length: 10})
+		So(e, ShouldBeNil)
+		So(store.linkData("abcdef").DownloadCount, ShouldEqual, 1)
+
+		_, e = h.GetObject(ctx, &tree.Node{Path: "/test/file"}, &GetRequestData{StartOffset: 0})
+		So(e, ShouldNotBeNil)
+		So(errors.Parse(e.Error()).Id, ShouldEqual, "MaxDownloadsReached")
+	})
+
+	Convey("Ranges continuing a download do not extend it", t, func() {
+		h, _, ctx := testShareLinkResources(&docstore.ShareDocument{DownloadLimit: 2})
+		_, e := h.GetObject(ctx, &tree.Node{Path: "/test/file"}, &GetRequestData{StartOffset: 0, Length: 10})
+		So(e, ShouldBeNil)
+		items := shareLinksDownloads.Items()
+		So(items, ShouldHaveLength, 1)
+		time.Sleep(5 * time.Millisecond)
+		_, e = h.GetObject(ctx, &tree.Node{Path: "/test/file"}, &GetRequestData{StartOffset: 10, Length: 10})
+		So(e, ShouldBeNil)
+		So(shareLinksDownloads.Items(), ShouldResemble, items)
+	})
+
+	Convey("Ranges from another client are counted", t, func() {
+		h, store, ctx := testShareLinkResources(&docstore.ShareDocument{DownloadLimit: 2})
+		_, e := h.GetObject(ctx, &tree.Node{Path: "/test/file"}, &GetRequestData{StartOffset: 0})
+		So(e, ShouldBeNil)
+		So(store.linkData("abcdef").DownloadCount, ShouldEqual, 1)
+
+		other := testShareLinkClient(ctx, "5.6.7.8")
+		_, e = h.GetObject(other, &tree.Node{Path: "/test/file"}, &GetRequestData{StartOffset: 1})
+		So(e, ShouldBeNil)
+		So(store.linkData("abcdef").DownloadCount, ShouldEqual, 2)
+
+		_, e = h.GetObject(testShareLinkClient(ctx, "9.9.9.9"), &tree.Node{Path: "/test/file"}, &GetRequestData{StartOffset: 1})
+		So(e, ShouldNotBeNil)
+		So(errors.Parse(e.Error()).Id, ShouldEqual, "MaxDownloadsReached")
+	})
+
+	Convey("Ranges are always counted when the client is unknown", t, func() {
+		h, store, ctx := testShareLinkResources(&docstore.ShareDocument{DownloadLimit: 2})
+		ctx = context.WithValue(context.Background(), claim.ContextKey, claim.Claims{Name: "link-user", Profile: common.PYDIO_PROFILE_SHARED})
+		_, e := h.GetObject(ctx, &tree.Node{Path: "/test/file"}, &GetRequestData{StartOffset: 0})
+		So(e, ShouldBeNil)
+		_, e = h.GetObject(ctx, &tree.Node{Path: "/test/file"}, &GetRequestData{StartOffset: 10})
+		So(e, ShouldBeNil)
+		So(store.linkData("abcdef").DownloadCount, ShouldEqual, 2)
+		So(shareLinksDownloads.ItemCount(), ShouldEqual, 0)
+	})
+
+	Convey("Ranges that do not continue a download are counted", t, func() {
+		h, store, ctx := testShareLinkResources(&docstore.ShareDocument{DownloadLimit: 1})
+		_, e := h.GetObject(ctx, &tree.Node{Path: "/test/file"}, &GetRequestData{StartOffset: 10})
+		So(e, ShouldBeNil)
+		So(store.linkData("abcdef").DownloadCount, ShouldEqual, 1)
+		_, e = h.GetObject(ctx, &tree.Node{Path: "/test/file"}, &GetRequestData{StartOffset: 0})
+		So(e, ShouldNotBeNil)
+	})
+
+}
+
+func TestShareLinkFilter_Writes(t *testing.T) {
+
+	Convey("Modifications are refused on expired links", t, func() {
+		h, _, ctx := testShareLinkResources(&docstore.ShareDocument{ExpireTime: time.Now().Add(-time.Hour).Unix()})
+
+		_, e := h.DeleteNode(ctx, &tree.DeleteNodeRequest{Node: &tree.Node{Path: "/test/file"}})
+		So(e, ShouldNotBeNil)
+		So(errors.Parse(e.Error()).Id, ShouldEqual, "LinkExpired")
+
+		_, e = h.UpdateNode(ctx, &tree.UpdateNodeRequest{From: &tree.Node{Path: "/test/file"}, To: &tree.Node{Path: "/test/moved"}})
+		So(e, ShouldNotBeNil)
+		So(errors.Parse(e.Error()).Id, ShouldEqual, "LinkExpired")
+
+		_, e = h.CopyObject(ctx, &tree.Node{Path: "/test/file"}, &tree.Node{Path: "/test/copy"}, &CopyRequestData{})
+		So(e, ShouldNotBeNil)
+		So(errors.Parse(e.Error()).Id, ShouldEqual, "LinkExpired")
+
+		_, e = h.CreateNode(ctx, &tree.CreateNodeRequest{Node: &tree.Node{Path: "/test/folder"}})
+		So(e, ShouldNotBeNil)
+		So(errors.Parse(e.Error()).Id, ShouldEqual, "LinkExpired")
+	})
+
+	Convey("Modifications are allowed on active links", t, func() {
+		h, _, ctx := testShareLinkResources(&docstore.ShareDocument{ExpireTime: time.Now().Add(time.Hour).Unix()})
+		_, e := h.DeleteNode(ctx, &tree.DeleteNodeRequest{Node: &tree.Node{Path: "/test/file"}})
+		So(e, ShouldBeNil)
+	})
+
+}
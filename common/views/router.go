@@ -72,6 +72,8 @@ func NewStandardRouter(options RouterOptions) *Router {
 	}
 	if !options.AdminView {
 		handlers = append(handlers, &AclFilterHandler{})
+		handlers = append(handlers, NewFileDropFilter())
+		handlers = append(handlers, NewShareLinkFilter())
 	}
 	if options.LogReadEvents {
 		handlers = append(handlers, &HandlerEventRead{})
@@ -84,6 +86,7 @@ func NewStandardRouter(options RouterOptions) *Router {
 	}
 	handlers = append(handlers, &EncryptionHandler{})
 	handlers = append(handlers, &VersionHandler{})
+	handlers = append(handlers, &DedupHandler{})
 	handlers = append(handlers, &Executor{})
 
 	pool := NewClientsPool(options.WatchRegistry)
@@ -105,6 +108,8 @@ func NewUuidRouter(options RouterOptions) *Router {
 
 	if !options.AdminView {
 		handlers = append(handlers, &AclFilterHandler{})
+		handlers = append(handlers, NewFileDropFilter())
+		handlers = append(handlers, NewShareLinkFilter())
 	}
 	handlers = append(handlers, &PutHandler{}) // adds a node precreation on PUT file request
 	if !options.AdminView {
@@ -114,6 +119,7 @@ func NewUuidRouter(options RouterOptions) *Router {
 	}
 	handlers = append(handlers, &EncryptionHandler{}) // retrieves encryption materials from encryption service
 	handlers = append(handlers, &VersionHandler{})
+	handlers = append(handlers, &DedupHandler{}) // stores content once per datasource if enabled
 	handlers = append(handlers, &Executor{})
 
 	pool := NewClientsPool(options.WatchRegistry)
@@ -74,14 +74,19 @@ const (
 	AUDIT_POLICY_DELETE       = "64"
 
 	// ShareLinks And Cells
-	AUDIT_CELL_CREATE = "71"
-	AUDIT_CELL_READ   = "72"
-	AUDIT_CELL_UPDATE = "73"
-	AUDIT_CELL_DELETE = "74"
-	AUDIT_LINK_CREATE = "75"
-	AUDIT_LINK_READ   = "76"
-	AUDIT_LINK_UPDATE = "77"
-	AUDIT_LINK_DELETE = "78"
+	AUDIT_CELL_CREATE   = "71"
+	AUDIT_CELL_READ     = "72"
+	AUDIT_CELL_UPDATE   = "73"
+	AUDIT_CELL_DELETE   = "74"
+	AUDIT_LINK_CREATE   = "75"
+	AUDIT_LINK_READ     = "76"
+	AUDIT_LINK_UPDATE   = "77"
+	AUDIT_LINK_DELETE   = "78"
+	AUDIT_LINK_DOWNLOAD = "79"
+
+	// Quotas
+	AUDIT_QUOTA_UPDATE = "81"
+	AUDIT_QUOTA_DELETE = "82"
 )
 
 // Known audit message IDs
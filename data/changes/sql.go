@@ -56,7 +56,7 @@ var (
 		"countChanges":      `SELECT COUNT(*) FROM data_changes`,
 		"firstSeq":          `SELECT MIN(seq) FROM data_changes`,
 		"lastSeq":           `SELECT MAX(seq) FROM data_changes`,
-		"nodeById":          `SELECT node_id FROM data_changes WHERE node_id = ? LIMIT 0,1`,
+		"nodeById":          `SELECT node_id FROM data_changes WHERE node_id = ? LIMIT 1`,
 		"delete":            `DELETE FROM data_changes where seq <= ?`,
 		"archive":           `INSERT INTO data_changes_archive (seq, node_id, type, source, target) SELECT seq, node_id, type, source, target from data_changes where seq <= ?`,
 	}
@@ -111,6 +111,54 @@ func (s *BoltStore) PutDocument(storeID string, doc *docstore.Document) error {
 
 }
 
+func (s *BoltStore) SwapDocument(storeID string, doc *docstore.Document, expectedData string) error {
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+
+		bucket, err := s.GetStore(tx, storeID, "write")
+		if err != nil {
+			return err
+		}
+		current := &docstore.Document{}
+		if data := bucket.Get([]byte(doc.ID)); data == nil {
+			return errors.NotFound(common.SERVICE_DOCSTORE, "Doc ID not found")
+		} else if err := json.Unmarshal(data, current); err != nil {
+			return errors.InternalServerError(common.SERVICE_DOCSTORE, "Cannot deserialize document")
+		}
+		if current.Data != expectedData {
+			return errors.New(common.SERVICE_DOCSTORE, "Document was modified", 409)
+		}
+		jsonData, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(doc.ID), jsonData)
+
+	})
+
+}
+
+func (s *BoltStore) CreateDocument(storeID string, doc *docstore.Document) error {
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+
+		bucket, err := s.GetStore(tx, storeID, "write")
+		if err != nil {
+			return err
+		}
+		if bucket.Get([]byte(doc.ID)) != nil {
+			return errors.New(common.SERVICE_DOCSTORE, "Document already exists", 409)
+		}
+		jsonData, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(doc.ID), jsonData)
+
+	})
+
+}
+
 func (s *BoltStore) GetDocument(storeID string, docId string) (*docstore.Document, error) {
 
 	j := &docstore.Document{}
@@ -24,7 +24,10 @@ import (
 	"os"
 	"testing"
 
+	"github.com/micro/go-micro/errors"
 	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/proto/docstore"
 )
 
 func TestNewBoltStore(t *testing.T) {
@@ -43,3 +46,50 @@ func TestNewBoltStore(t *testing.T) {
 
 	})
 }
+
+func TestBoltStore_SwapDocument(t *testing.T) {
+
+	Convey("Test SwapDocument", t, func() {
+
+		bs, e := NewBoltStore(newPath("bolt-test-swap.db"), true)
+		So(e, ShouldBeNil)
+		defer bs.Close()
+
+		e = bs.SwapDocument("store", &docstore.Document{ID: "doc", Data: "v1"}, "v0")
+		So(e, ShouldNotBeNil)
+		So(errors.Parse(e.Error()).Code, ShouldEqual, 404)
+
+		So(bs.PutDocument("store", &docstore.Document{ID: "doc", Data: "v1"}), ShouldBeNil)
+		So(bs.SwapDocument("store", &docstore.Document{ID: "doc", Data: "v2"}, "v1"), ShouldBeNil)
+
+		e = bs.SwapDocument("store", &docstore.Document{ID: "doc", Data: "v3"}, "v1")
+		So(e, ShouldNotBeNil)
+		So(errors.Parse(e.Error()).Code, ShouldEqual, 409)
+
+		doc, e := bs.GetDocument("store", "doc")
+		So(e, ShouldBeNil)
+		So(doc.Data, ShouldEqual, "v2")
+
+	})
+}
+
+func TestBoltStore_CreateDocument(t *testing.T) {
+
+	Convey("Test CreateDocument", t, func() {
+
+		bs, e := NewBoltStore(newPath("bolt-test-create.db"), true)
+		So(e, ShouldBeNil)
+		defer bs.Close()
+
+		So(bs.CreateDocument("store", &docstore.Document{ID: "doc", Data: "v1"}), ShouldBeNil)
+
+		e = bs.CreateDocument("store", &docstore.Document{ID: "doc", Data: "v2"})
+		So(e, ShouldNotBeNil)
+		So(errors.Parse(e.Error()).Code, ShouldEqual, 409)
+
+		doc, e := bs.GetDocument("store", "doc")
+		So(e, ShouldBeNil)
+		So(doc.Data, ShouldEqual, "v1")
+
+	})
+}
@@ -32,6 +32,10 @@ import (
 
 type Store interface {
 	PutDocument(storeID string, doc *docstore.Document) error
+	// SwapDocument replaces a document only if its current data is equal to expectedData, and returns a Conflict error otherwise.
+	SwapDocument(storeID string, doc *docstore.Document, expectedData string) error
+	// CreateDocument stores a document only if it does not exist yet, and returns a Conflict error otherwise.
+	CreateDocument(storeID string, doc *docstore.Document) error
 	GetDocument(storeID string, docId string) (*docstore.Document, error)
 	DeleteDocument(storeID string, docID string) error
 	ListDocuments(storeID string, query *docstore.DocumentQuery) (chan *docstore.Document, chan bool, error)
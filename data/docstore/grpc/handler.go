@@ -44,7 +44,14 @@ func (h *Handler) Close() error {
 }
 
 func (h *Handler) PutDocument(ctx context.Context, request *proto.PutDocumentRequest, response *proto.PutDocumentResponse) error {
-	e := h.Db.PutDocument(request.StoreID, request.Document)
+	var e error
+	if request.ExpectedData != "" {
+		e = h.Db.SwapDocument(request.StoreID, request.Document, request.ExpectedData)
+	} else if request.CreateOnly {
+		e = h.Db.CreateDocument(request.StoreID, request.Document)
+	} else {
+		e = h.Db.PutDocument(request.StoreID, request.Document)
+	}
 	log.Logger(ctx).Debug("PutDocument", zap.String("store", request.StoreID), zap.String("docId", request.Document.ID))
 	if e != nil {
 		log.Logger(ctx).Error("PutDocument", zap.Error(e))
@@ -37,6 +37,15 @@ type DAO interface {
 	DeleteNodeKey(node string, user string) error
 	DeleteNodeSharedKey(node string, ownerId string, userId string) error
 	DeleteNodeAllSharedKey(node string, ownerId string) error
+
+	// ListNodeKeys lists keys stored for userId, ordered by node id and starting after afterNodeId
+	ListNodeKeys(userId string, afterNodeId string, limit int) ([]*encryption.NodeKey, error)
+	CountNodeKeys(userId string) (int64, error)
+	UpdateNodeKey(nodeUuid string, userId string, keyData []byte) error
+
+	SaveKeyRotation(rotation *encryption.KeyRotation) error
+	GetKeyRotation(dataSource string) (*encryption.KeyRotation, error)
+	ListKeyRotations() ([]*encryption.KeyRotation, error)
 }
 
 func NewDAO(o dao.DAO) dao.DAO {
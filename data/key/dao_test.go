@@ -28,6 +28,7 @@ import (
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/pmker/yux/common/config"
+	"github.com/pmker/yux/common/proto/encryption"
 	"github.com/pmker/yux/common/sql"
 )
 
@@ -89,6 +90,20 @@ func TestSqlimpl_GetNodeKey(t *testing.T) {
 	})
 }
 
+func TestSqlimpl_GetNodeOwnerKey(t *testing.T) {
+	convey.Convey("Get node owner key", t, func() {
+		k, err := mockDAO.GetNodeKey("node_id", "")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(k, convey.ShouldNotBeNil)
+		convey.So(k.UserId, convey.ShouldEqual, "pydio")
+		convey.So(k.OwnerId, convey.ShouldEqual, "pydio")
+
+		k, err = mockDAO.GetNodeKey("unknown_node", "")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(k, convey.ShouldBeNil)
+	})
+}
+
 func TestSqlimpl_DeleteNodeSharedKey(t *testing.T) {
 	convey.Convey("Get node key", t, func() {
 		err := mockDAO.DeleteNodeSharedKey("node_id", "pydio", "user-1")
@@ -109,3 +124,71 @@ func TestSqlimpl_DeleteNode(t *testing.T) {
 		convey.So(err, convey.ShouldBeNil)
 	})
 }
+
+func TestSqlimpl_ListNodeKeys(t *testing.T) {
+	convey.Convey("List and update node keys of a user", t, func() {
+		for _, n := range []string{"list-1", "list-2", "list-3"} {
+			convey.So(mockDAO.InsertNode(n, []byte("nonce"), 4), convey.ShouldBeNil)
+			convey.So(mockDAO.SetNodeKey(n, "ds:list", "ds:list", []byte("key")), convey.ShouldBeNil)
+		}
+
+		keys, err := mockDAO.ListNodeKeys("ds:list", "", 2)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(keys, convey.ShouldHaveLength, 2)
+		convey.So(keys[0].NodeId, convey.ShouldEqual, "list-1")
+
+		keys, err = mockDAO.ListNodeKeys("ds:list", "list-2", 2)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(keys, convey.ShouldHaveLength, 1)
+		convey.So(keys[0].NodeId, convey.ShouldEqual, "list-3")
+
+		count, err := mockDAO.CountNodeKeys("ds:list")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(count, convey.ShouldEqual, 3)
+
+		convey.So(mockDAO.UpdateNodeKey("list-3", "ds:list", []byte("new-key")), convey.ShouldBeNil)
+		k, err := mockDAO.GetNodeKey("list-3", "ds:list")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(string(k.Data), convey.ShouldEqual, "new-key")
+	})
+}
+
+func TestSqlimpl_KeyRotation(t *testing.T) {
+	convey.Convey("Save and retrieve key rotations", t, func() {
+		r, err := mockDAO.GetKeyRotation("rotated")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(r, convey.ShouldBeNil)
+
+		rotation := &encryption.KeyRotation{
+			DataSource:   "rotated",
+			OldKeyID:     "old",
+			NewKeyID:     "new",
+			Status:       encryption.KeyRotationStatus_RotationRunning,
+			Total:        10,
+			RetireOldKey: true,
+			StartTime:    1,
+			UpdateTime:   1,
+		}
+		convey.So(mockDAO.SaveKeyRotation(rotation), convey.ShouldBeNil)
+
+		rotation.Status = encryption.KeyRotationStatus_RotationError
+		rotation.Cursor = "node"
+		rotation.Rewrapped = 4
+		rotation.Error = "failed"
+		convey.So(mockDAO.SaveKeyRotation(rotation), convey.ShouldBeNil)
+
+		r, err = mockDAO.GetKeyRotation("rotated")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(r, convey.ShouldNotBeNil)
+		convey.So(r.Status, convey.ShouldEqual, encryption.KeyRotationStatus_RotationError)
+		convey.So(r.Cursor, convey.ShouldEqual, "node")
+		convey.So(r.Rewrapped, convey.ShouldEqual, 4)
+		convey.So(r.Total, convey.ShouldEqual, 10)
+		convey.So(r.RetireOldKey, convey.ShouldBeTrue)
+		convey.So(r.Error, convey.ShouldEqual, "failed")
+
+		list, err := mockDAO.ListKeyRotations()
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(list, convey.ShouldHaveLength, 1)
+	})
+}
@@ -77,6 +77,7 @@ func (km *NodeKeyManagerHandler) SetNodeParams(ctx context.Context, req *encrypt
 	return keyDao.InsertNode(req.NodeId, req.Params.Nonce, req.Params.BlockSize)
 }
 
+// GetNodeKey finds the node key stored for req.UserId, or the key of the node owner if no user is set.
 func (km *NodeKeyManagerHandler) GetNodeKey(ctx context.Context, req *encryption.GetNodeKeyRequest, rsp *encryption.GetNodeKeyResponse) error {
 	dao := servicecontext.GetDAO(ctx)
 	if dao == nil {
@@ -24,8 +24,10 @@ package grpc
 import (
 	"github.com/micro/go-micro"
 	"github.com/pmker/yux/common/plugins"
+	"go.uber.org/zap"
 
 	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/log"
 	"github.com/pmker/yux/common/proto/encryption"
 	"github.com/pmker/yux/common/service"
 	"github.com/pmker/yux/data/key"
@@ -45,6 +47,14 @@ func init() {
 				if err := m.Options().Server.Subscribe(m.Options().Server.NewSubscriber(common.TOPIC_TREE_CHANGES, h.HandleTreeChanges)); err != nil {
 					return err
 				}
+
+				ctx := m.Options().Context
+				m.Init(micro.AfterStart(func() error {
+					if err := ResumeKeyRotations(ctx); err != nil {
+						log.Logger(ctx).Error("Cannot resume key rotations", zap.Error(err))
+					}
+					return nil
+				}))
 				return nil
 			}),
 		)
@@ -0,0 +1,265 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/client"
+	"github.com/micro/go-micro/errors"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/auth"
+	"github.com/pmker/yux/common/auth/claim"
+	"github.com/pmker/yux/common/config"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/proto/encryption"
+	"github.com/pmker/yux/common/proto/object"
+	"github.com/pmker/yux/common/service/context"
+	"github.com/pmker/yux/data/key"
+	idmkey "github.com/pmker/yux/idm/key"
+)
+
+var (
+	runningRotations = make(map[string]bool)
+	rotationsLock    sync.Mutex
+)
+
+// RotateKey replaces the key sealing node keys of a datasource encrypted in MASTER mode. A new key is created in the
+// key store and every node key is rewrapped in background: files content is not re-encrypted. Calling it again on a
+// datasource whose rotation did not complete resumes that rotation.
+func (km *NodeKeyManagerHandler) RotateKey(ctx context.Context, req *encryption.RotateKeyRequest, rsp *encryption.RotateKeyResponse) error {
+	dao := servicecontext.GetDAO(ctx)
+	if dao == nil {
+		return errors.InternalServerError(common.SERVICE_ENC_KEY, "no DAO found, wrong initialization")
+	}
+	keyDao := dao.(key.DAO)
+
+	rotation, err := keyDao.GetKeyRotation(req.DataSource)
+	if err != nil {
+		return err
+	}
+	if rotation != nil && rotation.Status != encryption.KeyRotationStatus_RotationDone {
+		log.Logger(ctx).Info("Resuming key rotation for datasource "+req.DataSource, zap.String("from", rotation.OldKeyID), zap.String("to", rotation.NewKeyID))
+		startRotation(servicecontext.WithDAO(context.Background(), keyDao), rotation)
+		rsp.Rotation = rotation
+		return nil
+	}
+
+	ds, ok := config.ListSourcesFromConfig()[req.DataSource]
+	if !ok {
+		return errors.NotFound(common.SERVICE_ENC_KEY, fmt.Sprintf("cannot find datasource %s", req.DataSource))
+	}
+	if ds.EncryptionMode != object.EncryptionMode_MASTER || ds.EncryptionKey == "" {
+		return errors.BadRequest(common.SERVICE_ENC_KEY, fmt.Sprintf("datasource %s is not encrypted with a master key", req.DataSource))
+	}
+
+	newKeyID := req.NewKeyID
+	if newKeyID == "" {
+		newKeyID = fmt.Sprintf("%s-%s", req.DataSource, time.Now().Format("20060102150405"))
+	}
+	label := req.NewKeyLabel
+	if label == "" {
+		label = newKeyID
+	}
+	keyClient := encryption.NewUserKeyStoreClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_USER_KEY, defaults.NewClient())
+	if _, err := keyClient.AdminCreateKey(adminContext(ctx), &encryption.AdminCreateKeyRequest{KeyID: newKeyID, Label: label}); err != nil {
+		return err
+	}
+
+	total, err := keyDao.CountNodeKeys(key.DataSourceKeyOwner(req.DataSource))
+	if err != nil {
+		return err
+	}
+	now := int32(time.Now().Unix())
+	rotation = &encryption.KeyRotation{
+		DataSource:   req.DataSource,
+		OldKeyID:     ds.EncryptionKey,
+		NewKeyID:     newKeyID,
+		Status:       encryption.KeyRotationStatus_RotationRunning,
+		Total:        total,
+		RetireOldKey: !req.KeepOldKey,
+		StartTime:    now,
+		UpdateTime:   now,
+	}
+	if err := keyDao.SaveKeyRotation(rotation); err != nil {
+		return err
+	}
+
+	log.Logger(ctx).Info("Starting key rotation for datasource "+req.DataSource, zap.String("from", rotation.OldKeyID), zap.String("to", rotation.NewKeyID), zap.Int64("keys", total))
+	startRotation(servicecontext.WithDAO(context.Background(), keyDao), rotation)
+	rsp.Rotation = rotation
+	return nil
+}
+
+// GetKeyRotation returns the last key rotation started for a datasource.
+func (km *NodeKeyManagerHandler) GetKeyRotation(ctx context.Context, req *encryption.GetKeyRotationRequest, rsp *encryption.GetKeyRotationResponse) error {
+	dao := servicecontext.GetDAO(ctx)
+	if dao == nil {
+		return errors.InternalServerError(common.SERVICE_ENC_KEY, "no DAO found, wrong initialization")
+	}
+	keyDao := dao.(key.DAO)
+
+	rotation, err := keyDao.GetKeyRotation(req.DataSource)
+	if err != nil {
+		return err
+	}
+	if rotation == nil {
+		return errors.NotFound(common.SERVICE_ENC_KEY, fmt.Sprintf("no key rotation found for datasource %s", req.DataSource))
+	}
+	rsp.Rotation = rotation
+	return nil
+}
+
+// ResumeKeyRotations restarts the rotations that were interrupted, typically by a service restart.
+func ResumeKeyRotations(ctx context.Context) error {
+	dao := servicecontext.GetDAO(ctx)
+	if dao == nil {
+		return errors.InternalServerError(common.SERVICE_ENC_KEY, "no DAO found, wrong initialization")
+	}
+	keyDao := dao.(key.DAO)
+
+	rotations, err := keyDao.ListKeyRotations()
+	if err != nil {
+		return err
+	}
+	for _, r := range rotations {
+		if r.Status == encryption.KeyRotationStatus_RotationRunning || r.Status == encryption.KeyRotationStatus_RotationFinalizing {
+			log.Logger(ctx).Info("Resuming key rotation for datasource "+r.DataSource, zap.String("cursor", r.Cursor))
+			startRotation(ctx, r)
+		}
+	}
+	return nil
+}
+
+// startRotation runs a rotation in background, unless one is already running for the same datasource.
+func startRotation(ctx context.Context, rotation *encryption.KeyRotation) {
+	rotationsLock.Lock()
+	defer rotationsLock.Unlock()
+	if runningRotations[rotation.DataSource] {
+		return
+	}
+	runningRotations[rotation.DataSource] = true
+
+	go func() {
+		defer func() {
+			rotationsLock.Lock()
+			delete(runningRotations, rotation.DataSource)
+			rotationsLock.Unlock()
+		}()
+		keyDao := servicecontext.GetDAO(ctx).(key.DAO)
+		if err := runRotation(ctx, keyDao, rotation); err != nil {
+			log.Logger(ctx).Error("Key rotation failed for datasource "+rotation.DataSource, zap.Error(err))
+			rotation.Status = encryption.KeyRotationStatus_RotationError
+			rotation.Error = err.Error()
+			rotation.UpdateTime = int32(time.Now().Unix())
+			keyDao.SaveKeyRotation(rotation)
+		}
+	}()
+}
+
+// runRotation rewraps all node keys, switches the datasource to the new key, then sweeps the keys that were
+// created with the old key in the meantime. The old key is finally removed from the key store if required.
+func runRotation(ctx context.Context, keyDao key.DAO, rotation *encryption.KeyRotation) error {
+
+	tool, err := idmkey.MasterKeyTool(ctx)
+	if err != nil {
+		return err
+	}
+	rotation.Error = ""
+
+	if rotation.Status != encryption.KeyRotationStatus_RotationFinalizing {
+		ds, ok := config.ListSourcesFromConfig()[rotation.DataSource]
+		if !ok {
+			return fmt.Errorf("cannot find datasource %s", rotation.DataSource)
+		}
+		if ds.EncryptionKey == rotation.NewKeyID {
+			// Failed after switching the datasource key
+			rotation.Status = encryption.KeyRotationStatus_RotationFinalizing
+		} else {
+			rotation.Status = encryption.KeyRotationStatus_RotationRunning
+			if _, err := key.RewrapNodeKeys(ctx, keyDao, tool, rotation); err != nil {
+				return err
+			}
+			if err := switchDataSourceKey(ctx, ds, rotation.NewKeyID); err != nil {
+				return err
+			}
+			rotation.Status = encryption.KeyRotationStatus_RotationFinalizing
+			rotation.Cursor = ""
+			rotation.UpdateTime = int32(time.Now().Unix())
+			if err := keyDao.SaveKeyRotation(rotation); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Nodes written before every gateway picked up the new datasource key are still sealed with the old key
+	for {
+		count, err := key.RewrapNodeKeys(ctx, keyDao, tool, rotation)
+		if err != nil {
+			return err
+		}
+		rotation.Cursor = ""
+		if count == 0 {
+			break
+		}
+	}
+
+	if rotation.RetireOldKey {
+		keyClient := encryption.NewUserKeyStoreClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_USER_KEY, defaults.NewClient())
+		if _, err := keyClient.AdminDeleteKey(adminContext(ctx), &encryption.AdminDeleteKeyRequest{KeyID: rotation.OldKeyID}); err != nil {
+			return err
+		}
+	}
+
+	rotation.Status = encryption.KeyRotationStatus_RotationDone
+	rotation.UpdateTime = int32(time.Now().Unix())
+	log.Logger(ctx).Info("Key rotation done for datasource "+rotation.DataSource, zap.Int64("rewrapped", rotation.Rewrapped))
+	return keyDao.SaveKeyRotation(rotation)
+}
+
+// switchDataSourceKey stores the new key in the datasource configuration and notifies the datasource update.
+func switchDataSourceKey(ctx context.Context, ds *object.DataSource, keyID string) error {
+	ds.EncryptionKey = keyID
+	config.Set(ds, "services", common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_DATA_SYNC_+ds.Name)
+	if err := config.Save(common.PYDIO_SYSTEM_USERNAME, "Rotate encryption key of datasource "+ds.Name); err != nil {
+		return err
+	}
+	config.TouchSourceNamesForDataServices(common.SERVICE_DATA_SYNC)
+	return client.Publish(ctx, client.NewPublication(common.TOPIC_DATASOURCE_EVENT, &object.DataSourceEvent{
+		Name:   ds.Name,
+		Type:   object.DataSourceEvent_UPDATE,
+		Config: ds,
+	}))
+}
+
+// adminContext adds system administrator claims to the context, as required by key store administrative calls.
+func adminContext(ctx context.Context) context.Context {
+	return auth.WithClaims(ctx, claim.Claims{
+		Name:    common.PYDIO_SYSTEM_USERNAME,
+		Profile: common.PYDIO_PROFILE_ADMIN,
+	})
+}
@@ -0,0 +1,17 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS enc_nodes (
+    node_id VARCHAR(255) NOT NULL PRIMARY KEY,
+    nonce BYTEA,
+    block_size INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS enc_node_keys (
+    node_id VARCHAR(255) NOT NULL REFERENCES enc_nodes(node_id) ON DELETE CASCADE,
+    owner_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    key_data BYTEA
+);
+
+-- +migrate Down
+DROP TABLE enc_node_keys;
+DROP TABLE enc_nodes;
@@ -0,0 +1,17 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS enc_key_rotations (
+    data_source VARCHAR(255) NOT NULL PRIMARY KEY,
+    old_key_id VARCHAR(255) NOT NULL,
+    new_key_id VARCHAR(255) NOT NULL,
+    status INT NOT NULL,
+    last_node_id VARCHAR(255) NOT NULL DEFAULT '',
+    rewrapped BIGINT NOT NULL DEFAULT 0,
+    total BIGINT NOT NULL DEFAULT 0,
+    retire_old_key INT NOT NULL DEFAULT 0,
+    start_time INT NOT NULL,
+    update_time INT NOT NULL,
+    error TEXT
+);
+
+-- +migrate Down
+DROP TABLE enc_key_rotations;
@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package key
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pmker/yux/common/proto/encryption"
+)
+
+// RotationBatchSize is the number of node keys rewrapped between two saves of a rotation cursor
+var RotationBatchSize = 500
+
+// KeyTool opens and seals node keys with a key from the key store
+type KeyTool interface {
+	GetEncrypted(ctx context.Context, keyID string, data []byte) ([]byte, error)
+	GetDecrypted(ctx context.Context, keyID string, data []byte) ([]byte, error)
+}
+
+// DataSourceKeyOwner is the user id under which node keys of a datasource encrypted in MASTER mode are stored
+func DataSourceKeyOwner(dataSource string) string {
+	return fmt.Sprintf("ds:%s", dataSource)
+}
+
+// RewrapNodeKeys opens every node key of the rotation datasource with its old key and seals it again with
+// the new one, starting after the rotation cursor. Progress is saved after each batch so that an interrupted
+// sweep resumes where it stopped. Keys that already open with the new key are left untouched.
+// It returns the number of keys actually rewrapped by this sweep.
+func RewrapNodeKeys(ctx context.Context, dao DAO, tool KeyTool, rotation *encryption.KeyRotation) (int64, error) {
+
+	owner := DataSourceKeyOwner(rotation.DataSource)
+	var count int64
+	for {
+		keys, err := dao.ListNodeKeys(owner, rotation.Cursor, RotationBatchSize)
+		if err != nil {
+			return count, err
+		}
+		if len(keys) == 0 {
+			return count, nil
+		}
+
+		for _, k := range keys {
+			plain, err := tool.GetDecrypted(ctx, rotation.OldKeyID, k.Data)
+			if err != nil {
+				if _, e := tool.GetDecrypted(ctx, rotation.NewKeyID, k.Data); e == nil {
+					// already rewrapped
+					continue
+				}
+				return count, fmt.Errorf("cannot open key of node %s: %s", k.NodeId, err.Error())
+			}
+			sealed, err := tool.GetEncrypted(ctx, rotation.NewKeyID, plain)
+			if err != nil {
+				return count, err
+			}
+			if err := dao.UpdateNodeKey(k.NodeId, owner, sealed); err != nil {
+				return count, err
+			}
+			count++
+			rotation.Rewrapped++
+		}
+
+		rotation.Cursor = keys[len(keys)-1].NodeId
+		rotation.UpdateTime = int32(time.Now().Unix())
+		if err := dao.SaveKeyRotation(rotation); err != nil {
+			return count, err
+		}
+	}
+}
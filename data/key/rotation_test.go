@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package key
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/proto/encryption"
+)
+
+// prefixTool "seals" data by prefixing it with the key id
+type prefixTool struct{}
+
+func (prefixTool) GetEncrypted(ctx context.Context, keyID string, data []byte) ([]byte, error) {
+	return append([]byte(keyID+"|"), data...), nil
+}
+
+func (prefixTool) GetDecrypted(ctx context.Context, keyID string, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(keyID+"|")) {
+		return nil, fmt.Errorf("cannot open with %s", keyID)
+	}
+	return data[len(keyID)+1:], nil
+}
+
+func TestRewrapNodeKeys(t *testing.T) {
+
+	convey.Convey("Rewrap node keys of a datasource", t, func() {
+		ctx := context.Background()
+		tool := prefixTool{}
+		owner := DataSourceKeyOwner("rewrap")
+		RotationBatchSize = 2
+		defer func() { RotationBatchSize = 500 }()
+
+		for i := 0; i < 5; i++ {
+			nodeId := fmt.Sprintf("rewrap-%d", i)
+			keyId := "old"
+			if i == 2 {
+				keyId = "new"
+			}
+			sealed, _ := tool.GetEncrypted(ctx, keyId, []byte("content-"+nodeId))
+			convey.So(mockDAO.InsertNode(nodeId, []byte("nonce"), 4), convey.ShouldBeNil)
+			convey.So(mockDAO.SetNodeKey(nodeId, owner, owner, sealed), convey.ShouldBeNil)
+		}
+
+		rotation := &encryption.KeyRotation{
+			DataSource: "rewrap",
+			OldKeyID:   "old",
+			NewKeyID:   "new",
+		}
+		count, err := RewrapNodeKeys(ctx, mockDAO, tool, rotation)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(count, convey.ShouldEqual, 4)
+		convey.So(rotation.Rewrapped, convey.ShouldEqual, 4)
+		convey.So(rotation.Cursor, convey.ShouldEqual, "rewrap-4")
+
+		for i := 0; i < 5; i++ {
+			nodeId := fmt.Sprintf("rewrap-%d", i)
+			k, e := mockDAO.GetNodeKey(nodeId, owner)
+			convey.So(e, convey.ShouldBeNil)
+			plain, e := tool.GetDecrypted(ctx, "new", k.Data)
+			convey.So(e, convey.ShouldBeNil)
+			convey.So(string(plain), convey.ShouldEqual, "content-"+nodeId)
+		}
+
+		saved, err := mockDAO.GetKeyRotation("rewrap")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(saved.Cursor, convey.ShouldEqual, "rewrap-4")
+
+		rotation.Cursor = ""
+		count, err = RewrapNodeKeys(ctx, mockDAO, tool, rotation)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(count, convey.ShouldEqual, 0)
+
+		convey.Convey("Keys opening with none of the rotation keys stop the sweep", func() {
+			sealed, _ := tool.GetEncrypted(ctx, "other", []byte("content"))
+			convey.So(mockDAO.InsertNode("rewrap-5", []byte("nonce"), 4), convey.ShouldBeNil)
+			convey.So(mockDAO.SetNodeKey("rewrap-5", owner, owner, sealed), convey.ShouldBeNil)
+
+			rotation.Cursor = "rewrap-4"
+			_, err := RewrapNodeKeys(ctx, mockDAO, tool, rotation)
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(rotation.Cursor, convey.ShouldEqual, "rewrap-4")
+		})
+	})
+}
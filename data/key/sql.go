@@ -47,6 +47,14 @@ var (
 		"enc_node_keys_deleteShared":    `DELETE FROM enc_node_keys WHERE user_id<>owner_id AND node_id=? AND owner_id=? AND user_id=?`,
 		"enc_node_keys_deleteAllShared": `DELETE FROM enc_node_keys WHERE  user_id<>owner_id AND node_id=? AND owner_id=?`,
 		"selectNodeKey":                 `SELECT enc_nodes.node_id, user_id, owner_id, nonce, block_size, key_data FROM enc_node_keys, enc_nodes WHERE enc_nodes.node_id=enc_node_keys.node_id AND enc_node_keys.node_id=? AND user_id=?`,
+		"selectNodeOwnerKey":            `SELECT enc_nodes.node_id, user_id, owner_id, nonce, block_size, key_data FROM enc_node_keys, enc_nodes WHERE enc_nodes.node_id=enc_node_keys.node_id AND enc_node_keys.node_id=? AND user_id=owner_id`,
+		"enc_node_keys_list":            `SELECT node_id, owner_id, user_id, key_data FROM enc_node_keys WHERE user_id=? AND node_id>? ORDER BY node_id LIMIT ?`,
+		"enc_node_keys_count":           `SELECT COUNT(*) FROM enc_node_keys WHERE user_id=?`,
+		"enc_node_keys_update":          `UPDATE enc_node_keys SET key_data=? WHERE node_id=? AND user_id=?`,
+		"enc_key_rotations_select":      `SELECT data_source, old_key_id, new_key_id, status, last_node_id, rewrapped, total, retire_old_key, start_time, update_time, error FROM enc_key_rotations WHERE data_source=?`,
+		"enc_key_rotations_list":        `SELECT data_source, old_key_id, new_key_id, status, last_node_id, rewrapped, total, retire_old_key, start_time, update_time, error FROM enc_key_rotations ORDER BY data_source`,
+		"enc_key_rotations_insert":      `INSERT INTO enc_key_rotations (data_source, old_key_id, new_key_id, status, last_node_id, rewrapped, total, retire_old_key, start_time, update_time, error) VALUES (?,?,?,?,?,?,?,?,?,?,?)`,
+		"enc_key_rotations_update":      `UPDATE enc_key_rotations SET old_key_id=?, new_key_id=?, status=?, last_node_id=?, rewrapped=?, total=?, retire_old_key=?, start_time=?, update_time=?, error=? WHERE data_source=?`,
 	}
 	mu atomic.Value
 )
@@ -154,18 +162,20 @@ func (h *sqlimpl) SetNodeKey(nodeUuid string, ownerId string, userId string, key
 	return err
 }
 
+// GetNodeKey finds the key of node stored for user. If user is empty, the key of the node owner is returned.
 func (h *sqlimpl) GetNodeKey(node string, user string) (*encryption.NodeKey, error) {
 
-	stmt := h.GetStmt("selectNodeKey")
+	query, args := "selectNodeKey", []interface{}{node, user}
+	if user == "" {
+		query, args = "selectNodeOwnerKey", []interface{}{node}
+	}
+	stmt := h.GetStmt(query)
 	if stmt == nil {
 		return nil, fmt.Errorf("Unknown statement")
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query(
-		node,
-		user,
-	)
+	rows, err := stmt.Query(args...)
 	if err != nil {
 		return nil, errors.New("NodeKey", "cannot retrieve node key", 500)
 	}
@@ -225,3 +235,148 @@ func (h *sqlimpl) DeleteNodeAllSharedKey(node string, ownerId string) error {
 	)
 	return err
 }
+
+func (h *sqlimpl) ListNodeKeys(userId string, afterNodeId string, limit int) ([]*encryption.NodeKey, error) {
+
+	stmt := h.GetStmt("enc_node_keys_list")
+	if stmt == nil {
+		return nil, fmt.Errorf("Unknown statement")
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(
+		userId, afterNodeId, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*encryption.NodeKey
+	for rows.Next() {
+		k := &encryption.NodeKey{Data: []byte{}}
+		if err := rows.Scan(&(k.NodeId), &(k.OwnerId), &(k.UserId), &(k.Data)); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (h *sqlimpl) CountNodeKeys(userId string) (int64, error) {
+
+	stmt := h.GetStmt("enc_node_keys_count")
+	if stmt == nil {
+		return 0, fmt.Errorf("Unknown statement")
+	}
+	defer stmt.Close()
+
+	var count int64
+	if err := stmt.QueryRow(userId).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (h *sqlimpl) UpdateNodeKey(nodeUuid string, userId string, keyData []byte) error {
+
+	stmt := h.GetStmt("enc_node_keys_update")
+	if stmt == nil {
+		return fmt.Errorf("Unknown statement")
+	}
+	defer stmt.Close()
+
+	_, err := stmt.Exec(
+		keyData, nodeUuid, userId,
+	)
+	return err
+}
+
+func (h *sqlimpl) SaveKeyRotation(r *encryption.KeyRotation) error {
+
+	existing, err := h.GetKeyRotation(r.DataSource)
+	if err != nil {
+		return err
+	}
+
+	if existing != nil {
+		stmt := h.GetStmt("enc_key_rotations_update")
+		if stmt == nil {
+			return fmt.Errorf("Unknown statement")
+		}
+		defer stmt.Close()
+		_, err = stmt.Exec(
+			r.OldKeyID, r.NewKeyID, int32(r.Status), r.Cursor, r.Rewrapped, r.Total, r.RetireOldKey, r.StartTime, r.UpdateTime, r.Error,
+			r.DataSource,
+		)
+	} else {
+		stmt := h.GetStmt("enc_key_rotations_insert")
+		if stmt == nil {
+			return fmt.Errorf("Unknown statement")
+		}
+		defer stmt.Close()
+		_, err = stmt.Exec(
+			r.DataSource, r.OldKeyID, r.NewKeyID, int32(r.Status), r.Cursor, r.Rewrapped, r.Total, r.RetireOldKey, r.StartTime, r.UpdateTime, r.Error,
+		)
+	}
+	return err
+}
+
+func (h *sqlimpl) GetKeyRotation(dataSource string) (*encryption.KeyRotation, error) {
+
+	stmt := h.GetStmt("enc_key_rotations_select")
+	if stmt == nil {
+		return nil, fmt.Errorf("Unknown statement")
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(dataSource)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		return scanKeyRotation(rows)
+	}
+	return nil, rows.Err()
+}
+
+func (h *sqlimpl) ListKeyRotations() ([]*encryption.KeyRotation, error) {
+
+	stmt := h.GetStmt("enc_key_rotations_list")
+	if stmt == nil {
+		return nil, fmt.Errorf("Unknown statement")
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rotations []*encryption.KeyRotation
+	for rows.Next() {
+		r, err := scanKeyRotation(rows)
+		if err != nil {
+			return nil, err
+		}
+		rotations = append(rotations, r)
+	}
+	return rotations, rows.Err()
+}
+
+func scanKeyRotation(rows sql.Scanner) (*encryption.KeyRotation, error) {
+	r := &encryption.KeyRotation{}
+	var status int32
+	var errorMsg *string
+	if err := rows.Scan(&(r.DataSource), &(r.OldKeyID), &(r.NewKeyID), &status, &(r.Cursor), &(r.Rewrapped), &(r.Total), &(r.RetireOldKey), &(r.StartTime), &(r.UpdateTime), &errorMsg); err != nil {
+		return nil, errors.New("KeyRotation", "Error while parsing key rotation", 500)
+	}
+	r.Status = encryption.KeyRotationStatus(status)
+	if errorMsg != nil {
+		r.Error = *errorMsg
+	}
+	return r, nil
+}
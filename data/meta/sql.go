@@ -39,7 +39,12 @@ var (
 		"deleteNS":   `DELETE FROM data_meta WHERE namespace=?`,
 		"deleteUuid": `DELETE FROM data_meta WHERE node_id=?`,
 		"select":     `SELECT * FROM data_meta WHERE node_id=?`,
-		"selectAll":  `SELECT * FROM data_meta LIMIT 0, 500`,
+		"selectAll":  `SELECT * FROM data_meta LIMIT 500`,
+	}
+
+	// Statements that differ for the postgres driver
+	postgresQueries = map[string]string{
+		"upsert": `INSERT INTO data_meta (node_id,namespace,data,author,timestamp,format) VALUES (?,?,?,?,?,?) ON CONFLICT (node_id,namespace) DO UPDATE SET data=?,author=?,timestamp=?,format=?`,
 	}
 	mu atomic.Value
 )
@@ -70,6 +75,9 @@ func (s *sqlimpl) Init(options common.ConfigValues) error {
 	// Preparing the db statements
 	if options.Bool("prepare", true) {
 		for key, query := range queries {
+			if q, ok := postgresQueries[key]; ok && s.Driver() == "postgres" {
+				query = q
+			}
 			if err := s.Prepare(key, query); err != nil {
 				return err
 			}
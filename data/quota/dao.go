@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+// Package quota keeps a ledger of the storage used by users, groups and datasources, along with the quotas
+// assigned to them.
+package quota
+
+import (
+	"github.com/pmker/yux/common/dao"
+	"github.com/pmker/yux/common/proto/quota"
+	"github.com/pmker/yux/common/sql"
+)
+
+type DAO interface {
+	dao.DAO
+
+	PutQuota(q *quota.Quota) error
+	DeleteQuota(subject *quota.Subject) error
+	// GetUsage reads usage and limits of each subject. Unknown subjects have no usage and no limits.
+	GetUsage(subjects []*quota.Subject) ([]*quota.Usage, error)
+	// ListUsage lists subjects of a given type, or only those having a quota set
+	ListUsage(subjectType quota.SubjectType, onlyLimited bool) ([]*quota.Usage, error)
+
+	// ChargeNode sets the size charged for a node. A node seen for the first time is charged to the given subjects,
+	// later calls charge the size difference to the subjects recorded at first charge. It returns the updated
+	// usages of these subjects and the charged difference.
+	ChargeNode(nodeUuid string, subjects []*quota.Subject, size int64) ([]*quota.Usage, int64, error)
+	// ReleaseNode removes a node from the ledger and credits its size back to its subjects.
+	ReleaseNode(nodeUuid string) ([]*quota.Usage, int64, error)
+	// ListNodes lists the uuids of all nodes recorded in the ledger.
+	ListNodes() ([]string, error)
+}
+
+func NewDAO(o dao.DAO) dao.DAO {
+	switch v := o.(type) {
+	case sql.DAO:
+		return &sqlimpl{DAO: v}
+	}
+	return nil
+}
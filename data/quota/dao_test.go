@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package quota
+
+import (
+	"log"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/config"
+	"github.com/pmker/yux/common/proto/quota"
+	"github.com/pmker/yux/common/sql"
+)
+
+var (
+	mockDAO DAO
+)
+
+func TestMain(m *testing.M) {
+	var options config.Map
+
+	sqlDAO := sql.NewDAO("sqlite3", "file::memory:?mode=memory&cache=shared", "test")
+	if sqlDAO == nil {
+		log.Fatal("Could not start test")
+	}
+
+	mockDAO = NewDAO(sqlDAO).(DAO)
+	if err := mockDAO.Init(options); err != nil {
+		log.Fatal("Could not start test ", err)
+	}
+
+	m.Run()
+}
+
+func TestQuotas(t *testing.T) {
+
+	Convey("Put, read and delete quotas", t, func() {
+		group := &quota.Subject{Type: quota.SubjectType_GROUP, Id: "/sales"}
+		So(mockDAO.PutQuota(&quota.Quota{Subject: group, HardLimit: 1000, SoftLimit: 800}), ShouldBeNil)
+		So(mockDAO.PutQuota(&quota.Quota{Subject: group, HardLimit: 2000, SoftLimit: 1500}), ShouldBeNil)
+
+		usages, err := mockDAO.GetUsage([]*quota.Subject{group})
+		So(err, ShouldBeNil)
+		So(usages, ShouldHaveLength, 1)
+		So(usages[0].HardLimit, ShouldEqual, 2000)
+		So(usages[0].SoftLimit, ShouldEqual, 1500)
+		So(usages[0].Bytes, ShouldEqual, 0)
+
+		listed, err := mockDAO.ListUsage(quota.SubjectType_GROUP, true)
+		So(err, ShouldBeNil)
+		So(listed, ShouldHaveLength, 1)
+
+		So(mockDAO.DeleteQuota(group), ShouldBeNil)
+		listed, err = mockDAO.ListUsage(quota.SubjectType_GROUP, true)
+		So(err, ShouldBeNil)
+		So(listed, ShouldBeEmpty)
+
+		So(mockDAO.PutQuota(&quota.Quota{}), ShouldNotBeNil)
+	})
+
+}
+
+func TestLedger(t *testing.T) {
+
+	Convey("Charge and release nodes", t, func() {
+		subjects := quota.SubjectsFor("john", "/corp/rd", "pydiods1")
+		So(subjects, ShouldHaveLength, 4)
+
+		usages, delta, err := mockDAO.ChargeNode("node-1", subjects, 100)
+		So(err, ShouldBeNil)
+		So(delta, ShouldEqual, 100)
+		So(usages, ShouldHaveLength, 4)
+		for _, u := range usages {
+			So(u.Bytes, ShouldEqual, 100)
+		}
+
+		// A second node is charged to another user of the same group
+		_, _, err = mockDAO.ChargeNode("node-2", quota.SubjectsFor("jane", "/corp/rd", "pydiods1"), 50)
+		So(err, ShouldBeNil)
+
+		// Later writes are charged to the original subjects, whoever makes them
+		usages, delta, err = mockDAO.ChargeNode("node-1", quota.SubjectsFor("jane", "/corp", "pydiods1"), 130)
+		So(err, ShouldBeNil)
+		So(delta, ShouldEqual, 30)
+		So(usages[0].Subject.Id, ShouldEqual, "john")
+		So(usages[0].Bytes, ShouldEqual, 130)
+
+		usages, err = mockDAO.GetUsage([]*quota.Subject{
+			{Type: quota.SubjectType_USER, Id: "jane"},
+			{Type: quota.SubjectType_GROUP, Id: "/corp/rd"},
+			{Type: quota.SubjectType_DATASOURCE, Id: "pydiods1"},
+		})
+		So(err, ShouldBeNil)
+		So(usages[0].Bytes, ShouldEqual, 50)
+		So(usages[1].Bytes, ShouldEqual, 180)
+		So(usages[2].Bytes, ShouldEqual, 180)
+
+		usages, delta, err = mockDAO.ReleaseNode("node-1")
+		So(err, ShouldBeNil)
+		So(delta, ShouldEqual, -130)
+		So(usages[0].Bytes, ShouldEqual, 0)
+		So(usages[3].Bytes, ShouldEqual, 50)
+
+		// Unknown nodes are ignored
+		usages, delta, err = mockDAO.ReleaseNode("node-1")
+		So(err, ShouldBeNil)
+		So(delta, ShouldEqual, 0)
+		So(usages, ShouldBeEmpty)
+
+		ids, err := mockDAO.ListNodes()
+		So(err, ShouldBeNil)
+		So(ids, ShouldResemble, []string{"node-2"})
+
+		users, err := mockDAO.ListUsage(quota.SubjectType_USER, false)
+		So(err, ShouldBeNil)
+		So(users, ShouldHaveLength, 2)
+		So(users[0].Subject.Id, ShouldEqual, "jane")
+	})
+
+}
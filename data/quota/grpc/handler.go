@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package grpc
+
+import (
+	"context"
+
+	"github.com/micro/go-micro/errors"
+
+	proto "github.com/pmker/yux/common/proto/quota"
+	"github.com/pmker/yux/common/service/context"
+	"github.com/pmker/yux/data/quota"
+)
+
+// Handler implements the QuotaService
+type Handler struct{}
+
+// PutQuota creates or replaces the limits of a subject
+func (h *Handler) PutQuota(ctx context.Context, req *proto.PutQuotaRequest, resp *proto.PutQuotaResponse) error {
+
+	q := req.GetQuota()
+	if q.GetSubject().GetId() == "" {
+		return errors.BadRequest(Name, "please provide a quota subject")
+	}
+	if q.HardLimit < 0 || q.SoftLimit < 0 {
+		return errors.BadRequest(Name, "limits cannot be negative")
+	}
+	if q.HardLimit > 0 && q.SoftLimit > q.HardLimit {
+		return errors.BadRequest(Name, "soft limit cannot be greater than hard limit")
+	}
+
+	if err := servicecontext.GetDAO(ctx).(quota.DAO).PutQuota(q); err != nil {
+		return errors.InternalServerError(Name, err.Error())
+	}
+	resp.Quota = q
+	return nil
+}
+
+// DeleteQuota removes the limits of a subject
+func (h *Handler) DeleteQuota(ctx context.Context, req *proto.DeleteQuotaRequest, resp *proto.DeleteQuotaResponse) error {
+
+	if req.GetSubject().GetId() == "" {
+		return errors.BadRequest(Name, "please provide a quota subject")
+	}
+	if err := servicecontext.GetDAO(ctx).(quota.DAO).DeleteQuota(req.Subject); err != nil {
+		return errors.InternalServerError(Name, err.Error())
+	}
+	resp.Success = true
+	return nil
+}
+
+// GetUsage reads usage and limits of the requested subjects
+func (h *Handler) GetUsage(ctx context.Context, req *proto.GetUsageRequest, resp *proto.GetUsageResponse) error {
+
+	usages, err := servicecontext.GetDAO(ctx).(quota.DAO).GetUsage(req.Subjects)
+	if err != nil {
+		return errors.InternalServerError(Name, err.Error())
+	}
+	resp.Usages = usages
+	return nil
+}
+
+// ListUsage lists usage and limits of all subjects of a given type
+func (h *Handler) ListUsage(ctx context.Context, req *proto.ListUsageRequest, resp *proto.ListUsageResponse) error {
+
+	usages, err := servicecontext.GetDAO(ctx).(quota.DAO).ListUsage(req.Type, req.OnlyLimited)
+	if err != nil {
+		return errors.InternalServerError(Name, err.Error())
+	}
+	resp.Usages = usages
+	return nil
+}
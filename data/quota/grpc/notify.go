@@ -0,0 +1,149 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package grpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang/protobuf/ptypes"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/config"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/proto/activity"
+	"github.com/pmker/yux/common/proto/mailer"
+	proto "github.com/pmker/yux/common/proto/quota"
+	"github.com/pmker/yux/common/registry"
+	"github.com/pmker/yux/common/utils"
+	"github.com/pmker/yux/common/utils/i18n"
+)
+
+// notifySoftLimits warns the author of a write that brought some usages over their soft limit, by mail and
+// in its activity inbox.
+func notifySoftLimits(ctx context.Context, author string, usages []*proto.Usage, delta int64) {
+
+	for _, usage := range usages {
+		if !usage.CrossedSoftLimit(delta) {
+			continue
+		}
+		label := subjectLabel(usage.Subject)
+		log.Logger(ctx).Warn("Soft quota limit reached for "+label, zap.Int64("usage", usage.Bytes), zap.Int64("softLimit", usage.SoftLimit), zap.Int64("hardLimit", usage.HardLimit))
+		if author == "" {
+			continue
+		}
+		summary := fmt.Sprintf("Storage used by %s (%s) is over its warning limit of %s", label, byteSize(usage.Bytes), byteSize(usage.SoftLimit))
+		if usage.HardLimit > 0 {
+			summary += fmt.Sprintf(", uploads will be refused above %s", byteSize(usage.HardLimit))
+		}
+		if e := postWarningActivity(ctx, author, summary); e != nil {
+			log.Logger(ctx).Error("cannot post quota warning activity", zap.String(common.KEY_USER, author), zap.Error(e))
+		}
+		if e := sendWarningMail(ctx, author, label, usage); e != nil {
+			log.Logger(ctx).Error("cannot send quota warning email", zap.String(common.KEY_USER, author), zap.Error(e))
+		}
+	}
+
+}
+
+func postWarningActivity(ctx context.Context, author string, summary string) error {
+
+	ac := &activity.Object{
+		JsonLdContext: "https://www.w3.org/ns/activitystreams",
+		Type:          activity.ObjectType_Note,
+		Name:          "Quota Warning",
+		Summary:       summary,
+		Updated:       ptypes.TimestampNow(),
+		Actor:         &activity.Object{Type: activity.ObjectType_Service, Id: Name},
+		To:            &activity.Object{Type: activity.ObjectType_Person, Id: author},
+	}
+	stream, e := activity.NewActivityServiceClient(registry.GetClient(common.SERVICE_ACTIVITY)).PostActivity(ctx)
+	if e != nil {
+		return e
+	}
+	defer stream.Close()
+	return stream.Send(&activity.PostActivityRequest{Object: ac})
+}
+
+func sendWarningMail(ctx context.Context, author string, label string, usage *proto.Usage) error {
+
+	user, e := utils.SearchUniqueUser(ctx, author, "")
+	if e != nil {
+		return e
+	}
+	email, ok := user.Attributes["email"]
+	if !ok || email == "" {
+		return nil
+	}
+	displayName, ok := user.Attributes["displayName"]
+	if !ok {
+		displayName = user.Login
+	}
+	hardLimit := ""
+	if usage.HardLimit > 0 {
+		hardLimit = byteSize(usage.HardLimit)
+	}
+
+	_, e = mailer.NewMailerServiceClient(registry.GetClient(common.SERVICE_MAILER)).SendMail(ctx, &mailer.SendMailRequest{
+		Mail: &mailer.Mail{
+			To: []*mailer.User{{
+				Uuid:     user.Uuid,
+				Name:     displayName,
+				Address:  email,
+				Language: i18n.UserLanguage(ctx, user, config.Default()),
+			}},
+			TemplateId: "QuotaWarning",
+			TemplateData: map[string]string{
+				"Subject":   label,
+				"Usage":     byteSize(usage.Bytes),
+				"SoftLimit": byteSize(usage.SoftLimit),
+				"HardLimit": hardLimit,
+			},
+		},
+	})
+	return e
+}
+
+func subjectLabel(subject *proto.Subject) string {
+	switch subject.Type {
+	case proto.SubjectType_GROUP:
+		return "group " + subject.Id
+	case proto.SubjectType_DATASOURCE:
+		return "datasource " + subject.Id
+	default:
+		return "user " + subject.Id
+	}
+}
+
+// byteSize formats a number of bytes with a binary unit
+func byteSize(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+// Package grpc provides the quota service: it maintains the storage usage ledger from tree events and serves
+// usage and limits of users, groups and datasources.
+package grpc
+
+import (
+	"time"
+
+	"github.com/micro/go-micro"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/plugins"
+	proto "github.com/pmker/yux/common/proto/quota"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/service"
+	"github.com/pmker/yux/common/service/context"
+	"github.com/pmker/yux/data/quota"
+)
+
+var (
+	Name = common.SERVICE_GRPC_NAMESPACE_ + common.SERVICE_QUOTA
+)
+
+func init() {
+	plugins.Register(func() {
+		service.NewService(
+			service.Name(Name),
+			service.Tag(common.SERVICE_TAG_DATA),
+			service.Description("Storage quotas and usage ledger for users, groups and datasources"),
+			service.Dependency(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_USER, []string{}),
+			service.WithStorage(quota.NewDAO, "data_quota"),
+			service.Unique(true),
+			service.WithMicro(func(m micro.Service) error {
+				proto.RegisterQuotaServiceHandler(m.Options().Server, new(Handler))
+
+				subscriber := NewTreeEventsSubscriber()
+				if err := m.Options().Server.Subscribe(m.Options().Server.NewSubscriber(common.TOPIC_TREE_CHANGES, subscriber)); err != nil {
+					return err
+				}
+
+				// Events only keep the ledger up to date: align it with the tree content at startup
+				ctx := m.Options().Context
+				m.Init(micro.AfterStart(func() error {
+					go func() {
+						treeClient := tree.NewNodeProviderClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_TREE, defaults.NewClient())
+						e := service.Retry(func() error {
+							return Reconcile(ctx, servicecontext.GetDAO(ctx).(quota.DAO), subscriber, treeClient)
+						}, 10*time.Second, 10*time.Minute)
+						if e != nil {
+							log.Logger(ctx).Error("Cannot reconcile quota ledger with tree", zap.Error(e))
+						}
+					}()
+					return nil
+				}))
+				return nil
+			}),
+		)
+	})
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+package grpc
+
+import (
+	"context"
+	"io"
+
+	"github.com/micro/go-micro/errors"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/data/quota"
+)
+
+// Reconcile aligns the ledger with the current tree. Files missing from the ledger, e.g. created before the
+// quota service was running, are charged to their datasource only as their author is unknown. Files whose size
+// drifted are charged the difference. Ledger nodes that are not found in the tree anymore are released.
+func Reconcile(ctx context.Context, dao quota.DAO, subscriber *TreeEventsSubscriber, treeClient tree.NodeProviderClient) error {
+
+	stream, err := treeClient.ListNodes(ctx, &tree.ListNodesRequest{Node: &tree.Node{Path: ""}, Recursive: true})
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	seen := make(map[string]struct{})
+	var charged int
+	for {
+		resp, e := stream.Recv()
+		if e != nil {
+			if e != io.EOF {
+				log.Logger(ctx).Debug("quota reconciliation: listing stopped", zap.Error(e))
+			}
+			break
+		}
+		node := resp.GetNode()
+		if node == nil || node.Uuid == "" || !node.IsLeaf() {
+			continue
+		}
+		seen[node.Uuid] = struct{}{}
+		_, delta, e := dao.ChargeNode(node.Uuid, subscriber.subjects(ctx, "", node), node.Size)
+		if e != nil {
+			return e
+		}
+		if delta != 0 {
+			charged++
+		}
+	}
+
+	// Nodes created during the listing are not seen: only release those that the tree does not know anymore
+	uuids, err := dao.ListNodes()
+	if err != nil {
+		return err
+	}
+	var released int
+	for _, uuid := range uuids {
+		if _, ok := seen[uuid]; ok {
+			continue
+		}
+		if _, e := treeClient.ReadNode(ctx, &tree.ReadNodeRequest{Node: &tree.Node{Uuid: uuid}}); e == nil || errors.Parse(e.Error()).Code != 404 {
+			continue
+		}
+		if _, _, e := dao.ReleaseNode(uuid); e != nil {
+			return e
+		}
+		released++
+	}
+
+	log.Logger(ctx).Info("Quota ledger reconciled with tree", zap.Int("charged", charged), zap.Int("released", released))
+	return nil
+}
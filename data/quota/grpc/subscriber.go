@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package grpc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/micro/go-micro/metadata"
+	"github.com/patrickmn/go-cache"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/log"
+	proto "github.com/pmker/yux/common/proto/quota"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/service/context"
+	"github.com/pmker/yux/common/utils"
+	"github.com/pmker/yux/data/quota"
+)
+
+// TreeEventsSubscriber keeps the usage ledger up to date from tree changes. Files are charged to the user who
+// created them, its groups and their datasource; later changes of the same file are charged to the same subjects.
+type TreeEventsSubscriber struct {
+	groupPaths *cache.Cache
+}
+
+// NewTreeEventsSubscriber creates a subscriber with a short-lived cache of users group paths.
+func NewTreeEventsSubscriber() *TreeEventsSubscriber {
+	return &TreeEventsSubscriber{
+		groupPaths: cache.New(5*time.Minute, 10*time.Minute),
+	}
+}
+
+// Handle updates the ledger for files creation, modification and deletion.
+func (s *TreeEventsSubscriber) Handle(ctx context.Context, msg *tree.NodeChangeEvent) error {
+
+	dao := servicecontext.GetDAO(ctx).(quota.DAO)
+
+	switch msg.Type {
+	case tree.NodeChangeEvent_CREATE, tree.NodeChangeEvent_UPDATE_CONTENT:
+
+		node := msg.GetTarget()
+		if node == nil || node.Uuid == "" || !node.IsLeaf() {
+			return nil
+		}
+		author := eventAuthor(ctx)
+		usages, delta, err := dao.ChargeNode(node.Uuid, s.subjects(ctx, author, node), node.Size)
+		if err != nil {
+			log.Logger(ctx).Error("cannot charge node to quota ledger", node.Zap(), zap.Error(err))
+			return err
+		}
+		notifySoftLimits(ctx, author, usages, delta)
+
+	case tree.NodeChangeEvent_DELETE:
+
+		node := msg.GetSource()
+		if node == nil || node.Uuid == "" {
+			return nil
+		}
+		if _, _, err := dao.ReleaseNode(node.Uuid); err != nil {
+			log.Logger(ctx).Error("cannot release node from quota ledger", node.Zap(), zap.Error(err))
+			return err
+		}
+
+	}
+
+	return nil
+}
+
+// subjects lists the subjects a new node is charged to. Nodes written by the system are only charged to
+// their datasource.
+func (s *TreeEventsSubscriber) subjects(ctx context.Context, author string, node *tree.Node) []*proto.Subject {
+
+	dataSource := node.GetStringMeta(common.META_NAMESPACE_DATASOURCE_NAME)
+	if dataSource == "" {
+		dataSource = strings.SplitN(strings.Trim(node.Path, "/"), "/", 2)[0]
+	}
+	if author == "" {
+		return proto.SubjectsFor("", "", dataSource)
+	}
+
+	var groupPath string
+	if cached, ok := s.groupPaths.Get(author); ok {
+		groupPath = cached.(string)
+	} else if user, e := utils.SearchUniqueUser(ctx, author, ""); e == nil {
+		groupPath = user.GroupPath
+		s.groupPaths.Set(author, groupPath, cache.DefaultExpiration)
+	} else {
+		log.Logger(ctx).Debug("cannot load user for quota groups, only charging user", zap.String(common.KEY_USER, author), zap.Error(e))
+	}
+	return proto.SubjectsFor(author, groupPath, dataSource)
+}
+
+// eventAuthor finds the login of the user who triggered an event, or an empty string for system events.
+func eventAuthor(ctx context.Context) string {
+	meta, ok := metadata.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	author, exists := meta[common.PYDIO_CONTEXT_USER_KEY]
+	if !exists {
+		author = meta[strings.ToLower(common.PYDIO_CONTEXT_USER_KEY)]
+	}
+	if author == common.PYDIO_SYSTEM_USERNAME {
+		return ""
+	}
+	return author
+}
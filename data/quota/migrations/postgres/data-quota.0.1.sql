@@ -0,0 +1,33 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS quota_limits (
+    subject_type INTEGER NOT NULL,
+    subject_id VARCHAR(255) NOT NULL,
+    hard_limit BIGINT NOT NULL DEFAULT 0,
+    soft_limit BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (subject_type, subject_id)
+);
+
+CREATE TABLE IF NOT EXISTS quota_usage (
+    subject_type INTEGER NOT NULL,
+    subject_id VARCHAR(255) NOT NULL,
+    bytes BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (subject_type, subject_id)
+);
+
+CREATE TABLE IF NOT EXISTS quota_nodes (
+    node_id VARCHAR(128) NOT NULL PRIMARY KEY,
+    size BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS quota_node_subjects (
+    node_id VARCHAR(128) NOT NULL,
+    subject_type INTEGER NOT NULL,
+    subject_id VARCHAR(255) NOT NULL,
+    PRIMARY KEY (node_id, subject_type, subject_id)
+);
+
+-- +migrate Down
+DROP TABLE quota_node_subjects;
+DROP TABLE quota_nodes;
+DROP TABLE quota_usage;
+DROP TABLE quota_limits;
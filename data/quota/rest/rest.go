@@ -0,0 +1,168 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package rest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/emicklei/go-restful"
+	"github.com/micro/go-micro/errors"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/auth/claim"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/proto/quota"
+	"github.com/pmker/yux/common/proto/rest"
+	"github.com/pmker/yux/common/service"
+)
+
+type Handler struct{}
+
+// SwaggerTags list the names of the service tags declared in the swagger json implemented by this service
+func (h *Handler) SwaggerTags() []string {
+	return []string{"QuotaService"}
+}
+
+// Filter returns a function to filter the swagger path
+func (h *Handler) Filter() func(string) string {
+	return func(s string) string {
+		// Group subjects are identified by their path
+		return strings.Replace(s, "{Id}", "{Id:*}", 1)
+	}
+}
+
+func (h *Handler) client() quota.QuotaServiceClient {
+	return quota.NewQuotaServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_QUOTA, defaults.NewClient())
+}
+
+// QuotaUsage reports usage and limits of the current user and its groups. Admins may query any subject,
+// other users only the subjects they are charged to.
+func (h *Handler) QuotaUsage(req *restful.Request, rsp *restful.Response) {
+
+	var input rest.QuotaUsageRequest
+	if e := req.ReadEntity(&input); e != nil {
+		service.RestError500(req, rsp, e)
+		return
+	}
+	ctx := req.Request.Context()
+	claims, ok := ctx.Value(claim.ContextKey).(claim.Claims)
+	if !ok {
+		service.RestError401(req, rsp, errors.Unauthorized(common.SERVICE_QUOTA, "cannot find claims in context"))
+		return
+	}
+
+	own := quota.SubjectsFor(claims.Name, claims.GroupPath, "")
+	subjects := input.Subjects
+	if len(subjects) == 0 {
+		subjects = own
+	} else if claims.Profile != common.PYDIO_PROFILE_ADMIN {
+		for _, s := range subjects {
+			if !containsSubject(own, s) {
+				service.RestError403(req, rsp, errors.Forbidden(common.SERVICE_QUOTA, fmt.Sprintf("you are not allowed to read usage of %s %s", strings.ToLower(s.Type.String()), s.Id)))
+				return
+			}
+		}
+	}
+
+	resp, e := h.client().GetUsage(ctx, &quota.GetUsageRequest{Subjects: subjects})
+	if e != nil {
+		service.RestErrorDetect(req, rsp, e)
+		return
+	}
+	rsp.WriteEntity(&rest.QuotaUsageCollection{Usages: resp.Usages})
+}
+
+// ListQuotaUsage lists usage and limits of all subjects of a given type
+func (h *Handler) ListQuotaUsage(req *restful.Request, rsp *restful.Response) {
+
+	var input quota.ListUsageRequest
+	if e := req.ReadEntity(&input); e != nil {
+		service.RestError500(req, rsp, e)
+		return
+	}
+	resp, e := h.client().ListUsage(req.Request.Context(), &input)
+	if e != nil {
+		service.RestErrorDetect(req, rsp, e)
+		return
+	}
+	rsp.WriteEntity(&rest.QuotaUsageCollection{Usages: resp.Usages})
+}
+
+// PutQuota creates or updates the quota of a subject
+func (h *Handler) PutQuota(req *restful.Request, rsp *restful.Response) {
+
+	var input quota.Quota
+	if e := req.ReadEntity(&input); e != nil {
+		service.RestError500(req, rsp, e)
+		return
+	}
+	ctx := req.Request.Context()
+	resp, e := h.client().PutQuota(ctx, &quota.PutQuotaRequest{Quota: &input})
+	if e != nil {
+		service.RestErrorDetect(req, rsp, e)
+		return
+	}
+	log.Auditer(ctx).Info(
+		fmt.Sprintf("Set quota of %s [%s]", strings.ToLower(input.Subject.Type.String()), input.Subject.Id),
+		log.GetAuditId(common.AUDIT_QUOTA_UPDATE),
+		zap.Int64("hardLimit", input.HardLimit),
+		zap.Int64("softLimit", input.SoftLimit),
+	)
+	rsp.WriteEntity(resp.Quota)
+}
+
+// DeleteQuota removes the quota of a subject
+func (h *Handler) DeleteQuota(req *restful.Request, rsp *restful.Response) {
+
+	typeName := req.PathParameter("Type")
+	subjectType, ok := quota.SubjectType_value[strings.ToUpper(typeName)]
+	if !ok {
+		service.RestError500(req, rsp, errors.BadRequest(common.SERVICE_QUOTA, "unknown subject type "+typeName))
+		return
+	}
+	subject := &quota.Subject{Type: quota.SubjectType(subjectType), Id: req.PathParameter("Id")}
+	if subject.Type == quota.SubjectType_GROUP && !strings.HasPrefix(subject.Id, "/") {
+		subject.Id = "/" + subject.Id
+	}
+
+	ctx := req.Request.Context()
+	if _, e := h.client().DeleteQuota(ctx, &quota.DeleteQuotaRequest{Subject: subject}); e != nil {
+		service.RestErrorDetect(req, rsp, e)
+		return
+	}
+	log.Auditer(ctx).Info(
+		fmt.Sprintf("Removed quota of %s [%s]", strings.ToLower(subject.Type.String()), subject.Id),
+		log.GetAuditId(common.AUDIT_QUOTA_DELETE),
+	)
+	rsp.WriteEntity(&rest.DeleteResponse{Success: true})
+}
+
+func containsSubject(subjects []*quota.Subject, subject *quota.Subject) bool {
+	for _, s := range subjects {
+		if s.Type == subject.Type && s.Id == subject.Id {
+			return true
+		}
+	}
+	return false
+}
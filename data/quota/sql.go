@@ -0,0 +1,388 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package quota
+
+import (
+	"context"
+	databasesql "database/sql"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/gobuffalo/packr"
+	"github.com/rubenv/sql-migrate"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/proto/quota"
+	"github.com/pmker/yux/common/sql"
+)
+
+var (
+	queries = map[string]interface{}{
+		"quota_limits_select":        `SELECT hard_limit, soft_limit FROM quota_limits WHERE subject_type=? AND subject_id=?`,
+		"quota_limits_insert":        `INSERT INTO quota_limits (subject_type, subject_id, hard_limit, soft_limit) VALUES (?,?,?,?)`,
+		"quota_limits_update":        `UPDATE quota_limits SET hard_limit=?, soft_limit=? WHERE subject_type=? AND subject_id=?`,
+		"quota_limits_delete":        `DELETE FROM quota_limits WHERE subject_type=? AND subject_id=?`,
+		"quota_limits_list":          `SELECT subject_id, hard_limit, soft_limit FROM quota_limits WHERE subject_type=?`,
+		"quota_usage_select":         `SELECT bytes FROM quota_usage WHERE subject_type=? AND subject_id=?`,
+		"quota_usage_insert":         `INSERT INTO quota_usage (subject_type, subject_id, bytes) VALUES (?,?,?)`,
+		"quota_usage_add":            `UPDATE quota_usage SET bytes=bytes+? WHERE subject_type=? AND subject_id=?`,
+		"quota_usage_list":           `SELECT subject_id, bytes FROM quota_usage WHERE subject_type=?`,
+		"quota_nodes_select":         `SELECT size FROM quota_nodes WHERE node_id=?`,
+		"quota_nodes_insert":         `INSERT INTO quota_nodes (node_id, size) VALUES (?,?)`,
+		"quota_nodes_update":         `UPDATE quota_nodes SET size=? WHERE node_id=?`,
+		"quota_nodes_delete":         `DELETE FROM quota_nodes WHERE node_id=?`,
+		"quota_nodes_list":           `SELECT node_id FROM quota_nodes`,
+		"quota_node_subjects_select": `SELECT subject_type, subject_id FROM quota_node_subjects WHERE node_id=?`,
+		"quota_node_subjects_insert": `INSERT INTO quota_node_subjects (node_id, subject_type, subject_id) VALUES (?,?,?)`,
+		"quota_node_subjects_delete": `DELETE FROM quota_node_subjects WHERE node_id=?`,
+	}
+)
+
+type sqlimpl struct {
+	sql.DAO
+
+	// Serializes read-modify-write operations on the ledger inside this process, transactions keep them atomic
+	ledgerLock sync.Mutex
+}
+
+// Init handler for the SQL DAO
+func (s *sqlimpl) Init(options common.ConfigValues) error {
+
+	// super
+	s.DAO.Init(options)
+
+	// Doing the database migrations
+	migrations := &sql.PackrMigrationSource{
+		Box:         packr.NewBox("../../data/quota/migrations"),
+		Dir:         s.Driver(),
+		TablePrefix: s.Prefix(),
+	}
+
+	_, err := sql.ExecMigration(s.DB(), s.Driver(), migrations, migrate.Up, "data_quota_")
+	if err != nil {
+		return err
+	}
+
+	// Preparing the db statements
+	if options.Bool("prepare", true) {
+		for key, query := range queries {
+			if err := s.Prepare(key, query); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// exec runs a prepared statement, inside tx if it is not nil, and returns the number of affected rows
+func (s *sqlimpl) exec(tx *databasesql.Tx, key string, args ...interface{}) (int64, error) {
+	stmt, closer, err := s.stmt(tx, key)
+	if err != nil {
+		return 0, err
+	}
+	defer closer()
+
+	res, err := stmt.Exec(args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// stmt loads a prepared statement, bound to tx if it is not nil. The returned function closes it.
+func (s *sqlimpl) stmt(tx *databasesql.Tx, key string) (*databasesql.Stmt, func(), error) {
+	stmt := s.GetStmt(key)
+	if stmt == nil {
+		return nil, nil, fmt.Errorf("Unknown statement")
+	}
+	if tx == nil {
+		return stmt, func() { stmt.Close() }, nil
+	}
+	txStmt := tx.Stmt(stmt)
+	if txStmt == nil {
+		stmt.Close()
+		return nil, nil, fmt.Errorf("Empty statement")
+	}
+	return txStmt, func() {
+		txStmt.Close()
+		stmt.Close()
+	}, nil
+}
+
+// inTx runs f inside a transaction, committed if f succeeds and rolled back otherwise
+func (s *sqlimpl) inTx(f func(tx *databasesql.Tx) error) (err error) {
+	tx, err := s.DB().BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+	return f(tx)
+}
+
+// PutQuota creates or replaces the limits of a subject
+func (s *sqlimpl) PutQuota(q *quota.Quota) error {
+	if q.GetSubject() == nil || q.Subject.Id == "" {
+		return fmt.Errorf("quota must have a subject")
+	}
+	subject := q.Subject
+
+	var hard, soft int64
+	found, err := s.scalar(nil, "quota_limits_select", []interface{}{int32(subject.Type), subject.Id}, &hard, &soft)
+	if err != nil {
+		return err
+	}
+	if found {
+		_, err = s.exec(nil, "quota_limits_update", q.HardLimit, q.SoftLimit, int32(subject.Type), subject.Id)
+	} else {
+		_, err = s.exec(nil, "quota_limits_insert", int32(subject.Type), subject.Id, q.HardLimit, q.SoftLimit)
+	}
+	return err
+}
+
+// DeleteQuota removes the limits of a subject. Its usage is kept.
+func (s *sqlimpl) DeleteQuota(subject *quota.Subject) error {
+	_, err := s.exec(nil, "quota_limits_delete", int32(subject.Type), subject.Id)
+	return err
+}
+
+// GetUsage reads usage and limits of each subject.
+func (s *sqlimpl) GetUsage(subjects []*quota.Subject) ([]*quota.Usage, error) {
+	var usages []*quota.Usage
+	for _, subject := range subjects {
+		usage := &quota.Usage{Subject: subject}
+		if _, err := s.scalar(nil, "quota_usage_select", []interface{}{int32(subject.Type), subject.Id}, &usage.Bytes); err != nil {
+			return nil, err
+		}
+		if _, err := s.scalar(nil, "quota_limits_select", []interface{}{int32(subject.Type), subject.Id}, &usage.HardLimit, &usage.SoftLimit); err != nil {
+			return nil, err
+		}
+		usages = append(usages, usage)
+	}
+	return usages, nil
+}
+
+// ListUsage lists subjects of a given type, sorted by identifier.
+func (s *sqlimpl) ListUsage(subjectType quota.SubjectType, onlyLimited bool) ([]*quota.Usage, error) {
+
+	indexed := make(map[string]*quota.Usage)
+	get := func(id string) *quota.Usage {
+		if u, ok := indexed[id]; ok {
+			return u
+		}
+		u := &quota.Usage{Subject: &quota.Subject{Type: subjectType, Id: id}}
+		indexed[id] = u
+		return u
+	}
+
+	if err := s.scan(nil, "quota_limits_list", []interface{}{int32(subjectType)}, func(scan func(...interface{}) error) error {
+		var id string
+		var hard, soft int64
+		if e := scan(&id, &hard, &soft); e != nil {
+			return e
+		}
+		u := get(id)
+		u.HardLimit, u.SoftLimit = hard, soft
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := s.scan(nil, "quota_usage_list", []interface{}{int32(subjectType)}, func(scan func(...interface{}) error) error {
+		var id string
+		var bytes int64
+		if e := scan(&id, &bytes); e != nil {
+			return e
+		}
+		if _, limited := indexed[id]; onlyLimited && !limited {
+			return nil
+		}
+		get(id).Bytes = bytes
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var usages []*quota.Usage
+	for _, u := range indexed {
+		usages = append(usages, u)
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].Subject.Id < usages[j].Subject.Id
+	})
+	return usages, nil
+}
+
+// ChargeNode sets the size charged for a node and updates its subjects usages, in a single transaction.
+func (s *sqlimpl) ChargeNode(nodeUuid string, subjects []*quota.Subject, size int64) ([]*quota.Usage, int64, error) {
+
+	s.ledgerLock.Lock()
+	defer s.ledgerLock.Unlock()
+
+	var delta int64
+	err := s.inTx(func(tx *databasesql.Tx) error {
+		var previous int64
+		known, err := s.scalar(tx, "quota_nodes_select", []interface{}{nodeUuid}, &previous)
+		if err != nil {
+			return err
+		}
+		if known {
+			if subjects, err = s.nodeSubjects(tx, nodeUuid); err != nil {
+				return err
+			}
+			if _, err := s.exec(tx, "quota_nodes_update", size, nodeUuid); err != nil {
+				return err
+			}
+		} else {
+			if _, err := s.exec(tx, "quota_nodes_insert", nodeUuid, size); err != nil {
+				return err
+			}
+			for _, subject := range subjects {
+				if _, err := s.exec(tx, "quota_node_subjects_insert", nodeUuid, int32(subject.Type), subject.Id); err != nil {
+					return err
+				}
+			}
+		}
+		delta = size - previous
+		return s.addUsage(tx, subjects, delta)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	usages, err := s.GetUsage(subjects)
+	return usages, delta, err
+}
+
+// ReleaseNode removes a node from the ledger and credits its size back to its subjects, in a single transaction.
+func (s *sqlimpl) ReleaseNode(nodeUuid string) ([]*quota.Usage, int64, error) {
+
+	s.ledgerLock.Lock()
+	defer s.ledgerLock.Unlock()
+
+	var size int64
+	var subjects []*quota.Subject
+	err := s.inTx(func(tx *databasesql.Tx) error {
+		known, err := s.scalar(tx, "quota_nodes_select", []interface{}{nodeUuid}, &size)
+		if err != nil || !known {
+			return err
+		}
+		if subjects, err = s.nodeSubjects(tx, nodeUuid); err != nil {
+			return err
+		}
+		if _, err := s.exec(tx, "quota_node_subjects_delete", nodeUuid); err != nil {
+			return err
+		}
+		if _, err := s.exec(tx, "quota_nodes_delete", nodeUuid); err != nil {
+			return err
+		}
+		return s.addUsage(tx, subjects, -size)
+	})
+	if err != nil || len(subjects) == 0 {
+		return nil, 0, err
+	}
+	usages, err := s.GetUsage(subjects)
+	return usages, -size, err
+}
+
+// ListNodes lists the uuids of all nodes recorded in the ledger.
+func (s *sqlimpl) ListNodes() (uuids []string, err error) {
+	err = s.scan(nil, "quota_nodes_list", nil, func(scan func(...interface{}) error) error {
+		var id string
+		if e := scan(&id); e != nil {
+			return e
+		}
+		uuids = append(uuids, id)
+		return nil
+	})
+	return
+}
+
+func (s *sqlimpl) nodeSubjects(tx *databasesql.Tx, nodeUuid string) (subjects []*quota.Subject, err error) {
+	err = s.scan(tx, "quota_node_subjects_select", []interface{}{nodeUuid}, func(scan func(...interface{}) error) error {
+		var t int32
+		var id string
+		if e := scan(&t, &id); e != nil {
+			return e
+		}
+		subjects = append(subjects, &quota.Subject{Type: quota.SubjectType(t), Id: id})
+		return nil
+	})
+	return
+}
+
+func (s *sqlimpl) addUsage(tx *databasesql.Tx, subjects []*quota.Subject, delta int64) error {
+	if delta == 0 {
+		return nil
+	}
+	for _, subject := range subjects {
+		affected, err := s.exec(tx, "quota_usage_add", delta, int32(subject.Type), subject.Id)
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			if _, err := s.exec(tx, "quota_usage_insert", int32(subject.Type), subject.Id, delta); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// scalar reads the first row returned by a statement, inside tx if it is not nil, into dest, and tells if a row was found
+func (s *sqlimpl) scalar(tx *databasesql.Tx, key string, args []interface{}, dest ...interface{}) (bool, error) {
+	found := false
+	err := s.scan(tx, key, args, func(scan func(...interface{}) error) error {
+		if found {
+			return nil
+		}
+		found = true
+		return scan(dest...)
+	})
+	return found, err
+}
+
+// scan runs a query statement, inside tx if it is not nil, and calls f for each row
+func (s *sqlimpl) scan(tx *databasesql.Tx, key string, args []interface{}, f func(scan func(...interface{}) error) error) error {
+	stmt, closer, err := s.stmt(tx, key)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := f(rows.Scan); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
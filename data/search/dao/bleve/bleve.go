@@ -26,16 +26,20 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/blevesearch/bleve"
 	_ "github.com/blevesearch/bleve/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/search"
+	_ "github.com/blevesearch/bleve/search/highlight/highlighter/html"
 	"github.com/blevesearch/bleve/search/query"
 	"github.com/sajari/docconv"
 	"go.uber.org/zap"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/pmker/yux/common"
 	"github.com/pmker/yux/common/log"
 	"github.com/pmker/yux/common/proto/tree"
 	"github.com/pmker/yux/common/views"
@@ -43,12 +47,39 @@ import (
 
 var (
 	BleveIndexPath = ""
+	// Maximum number of terms returned for a term facet
+	FacetTermsSize = 10
+	// Store the text content in the index, to highlight the content matches. It is disabled by default,
+	// as it makes the index as large as the indexed documents.
+	StoreContent = false
 )
 
+const (
+	// Increment mappingVersion whenever the index mapping changes: indexes created with a previous mapping are rebuilt
+	mappingVersion    = "2"
+	mappingVersionKey = "mappingVersion"
+)
+
+type sizeRange struct {
+	label    string
+	min, max float64
+}
+
+// Buckets used by the "size" facet, max is exclusive and 0 means unbounded
+var sizeFacetRanges = []sizeRange{
+	{label: "< 100KB", max: 100 * 1024},
+	{label: "100KB - 1MB", min: 100 * 1024, max: 1024 * 1024},
+	{label: "1MB - 10MB", min: 1024 * 1024, max: 10 * 1024 * 1024},
+	{label: "10MB - 100MB", min: 10 * 1024 * 1024, max: 100 * 1024 * 1024},
+	{label: "> 100MB", min: 100 * 1024 * 1024},
+}
+
 type BleveServer struct {
 	Router       views.Handler
 	Engine       bleve.Index
 	IndexContent bool
+	// NeedsReindex is set when an index created with a previous mapping was dropped and must be filled again
+	NeedsReindex bool
 }
 
 func NewBleveEngine(indexContent bool) (*BleveServer, error) {
@@ -60,47 +91,25 @@ func NewBleveEngine(indexContent bool) (*BleveServer, error) {
 	_, e := os.Stat(BleveIndexPath)
 	var index bleve.Index
 	var err error
+	var needsReindex bool
 	if e == nil {
 
 		index, err = bleve.Open(BleveIndexPath)
+		if err == nil {
+			if version, _ := index.GetInternal([]byte(mappingVersionKey)); string(version) != indexMappingVersion() {
+				log.Logger(context.Background()).Info("Search index was created with a previous mapping, it will be rebuilt", zap.String("version", string(version)))
+				index.Close()
+				if err = os.RemoveAll(BleveIndexPath); err == nil {
+					index, err = newIndex()
+					needsReindex = true
+				}
+			}
+		}
 
 	} else {
 
-		mapping := bleve.NewIndexMapping()
-		nodeMapping := bleve.NewDocumentMapping()
-		mapping.AddDocumentMapping("node", nodeMapping)
+		index, err = newIndex()
 
-		// Path to keyword
-		pathFieldMapping := bleve.NewTextFieldMapping()
-		pathFieldMapping.Analyzer = "keyword"
-		nodeMapping.AddFieldMappingsAt("Path", pathFieldMapping)
-
-		// Node type to keyword
-		nodeType := bleve.NewTextFieldMapping()
-		nodeType.Analyzer = "keyword"
-		nodeMapping.AddFieldMappingsAt("NodeType", nodeType)
-
-		// Extension to keyword
-		extType := bleve.NewTextFieldMapping()
-		extType.Analyzer = "keyword"
-		nodeMapping.AddFieldMappingsAt("Extension", extType)
-
-		// Modification Time as Date
-		modifTime := bleve.NewDateTimeFieldMapping()
-		nodeMapping.AddFieldMappingsAt("ModifTime", modifTime)
-
-		// GeoPoint
-		geoPosition := bleve.NewGeoPointFieldMapping()
-		nodeMapping.AddFieldMappingsAt("GeoPoint", geoPosition)
-
-		// Text Content
-		textContent := bleve.NewTextFieldMapping()
-		textContent.Analyzer = "en" // See detect_lang in the blevesearch/blevex package?
-		textContent.Store = false
-		textContent.IncludeInAll = false
-		nodeMapping.AddFieldMappingsAt("TextContent", textContent)
-
-		index, err = bleve.New(BleveIndexPath, mapping)
 	}
 	if err != nil {
 		return nil, err
@@ -108,19 +117,86 @@ func NewBleveEngine(indexContent bool) (*BleveServer, error) {
 	return &BleveServer{
 		Engine:       index,
 		IndexContent: indexContent,
+		NeedsReindex: needsReindex,
 	}, nil
 
 }
 
+// indexMappingVersion identifies the mapping of the index, including the options modifying it.
+func indexMappingVersion() string {
+	if StoreContent {
+		return mappingVersion + "-stored-content"
+	}
+	return mappingVersion
+}
+
+// newIndex creates the index at BleveIndexPath and records its mapping version.
+func newIndex() (bleve.Index, error) {
+
+	mapping := bleve.NewIndexMapping()
+	nodeMapping := bleve.NewDocumentMapping()
+	mapping.AddDocumentMapping("node", nodeMapping)
+
+	// Path to keyword
+	pathFieldMapping := bleve.NewTextFieldMapping()
+	pathFieldMapping.Analyzer = "keyword"
+	nodeMapping.AddFieldMappingsAt("Path", pathFieldMapping)
+
+	// Node type to keyword
+	nodeType := bleve.NewTextFieldMapping()
+	nodeType.Analyzer = "keyword"
+	nodeMapping.AddFieldMappingsAt("NodeType", nodeType)
+
+	// Lowercased basename to keyword, used for sorting by name
+	basenameSort := bleve.NewTextFieldMapping()
+	basenameSort.Analyzer = "keyword"
+	basenameSort.IncludeInAll = false
+	nodeMapping.AddFieldMappingsAt("BasenameSort", basenameSort)
+
+	// Extension to keyword
+	extType := bleve.NewTextFieldMapping()
+	extType.Analyzer = "keyword"
+	nodeMapping.AddFieldMappingsAt("Extension", extType)
+
+	// Modification Time as Date
+	modifTime := bleve.NewDateTimeFieldMapping()
+	nodeMapping.AddFieldMappingsAt("ModifTime", modifTime)
+
+	// GeoPoint
+	geoPosition := bleve.NewGeoPointFieldMapping()
+	nodeMapping.AddFieldMappingsAt("GeoPoint", geoPosition)
+
+	// Text Content
+	textContent := bleve.NewTextFieldMapping()
+	textContent.Analyzer = "en" // See detect_lang in the blevesearch/blevex package?
+	// Only stored with term vectors if required to compute highlighted fragments
+	textContent.Store = StoreContent
+	textContent.IncludeTermVectors = StoreContent
+	textContent.IncludeInAll = false
+	nodeMapping.AddFieldMappingsAt("TextContent", textContent)
+
+	index, err := bleve.New(BleveIndexPath, mapping)
+	if err != nil {
+		return nil, err
+	}
+	if err := index.SetInternal([]byte(mappingVersionKey), []byte(indexMappingVersion())); err != nil {
+		index.Close()
+		return nil, err
+	}
+	return index, nil
+
+}
+
 type IndexableNode struct {
 	tree.Node
-	ModifTime   time.Time
-	Basename    string
-	NodeType    string
-	Extension   string
-	TextContent string
-	GeoPoint    map[string]interface{}
-	Meta        map[string]interface{}
+	ModifTime    time.Time
+	Basename     string
+	BasenameSort string
+	NodeType     string
+	Extension    string
+	TextContent  string
+	GeoPoint     map[string]interface{}
+	Meta         map[string]interface{}
 }
 
 func (i *IndexableNode) BleveType() string {
@@ -141,6 +217,7 @@ func (s *BleveServer) MakeIndexableNode(ctx context.Context, node *tree.Node) *I
 	var basename string
 	indexNode.GetMeta("name", &basename)
 	indexNode.Basename = basename
+	indexNode.BasenameSort = strings.ToLower(basename)
 	if indexNode.Type == 1 {
 		indexNode.NodeType = "file"
 		indexNode.Extension = filepath.Ext(basename)
@@ -210,7 +287,7 @@ func (s *BleveServer) ClearIndex(ctx context.Context) error {
 	return nil
 }
 
-func (s *BleveServer) SearchNodes(c context.Context, queryObject *tree.Query, from int32, size int32, resultChan chan *tree.Node, doneChan chan bool) error {
+func (s *BleveServer) SearchNodes(c context.Context, queryObject *tree.Query, from int32, size int32, sortField string, sortDesc bool, facets []string, resultChan chan *tree.Node, facetsChan chan *tree.SearchFacet, doneChan chan bool) error {
 
 	boolean := bleve.NewBooleanQuery()
 	// FileName
@@ -219,6 +296,12 @@ func (s *BleveServer) SearchNodes(c context.Context, queryObject *tree.Query, fr
 		wCard.SetField("Basename")
 		boolean.AddMust(wCard)
 	}
+	// Full-text content
+	if len(queryObject.GetContent()) > 0 {
+		contentQuery := bleve.NewMatchQuery(queryObject.GetContent())
+		contentQuery.SetField("TextContent")
+		boolean.AddMust(contentQuery)
+	}
 	// File Size Range
 	if queryObject.MinSize > 0 || queryObject.MaxSize > 0 {
 		var min = float64(queryObject.MinSize)
@@ -298,6 +381,20 @@ func (s *BleveServer) SearchNodes(c context.Context, queryObject *tree.Query, fr
 		searchRequest.Size = int(size)
 	}
 	searchRequest.From = int(from)
+	if sortOrder := s.sortOrder(sortField, sortDesc); len(sortOrder) > 0 {
+		searchRequest.SortBy(sortOrder)
+	}
+	if len(queryObject.GetContent()) > 0 || len(queryObject.GetFileName()) > 0 || len(queryObject.GetFreeString()) > 0 {
+		searchRequest.Highlight = bleve.NewHighlightWithStyle("html")
+		if StoreContent {
+			searchRequest.Highlight.AddField("TextContent")
+		}
+		searchRequest.Highlight.AddField("Basename")
+	}
+	now := time.Now()
+	for name, facetRequest := range s.facetRequests(facets, now) {
+		searchRequest.AddFacet(name, facetRequest)
+	}
 	searchResult, err := s.Engine.SearchInContext(c, searchRequest)
 	if err != nil {
 		doneChan <- true
@@ -332,13 +429,190 @@ func (s *BleveServer) SearchNodes(c context.Context, queryObject *tree.Query, fr
 				break
 			}
 		}
+		if len(hit.Fragments) > 0 {
+			highlights := make(map[string][]string)
+			if fragments, ok := hit.Fragments["TextContent"]; ok {
+				highlights["Content"] = fragments
+			}
+			if fragments, ok := hit.Fragments["Basename"]; ok {
+				highlights["FileName"] = fragments
+			}
+			node.SetMeta(common.META_NAMESPACE_SEARCH_HIGHLIGHTS, highlights)
+		}
 
 		log.Logger(c).Info("SearchObjects", zap.Any("node", node))
 
 		resultChan <- node
 	}
 
+	if facetsChan != nil {
+		for _, facet := range s.parseFacets(searchResult.Facets, now) {
+			facetsChan <- facet
+		}
+	}
+
 	doneChan <- true
 	return nil
 
 }
+
+// sortOrder translates a sort field name into a bleve sort order. Relevance is the default,
+// and ties are always broken by relevance.
+func (s *BleveServer) sortOrder(sortField string, sortDesc bool) []string {
+	var field string
+	switch strings.ToLower(sortField) {
+	case "mtime", "modiftime":
+		field = "MTime"
+	case "size":
+		field = "Size"
+	case "name", "basename":
+		field = "BasenameSort"
+	default:
+		return nil
+	}
+	if sortDesc {
+		field = "-" + field
+	}
+	return []string{field, "-_score"}
+}
+
+type dateRange struct {
+	label      string
+	start, end time.Time
+}
+
+// dateFacetRanges computes the buckets used by the "date" facet, relative to now.
+// A zero time means the range is unbounded on that side.
+func dateFacetRanges(now time.Time) []dateRange {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return []dateRange{
+		{label: "Today", start: today},
+		{label: "Last 7 days", start: today.AddDate(0, 0, -7)},
+		{label: "Last 30 days", start: today.AddDate(0, 0, -30)},
+		{label: "Last year", start: today.AddDate(-1, 0, 0)},
+		{label: "Older than a year", end: today.AddDate(-1, 0, 0)},
+	}
+}
+
+// facetField maps a facet name as sent by clients to the corresponding indexed field.
+// Unknown names are considered as metadata keys.
+func facetField(name string) string {
+	switch strings.ToLower(name) {
+	case "extension":
+		return "Extension"
+	case "type", "nodetype":
+		return "NodeType"
+	case "size":
+		return "Size"
+	case "date", "mtime", "modiftime":
+		return "ModifTime"
+	default:
+		return "Meta." + strings.TrimPrefix(name, "Meta.")
+	}
+}
+
+// facetRequests builds the bleve facets for the requested fields.
+func (s *BleveServer) facetRequests(facets []string, now time.Time) map[string]*bleve.FacetRequest {
+	requests := make(map[string]*bleve.FacetRequest)
+	for _, name := range facets {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		field := facetField(name)
+		if _, ok := requests[field]; ok {
+			continue
+		}
+		switch field {
+		case "Size":
+			facetRequest := bleve.NewFacetRequest(field, len(sizeFacetRanges))
+			for _, r := range sizeFacetRanges {
+				var min, max *float64
+				if r.min > 0 {
+					m := r.min
+					min = &m
+				}
+				if r.max > 0 {
+					m := r.max
+					max = &m
+				}
+				facetRequest.AddNumericRange(r.label, min, max)
+			}
+			requests[field] = facetRequest
+		case "ModifTime":
+			ranges := dateFacetRanges(now)
+			facetRequest := bleve.NewFacetRequest(field, len(ranges))
+			for _, r := range ranges {
+				facetRequest.AddDateTimeRange(r.label, r.start, r.end)
+			}
+			requests[field] = facetRequest
+		default:
+			requests[field] = bleve.NewFacetRequest(field, FacetTermsSize)
+		}
+	}
+	return requests
+}
+
+// parseFacets transforms bleve facets results into tree.SearchFacet. Ranges are
+// returned in their definition order and empty buckets are ignored.
+func (s *BleveServer) parseFacets(results search.FacetResults, now time.Time) (facets []*tree.SearchFacet) {
+	fields := make([]string, 0, len(results))
+	for field := range results {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		result := results[field]
+		switch field {
+		case "Size":
+			counts := make(map[string]int, len(result.NumericRanges))
+			for _, r := range result.NumericRanges {
+				counts[r.Name] = r.Count
+			}
+			for _, r := range sizeFacetRanges {
+				if counts[r.label] == 0 {
+					continue
+				}
+				facets = append(facets, &tree.SearchFacet{
+					FieldName: field,
+					Label:     r.label,
+					Count:     int32(counts[r.label]),
+					Min:       int64(r.min),
+					Max:       int64(r.max),
+				})
+			}
+		case "ModifTime":
+			counts := make(map[string]int, len(result.DateRanges))
+			for _, r := range result.DateRanges {
+				counts[r.Name] = r.Count
+			}
+			for _, r := range dateFacetRanges(now) {
+				if counts[r.label] == 0 {
+					continue
+				}
+				facet := &tree.SearchFacet{
+					FieldName: field,
+					Label:     r.label,
+					Count:     int32(counts[r.label]),
+				}
+				if !r.start.IsZero() {
+					facet.Min = r.start.Unix()
+				}
+				if !r.end.IsZero() {
+					facet.Max = r.end.Unix()
+				}
+				facets = append(facets, facet)
+			}
+		default:
+			for _, term := range result.Terms {
+				facets = append(facets, &tree.SearchFacet{
+					FieldName: field,
+					Label:     term.Term,
+					Term:      term.Term,
+					Count:     int32(term.Count),
+				})
+			}
+		}
+	}
+	return
+}
@@ -32,6 +32,7 @@ import (
 
 	. "github.com/smartystreets/goconvey/convey"
 
+	"github.com/pmker/yux/common"
 	"github.com/pmker/yux/common/proto/tree"
 )
 
@@ -84,9 +85,18 @@ func getTmpIndex(createNodes bool) (s *BleveServer, dir string) {
 
 func search(ctx context.Context, index *BleveServer, queryObject *tree.Query) ([]*tree.Node, error) {
 
+	results, _, e := searchWithOptions(ctx, index, queryObject, "", false, nil)
+	return results, e
+
+}
+
+func searchWithOptions(ctx context.Context, index *BleveServer, queryObject *tree.Query, sortField string, sortDesc bool, facetNames []string) ([]*tree.Node, []*tree.SearchFacet, error) {
+
 	resultsChan := make(chan *tree.Node)
+	facetsChan := make(chan *tree.SearchFacet)
 	doneChan := make(chan bool)
 	results := []*tree.Node{}
+	facets := []*tree.SearchFacet{}
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
@@ -97,15 +107,19 @@ func search(ctx context.Context, index *BleveServer, queryObject *tree.Query) ([
 				if node != nil {
 					results = append(results, node)
 				}
+			case facet := <-facetsChan:
+				if facet != nil {
+					facets = append(facets, facet)
+				}
 			case <-doneChan:
 				return
 			}
 		}
 	}()
 
-	e := index.SearchNodes(ctx, queryObject, 0, 10, resultsChan, doneChan)
+	e := index.SearchNodes(ctx, queryObject, 0, 10, sortField, sortDesc, facetNames, resultsChan, facetsChan, doneChan)
 	wg.Wait()
-	return results, e
+	return results, facets, e
 
 }
 
@@ -126,11 +140,34 @@ func TestNewBleveEngine(t *testing.T) {
 		server, err = NewBleveEngine(false)
 		So(err, ShouldBeNil)
 		So(server, ShouldNotBeNil)
+		So(server.NeedsReindex, ShouldBeFalse)
 
 		e = server.Close()
 		So(e, ShouldBeNil)
 	})
 
+	Convey("Test indexes created with another mapping are rebuilt", t, func() {
+		server, err := NewBleveEngine(false)
+		So(err, ShouldBeNil)
+		node := &tree.Node{Uuid: "docID1", Path: "/path/to/node.txt", Type: 1}
+		node.SetMeta("name", "node.txt")
+		So(server.IndexNode(context.Background(), node), ShouldBeNil)
+		So(server.Engine.SetInternal([]byte(mappingVersionKey), []byte("1")), ShouldBeNil)
+		So(server.Close(), ShouldBeNil)
+
+		server, err = NewBleveEngine(false)
+		So(err, ShouldBeNil)
+		So(server.NeedsReindex, ShouldBeTrue)
+		count, _ := server.Engine.DocCount()
+		So(count, ShouldEqual, 0)
+		So(server.Close(), ShouldBeNil)
+
+		server, err = NewBleveEngine(false)
+		So(err, ShouldBeNil)
+		So(server.NeedsReindex, ShouldBeFalse)
+		So(server.Close(), ShouldBeNil)
+	})
+
 }
 
 func TestMakeIndexableNode(t *testing.T) {
@@ -478,6 +515,156 @@ func TestSearchNode(t *testing.T) {
 
 }
 
+func TestSearchOptions(t *testing.T) {
+
+	Convey("Sort results", t, func() {
+
+		server, tmpDir := getTmpIndex(true)
+		defer func() {
+			server.Close()
+			e := os.RemoveAll(tmpDir)
+			if e != nil {
+				log.Println(e)
+			}
+		}()
+
+		ctx := context.Background()
+		queryObject := &tree.Query{MinSize: 1}
+
+		results, _, e := searchWithOptions(ctx, server, queryObject, "size", true, nil)
+		So(e, ShouldBeNil)
+		So(results, ShouldHaveLength, 2)
+		So(results[0].GetUuid(), ShouldEqual, "docID2")
+		So(results[1].GetUuid(), ShouldEqual, "docID1")
+
+		results, _, e = searchWithOptions(ctx, server, queryObject, "name", false, nil)
+		So(e, ShouldBeNil)
+		So(results, ShouldHaveLength, 2)
+		So(results[0].GetUuid(), ShouldEqual, "docID2")
+		So(results[1].GetUuid(), ShouldEqual, "docID1")
+
+		results, _, e = searchWithOptions(ctx, server, queryObject, "name", true, nil)
+		So(e, ShouldBeNil)
+		So(results, ShouldHaveLength, 2)
+		So(results[0].GetUuid(), ShouldEqual, "docID1")
+		So(results[1].GetUuid(), ShouldEqual, "docID2")
+
+	})
+
+	Convey("Compute facets", t, func() {
+
+		server, tmpDir := getTmpIndex(true)
+		defer func() {
+			server.Close()
+			e := os.RemoveAll(tmpDir)
+			if e != nil {
+				log.Println(e)
+			}
+		}()
+
+		ctx := context.Background()
+		queryObject := &tree.Query{MinSize: 1}
+
+		results, facets, e := searchWithOptions(ctx, server, queryObject, "", false, []string{"Extension", "type", "size", "date", "FreeMeta"})
+		So(e, ShouldBeNil)
+		So(results, ShouldHaveLength, 2)
+
+		byField := make(map[string][]*tree.SearchFacet)
+		for _, f := range facets {
+			byField[f.FieldName] = append(byField[f.FieldName], f)
+		}
+		So(byField["Extension"], ShouldHaveLength, 1)
+		So(byField["Extension"][0].Term, ShouldEqual, ".txt")
+		So(byField["Extension"][0].Count, ShouldEqual, 1)
+		So(byField["NodeType"], ShouldHaveLength, 2)
+		So(byField["Size"], ShouldHaveLength, 1)
+		So(byField["Size"][0].Count, ShouldEqual, 2)
+		So(byField["Size"][0].Max, ShouldEqual, 100*1024)
+		So(byField["ModifTime"], ShouldHaveLength, 4)
+		So(byField["ModifTime"][0].Label, ShouldEqual, "Today")
+		So(byField["ModifTime"][0].Count, ShouldEqual, 2)
+		So(byField["Meta.FreeMeta"], ShouldHaveLength, 1)
+		So(byField["Meta.FreeMeta"][0].Count, ShouldEqual, 1)
+
+	})
+
+	Convey("Search content with highlights", t, func() {
+
+		StoreContent = true
+		server, tmpDir := getTmpIndex(false)
+		defer func() {
+			StoreContent = false
+			server.Close()
+			e := os.RemoveAll(tmpDir)
+			if e != nil {
+				log.Println(e)
+			}
+		}()
+
+		ctx := context.Background()
+		node := &tree.Node{
+			Uuid:  "docID3",
+			Path:  "/path/to/report.txt",
+			MTime: time.Now().Unix(),
+			Type:  1,
+			Size:  42,
+		}
+		node.SetMeta("name", "report.txt")
+		indexNode := server.MakeIndexableNode(ctx, node)
+		indexNode.TextContent = "The quarterly report shows a strong increase of revenues"
+		So(server.Engine.Index(node.Uuid, indexNode), ShouldBeNil)
+
+		results, e := search(ctx, server, &tree.Query{Content: "revenues"})
+		So(e, ShouldBeNil)
+		So(results, ShouldHaveLength, 1)
+
+		var highlights map[string][]string
+		So(results[0].GetMeta(common.META_NAMESPACE_SEARCH_HIGHLIGHTS, &highlights), ShouldBeNil)
+		So(highlights["Content"], ShouldHaveLength, 1)
+		So(highlights["Content"][0], ShouldContainSubstring, "<mark>revenues</mark>")
+
+		results, e = search(ctx, server, &tree.Query{Content: "expenses"})
+		So(e, ShouldBeNil)
+		So(results, ShouldHaveLength, 0)
+
+	})
+
+	Convey("Content is searchable but not highlighted when it is not stored", t, func() {
+
+		server, tmpDir := getTmpIndex(false)
+		defer func() {
+			server.Close()
+			e := os.RemoveAll(tmpDir)
+			if e != nil {
+				log.Println(e)
+			}
+		}()
+
+		ctx := context.Background()
+		node := &tree.Node{
+			Uuid:  "docID3",
+			Path:  "/path/to/report.txt",
+			MTime: time.Now().Unix(),
+			Type:  1,
+			Size:  42,
+		}
+		node.SetMeta("name", "report.txt")
+		indexNode := server.MakeIndexableNode(ctx, node)
+		indexNode.TextContent = "The quarterly report shows a strong increase of revenues"
+		So(server.Engine.Index(node.Uuid, indexNode), ShouldBeNil)
+
+		results, e := search(ctx, server, &tree.Query{Content: "revenues"})
+		So(e, ShouldBeNil)
+		So(results, ShouldHaveLength, 1)
+
+		var highlights map[string][]string
+		results[0].GetMeta(common.META_NAMESPACE_SEARCH_HIGHLIGHTS, &highlights)
+		So(highlights["Content"], ShouldBeEmpty)
+
+	})
+
+}
+
 func TestDeleteNode(t *testing.T) {
 
 	Convey("Delete Node", t, func() {
@@ -30,7 +30,9 @@ import (
 type SearchEngine interface {
 	IndexNode(context.Context, *tree.Node) error
 	DeleteNode(context.Context, *tree.Node) error
-	SearchNodes(context.Context, *tree.Query, int32, int32, chan *tree.Node, chan bool) error
+	// SearchNodes sends matching nodes on the results channel, then the computed facets, and finally
+	// signals the done channel. Sort field may be empty for relevance.
+	SearchNodes(c context.Context, query *tree.Query, from int32, size int32, sortField string, sortDesc bool, facets []string, resultChan chan *tree.Node, facetsChan chan *tree.SearchFacet, doneChan chan bool) error
 	ClearIndex(ctx context.Context) error
 	Close() error
 }
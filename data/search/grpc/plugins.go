@@ -24,11 +24,16 @@
 package grpc
 
 import (
+	"context"
 	"path/filepath"
+	"time"
 
 	"github.com/micro/go-micro"
+	"go.uber.org/zap"
+
 	"github.com/pmker/yux/common"
 	"github.com/pmker/yux/common/config"
+	"github.com/pmker/yux/common/log"
 	"github.com/pmker/yux/common/micro"
 	"github.com/pmker/yux/common/proto/sync"
 	"github.com/pmker/yux/common/proto/tree"
@@ -55,6 +60,9 @@ func init() {
 				if indexConf := cfg.Get("indexContent"); indexConf != nil {
 					indexContent = cfg.Get("indexContent").(bool)
 				}
+				if storeConf := cfg.Get("storeContent"); storeConf != nil {
+					bleve.StoreContent = storeConf.(bool)
+				}
 				dir, _ := config.ServiceDataDir(Name)
 				bleve.BleveIndexPath = filepath.Join(dir, "searchengine.bleve")
 				bleveEngine, err := bleve.NewBleveEngine(indexContent)
@@ -66,6 +74,21 @@ func init() {
 					TreeClient: tree.NewNodeProviderClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_TREE, defaults.NewClient()),
 				}
 
+				if bleveEngine.NeedsReindex {
+					// Index was dropped because its mapping changed, fill it again as soon as the tree is available
+					ctx := m.Options().Context
+					m.Init(micro.AfterStart(func() error {
+						go func() {
+							if e := service.Retry(func() error {
+								return server.Reindex(context.Background())
+							}, 10*time.Second, 10*time.Minute); e != nil {
+								log.Logger(ctx).Error("Cannot reindex search engine", zap.Error(e))
+							}
+						}()
+						return nil
+					}))
+				}
+
 				tree.RegisterSearcherHandler(m.Options().Server, server)
 				sync.RegisterSyncEndpointHandler(m.Options().Server, server)
 
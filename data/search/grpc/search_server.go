@@ -115,10 +115,18 @@ func (s *SearchServer) processEvent(ctx context.Context, e *tree.NodeChangeEvent
 func (s *SearchServer) Search(ctx context.Context, req *tree.SearchRequest, streamer tree.Searcher_SearchStream) error {
 
 	resultsChan := make(chan *tree.Node)
+	facetsChan := make(chan *tree.SearchFacet)
 	doneChan := make(chan bool)
 	defer close(resultsChan)
+	defer close(facetsChan)
 	defer close(doneChan)
 
+	var facets []*tree.SearchFacet
+	var requestedFacets []string
+	if req.GetFacet() != "" {
+		requestedFacets = strings.Split(req.GetFacet(), ",")
+	}
+
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
@@ -135,6 +143,10 @@ func (s *SearchServer) Search(ctx context.Context, req *tree.SearchRequest, stre
 							Uuid: node.Uuid,
 						}})
 						if e == nil {
+							var highlights map[string][]string
+							if node.GetMeta(common.META_NAMESPACE_SEARCH_HIGHLIGHTS, &highlights) == nil && len(highlights) > 0 {
+								response.Node.SetMeta(common.META_NAMESPACE_SEARCH_HIGHLIGHTS, highlights)
+							}
 							streamer.Send(&tree.SearchResponse{Node: response.Node})
 						} else if errors.Parse(e.Error()).Code == 404 {
 
@@ -152,48 +164,60 @@ func (s *SearchServer) Search(ctx context.Context, req *tree.SearchRequest, stre
 					}
 
 				}
+			case facet := <-facetsChan:
+				if facet != nil {
+					facets = append(facets, facet)
+				}
 			case <-doneChan:
 				return
 			}
 		}
 	}()
 
-	err := s.Engine.SearchNodes(ctx, req.GetQuery(), req.GetFrom(), req.GetSize(), resultsChan, doneChan)
+	err := s.Engine.SearchNodes(ctx, req.GetQuery(), req.GetFrom(), req.GetSize(), req.GetSortField(), req.GetSortDirDesc(), requestedFacets, resultsChan, facetsChan, doneChan)
 	if err != nil {
 		return err
 	}
 	wg.Wait()
+	if len(facets) > 0 {
+		streamer.Send(&tree.SearchResponse{Facets: facets})
+	}
 	return nil
 }
 
 func (s *SearchServer) TriggerResync(c context.Context, req *protosync.ResyncRequest, resp *protosync.ResyncResponse) error {
 
 	go func() {
-		bg := context.Background()
-		s.Engine.ClearIndex(bg)
-
-		dsStream, err := s.TreeClient.ListNodes(bg, &tree.ListNodesRequest{
-			Node:      &tree.Node{Path: ""},
-			Recursive: true,
-		})
-		if err != nil {
-			log.Logger(c).Error("Resync", zap.Error(err))
-			return
-		}
-		defer dsStream.Close()
-		for {
-			response, e := dsStream.Recv()
-			if e != nil || response == nil {
-				break
-			}
-			if !strings.HasPrefix(response.Node.GetUuid(), "DATASOURCE:") && !utils.IgnoreNodeForOutput(c, response.Node) {
-				s.Engine.IndexNode(bg, response.Node)
-			}
+		if e := s.Reindex(context.Background()); e != nil {
+			log.Logger(c).Error("Resync", zap.Error(e))
 		}
-
 	}()
 
 	resp.Success = true
 
 	return nil
 }
+
+// Reindex clears the index and indexes again all the nodes of the tree.
+func (s *SearchServer) Reindex(ctx context.Context) error {
+
+	dsStream, err := s.TreeClient.ListNodes(ctx, &tree.ListNodesRequest{
+		Node:      &tree.Node{Path: ""},
+		Recursive: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer dsStream.Close()
+	s.Engine.ClearIndex(ctx)
+	for {
+		response, e := dsStream.Recv()
+		if e != nil || response == nil {
+			break
+		}
+		if !strings.HasPrefix(response.Node.GetUuid(), "DATASOURCE:") && !utils.IgnoreNodeForOutput(ctx, response.Node) {
+			s.Engine.IndexNode(ctx, response.Node)
+		}
+	}
+	return nil
+}
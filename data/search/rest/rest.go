@@ -25,6 +25,7 @@ import (
 	"strings"
 
 	"github.com/emicklei/go-restful"
+	"github.com/micro/go-micro/errors"
 	"go.uber.org/zap"
 
 	"context"
@@ -77,6 +78,15 @@ func (s *Handler) Nodes(req *restful.Request, rsp *restful.Response) {
 		return
 	}
 
+	// Visitors of a file drop cannot see anything but the drop folder itself
+	if drop, e := views.IsFileDropVisitor(ctx); e != nil {
+		service.RestError500(req, rsp, e)
+		return
+	} else if drop {
+		service.RestError403(req, rsp, errors.Forbidden("FileDropUploadOnly", "This link only accepts uploads"))
+		return
+	}
+
 	query := searchRequest.Query
 	if query == nil {
 		rsp.WriteEntity(&rest.SearchResults{Total: 0})
@@ -86,6 +96,7 @@ func (s *Handler) Nodes(req *restful.Request, rsp *restful.Response) {
 	router := s.getRouter()
 
 	var nodes []*tree.Node
+	var facets []*tree.SearchFacet
 	prefixes := []string{}
 	nodesPrefixes := map[string]string{}
 	var passedPrefix string
@@ -152,6 +163,11 @@ func (s *Handler) Nodes(req *restful.Request, rsp *restful.Response) {
 			} else if rErr != nil {
 				return err
 			}
+			if resp.Node == nil {
+				// Facets are sent in a last response without node
+				facets = append(facets, resp.Facets...)
+				continue
+			}
 			respNode := resp.Node
 			for r, p := range nodesPrefixes {
 				if strings.HasPrefix(respNode.Path, r+"/") {
@@ -185,6 +201,7 @@ func (s *Handler) Nodes(req *restful.Request, rsp *restful.Response) {
 	result := &rest.SearchResults{
 		Results: nodes,
 		Total:   int32(len(nodes)),
+		Facets:  facets,
 	}
 	rsp.WriteEntity(result)
 
@@ -24,6 +24,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -48,6 +49,7 @@ import (
 	synccommon "github.com/pmker/yux/data/source/sync/lib/common"
 	"github.com/pmker/yux/data/source/sync/lib/endpoints"
 	"github.com/pmker/yux/data/source/sync/lib/filters"
+	"github.com/pmker/yux/data/source/sync/lib/proc"
 	"github.com/pmker/yux/data/source/sync/lib/task"
 )
 
@@ -142,6 +144,27 @@ func (s *Handler) initSync(syncConfig *object.DataSource) error {
 	s.ObjectConfig = minioConfig
 	s.syncTask = task.NewSync(ctx, source, target)
 	s.syncTask.Direction = "left"
+	if syncConfig.StorageConfiguration["syncMode"] == "bidirectional" {
+		// Changes found in the index are also applied to the storage, conflicts are resolved with conflictPolicy
+		s.syncTask.Direction = "bi"
+		switch policy := proc.ConflictPolicy(syncConfig.StorageConfiguration["conflictPolicy"]); policy {
+		case "", proc.ConflictKeepBoth, proc.ConflictPreferLeft, proc.ConflictPreferRight:
+			s.syncTask.ConflictPolicy = policy
+		default:
+			log.Logger(ctx).Error("Unknown sync conflict policy, keeping both versions", zap.String("policy", string(policy)))
+		}
+	}
+
+	// The same snapshot is used for both modes: after a successful pass, the storage and the index are identical
+	if dataDir, e := config.ServiceDataDir(common.SERVICE_GRPC_NAMESPACE_ + common.SERVICE_DATA_SYNC_ + datasource); e == nil {
+		if snapshot, e := endpoints.NewBoltSnapshot(filepath.Join(dataDir, "snapshot.db")); e == nil {
+			s.syncTask.Snapshot = snapshot
+		} else if s.syncTask.Direction == "bi" {
+			return fmt.Errorf("cannot open sync snapshot required by bidirectional sync: %v", e)
+		} else {
+			log.Logger(ctx).Error("Cannot open sync snapshot, resync will compare source and index", zap.Error(e))
+		}
+	}
 
 	return nil
 
@@ -239,7 +262,13 @@ func (s *Handler) TriggerResync(c context.Context, req *protosync.ResyncRequest,
 		}()
 	}
 
-	diff, e := s.syncTask.Resync(c, req.DryRun, statusChan, doneChan)
+	var diff interface{}
+	var e error
+	if s.syncTask.Direction == "bi" {
+		diff, e = s.syncTask.ThreeWayResync(c, req.DryRun, statusChan, doneChan)
+	} else {
+		diff, e = s.syncTask.Resync(c, req.DryRun, statusChan, doneChan)
+	}
 	if e != nil {
 		if req.Task != nil {
 			theTask := req.Task
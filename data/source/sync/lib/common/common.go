@@ -28,6 +28,7 @@ import (
 	"time"
 
 	"github.com/micro/go-micro/metadata"
+	servicescommon "github.com/pmker/yux/common"
 	"github.com/pmker/yux/common/proto/tree"
 )
 
@@ -218,7 +219,7 @@ func (w *WatchObject) Close() {
 }
 
 func IsIgnoredFile(path string) (ignored bool) {
-	return strings.HasSuffix(path, ".DS_Store") || strings.Contains(path, ".minio.sys") || strings.HasSuffix(path, "$buckets.json") || strings.HasSuffix(path, "$multiparts-session.json") || strings.HasSuffix(path, "--COMPUTE_HASH")
+	return strings.HasSuffix(path, ".DS_Store") || strings.Contains(path, ".minio.sys") || strings.Contains(path, servicescommon.PYDIO_DEDUP_BLOBS_FOLDER) || strings.HasSuffix(path, "$buckets.json") || strings.HasSuffix(path, "$multiparts-session.json") || strings.HasSuffix(path, "--COMPUTE_HASH")
 }
 
 func NodeToEventInfo(ctx context.Context, path string, node *tree.Node, eventType EventType) (eventInfo EventInfo) {
@@ -0,0 +1,499 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+package endpoints
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/data/source/sync/lib/common"
+)
+
+var (
+	snapshotMetaBucket    = []byte("meta")
+	snapshotGenerationKey = []byte("generation")
+
+	// Number of nodes written per transaction when capturing a whole endpoint
+	snapshotCaptureBatchSize = 1000
+)
+
+// snapshotBuckets are the buckets storing one generation of the snapshot
+type snapshotBuckets struct {
+	nodes  *bolt.Bucket
+	uuids  *bolt.Bucket
+	hashes *bolt.Bucket
+}
+
+// BoltSnapshot is a snapshot endpoint persisted in a BoltDB file. Nodes are
+// stored by path and indexed by Uuid and Etag, so that lookups do not require
+// loading the whole tree in memory.
+//
+// Capture writes a new generation of buckets next to the current one, and
+// switches to it in a single transaction once complete.
+//
+// Walk runs inside a read transaction: the WalkNodesFunc must not write to
+// the same snapshot.
+type BoltSnapshot struct {
+	db *bolt.DB
+}
+
+// NewBoltSnapshot opens or creates a snapshot in the given file. Buckets left
+// by an interrupted capture are dropped.
+func NewBoltSnapshot(filename string) (*BoltSnapshot, error) {
+
+	options := bolt.DefaultOptions
+	options.Timeout = 5 * time.Second
+	db, err := bolt.Open(filename, 0644, options)
+	if err != nil {
+		return nil, err
+	}
+	er := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(snapshotMetaBucket); err != nil {
+			return err
+		}
+		current := make(map[string]bool)
+		for _, name := range snapshotBucketNames(currentGeneration(tx)) {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+			current[string(name)] = true
+		}
+		var stale [][]byte
+		tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			if !current[string(name)] && !bytes.Equal(name, snapshotMetaBucket) {
+				stale = append(stale, append([]byte{}, name...))
+			}
+			return nil
+		})
+		for _, name := range stale {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if er != nil {
+		db.Close()
+		return nil, er
+	}
+	return &BoltSnapshot{db: db}, nil
+}
+
+// Close closes the underlying BoltDB file
+func (s *BoltSnapshot) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltSnapshot) GetEndpointInfo() common.EndpointInfo {
+
+	return common.EndpointInfo{
+		RequiresFoldersRescan: false,
+		RequiresNormalization: false,
+	}
+
+}
+
+/*************************/
+/* Path Sync Target 	 */
+/*************************/
+func (s *BoltSnapshot) LoadNode(ctx context.Context, path string, leaf ...bool) (node *tree.Node, err error) {
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		node, err = s.get(currentBuckets(tx), snapshotPathKey(path))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func (s *BoltSnapshot) CreateNode(ctx context.Context, node *tree.Node, updateIfExists bool) (err error) {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return s.put(currentBuckets(tx), node)
+	})
+}
+
+func (s *BoltSnapshot) UpdateNode(ctx context.Context, node *tree.Node) (err error) {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return s.put(currentBuckets(tx), node)
+	})
+}
+
+func (s *BoltSnapshot) DeleteNode(ctx context.Context, path string) (err error) {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return s.deleteTree(currentBuckets(tx), path)
+	})
+}
+
+func (s *BoltSnapshot) MoveNode(ctx context.Context, oldPath string, newPath string) (err error) {
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return s.moveTree(currentBuckets(tx), oldPath, newPath)
+	})
+
+}
+
+/*************************/
+/* Path Sync Source 	 */
+/*************************/
+func (s *BoltSnapshot) Walk(walknFc common.WalkNodesFunc, pathes ...string) (err error) {
+
+	return s.db.View(func(tx *bolt.Tx) error {
+		return currentBuckets(tx).nodes.ForEach(func(k, v []byte) error {
+			if len(pathes) > 0 {
+				// If there are some limitations on path, detect them
+				for _, testPath := range pathes {
+					if !bytes.HasPrefix(k, snapshotPathKey(testPath)) {
+						return nil
+					}
+				}
+			}
+			node := &tree.Node{}
+			if err := proto.Unmarshal(v, node); err != nil {
+				return err
+			}
+			walknFc(node.Path, node, nil)
+			return nil
+		})
+	})
+
+}
+
+func (s *BoltSnapshot) Watch(recursivePath string) (*common.WatchObject, error) {
+	return nil, errors.New("Not implemented")
+}
+
+/*************************/
+/* Uuid Provider 	 */
+/*************************/
+func (s *BoltSnapshot) LoadNodeByUuid(ctx context.Context, uuid string) (node *tree.Node, err error) {
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		b := currentBuckets(tx)
+		path := b.uuids.Get([]byte(uuid))
+		if path == nil {
+			return errors.New("Node not found")
+		}
+		node, err = s.get(b, path)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+/*************************/
+/* Other Methods 	 */
+/*************************/
+
+// FindByHash returns the first node with the given Etag, or nil
+func (s *BoltSnapshot) FindByHash(hash string) (node *tree.Node) {
+
+	s.db.View(func(tx *bolt.Tx) error {
+		b := currentBuckets(tx)
+		prefix := snapshotHashKey(hash, "")
+		c := b.hashes.Cursor()
+		if k, path := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix) {
+			node, _ = s.get(b, path)
+		}
+		return nil
+	})
+	return
+
+}
+
+// FindByUuid returns the node with the given Uuid, or nil
+func (s *BoltSnapshot) FindByUuid(id string) (node *tree.Node) {
+	node, _ = s.LoadNodeByUuid(context.Background(), id)
+	return
+}
+
+// IsEmpty tells if the snapshot contains at least one node
+func (s *BoltSnapshot) IsEmpty() (empty bool) {
+	s.db.View(func(tx *bolt.Tx) error {
+		k, _ := currentBuckets(tx).nodes.Cursor().First()
+		empty = k == nil
+		return nil
+	})
+	return
+}
+
+// Capture replaces the whole content of the snapshot by walking the given source. Nodes are written
+// to a new generation of buckets, which replaces the current one in a single transaction once the
+// walk succeeded: readers never see a partial snapshot, and the previous one is kept on failure.
+func (s *BoltSnapshot) Capture(ctx context.Context, source common.PathSyncSource) error {
+
+	generation := strconv.FormatInt(time.Now().UnixNano(), 36)
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range snapshotBucketNames(generation) {
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var nodes []*tree.Node
+	var flushErr error
+	flush := func() {
+		if flushErr == nil && len(nodes) > 0 {
+			flushErr = s.db.Update(func(tx *bolt.Tx) error {
+				b := generationBuckets(tx, generation)
+				for _, node := range nodes {
+					if err := s.put(b, node); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		}
+		nodes = nil
+	}
+	err = source.Walk(func(path string, node *tree.Node, err error) {
+		if err != nil || common.IsIgnoredFile(path) || len(path) == 0 || path == common.InternalPathSeparator {
+			return
+		}
+		nodes = append(nodes, node)
+		if len(nodes) >= snapshotCaptureBatchSize {
+			flush()
+		}
+	})
+	if err == nil {
+		flush()
+		err = flushErr
+	}
+	if err != nil {
+		s.db.Update(func(tx *bolt.Tx) error {
+			return dropGeneration(tx, generation)
+		})
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		previous := currentGeneration(tx)
+		if err := tx.Bucket(snapshotMetaBucket).Put(snapshotGenerationKey, []byte(generation)); err != nil {
+			return err
+		}
+		return dropGeneration(tx, previous)
+	})
+
+}
+
+// ApplyChanges deletes then creates or updates the given nodes inside a single transaction
+func (s *BoltSnapshot) ApplyChanges(ctx context.Context, deletes []string, nodes []*tree.Node) error {
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := currentBuckets(tx)
+		for _, path := range deletes {
+			if err := s.deleteTree(b, path); err != nil {
+				return err
+			}
+		}
+		for _, node := range nodes {
+			if err := s.put(b, node); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+}
+
+func (s *BoltSnapshot) Stats() string {
+	var leafs, colls int
+	s.Walk(func(path string, node *tree.Node, err error) {
+		if node.IsLeaf() {
+			leafs++
+		} else {
+			colls++
+		}
+	})
+	return fmt.Sprintf("Snapshot contains %v files and %v folders", leafs, colls)
+}
+
+func (s *BoltSnapshot) get(b *snapshotBuckets, key []byte) (*tree.Node, error) {
+	data := b.nodes.Get(key)
+	if data == nil {
+		return nil, errors.New("Node not found")
+	}
+	node := &tree.Node{}
+	if err := proto.Unmarshal(data, node); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// put stores a node and its indexes, replacing any existing node at the same path
+func (s *BoltSnapshot) put(b *snapshotBuckets, node *tree.Node) error {
+
+	key := snapshotPathKey(node.Path)
+	if existing, err := s.get(b, key); err == nil {
+		if err := s.remove(b, existing); err != nil {
+			return err
+		}
+	}
+	data, err := proto.Marshal(node)
+	if err != nil {
+		return err
+	}
+	if err := b.nodes.Put(key, data); err != nil {
+		return err
+	}
+	if node.Uuid != "" {
+		if err := b.uuids.Put([]byte(node.Uuid), key); err != nil {
+			return err
+		}
+	}
+	if node.IsLeaf() && node.Etag != "" {
+		return b.hashes.Put(snapshotHashKey(node.Etag, node.Path), key)
+	}
+	return nil
+
+}
+
+// remove deletes a node and its indexes
+func (s *BoltSnapshot) remove(b *snapshotBuckets, node *tree.Node) error {
+
+	key := snapshotPathKey(node.Path)
+	if node.Uuid != "" {
+		if bytes.Equal(b.uuids.Get([]byte(node.Uuid)), key) {
+			if err := b.uuids.Delete([]byte(node.Uuid)); err != nil {
+				return err
+			}
+		}
+	}
+	if node.IsLeaf() && node.Etag != "" {
+		if err := b.hashes.Delete(snapshotHashKey(node.Etag, node.Path)); err != nil {
+			return err
+		}
+	}
+	return b.nodes.Delete(key)
+
+}
+
+func (s *BoltSnapshot) deleteTree(b *snapshotBuckets, path string) error {
+	nodes, err := s.listTree(b, path)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if err := s.remove(b, node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *BoltSnapshot) moveTree(b *snapshotBuckets, oldPath string, newPath string) error {
+	nodes, err := s.listTree(b, oldPath)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if err := s.remove(b, node); err != nil {
+			return err
+		}
+	}
+	for _, node := range nodes {
+		node.Path = newPath + strings.TrimPrefix(node.Path, oldPath)
+		if err := s.put(b, node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listTree loads a node and all its children
+func (s *BoltSnapshot) listTree(b *snapshotBuckets, path string) (nodes []*tree.Node, err error) {
+
+	if node, e := s.get(b, snapshotPathKey(path)); e == nil {
+		nodes = append(nodes, node)
+	}
+	prefix := snapshotPathKey(strings.TrimSuffix(path, common.InternalPathSeparator) + common.InternalPathSeparator)
+	c := b.nodes.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		node := &tree.Node{}
+		if err := proto.Unmarshal(v, node); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+
+}
+
+// currentGeneration reads the generation of the buckets in use, empty for the initial one
+func currentGeneration(tx *bolt.Tx) string {
+	return string(tx.Bucket(snapshotMetaBucket).Get(snapshotGenerationKey))
+}
+
+func currentBuckets(tx *bolt.Tx) *snapshotBuckets {
+	return generationBuckets(tx, currentGeneration(tx))
+}
+
+func generationBuckets(tx *bolt.Tx, generation string) *snapshotBuckets {
+	names := snapshotBucketNames(generation)
+	return &snapshotBuckets{
+		nodes:  tx.Bucket(names[0]),
+		uuids:  tx.Bucket(names[1]),
+		hashes: tx.Bucket(names[2]),
+	}
+}
+
+func dropGeneration(tx *bolt.Tx, generation string) error {
+	for _, name := range snapshotBucketNames(generation) {
+		if err := tx.DeleteBucket(name); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshotBucketNames lists the nodes, uuids and hashes buckets of a generation
+func snapshotBucketNames(generation string) [][]byte {
+	suffix := ""
+	if generation != "" {
+		suffix = "-" + generation
+	}
+	return [][]byte{[]byte("nodes" + suffix), []byte("uuids" + suffix), []byte("hashes" + suffix)}
+}
+
+func snapshotPathKey(path string) []byte {
+	return []byte(norm.NFC.String(path))
+}
+
+func snapshotHashKey(hash string, path string) []byte {
+	return []byte(hash + "\x00" + norm.NFC.String(path))
+}
@@ -0,0 +1,258 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package endpoints
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/data/source/sync/lib/common"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// failingSource walks its nodes then fails
+type failingSource struct {
+	*MemDB
+}
+
+func (f *failingSource) Walk(walknFc common.WalkNodesFunc, pathes ...string) error {
+	f.MemDB.Walk(walknFc, pathes...)
+	return errors.New("walk interrupted")
+}
+
+func basicBoltSnapshot() (*BoltSnapshot, func()) {
+	folder, e := ioutil.TempDir("", "bolt-snapshot")
+	So(e, ShouldBeNil)
+	snapshot, e := NewBoltSnapshot(filepath.Join(folder, "snapshot.db"))
+	So(e, ShouldBeNil)
+	snapshot.CreateNode(memTestCtx, &tree.Node{
+		Path: "/folder",
+		Type: tree.NodeType_COLLECTION,
+		Uuid: "folderuuid",
+	}, true)
+	snapshot.CreateNode(memTestCtx, &tree.Node{
+		Path: "/folder/file",
+		Type: tree.NodeType_LEAF,
+		Uuid: "fileuuid",
+		Etag: "filehash",
+	}, true)
+	snapshot.CreateNode(memTestCtx, &tree.Node{
+		Path: "/other",
+		Type: tree.NodeType_LEAF,
+		Uuid: "otheruuid",
+		Etag: "otherhash",
+	}, true)
+	return snapshot, func() {
+		snapshot.Close()
+		os.RemoveAll(folder)
+	}
+}
+
+func TestBoltSnapshotCrud(t *testing.T) {
+
+	Convey("Test create, load and update nodes", t, func() {
+
+		snapshot, closer := basicBoltSnapshot()
+		defer closer()
+
+		So(snapshot.IsEmpty(), ShouldBeFalse)
+		node, e := snapshot.LoadNode(memTestCtx, "/folder/file")
+		So(e, ShouldBeNil)
+		So(node, ShouldNotBeNil)
+		So(node.Uuid, ShouldEqual, "fileuuid")
+
+		missing, e := snapshot.LoadNode(memTestCtx, "/missing")
+		So(e, ShouldNotBeNil)
+		So(missing, ShouldBeNil)
+
+		e = snapshot.UpdateNode(memTestCtx, &tree.Node{
+			Path: "/folder/file",
+			Type: tree.NodeType_LEAF,
+			Uuid: "fileuuid",
+			Etag: "newhash",
+		})
+		So(e, ShouldBeNil)
+		So(snapshot.FindByHash("filehash"), ShouldBeNil)
+		So(snapshot.FindByHash("newhash"), ShouldNotBeNil)
+		So(snapshot.FindByHash("newhash").Path, ShouldEqual, "/folder/file")
+
+	})
+
+	Convey("Test finding nodes by uuid", t, func() {
+
+		snapshot, closer := basicBoltSnapshot()
+		defer closer()
+
+		node := snapshot.FindByUuid("otheruuid")
+		So(node, ShouldNotBeNil)
+		So(node.Path, ShouldEqual, "/other")
+		So(snapshot.FindByUuid("unknown"), ShouldBeNil)
+
+		_, e := snapshot.LoadNodeByUuid(memTestCtx, "unknown")
+		So(e, ShouldNotBeNil)
+
+	})
+
+}
+
+func TestBoltSnapshotMoveDelete(t *testing.T) {
+
+	Convey("Test moving a folder with its children", t, func() {
+
+		snapshot, closer := basicBoltSnapshot()
+		defer closer()
+
+		e := snapshot.MoveNode(memTestCtx, "/folder", "/moved")
+		So(e, ShouldBeNil)
+
+		old, _ := snapshot.LoadNode(memTestCtx, "/folder/file")
+		So(old, ShouldBeNil)
+		moved, _ := snapshot.LoadNode(memTestCtx, "/moved/file")
+		So(moved, ShouldNotBeNil)
+		So(snapshot.FindByUuid("fileuuid").Path, ShouldEqual, "/moved/file")
+		So(snapshot.FindByHash("filehash").Path, ShouldEqual, "/moved/file")
+
+	})
+
+	Convey("Test deleting a folder recursively", t, func() {
+
+		snapshot, closer := basicBoltSnapshot()
+		defer closer()
+
+		e := snapshot.DeleteNode(memTestCtx, "/folder")
+		So(e, ShouldBeNil)
+
+		var paths []string
+		snapshot.Walk(func(path string, node *tree.Node, err error) {
+			paths = append(paths, path)
+		})
+		So(paths, ShouldResemble, []string{"/other"})
+		So(snapshot.FindByUuid("fileuuid"), ShouldBeNil)
+		So(snapshot.FindByHash("filehash"), ShouldBeNil)
+
+	})
+
+}
+
+func TestBoltSnapshotCapture(t *testing.T) {
+
+	Convey("Test capturing a source replaces the snapshot", t, func() {
+
+		snapshot, closer := basicBoltSnapshot()
+		defer closer()
+
+		db := NewMemDB()
+		db.CreateNode(memTestCtx, &tree.Node{
+			Path: "/",
+			Type: tree.NodeType_COLLECTION,
+			Uuid: "rootuuid",
+		}, true)
+		db.CreateNode(memTestCtx, &tree.Node{
+			Path: "/captured",
+			Type: tree.NodeType_LEAF,
+			Uuid: "captureduuid",
+			Etag: "capturedhash",
+		}, true)
+
+		e := snapshot.Capture(memTestCtx, db)
+		So(e, ShouldBeNil)
+
+		var paths []string
+		snapshot.Walk(func(path string, node *tree.Node, err error) {
+			paths = append(paths, path)
+		})
+		So(paths, ShouldResemble, []string{"/captured"})
+		So(snapshot.FindByUuid("fileuuid"), ShouldBeNil)
+		So(snapshot.FindByHash("capturedhash"), ShouldNotBeNil)
+
+		e = snapshot.ApplyChanges(memTestCtx, []string{"/captured"}, nil)
+		So(e, ShouldBeNil)
+		So(snapshot.IsEmpty(), ShouldBeTrue)
+
+	})
+
+}
+
+func TestBoltSnapshotCaptureFailure(t *testing.T) {
+
+	Convey("Test a failed capture keeps the previous snapshot", t, func() {
+
+		snapshot, closer := basicBoltSnapshot()
+		defer closer()
+
+		db := NewMemDB()
+		db.CreateNode(memTestCtx, &tree.Node{
+			Path: "/partial",
+			Type: tree.NodeType_LEAF,
+			Uuid: "partialuuid",
+			Etag: "partialhash",
+		}, true)
+
+		e := snapshot.Capture(memTestCtx, &failingSource{MemDB: db})
+		So(e, ShouldNotBeNil)
+		So(snapshot.FindByUuid("partialuuid"), ShouldBeNil)
+		So(snapshot.FindByUuid("fileuuid"), ShouldNotBeNil)
+
+		var buckets []string
+		snapshot.db.View(func(tx *bolt.Tx) error {
+			return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+				buckets = append(buckets, string(name))
+				return nil
+			})
+		})
+		So(buckets, ShouldHaveLength, 4)
+
+	})
+
+	Convey("Test buckets of an interrupted capture are dropped when opening the snapshot", t, func() {
+
+		folder, e := ioutil.TempDir("", "bolt-snapshot")
+		So(e, ShouldBeNil)
+		defer os.RemoveAll(folder)
+		filename := filepath.Join(folder, "snapshot.db")
+
+		snapshot, e := NewBoltSnapshot(filename)
+		So(e, ShouldBeNil)
+		snapshot.db.Update(func(tx *bolt.Tx) error {
+			for _, name := range snapshotBucketNames("interrupted") {
+				tx.CreateBucket(name)
+			}
+			return nil
+		})
+		snapshot.Close()
+
+		snapshot, e = NewBoltSnapshot(filename)
+		So(e, ShouldBeNil)
+		defer snapshot.Close()
+		snapshot.db.View(func(tx *bolt.Tx) error {
+			So(tx.Bucket([]byte("nodes-interrupted")), ShouldBeNil)
+			So(tx.Bucket([]byte("nodes")), ShouldNotBeNil)
+			return nil
+		})
+
+	})
+
+}
@@ -26,6 +26,8 @@ import (
 
 	"fmt"
 
+	"golang.org/x/text/unicode/norm"
+
 	"github.com/pmker/yux/common/proto/tree"
 	sync "github.com/pmker/yux/data/source/sync/lib/common"
 	"github.com/pmker/yux/data/source/sync/lib/endpoints"
@@ -38,6 +40,8 @@ type SourceDiff struct {
 	MissingLeft  []*tree.Node
 	MissingRight []*tree.Node
 	Context      context.Context
+
+	leftSnapshot *endpoints.MemDB
 }
 
 func (diff *SourceDiff) FilterMissing(source sync.PathSyncSource, target sync.PathSyncTarget, in []*tree.Node, folders bool, nofilter bool) (out map[string]*filters.BatchedEvent) {
@@ -77,41 +81,18 @@ func ComputeSourcesDiff(ctx context.Context, left sync.PathSyncSource, right syn
 	var rightSnapshot, leftSnapshot *endpoints.MemDB
 
 	if right != nil {
-		if statusChan != nil {
-			statusChan <- filters.BatchProcessStatus{StatusString: "[right] Loading snapshot"}
-		}
-		rightSnapshot = endpoints.NewMemDB()
-		err = right.Walk(func(path string, node *tree.Node, err error) {
-			if sync.IsIgnoredFile(path) || len(path) == 0 {
-				return
-			}
-			rightSnapshot.CreateNode(ctx, node, true)
-		})
+		rightSnapshot, err = walkToSnapshot(ctx, right, "right", statusChan)
 		if err != nil {
 			return nil, err
 		}
-		if statusChan != nil {
-			statusChan <- filters.BatchProcessStatus{StatusString: "[right] Snapshot loaded - " + rightSnapshot.Stats()}
-		}
 	}
 
 	if left != nil {
-		leftSnapshot = endpoints.NewMemDB()
-		if statusChan != nil {
-			statusChan <- filters.BatchProcessStatus{StatusString: "[left] Loading snapshot"}
-		}
-		err = left.Walk(func(path string, node *tree.Node, err error) {
-			if sync.IsIgnoredFile(path) || len(path) == 0 {
-				return
-			}
-			leftSnapshot.CreateNode(ctx, node, true)
-		})
+		leftSnapshot, err = walkToSnapshot(ctx, left, "left", statusChan)
 		if err != nil {
 			return nil, err
 		}
-		if statusChan != nil {
-			statusChan <- filters.BatchProcessStatus{StatusString: "[left] Snapshot loaded - " + leftSnapshot.Stats()}
-		}
+		diff.leftSnapshot = leftSnapshot
 	}
 
 	//	log.Logger(ctx).Info("Snapshots", zap.Any("left", leftSnapshot), zap.Any("right", rightSnapshot))
@@ -174,6 +155,61 @@ func ComputeSourcesDiff(ctx context.Context, left sync.PathSyncSource, right syn
 	return diff, nil
 }
 
+// ComputeSnapshotDiff compares the left endpoint with a persisted snapshot of the right endpoint, instead of walking
+// the right endpoint itself. Nodes are looked up one by one in the snapshot, so that no in-memory copy is required.
+// The resulting diff targets the right endpoint.
+func ComputeSnapshotDiff(ctx context.Context, left sync.PathSyncSource, right sync.PathSyncSource, snapshot *endpoints.BoltSnapshot, statusChan chan filters.BatchProcessStatus) (diff *SourceDiff, err error) {
+
+	diff = &SourceDiff{
+		Left:    left,
+		Right:   right,
+		Context: ctx,
+	}
+
+	if statusChan != nil {
+		statusChan <- filters.BatchProcessStatus{StatusString: "[left] Comparing with persisted snapshot"}
+	}
+	seen := make(map[string]bool)
+	err = left.Walk(func(path string, node *tree.Node, err error) {
+		if sync.IsIgnoredFile(path) || len(path) == 0 || path == sync.InternalPathSeparator {
+			return
+		}
+		seen[norm.NFC.String(node.Path)] = true
+		otherNode, e := snapshot.LoadNode(ctx, node.Path)
+		if e != nil || otherNode.IsLeaf() != node.IsLeaf() {
+			diff.MissingRight = append(diff.MissingRight, node)
+		} else if node.IsLeaf() && node.Etag != otherNode.Etag || !node.IsLeaf() && node.Uuid != otherNode.Uuid {
+			diff.MissingRight = append(diff.MissingRight, node)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = snapshot.Walk(func(path string, node *tree.Node, err error) {
+		if len(path) == 0 || path == sync.InternalPathSeparator {
+			return
+		}
+		if !seen[norm.NFC.String(node.Path)] {
+			diff.MissingLeft = append(diff.MissingLeft, node)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if statusChan != nil {
+		statusChan <- filters.BatchProcessStatus{StatusString: fmt.Sprintf("Diff contents: missing left %v - missing right %v", len(diff.MissingLeft), len(diff.MissingRight))}
+	}
+
+	return diff, nil
+}
+
+// LeftSnapshot returns the in-memory snapshot of the left endpoint that was loaded to compute the diff, if any
+func (diff *SourceDiff) LeftSnapshot() *endpoints.MemDB {
+	return diff.leftSnapshot
+}
+
 func (diff *SourceDiff) String() string {
 	output := ""
 	output += "\n MissingLeft : "
@@ -21,6 +21,9 @@
 package proc
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/pmker/yux/common/proto/tree"
@@ -129,3 +132,32 @@ func TestComputeSourcesDiff(t *testing.T) {
 	})
 
 }
+
+func TestComputeSnapshotDiff(t *testing.T) {
+
+	Convey("Test diff against a persisted snapshot", t, func() {
+
+		folder, e := ioutil.TempDir("", "snapshot-diff")
+		So(e, ShouldBeNil)
+		defer os.RemoveAll(folder)
+		snapshot, e := endpoints.NewBoltSnapshot(filepath.Join(folder, "snapshot.db"))
+		So(e, ShouldBeNil)
+		defer snapshot.Close()
+
+		left := endpoints.NewMemDB()
+		left.CreateNode(mergerTestCtx, &tree.Node{Path: "/same", Type: tree.NodeType_LEAF, Etag: "same"}, true)
+		left.CreateNode(mergerTestCtx, &tree.Node{Path: "/modified", Type: tree.NodeType_LEAF, Etag: "new"}, true)
+		left.CreateNode(mergerTestCtx, &tree.Node{Path: "/created", Type: tree.NodeType_LEAF, Etag: "created"}, true)
+		snapshot.CreateNode(mergerTestCtx, &tree.Node{Path: "/same", Type: tree.NodeType_LEAF, Etag: "same"}, true)
+		snapshot.CreateNode(mergerTestCtx, &tree.Node{Path: "/modified", Type: tree.NodeType_LEAF, Etag: "old"}, true)
+		snapshot.CreateNode(mergerTestCtx, &tree.Node{Path: "/deleted", Type: tree.NodeType_LEAF, Etag: "deleted"}, true)
+
+		diff, e := ComputeSnapshotDiff(mergerTestCtx, left, endpoints.NewMemDB(), snapshot, nil)
+		So(e, ShouldBeNil)
+		So(diff.MissingRight, ShouldHaveLength, 2)
+		So(diff.MissingLeft, ShouldHaveLength, 1)
+		So(diff.MissingLeft[0].Path, ShouldEqual, "/deleted")
+
+	})
+
+}
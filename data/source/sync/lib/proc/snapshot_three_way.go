@@ -0,0 +1,448 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+package proc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pmker/yux/common/proto/tree"
+	sync "github.com/pmker/yux/data/source/sync/lib/common"
+	"github.com/pmker/yux/data/source/sync/lib/endpoints"
+	"github.com/pmker/yux/data/source/sync/lib/filters"
+)
+
+// ChangeType describes how a node evolved on one endpoint since the base snapshot
+type ChangeType int
+
+const (
+	ChangeCreate ChangeType = iota
+	ChangeModify
+	ChangeMove
+	ChangeDelete
+)
+
+// ConflictType describes a change detected on both endpoints that cannot be merged automatically
+type ConflictType string
+
+const (
+	// Both sides modified the content of the same node
+	ConflictModifyModify ConflictType = "modify/modify"
+	// One side modified or moved a node that was deleted on the other side
+	ConflictModifyDelete ConflictType = "modify/delete"
+	// Both sides moved the same node to different locations
+	ConflictMoveMove ConflictType = "move/move"
+)
+
+// ConflictPolicy tells how conflicts are resolved
+type ConflictPolicy string
+
+const (
+	// Keep both versions: the right one is renamed as a conflict copy, modified nodes win over deleted ones.
+	// This is the default policy.
+	ConflictKeepBoth ConflictPolicy = "keep-both"
+	// Left version always wins
+	ConflictPreferLeft ConflictPolicy = "prefer-left"
+	// Right version always wins
+	ConflictPreferRight ConflictPolicy = "prefer-right"
+)
+
+// NodeChange is a single change detected on an endpoint by comparing it to the base snapshot
+type NodeChange struct {
+	Type ChangeType
+	// Node as found in the base snapshot, nil for creates
+	Base *tree.Node
+	// Node as currently found on the endpoint, nil for deletes
+	Node *tree.Node
+}
+
+// EndpointChanges lists all changes detected on one endpoint since the base snapshot
+type EndpointChanges struct {
+	// Modifications, moves and deletes, keyed by their path in the base snapshot
+	Updates map[string]*NodeChange
+	// New nodes, keyed by their current path
+	Creates map[string]*NodeChange
+
+	index *snapshotIndex
+	moves []folderMove
+}
+
+// Count returns the total number of changes
+func (e *EndpointChanges) Count() int {
+	return len(e.Updates) + len(e.Creates)
+}
+
+// Conflict is a change detected on both sides, along with the policy that was applied to resolve it
+type Conflict struct {
+	Type       ConflictType
+	Path       string
+	Left       *NodeChange
+	Right      *NodeChange
+	Resolution ConflictPolicy
+}
+
+// ThreeWayDiff compares two endpoints with their last known common state (the base snapshot)
+type ThreeWayDiff struct {
+	Left         sync.PathSyncSource
+	Right        sync.PathSyncSource
+	LeftChanges  *EndpointChanges
+	RightChanges *EndpointChanges
+	Conflicts    []*Conflict
+	Context      context.Context
+}
+
+type folderMove struct {
+	from string
+	to   string
+}
+
+type snapshotIndex struct {
+	nodes  []*tree.Node
+	byPath map[string]*tree.Node
+	byUuid map[string]*tree.Node
+	byEtag map[string][]*tree.Node
+}
+
+// ComputeThreeWayDiff walks both endpoints and compares each of them to the base snapshot, usually
+// the persisted endpoints.BoltSnapshot. A nil base is considered empty: all nodes then appear as
+// created on both sides.
+func ComputeThreeWayDiff(ctx context.Context, left sync.PathSyncSource, right sync.PathSyncSource, base sync.PathSyncSource, statusChan chan filters.BatchProcessStatus) (diff *ThreeWayDiff, err error) {
+
+	if left == nil || right == nil {
+		return nil, errors.New("Three-way diff requires both a left and a right endpoint")
+	}
+	leftSnapshot, err := walkToSnapshot(ctx, left, "left", statusChan)
+	if err != nil {
+		return nil, err
+	}
+	rightSnapshot, err := walkToSnapshot(ctx, right, "right", statusChan)
+	if err != nil {
+		return nil, err
+	}
+
+	if statusChan != nil {
+		statusChan <- filters.BatchProcessStatus{StatusString: "Now computing three-way diff against base snapshot"}
+	}
+
+	var baseSnapshot *endpoints.MemDB
+	if base != nil {
+		if baseSnapshot, err = walkToSnapshot(ctx, base, "base", statusChan); err != nil {
+			return nil, err
+		}
+	}
+	baseIndex := newSnapshotIndex(baseSnapshot)
+	diff = &ThreeWayDiff{
+		Left:         left,
+		Right:        right,
+		LeftChanges:  computeChanges(baseIndex, newSnapshotIndex(leftSnapshot)),
+		RightChanges: computeChanges(baseIndex, newSnapshotIndex(rightSnapshot)),
+		Context:      ctx,
+	}
+
+	if statusChan != nil {
+		statusChan <- filters.BatchProcessStatus{StatusString: fmt.Sprintf("Diff contents: %v changes on left - %v changes on right", diff.LeftChanges.Count(), diff.RightChanges.Count())}
+	}
+
+	return diff, nil
+}
+
+// CaptureCommonSnapshot walks both endpoints and keeps only the nodes that are identical on both sides.
+// The result is meant to be persisted and used as the base of the next three-way diff.
+func CaptureCommonSnapshot(ctx context.Context, left sync.PathSyncSource, right sync.PathSyncSource, statusChan chan filters.BatchProcessStatus) (*endpoints.MemDB, error) {
+
+	leftSnapshot, err := walkToSnapshot(ctx, left, "left", statusChan)
+	if err != nil {
+		return nil, err
+	}
+	rightSnapshot, err := walkToSnapshot(ctx, right, "right", statusChan)
+	if err != nil {
+		return nil, err
+	}
+	rightIndex := newSnapshotIndex(rightSnapshot)
+	snapshot := endpoints.NewMemDB()
+	for _, node := range newSnapshotIndex(leftSnapshot).nodes {
+		other, ok := rightIndex.byPath[node.Path]
+		if !ok || other.IsLeaf() != node.IsLeaf() || node.IsLeaf() && node.Etag != other.Etag {
+			continue
+		}
+		snapshot.CreateNode(ctx, node, true)
+	}
+	return snapshot, nil
+}
+
+func (diff *ThreeWayDiff) String() string {
+	output := ""
+	for _, side := range []struct {
+		label   string
+		changes *EndpointChanges
+	}{{"Left", diff.LeftChanges}, {"Right", diff.RightChanges}} {
+		output += "\n " + side.label + " : "
+		for _, k := range sortedChangeKeys(side.changes.Updates) {
+			output += "\n " + changeLabel(side.changes.Updates[k].Type) + " " + k
+		}
+		for _, k := range sortedChangeKeys(side.changes.Creates) {
+			output += "\n create " + k
+		}
+	}
+	output += "\n Conflicts : "
+	for _, c := range diff.Conflicts {
+		output += "\n " + string(c.Type) + " " + c.Path + " (" + string(c.Resolution) + ")"
+	}
+	return output
+}
+
+// ToBidirectionalBatches resolves changes and conflicts with the given policy. It returns two bidirectional
+// batches that must be processed in this order: the first one only contains moves, so that both endpoints
+// share the same layout before contents are transferred and deletes are applied by the second one.
+// As for ToBidirectionalBatch, the Left batches carry events from left to right. Conflicts are stored
+// in diff.Conflicts.
+func (diff *ThreeWayDiff) ToBidirectionalBatches(leftTarget sync.PathSyncTarget, rightTarget sync.PathSyncTarget, policy ConflictPolicy) (moves *filters.BidirectionalBatch, contents *filters.BidirectionalBatch, err error) {
+
+	if leftTarget == nil || rightTarget == nil {
+		return nil, nil, errors.New("Error while extracting bidirectional batches. Either left or right is not a sync target")
+	}
+	if policy == "" {
+		policy = ConflictKeepBoth
+	}
+	diff.Conflicts = nil
+
+	left := &resolverSide{name: "left", changes: diff.LeftChanges, source: diff.Left, target: leftTarget, moves: filters.NewBatch(), contents: filters.NewBatch()}
+	right := &resolverSide{name: "right", changes: diff.RightChanges, source: diff.Right, target: rightTarget, moves: filters.NewBatch(), contents: filters.NewBatch()}
+	left.other = right
+	right.other = left
+
+	r := &threeWayResolver{
+		diff:    diff,
+		policy:  policy,
+		left:    left,
+		right:   right,
+		handled: make(map[*NodeChange]bool),
+		rescued: map[*resolverSide]map[string]bool{left: {}, right: {}},
+	}
+	r.resolveFolderMoves()
+	r.resolveUpdates()
+	r.resolveCreates()
+	r.flushDeletes()
+
+	moves = &filters.BidirectionalBatch{Left: left.moves, Right: right.moves}
+	contents = &filters.BidirectionalBatch{Left: left.contents, Right: right.contents}
+	return moves, contents, nil
+}
+
+// ConflictCopyPath computes the path used to keep a conflicting version next to the original one
+func ConflictCopyPath(nodePath string, label string) string {
+	dir, base := path.Split(nodePath)
+	ext := path.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+	if name == "" {
+		name, ext = ext, ""
+	}
+	return dir + name + "-conflict-" + label + ext
+}
+
+/*************************/
+/* Changes detection     */
+/*************************/
+
+func walkToSnapshot(ctx context.Context, source sync.PathSyncSource, label string, statusChan chan filters.BatchProcessStatus) (*endpoints.MemDB, error) {
+
+	if statusChan != nil {
+		statusChan <- filters.BatchProcessStatus{StatusString: "[" + label + "] Loading snapshot"}
+	}
+	snapshot := endpoints.NewMemDB()
+	err := source.Walk(func(path string, node *tree.Node, err error) {
+		if sync.IsIgnoredFile(path) || len(path) == 0 {
+			return
+		}
+		snapshot.CreateNode(ctx, node, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if statusChan != nil {
+		statusChan <- filters.BatchProcessStatus{StatusString: "[" + label + "] Snapshot loaded - " + snapshot.Stats()}
+	}
+	return snapshot, nil
+}
+
+func newSnapshotIndex(db *endpoints.MemDB) *snapshotIndex {
+
+	idx := &snapshotIndex{
+		byPath: make(map[string]*tree.Node),
+		byUuid: make(map[string]*tree.Node),
+		byEtag: make(map[string][]*tree.Node),
+	}
+	if db == nil {
+		return idx
+	}
+	for _, node := range db.Nodes {
+		if node.Path == "" || node.Path == sync.InternalPathSeparator {
+			continue
+		}
+		idx.nodes = append(idx.nodes, node)
+		idx.byPath[node.Path] = node
+		if node.Uuid != "" {
+			idx.byUuid[node.Uuid] = node
+		}
+		if node.IsLeaf() && node.Etag != "" {
+			idx.byEtag[node.Etag] = append(idx.byEtag[node.Etag], node)
+		}
+	}
+	// Parents are always listed before their children
+	sort.Slice(idx.nodes, func(i, j int) bool {
+		return idx.nodes[i].Path < idx.nodes[j].Path
+	})
+	return idx
+}
+
+// computeChanges compares the current state of an endpoint to the base snapshot. Folders are moved
+// when their Uuid is found at another path, files when their Uuid or their Etag is found at a path
+// unknown to the base. Children of a moved folder are compared at their new location.
+func computeChanges(base *snapshotIndex, current *snapshotIndex) *EndpointChanges {
+
+	changes := &EndpointChanges{
+		Updates: make(map[string]*NodeChange),
+		Creates: make(map[string]*NodeChange),
+		index:   current,
+	}
+	matched := make(map[string]bool)
+
+	for _, b := range base.nodes {
+		if b.IsLeaf() {
+			continue
+		}
+		expected := translatePath(b.Path, changes.moves)
+		if c, ok := current.byPath[expected]; ok && !c.IsLeaf() {
+			matched[expected] = true
+			continue
+		}
+		if b.Uuid == "" {
+			continue
+		}
+		if c, ok := current.byUuid[b.Uuid]; ok && !c.IsLeaf() && !matched[c.Path] {
+			if _, inBase := base.byPath[c.Path]; !inBase {
+				matched[c.Path] = true
+				changes.moves = append(changes.moves, folderMove{from: b.Path, to: c.Path})
+				changes.Updates[b.Path] = &NodeChange{Type: ChangeMove, Base: b, Node: c}
+			}
+		}
+	}
+
+	for _, b := range base.nodes {
+		if _, moved := changes.Updates[b.Path]; moved {
+			continue
+		}
+		expected := translatePath(b.Path, changes.moves)
+		if !b.IsLeaf() && matched[expected] {
+			continue
+		}
+		if c, ok := current.byPath[expected]; ok && !matched[expected] {
+			matched[expected] = true
+			if b.IsLeaf() != c.IsLeaf() || b.IsLeaf() && b.Etag != c.Etag {
+				changes.Updates[b.Path] = &NodeChange{Type: ChangeModify, Base: b, Node: c}
+			}
+			continue
+		}
+		if b.IsLeaf() {
+			if c := findMovedLeaf(b, base, current, matched); c != nil {
+				matched[c.Path] = true
+				changes.Updates[b.Path] = &NodeChange{Type: ChangeMove, Base: b, Node: c}
+				continue
+			}
+		}
+		changes.Updates[b.Path] = &NodeChange{Type: ChangeDelete, Base: b}
+	}
+
+	for _, c := range current.nodes {
+		if !matched[c.Path] {
+			changes.Creates[c.Path] = &NodeChange{Type: ChangeCreate, Node: c}
+		}
+	}
+
+	return changes
+}
+
+func findMovedLeaf(b *tree.Node, base *snapshotIndex, current *snapshotIndex, matched map[string]bool) *tree.Node {
+
+	candidate := func(c *tree.Node) bool {
+		if c == nil || !c.IsLeaf() || matched[c.Path] {
+			return false
+		}
+		_, inBase := base.byPath[c.Path]
+		return !inBase
+	}
+	if b.Uuid != "" {
+		if c := current.byUuid[b.Uuid]; candidate(c) {
+			return c
+		}
+	}
+	if b.Etag != "" {
+		for _, c := range current.byEtag[b.Etag] {
+			if candidate(c) {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// translatePath applies the deepest matching folder move to a path
+func translatePath(p string, moves []folderMove) string {
+	var found *folderMove
+	for i, m := range moves {
+		if isSelfOrChild(p, m.from) && (found == nil || len(m.from) > len(found.from)) {
+			found = &moves[i]
+		}
+	}
+	if found == nil {
+		return p
+	}
+	return found.to + strings.TrimPrefix(p, found.from)
+}
+
+func isSelfOrChild(p string, parent string) bool {
+	return p == parent || strings.HasPrefix(p, strings.TrimSuffix(parent, sync.InternalPathSeparator)+sync.InternalPathSeparator)
+}
+
+func sortedChangeKeys(changes map[string]*NodeChange) []string {
+	var keys []string
+	for k := range changes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func changeLabel(t ChangeType) string {
+	switch t {
+	case ChangeCreate:
+		return "create"
+	case ChangeModify:
+		return "modify"
+	case ChangeMove:
+		return "move"
+	default:
+		return "delete"
+	}
+}
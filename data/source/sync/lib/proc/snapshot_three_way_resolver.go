@@ -0,0 +1,514 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+package proc
+
+import (
+	"path"
+
+	"github.com/pmker/yux/common/proto/tree"
+	sync "github.com/pmker/yux/data/source/sync/lib/common"
+	"github.com/pmker/yux/data/source/sync/lib/filters"
+)
+
+// resolverSide gathers the changes of one endpoint and the batches carrying them to the other one
+type resolverSide struct {
+	name     string
+	changes  *EndpointChanges
+	source   sync.PathSyncSource
+	target   sync.PathSyncTarget
+	moves    *filters.Batch
+	contents *filters.Batch
+	other    *resolverSide
+}
+
+type threeWayResolver struct {
+	diff   *ThreeWayDiff
+	policy ConflictPolicy
+	left   *resolverSide
+	right  *resolverSide
+	// Folder moves applied on both sides at the end of the process
+	effective []folderMove
+	handled   map[*NodeChange]bool
+	// Deletes that must be reverted, per side. Value is true if the whole subtree is concerned.
+	rescued map[*resolverSide]map[string]bool
+	deletes []pendingDelete
+}
+
+type pendingDelete struct {
+	side   *resolverSide
+	change *NodeChange
+}
+
+type pendingFolderMove struct {
+	from   *resolverSide
+	source string
+	change *NodeChange
+}
+
+// resolveFolderMoves must run first, as all other changes are located
+// using the final layout of the folders.
+func (r *threeWayResolver) resolveFolderMoves() {
+
+	var pending []pendingFolderMove
+	for _, k := range r.updateKeys() {
+		l, rc := r.left.changes.Updates[k], r.right.changes.Updates[k]
+		lMove, rMove := isFolderMove(l), isFolderMove(rc)
+		if !lMove && !rMove {
+			continue
+		}
+		r.markHandled(l, rc)
+
+		if lMove && rMove {
+			if l.Node.Path == rc.Node.Path {
+				r.effective = append(r.effective, folderMove{from: k, to: l.Node.Path})
+				continue
+			}
+			// Keeping both versions of a folder would duplicate its whole content: left wins
+			winner, loser, resolution := r.left, r.right, ConflictPreferLeft
+			if r.policy == ConflictPreferRight {
+				winner, loser, resolution = r.right, r.left, ConflictPreferRight
+			}
+			r.addConflict(ConflictMoveMove, k, l, rc, resolution)
+			wc, lc := r.changeOf(winner, k), r.changeOf(loser, k)
+			r.effective = append(r.effective, folderMove{from: k, to: wc.Node.Path}, folderMove{from: lc.Node.Path, to: wc.Node.Path})
+			pending = append(pending, pendingFolderMove{from: winner, source: lc.Node.Path, change: wc})
+			continue
+		}
+
+		mover, other := r.left, r.right
+		if rMove {
+			mover, other = r.right, r.left
+		}
+		mc, oc := r.changeOf(mover, k), r.changeOf(other, k)
+		if oc == nil {
+			r.effective = append(r.effective, folderMove{from: k, to: mc.Node.Path})
+			pending = append(pending, pendingFolderMove{from: mover, source: translatePath(k, other.changes.moves), change: mc})
+			continue
+		}
+
+		// Folder moved on one side, deleted (or replaced by a file) on the other side
+		conflictType := ConflictModifyDelete
+		if oc.Type != ChangeDelete {
+			conflictType = ConflictModifyModify
+		}
+		r.addConflict(conflictType, k, l, rc, r.policy)
+		if r.prefers(other) {
+			r.deleteOn(other, mc.Node, mc.Node.Path)
+			if oc.Type != ChangeDelete {
+				r.pushContent(other, oc.Node, k)
+			}
+			for _, side := range []*resolverSide{r.left, r.right} {
+				for p, c := range side.changes.Updates {
+					if isSelfOrChild(p, k) {
+						r.handled[c] = true
+					}
+				}
+			}
+			for p, c := range mover.changes.Creates {
+				if isSelfOrChild(p, mc.Node.Path) {
+					r.handled[c] = true
+				}
+			}
+		} else {
+			r.effective = append(r.effective, folderMove{from: k, to: mc.Node.Path})
+			r.rescued[other][k] = true
+			r.pushContent(mover, mc.Node, mc.Node.Path)
+		}
+	}
+
+	for _, p := range pending {
+		r.moveOn(p.from, p.source, p.change.Node.Path, false)
+	}
+}
+
+func (r *threeWayResolver) resolveUpdates() {
+
+	for _, k := range r.updateKeys() {
+		l, rc := r.unhandled(r.left.changes.Updates[k]), r.unhandled(r.right.changes.Updates[k])
+		switch {
+		case l == nil && rc == nil:
+			continue
+		case rc == nil:
+			r.resolveSingle(r.left, l)
+		case l == nil:
+			r.resolveSingle(r.right, rc)
+		case l.Type == ChangeDelete && rc.Type == ChangeDelete:
+			continue
+		case l.Type == ChangeDelete:
+			r.resolveModifyDelete(k, r.left, r.right)
+		case rc.Type == ChangeDelete:
+			r.resolveModifyDelete(k, r.right, r.left)
+		default:
+			r.resolveBoth(k, l, rc)
+		}
+	}
+}
+
+func (r *threeWayResolver) resolveCreates() {
+
+	for _, k := range unionKeys(r.left.changes.Creates, r.right.changes.Creates) {
+		l, rc := r.unhandled(r.left.changes.Creates[k]), r.unhandled(r.right.changes.Creates[k])
+		switch {
+		case l == nil && rc == nil:
+			continue
+		case rc == nil:
+			r.resolveSingle(r.left, l)
+		case l == nil:
+			r.resolveSingle(r.right, rc)
+		default:
+			r.resolveBoth(k, l, rc)
+		}
+	}
+}
+
+// resolveSingle handles a change detected on one side only
+func (r *threeWayResolver) resolveSingle(side *resolverSide, c *NodeChange) {
+
+	if c.Type == ChangeDelete {
+		r.deletes = append(r.deletes, pendingDelete{side: side, change: c})
+		return
+	}
+	dest := r.dest(c)
+	if deleted := r.deletedAncestor(side.other, dest); deleted != nil {
+		// Change happened inside a folder that was deleted on the other side
+		l, rc := c, deleted
+		if side == r.right {
+			l, rc = deleted, c
+		}
+		r.addConflict(ConflictModifyDelete, dest, l, rc, r.policy)
+		if r.prefers(side.other) {
+			if c.Type == ChangeMove {
+				r.deleteOn(side, c.Base, r.location(side.other, c.Base.Path))
+			}
+			return
+		}
+		r.rescueAncestors(side.other, dest)
+		r.applyChange(side, c, true)
+		return
+	}
+	r.applyChange(side, c, false)
+}
+
+// resolveModifyDelete handles a node deleted on one side and modified or moved on the other side
+func (r *threeWayResolver) resolveModifyDelete(k string, deleter *resolverSide, modifier *resolverSide) {
+
+	mc := r.changeOf(modifier, k)
+	if deleter == r.left {
+		r.addConflict(ConflictModifyDelete, k, r.changeOf(deleter, k), mc, r.policy)
+	} else {
+		r.addConflict(ConflictModifyDelete, k, mc, r.changeOf(deleter, k), r.policy)
+	}
+	if r.prefers(deleter) {
+		r.deleteOn(deleter, mc.Node, r.dest(mc))
+		return
+	}
+	r.rescueAncestors(deleter, r.dest(mc))
+	r.applyChange(modifier, mc, true)
+}
+
+// resolveBoth handles a node modified, moved or created on both sides
+func (r *threeWayResolver) resolveBoth(k string, l *NodeChange, rc *NodeChange) {
+
+	lDest, rDest := r.dest(l), r.dest(rc)
+	if lDest == rDest && sameContent(l.Node, rc.Node) {
+		return
+	}
+	lContent, rContent := r.contentChanged(l), r.contentChanged(rc)
+
+	// One side moved the node while the other one modified it: both changes are applied
+	if l.Type == ChangeMove && !lContent && rc.Type == ChangeModify {
+		r.moveOn(r.left, r.location(r.right, k), lDest, l.Node.IsLeaf())
+		r.pushContent(r.right, rc.Node, lDest)
+		return
+	}
+	if rc.Type == ChangeMove && !rContent && l.Type == ChangeModify {
+		r.moveOn(r.right, r.location(r.left, k), rDest, rc.Node.IsLeaf())
+		r.pushContent(r.left, l.Node, rDest)
+		return
+	}
+
+	conflictType := ConflictModifyModify
+	if !lContent && !rContent {
+		conflictType = ConflictMoveMove
+	}
+	resolution := r.policy
+	if l.Node.IsLeaf() != rc.Node.IsLeaf() && lDest == rDest {
+		// A file cannot simply overwrite a folder
+		resolution = ConflictKeepBoth
+	}
+	r.addConflict(conflictType, k, l, rc, resolution)
+
+	switch resolution {
+	case ConflictPreferLeft:
+		r.overwrite(r.left, l, lDest, rc, rDest)
+	case ConflictPreferRight:
+		r.overwrite(r.right, rc, rDest, l, lDest)
+	default:
+		r.keepBoth(l, lDest, rc, rDest)
+	}
+}
+
+// overwrite replaces the loser version by the winner one on the loser side
+func (r *threeWayResolver) overwrite(winner *resolverSide, wc *NodeChange, wDest string, lc *NodeChange, lDest string) {
+
+	if lDest != wDest {
+		r.moveOn(winner, lDest, wDest, wc.Node.IsLeaf())
+	}
+	if !sameContent(wc.Node, lc.Node) {
+		r.pushContent(winner, wc.Node, wDest)
+	}
+}
+
+// keepBoth copies each version on the other side, renaming one of them if they share the same path
+func (r *threeWayResolver) keepBoth(l *NodeChange, lDest string, rc *NodeChange, rDest string) {
+
+	if lDest != rDest {
+		r.pushContent(r.left, l.Node, lDest)
+		r.pushContent(r.right, rc.Node, rDest)
+		return
+	}
+	if rc.Node.IsLeaf() {
+		copyPath := ConflictCopyPath(rDest, r.right.name)
+		r.moveOn(r.left, rDest, copyPath, true)
+		r.pushContent(r.left, l.Node, lDest)
+		r.pushContent(r.right, rc.Node, copyPath)
+	} else {
+		copyPath := ConflictCopyPath(lDest, r.left.name)
+		r.moveOn(r.right, lDest, copyPath, true)
+		r.pushContent(r.right, rc.Node, rDest)
+		r.pushContent(r.left, l.Node, copyPath)
+	}
+}
+
+// applyChange propagates a change to the other side. If asContent is set, moves are
+// replaced by a copy of the node, as its original location does not exist anymore.
+func (r *threeWayResolver) applyChange(side *resolverSide, c *NodeChange, asContent bool) {
+
+	dest := r.dest(c)
+	switch c.Type {
+	case ChangeCreate, ChangeModify:
+		r.pushContent(side, c.Node, dest)
+	case ChangeMove:
+		if asContent {
+			r.pushContent(side, c.Node, dest)
+			return
+		}
+		r.moveOn(side, r.location(side.other, c.Base.Path), dest, c.Node.IsLeaf())
+		if r.contentChanged(c) {
+			r.pushContent(side, c.Node, dest)
+		}
+	}
+}
+
+// flushDeletes propagates deletes once all conflicts are known, skipping children of deleted folders.
+// Rescued folders are recreated on the side that deleted them instead.
+func (r *threeWayResolver) flushDeletes() {
+
+	deletedFolders := make(map[*resolverSide][]string)
+	for _, d := range r.deletes {
+		side, p := d.side, d.change.Base.Path
+		if r.isRescued(side, p) {
+			other := side.other
+			if node, ok := other.changes.index.byPath[translatePath(p, other.changes.moves)]; ok {
+				r.pushContent(other, node, r.final(p))
+			}
+			continue
+		}
+		parentDeleted := false
+		for _, folder := range deletedFolders[side] {
+			if isSelfOrChild(p, folder) {
+				parentDeleted = true
+				break
+			}
+		}
+		if parentDeleted {
+			continue
+		}
+		r.deleteOn(side, d.change.Base, r.location(side.other, p))
+		if !d.change.Base.IsLeaf() {
+			deletedFolders[side] = append(deletedFolders[side], p)
+		}
+	}
+}
+
+/*************************/
+/* Batches               */
+/*************************/
+
+// pushContent copies a node found on side at nodePath to the other side
+func (r *threeWayResolver) pushContent(side *resolverSide, node *tree.Node, nodePath string) {
+	n := node.Clone()
+	n.Path = nodePath
+	event := r.event(side, n, nodePath, sync.EventCreate)
+	if n.IsLeaf() {
+		side.contents.CreateFiles[nodePath] = event
+	} else {
+		side.contents.CreateFolders[nodePath] = event
+	}
+}
+
+// moveOn moves a node on the other side
+func (r *threeWayResolver) moveOn(side *resolverSide, from string, to string, leaf bool) {
+	event := r.event(side, &tree.Node{Path: from}, to, sync.EventRename)
+	if leaf {
+		side.moves.FileMoves[from] = event
+	} else {
+		side.moves.FolderMoves[from] = event
+	}
+}
+
+// deleteOn deletes a node on the other side
+func (r *threeWayResolver) deleteOn(side *resolverSide, node *tree.Node, nodePath string) {
+	n := &tree.Node{Path: nodePath, Type: node.Type, Uuid: node.Uuid, Etag: node.Etag}
+	side.contents.Deletes[nodePath] = r.event(side, n, nodePath, sync.EventRemove)
+}
+
+func (r *threeWayResolver) event(side *resolverSide, node *tree.Node, eventPath string, eventType sync.EventType) *filters.BatchedEvent {
+	eventInfo := sync.NodeToEventInfo(r.diff.Context, eventPath, node, eventType)
+	eventInfo.Size = node.Size
+	return &filters.BatchedEvent{
+		Key:       eventPath,
+		Node:      node,
+		EventInfo: eventInfo,
+		Source:    side.source,
+		Target:    side.other.target,
+	}
+}
+
+/*************************/
+/* Helpers               */
+/*************************/
+
+func (r *threeWayResolver) addConflict(conflictType ConflictType, p string, l *NodeChange, rc *NodeChange, resolution ConflictPolicy) {
+	r.diff.Conflicts = append(r.diff.Conflicts, &Conflict{
+		Type:       conflictType,
+		Path:       p,
+		Left:       l,
+		Right:      rc,
+		Resolution: resolution,
+	})
+}
+
+// prefers tells if the given side wins a conflict where a deletion is involved.
+// With ConflictKeepBoth, the modified version is always kept.
+func (r *threeWayResolver) prefers(side *resolverSide) bool {
+	return r.policy == ConflictPreferLeft && side == r.left || r.policy == ConflictPreferRight && side == r.right
+}
+
+// final computes the path of a node once all folder moves are applied
+func (r *threeWayResolver) final(p string) string {
+	return translatePath(p, r.effective)
+}
+
+// location computes the path of a node of the base snapshot on the given side, once all folder moves are applied
+func (r *threeWayResolver) location(side *resolverSide, basePath string) string {
+	return r.final(translatePath(basePath, side.changes.moves))
+}
+
+// dest computes the final path of a changed node
+func (r *threeWayResolver) dest(c *NodeChange) string {
+	if c.Type == ChangeModify {
+		return r.final(c.Base.Path)
+	}
+	return r.final(c.Node.Path)
+}
+
+func (r *threeWayResolver) contentChanged(c *NodeChange) bool {
+	switch c.Type {
+	case ChangeCreate, ChangeModify:
+		return true
+	case ChangeMove:
+		return c.Node.IsLeaf() && c.Node.Etag != c.Base.Etag
+	}
+	return false
+}
+
+func (r *threeWayResolver) deletedAncestor(side *resolverSide, p string) *NodeChange {
+	for dir := path.Dir(p); dir != sync.InternalPathSeparator && dir != "." && dir != ""; dir = path.Dir(dir) {
+		if c, ok := side.changes.Updates[dir]; ok && c.Type == ChangeDelete && !c.Base.IsLeaf() {
+			return c
+		}
+	}
+	return nil
+}
+
+func (r *threeWayResolver) rescueAncestors(side *resolverSide, p string) {
+	for dir := path.Dir(p); dir != sync.InternalPathSeparator && dir != "." && dir != ""; dir = path.Dir(dir) {
+		if c, ok := side.changes.Updates[dir]; ok && c.Type == ChangeDelete && !c.Base.IsLeaf() {
+			if _, ok := r.rescued[side][dir]; !ok {
+				r.rescued[side][dir] = false
+			}
+		}
+	}
+}
+
+func (r *threeWayResolver) isRescued(side *resolverSide, p string) bool {
+	for folder, subtree := range r.rescued[side] {
+		if folder == p || subtree && isSelfOrChild(p, folder) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *threeWayResolver) changeOf(side *resolverSide, k string) *NodeChange {
+	return side.changes.Updates[k]
+}
+
+func (r *threeWayResolver) unhandled(c *NodeChange) *NodeChange {
+	if c == nil || r.handled[c] {
+		return nil
+	}
+	return c
+}
+
+func (r *threeWayResolver) markHandled(changes ...*NodeChange) {
+	for _, c := range changes {
+		if c != nil {
+			r.handled[c] = true
+		}
+	}
+}
+
+func (r *threeWayResolver) updateKeys() []string {
+	return unionKeys(r.left.changes.Updates, r.right.changes.Updates)
+}
+
+func unionKeys(a map[string]*NodeChange, b map[string]*NodeChange) []string {
+	union := make(map[string]*NodeChange, len(a)+len(b))
+	for k, c := range a {
+		union[k] = c
+	}
+	for k, c := range b {
+		union[k] = c
+	}
+	return sortedChangeKeys(union)
+}
+
+func isFolderMove(c *NodeChange) bool {
+	return c != nil && c.Type == ChangeMove && !c.Base.IsLeaf()
+}
+
+func sameContent(a *tree.Node, b *tree.Node) bool {
+	if a.IsLeaf() != b.IsLeaf() {
+		return false
+	}
+	return !a.IsLeaf() || a.Etag != "" && a.Etag == b.Etag
+}
@@ -0,0 +1,333 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+package proc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/data/source/sync/lib/endpoints"
+)
+
+func threeWayLeaf(path string, etag string) *tree.Node {
+	return &tree.Node{Path: path, Type: tree.NodeType_LEAF, Etag: etag}
+}
+
+func threeWayFolder(path string, uuid string) *tree.Node {
+	return &tree.Node{Path: path, Type: tree.NodeType_COLLECTION, Uuid: uuid}
+}
+
+func threeWayDB(nodes ...*tree.Node) *endpoints.MemDB {
+	db := endpoints.NewMemDB()
+	for _, n := range nodes {
+		db.CreateNode(mergerTestCtx, n, true)
+	}
+	return db
+}
+
+func TestComputeThreeWayDiff(t *testing.T) {
+
+	Convey("Test changes detection against base snapshot", t, func() {
+
+		base := threeWayDB(threeWayFolder("/a", "uuid-a"), threeWayLeaf("/a/f1", "h1"), threeWayLeaf("/b", "h2"), threeWayLeaf("/c", "h3"), threeWayLeaf("/d", "h4"))
+		left := threeWayDB(threeWayFolder("/z", "uuid-a"), threeWayLeaf("/z/f1", "h1"), threeWayLeaf("/b", "h2-modified"), threeWayLeaf("/d-renamed", "h4"), threeWayLeaf("/e", "h5"))
+		right := threeWayDB(threeWayFolder("/a", "uuid-a"), threeWayLeaf("/a/f1", "h1"), threeWayLeaf("/b", "h2"), threeWayLeaf("/c", "h3"), threeWayLeaf("/d", "h4"))
+
+		diff, err := ComputeThreeWayDiff(mergerTestCtx, left, right, base, nil)
+		So(err, ShouldBeNil)
+		So(diff.RightChanges.Count(), ShouldEqual, 0)
+
+		changes := diff.LeftChanges
+		So(changes.Updates, ShouldHaveLength, 4)
+		So(changes.Updates["/a"].Type, ShouldEqual, ChangeMove)
+		So(changes.Updates["/a"].Node.Path, ShouldEqual, "/z")
+		So(changes.Updates["/b"].Type, ShouldEqual, ChangeModify)
+		So(changes.Updates["/c"].Type, ShouldEqual, ChangeDelete)
+		So(changes.Updates["/d"].Type, ShouldEqual, ChangeMove)
+		So(changes.Updates["/d"].Node.Path, ShouldEqual, "/d-renamed")
+		So(changes.Creates, ShouldHaveLength, 1)
+		So(changes.Creates["/e"], ShouldNotBeNil)
+
+	})
+
+	Convey("Test without base snapshot", t, func() {
+
+		left := threeWayDB(threeWayLeaf("/same", "h1"), threeWayLeaf("/different", "h2"))
+		right := threeWayDB(threeWayLeaf("/same", "h1"), threeWayLeaf("/different", "h3"))
+
+		diff, err := ComputeThreeWayDiff(mergerTestCtx, left, right, nil, nil)
+		So(err, ShouldBeNil)
+		So(diff.LeftChanges.Creates, ShouldHaveLength, 2)
+		So(diff.RightChanges.Creates, ShouldHaveLength, 2)
+
+		_, contents, err := diff.ToBidirectionalBatches(left, right, ConflictPreferLeft)
+		So(err, ShouldBeNil)
+		So(diff.Conflicts, ShouldHaveLength, 1)
+		So(diff.Conflicts[0].Type, ShouldEqual, ConflictModifyModify)
+		So(diff.Conflicts[0].Path, ShouldEqual, "/different")
+		So(contents.Left.CreateFiles, ShouldHaveLength, 1)
+		So(contents.Left.CreateFiles["/different"], ShouldNotBeNil)
+		So(contents.Right.CreateFiles, ShouldHaveLength, 0)
+
+	})
+
+}
+
+func TestThreeWayBatches(t *testing.T) {
+
+	Convey("Test non-conflicting changes are applied in both directions", t, func() {
+
+		base := threeWayDB(threeWayLeaf("/modified-left", "h1"), threeWayLeaf("/deleted-right", "h2"))
+		left := threeWayDB(threeWayLeaf("/modified-left", "h1-bis"), threeWayLeaf("/deleted-right", "h2"), threeWayLeaf("/created-left", "h3"))
+		right := threeWayDB(threeWayLeaf("/modified-left", "h1"), threeWayFolder("/created-right", "uuid"))
+
+		diff, _ := ComputeThreeWayDiff(mergerTestCtx, left, right, base, nil)
+		moves, contents, err := diff.ToBidirectionalBatches(left, right, ConflictKeepBoth)
+		So(err, ShouldBeNil)
+		So(diff.Conflicts, ShouldHaveLength, 0)
+		So(moves.Left.FileMoves, ShouldHaveLength, 0)
+		So(moves.Right.FileMoves, ShouldHaveLength, 0)
+		So(contents.Left.CreateFiles, ShouldHaveLength, 2)
+		So(contents.Left.CreateFiles["/modified-left"].Node.Etag, ShouldEqual, "h1-bis")
+		So(contents.Left.CreateFiles["/created-left"], ShouldNotBeNil)
+		So(contents.Right.CreateFolders["/created-right"], ShouldNotBeNil)
+		So(contents.Right.Deletes["/deleted-right"], ShouldNotBeNil)
+		So(contents.Right.Deletes["/deleted-right"].Target, ShouldEqual, left)
+
+	})
+
+	Convey("Test both sides modified", t, func() {
+
+		base := threeWayDB(threeWayLeaf("/doc.txt", "h1"))
+		left := threeWayDB(threeWayLeaf("/doc.txt", "h-left"))
+		right := threeWayDB(threeWayLeaf("/doc.txt", "h-right"))
+		diff, _ := ComputeThreeWayDiff(mergerTestCtx, left, right, base, nil)
+
+		Convey("Keep both versions", func() {
+			moves, contents, _ := diff.ToBidirectionalBatches(left, right, ConflictKeepBoth)
+			So(diff.Conflicts, ShouldHaveLength, 1)
+			So(diff.Conflicts[0].Type, ShouldEqual, ConflictModifyModify)
+			So(diff.Conflicts[0].Resolution, ShouldEqual, ConflictKeepBoth)
+			So(moves.Left.FileMoves["/doc.txt"], ShouldNotBeNil)
+			So(moves.Left.FileMoves["/doc.txt"].EventInfo.Path, ShouldEqual, "/doc-conflict-right.txt")
+			So(contents.Left.CreateFiles["/doc.txt"].Node.Etag, ShouldEqual, "h-left")
+			So(contents.Right.CreateFiles["/doc-conflict-right.txt"].Node.Etag, ShouldEqual, "h-right")
+		})
+
+		Convey("Prefer right", func() {
+			moves, contents, _ := diff.ToBidirectionalBatches(left, right, ConflictPreferRight)
+			So(diff.Conflicts, ShouldHaveLength, 1)
+			So(moves.Left.FileMoves, ShouldHaveLength, 0)
+			So(contents.Left.CreateFiles, ShouldHaveLength, 0)
+			So(contents.Right.CreateFiles["/doc.txt"].Node.Etag, ShouldEqual, "h-right")
+		})
+
+	})
+
+	Convey("Test modified on one side, deleted on the other side", t, func() {
+
+		base := threeWayDB(threeWayLeaf("/file", "h1"))
+		left := threeWayDB(threeWayLeaf("/file", "h2"))
+		right := threeWayDB()
+		diff, _ := ComputeThreeWayDiff(mergerTestCtx, left, right, base, nil)
+
+		Convey("Keep both keeps the modified version", func() {
+			_, contents, _ := diff.ToBidirectionalBatches(left, right, ConflictKeepBoth)
+			So(diff.Conflicts, ShouldHaveLength, 1)
+			So(diff.Conflicts[0].Type, ShouldEqual, ConflictModifyDelete)
+			So(contents.Left.CreateFiles["/file"], ShouldNotBeNil)
+			So(contents.Right.Deletes, ShouldHaveLength, 0)
+		})
+
+		Convey("Prefer right deletes the file", func() {
+			_, contents, _ := diff.ToBidirectionalBatches(left, right, ConflictPreferRight)
+			So(contents.Left.CreateFiles, ShouldHaveLength, 0)
+			So(contents.Right.Deletes["/file"], ShouldNotBeNil)
+		})
+
+	})
+
+	Convey("Test moved on both sides", t, func() {
+
+		base := threeWayDB(threeWayLeaf("/file", "h1"))
+		left := threeWayDB(threeWayLeaf("/left-name", "h1"))
+		right := threeWayDB(threeWayLeaf("/right-name", "h1"))
+		diff, _ := ComputeThreeWayDiff(mergerTestCtx, left, right, base, nil)
+
+		Convey("Prefer left moves the right node", func() {
+			moves, contents, _ := diff.ToBidirectionalBatches(left, right, ConflictPreferLeft)
+			So(diff.Conflicts, ShouldHaveLength, 1)
+			So(diff.Conflicts[0].Type, ShouldEqual, ConflictMoveMove)
+			So(moves.Left.FileMoves["/right-name"].EventInfo.Path, ShouldEqual, "/left-name")
+			So(contents.Left.CreateFiles, ShouldHaveLength, 0)
+		})
+
+		Convey("Keep both copies each node", func() {
+			moves, contents, _ := diff.ToBidirectionalBatches(left, right, ConflictKeepBoth)
+			So(moves.Left.FileMoves, ShouldHaveLength, 0)
+			So(contents.Left.CreateFiles["/left-name"], ShouldNotBeNil)
+			So(contents.Right.CreateFiles["/right-name"], ShouldNotBeNil)
+		})
+
+	})
+
+	Convey("Test moved on one side, modified on the other side", t, func() {
+
+		base := threeWayDB(threeWayLeaf("/file", "h1"))
+		left := threeWayDB(threeWayLeaf("/moved", "h1"))
+		right := threeWayDB(threeWayLeaf("/file", "h2"))
+		diff, _ := ComputeThreeWayDiff(mergerTestCtx, left, right, base, nil)
+
+		moves, contents, _ := diff.ToBidirectionalBatches(left, right, ConflictKeepBoth)
+		So(diff.Conflicts, ShouldHaveLength, 0)
+		So(moves.Left.FileMoves["/file"].EventInfo.Path, ShouldEqual, "/moved")
+		So(contents.Right.CreateFiles["/moved"].Node.Etag, ShouldEqual, "h2")
+
+	})
+
+	Convey("Test folder moved on one side, child modified on the other side", t, func() {
+
+		base := threeWayDB(threeWayFolder("/a", "uuid-a"), threeWayLeaf("/a/f", "h1"))
+		left := threeWayDB(threeWayFolder("/z", "uuid-a"), threeWayLeaf("/z/f", "h1"))
+		right := threeWayDB(threeWayFolder("/a", "uuid-a"), threeWayLeaf("/a/f", "h2"))
+		diff, _ := ComputeThreeWayDiff(mergerTestCtx, left, right, base, nil)
+
+		moves, contents, _ := diff.ToBidirectionalBatches(left, right, ConflictKeepBoth)
+		So(diff.Conflicts, ShouldHaveLength, 0)
+		So(moves.Left.FolderMoves["/a"].EventInfo.Path, ShouldEqual, "/z")
+		So(contents.Right.CreateFiles["/z/f"].Node.Etag, ShouldEqual, "h2")
+
+	})
+
+	Convey("Test folder deleted on one side, file created inside on the other side", t, func() {
+
+		base := threeWayDB(threeWayFolder("/a", "uuid-a"), threeWayLeaf("/a/f", "h1"))
+		left := threeWayDB()
+		right := threeWayDB(threeWayFolder("/a", "uuid-a"), threeWayLeaf("/a/f", "h1"), threeWayLeaf("/a/new", "h2"))
+		diff, _ := ComputeThreeWayDiff(mergerTestCtx, left, right, base, nil)
+
+		Convey("Keep both recreates the folder", func() {
+			_, contents, _ := diff.ToBidirectionalBatches(left, right, ConflictKeepBoth)
+			So(diff.Conflicts, ShouldHaveLength, 1)
+			So(diff.Conflicts[0].Type, ShouldEqual, ConflictModifyDelete)
+			So(contents.Right.CreateFolders["/a"], ShouldNotBeNil)
+			So(contents.Right.CreateFiles["/a/new"], ShouldNotBeNil)
+			So(contents.Left.Deletes, ShouldHaveLength, 1)
+			So(contents.Left.Deletes["/a/f"], ShouldNotBeNil)
+		})
+
+		Convey("Prefer left deletes the whole folder", func() {
+			_, contents, _ := diff.ToBidirectionalBatches(left, right, ConflictPreferLeft)
+			So(contents.Right.CreateFiles, ShouldHaveLength, 0)
+			So(contents.Left.Deletes, ShouldHaveLength, 1)
+			So(contents.Left.Deletes["/a"], ShouldNotBeNil)
+		})
+
+	})
+
+}
+
+func TestThreeWayMerge(t *testing.T) {
+
+	Convey("Test processing three-way batches", t, func() {
+
+		m := NewMerger(mergerTestCtx)
+		defer m.Shutdown()
+
+		base := threeWayDB(threeWayFolder("/a", "uuid-a"), threeWayLeaf("/a/f1", "h1"), threeWayLeaf("/b", "h2"), threeWayLeaf("/c", "h3"))
+		left := threeWayDB(threeWayFolder("/a", "uuid-a"), threeWayLeaf("/a/f1", "h1"), threeWayLeaf("/a/b", "h2"), threeWayLeaf("/c", "h3"), threeWayLeaf("/new", "h4"))
+		right := threeWayDB(threeWayFolder("/z", "uuid-a"), threeWayLeaf("/z/f1", "h1"), threeWayLeaf("/b", "h2"))
+
+		diff, _ := ComputeThreeWayDiff(mergerTestCtx, left, right, base, nil)
+		moves, contents, err := diff.ToBidirectionalBatches(left, right, ConflictKeepBoth)
+		So(err, ShouldBeNil)
+		So(diff.Conflicts, ShouldHaveLength, 0)
+
+		m.process(moves.Left)
+		m.process(moves.Right)
+		m.process(contents.Left)
+		m.process(contents.Right)
+		time.Sleep(2 * time.Second)
+
+		for _, db := range []*endpoints.MemDB{left, right} {
+			for _, p := range []string{"/z", "/z/f1", "/z/b", "/new"} {
+				n, _ := db.LoadNode(mergerTestCtx, p)
+				So(n, ShouldNotBeNil)
+			}
+			for _, p := range []string{"/a", "/b", "/c"} {
+				n, _ := db.LoadNode(mergerTestCtx, p)
+				So(n, ShouldBeNil)
+			}
+		}
+
+		snapshot, err := CaptureCommonSnapshot(mergerTestCtx, left, right, nil)
+		So(err, ShouldBeNil)
+		So(snapshot.Nodes, ShouldHaveLength, 5)
+
+		diff, _ = ComputeThreeWayDiff(mergerTestCtx, left, right, snapshot, nil)
+		So(diff.LeftChanges.Count(), ShouldEqual, 0)
+		So(diff.RightChanges.Count(), ShouldEqual, 0)
+
+		// The common snapshot is persisted in the sync bolt snapshot, which is then used as base
+		folder, err := ioutil.TempDir("", "three-way")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(folder)
+		bolt, err := endpoints.NewBoltSnapshot(filepath.Join(folder, "snapshot.db"))
+		So(err, ShouldBeNil)
+		defer bolt.Close()
+		So(bolt.Capture(mergerTestCtx, snapshot), ShouldBeNil)
+
+		right.DeleteNode(mergerTestCtx, "/new")
+		diff, _ = ComputeThreeWayDiff(mergerTestCtx, left, right, bolt, nil)
+		So(diff.LeftChanges.Count(), ShouldEqual, 0)
+		So(diff.RightChanges.Count(), ShouldEqual, 1)
+
+	})
+
+	Convey("Test common snapshot only keeps identical nodes", t, func() {
+
+		left := threeWayDB(threeWayFolder("/a", "uuid-a"), threeWayLeaf("/a/f", "h1"), threeWayLeaf("/b", "h2"))
+		right := threeWayDB(threeWayFolder("/a", "uuid-a"), threeWayLeaf("/a/f", "h1"), threeWayLeaf("/b", "h3"), threeWayLeaf("/c", "h4"))
+
+		snapshot, err := CaptureCommonSnapshot(mergerTestCtx, left, right, nil)
+		So(err, ShouldBeNil)
+		So(snapshot.Nodes, ShouldHaveLength, 3)
+		b, _ := snapshot.LoadNode(mergerTestCtx, "/b")
+		So(b, ShouldBeNil)
+
+	})
+
+}
+
+func TestConflictCopyPath(t *testing.T) {
+
+	Convey("Test conflict copy names", t, func() {
+		So(ConflictCopyPath("/folder/file.txt", "right"), ShouldEqual, "/folder/file-conflict-right.txt")
+		So(ConflictCopyPath("/folder/noext", "right"), ShouldEqual, "/folder/noext-conflict-right")
+		So(ConflictCopyPath("/.hidden", "left"), ShouldEqual, "/.hidden-conflict-left")
+	})
+
+}
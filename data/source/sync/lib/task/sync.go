@@ -23,10 +23,13 @@ package task
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/proto/tree"
 	. "github.com/pmker/yux/data/source/sync/lib/common"
+	"github.com/pmker/yux/data/source/sync/lib/endpoints"
 	"github.com/pmker/yux/data/source/sync/lib/filters"
 	"github.com/pmker/yux/data/source/sync/lib/proc"
 	"go.uber.org/zap"
@@ -40,7 +43,15 @@ type Sync struct {
 	Merger     *proc.Merger
 	Direction  string
 
-	doneChans []chan bool
+	// ConflictPolicy is applied by ThreeWayResync, defaults to proc.ConflictKeepBoth
+	ConflictPolicy proc.ConflictPolicy
+	// Snapshot stores the state of the Source after each successful pass in "left" direction.
+	// The first resync after startup compares the Source with it instead of walking the Target.
+	// In "bi" direction, it stores the last common state of both endpoints, used as the base of ThreeWayResync.
+	Snapshot *endpoints.BoltSnapshot
+
+	doneChans        []chan bool
+	snapshotCompared bool
 }
 
 func (s *Sync) SetupWatcher(ctx context.Context, source PathSyncSource, target PathSyncTarget) error {
@@ -59,7 +70,12 @@ func (s *Sync) SetupWatcher(ctx context.Context, source PathSyncSource, target P
 
 	filterIn, filterOut := s.EchoFilter.CreateFilter()
 	s.Merger.AddRequeueChannel(source, filterIn)
-	go batcher.BatchEvents(filterOut, s.Merger.BatchesChannel, 1*time.Second)
+	batches := s.Merger.BatchesChannel
+	if s.Snapshot != nil {
+		batches = make(chan *filters.Batch)
+		go s.forwardWatchedBatches(ctx, batches)
+	}
+	go batcher.BatchEvents(filterOut, batches, 1*time.Second)
 
 	go func() {
 
@@ -87,11 +103,73 @@ func (s *Sync) SetupWatcher(ctx context.Context, source PathSyncSource, target P
 
 }
 
+// forwardWatchedBatches sends the batches built from watcher events to the merger, and applies each of them
+// to the Snapshot once it is processed without error, so that the snapshot does not drift between two resyncs.
+func (s *Sync) forwardWatchedBatches(ctx context.Context, batches chan *filters.Batch) {
+	for batch := range batches {
+		statusChan := make(chan filters.BatchProcessStatus)
+		doneChan := make(chan bool)
+		batch.StatusChan = statusChan
+		batch.DoneChan = doneChan
+		go func(batch *filters.Batch) {
+			var failed bool
+			for {
+				select {
+				case status := <-statusChan:
+					if status.IsError {
+						failed = true
+					}
+				case <-doneChan:
+					if failed {
+						log.Logger(ctx).Info("Errors occurred while processing watched events, snapshot is not updated")
+					} else if err := s.refreshSnapshot(ctx, batch); err != nil {
+						log.Logger(ctx).Error("Cannot update sync snapshot", zap.Error(err))
+					}
+					return
+				}
+			}
+		}(batch)
+		s.Merger.BatchesChannel <- batch
+	}
+}
+
+// refreshSnapshot applies a processed batch to the Snapshot
+func (s *Sync) refreshSnapshot(ctx context.Context, batch *filters.Batch) error {
+	for _, moves := range []map[string]*filters.BatchedEvent{batch.FolderMoves, batch.FileMoves} {
+		for _, event := range moves {
+			if err := s.Snapshot.MoveNode(ctx, event.Node.Path, event.EventInfo.Path); err != nil {
+				return err
+			}
+		}
+	}
+	var deletes []string
+	for _, event := range batch.Deletes {
+		if event.Node != nil {
+			deletes = append(deletes, event.Node.Path)
+		}
+	}
+	var nodes []*tree.Node
+	for _, creates := range []map[string]*filters.BatchedEvent{batch.CreateFolders, batch.CreateFiles} {
+		for _, event := range creates {
+			if event.Node != nil {
+				nodes = append(nodes, event.Node)
+			}
+		}
+	}
+	return s.Snapshot.ApplyChanges(ctx, deletes, nodes)
+}
+
 func (s *Sync) InitialSnapshots(ctx context.Context, dryRun bool, statusChan chan filters.BatchProcessStatus, doneChan chan bool) (diff *proc.SourceDiff, e error) {
 
 	source, _ := AsPathSyncSource(s.Source)
 	targetAsSource, tASOk := AsPathSyncSource(s.Target)
-	diff, e = proc.ComputeSourcesDiff(ctx, source, targetAsSource, dryRun, statusChan)
+	incremental := s.useSnapshot(dryRun)
+	if incremental {
+		log.Logger(ctx).Info("Comparing source with persisted snapshot")
+		diff, e = proc.ComputeSnapshotDiff(ctx, source, targetAsSource, s.Snapshot, statusChan)
+	} else {
+		diff, e = proc.ComputeSourcesDiff(ctx, source, targetAsSource, dryRun, statusChan)
+	}
 
 	//log.Logger(ctx).Info("### GOT DIFF", zap.Any("diff", diff))
 	if e != nil {
@@ -159,6 +237,26 @@ func (s *Sync) InitialSnapshots(ctx context.Context, dryRun bool, statusChan cha
 
 	batchLeft.StatusChan = statusChan
 	batchRight.StatusChan = statusChan
+	var snapshotStatus chan filters.BatchProcessStatus
+	var snapshotFailed bool
+	snapshotForwarded := make(chan bool)
+	if s.Snapshot != nil && s.Direction == "left" {
+		// Watch batches errors: the snapshot is only captured after a successful pass
+		snapshotStatus = make(chan filters.BatchProcessStatus)
+		batchLeft.StatusChan = snapshotStatus
+		batchRight.StatusChan = snapshotStatus
+		go func() {
+			defer close(snapshotForwarded)
+			for status := range snapshotStatus {
+				if status.IsError {
+					snapshotFailed = true
+				}
+				if statusChan != nil {
+					statusChan <- status
+				}
+			}
+		}()
+	}
 	dChan := make(chan bool, 2)
 	batchLeft.DoneChan = dChan
 	batchRight.DoneChan = dChan
@@ -168,6 +266,15 @@ func (s *Sync) InitialSnapshots(ctx context.Context, dryRun bool, statusChan cha
 			i++
 			if i == 2 {
 				close(dChan)
+				if snapshotStatus != nil {
+					close(snapshotStatus)
+					<-snapshotForwarded
+					if snapshotFailed {
+						log.Logger(ctx).Info("Errors occurred during sync, snapshot is not updated")
+					} else {
+						s.captureSnapshot(ctx, diff, incremental)
+					}
+				}
 				if doneChan != nil {
 					doneChan <- true
 				}
@@ -190,12 +297,45 @@ func (s *Sync) Shutdown() {
 		// ignore 'close on closed channel'
 		recover()
 	}()
+	if s.Snapshot != nil {
+		s.Snapshot.Close()
+	}
 	for _, channel := range s.doneChans {
 		close(channel)
 	}
 	s.Merger.Shutdown()
 }
 
+// useSnapshot tells if the diff can be computed against the persisted snapshot. This is only
+// done once after startup: later resyncs always compare the Source with the Target.
+func (s *Sync) useSnapshot(dryRun bool) bool {
+	if s.Snapshot == nil || s.Direction != "left" || dryRun || s.snapshotCompared {
+		return false
+	}
+	s.snapshotCompared = true
+	return !s.Snapshot.IsEmpty()
+}
+
+// captureSnapshot stores the new state of the Source, either by applying the incremental
+// diff to the snapshot, or by capturing the Source snapshot loaded by the full diff.
+func (s *Sync) captureSnapshot(ctx context.Context, diff *proc.SourceDiff, incremental bool) {
+	var err error
+	if incremental {
+		var deletes []string
+		for _, node := range diff.MissingLeft {
+			deletes = append(deletes, node.Path)
+		}
+		err = s.Snapshot.ApplyChanges(ctx, deletes, diff.MissingRight)
+	} else if leftSnapshot := diff.LeftSnapshot(); leftSnapshot != nil {
+		err = s.Snapshot.Capture(ctx, leftSnapshot)
+	}
+	if err != nil {
+		log.Logger(ctx).Error("Cannot capture sync snapshot", zap.Error(err))
+	} else {
+		log.Logger(ctx).Debug("Sync snapshot captured")
+	}
+}
+
 func (s *Sync) Start(ctx context.Context) {
 	source, sOk := AsPathSyncSource(s.Source)
 	target, tOk := AsPathSyncTarget(s.Target)
@@ -213,6 +353,94 @@ func (s *Sync) Resync(ctx context.Context, dryRun bool, statusChan chan filters.
 	return s.InitialSnapshots(ctx, dryRun, statusChan, doneChan)
 }
 
+// ThreeWayResync compares both endpoints with the last common snapshot, propagates changes in both
+// directions and resolves conflicts with the ConflictPolicy. Once all batches are processed, a new
+// common snapshot is captured in the Snapshot.
+func (s *Sync) ThreeWayResync(ctx context.Context, dryRun bool, statusChan chan filters.BatchProcessStatus, doneChan chan bool) (*proc.ThreeWayDiff, error) {
+
+	source, sOk := AsPathSyncSource(s.Source)
+	targetAsSource, tASOk := AsPathSyncSource(s.Target)
+	sourceAsTarget, sATOk := AsPathSyncTarget(s.Source)
+	target, tOk := AsPathSyncTarget(s.Target)
+	if !sOk || !tASOk || !sATOk || !tOk || s.Snapshot == nil {
+		if doneChan != nil {
+			doneChan <- true
+		}
+		return nil, errors.New("Three-way sync requires a snapshot and endpoints that are both sources and targets")
+	}
+
+	// Without base, all differences are considered as conflicting creations: nothing is lost
+	var base PathSyncSource
+	if !s.Snapshot.IsEmpty() {
+		base = s.Snapshot
+	}
+
+	diff, e := proc.ComputeThreeWayDiff(ctx, source, targetAsSource, base, statusChan)
+	if e != nil {
+		if doneChan != nil {
+			doneChan <- true
+		}
+		return nil, e
+	}
+	moves, contents, e := diff.ToBidirectionalBatches(sourceAsTarget, target, s.ConflictPolicy)
+	if e != nil {
+		if doneChan != nil {
+			doneChan <- true
+		}
+		return nil, e
+	}
+	for _, conflict := range diff.Conflicts {
+		log.Logger(ctx).Info("Sync conflict", zap.String("type", string(conflict.Type)), zap.String("path", conflict.Path), zap.String("resolution", string(conflict.Resolution)))
+		if statusChan != nil {
+			statusChan <- filters.BatchProcessStatus{StatusString: "Conflict (" + string(conflict.Type) + ") on " + conflict.Path + " resolved with " + string(conflict.Resolution)}
+		}
+	}
+	if dryRun {
+		if doneChan != nil {
+			doneChan <- true
+		}
+		return diff, nil
+	}
+
+	// Moves must be fully applied on both sides before contents are transferred
+	batches := []*filters.Batch{moves.Left, moves.Right, contents.Left, contents.Right}
+	dChan := make(chan bool, len(batches))
+	for _, batch := range batches {
+		batch.StatusChan = statusChan
+		batch.DoneChan = dChan
+	}
+	if provider, ok := AsSessionProvider(s.Target); ok {
+		contents.Left.SessionProvider = provider
+		contents.Left.SessionProviderContext = ctx
+	}
+	if provider, ok := AsSessionProvider(s.Source); ok {
+		contents.Right.SessionProvider = provider
+		contents.Right.SessionProviderContext = ctx
+	}
+
+	go func() {
+		for i := 0; i < len(batches); i++ {
+			<-dChan
+		}
+		snapshot, err := proc.CaptureCommonSnapshot(ctx, source, targetAsSource, statusChan)
+		if err == nil {
+			err = s.Snapshot.Capture(ctx, snapshot)
+		}
+		if err != nil {
+			log.Logger(ctx).Error("Cannot save common snapshot", zap.Error(err))
+		}
+		if doneChan != nil {
+			doneChan <- true
+		}
+	}()
+
+	for _, batch := range batches {
+		s.Merger.BatchesChannel <- batch
+	}
+
+	return diff, nil
+}
+
 func NewSync(ctx context.Context, left Endpoint, right Endpoint) *Sync {
 
 	filter := filters.NewEchoFilter()
@@ -0,0 +1,208 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package recycle
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/micro/go-micro/client"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/proto/idm"
+	"github.com/pmker/yux/common/proto/jobs"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/service/proto"
+	"github.com/pmker/yux/common/utils"
+	"github.com/pmker/yux/common/views"
+	"github.com/pmker/yux/scheduler/actions"
+)
+
+var (
+	purgeRecycleActionName = "actions.recycle.purge"
+)
+
+func init() {
+	actions.GetActionsManager().Register(purgeRecycleActionName, func() actions.ConcreteAction {
+		return &PurgeRecycleAction{}
+	})
+}
+
+// PurgeRecycleAction definitively deletes the nodes that were moved to a recycle bin more than a given number
+// of days ago. The "retentionDays" parameter overrides the retention configured for the tree service.
+type PurgeRecycleAction struct {
+	Router        views.Handler
+	retentionDays int
+}
+
+// GetName returns the Unique identifier.
+func (c *PurgeRecycleAction) GetName() string {
+	return purgeRecycleActionName
+}
+
+// Init passes the parameters to a newly created PurgeRecycleAction.
+func (c *PurgeRecycleAction) Init(job *jobs.Job, cl client.Client, action *jobs.Action) error {
+	if days, ok := action.Parameters["retentionDays"]; ok {
+		d, e := strconv.Atoi(days)
+		if e != nil {
+			return fmt.Errorf("invalid retentionDays parameter %s", days)
+		}
+		c.retentionDays = d
+	} else {
+		c.retentionDays = RetentionDays()
+	}
+	c.Router = views.NewStandardRouter(views.RouterOptions{AdminView: true})
+	return nil
+}
+
+// Run processes the actual action code.
+func (c *PurgeRecycleAction) Run(ctx context.Context, channels *actions.RunnableChannels, input jobs.ActionMessage) (jobs.ActionMessage, error) {
+
+	output := input
+	if c.retentionDays <= 0 {
+		output.AppendOutput(&jobs.ActionOutput{
+			Success:    true,
+			StringBody: "No retention period is set, recycle bins are kept",
+		})
+		return output, nil
+	}
+
+	roots, e := recycleRoots(ctx)
+	if e != nil {
+		return input.WithError(e), e
+	}
+
+	treeClient := tree.NewNodeProviderClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_TREE, defaults.NewClient())
+	now := time.Now()
+	var purged int
+	for _, rootId := range roots {
+		rootResp, e := treeClient.ReadNode(ctx, &tree.ReadNodeRequest{Node: &tree.Node{Uuid: rootId}})
+		if e != nil {
+			// Recycle root ACL may outlive its node
+			continue
+		}
+		binPath := path.Join(rootResp.Node.Path, common.RECYCLE_BIN_NAME)
+		items, e := listChildren(ctx, treeClient, &tree.Node{Path: binPath}, false)
+		if e != nil {
+			continue
+		}
+		for _, item := range items {
+			// ListNodes does not load the metadata
+			r, e := treeClient.ReadNode(ctx, &tree.ReadNodeRequest{Node: item})
+			if e != nil || !Expired(r.Node, c.retentionDays, now) {
+				continue
+			}
+			if e := c.deleteRecursive(ctx, treeClient, r.Node); e != nil {
+				log.Logger(ctx).Error("Cannot purge node from recycle bin", r.Node.ZapPath(), zap.Error(e))
+				continue
+			}
+			log.Auditer(ctx).Info(
+				fmt.Sprintf("Purged [%s] from recycle bin after %d days", r.Node.Path, c.retentionDays),
+				log.GetAuditId(common.AUDIT_NODE_DELETE),
+				r.Node.ZapUuid(),
+				r.Node.ZapPath(),
+			)
+			purged++
+		}
+	}
+
+	output.AppendOutput(&jobs.ActionOutput{
+		Success:    true,
+		StringBody: fmt.Sprintf("Purged %d item(s) from recycle bins", purged),
+	})
+	return output, nil
+}
+
+// deleteRecursive removes all files below a node, then the node itself.
+func (c *PurgeRecycleAction) deleteRecursive(ctx context.Context, treeClient tree.NodeProviderClient, node *tree.Node) error {
+	if !node.IsLeaf() {
+		children, e := listChildren(ctx, treeClient, node, true)
+		if e != nil {
+			return e
+		}
+		for _, child := range children {
+			if !child.IsLeaf() {
+				continue
+			}
+			if _, e := c.Router.DeleteNode(ctx, &tree.DeleteNodeRequest{Node: child}); e != nil {
+				return e
+			}
+		}
+	}
+	_, e := c.Router.DeleteNode(ctx, &tree.DeleteNodeRequest{Node: node})
+	return e
+}
+
+// recycleRoots lists the uuids of all nodes flagged as holding a recycle bin.
+func recycleRoots(ctx context.Context) ([]string, error) {
+	q, _ := ptypes.MarshalAny(&idm.ACLSingleQuery{
+		Actions: []*idm.ACLAction{utils.ACL_RECYCLE_ROOT},
+	})
+	cl := idm.NewACLServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_ACL, defaults.NewClient())
+	s, e := cl.SearchACL(ctx, &idm.SearchACLRequest{
+		Query: &service.Query{SubQueries: []*any.Any{q}},
+	})
+	if e != nil {
+		return nil, e
+	}
+	defer s.Close()
+	seen := make(map[string]bool)
+	var roots []string
+	for {
+		r, e := s.Recv()
+		if e != nil {
+			break
+		}
+		if !seen[r.ACL.NodeID] {
+			seen[r.ACL.NodeID] = true
+			roots = append(roots, r.ACL.NodeID)
+		}
+	}
+	return roots, nil
+}
+
+func listChildren(ctx context.Context, treeClient tree.NodeProviderClient, node *tree.Node, recursive bool) ([]*tree.Node, error) {
+	streamer, e := treeClient.ListNodes(ctx, &tree.ListNodesRequest{Node: node, Recursive: recursive})
+	if e != nil {
+		return nil, e
+	}
+	defer streamer.Close()
+	var children []*tree.Node
+	for {
+		r, e := streamer.Recv()
+		if e != nil || r == nil {
+			break
+		}
+		if !recursive && path.Base(r.Node.Path) == common.PYDIO_SYNC_HIDDEN_FILE_META {
+			continue
+		}
+		children = append(children, r.Node)
+	}
+	return children, nil
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+// Package recycle holds the metadata attached to nodes moved to a recycle bin, and the scheduler action
+// definitively removing them once the retention period is over.
+package recycle
+
+import (
+	"context"
+	"time"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/config"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/proto/jobs"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/registry"
+	"github.com/pmker/yux/common/service"
+)
+
+// RetentionDays reads the number of days deleted nodes are kept in recycle bins. Zero means forever.
+func RetentionDays() int {
+	return config.Get("services", common.SERVICE_REST_NAMESPACE_+common.SERVICE_TREE, "recycleRetentionDays").Int(0)
+}
+
+// SetDeletionMeta records on node where it was deleted from, who deleted it and when.
+func SetDeletionMeta(node *tree.Node, originalPath string, owner string, deletionTime time.Time) {
+	node.SetMeta(common.META_NAMESPACE_RECYCLE_RESTORE, originalPath)
+	node.SetMeta(common.META_NAMESPACE_RECYCLE_OWNER, owner)
+	node.SetMeta(common.META_NAMESPACE_RECYCLE_TIME, deletionTime.Unix())
+}
+
+// DeletionTime reads the time a node was moved to a recycle bin, or a zero time if it is unknown
+// (nodes recycled before the deletion time was recorded).
+func DeletionTime(node *tree.Node) time.Time {
+	var t int64
+	if e := node.GetMeta(common.META_NAMESPACE_RECYCLE_TIME, &t); e != nil || t == 0 {
+		return time.Time{}
+	}
+	return time.Unix(t, 0)
+}
+
+// Expired checks if a recycled node was deleted more than retentionDays ago. Nodes without a known
+// deletion time never expire.
+func Expired(node *tree.Node, retentionDays int, now time.Time) bool {
+	if retentionDays <= 0 {
+		return false
+	}
+	deleted := DeletionTime(node)
+	if deleted.IsZero() {
+		return false
+	}
+	return now.Sub(deleted) > time.Duration(retentionDays)*24*time.Hour
+}
+
+// InsertRetentionJob registers the daily job purging expired nodes from all recycle bins.
+func InsertRetentionJob(ctx context.Context) error {
+
+	log.Logger(ctx).Info("Inserting recycle bins retention job")
+
+	return service.Retry(func() error {
+		cli := jobs.NewJobServiceClient(registry.GetClient(common.SERVICE_JOBS))
+		_, e := cli.PutJob(ctx, &jobs.PutJobRequest{Job: &jobs.Job{
+			ID:    "recycle-retention-job",
+			Owner: common.PYDIO_SYSTEM_USERNAME,
+			Label: "Purge expired items from recycle bins",
+			Schedule: &jobs.Schedule{
+				Iso8601Schedule: "R/2012-06-04T03:00:00.828696-07:00/P1D", // Every day
+			},
+			AutoStart:      false,
+			MaxConcurrency: 1,
+			Actions: []*jobs.Action{{
+				ID: purgeRecycleActionName,
+			}},
+		}})
+		return e
+	})
+}
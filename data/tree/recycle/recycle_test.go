@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package recycle
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/client"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/views"
+)
+
+// treeMock serves a fixed list of nodes, indexed by path.
+type treeMock struct {
+	nodes []*tree.Node
+}
+
+func (m *treeMock) ReadNode(ctx context.Context, in *tree.ReadNodeRequest, opts ...client.CallOption) (*tree.ReadNodeResponse, error) {
+	for _, n := range m.nodes {
+		if n.Path == in.Node.Path {
+			return &tree.ReadNodeResponse{Node: n}, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot find node %s", in.Node.Path)
+}
+
+func (m *treeMock) ListNodes(ctx context.Context, in *tree.ListNodesRequest, opts ...client.CallOption) (tree.NodeProvider_ListNodesClient, error) {
+	streamer := views.NewWrappingStreamer()
+	go func() {
+		defer streamer.Close()
+		for _, n := range m.nodes {
+			if (in.Recursive && strings.HasPrefix(n.Path, in.Node.Path+"/")) || path.Dir(n.Path) == in.Node.Path {
+				streamer.Send(&tree.ListNodesResponse{Node: n})
+			}
+		}
+	}()
+	return streamer, nil
+}
+
+func TestDeletionMeta(t *testing.T) {
+
+	Convey("Deletion metadata", t, func() {
+		deleted := time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC)
+		node := &tree.Node{Uuid: "node-uuid"}
+		SetDeletionMeta(node, "pydiods1/folder/file.txt", "admin", deleted)
+
+		So(node.GetStringMeta(common.META_NAMESPACE_RECYCLE_RESTORE), ShouldEqual, "pydiods1/folder/file.txt")
+		So(node.GetStringMeta(common.META_NAMESPACE_RECYCLE_OWNER), ShouldEqual, "admin")
+		So(DeletionTime(node).Equal(deleted), ShouldBeTrue)
+		So(DeletionTime(&tree.Node{}).IsZero(), ShouldBeTrue)
+	})
+
+}
+
+func TestExpired(t *testing.T) {
+
+	Convey("Retention of recycled nodes", t, func() {
+		now := time.Date(2018, 10, 31, 12, 0, 0, 0, time.UTC)
+		node := &tree.Node{}
+		SetDeletionMeta(node, "pydiods1/file.txt", "admin", now.Add(-10*24*time.Hour-time.Minute))
+
+		So(Expired(node, 10, now), ShouldBeTrue)
+		So(Expired(node, 11, now), ShouldBeFalse)
+		So(Expired(node, 0, now), ShouldBeFalse)
+
+		// Nodes recycled without a deletion time are kept
+		legacy := &tree.Node{}
+		legacy.SetMeta(common.META_NAMESPACE_RECYCLE_RESTORE, "pydiods1/file.txt")
+		So(Expired(legacy, 1, now), ShouldBeFalse)
+	})
+
+}
+
+func TestListChildren(t *testing.T) {
+
+	treeClient := &treeMock{nodes: []*tree.Node{
+		{Path: "pydiods1/recycle_bin/" + common.PYDIO_SYNC_HIDDEN_FILE_META, Type: tree.NodeType_LEAF},
+		{Path: "pydiods1/recycle_bin/file.txt", Type: tree.NodeType_LEAF},
+		{Path: "pydiods1/recycle_bin/folder", Type: tree.NodeType_COLLECTION},
+		{Path: "pydiods1/recycle_bin/folder/child.txt", Type: tree.NodeType_LEAF},
+	}}
+
+	Convey("Recycle bin items are listed without the hidden file", t, func() {
+		items, e := listChildren(context.Background(), treeClient, &tree.Node{Path: "pydiods1/recycle_bin"}, false)
+		So(e, ShouldBeNil)
+		So(items, ShouldHaveLength, 2)
+		So(items[0].Path, ShouldEqual, "pydiods1/recycle_bin/file.txt")
+		So(items[1].Path, ShouldEqual, "pydiods1/recycle_bin/folder")
+
+		children, e := listChildren(context.Background(), treeClient, &tree.Node{Path: "pydiods1/recycle_bin/folder"}, true)
+		So(e, ShouldBeNil)
+		So(children, ShouldHaveLength, 1)
+		So(children[0].Path, ShouldEqual, "pydiods1/recycle_bin/folder/child.txt")
+	})
+
+}
+
+func TestDeleteRecursive(t *testing.T) {
+
+	nodes := []*tree.Node{
+		{Path: "pydiods1/recycle_bin/folder", Type: tree.NodeType_COLLECTION},
+		{Path: "pydiods1/recycle_bin/folder/sub", Type: tree.NodeType_COLLECTION},
+		{Path: "pydiods1/recycle_bin/folder/sub/child.txt", Type: tree.NodeType_LEAF},
+		{Path: "pydiods1/recycle_bin/folder/child.txt", Type: tree.NodeType_LEAF},
+		{Path: "pydiods1/recycle_bin/other.txt", Type: tree.NodeType_LEAF},
+	}
+	mock := &views.HandlerMock{Nodes: make(map[string]*tree.Node)}
+	for _, n := range nodes {
+		mock.Nodes[n.Path] = n
+	}
+	action := &PurgeRecycleAction{Router: mock}
+
+	Convey("Purging a folder deletes its files, then the folder itself", t, func() {
+		So(action.deleteRecursive(context.Background(), &treeMock{nodes: nodes}, nodes[0]), ShouldBeNil)
+		So(mock.Nodes, ShouldNotContainKey, "pydiods1/recycle_bin/folder")
+		So(mock.Nodes, ShouldNotContainKey, "pydiods1/recycle_bin/folder/child.txt")
+		So(mock.Nodes, ShouldNotContainKey, "pydiods1/recycle_bin/folder/sub/child.txt")
+		So(mock.Nodes, ShouldContainKey, "pydiods1/recycle_bin/other.txt")
+	})
+
+}
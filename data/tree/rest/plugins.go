@@ -22,8 +22,9 @@ package rest
 
 import (
 	"github.com/pmker/yux/common"
-	"github.com/pmker/yux/common/service"
 	"github.com/pmker/yux/common/plugins"
+	"github.com/pmker/yux/common/service"
+	"github.com/pmker/yux/data/tree/recycle"
 )
 
 func init() {
@@ -33,6 +34,10 @@ func init() {
 			service.Tag(common.SERVICE_TAG_DATA),
 			service.Description("RESTful Gateway to tree service"),
 			service.RouterDependencies(),
+			service.Migrations([]*service.Migration{{
+				TargetVersion: service.FirstRun(),
+				Up:            recycle.InsertRetentionJob,
+			}}),
 			service.WithWeb(func() service.WebHandler {
 				return new(Handler)
 			}),
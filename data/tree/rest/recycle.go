@@ -2,17 +2,23 @@ package rest
 
 import (
 	"context"
+	"fmt"
+	"path"
+	"strings"
 
 	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/any"
 	"github.com/micro/go-micro/errors"
+	"github.com/pborman/uuid"
 	"github.com/pmker/yux/common"
 	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/micro"
 	"github.com/pmker/yux/common/proto/idm"
+	"github.com/pmker/yux/common/proto/jobs"
 	"github.com/pmker/yux/common/proto/tree"
-	"github.com/pmker/yux/common/micro"
 	"github.com/pmker/yux/common/service/proto"
 	"github.com/pmker/yux/common/utils"
+	"github.com/pmker/yux/common/views"
 )
 
 type deleteJobs struct {
@@ -28,9 +34,14 @@ func newDeleteJobs() *deleteJobs {
 	}
 }
 
+// sourceInRecycle checks whether source is stored below a recycle bin. The ancestors list starts with
+// the source itself, so that a recycle bin is not considered as being inside itself.
 func sourceInRecycle(ctx context.Context, source *tree.Node, ancestors []*tree.Node) bool {
 
-	for _, n := range ancestors {
+	if len(ancestors) == 0 {
+		return false
+	}
+	for _, n := range ancestors[1:] {
 		if n.GetStringMeta("name") == common.RECYCLE_BIN_NAME {
 			return true
 		}
@@ -39,6 +50,11 @@ func sourceInRecycle(ctx context.Context, source *tree.Node, ancestors []*tree.N
 	return false
 }
 
+// isRecycleBin checks whether the node whose ancestors are passed is a recycle bin itself.
+func isRecycleBin(ancestors []*tree.Node) bool {
+	return len(ancestors) > 0 && ancestors[0].GetStringMeta("name") == common.RECYCLE_BIN_NAME
+}
+
 func findRecycleForSource(ctx context.Context, source *tree.Node, ancestors []*tree.Node) (recycle *tree.Node, err error) {
 
 	var ids []string
@@ -91,3 +107,96 @@ func findRecycleForSource(ctx context.Context, source *tree.Node, ancestors []*t
 	}
 	return
 }
+
+// checkRecycledWritable makes sure that node is inside a recycle bin and can be modified by the current user. If a
+// restore target is passed, the user must also be allowed to write at this location.
+func checkRecycledWritable(ctx context.Context, pool *views.ClientsPool, node *tree.Node, restoreTarget *tree.Node) error {
+
+	ctx, ancestors, e := views.AncestorsListFromContext(ctx, node, "in", pool, false)
+	if e != nil {
+		return e
+	}
+	if !sourceInRecycle(ctx, node, ancestors) {
+		return errors.Forbidden("RecycleOnly", fmt.Sprintf("%s is not in a recycle bin", node.Path))
+	}
+	accessList, e := views.AccessListFromContext(ctx)
+	if e != nil {
+		return e
+	}
+	if !accessList.CanWrite(ctx, ancestors...) {
+		return errors.Forbidden("RecycleOnly", fmt.Sprintf("%s is not writeable", node.Path))
+	}
+	if restoreTarget == nil {
+		return nil
+	}
+	// Original location may not exist anymore, check its closest existing parent
+	_, targetAncestors, e := views.AncestorsListFromContext(ctx, restoreTarget, "restore", pool, true)
+	if e != nil {
+		return e
+	}
+	if !accessList.CanWrite(ctx, targetAncestors...) {
+		return errors.Forbidden("RecycleOnly", "original location is not writeable, cannot restore")
+	}
+	return nil
+}
+
+// listRecycleItems lists the nodes of the recycle bin found under rootPath, with their metadata.
+func listRecycleItems(ctx context.Context, router *views.Router, rootPath string) ([]*tree.Node, error) {
+
+	binNode := &tree.Node{Path: strings.TrimSuffix(rootPath, "/") + "/" + common.RECYCLE_BIN_NAME}
+	streamer, e := router.ListNodes(ctx, &tree.ListNodesRequest{Node: binNode})
+	if e != nil {
+		return nil, e
+	}
+	defer streamer.Close()
+
+	var items []*tree.Node
+	for {
+		r, e := streamer.Recv()
+		if e != nil || r == nil {
+			break
+		}
+		if path.Base(r.Node.Path) == common.PYDIO_SYNC_HIDDEN_FILE_META {
+			continue
+		}
+		// Listing does not load the metadata
+		if read, e := router.ReadNode(ctx, &tree.ReadNodeRequest{Node: r.Node}); e == nil {
+			items = append(items, read.Node)
+		}
+	}
+	return items, nil
+}
+
+// userOriginalPath converts the full path a node was deleted from to a path relative to the user
+// view of the recycle root. It is empty if the node was not deleted from below this root.
+func userOriginalPath(originalFullPath string, rootFullPath string, rootPath string) string {
+	rootFullPath = strings.TrimSuffix(rootFullPath, "/")
+	if originalFullPath == "" || rootFullPath == "" || !strings.HasPrefix(originalFullPath+"/", rootFullPath+"/") {
+		return ""
+	}
+	return strings.TrimSuffix(rootPath, "/") + strings.TrimPrefix(originalFullPath, rootFullPath)
+}
+
+// newDeleteJob prepares a job definitively deleting the nodes at the given full paths.
+func newDeleteJob(owner string, label string, languages []string, fullPaths []string) (string, *jobs.Job) {
+	jobUuid := uuid.New()
+	return jobUuid, &jobs.Job{
+		ID:             "delete-" + jobUuid,
+		Owner:          owner,
+		Label:          label,
+		Inactive:       false,
+		Languages:      languages,
+		MaxConcurrency: 1,
+		AutoStart:      true,
+		AutoClean:      true,
+		Actions: []*jobs.Action{
+			{
+				ID:         "actions.tree.delete",
+				Parameters: map[string]string{},
+				NodesSelector: &jobs.NodesSelector{
+					Pathes: fullPaths,
+				},
+			},
+		},
+	}
+}
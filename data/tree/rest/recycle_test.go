@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+package rest
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/proto/tree"
+)
+
+func namedNode(uuid string, name string) *tree.Node {
+	n := &tree.Node{Uuid: uuid}
+	n.SetMeta("name", name)
+	return n
+}
+
+func TestSourceInRecycle(t *testing.T) {
+
+	root := namedNode("root", "pydiods1")
+	bin := namedNode("bin", common.RECYCLE_BIN_NAME)
+	folder := namedNode("folder", "folder")
+	file := namedNode("file", "file.txt")
+
+	Convey("Nodes below a recycle bin are recycled", t, func() {
+		So(sourceInRecycle(context.Background(), file, []*tree.Node{file, bin, root}), ShouldBeTrue)
+		So(sourceInRecycle(context.Background(), file, []*tree.Node{file, folder, bin, root}), ShouldBeTrue)
+		So(sourceInRecycle(context.Background(), file, []*tree.Node{file, folder, root}), ShouldBeFalse)
+		So(sourceInRecycle(context.Background(), file, nil), ShouldBeFalse)
+	})
+
+	Convey("The recycle bin itself is not inside a recycle bin", t, func() {
+		So(sourceInRecycle(context.Background(), bin, []*tree.Node{bin, root}), ShouldBeFalse)
+		So(isRecycleBin([]*tree.Node{bin, root}), ShouldBeTrue)
+		So(isRecycleBin([]*tree.Node{file, bin, root}), ShouldBeFalse)
+		So(isRecycleBin(nil), ShouldBeFalse)
+	})
+
+}
+
+func TestUserOriginalPath(t *testing.T) {
+
+	Convey("Original paths are converted to the user view of the recycle root", t, func() {
+		So(userOriginalPath("pydiods1/folder/file.txt", "pydiods1", "common-files"), ShouldEqual, "common-files/folder/file.txt")
+		So(userOriginalPath("pydiods1/folder/file.txt", "pydiods1/", "common-files/"), ShouldEqual, "common-files/folder/file.txt")
+		So(userOriginalPath("pydiods1/folder/file.txt", "pydiods1/folder", "my-files"), ShouldEqual, "my-files/file.txt")
+		So(userOriginalPath("pydiods10/file.txt", "pydiods1", "common-files"), ShouldBeEmpty)
+		So(userOriginalPath("", "pydiods1", "common-files"), ShouldBeEmpty)
+		So(userOriginalPath("pydiods1/file.txt", "", "common-files"), ShouldBeEmpty)
+	})
+
+}
+
+func TestNewDeleteJob(t *testing.T) {
+
+	Convey("Purge jobs delete the selected full paths", t, func() {
+		jobUuid, job := newDeleteJob("admin", "Purge", []string{"en-us"}, []string{"pydiods1/recycle_bin/file.txt"})
+		So(jobUuid, ShouldNotBeEmpty)
+		So(job.ID, ShouldEqual, "delete-"+jobUuid)
+		So(job.Owner, ShouldEqual, "admin")
+		So(job.Actions, ShouldHaveLength, 1)
+		So(job.Actions[0].ID, ShouldEqual, "actions.tree.delete")
+		So(job.Actions[0].NodesSelector.Pathes, ShouldResemble, []string{"pydiods1/recycle_bin/file.txt"})
+	})
+
+}
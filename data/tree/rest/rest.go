@@ -26,8 +26,10 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/emicklei/go-restful"
+	"github.com/micro/go-micro/errors"
 	"github.com/pborman/uuid"
 	"go.uber.org/zap"
 
@@ -46,6 +48,7 @@ import (
 	"github.com/pmker/yux/common/views"
 	rest_meta "github.com/pmker/yux/data/meta/rest"
 	"github.com/pmker/yux/data/templates"
+	"github.com/pmker/yux/data/tree/recycle"
 	"github.com/pmker/yux/scheduler/lang"
 )
 
@@ -196,7 +199,7 @@ func (h *Handler) DeleteNodes(req *restful.Request, resp *restful.Response) {
 			if e != nil {
 				return e
 			}
-			if sourceInRecycle(ctx, filtered, ancestors) {
+			if sourceInRecycle(ctx, filtered, ancestors) || isRecycleBin(ancestors) {
 				// Now, this is a real delete!
 				log.Logger(ctx).Info(fmt.Sprintf("Definitively deleting [%s]", node.GetPath()))
 				deleteJobs.RealDeletes = append(deleteJobs.RealDeletes, filtered.Path)
@@ -210,9 +213,9 @@ func (h *Handler) DeleteNodes(req *restful.Request, resp *restful.Response) {
 				// Moving to recycle bin
 				log.Logger(ctx).Info(fmt.Sprintf("Deletion: moving [%s] to recycle bin", node.GetPath()), zap.Any("RecycleRoot", recycleRoot))
 				rPath := strings.TrimSuffix(recycleRoot.Path, "/") + "/" + common.RECYCLE_BIN_NAME
-				// If moving to recycle, save current path as metadata for later restore operation
+				// If moving to recycle, save current path, owner and time as metadata for later restore and purge operations
 				metaNode := &tree.Node{Uuid: ancestors[0].Uuid}
-				metaNode.SetMeta(common.META_NAMESPACE_RECYCLE_RESTORE, ancestors[0].Path)
+				recycle.SetDeletionMeta(metaNode, ancestors[0].Path, username, time.Now())
 				if _, e := metaClient.CreateNode(ctx, &tree.CreateNodeRequest{Node: metaNode, Silent: true}); e != nil {
 					log.Logger(ctx).Error("Could not store recycle_restore metadata for node", zap.Error(e))
 				}
@@ -295,26 +298,7 @@ func (h *Handler) DeleteNodes(req *restful.Request, resp *restful.Response) {
 	if len(deleteJobs.RealDeletes) > 0 {
 
 		taskLabel := T("Jobs.User.Delete")
-		jobUuid := uuid.New()
-		job := &jobs.Job{
-			ID:             "delete-" + jobUuid,
-			Owner:          username,
-			Label:          taskLabel,
-			Inactive:       false,
-			Languages:      languages,
-			MaxConcurrency: 1,
-			AutoStart:      true,
-			AutoClean:      true,
-			Actions: []*jobs.Action{
-				{
-					ID:         "actions.tree.delete",
-					Parameters: map[string]string{},
-					NodesSelector: &jobs.NodesSelector{
-						Pathes: deleteJobs.RealDeletes,
-					},
-				},
-			},
-		}
+		jobUuid, job := newDeleteJob(username, taskLabel, languages, deleteJobs.RealDeletes)
 		if _, er := cli.PutJob(ctx, &jobs.PutJobRequest{Job: job}); er != nil {
 			service.RestError500(req, resp, er)
 			return
@@ -394,6 +378,9 @@ func (h *Handler) RestoreNodes(req *restful.Request, resp *restful.Response) {
 			if originalFullPath == "" {
 				return fmt.Errorf("cannot find restore location for selected node")
 			}
+			if e := checkRecycledWritable(ctx, router.GetClientsPool(), filtered, &tree.Node{Path: originalFullPath}); e != nil {
+				return e
+			}
 			if r.GetNode().IsLeaf() {
 				moveLabel = T("Jobs.User.FileMove")
 			} else {
@@ -440,13 +427,129 @@ func (h *Handler) RestoreNodes(req *restful.Request, resp *restful.Response) {
 	})
 
 	if e != nil {
-		service.RestError500(req, resp, e)
+		service.RestErrorDetect(req, resp, e)
 	} else {
 		resp.WriteEntity(output)
 	}
 
 }
 
+// ListRecycle lists the nodes of a recycle bin, along with their location, owner and time of deletion.
+func (h *Handler) ListRecycle(req *restful.Request, resp *restful.Response) {
+
+	var input rest.ListRecycleRequest
+	if e := req.ReadEntity(&input); e != nil {
+		service.RestError500(req, resp, e)
+		return
+	}
+	ctx := req.Request.Context()
+	router := h.GetRouter()
+	output := &rest.RecycleCollection{}
+
+	rootPath := strings.Trim(input.Path, "/")
+	var rootFullPath string
+	if e := router.WrapCallback(func(inputFilter views.NodeFilter, outputFilter views.NodeFilter) error {
+		_, filtered, e := inputFilter(ctx, &tree.Node{Path: rootPath}, "in")
+		if e != nil {
+			return e
+		}
+		rootFullPath = filtered.Path
+		return nil
+	}); e != nil {
+		service.RestErrorDetect(req, resp, e)
+		return
+	}
+
+	items, e := listRecycleItems(ctx, router, rootPath)
+	if e != nil {
+		service.RestErrorDetect(req, resp, e)
+		return
+	}
+	for _, n := range items {
+		item := &rest.RecycleItem{
+			Node:         n.WithoutReservedMetas(),
+			OriginalPath: userOriginalPath(n.GetStringMeta(common.META_NAMESPACE_RECYCLE_RESTORE), rootFullPath, rootPath),
+			Owner:        n.GetStringMeta(common.META_NAMESPACE_RECYCLE_OWNER),
+		}
+		if t := recycle.DeletionTime(n); !t.IsZero() {
+			item.DeletionTime = int32(t.Unix())
+		}
+		output.Items = append(output.Items, item)
+	}
+
+	resp.WriteEntity(output)
+}
+
+// PurgeRecycle definitively deletes some nodes of a recycle bin, or the whole content of a recycle bin.
+func (h *Handler) PurgeRecycle(req *restful.Request, resp *restful.Response) {
+
+	var input rest.PurgeRecycleRequest
+	if e := req.ReadEntity(&input); e != nil {
+		service.RestError500(req, resp, e)
+		return
+	}
+	ctx := req.Request.Context()
+	username, _ := utils.FindUserNameInContext(ctx)
+	languages := i18n.UserLanguagesFromRestRequest(req, config.Default())
+	T := lang.Bundle().GetTranslationFunc(languages...)
+	output := &rest.PurgeRecycleResponse{}
+	router := h.GetRouter()
+
+	nodes := input.Nodes
+	if len(nodes) == 0 {
+		if input.Path == "" {
+			service.RestErrorDetect(req, resp, errors.BadRequest("RecycleNotFound", "please provide a recycle bin or the nodes to purge"))
+			return
+		}
+		var e error
+		if nodes, e = listRecycleItems(ctx, router, strings.Trim(input.Path, "/")); e != nil {
+			service.RestErrorDetect(req, resp, e)
+			return
+		}
+	}
+
+	var purges []string
+	e := router.WrapCallback(func(inputFilter views.NodeFilter, outputFilter views.NodeFilter) error {
+		for _, node := range nodes {
+			ctx, filtered, e := inputFilter(ctx, node, "in")
+			if e != nil {
+				return e
+			}
+			if e := checkRecycledWritable(ctx, router.GetClientsPool(), filtered, nil); e != nil {
+				return e
+			}
+			purges = append(purges, filtered.Path)
+			log.Auditer(ctx).Info(
+				fmt.Sprintf("Purged [%s] from recycle bin", node.GetPath()),
+				log.GetAuditId(common.AUDIT_NODE_DELETE),
+				node.ZapUuid(),
+				node.ZapPath(),
+			)
+		}
+		return nil
+	})
+	if e != nil {
+		service.RestErrorDetect(req, resp, e)
+		return
+	}
+
+	if len(purges) > 0 {
+		cli := jobs.NewJobServiceClient(registry.GetClient(common.SERVICE_JOBS))
+		taskLabel := T("Jobs.User.Delete")
+		jobUuid, job := newDeleteJob(username, taskLabel, languages, purges)
+		if _, er := cli.PutJob(ctx, &jobs.PutJobRequest{Job: job}); er != nil {
+			service.RestError500(req, resp, er)
+			return
+		}
+		output.PurgeJobs = append(output.PurgeJobs, &rest.BackgroundJobResult{
+			Uuid:  jobUuid,
+			Label: taskLabel,
+		})
+	}
+
+	resp.WriteEntity(output)
+}
+
 func (h *Handler) ListAdminTree(req *restful.Request, resp *restful.Response) {
 
 	var input tree.ListNodesRequest
@@ -67,6 +67,7 @@ func (c *PruneVersionsAction) Run(ctx context.Context, channels *actions.Runnabl
 	}
 	// Prepare ctx with info about the target branch
 	ctx = views.WithBranchInfo(ctx, "to", views.BranchInfo{LoadedSource: source})
+	ctx = views.WithBranchInfo(ctx, "in", views.BranchInfo{LoadedSource: source})
 	/*
 		if meta, mOk := views.MinioMetaFromContext(ctx); mOk {
 			source.Client.PrepareMetadata(meta)
@@ -78,7 +79,10 @@ func (c *PruneVersionsAction) Run(ctx context.Context, channels *actions.Runnabl
 	if response, err := versionClient.PruneVersions(ctx, &tree.PruneVersionsRequest{AllDeletedNodes: true}); err == nil {
 		log.Logger(ctx).Debug("Client responded", zap.Any("resp", response))
 		for _, versionFileId := range response.DeletedVersions {
-			err := source.Client.RemoveObjectWithContext(ctx, source.ObjectsBucket, versionFileId)
+			// Go through the handler to release deduplicated content
+			deleteNode := &tree.Node{Path: versionFileId}
+			deleteNode.SetMeta(common.META_NAMESPACE_DATASOURCE_PATH, deleteNode.Path)
+			_, err := c.Handler.DeleteNode(ctx, &tree.DeleteNodeRequest{Node: deleteNode})
 			if err != nil {
 				log.Logger(ctx).Error("Error while trying to remove file", zap.String("fileId", versionFileId), zap.Error(err))
 			} else {
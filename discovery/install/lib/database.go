@@ -26,11 +26,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/url"
 	"regexp"
 	"strings"
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/pmker/yux/common/config"
+	"github.com/pmker/yux/common/dao"
 	"github.com/pmker/yux/common/proto/install"
 )
 
@@ -38,7 +41,7 @@ var (
 	ErrMySQLCharsetNotSupported = errors.New("Charset is not supported for this version of MySQL")
 )
 
-func dsnFromInstallConfig(c *install.InstallConfig) (string, error) {
+func dsnFromInstallConfig(c *install.InstallConfig) (string, string, error) {
 
 	var err error
 
@@ -49,14 +52,22 @@ func dsnFromInstallConfig(c *install.InstallConfig) (string, error) {
 		conf, err = addDatabaseTCPConnection(c)
 	case "socket":
 		conf, err = addDatabaseSocketConnection(c)
+	case "postgres":
+		return "postgres", postgresDSNFromInstallConfig(c), nil
 	case "manual":
+		if isPostgresDSN(c.GetDbManualDSN()) {
+			if _, err := dao.ParsePostgresDSN(c.GetDbManualDSN()); err != nil {
+				return "", "", err
+			}
+			return "postgres", c.GetDbManualDSN(), nil
+		}
 		conf, err = addDatabaseManualConnection(c)
 	default:
-		return "", fmt.Errorf("Unknown type")
+		return "", "", fmt.Errorf("Unknown type")
 	}
 
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	conf.ParseTime = true
@@ -64,24 +75,24 @@ func dsnFromInstallConfig(c *install.InstallConfig) (string, error) {
 	// Check DB Connection
 	dsn := conf.FormatDSN()
 
-	return dsn, nil
+	return "mysql", dsn, nil
 
 }
 
 // DATABASES
 func actionDatabaseAdd(c *install.InstallConfig) error {
 
-	dsn, err := dsnFromInstallConfig(c)
+	driver, dsn, err := dsnFromInstallConfig(c)
 	if err != nil {
 		return err
 	}
 
-	if e := checkConnection(dsn); e != nil {
+	if e := checkConnection(driver, dsn); e != nil {
 		return e
 	}
 
 	connection := map[string]string{
-		"driver": "mysql",
+		"driver": driver,
 		"dsn":    dsn,
 	}
 
@@ -125,6 +136,34 @@ func addDatabaseSocketConnection(c *install.InstallConfig) (*mysql.Config, error
 	return conf, nil
 }
 
+// postgresDSNFromInstallConfig builds a PostgreSQL connection URL from the TCP parameters.
+// SSL is disabled for local servers, other hosts keep the driver default (require).
+func postgresDSNFromInstallConfig(c *install.InstallConfig) string {
+	u := &url.URL{
+		Scheme: "postgres",
+		Host:   net.JoinHostPort(c.GetDbTCPHostname(), c.GetDbTCPPort()),
+		Path:   "/" + c.GetDbTCPName(),
+	}
+	if c.GetDbTCPPassword() != "" {
+		u.User = url.UserPassword(c.GetDbTCPUser(), c.GetDbTCPPassword())
+	} else {
+		u.User = url.User(c.GetDbTCPUser())
+	}
+	switch c.GetDbTCPHostname() {
+	case "localhost", "127.0.0.1", "::1":
+		u.RawQuery = "sslmode=disable"
+	}
+	return u.String()
+}
+
+// isPostgresDSN detects connection strings meant for PostgreSQL, in URL or key=value form.
+func isPostgresDSN(dsn string) bool {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return true
+	}
+	return strings.Contains(dsn, "dbname=") && !strings.Contains(dsn, "@tcp(") && !strings.Contains(dsn, "@unix(")
+}
+
 func addDatabaseManualConnection(c *install.InstallConfig) (*mysql.Config, error) {
 	// DSN has already been validated - no need to check the error
 	conf, _ := mysql.ParseDSN(c.GetDbManualDSN())
@@ -132,7 +171,10 @@ func addDatabaseManualConnection(c *install.InstallConfig) (*mysql.Config, error
 	return conf, nil
 }
 
-func checkConnection(dsn string) error {
+func checkConnection(driver string, dsn string) error {
+	if driver == "postgres" {
+		return checkPostgresConnection(dsn)
+	}
 	for {
 		if db, err := sql.Open("mysql", dsn); err != nil {
 			return err
@@ -176,6 +218,18 @@ func checkConnection(dsn string) error {
 	return nil
 }
 
+// checkPostgresConnection opens the database, creating it if necessary
+func checkPostgresConnection(dsn string) error {
+	conn, err := dao.NewConn("postgres", dsn)
+	if err != nil {
+		return err
+	}
+	if db, ok := conn.(*sql.DB); ok {
+		db.Close()
+	}
+	return nil
+}
+
 func checkMysqlCharset(db *sql.DB) error {
 	// Here we check the version of mysql and the default charset
 	var version string
@@ -79,14 +79,14 @@ func PerformCheck(ctx context.Context, name string, c *install.InstallConfig) *i
 	switch name {
 	case "DB":
 		// Create DSN
-		dsn, e := dsnFromInstallConfig(c)
+		driver, dsn, e := dsnFromInstallConfig(c)
 		if e != nil {
 			result.Success = false
 			data, _ := json.Marshal(map[string]string{"error": e.Error()})
 			result.JsonResult = string(data)
 			break
 		}
-		if e := checkConnection(dsn); e != nil {
+		if e := checkConnection(driver, dsn); e != nil {
 			result.Success = false
 			data, _ := json.Marshal(map[string]string{"error": e.Error()})
 			result.JsonResult = string(data)
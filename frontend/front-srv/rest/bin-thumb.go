@@ -6,16 +6,27 @@ import (
 	"fmt"
 	"image"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"path"
+	"time"
 
 	"github.com/disintegration/imaging"
+	"github.com/emicklei/go-restful"
 	"go.uber.org/zap"
 	"golang.org/x/image/colornames"
 
 	"github.com/pmker/yux/common"
 	"github.com/pmker/yux/common/log"
 	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/service"
 	"github.com/pmker/yux/common/views"
+	"github.com/pmker/yux/scheduler/actions/images"
+)
+
+const (
+	// Previews are revalidated with their ETag once this delay has expired
+	thumbsCacheControl = "private, max-age=3600"
 )
 
 func readBinary(ctx context.Context, router *views.Router, node *tree.Node, output io.Writer, headers http.Header, extension string, resize ...int) error {
@@ -83,3 +94,55 @@ func readBinary(ctx context.Context, router *views.Router, node *tree.Node, outp
 
 	return nil
 }
+
+// serveThumbnail sends a preview generated by the thumbnails job, if the current user can read the original node.
+// The "size" query parameter selects the thumbnail size id (defaults to "sm"), it must be one of the sizes listed
+// in the node thumbnails metadata.
+func (a *FrontendHandler) serveThumbnail(ctx context.Context, req *restful.Request, rsp *restful.Response, nodeUuid string) {
+
+	size := req.QueryParameter("size")
+	if size == "" {
+		size = "sm"
+	}
+	userRouter := views.NewUuidRouter(views.RouterOptions{})
+	original, e := userRouter.ReadNode(ctx, &tree.ReadNodeRequest{Node: &tree.Node{Uuid: nodeUuid}})
+	if e != nil {
+		service.RestError404(req, rsp, e)
+		return
+	}
+	// Only serve the sizes generated for this node
+	thumbsMeta := &images.ThumbnailsMeta{}
+	if e := original.Node.GetMeta(images.MetadataThumbnails, thumbsMeta); e != nil || !thumbsMeta.HasSize(size) {
+		service.RestError404(req, rsp, fmt.Errorf("no preview available for this node"))
+		return
+	}
+
+	ctx = context.WithValue(ctx, common.PYDIO_CONTEXT_USER_KEY, common.PYDIO_SYSTEM_USERNAME)
+	router := views.NewStandardRouter(views.RouterOptions{AdminView: true})
+	thumbNode := &tree.Node{Path: images.ThumbnailPath(nodeUuid, size)}
+	thumb, e := router.ReadNode(ctx, &tree.ReadNodeRequest{Node: thumbNode})
+	if e != nil {
+		service.RestError404(req, rsp, fmt.Errorf("no preview available for this node"))
+		return
+	}
+	reader, e := router.GetObject(ctx, thumb.Node, &views.GetRequestData{Length: thumb.Node.Size})
+	if e != nil {
+		service.RestError500(req, rsp, e)
+		return
+	}
+	data, e := ioutil.ReadAll(reader)
+	reader.Close()
+	if e != nil {
+		service.RestError500(req, rsp, e)
+		return
+	}
+
+	headers := rsp.Header()
+	headers.Set("Content-Type", "image/jpeg")
+	headers.Set("Cache-Control", thumbsCacheControl)
+	if thumb.Node.Etag != "" {
+		headers.Set("ETag", `"`+thumb.Node.Etag+`"`)
+	}
+	// ServeContent answers conditional requests with a 304 Not Modified
+	http.ServeContent(rsp.ResponseWriter, req.Request, path.Base(thumbNode.Path), time.Unix(thumb.Node.MTime, 0), bytes.NewReader(data))
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/micro/go-micro/errors"
 	"github.com/micro/go-micro/metadata"
 	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/auth/mfa"
 	"github.com/pmker/yux/common/config"
 	"github.com/pmker/yux/common/log"
 	"github.com/pmker/yux/common/proto/rest"
@@ -35,9 +36,22 @@ func LoginPasswordAuth(middleware frontend.AuthMiddleware) frontend.AuthMiddlewa
 			return middleware(req, rsp, in, out, session)
 		}
 
+		ctx := req.Request.Context()
+		login := in.AuthInfo["login"]
 		nonce := uuid.New()
-		respMap, err := GrantTypeAccess(req.Request.Context(), nonce, "", in.AuthInfo["login"], in.AuthInfo["password"], false)
+		respMap, err := GrantTypeAccess(ctx, nonce, "", login, in.AuthInfo["password"], in.AuthInfo["otp"], false)
 		if err != nil {
+			// Password is valid but a second factor is required: ask for it
+			if parsed := errors.Parse(err.Error()); parsed != nil {
+				switch parsed.Id {
+				case mfa.ErrorOTPRequired:
+					out.Trigger = "mfa_otp"
+					out.TriggerInfo = map[string]string{"login": login}
+					return nil
+				case mfa.ErrorEnrollRequired:
+					return mfaEnrollTrigger(ctx, login, out, session)
+				}
+			}
 			return err
 		}
 		token := respMap["id_token"].(string)
@@ -52,6 +66,17 @@ func LoginPasswordAuth(middleware frontend.AuthMiddleware) frontend.AuthMiddlewa
 		out.JWT = token
 		out.ExpireTime = int32(expiry)
 
+		// Second factor was just enrolled at login: give recovery codes to the user
+		if enrolling, ok := session.Values["mfaEnroll"]; ok && enrolling == login {
+			delete(session.Values, "mfaEnroll")
+			if codes, e := mfaRecoveryCodes(ctx, login); e == nil {
+				out.Trigger = "mfa_recovery_codes"
+				out.TriggerInfo = map[string]string{"recoveryCodes": strings.Join(codes, ",")}
+			} else {
+				log.Logger(ctx).Error("could not generate recovery codes", zap.String(common.KEY_USERNAME, login), zap.Error(e))
+			}
+		}
+
 		return middleware(req, rsp, in, out, session)
 
 	}
@@ -68,7 +93,7 @@ func JwtFromSession(ctx context.Context, session *sessions.Session) (jwt string,
 		if refresh, refOk := session.Values["refresh_token"]; refOk && (expTime.Before(ref) || expTime.Equal(ref)) {
 			// Refresh token
 			log.Logger(ctx).Debug("Refreshing Token Now", zap.Any("refresh", refresh), zap.Any("nonce", session.Values["nonce"]), zap.Any("jwt", session.Values["jwt"]))
-			refreshResponse, err := GrantTypeAccess(ctx, session.Values["nonce"].(string), refresh.(string), "", "", false)
+			refreshResponse, err := GrantTypeAccess(ctx, session.Values["nonce"].(string), refresh.(string), "", "", "", false)
 			if err != nil {
 				// Refresh_token is invalid: clear session
 				e = err
@@ -94,7 +119,7 @@ func JwtFromSession(ctx context.Context, session *sessions.Session) (jwt string,
 	return
 }
 
-func GrantTypeAccess(ctx context.Context, nonce string, refreshToken string, login string, pwd string, retry502 bool) (map[string]interface{}, error) {
+func GrantTypeAccess(ctx context.Context, nonce string, refreshToken string, login string, pwd string, otp string, retry502 bool) (map[string]interface{}, error) {
 
 	dexUrl := config.Get("defaults", "url").String("")
 	fullURL := dexUrl + "/auth/dex/token"
@@ -103,12 +128,12 @@ func GrantTypeAccess(ctx context.Context, nonce string, refreshToken string, log
 	if refreshToken != "" {
 		data.Set("grant_type", "refresh_token")
 		data.Add("refresh_token", refreshToken)
-		data.Add("scope", "email profile pydio")
+		data.Add("scope", "email profile pydio groups")
 	} else {
 		data.Set("grant_type", "password")
 		data.Add("username", login)
 		data.Add("password", pwd)
-		data.Add("scope", "email profile pydio offline_access")
+		data.Add("scope", "email profile pydio groups offline_access")
 	}
 	data.Add("nonce", nonce)
 
@@ -147,6 +172,10 @@ func GrantTypeAccess(ctx context.Context, nonce string, refreshToken string, log
 		}
 	}
 
+	if otp != "" {
+		httpReq.Header.Add(mfa.OTPHeader, otp)
+	}
+
 	httpReq.Header.Add("Content-Type", "application/x-www-form-urlencoded") // Important our dex API does not yet support json payload.
 	httpReq.Header.Add("Cache-Control", "no-cache")
 	httpReq.Header.Add("Authorization", basic)
@@ -168,7 +197,7 @@ func GrantTypeAccess(ctx context.Context, nonce string, refreshToken string, log
 		if res.StatusCode == 502 && !retry502 {
 			log.Logger(ctx).Error("Got a 502 when contacting gateway - maybe it is currently restarting, wait for 11s and retry once")
 			<-time.After(11 * time.Second)
-			return GrantTypeAccess(ctx, nonce, refreshToken, login, pwd, true)
+			return GrantTypeAccess(ctx, nonce, refreshToken, login, pwd, otp, true)
 		}
 		return nil, fmt.Errorf("could not unmarshall response with status %d: %s\nerror cause: %s", res.StatusCode, res.Status, err.Error())
 	}
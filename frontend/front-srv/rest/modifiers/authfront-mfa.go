@@ -0,0 +1,165 @@
+package modifiers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/gorilla/sessions"
+	"github.com/micro/go-micro/errors"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/auth/claim"
+	"github.com/pmker/yux/common/auth/mfa"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/proto/idm"
+	"github.com/pmker/yux/common/proto/rest"
+	"github.com/pmker/yux/common/service"
+)
+
+// TotpEnroll handles the FrontEnrollAuth requests of type "totp", used by logged users to manage
+// their second authentication factor. EnrollInfo["step"] is one of:
+//   - "status": tells if a second factor is enrolled and if it is enforced
+//   - "setup": generates a new secret, returned with its otpauth:// URI. A valid "code" is required
+//     if a second factor is already enrolled
+//   - "confirm": activates the secret with a first "code", and returns new recovery codes
+//   - "recovery": replaces the recovery codes, given a valid "code"
+//   - "disable": removes the second factor given a valid "code", unless it is enforced
+//   - "reset": for admins only, removes the second factor of the user passed in "login"
+func TotpEnroll(req *restful.Request, rsp *restful.Response, in *rest.FrontEnrollAuthRequest) bool {
+
+	if in.EnrollType != "totp" {
+		return false
+	}
+
+	ctx := req.Request.Context()
+	claims, ok := ctx.Value(claim.ContextKey).(claim.Claims)
+	if !ok || claims.Name == "" {
+		service.RestError401(req, rsp, fmt.Errorf("you must be logged in to manage a second factor"))
+		return true
+	}
+	step := in.EnrollInfo["step"]
+	code := in.EnrollInfo["code"]
+	login := claims.Name
+	if step == "reset" {
+		if claims.Profile != common.PYDIO_PROFILE_ADMIN {
+			service.RestError403(req, rsp, fmt.Errorf("only administrators can reset a second factor"))
+			return true
+		}
+		login = in.EnrollInfo["login"]
+	}
+
+	info := make(map[string]string)
+	now := time.Now()
+	invalid := errors.Forbidden(common.SERVICE_AUTH, "invalid one-time password")
+
+	user, e := mfa.Update(ctx, login, func(user *idm.User, state *mfa.State) (bool, error) {
+		switch step {
+		case "status":
+			info["enrolled"] = strconv.FormatBool(state.Enrolled())
+			info["enforced"] = strconv.FormatBool(mfa.IsEnforced(user))
+			info["recoveryCodes"] = strconv.Itoa(len(state.Recovery))
+			return false, nil
+		case "setup":
+			if state.Enrolled() {
+				if valid, _ := state.Verify(code, now); !valid {
+					return false, invalid
+				}
+			}
+			secret, e := state.Setup()
+			if e != nil {
+				return false, e
+			}
+			info["secret"] = secret
+			info["uri"] = mfa.ProvisioningURI(mfa.Issuer(), user.Login, secret)
+		case "confirm":
+			if !state.Confirm(code, now) {
+				return false, invalid
+			}
+			codes, e := state.NewRecoveryCodes()
+			if e != nil {
+				return false, e
+			}
+			info["recoveryCodes"] = strings.Join(codes, ",")
+		case "recovery":
+			if valid, _ := state.Verify(code, now); !valid {
+				return false, invalid
+			}
+			codes, e := state.NewRecoveryCodes()
+			if e != nil {
+				return false, e
+			}
+			info["recoveryCodes"] = strings.Join(codes, ",")
+		case "disable":
+			if mfa.IsEnforced(user) {
+				return false, errors.Forbidden(common.SERVICE_AUTH, "a second factor is required for your account")
+			}
+			if valid, _ := state.Verify(code, now); !valid {
+				return false, invalid
+			}
+			state.Reset()
+		case "reset":
+			state.Reset()
+		default:
+			return false, fmt.Errorf("unknown enrollment step %s", step)
+		}
+		return true, nil
+	})
+	if e != nil {
+		service.RestErrorDetect(req, rsp, e)
+		return true
+	}
+	if step != "status" && step != "setup" {
+		log.Auditer(ctx).Info(
+			fmt.Sprintf("Second factor of user [%s] updated (%s)", user.Login, step),
+			log.GetAuditId(common.AUDIT_USER_UPDATE),
+			user.ZapLogin(),
+			zap.String(common.KEY_USER_UUID, user.Uuid),
+		)
+	}
+	rsp.WriteEntity(&rest.FrontEnrollAuthResponse{Info: info})
+	return true
+}
+
+// mfaEnrollTrigger is called when the password of a user was accepted, but the user must enroll a
+// second factor before logging in. A new secret is set up and sent back to the client, that must
+// log in again with a first code.
+func mfaEnrollTrigger(ctx context.Context, login string, out *rest.FrontSessionResponse, session *sessions.Session) error {
+	var secret string
+	if _, e := mfa.Update(ctx, login, func(user *idm.User, state *mfa.State) (bool, error) {
+		var e error
+		secret, e = state.Setup()
+		return e == nil, e
+	}); e != nil {
+		return e
+	}
+	session.Values["mfaEnroll"] = login
+	out.Trigger = "mfa_enroll"
+	out.TriggerInfo = map[string]string{
+		"login":  login,
+		"secret": secret,
+		"uri":    mfa.ProvisioningURI(mfa.Issuer(), login, secret),
+	}
+	return nil
+}
+
+// mfaRecoveryCodes generates the first recovery codes of a user who just enrolled at login.
+func mfaRecoveryCodes(ctx context.Context, login string) ([]string, error) {
+	var codes []string
+	_, e := mfa.Update(ctx, login, func(user *idm.User, state *mfa.State) (bool, error) {
+		if !state.Enrolled() {
+			return false, fmt.Errorf("no second factor enrolled")
+		}
+		var e error
+		codes, e = state.NewRecoveryCodes()
+		return e == nil, e
+	})
+	if e != nil {
+		return nil, e
+	}
+	return codes, nil
+}
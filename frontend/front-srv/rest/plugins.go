@@ -87,6 +87,7 @@ func init() {
 		frontend.RegisterRegModifier(modifiers.MetaUserRegModifier)
 		frontend.RegisterPluginModifier(modifiers.MobileRegModifier)
 		frontend.WrapAuthMiddleware(modifiers.LoginPasswordAuth)
+		frontend.RegisterEnrollMiddleware("FrontEnrollAuth", modifiers.TotpEnroll)
 
 		s := service.NewService(
 			service.Name(common.SERVICE_REST_NAMESPACE_+common.SERVICE_FRONTEND),
@@ -267,6 +267,11 @@ func (a *FrontendHandler) FrontServeBinary(req *restful.Request, rsp *restful.Re
 			}
 			extension = strings.Split(avatarId, ".")[1]
 		}
+	} else if binaryType == "THUMB" {
+
+		a.serveThumbnail(ctxWithoutCookies(ctx), req, rsp, binaryUuid)
+		return
+
 	} else if binaryType == "GLOBAL" {
 
 		readNode = &tree.Node{
@@ -57,6 +57,12 @@ func (h *PublicHandler) computeTplConf(ctx context.Context, linkId string) (stat
 		return 404, tplConf
 	}
 
+	// Check activation time
+	if linkData.StartTime > 0 && time.Now().Before(time.Unix(linkData.StartTime, 0)) {
+		tplConf.ErrorMessage = "This link is not active yet. Please contact the person who sent it to you."
+		return 404, tplConf
+	}
+
 	// Check expiration time
 	if linkData.ExpireTime > 0 && time.Now().After(time.Unix(linkData.ExpireTime, 0)) {
 		tplConf.ErrorMessage = "This link has expired. Please contact the person who sent it to you."
@@ -59,11 +59,12 @@ func newHandler(ctx context.Context) http.Handler {
 		Debug:  true,
 		mu:     sync.Mutex{},
 	}
+	ls := &LockSystem{FileSystem: fs}
 
 	dav := &webdav.Handler{
 		FileSystem: fs,
 		Prefix:     "/dav",
-		LockSystem: webdav.NewMemLS(),
+		LockSystem: ls,
 		Logger: func(r *http.Request, err error) {
 			switch r.Method {
 			case "COPY", "MOVE": // add relevant destination param when loggin an error
@@ -86,5 +87,14 @@ func newHandler(ctx context.Context) http.Handler {
 		},
 	}
 
-	return basicAuthenticator.Wrap(logRequest(dav))
+	return basicAuthenticator.Wrap(logRequest(withRequestLocks(dav, ls)))
+}
+
+// withRequestLocks serves each request with a copy of the webdav handler whose LockSystem is bound to the request context.
+func withRequestLocks(dav *webdav.Handler, ls *LockSystem) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := *dav
+		h.LockSystem = ls.ForRequest(r)
+		h.ServeHTTP(w, r)
+	})
 }
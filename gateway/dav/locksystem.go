@@ -0,0 +1,289 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package dav
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pborman/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/net/webdav"
+
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/utils"
+)
+
+const (
+	lockTokenPrefix = "opaquelocktoken:"
+	// Owner XML is only echoed back to clients, do not store it if it is too long for the ACL value
+	maxOwnerXMLLength = 255
+)
+
+// LockSystem is the pydio specific implementation of the generic webdav.LockSystem interface.
+// Locks are stored in the ACL service as content locks, so that they survive restarts, are shared
+// between gateway instances and are enforced by the views.AclLockFilter as well. As the webdav
+// interface does not carry any context, a LockSystem must be bound to the current request using ForRequest.
+//
+// A lock applies to the locked node and, unless it is zero-depth, to all its descendants. Locks held by
+// descendants are not checked when creating an infinite-depth lock on a folder.
+type LockSystem struct {
+	FileSystem *FileSystem
+
+	ctx    context.Context
+	method string
+}
+
+// ForRequest returns a copy of this LockSystem bound to the request context.
+func (l *LockSystem) ForRequest(r *http.Request) webdav.LockSystem {
+	return &LockSystem{
+		FileSystem: l.FileSystem,
+		ctx:        r.Context(),
+		method:     r.Method,
+	}
+}
+
+// Confirm checks that the named resources are covered by a lock of the current user matching one of the conditions.
+func (l *LockSystem) Confirm(now time.Time, name0, name1 string, conditions ...webdav.Condition) (func(), error) {
+	userName, _ := utils.FindUserNameInContext(l.ctx)
+	for _, name := range []string{name0, name1} {
+		if name == "" {
+			continue
+		}
+		_, locks, err := l.coveringLocks(now, name)
+		if err != nil {
+			return nil, err
+		}
+		confirmed := false
+		for _, lock := range locks {
+			if lock.Owner != userName {
+				return nil, webdav.ErrConfirmationFailed
+			}
+			if lock.Info != nil && matchLockToken(lock.Info.Token, conditions) {
+				confirmed = true
+			}
+		}
+		if !confirmed {
+			return nil, webdav.ErrConfirmationFailed
+		}
+	}
+	return func() {}, nil
+}
+
+// Create registers a new lock on the resource. The webdav handler also calls Create with a temporary
+// lock before any write operation sent without lock token: in that case, we only check that the resource
+// is not locked by another user and nothing is stored.
+func (l *LockSystem) Create(now time.Time, details webdav.LockDetails) (string, error) {
+	userName, _ := utils.FindUserNameInContext(l.ctx)
+	if userName == "" {
+		return "", webdav.ErrForbidden
+	}
+	nodeUuid, locks, err := l.coveringLocks(now, details.Root)
+	if err != nil {
+		return "", err
+	}
+
+	if l.method != "LOCK" {
+		for _, lock := range locks {
+			if lock.Owner != userName {
+				return "", webdav.ErrLocked
+			}
+		}
+		return "", nil
+	}
+
+	var existing *utils.ContentLock
+	for _, lock := range locks {
+		if lock.NodeUuid == nodeUuid && lock.Info == nil && lock.Owner == userName {
+			// Lock set by the same user from another client, attach the webdav details to it
+			existing = lock
+			continue
+		}
+		return "", webdav.ErrLocked
+	}
+
+	if nodeUuid == "" {
+		// Locking an unmapped URL creates an empty resource: do it now to get a node Uuid
+		f, e := l.FileSystem.OpenFile(l.ctx, details.Root, os.O_RDWR|os.O_CREATE, 0666)
+		if e != nil {
+			return "", e
+		}
+		f.Close()
+		nodeUuid = f.(*File).node.Uuid
+	}
+
+	info := &utils.ContentLockInfo{
+		Source:    "webdav",
+		Token:     newLockToken(nodeUuid),
+		Root:      details.Root,
+		ZeroDepth: details.ZeroDepth,
+	}
+	if len(details.OwnerXML) <= maxOwnerXMLLength {
+		info.OwnerXML = details.OwnerXML
+	}
+	if details.Duration >= 0 {
+		info.Expiry = now.Add(details.Duration).Unix()
+	}
+	lock := &utils.ContentLock{NodeUuid: nodeUuid, Owner: userName, Info: info}
+
+	if existing != nil {
+		err = utils.UpdateContentLockInfo(l.ctx, lock)
+	} else if err = utils.CreateContentLock(l.ctx, lock); err != nil {
+		// Lock may have been created concurrently by another client
+		if current, e := utils.LoadContentLocks(l.ctx, nodeUuid); e == nil && current[nodeUuid] != nil {
+			return "", webdav.ErrLocked
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	log.Logger(l.ctx).Debug("LockSystem.Create", zap.String("root", details.Root), zap.String("node", nodeUuid), zap.Int64("expiry", info.Expiry))
+	return info.Token, nil
+}
+
+// Refresh pushes the expiry of an existing lock.
+func (l *LockSystem) Refresh(now time.Time, token string, duration time.Duration) (webdav.LockDetails, error) {
+	lock, err := l.lockForToken(now, token)
+	if err != nil {
+		return webdav.LockDetails{}, err
+	}
+	if duration >= 0 {
+		lock.Info.Expiry = now.Add(duration).Unix()
+	} else {
+		lock.Info.Expiry = 0
+	}
+	if e := utils.UpdateContentLockInfo(l.ctx, lock); e != nil {
+		return webdav.LockDetails{}, e
+	}
+	return webdav.LockDetails{
+		Root:      lock.Info.Root,
+		Duration:  duration,
+		OwnerXML:  lock.Info.OwnerXML,
+		ZeroDepth: lock.Info.ZeroDepth,
+	}, nil
+}
+
+// Unlock removes the lock identified by its token.
+func (l *LockSystem) Unlock(now time.Time, token string) error {
+	lock, err := l.lockForToken(now, token)
+	if err != nil {
+		return err
+	}
+	return utils.DeleteContentLock(l.ctx, lock.NodeUuid)
+}
+
+// lockForToken loads the active lock identified by this token and checks that it is owned by the current user.
+func (l *LockSystem) lockForToken(now time.Time, token string) (*utils.ContentLock, error) {
+	nodeUuid, ok := nodeUuidFromLockToken(token)
+	if !ok {
+		return nil, webdav.ErrNoSuchLock
+	}
+	locks, err := utils.LoadContentLocks(l.ctx, nodeUuid)
+	if err != nil {
+		return nil, err
+	}
+	lock, ok := locks[nodeUuid]
+	if !ok || lock.Info == nil || lock.Info.Token != token {
+		return nil, webdav.ErrNoSuchLock
+	}
+	if lock.Expired(now) {
+		utils.DeleteContentLock(l.ctx, nodeUuid)
+		return nil, webdav.ErrNoSuchLock
+	}
+	if userName, _ := utils.FindUserNameInContext(l.ctx); lock.Owner != userName {
+		return nil, webdav.ErrForbidden
+	}
+	return lock, nil
+}
+
+// coveringLocks finds the Uuid of the named resource (empty if it does not exist) and the active locks applying
+// to it: a lock on the resource itself or an infinite-depth lock on one of its parents. Expired locks are cleared.
+func (l *LockSystem) coveringLocks(now time.Time, name string) (string, []*utils.ContentLock, error) {
+	name, err := clearName(name)
+	if err != nil {
+		return "", nil, err
+	}
+	var nodeUuid string
+	var uuids []string
+	if resp, e := l.FileSystem.Router.ReadNode(l.ctx, &tree.ReadNodeRequest{Node: &tree.Node{Path: name}}); e == nil {
+		nodeUuid = resp.Node.Uuid
+		uuids = append(uuids, nodeUuid)
+	}
+	for _, p := range lockParents(name) {
+		if resp, e := l.FileSystem.Router.ReadNode(l.ctx, &tree.ReadNodeRequest{Node: &tree.Node{Path: p}}); e == nil {
+			uuids = append(uuids, resp.Node.Uuid)
+		}
+	}
+	locks, err := utils.LoadContentLocks(l.ctx, uuids...)
+	if err != nil {
+		return "", nil, err
+	}
+	var covering []*utils.ContentLock
+	for id, lock := range locks {
+		if lock.Expired(now) {
+			utils.DeleteContentLock(l.ctx, id)
+			continue
+		}
+		if id == nodeUuid || (lock.Info != nil && !lock.Info.ZeroDepth) {
+			covering = append(covering, lock)
+		}
+	}
+	return nodeUuid, covering, nil
+}
+
+// lockParents lists the parent paths of a resource, excluding the root.
+func lockParents(name string) (parents []string) {
+	for p := path.Dir(strings.TrimSuffix(name, "/")); p != "/" && p != "."; p = path.Dir(p) {
+		parents = append(parents, p)
+	}
+	return
+}
+
+// newLockToken generates a token referencing the locked node, so that a lock can be found from its token only.
+func newLockToken(nodeUuid string) string {
+	return lockTokenPrefix + nodeUuid + "/" + uuid.New()
+}
+
+func nodeUuidFromLockToken(token string) (string, bool) {
+	if !strings.HasPrefix(token, lockTokenPrefix) {
+		return "", false
+	}
+	t := strings.TrimPrefix(token, lockTokenPrefix)
+	i := strings.LastIndex(t, "/")
+	if i <= 0 || i == len(t)-1 {
+		return "", false
+	}
+	return t[:i], true
+}
+
+func matchLockToken(token string, conditions []webdav.Condition) bool {
+	for _, c := range conditions {
+		if !c.Not && c.Token != "" && c.Token == token {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package dav
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/webdav"
+)
+
+func TestLockTokens(t *testing.T) {
+
+	Convey("Lock tokens reference the locked node", t, func() {
+		token := newLockToken("node-uuid")
+		So(strings.HasPrefix(token, "opaquelocktoken:node-uuid/"), ShouldBeTrue)
+
+		nodeUuid, ok := nodeUuidFromLockToken(token)
+		So(ok, ShouldBeTrue)
+		So(nodeUuid, ShouldEqual, "node-uuid")
+
+		_, ok = nodeUuidFromLockToken("opaquelocktoken:node-uuid")
+		So(ok, ShouldBeFalse)
+		_, ok = nodeUuidFromLockToken("opaquelocktoken:node-uuid/")
+		So(ok, ShouldBeFalse)
+		_, ok = nodeUuidFromLockToken("12345")
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Match conditions", t, func() {
+		token := newLockToken("node-uuid")
+		So(matchLockToken(token, nil), ShouldBeFalse)
+		So(matchLockToken(token, []webdav.Condition{{ETag: `"etag"`}, {Token: token}}), ShouldBeTrue)
+		So(matchLockToken(token, []webdav.Condition{{Not: true, Token: token}}), ShouldBeFalse)
+		So(matchLockToken(token, []webdav.Condition{{Token: newLockToken("node-uuid")}}), ShouldBeFalse)
+	})
+
+	Convey("List parents", t, func() {
+		So(lockParents("/ws/folder/file.txt"), ShouldResemble, []string{"/ws/folder", "/ws"})
+		So(lockParents("/ws/folder/"), ShouldResemble, []string{"/ws"})
+		So(lockParents("/ws"), ShouldBeEmpty)
+	})
+
+}
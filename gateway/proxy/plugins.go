@@ -48,47 +48,68 @@ import (
 )
 
 var (
+	// The X-Pydio-Front-Client header is removed from incoming requests, as it would
+	// otherwise reach the services from this proxy, which is a trusted peer.
 	caddyfile = `
 		{{.Bind}} {
 		proxy /a  {{.Micro | urls}} {
+			header_upstream -X-Pydio-Front-Client
 			without /a
 			transparent
 		}
 		proxy /auth/dex {{.Dex | urls}} {
+			header_upstream -X-Pydio-Front-Client
 			transparent
 			insecure_skip_verify
 		}
 		proxy /io   {{.Gateway | serviceAddress}} {
+			header_upstream -X-Pydio-Front-Client
 			transparent
 		}
 		proxy /data {{.Gateway | serviceAddress}} {
+			header_upstream -X-Pydio-Front-Client
 			transparent
 		}
 		proxy /ws   {{.WebSocket | urls}} {
+			header_upstream -X-Pydio-Front-Client
 			websocket
 			without /ws
 		}
 		proxy /plug/ {{.FrontPlugins | urls}} {
+			header_upstream -X-Pydio-Front-Client
 			transparent
 			header_downstream Cache-Control "public, max-age=31536000"
 		}
 		proxy /dav/ {{.DAV | urls}} {
+			header_upstream -X-Pydio-Front-Client
+			transparent
+		}
+		proxy /s3/ {{.S3 | urls}} {
+			header_upstream -X-Pydio-Front-Client
+			transparent
+		}
+		proxy /tus/ {{.TUS | urls}} {
+			header_upstream -X-Pydio-Front-Client
 			transparent
 		}
 
 		proxy /public/ {{.FrontPlugins | urls}} {
+			header_upstream -X-Pydio-Front-Client
 			transparent
 		}
 
 		proxy /user/reset-password/ {{.FrontPlugins | urls}} {
+			header_upstream -X-Pydio-Front-Client
 			transparent
 		}
 
 		proxy /robots.txt {{.FrontPlugins | urls}} {
+			header_upstream -X-Pydio-Front-Client
 			transparent
 		}
 
 		proxy /login {{urls .FrontPlugins "/gui"}} {
+			header_upstream -X-Pydio-Front-Client
 			transparent
 			without /login
 		}
@@ -110,6 +131,8 @@ var (
 			if {path} not_starts_with "/ws/"
 			if {path} not_starts_with "/plug/"
 			if {path} not_starts_with "/dav/"
+			if {path} not_starts_with "/s3/"
+			if {path} not_starts_with "/tus/"
 			{{range .PluginPathes}}
 			if {path} not_starts_with "{{.}}"
 			{{end}}
@@ -139,6 +162,8 @@ var (
 		WebSocket    string
 		FrontPlugins string
 		DAV          string
+		S3           string
+		TUS          string
 		// Dedicated log file for caddy errors to ease debugging
 		Logs string
 		// Caddy compliant TLS string, either "self_signed" or paths to "cert key"
@@ -156,6 +181,8 @@ var (
 		WebSocket:    common.SERVICE_GATEWAY_NAMESPACE_ + common.SERVICE_WEBSOCKET,
 		FrontPlugins: common.SERVICE_WEB_NAMESPACE_ + common.SERVICE_FRONT_STATICS,
 		DAV:          common.SERVICE_GATEWAY_DAV,
+		S3:           common.SERVICE_GATEWAY_S3,
+		TUS:          common.SERVICE_GATEWAY_TUS,
 	}
 )
 
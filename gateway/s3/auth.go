@@ -0,0 +1,420 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	signV4Algorithm      = "AWS4-HMAC-SHA256"
+	signV4ChunkAlgorithm = "AWS4-HMAC-SHA256-PAYLOAD"
+	unsignedPayload      = "UNSIGNED-PAYLOAD"
+	streamingPayload     = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	iso8601Format        = "20060102T150405Z"
+	scopeDateFormat      = "20060102"
+	emptySHA256          = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	maxClockSkew     = 15 * time.Minute
+	maxPresignExpiry = 7 * 24 * time.Hour
+	maxChunkSize     = 16 * 1024 * 1024
+)
+
+// signature holds the AWS Signature Version 4 elements sent with a request, either in
+// the Authorization header or in the query string of a presigned URL.
+type signature struct {
+	AccessKey     string
+	ScopeDate     string
+	Region        string
+	Service       string
+	SignedHeaders []string
+	Signature     string
+	AmzDate       time.Time
+	Presigned     bool
+	Expires       time.Duration
+	PayloadHash   string
+}
+
+// parseSignature extracts the signature elements from the request. Only V4 signatures are supported.
+func parseSignature(r *http.Request) (*signature, *apiError) {
+
+	authHeader := r.Header.Get("Authorization")
+	query := r.URL.Query()
+
+	if strings.HasPrefix(authHeader, signV4Algorithm) {
+		return parseHeaderSignature(r, strings.TrimPrefix(authHeader, signV4Algorithm))
+	} else if query.Get("X-Amz-Algorithm") == signV4Algorithm {
+		return parsePresignedSignature(query)
+	} else if strings.HasPrefix(authHeader, "AWS ") || query.Get("AWSAccessKeyId") != "" {
+		return nil, errSignatureVersionNotSupported
+	}
+	return nil, errMissingAuth
+
+}
+
+func parseHeaderSignature(r *http.Request, value string) (*signature, *apiError) {
+
+	s := &signature{}
+	for _, part := range strings.Split(value, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, errAuthorizationHeaderMalformed
+		}
+		switch kv[0] {
+		case "Credential":
+			if e := s.parseCredential(kv[1]); e != nil {
+				return nil, e
+			}
+		case "SignedHeaders":
+			s.SignedHeaders = strings.Split(kv[1], ";")
+		case "Signature":
+			s.Signature = kv[1]
+		}
+	}
+	if s.AccessKey == "" || len(s.SignedHeaders) == 0 || s.Signature == "" {
+		return nil, errAuthorizationHeaderMalformed
+	}
+
+	if d := r.Header.Get("X-Amz-Date"); d != "" {
+		t, e := time.Parse(iso8601Format, d)
+		if e != nil {
+			return nil, errMalformedDate
+		}
+		s.AmzDate = t
+	} else if d := r.Header.Get("Date"); d != "" {
+		t, e := http.ParseTime(d)
+		if e != nil {
+			return nil, errMalformedDate
+		}
+		s.AmzDate = t.UTC()
+	} else {
+		return nil, errMissingDate
+	}
+
+	s.PayloadHash = r.Header.Get("X-Amz-Content-Sha256")
+	if s.PayloadHash == "" {
+		return nil, errMissingContentSHA256
+	}
+	return s, nil
+
+}
+
+func parsePresignedSignature(query url.Values) (*signature, *apiError) {
+
+	s := &signature{Presigned: true}
+	if e := s.parseCredential(query.Get("X-Amz-Credential")); e != nil {
+		return nil, e
+	}
+	t, e := time.Parse(iso8601Format, query.Get("X-Amz-Date"))
+	if e != nil {
+		return nil, errMalformedDate
+	}
+	s.AmzDate = t
+	expires, e := strconv.ParseInt(query.Get("X-Amz-Expires"), 10, 64)
+	if e != nil || expires < 0 || time.Duration(expires)*time.Second > maxPresignExpiry {
+		return nil, errMalformedExpires
+	}
+	s.Expires = time.Duration(expires) * time.Second
+	if sh := query.Get("X-Amz-SignedHeaders"); sh != "" {
+		s.SignedHeaders = strings.Split(sh, ";")
+	}
+	s.Signature = query.Get("X-Amz-Signature")
+	if len(s.SignedHeaders) == 0 || s.Signature == "" {
+		return nil, errAuthorizationQueryMalformed
+	}
+	s.PayloadHash = unsignedPayload
+	if h := query.Get("X-Amz-Content-Sha256"); h != "" {
+		s.PayloadHash = h
+	}
+	return s, nil
+
+}
+
+// parseCredential reads a credential string in the form AccessKey/Date/Region/Service/aws4_request.
+func (s *signature) parseCredential(value string) *apiError {
+	parts := strings.Split(value, "/")
+	if len(parts) != 5 || parts[0] == "" || parts[4] != "aws4_request" {
+		return errCredentialMalformed
+	}
+	if parts[3] != "s3" {
+		return errInvalidService
+	}
+	s.AccessKey, s.ScopeDate, s.Region, s.Service = parts[0], parts[1], parts[2], parts[3]
+	return nil
+}
+
+func (s *signature) scope() string {
+	return strings.Join([]string{s.ScopeDate, s.Region, s.Service, "aws4_request"}, "/")
+}
+
+// verify checks the request date and recomputes the signature with the given secret.
+func (s *signature) verify(r *http.Request, secret string, now time.Time) *apiError {
+
+	if s.Presigned {
+		if now.Before(s.AmzDate.Add(-maxClockSkew)) {
+			return errRequestNotReadyYet
+		}
+		if now.After(s.AmzDate.Add(s.Expires)) {
+			return errExpiredPresignRequest
+		}
+	} else if now.Sub(s.AmzDate) > maxClockSkew || s.AmzDate.Sub(now) > maxClockSkew {
+		return errRequestTimeTooSkewed
+	}
+	if s.AmzDate.Format(scopeDateFormat) != s.ScopeDate {
+		return errCredentialMalformed
+	}
+	var hasHost bool
+	for _, h := range s.SignedHeaders {
+		if h == "host" {
+			hasHost = true
+			break
+		}
+	}
+	if !hasHost {
+		return errUnsignedHeaders
+	}
+
+	expected := s.compute(r, secret)
+	if !hmac.Equal([]byte(expected), []byte(s.Signature)) {
+		return errSignatureDoesNotMatch
+	}
+	return nil
+
+}
+
+// compute builds the canonical request and signs it with the secret.
+func (s *signature) compute(r *http.Request, secret string) string {
+
+	canonical := strings.Join([]string{
+		r.Method,
+		uriEncode(r.URL.Path, false),
+		canonicalQuery(r.URL.Query(), s.Presigned),
+		canonicalHeaders(r, s.SignedHeaders),
+		strings.Join(s.SignedHeaders, ";"),
+		s.PayloadHash,
+	}, "\n")
+	hashed := sha256.Sum256([]byte(canonical))
+	stringToSign := strings.Join([]string{
+		signV4Algorithm,
+		s.AmzDate.Format(iso8601Format),
+		s.scope(),
+		hex.EncodeToString(hashed[:]),
+	}, "\n")
+
+	return hex.EncodeToString(hmacSHA256(s.signingKey(secret), stringToSign))
+
+}
+
+func (s *signature) signingKey(secret string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), s.ScopeDate)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, s.Service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode encodes a string the way AWS expects it in canonical requests: all bytes except
+// unreserved characters are percent-encoded, slashes being kept for paths.
+func uriEncode(value string, encodeSlash bool) string {
+	if value == "" {
+		if !encodeSlash {
+			return "/"
+		}
+		return ""
+	}
+	buf := &bytes.Buffer{}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			buf.WriteByte(c)
+		} else {
+			buf.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{c})))
+		}
+	}
+	return buf.String()
+}
+
+func canonicalQuery(query url.Values, presigned bool) string {
+	var keys []string
+	for k := range query {
+		if presigned && k == "X-Amz-Signature" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func canonicalHeaders(r *http.Request, signedHeaders []string) string {
+	buf := &bytes.Buffer{}
+	for _, name := range signedHeaders {
+		var values []string
+		switch name {
+		case "host":
+			values = []string{r.Host}
+		case "content-length":
+			if values = r.Header["Content-Length"]; len(values) == 0 {
+				values = []string{strconv.FormatInt(r.ContentLength, 10)}
+			}
+		case "transfer-encoding":
+			values = r.TransferEncoding
+		default:
+			values = r.Header[http.CanonicalHeaderKey(name)]
+		}
+		trimmed := make([]string, len(values))
+		for i, v := range values {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		buf.WriteString(name + ":" + strings.Join(trimmed, ",") + "\n")
+	}
+	return buf.String()
+}
+
+// payloadReader checks that the body matches the hash signed by the client once it is fully read.
+type payloadReader struct {
+	io.ReadCloser
+	hash     hash.Hash
+	expected string
+}
+
+func newPayloadReader(body io.ReadCloser, expected string) *payloadReader {
+	return &payloadReader{ReadCloser: body, hash: sha256.New(), expected: expected}
+}
+
+func (p *payloadReader) Read(b []byte) (int, error) {
+	n, err := p.ReadCloser.Read(b)
+	p.hash.Write(b[:n])
+	if err == io.EOF && hex.EncodeToString(p.hash.Sum(nil)) != p.expected {
+		return n, errContentSHA256Mismatch
+	}
+	return n, err
+}
+
+// chunkedReader decodes a body sent with the "aws-chunked" content encoding, checking
+// the signature of each chunk against the previous one, starting with the request signature.
+type chunkedReader struct {
+	io.Closer
+	reader   *bufio.Reader
+	key      []byte
+	date     string
+	scope    string
+	previous string
+	chunk    []byte
+	done     bool
+}
+
+func newChunkedReader(body io.ReadCloser, s *signature, secret string) *chunkedReader {
+	return &chunkedReader{
+		Closer:   body,
+		reader:   bufio.NewReader(body),
+		key:      s.signingKey(secret),
+		date:     s.AmzDate.Format(iso8601Format),
+		scope:    s.scope(),
+		previous: s.Signature,
+	}
+}
+
+func (c *chunkedReader) Read(b []byte) (int, error) {
+	for len(c.chunk) == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		if e := c.readChunk(); e != nil {
+			return 0, e
+		}
+	}
+	n := copy(b, c.chunk)
+	c.chunk = c.chunk[n:]
+	return n, nil
+}
+
+func (c *chunkedReader) readChunk() error {
+
+	header, e := c.reader.ReadString('\n')
+	if e != nil {
+		return errIncompleteBody
+	}
+	header = strings.TrimRight(header, "\r\n")
+	parts := strings.SplitN(header, ";", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[1], "chunk-signature=") {
+		return errMalformedChunk
+	}
+	size, e := strconv.ParseInt(parts[0], 16, 64)
+	if e != nil || size < 0 || size > maxChunkSize {
+		return errMalformedChunk
+	}
+	chunkSignature := strings.TrimPrefix(parts[1], "chunk-signature=")
+
+	data := make([]byte, size)
+	if _, e := io.ReadFull(c.reader, data); e != nil {
+		return errIncompleteBody
+	}
+	if crlf, e := c.reader.ReadString('\n'); e != nil && size > 0 || e == nil && crlf != "\r\n" {
+		return errMalformedChunk
+	}
+
+	hashed := sha256.Sum256(data)
+	stringToSign := strings.Join([]string{
+		signV4ChunkAlgorithm,
+		c.date,
+		c.scope,
+		c.previous,
+		emptySHA256,
+		hex.EncodeToString(hashed[:]),
+	}, "\n")
+	expected := hex.EncodeToString(hmacSHA256(c.key, stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(chunkSignature)) {
+		return errSignatureDoesNotMatch
+	}
+	c.previous = chunkSignature
+	c.chunk = data
+	if size == 0 {
+		c.done = true
+	}
+	return nil
+
+}
@@ -0,0 +1,302 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package s3
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/micro/go-micro/errors"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/proto/idm"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/views"
+)
+
+// listEntry is either an object or a common prefix (Node is nil) returned by ListObjects.
+type listEntry struct {
+	Key  string
+	Node *tree.Node
+}
+
+func (h *Handler) listBuckets(w http.ResponseWriter, r *http.Request) *apiError {
+
+	ctx := r.Context()
+	var workspaces []*idm.Workspace
+	err := h.Router.WrapCallback(func(inputFilter views.NodeFilter, outputFilter views.NodeFilter) error {
+		loaderCtx, _, e := inputFilter(ctx, &tree.Node{Path: ""}, "tmp")
+		if e != nil {
+			return e
+		}
+		for _, ws := range views.UserWorkspacesFromContext(loaderCtx) {
+			workspaces = append(workspaces, ws)
+		}
+		return nil
+	})
+	if err != nil {
+		return toAPIError(err, errNoSuchBucket)
+	}
+	sort.Slice(workspaces, func(i, j int) bool {
+		return workspaces[i].Slug < workspaces[j].Slug
+	})
+
+	result := &listAllMyBucketsResult{Owner: currentOwner(ctx)}
+	for _, ws := range workspaces {
+		result.Buckets = append(result.Buckets, bucketInfo{
+			Name:         ws.Slug,
+			CreationDate: formatTime(time.Unix(int64(ws.LastUpdated), 0)),
+		})
+	}
+	writeXML(w, http.StatusOK, result)
+	return nil
+
+}
+
+// listObjects implements both versions of ListObjects. Listing is computed from the tree by
+// browsing the folder containing the prefix, recursively unless the delimiter is a slash.
+func (h *Handler) listObjects(w http.ResponseWriter, r *http.Request, bucket string) *apiError {
+
+	ctx := r.Context()
+	query := r.URL.Query()
+	v2 := query.Get("list-type") == "2"
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+
+	encodingType := query.Get("encoding-type")
+	if encodingType != "" && encodingType != "url" {
+		return errInvalidArgument
+	}
+	encode := func(s string) string {
+		if encodingType == "url" {
+			return url.QueryEscape(s)
+		}
+		return s
+	}
+
+	maxKeys := maxObjectList
+	if mk := query.Get("max-keys"); mk != "" {
+		v, e := strconv.Atoi(mk)
+		if e != nil || v < 0 {
+			return errInvalidArgument
+		}
+		if v < maxKeys {
+			maxKeys = v
+		}
+	}
+
+	var marker string
+	if v2 {
+		if token := query.Get("continuation-token"); token != "" {
+			decoded, e := base64.StdEncoding.DecodeString(token)
+			if e != nil {
+				return errInvalidArgument
+			}
+			marker = string(decoded)
+		} else {
+			marker = query.Get("start-after")
+		}
+	} else {
+		marker = query.Get("marker")
+	}
+
+	entries, e := h.listEntries(r, bucket, prefix, delimiter)
+	if e != nil {
+		return toAPIError(e, errNoSuchBucket)
+	}
+	page, truncated := paginate(entries, marker, maxKeys)
+
+	result := &listBucketResult{
+		Name:        bucket,
+		Prefix:      encode(prefix),
+		MaxKeys:     maxKeys,
+		Delimiter:   encode(delimiter),
+		IsTruncated: truncated,
+	}
+	if encodingType != "" {
+		result.EncodingType = encodingType
+	}
+	var objectOwner *owner
+	if !v2 || query.Get("fetch-owner") == "true" {
+		o := currentOwner(ctx)
+		objectOwner = &o
+	}
+	for _, entry := range page {
+		if entry.Node == nil {
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: encode(entry.Key)})
+			continue
+		}
+		result.Contents = append(result.Contents, objectInfo{
+			Key:          encode(entry.Key),
+			LastModified: formatTime(time.Unix(entry.Node.MTime, 0)),
+			ETag:         nodeETag(entry.Node),
+			Size:         entry.Node.Size,
+			StorageClass: s3StorageClass,
+			Owner:        objectOwner,
+		})
+	}
+
+	if v2 {
+		count := len(page)
+		result.KeyCount = &count
+		result.ContinuationToken = query.Get("continuation-token")
+		result.StartAfter = encode(query.Get("start-after"))
+		if truncated {
+			result.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(page[len(page)-1].Key))
+		}
+	} else {
+		m := encode(marker)
+		result.Marker = &m
+		if truncated && len(page) > 0 {
+			result.NextMarker = encode(page[len(page)-1].Key)
+		}
+	}
+	writeXML(w, http.StatusOK, result)
+	return nil
+
+}
+
+// listEntries lists the objects matching the prefix, sorted by key and grouped by delimiter.
+func (h *Handler) listEntries(r *http.Request, bucket string, prefix string, delimiter string) ([]listEntry, error) {
+
+	dir := ""
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = prefix[:i]
+	}
+	recursive := delimiter != "/"
+	streamer, e := h.Router.ListNodes(r.Context(), &tree.ListNodesRequest{Node: &tree.Node{Path: nodePath(bucket, dir)}, Recursive: recursive})
+	if e != nil {
+		if errors.Parse(e.Error()).Code == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, e
+	}
+	defer streamer.Close()
+
+	var entries []listEntry
+	for {
+		resp, e := streamer.Recv()
+		if resp == nil || e != nil {
+			break
+		}
+		n := resp.Node
+		key := strings.TrimPrefix(strings.TrimLeft(n.Path, "/"), bucket+"/")
+		if hiddenKey(key) {
+			continue
+		}
+		if !n.IsLeaf() {
+			if recursive {
+				continue
+			}
+			key += "/"
+		}
+		if strings.HasPrefix(key, prefix) {
+			entries = append(entries, listEntry{Key: key, Node: n})
+		}
+	}
+	return groupEntries(entries, prefix, delimiter), nil
+
+}
+
+// groupEntries replaces the entries having the delimiter after the prefix by their common prefix, and sorts the result.
+func groupEntries(entries []listEntry, prefix string, delimiter string) []listEntry {
+	var grouped []listEntry
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if delimiter != "" {
+			rest := strings.TrimPrefix(entry.Key, prefix)
+			if i := strings.Index(rest, delimiter); i >= 0 {
+				p := prefix + rest[:i+len(delimiter)]
+				if !seen[p] {
+					seen[p] = true
+					grouped = append(grouped, listEntry{Key: p})
+				}
+				continue
+			}
+		}
+		grouped = append(grouped, entry)
+	}
+	sort.Slice(grouped, func(i, j int) bool {
+		return grouped[i].Key < grouped[j].Key
+	})
+	return grouped
+}
+
+// paginate returns at most max entries located after the marker.
+func paginate(entries []listEntry, marker string, max int) (page []listEntry, truncated bool) {
+	start := 0
+	if marker != "" {
+		start = sort.Search(len(entries), func(i int) bool {
+			return entries[i].Key > marker
+		})
+	}
+	end := start + max
+	if end >= len(entries) {
+		return entries[start:], false
+	}
+	return entries[start:end], true
+}
+
+// hiddenKey checks if the key points to an internal file that should not be exposed.
+func hiddenKey(key string) bool {
+	for _, segment := range strings.Split(key, "/") {
+		if segment == common.PYDIO_SYNC_HIDDEN_FILE_META || segment == common.PYDIO_DEDUP_BLOBS_FOLDER {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) deleteObjects(w http.ResponseWriter, r *http.Request, bucket string) *apiError {
+
+	request := &deleteRequest{}
+	if e := xml.NewDecoder(io.LimitReader(r.Body, 2*1024*1024)).Decode(request); e != nil {
+		return errMalformedXML
+	}
+	if len(request.Objects) == 0 || len(request.Objects) > maxDeleteObjects {
+		return errMalformedXML
+	}
+
+	result := &deleteResult{}
+	for _, object := range request.Objects {
+		var err *apiError
+		if !validKey(object.Key) {
+			err = errInvalidObjectName
+		} else {
+			err = h.deleteKey(r, bucket, object.Key)
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, deleteError{Key: object.Key, Code: err.Code, Message: err.Message})
+		} else if !request.Quiet {
+			result.Deleted = append(result.Deleted, deletedObject{Key: object.Key})
+		}
+	}
+	writeXML(w, http.StatusOK, result)
+	return nil
+
+}
@@ -0,0 +1,349 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/errors"
+	"github.com/pborman/uuid"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common/auth"
+	"github.com/pmker/yux/common/auth/claim"
+	"github.com/pmker/yux/common/auth/mfa"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/proto/idm"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/utils"
+	"github.com/pmker/yux/common/views"
+)
+
+// credentialsTTL bounds the time a deleted access key or a locked user keeps working.
+const credentialsTTL = 10 * time.Second
+
+var (
+	loadAccessKey = utils.LoadAccessKey
+	loadKeyOwner  = func(ctx context.Context, login string) (*idm.User, error) {
+		return utils.SearchUniqueUser(ctx, login, "")
+	}
+	ownerAccepted = mfa.AcceptsCredentials
+)
+
+// Handler serves S3 REST requests on top of a views Router: buckets are the workspaces
+// accessible to the authenticated user and object keys are paths inside these workspaces.
+// Requests must be signed with AWS Signature V4 using the user access keys, and only
+// path-style addressing is supported.
+type Handler struct {
+	Router *views.Router
+	Prefix string
+
+	credentials *credentialsCache
+}
+
+// NewHandler creates a Handler serving S3 requests under the given URL prefix.
+func NewHandler(router *views.Router, prefix string) *Handler {
+	return &Handler{
+		Router: router,
+		Prefix: prefix,
+		credentials: &credentialsCache{
+			ttl:   credentialsTTL,
+			cache: make(map[string]*credential),
+		},
+	}
+}
+
+// ServeHTTP authenticates the request and dispatches it to the relevant S3 operation.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	r, err := h.authenticate(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	ctx := r.Context()
+	log.Logger(ctx).Debug("S3 GATEWAY", zap.String("method", r.Method), zap.String("path", r.URL.Path))
+
+	bucket, key := splitPath(strings.TrimPrefix(r.URL.Path, h.Prefix))
+	query := r.URL.Query()
+
+	if bucket == "" {
+		if r.Method != http.MethodGet {
+			writeError(w, r, errMethodNotAllowed)
+			return
+		}
+		err = h.listBuckets(w, r)
+	} else if ws, e := h.workspace(ctx, bucket); e != nil {
+		err = toAPIError(e, errNoSuchBucket)
+	} else if ws == nil {
+		err = errNoSuchBucket
+	} else if key == "" {
+		err = h.serveBucket(w, r, bucket, query)
+	} else if !validKey(key) {
+		err = errInvalidObjectName
+	} else {
+		err = h.serveObject(w, r, bucket, key, query)
+	}
+
+	if err != nil {
+		if err.Status == http.StatusInternalServerError {
+			log.Logger(ctx).Error("S3 GATEWAY", zap.String("method", r.Method), zap.String("path", r.URL.Path), zap.Error(err))
+		}
+		writeError(w, r, err)
+	}
+
+}
+
+func (h *Handler) serveBucket(w http.ResponseWriter, r *http.Request, bucket string, query map[string][]string) *apiError {
+	switch r.Method {
+	case http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+		return nil
+	case http.MethodGet:
+		if _, ok := query["location"]; ok {
+			writeXML(w, http.StatusOK, &locationConstraint{})
+			return nil
+		} else if _, ok := query["uploads"]; ok {
+			return h.listMultipartUploads(w, r, bucket)
+		}
+		return h.listObjects(w, r, bucket)
+	case http.MethodPost:
+		if _, ok := query["delete"]; ok {
+			return h.deleteObjects(w, r, bucket)
+		}
+		return errNotImplemented
+	case http.MethodPut, http.MethodDelete:
+		return errBucketNotWritable
+	}
+	return errMethodNotAllowed
+}
+
+func (h *Handler) serveObject(w http.ResponseWriter, r *http.Request, bucket string, key string, query map[string][]string) *apiError {
+	_, hasUploadId := query["uploadId"]
+	switch r.Method {
+	case http.MethodHead:
+		return h.getObject(w, r, bucket, key, true)
+	case http.MethodGet:
+		if hasUploadId {
+			return h.listParts(w, r, bucket, key)
+		}
+		return h.getObject(w, r, bucket, key, false)
+	case http.MethodPut:
+		if hasUploadId {
+			return h.putObjectPart(w, r, bucket, key)
+		} else if r.Header.Get("X-Amz-Copy-Source") != "" {
+			return h.copyObject(w, r, bucket, key)
+		}
+		return h.putObject(w, r, bucket, key)
+	case http.MethodPost:
+		if _, ok := query["uploads"]; ok {
+			return h.createMultipartUpload(w, r, bucket, key)
+		} else if hasUploadId {
+			return h.completeMultipartUpload(w, r, bucket, key)
+		}
+		return errNotImplemented
+	case http.MethodDelete:
+		if hasUploadId {
+			return h.abortMultipartUpload(w, r, bucket, key)
+		}
+		return h.deleteObject(w, r, bucket, key)
+	}
+	return errMethodNotAllowed
+}
+
+// authenticate verifies the request signature and returns a request whose context carries
+// the identity of the access key owner. The body is wrapped to check the signed payload.
+func (h *Handler) authenticate(r *http.Request) (*http.Request, *apiError) {
+
+	sig, err := parseSignature(r)
+	if err != nil {
+		return r, err
+	}
+	cred, err := h.credentials.load(r.Context(), sig.AccessKey)
+	if err != nil {
+		return r, err
+	}
+	if err := sig.verify(r, cred.secret, time.Now()); err != nil {
+		return r, err
+	}
+
+	switch sig.PayloadHash {
+	case unsignedPayload:
+	case streamingPayload:
+		r.Body = newChunkedReader(r.Body, sig, cred.secret)
+	default:
+		r.Body = newPayloadReader(r.Body, sig.PayloadHash)
+	}
+
+	return r.WithContext(auth.WithClaims(r.Context(), cred.claims)), nil
+
+}
+
+// workspace finds the workspace whose slug is the bucket name, nil if it is not accessible to the current user.
+func (h *Handler) workspace(ctx context.Context, bucket string) (*idm.Workspace, error) {
+	var found *idm.Workspace
+	err := h.Router.WrapCallback(func(inputFilter views.NodeFilter, outputFilter views.NodeFilter) error {
+		loaderCtx, _, e := inputFilter(ctx, &tree.Node{Path: ""}, "tmp")
+		if e != nil {
+			return e
+		}
+		for _, ws := range views.UserWorkspacesFromContext(loaderCtx) {
+			if ws.Slug == bucket {
+				found = ws
+				break
+			}
+		}
+		return nil
+	})
+	return found, err
+}
+
+type credential struct {
+	secret string
+	claims claim.Claims
+	loaded time.Time
+}
+
+// credentialsCache keeps the access keys and their owner claims for a few seconds, to avoid
+// loading the user on every request.
+type credentialsCache struct {
+	sync.Mutex
+	ttl   time.Duration
+	cache map[string]*credential
+}
+
+func (c *credentialsCache) load(ctx context.Context, accessKey string) (*credential, *apiError) {
+
+	c.Lock()
+	cred, ok := c.cache[accessKey]
+	c.Unlock()
+	if ok && time.Now().Sub(cred.loaded) < c.ttl {
+		return cred, nil
+	}
+
+	cred, err := c.loadCredential(ctx, accessKey)
+	if err != nil {
+		c.Lock()
+		delete(c.cache, accessKey)
+		c.Unlock()
+		return nil, err
+	}
+	c.Lock()
+	c.cache[accessKey] = cred
+	c.Unlock()
+	return cred, nil
+
+}
+
+func (c *credentialsCache) loadCredential(ctx context.Context, accessKey string) (*credential, *apiError) {
+
+	key, e := loadAccessKey(ctx, accessKey)
+	if e != nil {
+		if errors.Parse(e.Error()).Code == http.StatusNotFound {
+			return nil, errInvalidAccessKeyId
+		}
+		log.Logger(ctx).Error("cannot load access key", zap.Error(e))
+		return nil, errInternal
+	}
+	user, e := loadKeyOwner(ctx, key.Login)
+	if e != nil {
+		if errors.Parse(e.Error()).Code == http.StatusNotFound {
+			return nil, errInvalidAccessKeyId
+		}
+		log.Logger(ctx).Error("cannot load access key owner", zap.Error(e))
+		return nil, errInternal
+	}
+	if utils.IsUserLocked(user) || !ownerAccepted(user) {
+		return nil, errAccessDenied
+	}
+
+	return &credential{
+		secret: key.Secret,
+		claims: auth.ClaimsFromUser(user, claim.AuthMethodAccessKey),
+		loaded: time.Now(),
+	}, nil
+
+}
+
+// splitPath reads the bucket and the object key from the request path.
+func splitPath(p string) (bucket string, key string) {
+	parts := strings.SplitN(strings.TrimPrefix(p, "/"), "/", 2)
+	bucket = parts[0]
+	if len(parts) > 1 {
+		key = parts[1]
+	}
+	return
+}
+
+// validKey rejects keys that cannot be mapped to a path inside the workspace.
+func validKey(key string) bool {
+	if len(key) > 1024 {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// nodePath builds the router path of an object, trimming the trailing slash of folder keys.
+func nodePath(bucket string, key string) string {
+	if key = strings.Trim(key, "/"); key == "" {
+		return bucket
+	}
+	return bucket + "/" + key
+}
+
+func currentOwner(ctx context.Context) owner {
+	if claims, ok := ctx.Value(claim.ContextKey).(claim.Claims); ok {
+		return owner{ID: claims.Name, DisplayName: claims.Name}
+	}
+	return owner{}
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err *apiError) {
+	requestId := uuid.New()
+	w.Header().Set("X-Amz-Request-Id", requestId)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(err.Status)
+		return
+	}
+	writeXML(w, err.Status, &errorResponse{
+		Code:      err.Code,
+		Message:   err.Message,
+		Resource:  r.URL.Path,
+		RequestId: requestId,
+	})
+}
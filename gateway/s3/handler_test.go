@@ -0,0 +1,206 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package s3
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/proto/idm"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/utils"
+)
+
+func entryKeys(entries []listEntry) (keys []string) {
+	for _, e := range entries {
+		keys = append(keys, e.Key)
+	}
+	return
+}
+
+func TestListing(t *testing.T) {
+
+	Convey("Group and sort entries", t, func() {
+		entries := []listEntry{
+			{Key: "photos/2018/b.jpg", Node: &tree.Node{}},
+			{Key: "photos/a.jpg", Node: &tree.Node{}},
+			{Key: "photos/2017/c.jpg", Node: &tree.Node{}},
+			{Key: "photos/2018/d.jpg", Node: &tree.Node{}},
+		}
+		grouped := groupEntries(entries, "photos/", "/")
+		So(entryKeys(grouped), ShouldResemble, []string{"photos/2017/", "photos/2018/", "photos/a.jpg"})
+		So(grouped[0].Node, ShouldBeNil)
+		So(grouped[2].Node, ShouldNotBeNil)
+
+		So(entryKeys(groupEntries(entries, "photos/", "")), ShouldResemble, []string{"photos/2017/c.jpg", "photos/2018/b.jpg", "photos/2018/d.jpg", "photos/a.jpg"})
+		So(entryKeys(groupEntries(entries, "photos/20", "1")), ShouldResemble, []string{"photos/201", "photos/a.jpg"})
+	})
+
+	Convey("Paginate entries", t, func() {
+		entries := []listEntry{{Key: "a"}, {Key: "b"}, {Key: "c"}, {Key: "d"}}
+		page, truncated := paginate(entries, "", 2)
+		So(entryKeys(page), ShouldResemble, []string{"a", "b"})
+		So(truncated, ShouldBeTrue)
+		page, truncated = paginate(entries, "b", 2)
+		So(entryKeys(page), ShouldResemble, []string{"c", "d"})
+		So(truncated, ShouldBeFalse)
+		page, truncated = paginate(entries, "bb", 1000)
+		So(entryKeys(page), ShouldResemble, []string{"c", "d"})
+		So(truncated, ShouldBeFalse)
+		page, _ = paginate(entries, "d", 1000)
+		So(page, ShouldBeEmpty)
+	})
+
+	Convey("Filter internal files", t, func() {
+		So(hiddenKey("folder/.pydio"), ShouldBeTrue)
+		So(hiddenKey(".pydio_blobs/ab/cd"), ShouldBeTrue)
+		So(hiddenKey("folder/file.pydio"), ShouldBeFalse)
+	})
+
+}
+
+func TestObjects(t *testing.T) {
+
+	Convey("Split paths and validate keys", t, func() {
+		b, k := splitPath("/bucket/folder/file.txt")
+		So(b, ShouldEqual, "bucket")
+		So(k, ShouldEqual, "folder/file.txt")
+		b, k = splitPath("/bucket/")
+		So(b, ShouldEqual, "bucket")
+		So(k, ShouldEqual, "")
+		b, _ = splitPath("/")
+		So(b, ShouldEqual, "")
+
+		So(validKey("folder/file.txt"), ShouldBeTrue)
+		So(validKey("folder/../other/file.txt"), ShouldBeFalse)
+		So(validKey("./file.txt"), ShouldBeFalse)
+		So(nodePath("bucket", "folder/"), ShouldEqual, "bucket/folder")
+	})
+
+	Convey("Parse copy sources", t, func() {
+		b, k, err := parseCopySource("/source/folder/my%20file.txt")
+		So(err, ShouldBeNil)
+		So(b, ShouldEqual, "source")
+		So(k, ShouldEqual, "folder/my file.txt")
+		_, _, err = parseCopySource("source")
+		So(err, ShouldEqual, errInvalidCopySource)
+		_, _, err = parseCopySource("source/file.txt?versionId=abc")
+		So(err, ShouldEqual, errNotImplemented)
+	})
+
+	Convey("Parse ranges", t, func() {
+		start, length, partial, err := parseRange("", 100)
+		So(err, ShouldBeNil)
+		So(partial, ShouldBeFalse)
+		So(length, ShouldEqual, 100)
+
+		start, length, partial, err = parseRange("bytes=10-19", 100)
+		So(err, ShouldBeNil)
+		So(partial, ShouldBeTrue)
+		So(start, ShouldEqual, 10)
+		So(length, ShouldEqual, 10)
+
+		start, length, _, err = parseRange("bytes=90-200", 100)
+		So(err, ShouldBeNil)
+		So(start, ShouldEqual, 90)
+		So(length, ShouldEqual, 10)
+
+		start, length, _, err = parseRange("bytes=95-", 100)
+		So(err, ShouldBeNil)
+		So(start, ShouldEqual, 95)
+		So(length, ShouldEqual, 5)
+
+		start, length, _, err = parseRange("bytes=-30", 100)
+		So(err, ShouldBeNil)
+		So(start, ShouldEqual, 70)
+		So(length, ShouldEqual, 30)
+
+		_, _, _, err = parseRange("bytes=100-", 100)
+		So(err, ShouldEqual, errInvalidRange)
+
+		_, _, partial, err = parseRange("bytes=0-1,5-6", 100)
+		So(err, ShouldBeNil)
+		So(partial, ShouldBeFalse)
+	})
+
+	Convey("Match ETags", t, func() {
+		So(matchETag(`"abc", "def"`, `"def"`), ShouldBeTrue)
+		So(matchETag(`*`, `"def"`), ShouldBeTrue)
+		So(matchETag(`"abc"`, `"def"`), ShouldBeFalse)
+		So(nodeETag(&tree.Node{Etag: "abc"}), ShouldEqual, `"abc"`)
+		So(nodeETag(&tree.Node{Etag: "temporary", Uuid: "uuid"}), ShouldNotEqual, `"temporary"`)
+	})
+
+}
+
+func TestCredentialsCache(t *testing.T) {
+
+	keys := map[string]*utils.AccessKey{"PYKEY": {ID: "PYKEY", Login: "john", Secret: "secret"}}
+	users := map[string]*idm.User{"john": {Login: "john", Attributes: map[string]string{"profile": "standard"}}}
+	defer func(k func(context.Context, string) (*utils.AccessKey, error), o func(context.Context, string) (*idm.User, error), a func(*idm.User) bool) {
+		loadAccessKey = k
+		loadKeyOwner = o
+		ownerAccepted = a
+	}(loadAccessKey, loadKeyOwner, ownerAccepted)
+	loadAccessKey = func(ctx context.Context, id string) (*utils.AccessKey, error) {
+		if k, ok := keys[id]; ok {
+			return k, nil
+		}
+		return nil, errors.NotFound("docstore", "Cannot find access key "+id)
+	}
+	loadKeyOwner = func(ctx context.Context, login string) (*idm.User, error) {
+		return users[login], nil
+	}
+	ownerAccepted = func(user *idm.User) bool { return true }
+
+	Convey("Deleted keys and locked users are refused once the cache expires", t, func() {
+		c := &credentialsCache{ttl: credentialsTTL, cache: make(map[string]*credential)}
+		cred, err := c.load(context.Background(), "PYKEY")
+		So(err, ShouldBeNil)
+		So(cred.secret, ShouldEqual, "secret")
+		So(cred.claims.Name, ShouldEqual, "john")
+
+		_, err = c.load(context.Background(), "PYOTHER")
+		So(err, ShouldEqual, errInvalidAccessKeyId)
+
+		// Cached credentials are used until they expire
+		users["john"].Attributes["locks"] = `["logout"]`
+		_, err = c.load(context.Background(), "PYKEY")
+		So(err, ShouldBeNil)
+		c.cache["PYKEY"].loaded = time.Now().Add(-credentialsTTL)
+		_, err = c.load(context.Background(), "PYKEY")
+		So(err, ShouldEqual, errAccessDenied)
+		So(c.cache, ShouldNotContainKey, "PYKEY")
+
+		delete(users["john"].Attributes, "locks")
+		_, err = c.load(context.Background(), "PYKEY")
+		So(err, ShouldBeNil)
+		delete(keys, "PYKEY")
+		c.cache["PYKEY"].loaded = time.Now().Add(-credentialsTTL)
+		_, err = c.load(context.Background(), "PYKEY")
+		So(err, ShouldEqual, errInvalidAccessKeyId)
+	})
+
+}
@@ -0,0 +1,192 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package s3
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	minio "github.com/pydio/minio-go"
+
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/views"
+)
+
+func (h *Handler) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucket string, key string) *apiError {
+
+	if strings.HasSuffix(key, "/") {
+		return errInvalidArgument
+	}
+	uploadId, e := h.Router.MultipartCreate(r.Context(), &tree.Node{Path: nodePath(bucket, key)}, &views.MultipartRequestData{})
+	if e != nil {
+		return toAPIError(e, errNoSuchKey)
+	}
+	writeXML(w, http.StatusOK, &initiateMultipartUploadResult{
+		Bucket:   bucket,
+		Key:      key,
+		UploadId: uploadId,
+	})
+	return nil
+
+}
+
+func (h *Handler) putObjectPart(w http.ResponseWriter, r *http.Request, bucket string, key string) *apiError {
+
+	query := r.URL.Query()
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		return errNotImplemented
+	}
+	partNumber, e := strconv.Atoi(query.Get("partNumber"))
+	if e != nil || partNumber < 1 || partNumber > maxParts {
+		return errInvalidArgument
+	}
+	size, err := contentLength(r)
+	if err != nil {
+		return err
+	}
+	uploadId := query.Get("uploadId")
+	part, e := h.Router.MultipartPutObjectPart(r.Context(), &tree.Node{Path: nodePath(bucket, key)}, uploadId, partNumber, r.Body, &views.PutRequestData{
+		Size:              size,
+		MultipartUploadID: uploadId,
+		MultipartPartID:   partNumber,
+	})
+	if e != nil {
+		return toAPIError(e, errNoSuchUpload)
+	}
+	w.Header().Set("ETag", `"`+strings.Trim(part.ETag, `"`)+`"`)
+	w.WriteHeader(http.StatusOK)
+	return nil
+
+}
+
+func (h *Handler) completeMultipartUpload(w http.ResponseWriter, r *http.Request, bucket string, key string) *apiError {
+
+	request := &completeMultipartUpload{}
+	if e := xml.NewDecoder(io.LimitReader(r.Body, 2*1024*1024)).Decode(request); e != nil {
+		return errMalformedXML
+	}
+	if len(request.Parts) == 0 {
+		return errMalformedXML
+	}
+	var parts []minio.CompletePart
+	for i, p := range request.Parts {
+		if i > 0 && p.PartNumber <= request.Parts[i-1].PartNumber {
+			return errInvalidPartOrder
+		}
+		parts = append(parts, minio.CompletePart{PartNumber: p.PartNumber, ETag: strings.Trim(p.ETag, `"`)})
+	}
+
+	info, e := h.Router.MultipartComplete(r.Context(), &tree.Node{Path: nodePath(bucket, key)}, r.URL.Query().Get("uploadId"), parts)
+	if e != nil {
+		return toAPIError(e, errNoSuchUpload)
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	writeXML(w, http.StatusOK, &completeMultipartUploadResult{
+		Location: scheme + "://" + r.Host + h.Prefix + "/" + bucket + "/" + key,
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     `"` + strings.Trim(info.ETag, `"`) + `"`,
+	})
+	return nil
+
+}
+
+func (h *Handler) abortMultipartUpload(w http.ResponseWriter, r *http.Request, bucket string, key string) *apiError {
+
+	if e := h.Router.MultipartAbort(r.Context(), &tree.Node{Path: nodePath(bucket, key)}, r.URL.Query().Get("uploadId"), &views.MultipartRequestData{}); e != nil {
+		return toAPIError(e, errNoSuchUpload)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+
+}
+
+func (h *Handler) listParts(w http.ResponseWriter, r *http.Request, bucket string, key string) *apiError {
+
+	query := r.URL.Query()
+	marker, max := 0, maxObjectList
+	if m := query.Get("part-number-marker"); m != "" {
+		v, e := strconv.Atoi(m)
+		if e != nil || v < 0 {
+			return errInvalidArgument
+		}
+		marker = v
+	}
+	if m := query.Get("max-parts"); m != "" {
+		v, e := strconv.Atoi(m)
+		if e != nil || v < 0 {
+			return errInvalidArgument
+		}
+		if v < max {
+			max = v
+		}
+	}
+
+	uploadId := query.Get("uploadId")
+	list, e := h.Router.MultipartListObjectParts(r.Context(), &tree.Node{Path: nodePath(bucket, key)}, uploadId, marker, max)
+	if e != nil {
+		return toAPIError(e, errNoSuchUpload)
+	}
+	o := currentOwner(r.Context())
+	result := &listPartsResult{
+		Bucket:               bucket,
+		Key:                  key,
+		UploadId:             uploadId,
+		Initiator:            o,
+		Owner:                o,
+		StorageClass:         s3StorageClass,
+		PartNumberMarker:     marker,
+		NextPartNumberMarker: list.NextPartNumberMarker,
+		MaxParts:             max,
+		IsTruncated:          list.IsTruncated,
+	}
+	for _, p := range list.ObjectParts {
+		result.Parts = append(result.Parts, partInfo{
+			PartNumber:   p.PartNumber,
+			LastModified: formatTime(p.LastModified),
+			ETag:         `"` + strings.Trim(p.ETag, `"`) + `"`,
+			Size:         p.Size,
+		})
+	}
+	writeXML(w, http.StatusOK, result)
+	return nil
+
+}
+
+// listMultipartUploads always returns an empty list: pending uploads are stored per datasource
+// and cannot be listed through the workspaces.
+func (h *Handler) listMultipartUploads(w http.ResponseWriter, r *http.Request, bucket string) *apiError {
+	query := r.URL.Query()
+	writeXML(w, http.StatusOK, &listMultipartUploadsResult{
+		Bucket:         bucket,
+		KeyMarker:      query.Get("key-marker"),
+		UploadIdMarker: query.Get("upload-id-marker"),
+		Prefix:         query.Get("prefix"),
+		MaxUploads:     maxObjectList,
+	})
+	return nil
+}
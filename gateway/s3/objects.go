@@ -0,0 +1,362 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/micro/go-micro/errors"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/views"
+)
+
+// responseHeaders lists the query parameters that presigned GET requests can use to override response headers.
+var responseHeaders = map[string]string{
+	"response-content-type":        "Content-Type",
+	"response-content-language":    "Content-Language",
+	"response-expires":             "Expires",
+	"response-cache-control":       "Cache-Control",
+	"response-content-disposition": "Content-Disposition",
+	"response-content-encoding":    "Content-Encoding",
+}
+
+func (h *Handler) getObject(w http.ResponseWriter, r *http.Request, bucket string, key string, head bool) *apiError {
+
+	ctx := r.Context()
+	resp, e := h.Router.ReadNode(ctx, &tree.ReadNodeRequest{Node: &tree.Node{Path: nodePath(bucket, key)}})
+	if e != nil {
+		return toAPIError(e, errNoSuchKey)
+	}
+	n := resp.Node
+	folder := strings.HasSuffix(key, "/")
+	if n.IsLeaf() == folder {
+		return errNoSuchKey
+	}
+
+	etag := nodeETag(n)
+	modified := time.Unix(n.MTime, 0)
+	if status := checkPreconditions(r, etag, modified); status != 0 {
+		if status == http.StatusPreconditionFailed {
+			return errPreconditionFailed
+		}
+		w.WriteHeader(status)
+		return nil
+	}
+
+	header := w.Header()
+	header.Set("ETag", etag)
+	header.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("Content-Type", contentType(n))
+	query := r.URL.Query()
+	for param, name := range responseHeaders {
+		if v := query.Get(param); v != "" {
+			header.Set(name, v)
+		}
+	}
+
+	size := n.Size
+	if folder {
+		size = 0
+	}
+	start, length, partial, err := parseRange(r.Header.Get("Range"), size)
+	if err != nil {
+		header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		return err
+	}
+	header.Set("Content-Length", strconv.FormatInt(length, 10))
+	status := http.StatusOK
+	if partial {
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, size))
+		status = http.StatusPartialContent
+	}
+	if head || length == 0 {
+		w.WriteHeader(status)
+		return nil
+	}
+
+	reader, e := h.Router.GetObject(ctx, n, &views.GetRequestData{StartOffset: start, Length: length})
+	if e != nil {
+		header.Del("Content-Length")
+		header.Del("Content-Range")
+		return toAPIError(e, errNoSuchKey)
+	}
+	defer reader.Close()
+	w.WriteHeader(status)
+	io.Copy(w, reader)
+	return nil
+
+}
+
+func (h *Handler) putObject(w http.ResponseWriter, r *http.Request, bucket string, key string) *apiError {
+
+	ctx := r.Context()
+	size, err := contentLength(r)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasSuffix(key, "/") {
+		// Folder marker, as created by most S3 clients for empty directories
+		if size > 0 {
+			return errInvalidArgument
+		}
+		p := nodePath(bucket, key)
+		if resp, e := h.Router.ReadNode(ctx, &tree.ReadNodeRequest{Node: &tree.Node{Path: p}}); e == nil {
+			if resp.Node.IsLeaf() {
+				return errInvalidArgument
+			}
+		} else if _, e := h.Router.CreateNode(ctx, &tree.CreateNodeRequest{Node: &tree.Node{Path: p, Type: tree.NodeType_COLLECTION}}); e != nil {
+			return toAPIError(e, errNoSuchKey)
+		}
+		w.Header().Set("ETag", `"`+hex.EncodeToString(md5.New().Sum(nil))+`"`)
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	hasher := md5.New()
+	if _, e := h.Router.PutObject(ctx, &tree.Node{Path: nodePath(bucket, key)}, io.TeeReader(r.Body, hasher), &views.PutRequestData{Size: size}); e != nil {
+		return toAPIError(e, errNoSuchKey)
+	}
+	w.Header().Set("ETag", `"`+hex.EncodeToString(hasher.Sum(nil))+`"`)
+	w.WriteHeader(http.StatusOK)
+	return nil
+
+}
+
+func (h *Handler) copyObject(w http.ResponseWriter, r *http.Request, bucket string, key string) *apiError {
+
+	ctx := r.Context()
+	srcBucket, srcKey, err := parseCopySource(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		return err
+	}
+	if ws, e := h.workspace(ctx, srcBucket); e != nil || ws == nil {
+		return errNoSuchBucket
+	}
+	if strings.HasSuffix(key, "/") || strings.HasSuffix(srcKey, "/") {
+		return errInvalidArgument
+	}
+
+	srcResp, e := h.Router.ReadNode(ctx, &tree.ReadNodeRequest{Node: &tree.Node{Path: nodePath(srcBucket, srcKey)}})
+	if e != nil {
+		return toAPIError(e, errNoSuchKey)
+	}
+	if !srcResp.Node.IsLeaf() {
+		return errNoSuchKey
+	}
+	target := nodePath(bucket, key)
+	// Copying an object onto itself is used by clients to update metadata, which are not supported: ignore it
+	if target != nodePath(srcBucket, srcKey) {
+		if _, e := h.Router.CopyObject(ctx, srcResp.Node, &tree.Node{Path: target}, &views.CopyRequestData{}); e != nil {
+			return toAPIError(e, errNoSuchKey)
+		}
+	}
+	resp, e := h.Router.ReadNode(ctx, &tree.ReadNodeRequest{Node: &tree.Node{Path: target}})
+	if e != nil {
+		return toAPIError(e, errNoSuchKey)
+	}
+	writeXML(w, http.StatusOK, &copyObjectResult{
+		LastModified: formatTime(time.Unix(resp.Node.MTime, 0)),
+		ETag:         nodeETag(resp.Node),
+	})
+	return nil
+
+}
+
+func (h *Handler) deleteObject(w http.ResponseWriter, r *http.Request, bucket string, key string) *apiError {
+	if err := h.deleteKey(r, bucket, key); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// deleteKey removes an object. As in S3, deleting a missing key is not an error. Folder markers
+// only remove empty folders, as folder contents would be listed as other keys.
+func (h *Handler) deleteKey(r *http.Request, bucket string, key string) *apiError {
+
+	ctx := r.Context()
+	resp, e := h.Router.ReadNode(ctx, &tree.ReadNodeRequest{Node: &tree.Node{Path: nodePath(bucket, key)}})
+	if e != nil {
+		if errors.Parse(e.Error()).Code == http.StatusNotFound {
+			return nil
+		}
+		return toAPIError(e, errNoSuchKey)
+	}
+	n := resp.Node
+	if strings.HasSuffix(key, "/") {
+		if n.IsLeaf() {
+			return nil
+		}
+		streamer, e := h.Router.ListNodes(ctx, &tree.ListNodesRequest{Node: n})
+		if e != nil {
+			return toAPIError(e, errNoSuchKey)
+		}
+		defer streamer.Close()
+		for {
+			child, e := streamer.Recv()
+			if child == nil || e != nil {
+				break
+			}
+			if path.Base(child.Node.Path) != common.PYDIO_SYNC_HIDDEN_FILE_META {
+				return nil
+			}
+		}
+	} else if !n.IsLeaf() {
+		return nil
+	}
+
+	if _, e := h.Router.DeleteNode(ctx, &tree.DeleteNodeRequest{Node: n}); e != nil {
+		return toAPIError(e, errNoSuchKey)
+	}
+	return nil
+
+}
+
+// contentLength finds the size of the uploaded data, which differs from the request Content-Length for chunked signed uploads.
+func contentLength(r *http.Request) (int64, *apiError) {
+	size := r.ContentLength
+	if r.Header.Get("X-Amz-Content-Sha256") == streamingPayload {
+		decoded, e := strconv.ParseInt(r.Header.Get("X-Amz-Decoded-Content-Length"), 10, 64)
+		if e != nil {
+			return 0, errMissingContentLength
+		}
+		size = decoded
+	}
+	if size < 0 {
+		return 0, errMissingContentLength
+	}
+	return size, nil
+}
+
+// parseCopySource reads the bucket and key from a x-amz-copy-source header value. Versions are not supported.
+func parseCopySource(value string) (bucket string, key string, err *apiError) {
+	if strings.Contains(value, "?versionId=") {
+		return "", "", errNotImplemented
+	}
+	unescaped, e := url.PathUnescape(value)
+	if e != nil {
+		return "", "", errInvalidCopySource
+	}
+	bucket, key = splitPath(unescaped)
+	if bucket == "" || key == "" || !validKey(key) {
+		return "", "", errInvalidCopySource
+	}
+	return bucket, key, nil
+}
+
+// parseRange reads a single byte range as sent in a Range header. If the header is empty or
+// holds multiple ranges, the whole content is returned.
+func parseRange(value string, size int64) (start int64, length int64, partial bool, err *apiError) {
+
+	if value == "" || !strings.HasPrefix(value, "bytes=") || strings.Contains(value, ",") {
+		return 0, size, false, nil
+	}
+	spec := strings.SplitN(strings.TrimPrefix(value, "bytes="), "-", 2)
+	if len(spec) != 2 {
+		return 0, size, false, nil
+	}
+	first, firstErr := strconv.ParseInt(spec[0], 10, 64)
+	last, lastErr := strconv.ParseInt(spec[1], 10, 64)
+	switch {
+	case spec[0] == "" && lastErr == nil && last > 0:
+		// Suffix range: last bytes of the content
+		if size == 0 {
+			return 0, 0, false, errInvalidRange
+		}
+		if last > size {
+			last = size
+		}
+		return size - last, last, true, nil
+	case firstErr == nil && first >= 0 && spec[1] == "":
+		if first >= size {
+			return 0, 0, false, errInvalidRange
+		}
+		return first, size - first, true, nil
+	case firstErr == nil && lastErr == nil && first >= 0 && last >= first:
+		if first >= size {
+			return 0, 0, false, errInvalidRange
+		}
+		if last >= size {
+			last = size - 1
+		}
+		return first, last - first + 1, true, nil
+	}
+	return 0, size, false, nil
+
+}
+
+// checkPreconditions evaluates conditional request headers, returning the status to send if one of them fails.
+func checkPreconditions(r *http.Request, etag string, modified time.Time) int {
+	if match := r.Header.Get("If-Match"); match != "" && !matchETag(match, etag) {
+		return http.StatusPreconditionFailed
+	}
+	if since, e := http.ParseTime(r.Header.Get("If-Unmodified-Since")); e == nil && modified.After(since) {
+		return http.StatusPreconditionFailed
+	}
+	if noneMatch := r.Header.Get("If-None-Match"); noneMatch != "" {
+		if matchETag(noneMatch, etag) {
+			return http.StatusNotModified
+		}
+	} else if since, e := http.ParseTime(r.Header.Get("If-Modified-Since")); e == nil && !modified.After(since) {
+		return http.StatusNotModified
+	}
+	return 0
+}
+
+func matchETag(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.Trim(candidate, `"`) == strings.Trim(etag, `"`) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeETag returns the quoted node ETag, or a value computed from the node modification time if it is not known yet.
+func nodeETag(n *tree.Node) string {
+	if n.Etag == "" || n.Etag == common.NODE_FLAG_ETAG_TEMPORARY {
+		sum := md5.Sum([]byte(fmt.Sprintf("%s-%d-%d", n.Uuid, n.MTime, n.Size)))
+		return `"` + hex.EncodeToString(sum[:]) + `"`
+	}
+	return `"` + strings.Trim(n.Etag, `"`) + `"`
+}
+
+func contentType(n *tree.Node) string {
+	if t := mime.TypeByExtension(path.Ext(n.Path)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,275 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package s3
+
+import (
+	"encoding/xml"
+	"net/http"
+	"time"
+
+	"github.com/micro/go-micro/errors"
+	minio "github.com/pydio/minio-go"
+)
+
+const (
+	s3Namespace      = "http://s3.amazonaws.com/doc/2006-03-01/"
+	s3TimeFormat     = "2006-01-02T15:04:05.000Z"
+	s3StorageClass   = "STANDARD"
+	maxObjectList    = 1000
+	maxParts         = 10000
+	maxDeleteObjects = 1000
+)
+
+// apiError is an error returned to S3 clients.
+type apiError struct {
+	Code    string
+	Message string
+	Status  int
+}
+
+func (e *apiError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+var (
+	errAccessDenied                 = &apiError{"AccessDenied", "Access Denied.", http.StatusForbidden}
+	errMissingAuth                  = &apiError{"AccessDenied", "Anonymous access is not allowed, please sign your requests.", http.StatusForbidden}
+	errInvalidAccessKeyId           = &apiError{"InvalidAccessKeyId", "The access key ID you provided does not exist in our records.", http.StatusForbidden}
+	errSignatureDoesNotMatch        = &apiError{"SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided.", http.StatusForbidden}
+	errSignatureVersionNotSupported = &apiError{"InvalidRequest", "The authorization mechanism you have provided is not supported. Please use AWS4-HMAC-SHA256.", http.StatusBadRequest}
+	errAuthorizationHeaderMalformed = &apiError{"AuthorizationHeaderMalformed", "The authorization header is malformed.", http.StatusBadRequest}
+	errAuthorizationQueryMalformed  = &apiError{"AuthorizationQueryParametersError", "The authorization query parameters are malformed.", http.StatusBadRequest}
+	errCredentialMalformed          = &apiError{"AuthorizationHeaderMalformed", "The credential is malformed or its date does not match the request date.", http.StatusBadRequest}
+	errInvalidService               = &apiError{"AuthorizationHeaderMalformed", "The credential service must be s3.", http.StatusBadRequest}
+	errUnsignedHeaders              = &apiError{"AccessDenied", "The host header must be signed.", http.StatusForbidden}
+	errMissingDate                  = &apiError{"AccessDenied", "AWS authentication requires a valid Date or x-amz-date header.", http.StatusForbidden}
+	errMalformedDate                = &apiError{"MalformedDate", "Invalid date format.", http.StatusBadRequest}
+	errMalformedExpires             = &apiError{"AuthorizationQueryParametersError", "X-Amz-Expires must be a number of seconds between 0 and 604800.", http.StatusBadRequest}
+	errRequestTimeTooSkewed         = &apiError{"RequestTimeTooSkewed", "The difference between the request time and the server's time is too large.", http.StatusForbidden}
+	errRequestNotReadyYet           = &apiError{"AccessDenied", "Request is not valid yet.", http.StatusForbidden}
+	errExpiredPresignRequest        = &apiError{"AccessDenied", "Request has expired.", http.StatusForbidden}
+	errMissingContentSHA256         = &apiError{"InvalidRequest", "Missing required header for this request: x-amz-content-sha256.", http.StatusBadRequest}
+	errContentSHA256Mismatch        = &apiError{"XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed.", http.StatusBadRequest}
+	errMalformedChunk               = &apiError{"InvalidRequest", "Malformed chunk in aws-chunked body.", http.StatusBadRequest}
+	errIncompleteBody               = &apiError{"IncompleteBody", "You did not provide the number of bytes specified by the Content-Length HTTP header.", http.StatusBadRequest}
+	errMissingContentLength         = &apiError{"MissingContentLength", "You must provide the Content-Length HTTP header.", http.StatusLengthRequired}
+	errInvalidDigest                = &apiError{"InvalidDigest", "The Content-MD5 you specified is not valid.", http.StatusBadRequest}
+	errBadDigest                    = &apiError{"BadDigest", "The Content-MD5 you specified did not match what we received.", http.StatusBadRequest}
+	errNoSuchBucket                 = &apiError{"NoSuchBucket", "The specified bucket does not exist.", http.StatusNotFound}
+	errNoSuchKey                    = &apiError{"NoSuchKey", "The specified key does not exist.", http.StatusNotFound}
+	errNoSuchUpload                 = &apiError{"NoSuchUpload", "The specified multipart upload does not exist.", http.StatusNotFound}
+	errInvalidPart                  = &apiError{"InvalidPart", "One or more of the specified parts could not be found.", http.StatusBadRequest}
+	errInvalidPartOrder             = &apiError{"InvalidPartOrder", "The list of parts was not in ascending order.", http.StatusBadRequest}
+	errEntityTooSmall               = &apiError{"EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size.", http.StatusBadRequest}
+	errInvalidArgument              = &apiError{"InvalidArgument", "Invalid argument.", http.StatusBadRequest}
+	errInvalidObjectName            = &apiError{"InvalidArgument", "Object key contains invalid path segments.", http.StatusBadRequest}
+	errInvalidCopySource            = &apiError{"InvalidArgument", "Copy Source must mention the source bucket and key: sourcebucket/sourcekey.", http.StatusBadRequest}
+	errInvalidRange                 = &apiError{"InvalidRange", "The requested range is not satisfiable.", http.StatusRequestedRangeNotSatisfiable}
+	errPreconditionFailed           = &apiError{"PreconditionFailed", "At least one of the pre-conditions you specified did not hold.", http.StatusPreconditionFailed}
+	errMalformedXML                 = &apiError{"MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.", http.StatusBadRequest}
+	errMethodNotAllowed             = &apiError{"MethodNotAllowed", "The specified method is not allowed against this resource.", http.StatusMethodNotAllowed}
+	errBucketNotWritable            = &apiError{"NotImplemented", "Buckets are mapped to workspaces and cannot be created or deleted.", http.StatusNotImplemented}
+	errNotImplemented               = &apiError{"NotImplemented", "A header or query you provided implies functionality that is not implemented.", http.StatusNotImplemented}
+	errInternal                     = &apiError{"InternalError", "We encountered an internal error, please try again.", http.StatusInternalServerError}
+)
+
+// toAPIError converts an error returned by the views Router to an S3 error. The notFound
+// error is returned if the router could not find the target.
+func toAPIError(e error, notFound *apiError) *apiError {
+	if a, ok := e.(*apiError); ok {
+		return a
+	}
+	switch minio.ToErrorResponse(e).Code {
+	case "NoSuchKey":
+		return notFound
+	case "NoSuchUpload":
+		return errNoSuchUpload
+	case "InvalidPart":
+		return errInvalidPart
+	case "InvalidPartOrder":
+		return errInvalidPartOrder
+	case "EntityTooSmall":
+		return errEntityTooSmall
+	case "BadDigest":
+		return errBadDigest
+	}
+	switch errors.Parse(e.Error()).Code {
+	case http.StatusNotFound:
+		return notFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return &apiError{errAccessDenied.Code, errors.Parse(e.Error()).Detail, http.StatusForbidden}
+	case http.StatusBadRequest:
+		return &apiError{errInvalidArgument.Code, errors.Parse(e.Error()).Detail, http.StatusBadRequest}
+	}
+	return errInternal
+}
+
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string
+	Message   string
+	Resource  string `xml:",omitempty"`
+	RequestId string
+}
+
+type owner struct {
+	ID          string
+	DisplayName string
+}
+
+type bucketInfo struct {
+	Name         string
+	CreationDate string
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name     `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListAllMyBucketsResult"`
+	Owner   owner        `xml:"Owner"`
+	Buckets []bucketInfo `xml:"Buckets>Bucket"`
+}
+
+type locationConstraint struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ LocationConstraint"`
+	Location string   `xml:",chardata"`
+}
+
+type objectInfo struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+	Owner        *owner `xml:"Owner,omitempty"`
+}
+
+type commonPrefix struct {
+	Prefix string
+}
+
+// listBucketResult is used for both versions of ListObjects, version specific fields being omitted when empty.
+type listBucketResult struct {
+	XMLName               xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string
+	Prefix                string
+	Marker                *string `xml:"Marker,omitempty"`
+	NextMarker            string  `xml:",omitempty"`
+	StartAfter            string  `xml:",omitempty"`
+	ContinuationToken     string  `xml:",omitempty"`
+	NextContinuationToken string  `xml:",omitempty"`
+	KeyCount              *int    `xml:"KeyCount,omitempty"`
+	MaxKeys               int
+	Delimiter             string `xml:",omitempty"`
+	EncodingType          string `xml:",omitempty"`
+	IsTruncated           bool
+	Contents              []objectInfo
+	CommonPrefixes        []commonPrefix
+}
+
+type copyObjectResult struct {
+	XMLName      xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CopyObjectResult"`
+	LastModified string
+	ETag         string
+}
+
+type deleteRequest struct {
+	XMLName xml.Name `xml:"Delete"`
+	Quiet   bool
+	Objects []struct {
+		Key string
+	} `xml:"Object"`
+}
+
+type deletedObject struct {
+	Key string
+}
+
+type deleteError struct {
+	Key     string
+	Code    string
+	Message string
+}
+
+type deleteResult struct {
+	XMLName xml.Name        `xml:"http://s3.amazonaws.com/doc/2006-03-01/ DeleteResult"`
+	Deleted []deletedObject `xml:"Deleted"`
+	Errors  []deleteError   `xml:"Error"`
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
+	Bucket   string
+	Key      string
+	UploadId string
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []struct {
+		PartNumber int
+		ETag       string
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
+	Location string
+	Bucket   string
+	Key      string
+	ETag     string
+}
+
+type partInfo struct {
+	PartNumber   int
+	LastModified string
+	ETag         string
+	Size         int64
+}
+
+type listPartsResult struct {
+	XMLName              xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListPartsResult"`
+	Bucket               string
+	Key                  string
+	UploadId             string
+	Initiator            owner
+	Owner                owner
+	StorageClass         string
+	PartNumberMarker     int
+	NextPartNumberMarker int
+	MaxParts             int
+	IsTruncated          bool
+	Parts                []partInfo `xml:"Part"`
+}
+
+type listMultipartUploadsResult struct {
+	XMLName            xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListMultipartUploadsResult"`
+	Bucket             string
+	KeyMarker          string
+	UploadIdMarker     string
+	NextKeyMarker      string
+	NextUploadIdMarker string
+	Prefix             string
+	MaxUploads         int
+	IsTruncated        bool
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(s3TimeFormat)
+}
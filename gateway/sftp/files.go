@@ -0,0 +1,227 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package sftp
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/pmker/yux/common/proto/tree"
+)
+
+var (
+	errNonSequentialWrite = errors.New("non sequential writes are not supported")
+	errIncompleteWrite    = errors.New("file was closed with missing parts")
+)
+
+// maxPendingWrite bounds the memory used to buffer chunks received ahead of the current offset.
+const maxPendingWrite = 32 * 1024 * 1024
+
+// fileInfo adapts a tree node to the os.FileInfo interface.
+type fileInfo struct {
+	name string
+	node *tree.Node
+}
+
+func (fi *fileInfo) Name() string {
+	if fi.name != "" {
+		return fi.name
+	}
+	return path.Base(fi.node.Path)
+}
+
+func (fi *fileInfo) Size() int64 {
+	if fi.IsDir() {
+		return 0
+	}
+	return fi.node.Size
+}
+
+func (fi *fileInfo) Mode() os.FileMode {
+	if fi.IsDir() {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (fi *fileInfo) ModTime() time.Time {
+	if fi.node.MTime == 0 {
+		return time.Now()
+	}
+	return fi.node.GetModTime()
+}
+
+func (fi *fileInfo) IsDir() bool { return !fi.node.IsLeaf() }
+
+func (fi *fileInfo) Sys() interface{} { return nil }
+
+// listerAt serves a list of files by chunks.
+type listerAt []os.FileInfo
+
+func (l listerAt) ListAt(ls []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(ls, l[offset:])
+	if n < len(ls) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// nodeReader implements io.ReaderAt on top of object streams. Clients usually read files
+// sequentially, so the current stream is kept open and only reopened when seeking.
+type nodeReader struct {
+	sync.Mutex
+	size   int64
+	open   func(offset int64) (io.ReadCloser, error)
+	reader io.ReadCloser
+	offset int64
+}
+
+func (r *nodeReader) ReadAt(p []byte, off int64) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	if r.reader == nil || off != r.offset {
+		if r.reader != nil {
+			r.reader.Close()
+		}
+		reader, e := r.open(off)
+		if e != nil {
+			r.reader = nil
+			return 0, e
+		}
+		r.reader = reader
+		r.offset = off
+	}
+	n, e := io.ReadFull(r.reader, p)
+	r.offset += int64(n)
+	if e == io.ErrUnexpectedEOF {
+		e = io.EOF
+	}
+	return n, e
+}
+
+func (r *nodeReader) Close() error {
+	r.Lock()
+	defer r.Unlock()
+	if r.reader != nil {
+		return r.reader.Close()
+	}
+	return nil
+}
+
+// nodeWriter implements io.WriterAt by streaming the data to an object upload running in background.
+// As objects cannot be written at random offsets, chunks received ahead of the current offset (clients
+// pipeline their write requests, which are then handled concurrently) are buffered until the missing
+// parts arrive. Already written parts cannot be rewritten.
+type nodeWriter struct {
+	sync.Mutex
+	pipe     *io.PipeWriter
+	offset   int64
+	pending  map[int64][]byte
+	buffered int64
+	done     chan error
+	closed   bool
+	err      error
+}
+
+func newNodeWriter(put func(reader io.Reader) error) *nodeWriter {
+	pr, pw := io.Pipe()
+	w := &nodeWriter{pipe: pw, done: make(chan error, 1), pending: make(map[int64][]byte)}
+	go func() {
+		e := put(pr)
+		// Unblock pending writes if the upload stopped before reading everything
+		pr.CloseWithError(e)
+		w.done <- e
+	}()
+	return w
+}
+
+func (w *nodeWriter) WriteAt(p []byte, off int64) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	if off < w.offset {
+		return 0, errNonSequentialWrite
+	}
+	if off > w.offset {
+		if _, exists := w.pending[off]; exists || w.buffered+int64(len(p)) > maxPendingWrite {
+			return 0, errNonSequentialWrite
+		}
+		// p is reused by the caller, keep a copy
+		w.pending[off] = append([]byte(nil), p...)
+		w.buffered += int64(len(p))
+		return len(p), nil
+	}
+	n, e := w.pipe.Write(p)
+	w.offset += int64(n)
+	if e != nil {
+		return n, e
+	}
+	return n, w.flushPending()
+}
+
+// flushPending writes the buffered chunks that directly follow the current offset.
+func (w *nodeWriter) flushPending() error {
+	for {
+		chunk, ok := w.pending[w.offset]
+		if !ok {
+			return nil
+		}
+		delete(w.pending, w.offset)
+		w.buffered -= int64(len(chunk))
+		n, e := w.pipe.Write(chunk)
+		w.offset += int64(n)
+		if e != nil {
+			return e
+		}
+	}
+}
+
+// Close ends the stream and waits for the upload to complete. The upload is
+// aborted if some buffered chunks could not be written.
+func (w *nodeWriter) Close() error {
+	w.Lock()
+	defer w.Unlock()
+	if !w.closed {
+		w.closed = true
+		if len(w.pending) > 0 {
+			w.pending = nil
+			w.pipe.CloseWithError(errIncompleteWrite)
+			w.err = <-w.done
+			if w.err == nil {
+				w.err = errIncompleteWrite
+			}
+		} else {
+			w.pipe.Close()
+			w.err = <-w.done
+		}
+	}
+	return w.err
+}
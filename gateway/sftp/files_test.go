@@ -0,0 +1,210 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package sftp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sync"
+	"testing"
+
+	microerrors "github.com/micro/go-micro/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/proto/tree"
+)
+
+func TestListerAt(t *testing.T) {
+
+	Convey("List files by chunks", t, func() {
+		l := listerAt{
+			&fileInfo{node: &tree.Node{Path: "ws/a", Type: tree.NodeType_LEAF}},
+			&fileInfo{node: &tree.Node{Path: "ws/b", Type: tree.NodeType_COLLECTION}},
+			&fileInfo{node: &tree.Node{Path: "ws/c", Type: tree.NodeType_LEAF}},
+		}
+		buffer := make([]os.FileInfo, 2)
+		n, e := l.ListAt(buffer, 0)
+		So(e, ShouldBeNil)
+		So(n, ShouldEqual, 2)
+		So(buffer[1].Name(), ShouldEqual, "b")
+		So(buffer[1].IsDir(), ShouldBeTrue)
+
+		n, e = l.ListAt(buffer, 2)
+		So(e, ShouldEqual, io.EOF)
+		So(n, ShouldEqual, 1)
+		So(buffer[0].Name(), ShouldEqual, "c")
+
+		n, e = l.ListAt(buffer, 3)
+		So(e, ShouldEqual, io.EOF)
+		So(n, ShouldEqual, 0)
+	})
+
+}
+
+func TestNodeReader(t *testing.T) {
+
+	Convey("Read sequentially and at random offsets", t, func() {
+		content := []byte("0123456789")
+		var opened []int64
+		r := &nodeReader{
+			size: int64(len(content)),
+			open: func(offset int64) (io.ReadCloser, error) {
+				opened = append(opened, offset)
+				return ioutil.NopCloser(bytes.NewReader(content[offset:])), nil
+			},
+		}
+		p := make([]byte, 4)
+		n, e := r.ReadAt(p, 0)
+		So(e, ShouldBeNil)
+		So(string(p[:n]), ShouldEqual, "0123")
+		n, e = r.ReadAt(p, 4)
+		So(e, ShouldBeNil)
+		So(string(p[:n]), ShouldEqual, "4567")
+		So(opened, ShouldResemble, []int64{0})
+
+		n, e = r.ReadAt(p, 8)
+		So(e, ShouldEqual, io.EOF)
+		So(string(p[:n]), ShouldEqual, "89")
+
+		n, e = r.ReadAt(p, 2)
+		So(e, ShouldBeNil)
+		So(string(p[:n]), ShouldEqual, "2345")
+		So(opened, ShouldResemble, []int64{0, 2})
+
+		_, e = r.ReadAt(p, 10)
+		So(e, ShouldEqual, io.EOF)
+		So(r.Close(), ShouldBeNil)
+	})
+
+}
+
+func TestNodeWriter(t *testing.T) {
+
+	Convey("Stream sequential writes to the upload", t, func() {
+		var received []byte
+		w := newNodeWriter(func(reader io.Reader) error {
+			data, e := ioutil.ReadAll(reader)
+			received = data
+			return e
+		})
+		_, e := w.WriteAt([]byte("hello "), 0)
+		So(e, ShouldBeNil)
+		_, e = w.WriteAt([]byte("world"), 6)
+		So(e, ShouldBeNil)
+		_, e = w.WriteAt([]byte("again"), 0)
+		So(e, ShouldEqual, errNonSequentialWrite)
+		So(w.Close(), ShouldBeNil)
+		So(w.Close(), ShouldBeNil)
+		So(string(received), ShouldEqual, "hello world")
+	})
+
+	Convey("Reorder chunks written concurrently in any order", t, func() {
+		var received []byte
+		w := newNodeWriter(func(reader io.Reader) error {
+			data, e := ioutil.ReadAll(reader)
+			received = data
+			return e
+		})
+		content := bytes.Repeat([]byte("0123456789abcdef"), 1024)
+		chunkSize := 1000
+		var offsets []int
+		for off := 0; off < len(content); off += chunkSize {
+			offsets = append(offsets, off)
+		}
+		rand.Seed(42)
+		rand.Shuffle(len(offsets), func(i, j int) { offsets[i], offsets[j] = offsets[j], offsets[i] })
+
+		wg := &sync.WaitGroup{}
+		errs := make(chan error, len(offsets))
+		for _, off := range offsets {
+			end := off + chunkSize
+			if end > len(content) {
+				end = len(content)
+			}
+			wg.Add(1)
+			go func(chunk []byte, off int) {
+				defer wg.Done()
+				if _, e := w.WriteAt(chunk, int64(off)); e != nil {
+					errs <- e
+				}
+			}(append([]byte(nil), content[off:end]...), off)
+		}
+		wg.Wait()
+		close(errs)
+		So(errs, ShouldBeEmpty)
+		So(w.Close(), ShouldBeNil)
+		So(received, ShouldResemble, content)
+	})
+
+	Convey("Abort the upload when parts are missing", t, func() {
+		var readErr error
+		w := newNodeWriter(func(reader io.Reader) error {
+			_, readErr = ioutil.ReadAll(reader)
+			return readErr
+		})
+		_, e := w.WriteAt([]byte("world"), 6)
+		So(e, ShouldBeNil)
+		So(w.Close(), ShouldEqual, errIncompleteWrite)
+		So(readErr, ShouldEqual, errIncompleteWrite)
+	})
+
+	Convey("Report upload errors", t, func() {
+		failure := errors.New("upload failed")
+		w := newNodeWriter(func(reader io.Reader) error {
+			return failure
+		})
+		_, e := w.WriteAt([]byte("data"), 0)
+		So(e, ShouldEqual, failure)
+		So(w.Close(), ShouldEqual, failure)
+	})
+
+}
+
+func TestPaths(t *testing.T) {
+
+	Convey("Convert sftp paths to router paths", t, func() {
+		p, depth := routerPath("/")
+		So(p, ShouldEqual, "")
+		So(depth, ShouldEqual, 0)
+		p, depth = routerPath("/common-files/")
+		So(p, ShouldEqual, "common-files")
+		So(depth, ShouldEqual, 1)
+		p, depth = routerPath("common-files/folder/../file.txt")
+		So(p, ShouldEqual, "common-files/file.txt")
+		So(depth, ShouldEqual, 2)
+		p, depth = routerPath("/../../etc")
+		So(p, ShouldEqual, "etc")
+		So(depth, ShouldEqual, 1)
+	})
+
+	Convey("Convert router errors", t, func() {
+		So(toOsError(nil), ShouldBeNil)
+		So(toOsError(microerrors.NotFound("node", "not found")), ShouldEqual, os.ErrNotExist)
+		So(toOsError(microerrors.Forbidden("node", "forbidden")), ShouldEqual, os.ErrPermission)
+		other := errors.New("other")
+		So(toOsError(other), ShouldEqual, other)
+	})
+
+}
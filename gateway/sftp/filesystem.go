@@ -0,0 +1,245 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package sftp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/micro/go-micro/errors"
+	"github.com/pkg/sftp"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/views"
+)
+
+// FileSystem implements the sftp request handlers on top of a views Router. The root folder
+// lists the user workspaces, and paths are resolved by the standard router as workspace
+// slug followed by the path inside the workspace.
+type FileSystem struct {
+	Router *views.Router
+	// ctx carries the authenticated user
+	ctx context.Context
+}
+
+// Handlers returns the sftp request handlers serving this FileSystem.
+func (fs *FileSystem) Handlers() sftp.Handlers {
+	return sftp.Handlers{
+		FileGet:  fs,
+		FilePut:  fs,
+		FileCmd:  fs,
+		FileList: fs,
+	}
+}
+
+// Fileread opens a file for reading.
+func (fs *FileSystem) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	n, err := fs.readNode(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	if !n.IsLeaf() {
+		return nil, os.ErrInvalid
+	}
+	return &nodeReader{
+		size: n.Size,
+		open: func(offset int64) (io.ReadCloser, error) {
+			return fs.Router.GetObject(fs.ctx, n, &views.GetRequestData{StartOffset: offset, Length: n.Size - offset})
+		},
+	}, nil
+}
+
+// Filewrite opens a file for writing. The content is streamed to the storage while it is received.
+func (fs *FileSystem) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	p, depth := routerPath(r.Filepath)
+	if depth < 2 {
+		return nil, os.ErrPermission
+	}
+	if n, e := fs.readNode(r.Filepath); e == nil && !n.IsLeaf() {
+		return nil, os.ErrInvalid
+	}
+	return newNodeWriter(func(reader io.Reader) error {
+		_, e := fs.Router.PutObject(fs.ctx, &tree.Node{Path: p}, reader, &views.PutRequestData{Size: -1})
+		if e != nil {
+			log.Logger(fs.ctx).Error("SFTP upload failed", zap.String("path", p), zap.Error(e))
+		}
+		return toOsError(e)
+	}), nil
+}
+
+// Filecmd applies commands that modify the tree. Setting attributes is accepted but ignored.
+func (fs *FileSystem) Filecmd(r *sftp.Request) error {
+	p, depth := routerPath(r.Filepath)
+	switch r.Method {
+	case "Setstat":
+		return nil
+	case "Mkdir":
+		if depth < 2 {
+			return os.ErrPermission
+		}
+		_, e := fs.Router.CreateNode(fs.ctx, &tree.CreateNodeRequest{Node: &tree.Node{Path: p, Type: tree.NodeType_COLLECTION}})
+		return toOsError(e)
+	case "Rename":
+		target, targetDepth := routerPath(r.Target)
+		if depth < 2 || targetDepth < 2 {
+			return os.ErrPermission
+		}
+		if _, e := fs.readNode(r.Target); e == nil {
+			return os.ErrExist
+		}
+		_, e := fs.Router.UpdateNode(fs.ctx, &tree.UpdateNodeRequest{From: &tree.Node{Path: p}, To: &tree.Node{Path: target}})
+		return toOsError(e)
+	case "Remove", "Rmdir":
+		if depth < 2 {
+			return os.ErrPermission
+		}
+		n, e := fs.readNode(r.Filepath)
+		if e != nil {
+			return e
+		}
+		if r.Method == "Remove" && !n.IsLeaf() {
+			return os.ErrInvalid
+		}
+		if r.Method == "Rmdir" {
+			if n.IsLeaf() {
+				return os.ErrInvalid
+			}
+			children, e := fs.list(r.Filepath)
+			if e != nil {
+				return e
+			}
+			if len(children) > 0 {
+				return sftp.ErrSshFxFailure
+			}
+		}
+		_, e = fs.Router.DeleteNode(fs.ctx, &tree.DeleteNodeRequest{Node: n})
+		return toOsError(e)
+	}
+	return sftp.ErrSshFxOpUnsupported
+}
+
+// Filelist lists folders contents and stats files.
+func (fs *FileSystem) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	switch r.Method {
+	case "List":
+		children, e := fs.list(r.Filepath)
+		if e != nil {
+			return nil, e
+		}
+		return listerAt(children), nil
+	case "Stat":
+		if _, depth := routerPath(r.Filepath); depth == 0 {
+			return listerAt{&fileInfo{name: "/", node: &tree.Node{Type: tree.NodeType_COLLECTION}}}, nil
+		}
+		n, e := fs.readNode(r.Filepath)
+		if e != nil {
+			return nil, e
+		}
+		return listerAt{&fileInfo{node: n}}, nil
+	}
+	return nil, sftp.ErrSshFxOpUnsupported
+}
+
+func (fs *FileSystem) readNode(sftpPath string) (*tree.Node, error) {
+	p, _ := routerPath(sftpPath)
+	resp, e := fs.Router.ReadNode(fs.ctx, &tree.ReadNodeRequest{Node: &tree.Node{Path: p}})
+	if e != nil {
+		return nil, toOsError(e)
+	}
+	return resp.Node, nil
+}
+
+// list returns the children of a folder, or the accessible workspaces for the root folder.
+func (fs *FileSystem) list(sftpPath string) ([]os.FileInfo, error) {
+
+	var children []os.FileInfo
+	p, depth := routerPath(sftpPath)
+	if depth == 0 {
+		err := fs.Router.WrapCallback(func(inputFilter views.NodeFilter, outputFilter views.NodeFilter) error {
+			loaderCtx, _, e := inputFilter(fs.ctx, &tree.Node{Path: ""}, "tmp")
+			if e != nil {
+				return e
+			}
+			for _, ws := range views.UserWorkspacesFromContext(loaderCtx) {
+				children = append(children, &fileInfo{
+					name: ws.Slug,
+					node: &tree.Node{Type: tree.NodeType_COLLECTION, MTime: int64(ws.LastUpdated)},
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, toOsError(err)
+		}
+	} else {
+		streamer, e := fs.Router.ListNodes(fs.ctx, &tree.ListNodesRequest{Node: &tree.Node{Path: p}})
+		if e != nil {
+			return nil, toOsError(e)
+		}
+		defer streamer.Close()
+		for {
+			resp, e := streamer.Recv()
+			if resp == nil || e != nil {
+				break
+			}
+			if path.Base(resp.Node.Path) == common.PYDIO_SYNC_HIDDEN_FILE_META {
+				continue
+			}
+			children = append(children, &fileInfo{node: resp.Node})
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Name() < children[j].Name()
+	})
+	return children, nil
+
+}
+
+// routerPath converts an sftp path to a router path, returning its depth: 0 for the root, 1 for workspaces.
+func routerPath(sftpPath string) (string, int) {
+	p := strings.Trim(path.Clean("/"+sftpPath), "/")
+	if p == "" {
+		return "", 0
+	}
+	return p, strings.Count(p, "/") + 1
+}
+
+// toOsError converts router errors to the errors understood by the sftp server.
+func toOsError(e error) error {
+	if e == nil {
+		return nil
+	}
+	switch errors.Parse(e.Error()).Code {
+	case http.StatusNotFound:
+		return os.ErrNotExist
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return os.ErrPermission
+	}
+	return e
+}
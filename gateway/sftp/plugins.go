@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+// Package sftp provides an SFTP gateway exposing the user workspaces through the views router.
+package sftp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/config"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/plugins"
+	"github.com/pmker/yux/common/service"
+	"github.com/pmker/yux/common/views"
+)
+
+func init() {
+
+	plugins.Register(func() {
+		port := config.Get("services", common.SERVICE_GATEWAY_SFTP, "port").Int(2022)
+		service.NewService(
+			service.Name(common.SERVICE_GATEWAY_SFTP),
+			service.Tag(common.SERVICE_TAG_GATEWAY),
+			service.RouterDependencies(),
+			service.Description("SFTP Gateway to tree service"),
+			service.Port(fmt.Sprintf("%d", port)),
+			service.WithGeneric(func(ctx context.Context, cancel context.CancelFunc) (service.Runner, service.Checker, service.Stopper, error) {
+
+				hostKey := config.Get("services", common.SERVICE_GATEWAY_SFTP, "hostKey").String(filepath.Join(config.ApplicationDataDir(), "sftp_host_key"))
+				router := views.NewStandardRouter(views.RouterOptions{WatchRegistry: true, AuditEvent: true})
+				server, err := NewServer(ctx, router, hostKey)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+
+				return service.RunnerFunc(func() error {
+						listener, e := net.Listen("tcp", fmt.Sprintf(":%d", port))
+						if e != nil {
+							log.Logger(ctx).Error("Cannot start SFTP server", zap.Error(e))
+							return e
+						}
+						log.Logger(ctx).Info("Starting SFTP server", zap.Int("port", port))
+						server.Serve(listener)
+						return nil
+					}), service.CheckerFunc(func() error {
+						return nil
+					}), service.StopperFunc(func() error {
+						return server.Close()
+					}), nil
+			}),
+		)
+	})
+}
@@ -0,0 +1,231 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package sftp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/sftp"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/pmker/yux/common/auth"
+	"github.com/pmker/yux/common/auth/claim"
+	"github.com/pmker/yux/common/auth/mfa"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/proto/idm"
+	"github.com/pmker/yux/common/utils"
+	"github.com/pmker/yux/common/views"
+)
+
+const (
+	// PublicKeysAttribute is the user attribute storing the SSH public keys allowed to connect,
+	// one per line using the authorized_keys format.
+	PublicKeysAttribute = "ssh_public_keys"
+
+	claimsExtension = "claims"
+)
+
+// Server accepts SSH connections and serves the sftp subsystem on top of a views Router.
+type Server struct {
+	sync.Mutex
+	Router *views.Router
+
+	ctx      context.Context
+	config   *ssh.ServerConfig
+	listener net.Listener
+}
+
+// NewServer creates a Server using the host key found in hostKeyFile, generating it if it does not exist yet.
+func NewServer(ctx context.Context, router *views.Router, hostKeyFile string) (*Server, error) {
+
+	signer, e := loadHostKey(hostKeyFile)
+	if e != nil {
+		return nil, e
+	}
+	s := &Server{Router: router, ctx: ctx}
+	s.config = &ssh.ServerConfig{
+		PasswordCallback:  s.checkPassword,
+		PublicKeyCallback: s.checkPublicKey,
+	}
+	s.config.AddHostKey(signer)
+	return s, nil
+
+}
+
+// Serve accepts connections on the listener until it is closed.
+func (s *Server) Serve(l net.Listener) error {
+	s.Lock()
+	s.listener = l
+	s.Unlock()
+	for {
+		conn, e := l.Accept()
+		if e != nil {
+			return e
+		}
+		go s.handleConn(conn)
+	}
+}
+
+// Close stops listening for new connections.
+func (s *Server) Close() error {
+	s.Lock()
+	defer s.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+func (s *Server) checkPassword(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	if auth.IsPersonalAccessToken(string(password)) {
+		_, claims, e := auth.DefaultJWTVerifier().Verify(s.ctx, string(password))
+		if e == nil && claims.Name == conn.User() {
+			return permissions(claims)
+		}
+		// The password may simply look like a token
+		log.Logger(s.ctx).Debug("SFTP token authentication failed", zap.String("login", conn.User()), zap.Error(e))
+	}
+	_, claims, e := auth.DefaultJWTVerifier().PasswordCredentialsToken(s.ctx, conn.User(), string(password))
+	if e != nil {
+		log.Logger(s.ctx).Debug("SFTP password authentication failed", zap.String("login", conn.User()), zap.Error(e))
+		return nil, fmt.Errorf("authentication failed for %s", conn.User())
+	}
+	return permissions(claims)
+}
+
+func (s *Server) checkPublicKey(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	user, e := utils.SearchUniqueUser(s.ctx, conn.User(), "")
+	if e != nil || utils.IsUserLocked(user) || !mfa.AcceptsCredentials(user) || !authorizedKey(user, key) {
+		return nil, fmt.Errorf("public key refused for %s", conn.User())
+	}
+	return permissions(auth.ClaimsFromUser(user, claim.AuthMethodPublicKey))
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+
+	sshConn, channels, requests, e := ssh.NewServerConn(conn, s.config)
+	if e != nil {
+		log.Logger(s.ctx).Debug("SFTP handshake failed", zap.String("remote", conn.RemoteAddr().String()), zap.Error(e))
+		conn.Close()
+		return
+	}
+	defer sshConn.Close()
+	go ssh.DiscardRequests(requests)
+
+	var claims claim.Claims
+	if e := json.Unmarshal([]byte(sshConn.Permissions.Extensions[claimsExtension]), &claims); e != nil {
+		return
+	}
+	fs := &FileSystem{Router: s.Router, ctx: auth.WithClaims(s.ctx, claims)}
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, reqs, e := newChannel.Accept()
+		if e != nil {
+			log.Logger(s.ctx).Error("SFTP cannot accept channel", zap.Error(e))
+			continue
+		}
+		go acceptSubsystem(reqs)
+		go func() {
+			server := sftp.NewRequestServer(channel, fs.Handlers())
+			if e := server.Serve(); e != nil && e != io.EOF {
+				log.Logger(s.ctx).Debug("SFTP session ended", zap.String("login", claims.Name), zap.Error(e))
+			}
+			server.Close()
+		}()
+	}
+
+}
+
+// acceptSubsystem only accepts requests for the sftp subsystem.
+func acceptSubsystem(requests <-chan *ssh.Request) {
+	for req := range requests {
+		ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+		req.Reply(ok, nil)
+	}
+}
+
+// permissions stores the claims inside the connection permissions.
+func permissions(claims claim.Claims) (*ssh.Permissions, error) {
+	data, e := json.Marshal(claims)
+	if e != nil {
+		return nil, e
+	}
+	return &ssh.Permissions{Extensions: map[string]string{claimsExtension: string(data)}}, nil
+}
+
+// authorizedKey checks whether the key is listed in the user public keys attribute.
+func authorizedKey(user *idm.User, key ssh.PublicKey) bool {
+	keys, ok := user.Attributes[PublicKeysAttribute]
+	if !ok {
+		return false
+	}
+	marshaled := key.Marshal()
+	for _, line := range strings.Split(keys, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		authorized, _, _, _, e := ssh.ParseAuthorizedKey([]byte(line))
+		if e != nil {
+			continue
+		}
+		if bytes.Equal(authorized.Marshal(), marshaled) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadHostKey reads a PEM encoded private key, or generates and stores a new RSA key if the file is missing.
+func loadHostKey(file string) (ssh.Signer, error) {
+	data, e := ioutil.ReadFile(file)
+	if os.IsNotExist(e) {
+		key, e := rsa.GenerateKey(rand.Reader, 2048)
+		if e != nil {
+			return nil, e
+		}
+		data = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+		if e := ioutil.WriteFile(file, data, 0600); e != nil {
+			return nil, e
+		}
+	} else if e != nil {
+		return nil, e
+	}
+	return ssh.ParsePrivateKey(data)
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package sftp
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/pmker/yux/common/proto/idm"
+)
+
+func TestAuthorizedKey(t *testing.T) {
+
+	Convey("Match public keys against user attributes", t, func() {
+		key1, e := rsa.GenerateKey(rand.Reader, 1024)
+		So(e, ShouldBeNil)
+		key2, e := rsa.GenerateKey(rand.Reader, 1024)
+		So(e, ShouldBeNil)
+		pub1, _ := ssh.NewPublicKey(&key1.PublicKey)
+		pub2, _ := ssh.NewPublicKey(&key2.PublicKey)
+
+		user := &idm.User{Login: "user", Attributes: map[string]string{}}
+		So(authorizedKey(user, pub1), ShouldBeFalse)
+
+		user.Attributes[PublicKeysAttribute] = "# laptop\n\ninvalid line\n" + string(ssh.MarshalAuthorizedKey(pub1))
+		So(authorizedKey(user, pub1), ShouldBeTrue)
+		So(authorizedKey(user, pub2), ShouldBeFalse)
+	})
+
+}
+
+func TestHostKey(t *testing.T) {
+
+	Convey("Generate then reload the host key", t, func() {
+		dir, e := ioutil.TempDir("", "sftp")
+		So(e, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "host_key")
+		signer, e := loadHostKey(file)
+		So(e, ShouldBeNil)
+		reloaded, e := loadHostKey(file)
+		So(e, ShouldBeNil)
+		So(reloaded.PublicKey().Marshal(), ShouldResemble, signer.PublicKey().Marshal())
+	})
+
+}
@@ -0,0 +1,565 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package tus
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/errors"
+	"github.com/pborman/uuid"
+	minio "github.com/pydio/minio-go"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/auth/claim"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/proto/object"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/views"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,expiration"
+	offsetContent = "application/offset+octet-stream"
+)
+
+var (
+	// Size of the parts sent to the datasource: S3 requires at least 5MB for all parts but the last one.
+	partSize int64 = 8 * 1024 * 1024
+)
+
+// Handler serves the tus resumable upload protocol (https://tus.io/protocols/resumable-upload.html)
+// by mapping each tus upload onto a multipart upload of the views router.
+type Handler struct {
+	Router views.Handler
+	// AdminRouter aborts the expired uploads, when the owner context is not available anymore
+	AdminRouter views.Handler
+	Store       *BoltStore
+	// StagingDir keeps the received bytes until they fill a part
+	StagingDir string
+	Prefix     string
+	TTL        time.Duration
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// NewHandler creates a tus Handler serving requests under the given prefix.
+func NewHandler(router views.Handler, adminRouter views.Handler, store *BoltStore, stagingDir string, prefix string, ttl time.Duration) *Handler {
+	return &Handler{
+		Router:      router,
+		AdminRouter: adminRouter,
+		Store:       store,
+		StagingDir:  stagingDir,
+		Prefix:      prefix,
+		TTL:         ttl,
+		locks:       make(map[string]*sync.Mutex),
+	}
+}
+
+// ServeHTTP dispatches the tus requests.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", tusExtensions)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "unsupported tus version", http.StatusPreconditionFailed)
+		return
+	}
+	if currentUser(r.Context()) == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	method := r.Method
+	if override := r.Header.Get("X-HTTP-Method-Override"); override != "" {
+		method = override
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, h.Prefix), "/")
+	switch {
+	case id == "" && method == http.MethodPost:
+		h.create(w, r)
+	case id != "" && method == http.MethodHead:
+		h.head(w, r, id)
+	case id != "" && method == http.MethodPatch:
+		h.patch(w, r, id)
+	case id != "" && method == http.MethodDelete:
+		h.terminate(w, r, id)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// create starts a new upload. The target is read from the "path" metadata, or from the "dir" and "filename" metadata.
+// Upload limits and quotas are checked against the announced Upload-Length before anything is received.
+// Empty files are created at once, and their upload is recorded as completed so that its location still resolves.
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+	length, e := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if e != nil || length < 0 {
+		http.Error(w, "missing or invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+	metadata, e := parseMetadata(r.Header.Get("Upload-Metadata"))
+	if e != nil {
+		http.Error(w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	target, e := targetPath(metadata)
+	if e != nil {
+		http.Error(w, e.Error(), http.StatusBadRequest)
+		return
+	}
+	node := &tree.Node{Path: target}
+	treePath, info := h.resolve(ctx, node)
+	now := time.Now().Unix()
+	upload := &Upload{
+		ID:       uuid.New(),
+		Owner:    currentUser(ctx),
+		Path:     target,
+		TreePath: treePath,
+		Length:   length,
+		Metadata: metadata,
+		Created:  now,
+		Updated:  now,
+	}
+
+	if length == 0 {
+		if _, e := h.Router.PutObject(ctx, node, strings.NewReader(""), &views.PutRequestData{Size: 0}); e != nil {
+			writeError(w, e)
+			return
+		}
+		upload.Completed = true
+		if e := h.Store.Put(upload); e != nil {
+			writeError(w, e)
+			return
+		}
+		w.Header().Set("Location", h.location(r, upload.ID))
+		w.Header().Set("Upload-Offset", "0")
+		w.Header().Set("Upload-Expires", upload.Expires(h.TTL).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	// Uploads are sent as multipart uploads, which cannot be encrypted
+	if info.EncryptionMode != object.EncryptionMode_CLEAR {
+		http.Error(w, "resumable uploads are not supported on encrypted datasources", http.StatusBadRequest)
+		return
+	}
+	multipartId, e := h.Router.MultipartCreate(ctx, node, &views.MultipartRequestData{Size: length})
+	if e != nil {
+		writeError(w, e)
+		return
+	}
+	upload.MultipartID = multipartId
+	if e := h.Store.Put(upload); e != nil {
+		h.Router.MultipartAbort(ctx, node, multipartId, &views.MultipartRequestData{})
+		writeError(w, e)
+		return
+	}
+	log.Logger(ctx).Debug("Created tus upload", zap.String("id", upload.ID), zap.String("path", target), zap.Int64("length", length))
+
+	w.Header().Set("Location", h.location(r, upload.ID))
+	w.Header().Set("Upload-Expires", upload.Expires(h.TTL).UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// head returns the current offset of an upload, so that the client knows where to resume.
+func (h *Handler) head(w http.ResponseWriter, r *http.Request, id string) {
+
+	upload, ok := h.load(w, r, id)
+	if !ok {
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset(), 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if len(upload.Metadata) > 0 {
+		w.Header().Set("Upload-Metadata", encodeMetadata(upload.Metadata))
+	}
+	w.Header().Set("Upload-Expires", upload.Expires(h.TTL).UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+}
+
+// patch appends the request body at the given offset and completes the upload when all bytes are received.
+func (h *Handler) patch(w http.ResponseWriter, r *http.Request, id string) {
+
+	ctx := r.Context()
+	if r.Header.Get("Content-Type") != offsetContent {
+		http.Error(w, "invalid Content-Type", http.StatusUnsupportedMediaType)
+		return
+	}
+	unlock := h.lock(id)
+	defer unlock()
+
+	upload, ok := h.load(w, r, id)
+	if !ok {
+		return
+	}
+	offset, e := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if e != nil {
+		http.Error(w, "missing or invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+	if offset != upload.Offset() {
+		http.Error(w, "offset does not match", http.StatusConflict)
+		return
+	}
+	if upload.Completed {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset(), 10))
+		w.Header().Set("Upload-Expires", upload.Expires(h.TTL).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	e = h.receive(ctx, upload, r.Body)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset(), 10))
+	w.Header().Set("Upload-Expires", upload.Expires(h.TTL).UTC().Format(http.TimeFormat))
+	if e != nil {
+		log.Logger(ctx).Error("Interrupted tus upload", zap.String("id", id), zap.Int64("offset", upload.Offset()), zap.Error(e))
+		writeError(w, e)
+		return
+	}
+	if upload.Offset() == upload.Length {
+		if e := h.finalize(ctx, upload); e != nil {
+			writeError(w, e)
+			return
+		}
+		log.Logger(ctx).Debug("Completed tus upload", zap.String("id", id), zap.String("path", upload.Path))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// terminate aborts an upload on client request. Completed uploads are only forgotten.
+func (h *Handler) terminate(w http.ResponseWriter, r *http.Request, id string) {
+
+	unlock := h.lock(id)
+	defer unlock()
+
+	upload, ok := h.load(w, r, id)
+	if !ok {
+		return
+	}
+	if !upload.Completed {
+		if e := h.Router.MultipartAbort(r.Context(), &tree.Node{Path: upload.Path}, upload.MultipartID, &views.MultipartRequestData{}); e != nil {
+			log.Logger(r.Context()).Error("Cannot abort multipart upload", zap.String("id", id), zap.Error(e))
+		}
+	}
+	h.remove(upload.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CleanExpired aborts the uploads that were not resumed before their expiration, and forgets the completed ones.
+func (h *Handler) CleanExpired(ctx context.Context) error {
+
+	expired, e := h.Store.Expired(h.TTL, time.Now())
+	if e != nil {
+		return e
+	}
+	ctx = context.WithValue(ctx, common.PYDIO_CONTEXT_USER_KEY, common.PYDIO_SYSTEM_USERNAME)
+	for _, upload := range expired {
+		unlock := h.lock(upload.ID)
+		if upload.Completed {
+			h.remove(upload.ID)
+			unlock()
+			continue
+		}
+		if e := h.AdminRouter.MultipartAbort(ctx, &tree.Node{Path: upload.TreePath}, upload.MultipartID, &views.MultipartRequestData{}); e != nil {
+			log.Logger(ctx).Error("Cannot abort expired upload", zap.String("id", upload.ID), zap.String("path", upload.TreePath), zap.Error(e))
+		}
+		h.remove(upload.ID)
+		unlock()
+		log.Logger(ctx).Info("Removed expired upload", zap.String("id", upload.ID), zap.String("owner", upload.Owner), zap.String("path", upload.Path))
+	}
+	return nil
+}
+
+// Janitor periodically calls CleanExpired until the context is done.
+func (h *Handler) Janitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if e := h.CleanExpired(ctx); e != nil {
+				log.Logger(ctx).Error("Cannot clean expired uploads", zap.Error(e))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// receive copies the body to the staging file and sends a part each time the staging file is full.
+// The state is saved after each step, so that whatever was received survives a dropped connection.
+func (h *Handler) receive(ctx context.Context, upload *Upload, body io.Reader) error {
+
+	f, e := os.OpenFile(h.stagingPath(upload.ID), os.O_RDWR|os.O_CREATE, 0600)
+	if e != nil {
+		return e
+	}
+	defer f.Close()
+	// Drop bytes that may have been written but not recorded before a crash
+	if e := f.Truncate(upload.Staged); e != nil {
+		return e
+	}
+	if _, e := f.Seek(upload.Staged, io.SeekStart); e != nil {
+		return e
+	}
+
+	body = io.LimitReader(body, upload.Length-upload.Offset())
+	for upload.Offset() < upload.Length {
+		n, readErr := io.CopyN(f, body, partSize-upload.Staged)
+		if e := f.Sync(); e != nil {
+			return e
+		}
+		upload.Staged += n
+		upload.Updated = time.Now().Unix()
+		if upload.Staged == partSize && upload.Offset() < upload.Length {
+			if e := h.flushPart(ctx, upload, f); e != nil {
+				h.Store.Put(upload)
+				return e
+			}
+		}
+		if e := h.Store.Put(upload); e != nil {
+			return e
+		}
+		if readErr == io.EOF {
+			return nil
+		} else if readErr != nil {
+			return readErr
+		}
+	}
+	return nil
+}
+
+// flushPart sends the staging file content as the next part of the multipart upload.
+func (h *Handler) flushPart(ctx context.Context, upload *Upload, f *os.File) error {
+
+	if _, e := f.Seek(0, io.SeekStart); e != nil {
+		return e
+	}
+	number := len(upload.Parts) + 1
+	part, e := h.Router.MultipartPutObjectPart(ctx, &tree.Node{Path: upload.Path}, upload.MultipartID, number, io.LimitReader(f, upload.Staged), &views.PutRequestData{
+		Size:              upload.Staged,
+		MultipartUploadID: upload.MultipartID,
+		MultipartPartID:   number,
+	})
+	if e != nil {
+		return e
+	}
+	upload.Parts = append(upload.Parts, &Part{Number: number, ETag: strings.Trim(part.ETag, `"`), Size: upload.Staged})
+	upload.Staged = 0
+	if e := f.Truncate(0); e != nil {
+		return e
+	}
+	_, e = f.Seek(0, io.SeekStart)
+	return e
+}
+
+// finalize sends the remaining bytes and completes the multipart upload.
+func (h *Handler) finalize(ctx context.Context, upload *Upload) error {
+
+	if upload.Staged > 0 {
+		f, e := os.OpenFile(h.stagingPath(upload.ID), os.O_RDWR, 0600)
+		if e != nil {
+			return e
+		}
+		e = h.flushPart(ctx, upload, f)
+		f.Close()
+		if e != nil {
+			return e
+		}
+		if e := h.Store.Put(upload); e != nil {
+			return e
+		}
+	}
+	var parts []minio.CompletePart
+	for _, p := range upload.Parts {
+		parts = append(parts, minio.CompletePart{PartNumber: p.Number, ETag: p.ETag})
+	}
+	if _, e := h.Router.MultipartComplete(ctx, &tree.Node{Path: upload.Path}, upload.MultipartID, parts); e != nil {
+		return e
+	}
+	h.remove(upload.ID)
+	return nil
+}
+
+// load finds an upload belonging to the current user, or writes a 404.
+func (h *Handler) load(w http.ResponseWriter, r *http.Request, id string) (*Upload, bool) {
+	upload, e := h.Store.Get(id)
+	if e != nil {
+		writeError(w, e)
+		return nil, false
+	}
+	if upload == nil || upload.Owner != currentUser(r.Context()) {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return nil, false
+	}
+	return upload, true
+}
+
+func (h *Handler) remove(id string) {
+	h.Store.Delete(id)
+	os.Remove(h.stagingPath(id))
+	h.mu.Lock()
+	delete(h.locks, id)
+	h.mu.Unlock()
+}
+
+// lock serializes the requests on a given upload.
+func (h *Handler) lock(id string) func() {
+	h.mu.Lock()
+	l, ok := h.locks[id]
+	if !ok {
+		l = &sync.Mutex{}
+		h.locks[id] = l
+	}
+	h.mu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+func (h *Handler) stagingPath(id string) string {
+	return filepath.Join(h.StagingDir, id)
+}
+
+func (h *Handler) location(r *http.Request, id string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + h.Prefix + "/" + id
+}
+
+// resolve computes the path of the node in the tree, as seen by an admin, and finds the datasource storing it.
+func (h *Handler) resolve(ctx context.Context, node *tree.Node) (treePath string, info views.BranchInfo) {
+	h.Router.ExecuteWrapped(nil, nil, func(inputFilter views.NodeFilter, outputFilter views.NodeFilter) error {
+		resolvedCtx, resolved, e := inputFilter(ctx, node.Clone(), "in")
+		if e == nil && resolved != nil {
+			treePath = resolved.Path
+			info, _ = views.GetBranchInfo(resolvedCtx, "in")
+		}
+		return e
+	})
+	return
+}
+
+func currentUser(ctx context.Context) string {
+	if claims, ok := ctx.Value(claim.ContextKey).(claim.Claims); ok {
+		return claims.Name
+	}
+	return ""
+}
+
+// parseMetadata decodes the Upload-Metadata header: comma-separated pairs of a key and a base64 encoded value.
+func parseMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, " ", 2)
+		value := ""
+		if len(parts) == 2 {
+			decoded, e := base64.StdEncoding.DecodeString(strings.TrimSpace(parts[1]))
+			if e != nil {
+				return nil, fmt.Errorf("invalid Upload-Metadata value for key %s", parts[0])
+			}
+			value = string(decoded)
+		}
+		metadata[parts[0]] = value
+	}
+	return metadata, nil
+}
+
+func encodeMetadata(metadata map[string]string) string {
+	var keys []string
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		if metadata[k] == "" {
+			pairs = append(pairs, k)
+		} else {
+			pairs = append(pairs, k+" "+base64.StdEncoding.EncodeToString([]byte(metadata[k])))
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+// targetPath reads the path of the file to create from the upload metadata.
+func targetPath(metadata map[string]string) (string, error) {
+	target := metadata["path"]
+	if target == "" && metadata["filename"] != "" {
+		target = path.Join(metadata["dir"], path.Base(metadata["filename"]))
+	}
+	if target == "" {
+		return "", fmt.Errorf("please provide the target in a path or filename metadata")
+	}
+	for _, segment := range strings.Split(target, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("invalid target path")
+		}
+	}
+	target = strings.Trim(path.Clean("/"+target), "/")
+	if target == "" || !strings.Contains(target, "/") {
+		return "", fmt.Errorf("target must be a file inside a workspace")
+	}
+	return target, nil
+}
+
+// writeError converts micro errors to the corresponding HTTP status.
+func writeError(w http.ResponseWriter, e error) {
+	parsed := errors.Parse(e.Error())
+	status := int(parsed.Code)
+	if status < 400 || status > 599 {
+		status = http.StatusInternalServerError
+	}
+	detail := parsed.Detail
+	if detail == "" {
+		detail = e.Error()
+	}
+	http.Error(w, detail, status)
+}
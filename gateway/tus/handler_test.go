@@ -0,0 +1,309 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package tus
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	minio "github.com/pydio/minio-go"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/auth/claim"
+	"github.com/pmker/yux/common/proto/object"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/views"
+)
+
+// multipartMock keeps the parts in memory and assembles them on completion.
+// Nodes under "encrypted/" are resolved to an encrypted datasource.
+type multipartMock struct {
+	*views.HandlerMock
+	createSize int64
+	parts      map[int][]byte
+	content    []byte
+	aborted    []string
+}
+
+func (m *multipartMock) ExecuteWrapped(inputFilter views.NodeFilter, outputFilter views.NodeFilter, provider views.NodesCallback) error {
+	resolve := func(ctx context.Context, node *tree.Node, identifier string) (context.Context, *tree.Node, error) {
+		info := views.BranchInfo{}
+		if strings.HasPrefix(node.Path, "encrypted/") {
+			info.EncryptionMode = object.EncryptionMode_MASTER
+		}
+		node.Path = path.Join("datasource", node.Path)
+		return views.WithBranchInfo(ctx, identifier, info), node, nil
+	}
+	return provider(resolve, resolve)
+}
+
+func (m *multipartMock) MultipartCreate(ctx context.Context, target *tree.Node, requestData *views.MultipartRequestData) (string, error) {
+	m.createSize = requestData.Size
+	m.parts = make(map[int][]byte)
+	return "multipart-id", nil
+}
+
+func (m *multipartMock) MultipartPutObjectPart(ctx context.Context, target *tree.Node, uploadID string, partNumberMarker int, reader io.Reader, requestData *views.PutRequestData) (minio.ObjectPart, error) {
+	data, e := ioutil.ReadAll(reader)
+	if e != nil {
+		return minio.ObjectPart{}, e
+	}
+	m.parts[partNumberMarker] = data
+	return minio.ObjectPart{PartNumber: partNumberMarker, ETag: fmt.Sprintf(`"etag-%d"`, partNumberMarker), Size: int64(len(data))}, nil
+}
+
+func (m *multipartMock) MultipartComplete(ctx context.Context, target *tree.Node, uploadID string, uploadedParts []minio.CompletePart) (minio.ObjectInfo, error) {
+	m.content = nil
+	for i, p := range uploadedParts {
+		if p.PartNumber != i+1 || p.ETag != fmt.Sprintf("etag-%d", p.PartNumber) {
+			return minio.ObjectInfo{}, fmt.Errorf("invalid part %d", p.PartNumber)
+		}
+		m.content = append(m.content, m.parts[p.PartNumber]...)
+	}
+	return minio.ObjectInfo{Size: int64(len(m.content))}, nil
+}
+
+func (m *multipartMock) MultipartAbort(ctx context.Context, target *tree.Node, uploadID string, requestData *views.MultipartRequestData) error {
+	m.aborted = append(m.aborted, target.Path)
+	return nil
+}
+
+func tusRequest(method string, url string, user string, body []byte, headers map[string]string) *http.Request {
+	r := httptest.NewRequest(method, url, bytes.NewReader(body))
+	r.Header.Set("Tus-Resumable", tusVersion)
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	if user != "" {
+		r = r.WithContext(context.WithValue(r.Context(), claim.ContextKey, claim.Claims{Name: user}))
+	}
+	return r
+}
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestHandler(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "tus")
+	defer os.RemoveAll(dir)
+	store, e := NewBoltStore(filepath.Join(dir, "uploads.db"), true)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer store.Close()
+
+	defaultPartSize := partSize
+	partSize = 4
+	defer func() {
+		partSize = defaultPartSize
+	}()
+
+	mock := &multipartMock{HandlerMock: views.NewHandlerMock()}
+	handler := NewHandler(mock, mock, store, dir, "/tus", time.Hour)
+	metadata := "path " + base64.StdEncoding.EncodeToString([]byte("personal/file.bin"))
+
+	create := func(user string) string {
+		w := serve(handler, tusRequest(http.MethodPost, "/tus/", user, nil, map[string]string{
+			"Upload-Length":   "10",
+			"Upload-Metadata": metadata,
+		}))
+		So(w.Code, ShouldEqual, http.StatusCreated)
+		return path.Base(w.Header().Get("Location"))
+	}
+
+	Convey("Protocol discovery and authentication", t, func() {
+		w := serve(handler, httptest.NewRequest(http.MethodOptions, "/tus/", nil))
+		So(w.Code, ShouldEqual, http.StatusNoContent)
+		So(w.Header().Get("Tus-Version"), ShouldEqual, tusVersion)
+		So(w.Header().Get("Tus-Extension"), ShouldContainSubstring, "creation")
+
+		r := tusRequest(http.MethodPost, "/tus/", "alice", nil, nil)
+		r.Header.Del("Tus-Resumable")
+		So(serve(handler, r).Code, ShouldEqual, http.StatusPreconditionFailed)
+		So(serve(handler, tusRequest(http.MethodPost, "/tus/", "", nil, nil)).Code, ShouldEqual, http.StatusUnauthorized)
+		So(serve(handler, tusRequest(http.MethodPost, "/tus/", "alice", nil, map[string]string{"Upload-Metadata": metadata})).Code, ShouldEqual, http.StatusBadRequest)
+	})
+
+	Convey("Upload a file in several requests", t, func() {
+		id := create("alice")
+		So(mock.createSize, ShouldEqual, 10)
+
+		w := serve(handler, tusRequest(http.MethodHead, "/tus/"+id, "alice", nil, nil))
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Header().Get("Upload-Offset"), ShouldEqual, "0")
+		So(w.Header().Get("Upload-Length"), ShouldEqual, "10")
+		So(w.Header().Get("Upload-Metadata"), ShouldEqual, metadata)
+
+		So(serve(handler, tusRequest(http.MethodHead, "/tus/"+id, "bob", nil, nil)).Code, ShouldEqual, http.StatusNotFound)
+
+		patch := map[string]string{"Content-Type": offsetContent, "Upload-Offset": "0"}
+		w = serve(handler, tusRequest(http.MethodPatch, "/tus/"+id, "alice", []byte("abcdef"), patch))
+		So(w.Code, ShouldEqual, http.StatusNoContent)
+		So(w.Header().Get("Upload-Offset"), ShouldEqual, "6")
+		So(mock.parts, ShouldHaveLength, 1)
+
+		// Replaying the same chunk is refused
+		So(serve(handler, tusRequest(http.MethodPatch, "/tus/"+id, "alice", []byte("abcdef"), patch)).Code, ShouldEqual, http.StatusConflict)
+
+		patch["Upload-Offset"] = "6"
+		w = serve(handler, tusRequest(http.MethodPatch, "/tus/"+id, "alice", []byte("ghij"), patch))
+		So(w.Code, ShouldEqual, http.StatusNoContent)
+		So(w.Header().Get("Upload-Offset"), ShouldEqual, "10")
+		So(string(mock.content), ShouldEqual, "abcdefghij")
+		So(mock.parts, ShouldHaveLength, 3)
+
+		So(serve(handler, tusRequest(http.MethodHead, "/tus/"+id, "alice", nil, nil)).Code, ShouldEqual, http.StatusNotFound)
+		_, e := os.Stat(filepath.Join(dir, id))
+		So(os.IsNotExist(e), ShouldBeTrue)
+	})
+
+	Convey("Resume after an interrupted request", t, func() {
+		id := create("alice")
+		patch := map[string]string{"Content-Type": offsetContent, "Upload-Offset": "0"}
+		r := tusRequest(http.MethodPatch, "/tus/"+id, "alice", nil, patch)
+		r.Body = ioutil.NopCloser(io.MultiReader(strings.NewReader("abc"), &failingReader{}))
+		So(serve(handler, r).Code, ShouldEqual, http.StatusInternalServerError)
+
+		w := serve(handler, tusRequest(http.MethodHead, "/tus/"+id, "alice", nil, nil))
+		So(w.Header().Get("Upload-Offset"), ShouldEqual, "3")
+
+		patch["Upload-Offset"] = "3"
+		w = serve(handler, tusRequest(http.MethodPatch, "/tus/"+id, "alice", []byte("defghij"), patch))
+		So(w.Code, ShouldEqual, http.StatusNoContent)
+		So(string(mock.content), ShouldEqual, "abcdefghij")
+	})
+
+	Convey("Terminate and expire uploads", t, func() {
+		mock.aborted = nil
+		id := create("alice")
+		So(serve(handler, tusRequest(http.MethodDelete, "/tus/"+id, "bob", nil, nil)).Code, ShouldEqual, http.StatusNotFound)
+		So(serve(handler, tusRequest(http.MethodDelete, "/tus/"+id, "alice", nil, nil)).Code, ShouldEqual, http.StatusNoContent)
+		So(mock.aborted, ShouldResemble, []string{"personal/file.bin"})
+
+		id = create("alice")
+		handler.TTL = 0
+		So(handler.CleanExpired(context.Background()), ShouldBeNil)
+		handler.TTL = time.Hour
+		So(mock.aborted, ShouldResemble, []string{"personal/file.bin", "datasource/personal/file.bin"})
+		So(serve(handler, tusRequest(http.MethodHead, "/tus/"+id, "alice", nil, nil)).Code, ShouldEqual, http.StatusNotFound)
+	})
+
+	Convey("Upload an empty file", t, func() {
+		mock.aborted = nil
+		w := serve(handler, tusRequest(http.MethodPost, "/tus/", "alice", nil, map[string]string{
+			"Upload-Length":   "0",
+			"Upload-Metadata": "path " + base64.StdEncoding.EncodeToString([]byte("personal/empty.txt")),
+		}))
+		So(w.Code, ShouldEqual, http.StatusCreated)
+		So(mock.Nodes["in"].Path, ShouldEqual, "personal/empty.txt")
+		id := path.Base(w.Header().Get("Location"))
+
+		w = serve(handler, tusRequest(http.MethodHead, "/tus/"+id, "alice", nil, nil))
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Header().Get("Upload-Offset"), ShouldEqual, "0")
+		So(w.Header().Get("Upload-Length"), ShouldEqual, "0")
+
+		w = serve(handler, tusRequest(http.MethodPatch, "/tus/"+id, "alice", nil, map[string]string{"Content-Type": offsetContent, "Upload-Offset": "0"}))
+		So(w.Code, ShouldEqual, http.StatusNoContent)
+		So(w.Header().Get("Upload-Offset"), ShouldEqual, "0")
+
+		handler.TTL = 0
+		So(handler.CleanExpired(context.Background()), ShouldBeNil)
+		handler.TTL = time.Hour
+		So(mock.aborted, ShouldBeEmpty)
+		So(serve(handler, tusRequest(http.MethodHead, "/tus/"+id, "alice", nil, nil)).Code, ShouldEqual, http.StatusNotFound)
+	})
+
+	Convey("Uploads to encrypted datasources are refused", t, func() {
+		mock.createSize = 0
+		w := serve(handler, tusRequest(http.MethodPost, "/tus/", "alice", nil, map[string]string{
+			"Upload-Length":   "10",
+			"Upload-Metadata": "path " + base64.StdEncoding.EncodeToString([]byte("encrypted/file.bin")),
+		}))
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(w.Body.String(), ShouldContainSubstring, "encrypted")
+		So(mock.createSize, ShouldEqual, 0)
+
+		// Empty files do not need a multipart upload
+		w = serve(handler, tusRequest(http.MethodPost, "/tus/", "alice", nil, map[string]string{
+			"Upload-Length":   "0",
+			"Upload-Metadata": "path " + base64.StdEncoding.EncodeToString([]byte("encrypted/empty.txt")),
+		}))
+		So(w.Code, ShouldEqual, http.StatusCreated)
+	})
+}
+
+type failingReader struct{}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	return 0, fmt.Errorf("connection reset")
+}
+
+func TestMetadata(t *testing.T) {
+
+	Convey("Parse and encode Upload-Metadata", t, func() {
+		header := "filename " + base64.StdEncoding.EncodeToString([]byte("report.pdf")) + ",dir " + base64.StdEncoding.EncodeToString([]byte("common-files/docs")) + ",is_confidential"
+		metadata, e := parseMetadata(header)
+		So(e, ShouldBeNil)
+		So(metadata["filename"], ShouldEqual, "report.pdf")
+		So(metadata, ShouldContainKey, "is_confidential")
+
+		keys := strings.Split(encodeMetadata(metadata), ",")
+		So(sort.StringsAreSorted(keys), ShouldBeTrue)
+
+		_, e = parseMetadata("filename not-base64!")
+		So(e, ShouldNotBeNil)
+	})
+
+	Convey("Compute target path", t, func() {
+		target, e := targetPath(map[string]string{"filename": "report.pdf", "dir": "common-files/docs"})
+		So(e, ShouldBeNil)
+		So(target, ShouldEqual, "common-files/docs/report.pdf")
+
+		target, e = targetPath(map[string]string{"path": "/personal/a//b.txt"})
+		So(e, ShouldBeNil)
+		So(target, ShouldEqual, "personal/a/b.txt")
+
+		_, e = targetPath(map[string]string{"path": "personal/../../etc/passwd"})
+		So(e, ShouldNotBeNil)
+		_, e = targetPath(map[string]string{"filename": "file.txt"})
+		So(e, ShouldNotBeNil)
+		_, e = targetPath(map[string]string{})
+		So(e, ShouldNotBeNil)
+	})
+}
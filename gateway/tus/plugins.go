@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+// Package tus provides a gateway implementing the tus.io resumable upload protocol on top of the views router.
+//
+// Clients create an upload with a POST on /tus/ announcing the Upload-Length and the target path in the
+// Upload-Metadata header (either a "path" key, or "dir" and "filename" keys), then send the content with PATCH
+// requests. The offset is persisted so that an interrupted upload can be resumed, and uploads that are not resumed
+// before their expiration are aborted.
+package tus
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	micro "github.com/micro/go-micro"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/config"
+	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/plugins"
+	"github.com/pmker/yux/common/service"
+	"github.com/pmker/yux/common/views"
+)
+
+func init() {
+	plugins.Register(func() {
+		service.NewService(
+			service.Name(common.SERVICE_GATEWAY_TUS),
+			service.Tag(common.SERVICE_TAG_GATEWAY),
+			service.RouterDependencies(),
+			service.Description("Resumable uploads gateway (tus protocol) to tree service"),
+			service.WithGeneric(func(ctx context.Context, cancel context.CancelFunc) (service.Runner, service.Checker, service.Stopper, error) {
+				return service.RunnerFunc(func() error {
+						return nil
+					}), service.CheckerFunc(func() error {
+						return nil
+					}), service.StopperFunc(func() error {
+						return nil
+					}), nil
+			}, func(s service.Service) (micro.Option, error) {
+				srv := defaults.NewHTTPServer()
+
+				dataDir, e := config.ServiceDataDir(common.SERVICE_GATEWAY_TUS)
+				if e != nil {
+					return nil, e
+				}
+				stagingDir := filepath.Join(dataDir, "staging")
+				if e := os.MkdirAll(stagingDir, 0700); e != nil {
+					return nil, e
+				}
+				store, e := NewBoltStore(filepath.Join(dataDir, "uploads.db"))
+				if e != nil {
+					return nil, e
+				}
+				ttl := time.Duration(config.Get("services", common.SERVICE_GATEWAY_TUS, "expirationHours").Int(24)) * time.Hour
+
+				router := views.NewStandardRouter(views.RouterOptions{WatchRegistry: true, AuditEvent: true})
+				adminRouter := views.NewStandardRouter(views.RouterOptions{AdminView: true, WatchRegistry: true})
+				handler := NewHandler(router, adminRouter, store, stagingDir, "/tus", ttl)
+				go handler.Janitor(s.Options().Context, time.Hour)
+
+				err := srv.Handle(srv.NewHandler(service.JWTHttpWrapper(service.KeyPasswordHttpWrapper(handler))))
+				if err != nil {
+					return nil, err
+				}
+
+				return micro.Server(srv), nil
+			}),
+		)
+	})
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package tus
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	bucketName = []byte("uploads")
+)
+
+// Part is a multipart part already sent to the datasource.
+type Part struct {
+	Number int    `json:"number"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+}
+
+// Upload is the persisted state of a tus upload session.
+type Upload struct {
+	ID    string `json:"id"`
+	Owner string `json:"owner"`
+	// Path of the target, as seen by the owner
+	Path string `json:"path"`
+	// Path of the target in the tree, used to abort the upload without the owner context
+	TreePath string `json:"treePath"`
+	// Id of the underlying multipart upload
+	MultipartID string            `json:"multipartId"`
+	Length      int64             `json:"length"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Parts       []*Part           `json:"parts,omitempty"`
+	// Number of bytes received but not yet sent as a part
+	Staged  int64 `json:"staged"`
+	Created int64 `json:"created"`
+	Updated int64 `json:"updated"`
+	// Set for empty files, that are created at once: there is nothing to send nor to abort
+	Completed bool `json:"completed,omitempty"`
+}
+
+// Offset is the number of bytes received so far.
+func (u *Upload) Offset() int64 {
+	offset := u.Staged
+	for _, p := range u.Parts {
+		offset += p.Size
+	}
+	return offset
+}
+
+// Expires computes the time after which the upload is considered abandoned.
+func (u *Upload) Expires(ttl time.Duration) time.Time {
+	return time.Unix(u.Updated, 0).Add(ttl)
+}
+
+// BoltStore persists the uploads state.
+type BoltStore struct {
+	// Internal DB
+	db *bolt.DB
+	// For Testing purpose : delete file after closing
+	DeleteOnClose bool
+	// Path to the DB file
+	DbPath string
+}
+
+// NewBoltStore opens or creates the uploads DB.
+func NewBoltStore(fileName string, deleteOnClose ...bool) (*BoltStore, error) {
+
+	bs := &BoltStore{
+		DbPath: fileName,
+	}
+	if len(deleteOnClose) > 0 && deleteOnClose[0] {
+		bs.DeleteOnClose = true
+	}
+	options := bolt.DefaultOptions
+	options.Timeout = 5 * time.Second
+	db, err := bolt.Open(fileName, 0644, options)
+	if err != nil {
+		return nil, err
+	}
+	bs.db = db
+	e2 := db.Update(func(tx *bolt.Tx) error {
+		_, e := tx.CreateBucketIfNotExists(bucketName)
+		return e
+	})
+	return bs, e2
+
+}
+
+// Close closes the DB.
+func (b *BoltStore) Close() error {
+	err := b.db.Close()
+	if b.DeleteOnClose {
+		os.Remove(b.DbPath)
+	}
+	return err
+}
+
+// Put stores an upload state.
+func (b *BoltStore) Put(upload *Upload) error {
+	data, e := json.Marshal(upload)
+	if e != nil {
+		return e
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketName).Put([]byte(upload.ID), data)
+	})
+}
+
+// Get loads an upload state, or returns nil if it does not exist.
+func (b *BoltStore) Get(id string) (upload *Upload, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketName).Get([]byte(id))
+		if data == nil {
+			return nil
+		}
+		upload = &Upload{}
+		return json.Unmarshal(data, upload)
+	})
+	return
+}
+
+// Delete removes an upload state.
+func (b *BoltStore) Delete(id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketName).Delete([]byte(id))
+	})
+}
+
+// Expired lists the uploads that were not updated since ttl.
+func (b *BoltStore) Expired(ttl time.Duration, now time.Time) (uploads []*Upload, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketName).ForEach(func(k, v []byte) error {
+			upload := &Upload{}
+			if e := json.Unmarshal(v, upload); e != nil {
+				return e
+			}
+			if !now.Before(upload.Expires(ttl)) {
+				uploads = append(uploads, upload)
+			}
+			return nil
+		})
+	})
+	return
+}
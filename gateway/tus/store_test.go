@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package tus
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBoltStore(t *testing.T) {
+
+	dir, _ := ioutil.TempDir("", "tus")
+	defer os.RemoveAll(dir)
+	store, e := NewBoltStore(filepath.Join(dir, "uploads.db"), true)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer store.Close()
+
+	Convey("Store and load uploads", t, func() {
+		now := time.Now()
+		upload := &Upload{
+			ID:      "upload1",
+			Owner:   "alice",
+			Length:  30,
+			Parts:   []*Part{{Number: 1, ETag: "e1", Size: 10}, {Number: 2, ETag: "e2", Size: 10}},
+			Staged:  5,
+			Updated: now.Add(-2 * time.Hour).Unix(),
+		}
+		So(upload.Offset(), ShouldEqual, 25)
+		So(store.Put(upload), ShouldBeNil)
+		So(store.Put(&Upload{ID: "upload2", Updated: now.Unix()}), ShouldBeNil)
+
+		loaded, e := store.Get("upload1")
+		So(e, ShouldBeNil)
+		So(loaded.Owner, ShouldEqual, "alice")
+		So(loaded.Offset(), ShouldEqual, 25)
+
+		missing, e := store.Get("unknown")
+		So(e, ShouldBeNil)
+		So(missing, ShouldBeNil)
+
+		expired, e := store.Expired(time.Hour, now)
+		So(e, ShouldBeNil)
+		So(expired, ShouldHaveLength, 1)
+		So(expired[0].ID, ShouldEqual, "upload1")
+
+		So(store.Delete("upload1"), ShouldBeNil)
+		loaded, _ = store.Get("upload1")
+		So(loaded, ShouldBeNil)
+	})
+}
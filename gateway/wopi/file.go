@@ -29,6 +29,7 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
@@ -49,6 +50,16 @@ type File struct {
 	UserFriendlyName string
 	UserCanWrite     bool
 	PydioPath        string
+
+	// Host capabilities
+	SupportsLocks              bool
+	SupportsGetLock            bool
+	SupportsExtendedLockLength bool
+	SupportsUpdate             bool
+	SupportsRename             bool
+	SupportsDeletes            bool
+	UserCanRename              bool
+	UserCanNotWriteRelative    bool
 }
 
 func getNodeInfos(w http.ResponseWriter, r *http.Request) {
@@ -65,6 +76,7 @@ func getNodeInfos(w http.ResponseWriter, r *http.Request) {
 
 	f := buildFileFromNode(r.Context(), n)
 
+	w.Header().Set("X-WOPI-ItemVersion", f.Version)
 	data, _ := json.Marshal(f)
 	w.Write(data)
 }
@@ -87,6 +99,7 @@ func download(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/octet-stream")
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", n.GetSize()))
+	w.Header().Set("X-WOPI-ItemVersion", itemVersion(r.Context(), n))
 	defer read.Close()
 	written, err := io.Copy(w, read)
 	if err != nil {
@@ -108,12 +121,17 @@ func uploadStream(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx, ok := checkWriteLock(w, r, n, n.GetSize() == 0)
+	if !ok {
+		return
+	}
+
 	var size int64
 	if h, ok := r.Header["Content-Length"]; ok && len(h) > 0 {
 		size, _ = strconv.ParseInt(h[0], 10, 64)
 	}
 
-	written, err := viewsRouter.PutObject(r.Context(), n, r.Body, &views.PutRequestData{
+	written, err := viewsRouter.PutObject(ctx, n, r.Body, &views.PutRequestData{
 		Size: size,
 	})
 	if err != nil {
@@ -127,6 +145,9 @@ func uploadStream(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Logger(r.Context()).Debug("uploaded node", n.Zap(), zap.Int64("Data Length", written))
+	if resp, e := viewsRouter.ReadNode(ctx, &tree.ReadNodeRequest{Node: &tree.Node{Uuid: n.Uuid}}); e == nil {
+		w.Header().Set("X-WOPI-ItemVersion", storedItemVersion(ctx, resp.Node))
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -136,8 +157,15 @@ func buildFileFromNode(ctx context.Context, n *tree.Node) *File {
 		BaseFileName: n.GetStringMeta("name"),
 		OwnerId:      "pydio", // TODO get an ownerID?
 		Size:         n.GetSize(),
-		Version:      fmt.Sprintf("%d", n.GetModTime().Unix()),
+		Version:      itemVersion(ctx, n),
 		PydioPath:    n.Path,
+
+		SupportsLocks:              true,
+		SupportsGetLock:            true,
+		SupportsExtendedLockLength: true,
+		SupportsUpdate:             true,
+		SupportsRename:             true,
+		SupportsDeletes:            true,
 	}
 
 	// Find user info in claims, if any
@@ -153,6 +181,8 @@ func buildFileFromNode(ctx context.Context, n *tree.Node) *File {
 			} else {
 				f.UserCanWrite = true
 			}
+			f.UserCanRename = f.UserCanWrite
+			f.UserCanNotWriteRelative = !f.UserCanWrite
 		}
 	} else {
 		log.Logger(ctx).Debug("No Claims Found", zap.Any("ctx", ctx))
@@ -161,6 +191,63 @@ func buildFileFromNode(ctx context.Context, n *tree.Node) *File {
 	return &f
 }
 
+// itemVersion computes the X-WOPI-ItemVersion of a node. It is the identifier of the data/versions
+// entry holding the current content. For contents that are not versioned, it is the ETag, or the
+// modification time as long as the ETag is not computed.
+func itemVersion(ctx context.Context, n *tree.Node) string {
+	if id := contentVersionId(ctx, n); id != "" {
+		return id
+	}
+	if n.Etag != "" && n.Etag != common.NODE_FLAG_ETAG_TEMPORARY {
+		return n.Etag
+	}
+	return fmt.Sprintf("%d", n.GetModTime().Unix())
+}
+
+// storedItemVersion computes the X-WOPI-ItemVersion of a content that was just written. Versions are
+// stored asynchronously, so it waits for the version to appear if the datasource is versioned.
+func storedItemVersion(ctx context.Context, n *tree.Node) string {
+	if isVersioned(n) {
+		for i := 0; i < versionLookupRetries; i++ {
+			if id := contentVersionId(ctx, n); id != "" {
+				return id
+			}
+			<-time.After(versionLookupDelay)
+		}
+	}
+	return itemVersion(ctx, n)
+}
+
+// contentVersionId finds the version of the node whose content is the current one.
+func contentVersionId(ctx context.Context, n *tree.Node) string {
+	if versionClient == nil || n.Uuid == "" || n.Etag == "" || n.Etag == common.NODE_FLAG_ETAG_TEMPORARY {
+		return ""
+	}
+	stream, err := versionClient.ListVersions(ctx, &tree.ListVersionsRequest{Node: n})
+	if err != nil {
+		return ""
+	}
+	defer stream.Close()
+	for {
+		resp, e := stream.Recv()
+		if e != nil {
+			return ""
+		}
+		if resp != nil && resp.Version != nil && string(resp.Version.Data) == n.Etag {
+			return resp.Version.Uuid
+		}
+	}
+}
+
+// isVersioned checks if the datasource of the node has a versioning policy.
+func isVersioned(n *tree.Node) bool {
+	if viewsRouter == nil || viewsRouter.GetClientsPool() == nil {
+		return false
+	}
+	source, ok := viewsRouter.GetClientsPool().Sources[n.GetStringMeta(common.META_NAMESPACE_DATASOURCE_NAME)]
+	return ok && source.VersioningPolicyName != ""
+}
+
 // findNodeFromRequest retrieves a node from the repository using the node id
 // prefixed by the relevant workspace slug that is encoded in the current route
 func findNodeFromRequest(r *http.Request) (*tree.Node, error) {
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package wopi
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/micro/go-micro/client"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/proto/tree"
+)
+
+// versionsMock lists a fixed set of versions for any node.
+type versionsMock struct {
+	tree.NodeVersionerClient
+	versions []*tree.ChangeLog
+}
+
+func (v *versionsMock) ListVersions(ctx context.Context, in *tree.ListVersionsRequest, opts ...client.CallOption) (tree.NodeVersioner_ListVersionsClient, error) {
+	return &versionsStreamMock{versions: v.versions}, nil
+}
+
+type versionsStreamMock struct {
+	versions []*tree.ChangeLog
+}
+
+func (s *versionsStreamMock) SendMsg(interface{}) error { return nil }
+func (s *versionsStreamMock) RecvMsg(interface{}) error { return nil }
+func (s *versionsStreamMock) Close() error              { return nil }
+func (s *versionsStreamMock) Recv() (*tree.ListVersionsResponse, error) {
+	if len(s.versions) == 0 {
+		return nil, io.EOF
+	}
+	v := s.versions[0]
+	s.versions = s.versions[1:]
+	return &tree.ListVersionsResponse{Version: v}, nil
+}
+
+func TestItemVersion(t *testing.T) {
+
+	ctx := context.Background()
+	defer func() { versionClient = nil }()
+
+	Convey("The item version is the identifier of the version of the current content", t, func() {
+		versionClient = &versionsMock{versions: []*tree.ChangeLog{
+			{Uuid: "version-2", Data: []byte("etag-2")},
+			{Uuid: "version-1", Data: []byte("etag-1")},
+		}}
+		So(itemVersion(ctx, &tree.Node{Uuid: "node-uuid", Etag: "etag-1"}), ShouldEqual, "version-1")
+	})
+
+	Convey("Contents that are not versioned fall back to the ETag or the modification time", t, func() {
+		versionClient = &versionsMock{}
+		So(itemVersion(ctx, &tree.Node{Uuid: "node-uuid", Etag: "etag-1"}), ShouldEqual, "etag-1")
+		So(itemVersion(ctx, &tree.Node{Uuid: "node-uuid", Etag: common.NODE_FLAG_ETAG_TEMPORARY, MTime: 1000}), ShouldEqual, "1000")
+	})
+
+}
@@ -0,0 +1,281 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package wopi
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/utils"
+)
+
+const (
+	// WOPI locks automatically expire after 30 minutes unless refreshed
+	lockDuration = 30 * time.Minute
+	lockSource   = "wopi"
+)
+
+// locksStore abstracts the storage of the content locks.
+type locksStore interface {
+	// Load finds the lock registered on a node, or nil if there is none.
+	Load(ctx context.Context, nodeUuid string) (*utils.ContentLock, error)
+	// Create registers a new lock, it fails if the node is already locked.
+	Create(ctx context.Context, lock *utils.ContentLock) error
+	// UpdateInfo replaces the details of an existing lock.
+	UpdateInfo(ctx context.Context, lock *utils.ContentLock) error
+	// Delete removes the lock registered on a node.
+	Delete(ctx context.Context, nodeUuid string) error
+}
+
+// contentLocks stores the WOPI locks as content locks, so that they are shared with the other gateways.
+var contentLocks locksStore = aclLocks{}
+
+// aclLocks stores locks in the ACL service.
+type aclLocks struct{}
+
+func (aclLocks) Load(ctx context.Context, nodeUuid string) (*utils.ContentLock, error) {
+	locks, err := utils.LoadContentLocks(ctx, nodeUuid)
+	if err != nil {
+		return nil, err
+	}
+	return locks[nodeUuid], nil
+}
+
+func (aclLocks) Create(ctx context.Context, lock *utils.ContentLock) error {
+	return utils.CreateContentLock(ctx, lock)
+}
+
+func (aclLocks) UpdateInfo(ctx context.Context, lock *utils.ContentLock) error {
+	return utils.UpdateContentLockInfo(ctx, lock)
+}
+
+func (aclLocks) Delete(ctx context.Context, nodeUuid string) error {
+	return utils.DeleteContentLock(ctx, nodeUuid)
+}
+
+// currentLock loads the active lock on the node, if any. Expired locks are cleared.
+func currentLock(ctx context.Context, n *tree.Node) (*utils.ContentLock, error) {
+	lock, err := contentLocks.Load(ctx, n.Uuid)
+	if err != nil || lock == nil {
+		return nil, err
+	}
+	if lock.Expired(time.Now()) {
+		if e := contentLocks.Delete(ctx, n.Uuid); e != nil {
+			log.Logger(ctx).Error("cannot clear expired lock", zap.Error(e))
+		}
+		return nil, nil
+	}
+	return lock, nil
+}
+
+// lockValue returns the WOPI lock identifier. Locks created by other means (webdav, web interface)
+// have no identifier that could be shared with WOPI clients.
+func lockValue(lock *utils.ContentLock) string {
+	if lock == nil || lock.Info == nil || lock.Info.Source != lockSource {
+		return ""
+	}
+	return lock.Info.Token
+}
+
+// lockConflict answers with a 409 status and the current lock identifier, as required by the WOPI protocol.
+func lockConflict(w http.ResponseWriter, r *http.Request, lock *utils.ContentLock, reason string) {
+	log.Logger(r.Context()).Debug("WOPI BACKEND - Lock mismatch", zap.String("reason", reason))
+	w.Header().Set("X-WOPI-Lock", lockValue(lock))
+	w.Header().Set("X-WOPI-LockFailureReason", reason)
+	w.WriteHeader(http.StatusConflict)
+}
+
+func newWopiLock(n *tree.Node, owner string, value string) *utils.ContentLock {
+	return &utils.ContentLock{
+		NodeUuid: n.Uuid,
+		Owner:    owner,
+		Info: &utils.ContentLockInfo{
+			Source: lockSource,
+			Token:  value,
+			Expiry: time.Now().Add(lockDuration).Unix(),
+		},
+	}
+}
+
+// lockFile implements the Lock and UnlockAndRelock operations.
+func lockFile(w http.ResponseWriter, r *http.Request, n *tree.Node) {
+	ctx := r.Context()
+	requested := r.Header.Get("X-WOPI-Lock")
+	_, relock := r.Header[http.CanonicalHeaderKey("X-WOPI-OldLock")]
+	if requested == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	userName, _ := utils.FindUserNameInContext(ctx)
+
+	lock, err := currentLock(ctx, n)
+	if err != nil {
+		log.Logger(ctx).Error("cannot load lock", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if relock {
+		if lock == nil {
+			lockConflict(w, r, lock, "File is not locked")
+			return
+		}
+		if lockValue(lock) != r.Header.Get("X-WOPI-OldLock") {
+			lockConflict(w, r, lock, "Lock mismatch")
+			return
+		}
+		newLock := newWopiLock(n, lock.Owner, requested)
+		if e := contentLocks.UpdateInfo(ctx, newLock); e != nil {
+			log.Logger(ctx).Error("cannot update lock", zap.Error(e))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if lock == nil {
+		if e := contentLocks.Create(ctx, newWopiLock(n, userName, requested)); e != nil {
+			// Lock may have been created concurrently
+			if lock, _ = currentLock(ctx, n); lock != nil {
+				lockConflict(w, r, lock, "File is already locked")
+				return
+			}
+			log.Logger(ctx).Error("cannot create lock", zap.Error(e))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if value := lockValue(lock); value == requested || (lock.Info == nil && lock.Owner == userName) {
+		// Same lock: refresh it. A lock set by the same user from the web interface is shared with the WOPI client.
+		if e := contentLocks.UpdateInfo(ctx, newWopiLock(n, lock.Owner, requested)); e != nil {
+			log.Logger(ctx).Error("cannot refresh lock", zap.Error(e))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	lockConflict(w, r, lock, "File is already locked")
+}
+
+// getLock implements the GetLock operation.
+func getLock(w http.ResponseWriter, r *http.Request, n *tree.Node) {
+	lock, err := currentLock(r.Context(), n)
+	if err != nil {
+		log.Logger(r.Context()).Error("cannot load lock", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if lock != nil && lockValue(lock) == "" {
+		// Locked by another client
+		lockConflict(w, r, lock, "File is locked by another client")
+		return
+	}
+	w.Header().Set("X-WOPI-Lock", lockValue(lock))
+	w.WriteHeader(http.StatusOK)
+}
+
+// refreshLock implements the RefreshLock operation.
+func refreshLock(w http.ResponseWriter, r *http.Request, n *tree.Node) {
+	ctx := r.Context()
+	lock, err := currentLock(ctx, n)
+	if err != nil {
+		log.Logger(ctx).Error("cannot load lock", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	requested := r.Header.Get("X-WOPI-Lock")
+	if lock == nil || requested == "" || lockValue(lock) != requested {
+		lockConflict(w, r, lock, "Lock mismatch")
+		return
+	}
+	if e := contentLocks.UpdateInfo(ctx, newWopiLock(n, lock.Owner, requested)); e != nil {
+		log.Logger(ctx).Error("cannot refresh lock", zap.Error(e))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// unlockFile implements the Unlock operation.
+func unlockFile(w http.ResponseWriter, r *http.Request, n *tree.Node) {
+	ctx := r.Context()
+	lock, err := currentLock(ctx, n)
+	if err != nil {
+		log.Logger(ctx).Error("cannot load lock", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	requested := r.Header.Get("X-WOPI-Lock")
+	if lock == nil || requested == "" || lockValue(lock) != requested {
+		lockConflict(w, r, lock, "Lock mismatch")
+		return
+	}
+	if e := contentLocks.Delete(ctx, n.Uuid); e != nil {
+		log.Logger(ctx).Error("cannot delete lock", zap.Error(e))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// checkWriteLock verifies that the client presents the current lock before modifying a file.
+// It returns false and answers with a conflict otherwise. Unlocked files can only be written if
+// allowUnlocked is set: PutFile accepts them only if they are empty, as required by the WOPI protocol.
+func checkWriteLock(w http.ResponseWriter, r *http.Request, n *tree.Node, allowUnlocked bool) (context.Context, bool) {
+	ctx := r.Context()
+	lock, err := currentLock(ctx, n)
+	if err != nil {
+		log.Logger(ctx).Error("cannot load lock", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return ctx, false
+	}
+	if lock == nil {
+		if !allowUnlocked {
+			lockConflict(w, r, nil, "File is not locked")
+			return ctx, false
+		}
+		return ctx, true
+	}
+	requested := r.Header.Get("X-WOPI-Lock")
+	if requested == "" && lock.Info == nil {
+		// Lock set from the web interface: the lock filter lets its owner write
+		if userName, _ := utils.FindUserNameInContext(ctx); userName == lock.Owner {
+			return ctx, true
+		}
+	}
+	if requested == "" || lockValue(lock) != requested {
+		lockConflict(w, r, lock, "Lock mismatch")
+		return ctx, false
+	}
+	// Let the lock filter accept the write even if the lock was created by another user of the same editing session
+	return utils.WithContentLockToken(ctx, requested), true
+}
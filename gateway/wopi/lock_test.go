@@ -0,0 +1,223 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package wopi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/auth/claim"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/utils"
+)
+
+// memoryLocks keeps locks in memory, indexed by node Uuid.
+type memoryLocks struct {
+	sync.Mutex
+	locks map[string]*utils.ContentLock
+}
+
+func (m *memoryLocks) Load(ctx context.Context, nodeUuid string) (*utils.ContentLock, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.locks[nodeUuid], nil
+}
+
+func (m *memoryLocks) Create(ctx context.Context, lock *utils.ContentLock) error {
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.locks[lock.NodeUuid]; ok {
+		return errors.New("locks", "already locked", http.StatusConflict)
+	}
+	m.locks[lock.NodeUuid] = lock
+	return nil
+}
+
+func (m *memoryLocks) UpdateInfo(ctx context.Context, lock *utils.ContentLock) error {
+	m.Lock()
+	defer m.Unlock()
+	if current, ok := m.locks[lock.NodeUuid]; ok {
+		current.Info = lock.Info
+	}
+	return nil
+}
+
+func (m *memoryLocks) Delete(ctx context.Context, nodeUuid string) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.locks, nodeUuid)
+	return nil
+}
+
+func testLocks() *memoryLocks {
+	store := &memoryLocks{locks: make(map[string]*utils.ContentLock)}
+	contentLocks = store
+	return store
+}
+
+func wopiRequest(user string, headers map[string]string) *http.Request {
+	r := httptest.NewRequest("POST", "/wopi/files/node-uuid", nil)
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	return r.WithContext(context.WithValue(r.Context(), claim.ContextKey, claim.Claims{Name: user}))
+}
+
+func TestLockOperations(t *testing.T) {
+
+	n := &tree.Node{Uuid: "node-uuid", Path: "ws/file.docx", Size: 10}
+
+	Convey("Lock, get, refresh and unlock a file", t, func() {
+		store := testLocks()
+
+		w := httptest.NewRecorder()
+		lockFile(w, wopiRequest("user1", map[string]string{"X-WOPI-Lock": "lock-1"}), n)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(store.locks["node-uuid"].Owner, ShouldEqual, "user1")
+
+		w = httptest.NewRecorder()
+		getLock(w, wopiRequest("user1", nil), n)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Header().Get("X-WOPI-Lock"), ShouldEqual, "lock-1")
+
+		w = httptest.NewRecorder()
+		refreshLock(w, wopiRequest("user1", map[string]string{"X-WOPI-Lock": "lock-1"}), n)
+		So(w.Code, ShouldEqual, http.StatusOK)
+
+		w = httptest.NewRecorder()
+		unlockFile(w, wopiRequest("user1", map[string]string{"X-WOPI-Lock": "lock-1"}), n)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(store.locks, ShouldBeEmpty)
+	})
+
+	Convey("Lock mismatches answer with a conflict and the current lock", t, func() {
+		testLocks()
+
+		w := httptest.NewRecorder()
+		lockFile(w, wopiRequest("user1", map[string]string{"X-WOPI-Lock": "lock-1"}), n)
+		So(w.Code, ShouldEqual, http.StatusOK)
+
+		w = httptest.NewRecorder()
+		lockFile(w, wopiRequest("user2", map[string]string{"X-WOPI-Lock": "lock-2"}), n)
+		So(w.Code, ShouldEqual, http.StatusConflict)
+		So(w.Header().Get("X-WOPI-Lock"), ShouldEqual, "lock-1")
+
+		w = httptest.NewRecorder()
+		refreshLock(w, wopiRequest("user2", map[string]string{"X-WOPI-Lock": "lock-2"}), n)
+		So(w.Code, ShouldEqual, http.StatusConflict)
+
+		w = httptest.NewRecorder()
+		unlockFile(w, wopiRequest("user2", map[string]string{"X-WOPI-Lock": "lock-2"}), n)
+		So(w.Code, ShouldEqual, http.StatusConflict)
+		So(w.Header().Get("X-WOPI-Lock"), ShouldEqual, "lock-1")
+	})
+
+	Convey("Unlock and relock a file", t, func() {
+		store := testLocks()
+
+		w := httptest.NewRecorder()
+		lockFile(w, wopiRequest("user1", map[string]string{"X-WOPI-Lock": "lock-1", "X-WOPI-OldLock": "lock-0"}), n)
+		So(w.Code, ShouldEqual, http.StatusConflict)
+		So(w.Header().Get("X-WOPI-Lock"), ShouldEqual, "")
+
+		lockFile(httptest.NewRecorder(), wopiRequest("user1", map[string]string{"X-WOPI-Lock": "lock-1"}), n)
+		w = httptest.NewRecorder()
+		lockFile(w, wopiRequest("user2", map[string]string{"X-WOPI-Lock": "lock-2", "X-WOPI-OldLock": "lock-1"}), n)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(lockValue(store.locks["node-uuid"]), ShouldEqual, "lock-2")
+		So(store.locks["node-uuid"].Owner, ShouldEqual, "user1")
+	})
+
+	Convey("Expired locks are cleared", t, func() {
+		store := testLocks()
+		lock := newWopiLock(n, "user1", "lock-1")
+		lock.Info.Expiry = time.Now().Add(-time.Minute).Unix()
+		store.locks["node-uuid"] = lock
+
+		w := httptest.NewRecorder()
+		lockFile(w, wopiRequest("user2", map[string]string{"X-WOPI-Lock": "lock-2"}), n)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(lockValue(store.locks["node-uuid"]), ShouldEqual, "lock-2")
+	})
+
+}
+
+func TestCheckWriteLock(t *testing.T) {
+
+	n := &tree.Node{Uuid: "node-uuid", Path: "ws/file.docx", Size: 10}
+
+	Convey("Unlocked files can only be written if allowed", t, func() {
+		testLocks()
+
+		w := httptest.NewRecorder()
+		_, ok := checkWriteLock(w, wopiRequest("user1", nil), n, false)
+		So(ok, ShouldBeFalse)
+		So(w.Code, ShouldEqual, http.StatusConflict)
+		So(w.Header().Get("X-WOPI-Lock"), ShouldEqual, "")
+		So(w.Header()["X-Wopi-Lock"], ShouldHaveLength, 1)
+
+		w = httptest.NewRecorder()
+		_, ok = checkWriteLock(w, wopiRequest("user1", nil), n, true)
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("Locked files are written with the current lock only", t, func() {
+		store := testLocks()
+		store.locks["node-uuid"] = newWopiLock(n, "user1", "lock-1")
+
+		w := httptest.NewRecorder()
+		_, ok := checkWriteLock(w, wopiRequest("user2", map[string]string{"X-WOPI-Lock": "lock-2"}), n, false)
+		So(ok, ShouldBeFalse)
+		So(w.Code, ShouldEqual, http.StatusConflict)
+		So(w.Header().Get("X-WOPI-Lock"), ShouldEqual, "lock-1")
+
+		w = httptest.NewRecorder()
+		_, ok = checkWriteLock(w, wopiRequest("user2", nil), n, true)
+		So(ok, ShouldBeFalse)
+		So(w.Code, ShouldEqual, http.StatusConflict)
+
+		w = httptest.NewRecorder()
+		ctx, ok := checkWriteLock(w, wopiRequest("user2", map[string]string{"X-WOPI-Lock": "lock-1"}), n, false)
+		So(ok, ShouldBeTrue)
+		So(utils.ContentLockTokenFromContext(ctx), ShouldEqual, "lock-1")
+	})
+
+	Convey("Locks set from the web interface let their owner write", t, func() {
+		store := testLocks()
+		store.locks["node-uuid"] = &utils.ContentLock{NodeUuid: "node-uuid", Owner: "user1"}
+
+		_, ok := checkWriteLock(httptest.NewRecorder(), wopiRequest("user1", nil), n, false)
+		So(ok, ShouldBeTrue)
+
+		w := httptest.NewRecorder()
+		_, ok = checkWriteLock(w, wopiRequest("user2", nil), n, false)
+		So(ok, ShouldBeFalse)
+		So(w.Code, ShouldEqual, http.StatusConflict)
+	})
+
+}
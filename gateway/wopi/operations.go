@@ -0,0 +1,284 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package wopi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/micro/go-micro/errors"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/views"
+)
+
+// maxUniqueNameAttempts bounds the number of names tried by uniqueName.
+var maxUniqueNameAttempts = 100
+
+// fileOperation dispatches the operations sent as POST requests on a file to the relevant
+// handler, depending on the X-WOPI-Override header.
+func fileOperation(w http.ResponseWriter, r *http.Request) {
+	override := r.Header.Get("X-WOPI-Override")
+	log.Logger(r.Context()).Debug("WOPI BACKEND - File operation", zap.String("override", override))
+
+	n, err := findNodeFromRequest(r)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch override {
+	case "LOCK":
+		lockFile(w, r, n)
+	case "GET_LOCK":
+		getLock(w, r, n)
+	case "REFRESH_LOCK":
+		refreshLock(w, r, n)
+	case "UNLOCK":
+		unlockFile(w, r, n)
+	case "PUT_RELATIVE":
+		putRelativeFile(w, r, n)
+	case "RENAME_FILE":
+		renameFile(w, r, n)
+	case "DELETE":
+		deleteFile(w, r, n)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// putRelativeFile implements the PutRelativeFile operation, creating a new file next to the current one.
+func putRelativeFile(w http.ResponseWriter, r *http.Request, n *tree.Node) {
+	ctx := r.Context()
+	suggested, isSuggested := r.Header[http.CanonicalHeaderKey("X-WOPI-SuggestedTarget")]
+	relative, isRelative := r.Header[http.CanonicalHeaderKey("X-WOPI-RelativeTarget")]
+	if isSuggested == isRelative {
+		// Headers are mutually exclusive, and one of them is required
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	nodePath, err := workspacePath(ctx, n)
+	if err != nil {
+		log.Logger(ctx).Error("cannot find node path", zap.Error(err))
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	dir := path.Dir(nodePath)
+
+	var targetName string
+	if isSuggested {
+		name, e := decodeUTF7(suggested[0])
+		if e != nil || name == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if strings.HasPrefix(name, ".") {
+			// Only an extension is suggested
+			base := path.Base(nodePath)
+			name = strings.TrimSuffix(base, path.Ext(base)) + name
+		}
+		unique, e := uniqueName(ctx, dir, name)
+		if e != nil {
+			log.Logger(ctx).Error("cannot find a free name", zap.String("name", name), zap.Error(e))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		targetName = unique
+	} else {
+		name, e := decodeUTF7(relative[0])
+		if e != nil || name == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		targetName = name
+		if resp, e := pathRouter.ReadNode(ctx, &tree.ReadNodeRequest{Node: &tree.Node{Path: path.Join(dir, name)}}); e == nil {
+			overwrite, _ := strconv.ParseBool(r.Header.Get("X-WOPI-OverwriteRelativeTarget"))
+			if !overwrite {
+				if unique, e := uniqueName(ctx, dir, name); e == nil {
+					w.Header().Set("X-WOPI-ValidRelativeTarget", encodeUTF7(unique))
+				}
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			if lock, e := currentLock(ctx, resp.Node); e != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			} else if lock != nil {
+				lockConflict(w, r, lock, "Target file is locked")
+				return
+			}
+		}
+	}
+	if strings.ContainsAny(targetName, "/\\") {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var size int64 = -1
+	if s, e := strconv.ParseInt(r.Header.Get("X-WOPI-Size"), 10, 64); e == nil {
+		size = s
+	} else if r.ContentLength >= 0 {
+		size = r.ContentLength
+	}
+	target := &tree.Node{Path: path.Join(dir, targetName), Type: tree.NodeType_LEAF}
+	if _, e := pathRouter.PutObject(ctx, target, r.Body, &views.PutRequestData{Size: size}); e != nil {
+		log.Logger(ctx).Error("cannot put relative file", zap.String("target", target.Path), zap.Error(e))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resp, e := pathRouter.ReadNode(ctx, &tree.ReadNodeRequest{Node: target})
+	if e != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	fileUrl := url.URL{
+		Scheme:   scheme,
+		Host:     r.Host,
+		Path:     "/wopi/files/" + resp.Node.Uuid,
+		RawQuery: url.Values{"access_token": []string{r.URL.Query().Get("access_token")}}.Encode(),
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	data, _ := json.Marshal(map[string]string{
+		"Name": targetName,
+		"Url":  fileUrl.String(),
+	})
+	w.Write(data)
+}
+
+// renameFile implements the RenameFile operation. The requested name does not include the file extension.
+func renameFile(w http.ResponseWriter, r *http.Request, n *tree.Node) {
+	ctx, ok := checkWriteLock(w, r, n, true)
+	if !ok {
+		return
+	}
+	requested, e := decodeUTF7(r.Header.Get("X-WOPI-RequestedName"))
+	if e != nil || requested == "" || strings.ContainsAny(requested, "/\\") {
+		w.Header().Set("X-WOPI-InvalidFileNameError", "Invalid file name")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	nodePath, err := workspacePath(ctx, n)
+	if err != nil {
+		log.Logger(ctx).Error("cannot find node path", zap.Error(err))
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	targetPath := path.Join(path.Dir(nodePath), requested+path.Ext(nodePath))
+	if _, e := pathRouter.ReadNode(ctx, &tree.ReadNodeRequest{Node: &tree.Node{Path: targetPath}}); e == nil {
+		w.Header().Set("X-WOPI-InvalidFileNameError", "A file with this name already exists")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if _, e := pathRouter.UpdateNode(ctx, &tree.UpdateNodeRequest{From: &tree.Node{Path: nodePath}, To: &tree.Node{Path: targetPath}}); e != nil {
+		log.Logger(ctx).Error("cannot rename file", zap.Error(e))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	data, _ := json.Marshal(map[string]string{"Name": requested})
+	w.Write(data)
+}
+
+// deleteFile implements the DeleteFile operation, which is refused if the file is locked.
+func deleteFile(w http.ResponseWriter, r *http.Request, n *tree.Node) {
+	ctx := r.Context()
+	lock, err := currentLock(ctx, n)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if lock != nil {
+		lockConflict(w, r, lock, "File is locked")
+		return
+	}
+	if _, e := viewsRouter.DeleteNode(ctx, &tree.DeleteNodeRequest{Node: n}); e != nil {
+		log.Logger(ctx).Error("cannot delete file", zap.Error(e))
+		if errors.Parse(e.Error()).Code == http.StatusForbidden {
+			w.WriteHeader(http.StatusForbidden)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// workspacePath finds the path of a node as seen through the standard path router, that is
+// the workspace slug followed by the path relative to the workspace root.
+func workspacePath(ctx context.Context, n *tree.Node) (string, error) {
+	var candidates []string
+	err := pathRouter.WrapCallback(func(inputFilter views.NodeFilter, outputFilter views.NodeFilter) error {
+		loaderCtx, _, _ := inputFilter(ctx, &tree.Node{Path: ""}, "tmp")
+		workspaces := views.UserWorkspacesFromContext(loaderCtx)
+		for _, appears := range n.AppearsIn {
+			ws, ok := workspaces[appears.WsUuid]
+			if !ok {
+				continue
+			}
+			if len(ws.RootUUIDs) > 1 {
+				for _, root := range ws.RootUUIDs {
+					candidates = append(candidates, path.Join(ws.Slug, root, appears.Path))
+				}
+			} else {
+				candidates = append(candidates, path.Join(ws.Slug, appears.Path))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, c := range candidates {
+		if resp, e := pathRouter.ReadNode(ctx, &tree.ReadNodeRequest{Node: &tree.Node{Path: c}}); e == nil && resp.Node.Uuid == n.Uuid {
+			return c, nil
+		}
+	}
+	return "", errors.NotFound("wopi", "cannot find node in any accessible workspace")
+}
+
+// uniqueName appends a counter to the name until no file exists with this name in the folder.
+// It gives up after maxUniqueNameAttempts.
+func uniqueName(ctx context.Context, dir string, name string) (string, error) {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 1; i <= maxUniqueNameAttempts; i++ {
+		if _, e := pathRouter.ReadNode(ctx, &tree.ReadNodeRequest{Node: &tree.Node{Path: path.Join(dir, candidate)}}); e != nil {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	return "", errors.New("wopi", "cannot find a free name for "+name, http.StatusConflict)
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package wopi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/views"
+)
+
+func testRouters() *views.HandlerMock {
+	mock := views.NewHandlerMock()
+	viewsRouter = views.NewRouter(nil, []views.Handler{mock})
+	pathRouter = viewsRouter
+	return mock
+}
+
+func TestUniqueName(t *testing.T) {
+
+	Convey("A counter is appended to existing names", t, func() {
+		mock := testRouters()
+		mock.Nodes["ws/dir/file.docx"] = &tree.Node{Path: "ws/dir/file.docx"}
+		mock.Nodes["ws/dir/file-1.docx"] = &tree.Node{Path: "ws/dir/file-1.docx"}
+
+		name, e := uniqueName(context.Background(), "ws/dir", "other.docx")
+		So(e, ShouldBeNil)
+		So(name, ShouldEqual, "other.docx")
+
+		name, e = uniqueName(context.Background(), "ws/dir", "file.docx")
+		So(e, ShouldBeNil)
+		So(name, ShouldEqual, "file-2.docx")
+	})
+
+	Convey("The number of attempts is bounded", t, func() {
+		mock := testRouters()
+		mock.Nodes["ws/dir/file.docx"] = &tree.Node{Path: "ws/dir/file.docx"}
+		mock.Nodes["ws/dir/file-1.docx"] = &tree.Node{Path: "ws/dir/file-1.docx"}
+		mock.Nodes["ws/dir/file-2.docx"] = &tree.Node{Path: "ws/dir/file-2.docx"}
+		defer func(max int) { maxUniqueNameAttempts = max }(maxUniqueNameAttempts)
+		maxUniqueNameAttempts = 2
+
+		_, e := uniqueName(context.Background(), "ws/dir", "file.docx")
+		So(e, ShouldNotBeNil)
+	})
+
+}
+
+func TestDeleteFile(t *testing.T) {
+
+	n := &tree.Node{Uuid: "node-uuid", Path: "ws/dir/file.docx"}
+
+	Convey("Locked files cannot be deleted", t, func() {
+		mock := testRouters()
+		mock.Nodes[n.Path] = n
+		store := testLocks()
+		store.locks["node-uuid"] = newWopiLock(n, "user1", "lock-1")
+
+		w := httptest.NewRecorder()
+		deleteFile(w, wopiRequest("user1", map[string]string{"X-WOPI-Lock": "lock-1"}), n)
+		So(w.Code, ShouldEqual, http.StatusConflict)
+		So(w.Header().Get("X-WOPI-Lock"), ShouldEqual, "lock-1")
+		So(mock.Nodes, ShouldContainKey, n.Path)
+	})
+
+	Convey("Unlocked files are deleted", t, func() {
+		mock := testRouters()
+		mock.Nodes[n.Path] = n
+		testLocks()
+
+		w := httptest.NewRecorder()
+		deleteFile(w, wopiRequest("user1", nil), n)
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(mock.Nodes, ShouldNotContainKey, n.Path)
+	})
+
+}
+
+func TestRenameFile(t *testing.T) {
+
+	n := &tree.Node{Uuid: "node-uuid", Path: "ws/dir/file.docx"}
+
+	Convey("Renaming requires the current lock", t, func() {
+		testRouters()
+		store := testLocks()
+		store.locks["node-uuid"] = newWopiLock(n, "user1", "lock-1")
+
+		w := httptest.NewRecorder()
+		renameFile(w, wopiRequest("user2", map[string]string{"X-WOPI-Lock": "lock-2", "X-WOPI-RequestedName": "renamed"}), n)
+		So(w.Code, ShouldEqual, http.StatusConflict)
+		So(w.Header().Get("X-WOPI-Lock"), ShouldEqual, "lock-1")
+	})
+
+	Convey("Invalid names are refused", t, func() {
+		testRouters()
+		testLocks()
+
+		w := httptest.NewRecorder()
+		renameFile(w, wopiRequest("user1", map[string]string{"X-WOPI-RequestedName": "sub/renamed"}), n)
+		So(w.Code, ShouldEqual, http.StatusBadRequest)
+		So(w.Header().Get("X-WOPI-InvalidFileNameError"), ShouldNotBeEmpty)
+	})
+
+}
+
+func TestPutRelativeFile(t *testing.T) {
+
+	Convey("Suggested and relative targets are mutually exclusive", t, func() {
+		testRouters()
+		testLocks()
+
+		w := httptest.NewRecorder()
+		putRelativeFile(w, wopiRequest("user1", map[string]string{"X-WOPI-SuggestedTarget": ".pdf", "X-WOPI-RelativeTarget": "file.pdf"}), &tree.Node{Uuid: "node-uuid"})
+		So(w.Code, ShouldEqual, http.StatusNotImplemented)
+
+		w = httptest.NewRecorder()
+		putRelativeFile(w, wopiRequest("user1", nil), &tree.Node{Uuid: "node-uuid"})
+		So(w.Code, ShouldEqual, http.StatusNotImplemented)
+	})
+
+}
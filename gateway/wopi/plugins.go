@@ -23,10 +23,12 @@ package wopi
 
 import (
 	"context"
+	"time"
 
 	micro "github.com/micro/go-micro"
 	"github.com/pmker/yux/common"
 	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/proto/tree"
 	"github.com/pmker/yux/common/service"
 	"github.com/pmker/yux/common/views"
 	"github.com/pmker/yux/common/plugins"
@@ -34,6 +36,13 @@ import (
 
 var (
 	viewsRouter *views.Router
+	pathRouter  *views.Router
+	// versionClient finds the data/versions entries matching the files contents
+	versionClient tree.NodeVersionerClient
+
+	// versionLookupRetries and versionLookupDelay bound the wait for the version of a content that was just written
+	versionLookupRetries = 5
+	versionLookupDelay   = 500 * time.Millisecond
 )
 
 func init() {
@@ -56,6 +65,9 @@ func init() {
 				srv := defaults.NewHTTPServer()
 
 				viewsRouter = views.NewUuidRouter(views.RouterOptions{WatchRegistry: true, AuditEvent: true})
+				// Path based router is required to create or rename files
+				pathRouter = views.NewStandardRouter(views.RouterOptions{WatchRegistry: true, AuditEvent: true})
+				versionClient = tree.NewNodeVersionerClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_VERSIONS, defaults.NewClient())
 
 				router := NewRouter()
 
@@ -80,6 +80,18 @@ var myRoutes = routes{
 		getNodeInfos,
 	},
 
+	// Lock, GetLock, RefreshLock, Unlock, UnlockAndRelock, PutRelativeFile, RenameFile and DeleteFile
+	// operations are all sent on the file URL, the operation being given by the X-WOPI-Override header.
+	// Operations modifying a locked file must present the current lock, or receive a 409 Conflict status
+	// along with the current lock value in the X-WOPI-Lock header.
+	// See https://wopi.readthedocs.io/projects/wopirest/en/latest/files/Lock.html
+	route{
+		"FileOperation",
+		"POST",
+		"/wopi/files/{uuid}",
+		fileOperation,
+	},
+
 	route{
 		"Download",
 		"GET",
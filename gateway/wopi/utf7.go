@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package wopi
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// WOPI headers carrying file names are UTF-7 encoded (RFC 2152).
+
+func isUTF7Direct(r rune) bool {
+	return r >= 0x20 && r <= 0x7e && r != '+' && r != '\\' && r != '~'
+}
+
+func isBase64Char(c byte) bool {
+	return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '+' || c == '/'
+}
+
+// decodeUTF7 decodes a UTF-7 string.
+func decodeUTF7(s string) (string, error) {
+	var out strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c != '+' {
+			out.WriteByte(c)
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(s) && isBase64Char(s[j]) {
+			j++
+		}
+		if j == i+1 {
+			// "+-" is an escaped plus sign
+			out.WriteByte('+')
+		} else {
+			data, err := base64.RawStdEncoding.DecodeString(s[i+1 : j])
+			if err != nil {
+				return "", fmt.Errorf("invalid utf-7 sequence: %v", err)
+			}
+			units := make([]uint16, len(data)/2)
+			for k := range units {
+				units[k] = uint16(data[2*k])<<8 | uint16(data[2*k+1])
+			}
+			out.WriteString(string(utf16.Decode(units)))
+		}
+		i = j
+		if i < len(s) && s[i] == '-' {
+			i++
+		}
+	}
+	return out.String(), nil
+}
+
+// encodeUTF7 encodes a string to UTF-7.
+func encodeUTF7(s string) string {
+	var out strings.Builder
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		if runes[i] == '+' {
+			out.WriteString("+-")
+			i++
+			continue
+		}
+		if isUTF7Direct(runes[i]) {
+			out.WriteRune(runes[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && !isUTF7Direct(runes[j]) && runes[j] != '+' {
+			j++
+		}
+		units := utf16.Encode(runes[i:j])
+		data := make([]byte, 2*len(units))
+		for k, u := range units {
+			data[2*k] = byte(u >> 8)
+			data[2*k+1] = byte(u)
+		}
+		out.WriteString("+" + base64.RawStdEncoding.EncodeToString(data) + "-")
+		i = j
+	}
+	return out.String()
+}
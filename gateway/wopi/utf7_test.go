@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package wopi
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUTF7(t *testing.T) {
+
+	Convey("Decode UTF-7 strings", t, func() {
+		s, e := decodeUTF7("Hi Mom -+Jjo--!")
+		So(e, ShouldBeNil)
+		So(s, ShouldEqual, "Hi Mom -☺-!")
+
+		s, e = decodeUTF7("+ZeVnLIqe-")
+		So(e, ShouldBeNil)
+		So(s, ShouldEqual, "日本語")
+
+		s, e = decodeUTF7("1 +- 1.docx")
+		So(e, ShouldBeNil)
+		So(s, ShouldEqual, "1 + 1.docx")
+
+		s, e = decodeUTF7("R+AOk-sum+AOk-.docx")
+		So(e, ShouldBeNil)
+		So(s, ShouldEqual, "Résumé.docx")
+	})
+
+	Convey("Encode UTF-7 strings", t, func() {
+		So(encodeUTF7("report.docx"), ShouldEqual, "report.docx")
+		So(encodeUTF7("1 + 1.docx"), ShouldEqual, "1 +- 1.docx")
+		So(encodeUTF7("日本語"), ShouldEqual, "+ZeVnLIqe-")
+
+		for _, name := range []string{"Résumé.docx", "Hi Mom -☺-!", "~/back\\slash", "😀 smile.xlsx"} {
+			s, e := decodeUTF7(encodeUTF7(name))
+			So(e, ShouldBeNil)
+			So(s, ShouldEqual, name)
+		}
+	})
+
+}
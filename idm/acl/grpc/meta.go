@@ -22,6 +22,8 @@ package grpc
 
 import (
 	"context"
+	"encoding/json"
+	"time"
 
 	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/any"
@@ -62,17 +64,24 @@ func (h *Handler) ReadNodeStream(ctx context.Context, stream tree.NodeProviderSt
 			NodeIDs: []string{node.Uuid},
 			Actions: []*idm.ACLAction{
 				{Name: "content_lock"},
+				utils.ACL_CONTENT_LOCK_INFO,
 				utils.ACL_READ,
 				utils.ACL_WRITE,
 			},
 		})
 		dao.Search(&service.Query{SubQueries: []*any.Any{q}}, acls)
 		var contentLock string
+		var contentLockInfo *utils.ContentLockInfo
 		nodeAcls := map[string][]*idm.ACL{}
 		for _, in := range *acls {
 			a, _ := in.(*idm.ACL)
 			if a.Action.Name == "content_lock" {
 				contentLock = a.Action.Value
+			} else if a.Action.Name == utils.ACL_CONTENT_LOCK_INFO.Name {
+				contentLockInfo = &utils.ContentLockInfo{}
+				if e := json.Unmarshal([]byte(a.Action.Value), contentLockInfo); e != nil {
+					contentLockInfo = nil
+				}
 			} else if a.WorkspaceID != "" {
 				if _, exists := nodeAcls[a.WorkspaceID]; !exists {
 					nodeAcls[a.WorkspaceID] = []*idm.ACL{}
@@ -82,7 +91,17 @@ func (h *Handler) ReadNodeStream(ctx context.Context, stream tree.NodeProviderSt
 		}
 
 		if contentLock != "" {
-			node.SetMeta("content_lock", contentLock)
+			lock := &utils.ContentLock{NodeUuid: node.Uuid, Owner: contentLock, Info: contentLockInfo}
+			if !lock.Expired(time.Now()) {
+				node.SetMeta("content_lock", contentLock)
+				if contentLockInfo != nil {
+					// Expose owner and expiry, but not the lock token
+					node.SetMeta("content_lock_info", map[string]interface{}{
+						"owner":  contentLock,
+						"expiry": contentLockInfo.Expiry,
+					})
+				}
+			}
 		}
 
 		var shares []*idm.Workspace
@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE idm_acls MODIFY action_value TEXT;
+
+-- +migrate Down
+ALTER TABLE idm_acls MODIFY action_value VARCHAR(500);
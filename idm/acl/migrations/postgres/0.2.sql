@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE idm_acls ALTER COLUMN action_value TYPE TEXT;
+
+-- +migrate Down
+ALTER TABLE idm_acls ALTER COLUMN action_value TYPE VARCHAR(500);
@@ -51,6 +51,11 @@ var (
 		"CleanRoles":      `DELETE FROM idm_acl_roles WHERE id != -1 and id NOT IN (select distinct(role_id) from idm_acls)`,
 		"CleanNodes":      `DELETE FROM idm_acl_nodes WHERE id != -1 and id NOT IN (select distinct(node_id) from idm_acls)`,
 	}
+
+	// Statements that differ for the postgres driver, which does not support LastInsertId
+	postgresQueries = map[string]string{
+		"AddACL": `insert into idm_acls (action_name, action_value, role_id, workspace_id, node_id) values (?, ?, ?, ?, ?) returning id`,
+	}
 )
 
 type sqlimpl struct {
@@ -78,6 +83,9 @@ func (s *sqlimpl) Init(options common.ConfigValues) error {
 	// Preparing the db statements
 	if options.Bool("prepare", true) {
 		for key, query := range queries {
+			if q, ok := postgresQueries[key]; ok && s.Driver() == "postgres" {
+				query = q
+			}
 			if err := s.Prepare(key, query); err != nil {
 				return err
 			}
@@ -136,14 +144,21 @@ func (dao *sqlimpl) Add(in interface{}) error {
 
 	defer stmt.Close()
 
-	res, err := stmt.Exec(val.Action.Name, val.Action.Value, roleID, workspaceID, nodeID)
-	if err != nil {
-		return err
-	}
+	var id int64
+	if dao.Driver() == "postgres" {
+		if err := stmt.QueryRow(val.Action.Name, val.Action.Value, roleID, workspaceID, nodeID).Scan(&id); err != nil {
+			return err
+		}
+	} else {
+		res, err := stmt.Exec(val.Action.Name, val.Action.Value, roleID, workspaceID, nodeID)
+		if err != nil {
+			return err
+		}
 
-	id, err := res.LastInsertId()
-	if err != nil {
-		return err
+		id, err = res.LastInsertId()
+		if err != nil {
+			return err
+		}
 	}
 
 	val.ID = fmt.Sprintf("%d", id)
@@ -273,7 +288,8 @@ func (dao *sqlimpl) addWorkspace(uuid string) (string, error) {
 				return "", err
 			}
 
-			if rows > 0 {
+			// Postgres does not support LastInsertId, the id is read back below
+			if rows > 0 && dao.Driver() != "postgres" {
 				id, err := res.LastInsertId()
 				if err != nil {
 					return "", err
@@ -314,7 +330,8 @@ func (dao *sqlimpl) addNode(uuid string) (string, error) {
 				return "", err
 			}
 
-			if rows > 0 {
+			// Postgres does not support LastInsertId, the id is read back below
+			if rows > 0 && dao.Driver() != "postgres" {
 				id, err := res.LastInsertId()
 				if err != nil {
 					return "", err
@@ -356,7 +373,8 @@ func (dao *sqlimpl) addRole(uuid string) (string, error) {
 				return "", err
 			}
 
-			if rows > 0 {
+			// Postgres does not support LastInsertId, the id is read back below
+			if rows > 0 && dao.Driver() != "postgres" {
 				id, err := res.LastInsertId()
 				if err != nil {
 					return "", err
@@ -25,6 +25,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
@@ -34,6 +35,8 @@ import (
 	"github.com/coreos/dex/storage/kubernetes"
 	"github.com/coreos/dex/storage/memory"
 	"github.com/coreos/dex/storage/sql"
+
+	"github.com/pmker/yux/common/dao"
 )
 
 // Config is the config format for the main application.
@@ -257,3 +260,33 @@ type Logger struct {
 	// Format specifies the format to be used for logging.
 	Format string `json:"format"`
 }
+
+// PostgresStorageConfig builds the dex storage configuration from a PostgreSQL connection string,
+// in URL or key=value form.
+func PostgresStorageConfig(dsn string) (*sql.Postgres, error) {
+	params, err := dao.ParsePostgresDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	conf := &sql.Postgres{
+		Database: params["dbname"],
+		User:     params["user"],
+		Password: params["password"],
+		Host:     params["host"],
+	}
+	if port, ok := params["port"]; ok {
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid postgres port %s: %v", port, err)
+		}
+		conf.Port = uint16(p)
+	}
+	if timeout, ok := params["connect_timeout"]; ok {
+		conf.ConnectionTimeout, _ = strconv.Atoi(timeout)
+	}
+	conf.SSL.Mode = params["sslmode"]
+	conf.SSL.CAFile = params["sslrootcert"]
+	conf.SSL.CertFile = params["sslcert"]
+	conf.SSL.KeyFile = params["sslkey"]
+	return conf, nil
+}
@@ -84,13 +84,13 @@ func (s *dexSql) DexPruneOfflineSessions(c Config) (pruned int64, e error) {
 // DexDeleteOfflineSessions Delete offline session and refresh token based on uuid / session uuid (nonce)
 func (s *dexSql) DexDeleteOfflineSessions(c Config, userUuid string, sessionUuid string) error {
 
-	offline, e := s.DB().Prepare(`DELETE FROM dex_offline_session WHERE user_id=? AND conn_id=?`)
+	offline, e := s.DB().Prepare(sql.Rebind(s.Driver(), `DELETE FROM dex_offline_session WHERE user_id=? AND conn_id=?`))
 	if e != nil {
 		return e
 	}
 	defer offline.Close()
 
-	refresh, e := s.DB().Prepare(`DELETE FROM dex_refresh_token WHERE claims_user_id=? AND nonce=?`)
+	refresh, e := s.DB().Prepare(sql.Rebind(s.Driver(), `DELETE FROM dex_refresh_token WHERE claims_user_id=? AND nonce=?`))
 	if e != nil {
 		return e
 	}
@@ -40,9 +40,10 @@ import (
 	"github.com/pmker/yux/idm/auth"
 )
 
-func NewAuthTokenRevokerHandler(dexConfig auth.Config) (proto.AuthTokenRevokerHandler, error) {
+func NewAuthTokenRevokerHandler(dexConfig auth.Config, patDao auth.PatDAO) (proto.AuthTokenRevokerHandler, error) {
 	h := &TokenRevokerHandler{
 		dexConfig: dexConfig,
+		patDao:    patDao,
 	}
 	dataDir, e := config.ServiceDataDir(common.SERVICE_GRPC_NAMESPACE_ + common.SERVICE_AUTH)
 	if e != nil {
@@ -59,6 +60,7 @@ func NewAuthTokenRevokerHandler(dexConfig auth.Config) (proto.AuthTokenRevokerHa
 type TokenRevokerHandler struct {
 	dao       auth.DAO
 	dexConfig auth.Config
+	patDao    auth.PatDAO
 }
 
 // MatchInvalid checks if token is part of revocation list
@@ -95,7 +97,7 @@ func (h *TokenRevokerHandler) Revoke(ctx context.Context, in *proto.RevokeTokenR
 
 }
 
-// PruneTokens garbage collect expired IdTokens and Tokens
+// PruneTokens garbage collect expired IdTokens, Tokens and Personal Access Tokens
 func (h *TokenRevokerHandler) PruneTokens(ctx context.Context, in *proto.PruneTokensRequest, out *proto.PruneTokensResponse) error {
 	var offset = 0
 
@@ -127,6 +129,14 @@ func (h *TokenRevokerHandler) PruneTokens(ctx context.Context, in *proto.PruneTo
 		}
 	}
 
+	if h.patDao != nil {
+		if pruned, e := h.patDao.PruneExpiredPats(time.Now()); e != nil {
+			log.Logger(ctx).Error("Cannot prune personal access tokens", zap.Error(e))
+		} else if pruned > 0 {
+			log.Logger(ctx).Info(fmt.Sprintf("Pruned %d expired personal access tokens", pruned))
+		}
+	}
+
 	if dexDao, ok := servicecontext.GetDAO(ctx).(auth.DexDAO); ok {
 		pruned, _ := dexDao.DexPruneOfflineSessions(h.dexConfig)
 		if pruned > 0 {
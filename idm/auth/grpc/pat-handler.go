@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package grpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/micro/go-micro/errors"
+	"github.com/pborman/uuid"
+
+	"github.com/pmker/yux/common"
+	commonauth "github.com/pmker/yux/common/auth"
+	"github.com/pmker/yux/common/config"
+	proto "github.com/pmker/yux/common/proto/auth"
+	"github.com/pmker/yux/common/utils"
+	"github.com/pmker/yux/idm/auth"
+)
+
+const (
+	// defaultPatLifetime applies to tokens generated without expiration date
+	defaultPatLifetime = 30 * 24 * time.Hour
+	// defaultPatMaxLifetime applies if no maximum lifetime is configured
+	defaultPatMaxLifetime = 365 * 24 * time.Hour
+	// patUsageResolution avoids writing the last usage date on every request
+	patUsageResolution = time.Minute
+)
+
+// NewPatHandler opens the personal access tokens store. Tokens cannot be generated for more than maxLifetime,
+// or defaultPatMaxLifetime if it is zero.
+func NewPatHandler(maxLifetime time.Duration) (*PatHandler, error) {
+	dataDir, e := config.ServiceDataDir(common.SERVICE_GRPC_NAMESPACE_ + common.SERVICE_AUTH)
+	if e != nil {
+		return nil, e
+	}
+	dao, err := auth.NewBoltPatStore(path.Join(dataDir, "auth-pat.db"))
+	if err != nil {
+		return nil, err
+	}
+	if maxLifetime <= 0 {
+		maxLifetime = defaultPatMaxLifetime
+	}
+	return &PatHandler{dao: dao, maxLifetime: maxLifetime}, nil
+}
+
+// PatHandler implements the PersonalAccessTokenService.
+type PatHandler struct {
+	dao         auth.PatDAO
+	maxLifetime time.Duration
+}
+
+// Generate creates a new random token for a user.
+func (h *PatHandler) Generate(ctx context.Context, in *proto.PatGenerateRequest, out *proto.PatGenerateResponse) error {
+	if in.UserUuid == "" || in.UserLogin == "" {
+		return errors.BadRequest(common.SERVICE_AUTH, "token must be attached to a user")
+	}
+	now := time.Now()
+	expiresAt := in.ExpiresAt
+	if expiresAt == 0 {
+		lifetime := defaultPatLifetime
+		if lifetime > h.maxLifetime {
+			lifetime = h.maxLifetime
+		}
+		expiresAt = now.Add(lifetime).Unix()
+	} else if expiresAt <= now.Unix() {
+		return errors.BadRequest(common.SERVICE_AUTH, "expiration date must be in the future")
+	} else if expiresAt > now.Add(h.maxLifetime).Unix() {
+		return errors.BadRequest(common.SERVICE_AUTH, fmt.Sprintf("tokens cannot be valid for more than %d days", int(h.maxLifetime.Hours()/24)))
+	}
+
+	b := make([]byte, 32)
+	if _, e := rand.Read(b); e != nil {
+		return e
+	}
+	value := commonauth.PersonalAccessTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	createdBy, _ := utils.FindUserNameInContext(ctx)
+	token := &proto.PersonalAccessToken{
+		Uuid:       uuid.New(),
+		Label:      in.Label,
+		UserUuid:   in.UserUuid,
+		UserLogin:  in.UserLogin,
+		CreatedBy:  createdBy,
+		CreatedAt:  now.Unix(),
+		ExpiresAt:  expiresAt,
+		ReadOnly:   in.ReadOnly,
+		Workspaces: in.Workspaces,
+		Resources:  in.Resources,
+	}
+	if e := h.dao.PutPat(auth.HashPat(value), token); e != nil {
+		return e
+	}
+	out.AccessToken = value
+	out.Token = token
+	return nil
+}
+
+// Verify finds a valid token and updates its last usage date.
+func (h *PatHandler) Verify(ctx context.Context, in *proto.PatVerifyRequest, out *proto.PatVerifyResponse) error {
+	hash := auth.HashPat(in.AccessToken)
+	token, e := h.dao.GetPat(hash)
+	if e != nil {
+		return e
+	}
+	now := time.Now()
+	if token == nil || (token.ExpiresAt > 0 && token.ExpiresAt < now.Unix()) {
+		out.Success = false
+		return nil
+	}
+	if now.Unix()-token.LastUsedAt >= int64(patUsageResolution.Seconds()) {
+		token.LastUsedAt = now.Unix()
+		if e := h.dao.PutPat(hash, token); e != nil {
+			return e
+		}
+	}
+	out.Success = true
+	out.Token = token
+	return nil
+}
+
+// List returns the tokens of a user.
+func (h *PatHandler) List(ctx context.Context, in *proto.PatListRequest, out *proto.PatListResponse) error {
+	tokens, e := h.dao.ListPats(in.UserLogin)
+	if e != nil {
+		return e
+	}
+	out.Tokens = tokens
+	return nil
+}
+
+// Revoke deletes a token.
+func (h *PatHandler) Revoke(ctx context.Context, in *proto.PatRevokeRequest, out *proto.PatRevokeResponse) error {
+	if e := h.dao.DeletePat(in.Uuid); e != nil {
+		return e
+	}
+	out.Success = true
+	return nil
+}
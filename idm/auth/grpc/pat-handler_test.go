@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package grpc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	proto "github.com/pmker/yux/common/proto/auth"
+	"github.com/pmker/yux/idm/auth"
+)
+
+func TestPatHandler(t *testing.T) {
+
+	dbFile := filepath.Join(os.TempDir(), "pat-handler-test.db")
+	defer os.Remove(dbFile)
+	dao, e := auth.NewBoltPatStore(dbFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer dao.Close()
+	h := &PatHandler{dao: dao, maxLifetime: 48 * time.Hour}
+	ctx := context.Background()
+
+	Convey("Generated tokens expire by default, within the maximum lifetime", t, func() {
+		out := &proto.PatGenerateResponse{}
+		So(h.Generate(ctx, &proto.PatGenerateRequest{UserUuid: "user-1", UserLogin: "john"}, out), ShouldBeNil)
+		So(out.AccessToken, ShouldStartWith, "pat_")
+		So(out.Token.ExpiresAt, ShouldBeLessThanOrEqualTo, time.Now().Add(48*time.Hour).Unix())
+		So(out.Token.ExpiresAt, ShouldBeGreaterThan, time.Now().Add(47*time.Hour).Unix())
+	})
+
+	Convey("Expiration dates must be in the future and within the maximum lifetime", t, func() {
+		e := h.Generate(ctx, &proto.PatGenerateRequest{UserUuid: "user-1", UserLogin: "john", ExpiresAt: time.Now().Add(-time.Hour).Unix()}, &proto.PatGenerateResponse{})
+		So(e, ShouldNotBeNil)
+		So(errors.Parse(e.Error()).Code, ShouldEqual, 400)
+
+		e = h.Generate(ctx, &proto.PatGenerateRequest{UserUuid: "user-1", UserLogin: "john", ExpiresAt: time.Now().Add(72 * time.Hour).Unix()}, &proto.PatGenerateResponse{})
+		So(e, ShouldNotBeNil)
+		So(errors.Parse(e.Error()).Code, ShouldEqual, 400)
+
+		e = h.Generate(ctx, &proto.PatGenerateRequest{UserUuid: "user-1", UserLogin: "john", ExpiresAt: time.Now().Add(24 * time.Hour).Unix()}, &proto.PatGenerateResponse{})
+		So(e, ShouldBeNil)
+	})
+
+	Convey("Only valid tokens are verified", t, func() {
+		out := &proto.PatGenerateResponse{}
+		So(h.Generate(ctx, &proto.PatGenerateRequest{UserUuid: "user-1", UserLogin: "john"}, out), ShouldBeNil)
+
+		verified := &proto.PatVerifyResponse{}
+		So(h.Verify(ctx, &proto.PatVerifyRequest{AccessToken: out.AccessToken}, verified), ShouldBeNil)
+		So(verified.Success, ShouldBeTrue)
+		So(verified.Token.UserLogin, ShouldEqual, "john")
+
+		verified = &proto.PatVerifyResponse{}
+		So(h.Verify(ctx, &proto.PatVerifyRequest{AccessToken: "pat_unknown"}, verified), ShouldBeNil)
+		So(verified.Success, ShouldBeFalse)
+
+		out.Token.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+		So(dao.PutPat(auth.HashPat(out.AccessToken), out.Token), ShouldBeNil)
+		verified = &proto.PatVerifyResponse{}
+		So(h.Verify(ctx, &proto.PatVerifyRequest{AccessToken: out.AccessToken}, verified), ShouldBeNil)
+		So(verified.Success, ShouldBeFalse)
+	})
+
+}
@@ -24,6 +24,7 @@ package grpc
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/coreos/dex/storage/sql"
 	"github.com/micro/go-micro"
@@ -77,6 +78,12 @@ func init() {
 				case "sqlite3":
 					sqlConfig := new(sql.SQLite3)
 					sqlConfig.File = dsn
+				case "postgres":
+					sqlConfig, err := auth.PostgresStorageConfig(dsn)
+					if err != nil {
+						return err
+					}
+					c.Storage.Config = sqlConfig
 				}
 
 				if config.Get("cert", "http", "ssl").Bool(false) {
@@ -96,12 +103,19 @@ func init() {
 					}
 				}
 
-				tokenRevokerHandler, err := NewAuthTokenRevokerHandler(c)
+				// Maximum lifetime of personal access tokens, in days
+				patHandler, err := NewPatHandler(time.Duration(conf.Int("patMaxLifetimeDays", 365)) * 24 * time.Hour)
+				if err != nil {
+					return err
+				}
+
+				tokenRevokerHandler, err := NewAuthTokenRevokerHandler(c, patHandler.dao)
 				if err != nil {
 					return err
 				}
 
 				proto.RegisterAuthTokenRevokerHandler(m.Options().Server, tokenRevokerHandler)
+				proto.RegisterPersonalAccessTokenServiceHandler(m.Options().Server, patHandler)
 
 				return nil
 			}),
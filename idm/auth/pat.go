@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/pmker/yux/common/proto/auth"
+)
+
+// PatDAO stores personal access tokens. Tokens are indexed by a hash of their value, the value itself is never stored.
+type PatDAO interface {
+	PutPat(hash string, token *auth.PersonalAccessToken) error
+	GetPat(hash string) (*auth.PersonalAccessToken, error)
+	ListPats(userLogin string) ([]*auth.PersonalAccessToken, error)
+	DeletePat(uuid string) error
+	PruneExpiredPats(now time.Time) (int, error)
+}
+
+// HashPat computes the key under which a token value is stored.
+func HashPat(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+var patBucket = []byte("pats")
+
+// BoltPatStore implements PatDAO with a bolt database.
+type BoltPatStore struct {
+	db *bolt.DB
+}
+
+// NewBoltPatStore opens the bolt database and creates the tokens bucket.
+func NewBoltPatStore(filename string) (*BoltPatStore, error) {
+
+	options := bolt.DefaultOptions
+	options.Timeout = 5 * time.Second
+	db, err := bolt.Open(filename, 0644, options)
+	if err != nil {
+		return nil, err
+	}
+	er := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(patBucket)
+		return err
+	})
+	if er != nil {
+		db.Close()
+		return nil, er
+	}
+	return &BoltPatStore{db: db}, nil
+}
+
+func (b *BoltPatStore) Close() error {
+	return b.db.Close()
+}
+
+// PutPat creates or updates a token.
+func (b *BoltPatStore) PutPat(hash string, token *auth.PersonalAccessToken) error {
+	data, e := json.Marshal(token)
+	if e != nil {
+		return e
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(patBucket).Put([]byte(hash), data)
+	})
+}
+
+// GetPat finds a token by the hash of its value, it returns nil if it does not exist.
+func (b *BoltPatStore) GetPat(hash string) (*auth.PersonalAccessToken, error) {
+	var token *auth.PersonalAccessToken
+	e := b.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(patBucket).Get([]byte(hash))
+		if data == nil {
+			return nil
+		}
+		token = &auth.PersonalAccessToken{}
+		return json.Unmarshal(data, token)
+	})
+	return token, e
+}
+
+// ListPats lists the tokens of a user, or all tokens if userLogin is empty.
+func (b *BoltPatStore) ListPats(userLogin string) (tokens []*auth.PersonalAccessToken, e error) {
+	e = b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(patBucket).ForEach(func(k, v []byte) error {
+			token := &auth.PersonalAccessToken{}
+			if err := json.Unmarshal(v, token); err != nil {
+				return err
+			}
+			if userLogin == "" || token.UserLogin == userLogin {
+				tokens = append(tokens, token)
+			}
+			return nil
+		})
+	})
+	return
+}
+
+// DeletePat removes a token by its Uuid.
+func (b *BoltPatStore) DeletePat(uuid string) error {
+	return b.deleteWhere(func(token *auth.PersonalAccessToken) bool {
+		return token.Uuid == uuid
+	})
+}
+
+// PruneExpiredPats removes expired tokens and returns the number of deleted tokens.
+func (b *BoltPatStore) PruneExpiredPats(now time.Time) (count int, e error) {
+	e = b.deleteWhere(func(token *auth.PersonalAccessToken) bool {
+		if token.ExpiresAt > 0 && token.ExpiresAt < now.Unix() {
+			count++
+			return true
+		}
+		return false
+	})
+	return
+}
+
+func (b *BoltPatStore) deleteWhere(match func(token *auth.PersonalAccessToken) bool) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(patBucket)
+		var keys [][]byte
+		e := bucket.ForEach(func(k, v []byte) error {
+			token := &auth.PersonalAccessToken{}
+			if err := json.Unmarshal(v, token); err == nil && match(token) {
+				keys = append(keys, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if e != nil {
+			return e
+		}
+		for _, k := range keys {
+			if e := bucket.Delete(k); e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+}
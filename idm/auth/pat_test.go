@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package auth
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pmker/yux/common/proto/auth"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestBoltPatStore(t *testing.T) {
+
+	patFile := os.TempDir() + "/bolt-pat-test.db"
+	defer os.Remove(patFile)
+
+	patStore, e := NewBoltPatStore(patFile)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer patStore.Close()
+	now := time.Now()
+
+	convey.Convey("Test Put and Get tokens", t, func() {
+		convey.So(patStore.PutPat(HashPat("pat_one"), &auth.PersonalAccessToken{Uuid: "u1", UserLogin: "john", ExpiresAt: now.Add(time.Hour).Unix()}), convey.ShouldBeNil)
+		convey.So(patStore.PutPat(HashPat("pat_two"), &auth.PersonalAccessToken{Uuid: "u2", UserLogin: "john", ExpiresAt: now.Add(-time.Hour).Unix()}), convey.ShouldBeNil)
+		convey.So(patStore.PutPat(HashPat("pat_three"), &auth.PersonalAccessToken{Uuid: "u3", UserLogin: "jane", ReadOnly: true}), convey.ShouldBeNil)
+
+		token, e := patStore.GetPat(HashPat("pat_three"))
+		convey.So(e, convey.ShouldBeNil)
+		convey.So(token, convey.ShouldNotBeNil)
+		convey.So(token.Uuid, convey.ShouldEqual, "u3")
+		convey.So(token.ReadOnly, convey.ShouldBeTrue)
+
+		token, e = patStore.GetPat(HashPat("pat_unknown"))
+		convey.So(e, convey.ShouldBeNil)
+		convey.So(token, convey.ShouldBeNil)
+	})
+
+	convey.Convey("Test List tokens", t, func() {
+		tokens, e := patStore.ListPats("john")
+		convey.So(e, convey.ShouldBeNil)
+		convey.So(tokens, convey.ShouldHaveLength, 2)
+		tokens, e = patStore.ListPats("")
+		convey.So(e, convey.ShouldBeNil)
+		convey.So(tokens, convey.ShouldHaveLength, 3)
+	})
+
+	convey.Convey("Test Prune and Delete tokens", t, func() {
+		count, e := patStore.PruneExpiredPats(now)
+		convey.So(e, convey.ShouldBeNil)
+		convey.So(count, convey.ShouldEqual, 1)
+		token, _ := patStore.GetPat(HashPat("pat_two"))
+		convey.So(token, convey.ShouldBeNil)
+
+		convey.So(patStore.DeletePat("u1"), convey.ShouldBeNil)
+		tokens, _ := patStore.ListPats("")
+		convey.So(tokens, convey.ShouldHaveLength, 1)
+		convey.So(tokens[0].Uuid, convey.ShouldEqual, "u3")
+	})
+}
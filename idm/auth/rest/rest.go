@@ -21,6 +21,7 @@
 package rest
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -44,6 +45,17 @@ import (
 
 type TokenHandler struct{}
 
+var (
+	// patService returns the client of the service storing the personal access tokens.
+	patService = func() auth.PersonalAccessTokenServiceClient {
+		return auth.NewPersonalAccessTokenServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_AUTH, defaults.NewClient())
+	}
+	// patUserByLogin loads the owner of personal access tokens.
+	patUserByLogin = func(ctx context.Context, login string) (*idm.User, error) {
+		return utils.SearchUniqueUser(ctx, login, "")
+	}
+)
+
 // SwaggerTags list the names of the service tags declared in the swagger json implemented by this service
 func (a *TokenHandler) SwaggerTags() []string {
 	return []string{"TokenService"}
@@ -246,3 +258,126 @@ func (a *TokenHandler) ResetPassword(req *restful.Request, resp *restful.Respons
 	resp.WriteEntity(response)
 
 }
+
+// patUser resolves the owner of personal access tokens: the current user by default, other users
+// (e.g. service accounts) can only be targeted by admins. Tokens cannot be managed with a personal access token,
+// nor by the hidden users of public links.
+func (a *TokenHandler) patUser(req *restful.Request, resp *restful.Response, login string) (*idm.User, bool) {
+
+	ctx := req.Request.Context()
+	claims, ok := ctx.Value(claim.ContextKey).(claim.Claims)
+	if !ok {
+		service.RestError401(req, resp, errors.Unauthorized(common.SERVICE_AUTH, "please log in"))
+		return nil, false
+	}
+	if claims.Restrictions != nil {
+		service.RestError403(req, resp, errors.Forbidden(common.SERVICE_AUTH, "personal access tokens cannot be managed with a personal access token"))
+		return nil, false
+	}
+	if claims.Profile == common.PYDIO_PROFILE_SHARED {
+		service.RestError403(req, resp, errors.Forbidden(common.SERVICE_AUTH, "shared users cannot manage personal access tokens"))
+		return nil, false
+	}
+	if login == "" {
+		login = claims.Name
+	} else if login != claims.Name && claims.Profile != common.PYDIO_PROFILE_ADMIN {
+		service.RestError403(req, resp, errors.Forbidden(common.SERVICE_AUTH, "only admins can manage tokens of other users"))
+		return nil, false
+	}
+	user, e := patUserByLogin(ctx, login)
+	if e != nil {
+		service.RestErrorDetect(req, resp, e)
+		return nil, false
+	}
+	return user, true
+
+}
+
+// GeneratePersonalAccessToken creates a new token, its value is only returned in this response.
+func (a *TokenHandler) GeneratePersonalAccessToken(req *restful.Request, resp *restful.Response) {
+
+	var input auth.PatGenerateRequest
+	if e := req.ReadEntity(&input); e != nil {
+		service.RestError500(req, resp, errors.BadRequest(common.SERVICE_AUTH, "Cannot decode input request"))
+		return
+	}
+	user, ok := a.patUser(req, resp, input.UserLogin)
+	if !ok {
+		return
+	}
+	input.UserLogin = user.Login
+	input.UserUuid = user.Uuid
+
+	ctx := req.Request.Context()
+	cli := patService()
+	response, e := cli.Generate(ctx, &input)
+	if e != nil {
+		service.RestErrorDetect(req, resp, e)
+		return
+	}
+	resp.WriteEntity(response)
+
+}
+
+// ListPersonalAccessTokens lists the tokens of the current user, or of any user for admins.
+func (a *TokenHandler) ListPersonalAccessTokens(req *restful.Request, resp *restful.Response) {
+
+	user, ok := a.patUser(req, resp, req.QueryParameter("UserLogin"))
+	if !ok {
+		return
+	}
+	ctx := req.Request.Context()
+	cli := patService()
+	response, e := cli.List(ctx, &auth.PatListRequest{UserLogin: user.Login})
+	if e != nil {
+		service.RestErrorDetect(req, resp, e)
+		return
+	}
+	resp.WriteEntity(response)
+
+}
+
+// RevokePersonalAccessToken deletes a token owned by the current user, or any token for admins.
+func (a *TokenHandler) RevokePersonalAccessToken(req *restful.Request, resp *restful.Response) {
+
+	tokenId := req.PathParameter("Uuid")
+	ctx := req.Request.Context()
+	claims, _ := ctx.Value(claim.ContextKey).(claim.Claims)
+	user, ok := a.patUser(req, resp, "")
+	if !ok {
+		return
+	}
+
+	cli := patService()
+	if claims.Profile != common.PYDIO_PROFILE_ADMIN {
+		if found, e := ownsPersonalAccessToken(ctx, cli, user.Login, tokenId); e != nil {
+			service.RestErrorDetect(req, resp, e)
+			return
+		} else if !found {
+			service.RestError404(req, resp, errors.NotFound(common.SERVICE_AUTH, "cannot find token "+tokenId))
+			return
+		}
+	}
+
+	response, e := cli.Revoke(ctx, &auth.PatRevokeRequest{Uuid: tokenId})
+	if e != nil {
+		service.RestErrorDetect(req, resp, e)
+		return
+	}
+	resp.WriteEntity(response)
+
+}
+
+// ownsPersonalAccessToken checks that a token belongs to the given user.
+func ownsPersonalAccessToken(ctx context.Context, cli auth.PersonalAccessTokenServiceClient, login string, tokenId string) (bool, error) {
+	list, e := cli.List(ctx, &auth.PatListRequest{UserLogin: login})
+	if e != nil {
+		return false, e
+	}
+	for _, t := range list.Tokens {
+		if t.Uuid == tokenId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/micro/go-micro/client"
+	"github.com/micro/go-micro/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/auth/claim"
+	"github.com/pmker/yux/common/proto/auth"
+	"github.com/pmker/yux/common/proto/idm"
+)
+
+// patListMock lists the tokens of a fixed set of users.
+type patListMock struct {
+	auth.PersonalAccessTokenServiceClient
+	tokens map[string][]*auth.PersonalAccessToken
+}
+
+func (p *patListMock) List(ctx context.Context, in *auth.PatListRequest, opts ...client.CallOption) (*auth.PatListResponse, error) {
+	return &auth.PatListResponse{Tokens: p.tokens[in.UserLogin]}, nil
+}
+
+func patRequest(claims *claim.Claims) (*restful.Request, *restful.Response, *httptest.ResponseRecorder) {
+	r := httptest.NewRequest("GET", "/auth/token/personal", nil)
+	if claims != nil {
+		r = r.WithContext(context.WithValue(r.Context(), claim.ContextKey, *claims))
+	}
+	recorder := httptest.NewRecorder()
+	resp := restful.NewResponse(recorder)
+	resp.SetRequestAccepts("application/json")
+	return restful.NewRequest(r), resp, recorder
+}
+
+func TestPatUser(t *testing.T) {
+
+	defer func(f func(context.Context, string) (*idm.User, error)) { patUserByLogin = f }(patUserByLogin)
+	patUserByLogin = func(ctx context.Context, login string) (*idm.User, error) {
+		if login == "john" || login == "service-account" {
+			return &idm.User{Login: login}, nil
+		}
+		return nil, errors.NotFound("user", "cannot find user "+login)
+	}
+	h := &TokenHandler{}
+
+	Convey("Anonymous users cannot manage tokens", t, func() {
+		req, resp, recorder := patRequest(nil)
+		_, ok := h.patUser(req, resp, "")
+		So(ok, ShouldBeFalse)
+		So(recorder.Code, ShouldEqual, http.StatusUnauthorized)
+	})
+
+	Convey("Tokens cannot be managed with a token, nor by shared users", t, func() {
+		req, resp, recorder := patRequest(&claim.Claims{Name: "john", Restrictions: &claim.Restrictions{TokenUuid: "token"}})
+		_, ok := h.patUser(req, resp, "")
+		So(ok, ShouldBeFalse)
+		So(recorder.Code, ShouldEqual, http.StatusForbidden)
+
+		req, resp, recorder = patRequest(&claim.Claims{Name: "john", Profile: common.PYDIO_PROFILE_SHARED})
+		_, ok = h.patUser(req, resp, "")
+		So(ok, ShouldBeFalse)
+		So(recorder.Code, ShouldEqual, http.StatusForbidden)
+	})
+
+	Convey("Users manage their own tokens, admins manage the tokens of any user", t, func() {
+		req, resp, _ := patRequest(&claim.Claims{Name: "john", Profile: common.PYDIO_PROFILE_STANDARD})
+		user, ok := h.patUser(req, resp, "")
+		So(ok, ShouldBeTrue)
+		So(user.Login, ShouldEqual, "john")
+
+		req, resp, recorder := patRequest(&claim.Claims{Name: "john", Profile: common.PYDIO_PROFILE_STANDARD})
+		_, ok = h.patUser(req, resp, "service-account")
+		So(ok, ShouldBeFalse)
+		So(recorder.Code, ShouldEqual, http.StatusForbidden)
+
+		req, resp, _ = patRequest(&claim.Claims{Name: "admin", Profile: common.PYDIO_PROFILE_ADMIN})
+		user, ok = h.patUser(req, resp, "service-account")
+		So(ok, ShouldBeTrue)
+		So(user.Login, ShouldEqual, "service-account")
+	})
+
+}
+
+func TestOwnsPersonalAccessToken(t *testing.T) {
+
+	Convey("Tokens are only found in the list of their owner", t, func() {
+		cli := &patListMock{tokens: map[string][]*auth.PersonalAccessToken{
+			"john": {{Uuid: "token-1"}},
+			"jane": {{Uuid: "token-2"}},
+		}}
+		found, e := ownsPersonalAccessToken(context.Background(), cli, "john", "token-1")
+		So(e, ShouldBeNil)
+		So(found, ShouldBeTrue)
+
+		found, e = ownsPersonalAccessToken(context.Background(), cli, "john", "token-2")
+		So(e, ShouldBeNil)
+		So(found, ShouldBeFalse)
+	})
+
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/micro/go-micro/client"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/auth/dex"
+	"github.com/pmker/yux/common/auth/ldap"
+	"github.com/pmker/yux/common/config"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/proto/auth"
+	"github.com/pmker/yux/common/proto/jobs"
+	"github.com/pmker/yux/common/utils/i18n"
+	"github.com/pmker/yux/idm/auth/lang"
+	"github.com/pmker/yux/scheduler/actions"
+)
+
+var (
+	syncUsersActionName = "actions.auth.sync-users"
+)
+
+func init() {
+	actions.GetActionsManager().Register(syncUsersActionName, func() actions.ConcreteAction {
+		return &SyncUsersAction{}
+	})
+}
+
+// SyncUsersAction synchronises the users of the LDAP servers declared as dex connectors.
+// Parameters are "configId" to restrict the sync to one server, and "deleteMissing" to delete
+// users that disappeared from the directory instead of locking them.
+type SyncUsersAction struct {
+	configId      string
+	deleteMissing bool
+}
+
+// Unique identifier
+func (c *SyncUsersAction) GetName() string {
+	return syncUsersActionName
+}
+
+// Pass parameters
+func (c *SyncUsersAction) Init(job *jobs.Job, cl client.Client, action *jobs.Action) error {
+	c.configId = action.Parameters["configId"]
+	c.deleteMissing = action.Parameters["deleteMissing"] == "true"
+	return nil
+}
+
+// Run the actual action code
+func (c *SyncUsersAction) Run(ctx context.Context, channels *actions.RunnableChannels, input jobs.ActionMessage) (jobs.ActionMessage, error) {
+
+	T := lang.Bundle().GetTranslationFunc(i18n.GetDefaultLanguage(config.Default()))
+
+	output := input
+	configs, err := LdapServerConfigs()
+	if err != nil {
+		return input.WithError(err), err
+	}
+	found := false
+	for _, conf := range configs {
+		// NewServer also sets the default ConfigId
+		server := ldap.NewServer(conf)
+		if c.configId != "" && conf.ConfigId != c.configId {
+			continue
+		}
+		found = true
+		channels.StatusMsg <- T("Auth.SyncJob.Running", conf)
+		syncer := ldap.NewSyncer(server)
+		syncer.DeleteMissing = c.deleteMissing
+		report, err := syncer.Sync(ctx)
+		if err != nil {
+			log.Logger(ctx).Error("Cannot synchronise users", zap.String(common.KEY_CONNECTOR, conf.ConfigId), zap.Error(err))
+			return output.WithError(err), err
+		}
+		output.AppendOutput(&jobs.ActionOutput{
+			Success: true,
+			StringBody: T("Auth.SyncJob.Report", map[string]interface{}{
+				"ConfigId": conf.ConfigId,
+				"Created":  report.Created,
+				"Updated":  report.Updated,
+				"Locked":   report.Locked,
+				"Deleted":  report.Deleted,
+				"Errors":   report.Errors,
+			}),
+		})
+	}
+	if !found {
+		err := fmt.Errorf("no ldap server configured")
+		if c.configId != "" {
+			err = fmt.Errorf("cannot find ldap server %s", c.configId)
+		}
+		return output.WithError(err), err
+	}
+
+	return output, nil
+}
+
+// LdapServerConfigs lists the LDAP servers declared in the pydio dex connector.
+func LdapServerConfigs() ([]*auth.LdapServerConfig, error) {
+
+	var connectors []struct {
+		Type   string          `json:"type"`
+		Config json.RawMessage `json:"config"`
+	}
+	if err := config.Get("services", common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_AUTH, "dex", "connectors").Scan(&connectors); err != nil {
+		return nil, err
+	}
+	var configs []*auth.LdapServerConfig
+	for _, connector := range connectors {
+		if connector.Type != "pydio" || len(connector.Config) == 0 {
+			continue
+		}
+		var wrapper dex.WrapperConfig
+		if err := json.Unmarshal(connector.Config, &wrapper); err != nil {
+			return nil, fmt.Errorf("cannot parse connector config: %v", err)
+		}
+		for _, c := range wrapper.Connectors {
+			if c.Type != "ldap" || len(c.Config) == 0 {
+				continue
+			}
+			conf := &auth.LdapServerConfig{}
+			if err := json.Unmarshal(c.Config, conf); err != nil {
+				return nil, fmt.Errorf("cannot parse ldap config %s: %v", c.Name, err)
+			}
+			configs = append(configs, conf)
+		}
+	}
+	return configs, nil
+
+}
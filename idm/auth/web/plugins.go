@@ -44,11 +44,13 @@ func init() {
 
 	plugins.Register(func() {
 		dex.RegisterWrapperConnectorMiddleware("Login", dex.WrapWithIdmUser)
+		dex.RegisterWrapperConnectorMiddleware("Login", dex.WrapWithMFA)
 		dex.RegisterWrapperConnectorMiddleware("Login", dex.WrapWithUserLocks)
 		dex.RegisterWrapperConnectorMiddleware("Login", dex.WrapWithPolicyCheck)
 		dex.RegisterWrapperConnectorMiddleware("Login", dex.WrapWithIdentity)
 
 		dex.RegisterWrapperConnectorMiddleware("Refresh", dex.WrapWithIdmUser)
+		dex.RegisterWrapperConnectorMiddleware("Refresh", dex.WrapWithMFA)
 		dex.RegisterWrapperConnectorMiddleware("Refresh", dex.WrapWithUserLocks)
 		dex.RegisterWrapperConnectorMiddleware("Refresh", dex.WrapWithPolicyCheck)
 		dex.RegisterWrapperConnectorMiddleware("Refresh", dex.WrapWithIdentity)
@@ -96,6 +98,12 @@ func init() {
 				case "sqlite3":
 					sqlConfig := new(sql.SQLite3)
 					sqlConfig.File = dsn
+				case "postgres":
+					sqlConfig, err := auth.PostgresStorageConfig(dsn)
+					if err != nil {
+						return nil, err
+					}
+					c.Storage.Config = sqlConfig
 				}
 
 				router, err := serve(c, ctx, log.Logger(ctx))
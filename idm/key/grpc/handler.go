@@ -66,14 +66,33 @@ func (ukm *userKeyStore) AddKey(ctx context.Context, req *enc.AddKeyRequest, rsp
 		return err
 	}
 
-	err = seal(req.Key, []byte(req.StrPassword))
+	if len(req.Key.Owner) > 0 && req.Key.Owner != common.PYDIO_SYSTEM_USERNAME {
+		// Never override a user key: data sealed with the previous one would be lost
+		if _, e := dao.GetKey(req.Key.Owner, req.Key.ID); e == nil {
+			return errors.New(common.SERVICE_USER_KEY, "key already exists for this user", 409)
+		} else if errors.Parse(e.Error()).Code != 404 {
+			return e
+		}
+	}
+
+	if len(req.StrPassword) == 0 {
+		err = sealWithMasterKey(req.Key)
+	} else {
+		err = seal(req.Key, []byte(req.StrPassword))
+	}
 	if err != nil {
 		return err
 	}
 
-	return dao.SaveKey(req.Key)
+	if err = dao.SaveKey(req.Key); err != nil {
+		return err
+	}
+	rsp.Success = true
+	return nil
 }
 
+// GetKey opens the required key. System keys are sealed with the master password. User keys are sealed
+// with the user password if one is passed (USER_PWD mode), or with the master password (USER mode).
 func (ukm *userKeyStore) GetKey(ctx context.Context, req *enc.GetKeyRequest, rsp *enc.GetKeyResponse) error {
 
 	dao, err := ukm.getDAO(ctx)
@@ -81,9 +100,16 @@ func (ukm *userKeyStore) GetKey(ctx context.Context, req *enc.GetKeyRequest, rsp
 		return err
 	}
 
-	// TODO: Extract user / password info from Context
-	user := common.PYDIO_SYSTEM_USERNAME
-	pwd := config.Vault().Get("masterPassword").Bytes()
+	user := req.Owner
+	pwd := []byte(req.StrPassword)
+	if len(user) == 0 || user == common.PYDIO_SYSTEM_USERNAME || len(pwd) == 0 {
+		if len(user) == 0 {
+			user = common.PYDIO_SYSTEM_USERNAME
+		}
+		if pwd, err = getMasterPassword(); err != nil {
+			return err
+		}
+	}
 
 	rsp.Key, err = dao.GetKey(user, req.KeyID)
 	if err != nil {
@@ -93,7 +119,11 @@ func (ukm *userKeyStore) GetKey(ctx context.Context, req *enc.GetKeyRequest, rsp
 	if rsp.Key == nil {
 		return nil
 	}
-	return open(rsp.Key, pwd)
+	if err = open(rsp.Key, pwd); err != nil {
+		rsp.Key = nil
+		return errors.Forbidden(common.SERVICE_USER_KEY, "cannot unlock key "+req.KeyID+" for "+user)
+	}
+	return nil
 }
 
 func (ukm *userKeyStore) AdminListKeys(ctx context.Context, req *enc.AdminListKeysRequest, rsp *enc.AdminListKeysResponse) error {
@@ -273,6 +303,46 @@ func (ukm *userKeyStore) AdminExportKey(ctx context.Context, req *enc.AdminExpor
 	return nil
 }
 
+// UpdateKeysPassword re-seals the keys of a user after a password change. Only keys opening with the old
+// password are updated, keys sealed with the master password (USER mode) are left untouched. The request
+// must come from the owner: an admin resetting a password does not know the previous one, and the
+// keys sealed with it cannot be recovered.
+func (ukm *userKeyStore) UpdateKeysPassword(ctx context.Context, req *enc.UpdateKeysPasswordRequest, rsp *enc.UpdateKeysPasswordResponse) error {
+
+	claims, ok := ctx.Value(claim.ContextKey).(claim.Claims)
+	if !ok || len(req.Owner) == 0 || claims.Name != req.Owner {
+		return errors.Forbidden(common.SERVICE_USER_KEY, "users can only update their own keys")
+	}
+	if len(req.OldPassword) == 0 || len(req.NewPassword) == 0 {
+		return errors.BadRequest(common.SERVICE_USER_KEY, "both old and new passwords are required")
+	}
+
+	dao, err := ukm.getDAO(ctx)
+	if err != nil {
+		return err
+	}
+	keys, err := dao.ListKeys(req.Owner)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		if e := open(k, []byte(req.OldPassword)); e != nil {
+			continue
+		}
+		if e := seal(k, []byte(req.NewPassword)); e != nil {
+			return e
+		}
+		if e := dao.SaveKey(k); e != nil {
+			return e
+		}
+		rsp.Updated++
+	}
+	log.Logger(ctx).Info("Re-sealed user keys after password change", zap.String("owner", req.Owner), zap.Int32("keys", rsp.Updated))
+	rsp.Success = true
+	return nil
+}
+
 // Create a default key or create a system key with a given ID
 func createSystemKey(dao key.DAO, keyID string, keyLabel string) error {
 	systemKey := &enc.Key{
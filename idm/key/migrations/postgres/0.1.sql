@@ -0,0 +1,13 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS idm_user_keys (
+    owner VARCHAR(255) NOT NULL,
+    key_id VARCHAR(255) NOT NULL,
+    key_label VARCHAR(255) NOT NULL,
+    key_data VARCHAR(255) NOT NULL,
+    creation_date INTEGER,
+    key_info BYTEA,
+    UNIQUE (owner, key_id)
+);
+
+-- +migrate Down
+DROP TABLE idm_user_keys;
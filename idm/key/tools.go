@@ -24,6 +24,9 @@ import (
 	"context"
 	"encoding/base64"
 	"sync"
+	"time"
+
+	"github.com/micro/go-micro/errors"
 
 	"github.com/pmker/yux/common"
 	"github.com/pmker/yux/common/proto/encryption"
@@ -32,6 +35,27 @@ import (
 	"github.com/pmker/yux/common/crypto"
 )
 
+// PasswordHeader is the request header carrying the password that unlocks the user key
+// on datasources encrypted in USER_PWD mode. It is verified at the gateway and never
+// forwarded in the request metadata.
+const PasswordHeader = "X-Pydio-Key-Password"
+
+type passwordContextKey struct{}
+
+// WithPassword stores the password unlocking the current user key in the context.
+func WithPassword(ctx context.Context, pass []byte) context.Context {
+	return context.WithValue(ctx, passwordContextKey{}, pass)
+}
+
+// PasswordFromContext finds the verified password set by WithPassword. It stays in the
+// process context: the clear password is never read from the request metadata.
+func PasswordFromContext(ctx context.Context) ([]byte, bool) {
+	if pass, ok := ctx.Value(passwordContextKey{}).([]byte); ok && len(pass) > 0 {
+		return pass, true
+	}
+	return nil, false
+}
+
 // UserKeyTool describes a tool that can encrypt/decrypt data based on user context
 type UserKeyTool interface {
 	GetEncrypted(ctx context.Context, keyID string, data []byte) ([]byte, error)
@@ -45,14 +69,21 @@ func MasterKeyTool(ctx context.Context) (UserKeyTool, error) {
 	return kt, nil
 }
 
-// GetUserKeyTool creates a keytool based on specified @user and @pass
+// GetUserKeyTool creates a keytool based on specified @user and @pass. User keys are created on first use:
+// they are sealed with @pass if it is set, or with the master password otherwise.
 func GetUserKeyTool(user string, pass []byte) UserKeyTool {
-	return &userKeyTool{}
+	return &userKeyTool{
+		keys:     make(map[string][]byte),
+		owner:    user,
+		password: pass,
+	}
 }
 
 type userKeyTool struct {
 	sync.Mutex
-	keys map[string][]byte
+	keys     map[string][]byte
+	owner    string
+	password []byte
 }
 
 func (kt *userKeyTool) keyByID(ctx context.Context, id string) ([]byte, error) {
@@ -61,17 +92,57 @@ func (kt *userKeyTool) keyByID(ctx context.Context, id string) ([]byte, error) {
 	}
 
 	client := encryption.NewUserKeyStoreClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_USER_KEY, defaults.NewClient())
-	rsp, err := client.GetKey(ctx, &encryption.GetKeyRequest{KeyID: id})
+	bytes, err := kt.loadKey(ctx, client, id)
+	if err != nil && kt.owner != "" && errors.Parse(err.Error()).Code == 404 {
+		bytes, err = kt.createKey(ctx, client, id)
+		if err != nil && errors.Parse(err.Error()).Code == 409 {
+			// Key was created concurrently, use the stored one
+			bytes, err = kt.loadKey(ctx, client, id)
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	bytes, err := base64.StdEncoding.DecodeString(rsp.Key.Content)
+	kt.keys[id] = bytes
+
+	return bytes, nil
+}
+
+// loadKey retrieves a key from the user key store and decodes its content.
+func (kt *userKeyTool) loadKey(ctx context.Context, client encryption.UserKeyStoreClient, id string) ([]byte, error) {
+	rsp, err := client.GetKey(ctx, &encryption.GetKeyRequest{
+		Owner:       kt.owner,
+		KeyID:       id,
+		StrPassword: string(kt.password),
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	kt.keys[id] = bytes
+	return base64.StdEncoding.DecodeString(rsp.Key.Content)
+}
+
+// createKey generates a new key for the tool owner and registers it in the user key store.
+func (kt *userKeyTool) createKey(ctx context.Context, client encryption.UserKeyStoreClient, id string) ([]byte, error) {
+	bytes, err := crypto.RandomBytes(32)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = client.AddKey(ctx, &encryption.AddKeyRequest{
+		Key: &encryption.Key{
+			Owner:        kt.owner,
+			ID:           id,
+			Label:        id,
+			Content:      base64.StdEncoding.EncodeToString(bytes),
+			CreationDate: int32(time.Now().Unix()),
+		},
+		StrPassword: string(kt.password),
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	return bytes, nil
 }
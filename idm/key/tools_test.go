@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package key
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micro/go-micro/metadata"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPasswordFromContext(t *testing.T) {
+
+	Convey("Test no password", t, func() {
+		_, ok := PasswordFromContext(context.Background())
+		So(ok, ShouldBeFalse)
+
+		_, ok = PasswordFromContext(WithPassword(context.Background(), []byte{}))
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Test password set in context", t, func() {
+		pass, ok := PasswordFromContext(WithPassword(context.Background(), []byte("secret")))
+		So(ok, ShouldBeTrue)
+		So(string(pass), ShouldEqual, "secret")
+	})
+
+	Convey("Test password passed with metadata is ignored", t, func() {
+		ctx := metadata.NewContext(context.Background(), metadata.Metadata{PasswordHeader: "secret"})
+		_, ok := PasswordFromContext(ctx)
+		So(ok, ShouldBeFalse)
+	})
+
+}
+
+func TestGetUserKeyTool(t *testing.T) {
+
+	Convey("Test user key tool is bound to its owner", t, func() {
+		tool := GetUserKeyTool("alice", []byte("secret")).(*userKeyTool)
+		So(tool.owner, ShouldEqual, "alice")
+		So(string(tool.password), ShouldEqual, "secret")
+		So(tool.keys, ShouldNotBeNil)
+	})
+
+	Convey("Test cached keys are used without calling the key store", t, func() {
+		tool := GetUserKeyTool("alice", nil).(*userKeyTool)
+		tool.keys["k1"] = make([]byte, 32)
+
+		sealed, e := tool.GetEncrypted(context.Background(), "k1", []byte("node key"))
+		So(e, ShouldBeNil)
+		plain, e := tool.GetDecrypted(context.Background(), "k1", sealed)
+		So(e, ShouldBeNil)
+		So(string(plain), ShouldEqual, "node key")
+	})
+
+}
@@ -25,12 +25,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/emicklei/go-restful"
 	"go.uber.org/zap"
 
-	"github.com/golang/protobuf/ptypes"
-	"github.com/golang/protobuf/ptypes/any"
 	"github.com/micro/go-micro/errors"
 	"github.com/pmker/yux/common"
 	"github.com/pmker/yux/common/auth"
@@ -77,45 +76,25 @@ func (s *UserMetaHandler) Filter() func(string) string {
 func (s *UserMetaHandler) updateLock(ctx context.Context, meta *idm.UserMeta, operation idm.UpdateUserMetaRequest_UserMetaOp) error {
 	log.Logger(ctx).Info("Should update content lock in ACLs", zap.Any("meta", meta), zap.Any("operation", operation))
 	nodeUuid := meta.NodeUuid
-	aclClient := idm.NewACLServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_ACL, defaults.NewClient())
-	q, _ := ptypes.MarshalAny(&idm.ACLSingleQuery{
-		NodeIDs: []string{nodeUuid},
-		Actions: []*idm.ACLAction{{Name: utils.ACL_CONTENT_LOCK.Name}},
-	})
 	userName, _ := utils.FindUserNameInContext(ctx)
-	stream, err := aclClient.SearchACL(ctx, &idm.SearchACLRequest{Query: &serviceproto.Query{SubQueries: []*any.Any{q}}})
+	locks, err := utils.LoadContentLocks(ctx, nodeUuid)
 	if err != nil {
 		return err
 	}
-	defer stream.Close()
-	for {
-		rsp, e := stream.Recv()
-		if e != nil {
-			break
-		}
-		if rsp == nil {
-			continue
-		}
-		acl := rsp.ACL
-		if userName == "" || acl.Action.Value != userName {
+	if lock, ok := locks[nodeUuid]; ok {
+		if lock.Expired(time.Now()) {
+			if e := utils.DeleteContentLock(ctx, nodeUuid); e != nil {
+				return e
+			}
+		} else if userName == "" || lock.Owner != userName {
 			return errors.Forbidden("lock.update.forbidden", "This file is locked by another user")
 		}
-		break
 	}
 	if operation == idm.UpdateUserMetaRequest_PUT {
-		if _, e := aclClient.CreateACL(ctx, &idm.CreateACLRequest{ACL: &idm.ACL{
-			NodeID: nodeUuid,
-			Action: &idm.ACLAction{Name: "content_lock", Value: meta.JsonValue},
-		}}); e != nil {
-			return e
-		}
-	} else {
-		req := &idm.DeleteACLRequest{Query: &serviceproto.Query{SubQueries: []*any.Any{q}}}
-		if _, e := aclClient.DeleteACL(ctx, req); e != nil {
-			return e
-		}
+		return utils.CreateContentLock(ctx, &utils.ContentLock{NodeUuid: nodeUuid, Owner: meta.JsonValue})
 	}
-	return nil
+	// Also clears lock details that may have been set by a WebDAV client
+	return utils.DeleteContentLock(ctx, nodeUuid)
 }
 
 // Will check for namespace policies before updating / deleting
@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package policy
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+
+	"github.com/pmker/yux/common/proto/idm"
+)
+
+// DecisionCache keeps the policy engine decisions in memory for identical requests. It must be
+// invalidated each time the policy groups or the roles are modified. Request contexts carrying
+// times (ClientTime, ServerTime) naturally produce new keys every minute.
+type DecisionCache struct {
+	sync.Mutex
+	decisions  *cache.Cache
+	generation uint64
+}
+
+// NewDecisionCache creates a cache whose entries expire after ttl.
+func NewDecisionCache(ttl time.Duration) *DecisionCache {
+	return &DecisionCache{
+		decisions: cache.New(ttl, 2*ttl),
+	}
+}
+
+// Get finds a decision for this request. It also returns the current cache generation,
+// which must be passed back to Set once the decision has been computed.
+func (d *DecisionCache) Get(request *idm.PolicyEngineRequest) (*idm.PolicyEngineResponse, uint64, bool) {
+	d.Lock()
+	generation := d.generation
+	d.Unlock()
+	if r, ok := d.decisions.Get(decisionKey(request)); ok {
+		response := r.(idm.PolicyEngineResponse)
+		return &response, generation, true
+	}
+	return nil, generation, false
+}
+
+// Set stores a decision, unless the cache has been invalidated since the generation was read:
+// this decision may have been computed with outdated policies.
+func (d *DecisionCache) Set(request *idm.PolicyEngineRequest, response *idm.PolicyEngineResponse, generation uint64) {
+	d.Lock()
+	defer d.Unlock()
+	if generation != d.generation {
+		return
+	}
+	d.decisions.Set(decisionKey(request), *response, cache.DefaultExpiration)
+}
+
+// Invalidate drops all cached decisions.
+func (d *DecisionCache) Invalidate() {
+	d.Lock()
+	defer d.Unlock()
+	d.generation++
+	d.decisions.Flush()
+}
+
+// decisionKey serializes the request, subjects order being irrelevant to the decision.
+func decisionKey(request *idm.PolicyEngineRequest) string {
+	subjects := append([]string{}, request.Subjects...)
+	sort.Strings(subjects)
+	key, _ := json.Marshal(struct {
+		R string
+		A string
+		S []string
+		C map[string]string
+	}{request.Resource, request.Action, subjects, request.Context})
+	return string(key)
+}
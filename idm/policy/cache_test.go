@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package policy
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/proto/idm"
+)
+
+func TestDecisionCache(t *testing.T) {
+
+	Convey("Decisions are cached for identical requests", t, func() {
+
+		c := NewDecisionCache(time.Minute)
+		request := &idm.PolicyEngineRequest{
+			Resource: "rest:/policy",
+			Action:   "PUT",
+			Subjects: []string{"user:admin", "profile:admin"},
+			Context:  map[string]string{"RemoteAddress": "10.8.0.1", "UserAgent": "curl"},
+		}
+
+		_, generation, ok := c.Get(request)
+		So(ok, ShouldBeFalse)
+		c.Set(request, &idm.PolicyEngineResponse{Allowed: true}, generation)
+
+		same := &idm.PolicyEngineRequest{
+			Resource: "rest:/policy",
+			Action:   "PUT",
+			Subjects: []string{"profile:admin", "user:admin"},
+			Context:  map[string]string{"UserAgent": "curl", "RemoteAddress": "10.8.0.1"},
+		}
+		resp, _, ok := c.Get(same)
+		So(ok, ShouldBeTrue)
+		So(resp.Allowed, ShouldBeTrue)
+
+		// Cached value cannot be modified by callers
+		resp.Allowed = false
+		resp, _, _ = c.Get(same)
+		So(resp.Allowed, ShouldBeTrue)
+
+		other := &idm.PolicyEngineRequest{
+			Resource: "rest:/policy",
+			Action:   "PUT",
+			Subjects: []string{"profile:admin", "user:admin"},
+			Context:  map[string]string{"UserAgent": "curl", "RemoteAddress": "81.1.1.1"},
+		}
+		_, _, ok = c.Get(other)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Invalidation drops decisions and rejects outdated ones", t, func() {
+
+		c := NewDecisionCache(time.Minute)
+		request := &idm.PolicyEngineRequest{Resource: "acl", Action: "read", Subjects: []string{"policy:p1"}}
+
+		_, generation, _ := c.Get(request)
+		c.Set(request, &idm.PolicyEngineResponse{Allowed: true}, generation)
+		c.Invalidate()
+		_, _, ok := c.Get(request)
+		So(ok, ShouldBeFalse)
+
+		// Decision computed before an invalidation is not stored
+		_, generation, _ = c.Get(request)
+		c.Invalidate()
+		c.Set(request, &idm.PolicyEngineResponse{Allowed: true}, generation)
+		_, _, ok = c.Get(request)
+		So(ok, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package conditions
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/ory/ladon"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common/log"
+)
+
+// AuthMethodCondition is a condition which is fulfilled if the user authenticated with at least
+// one of the Methods (pwd, otp, key, ssh), as listed in the AuthMethods policy context value.
+type AuthMethodCondition struct {
+	Methods []string `json:"methods"`
+}
+
+// Fulfills returns true if the given value is a comma-separated list of methods containing one of the Methods.
+func (c *AuthMethodCondition) Fulfills(value interface{}, _ *ladon.Request) bool {
+	s, ok := value.(string)
+	if !ok {
+		log.Logger(context.Background()).Error("passed value must be a string", zap.Any("input param", value))
+		return false
+	}
+	for _, used := range strings.Split(s, ",") {
+		for _, m := range c.Methods {
+			if strings.TrimSpace(used) == m {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetName returns the condition's name.
+func (c *AuthMethodCondition) GetName() string {
+	return "AuthMethodCondition"
+}
+
+// MFALevelCondition is a condition which is fulfilled if the user authenticated with at least
+// MinLevel distinct methods, as given by the AuthMFALevel policy context value.
+type MFALevelCondition struct {
+	MinLevel int `json:"minLevel"`
+}
+
+// Fulfills returns true if the given value is a level greater or equal to MinLevel.
+func (c *MFALevelCondition) Fulfills(value interface{}, _ *ladon.Request) bool {
+	s, ok := value.(string)
+	if !ok {
+		log.Logger(context.Background()).Error("passed value must be a string", zap.Any("input param", value))
+		return false
+	}
+	level, e := strconv.Atoi(s)
+	if e != nil {
+		log.Logger(context.Background()).Error("cannot parse passed value as a level", zap.String("input param", s), zap.Error(e))
+		return false
+	}
+	return level >= c.MinLevel
+}
+
+// GetName returns the condition's name.
+func (c *MFALevelCondition) GetName() string {
+	return "MFALevelCondition"
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package conditions
+
+import (
+	"testing"
+
+	"github.com/ory/ladon"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAuthMethodCondition(t *testing.T) {
+
+	Convey("Canonical auth method tests", t, func() {
+
+		for _, c := range []struct {
+			methods []string
+			value   interface{}
+			pass    bool
+		}{
+			{methods: []string{"otp"}, value: "pwd,otp", pass: true},
+			{methods: []string{"key", "ssh"}, value: "ssh", pass: true},
+			{methods: []string{"otp"}, value: "pwd", pass: false},
+			{methods: []string{"otp"}, value: "", pass: false},
+			{methods: []string{"otp"}, value: nil, pass: false},
+		} {
+			condition := &AuthMethodCondition{Methods: c.methods}
+			So(condition.Fulfills(c.value, new(ladon.Request)), ShouldEqual, c.pass)
+		}
+	})
+}
+
+func TestMFALevelCondition(t *testing.T) {
+
+	Convey("Canonical mfa level tests", t, func() {
+
+		for _, c := range []struct {
+			minLevel int
+			value    interface{}
+			pass     bool
+		}{
+			{minLevel: 2, value: "2", pass: true},
+			{minLevel: 2, value: "3", pass: true},
+			{minLevel: 2, value: "1", pass: false},
+			{minLevel: 1, value: "one", pass: false},
+			{minLevel: 1, value: 1, pass: false},
+		} {
+			condition := &MFALevelCondition{MinLevel: c.minLevel}
+			So(condition.Fulfills(c.value, new(ladon.Request)), ShouldEqual, c.pass)
+		}
+	})
+}
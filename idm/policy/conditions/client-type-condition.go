@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package conditions
+
+import (
+	"regexp"
+
+	"github.com/ory/ladon"
+)
+
+// Client types detected from the request user agent
+const (
+	ClientTypeWeb    = "web"
+	ClientTypeMobile = "mobile"
+	ClientTypeSync   = "sync"
+	ClientTypeCLI    = "cli"
+	ClientTypeS3     = "s3"
+	ClientTypeWebDAV = "webdav"
+	ClientTypeOther  = "other"
+)
+
+var (
+	// Order matters: dedicated applications are checked before generic browsers
+	clientTypePatterns = []struct {
+		clientType string
+		pattern    *regexp.Regexp
+	}{
+		{ClientTypeSync, regexp.MustCompile(`(?i)(cells-?sync|pydio-?sync)`)},
+		{ClientTypeMobile, regexp.MustCompile(`(?i)((pydio|cells).*(ios|android)|okhttp|cfnetwork)`)},
+		{ClientTypeCLI, regexp.MustCompile(`(?i)^(cells-client|cec|curl|wget|python-requests|go-http-client)`)},
+		{ClientTypeS3, regexp.MustCompile(`(?i)(aws-sdk|aws-cli|minio|s3cmd|boto)`)},
+		{ClientTypeWebDAV, regexp.MustCompile(`(?i)(webdav|davfs|gvfs|cadaver)`)},
+		{ClientTypeWeb, regexp.MustCompile(`(?i)^mozilla/`)},
+	}
+)
+
+// ClientType guesses the type of client from its user agent. It returns ClientTypeOther if no known pattern matches.
+func ClientType(userAgent string) string {
+	for _, p := range clientTypePatterns {
+		if p.pattern.MatchString(userAgent) {
+			return p.clientType
+		}
+	}
+	return ClientTypeOther
+}
+
+// ClientTypeCondition is a condition which is fulfilled if the client type detected from
+// the user agent is one of the ClientTypes (web, mobile, sync, cli, s3, webdav or other).
+type ClientTypeCondition struct {
+	ClientTypes []string `json:"clientTypes"`
+}
+
+// Fulfills returns true if the given value is a user agent string of one of the client types.
+func (c *ClientTypeCondition) Fulfills(value interface{}, _ *ladon.Request) bool {
+	s, ok := value.(string)
+	if !ok {
+		return false
+	}
+	clientType := ClientType(s)
+	for _, t := range c.ClientTypes {
+		if t == clientType {
+			return true
+		}
+	}
+	return false
+}
+
+// GetName returns the condition's name.
+func (c *ClientTypeCondition) GetName() string {
+	return "ClientTypeCondition"
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package conditions
+
+import (
+	"testing"
+
+	"github.com/ory/ladon"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClientTypeCondition(t *testing.T) {
+
+	Convey("Detect client types from user agents", t, func() {
+
+		for ua, clientType := range map[string]string{
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_11_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/65.0.3325.181 Safari/537.36": ClientTypeWeb,
+			"Mozilla/5.0 (Linux; Android 8.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/70.0 Mobile Safari/537.36":                ClientTypeWeb,
+			"Pydio-Native-Android v2.0":                ClientTypeMobile,
+			"CellsiOS/1.0 CFNetwork/976 Darwin/18.2.0": ClientTypeMobile,
+			"cells-sync/0.9.0":                         ClientTypeSync,
+			"cells-client/1.0.0":                       ClientTypeCLI,
+			"curl/7.58.0":                              ClientTypeCLI,
+			"aws-sdk-go/1.15.0 (go1.11; linux; amd64)": ClientTypeS3,
+			"Minio (linux; amd64) minio-go/v6.0.11":    ClientTypeS3,
+			"Microsoft-WebDAV-MiniRedir/10.0.17134":    ClientTypeWebDAV,
+			"WebDAVFS/3.0.0 (03008000) Darwin/17.7.0":  ClientTypeWebDAV,
+			"davfs2/1.5.4 neon/0.30.2":                 ClientTypeWebDAV,
+			"":                                         ClientTypeOther,
+			"SomeBot/1.0":                              ClientTypeOther,
+		} {
+			So(ClientType(ua), ShouldEqual, clientType)
+		}
+	})
+
+	Convey("Canonical client type tests", t, func() {
+
+		condition := &ClientTypeCondition{ClientTypes: []string{ClientTypeWeb, ClientTypeMobile}}
+		So(condition.Fulfills("Mozilla/5.0 (X11; Linux x86_64; rv:62.0) Gecko/20100101 Firefox/62.0", new(ladon.Request)), ShouldBeTrue)
+		So(condition.Fulfills("Pydio-Native-Android v2.0", new(ladon.Request)), ShouldBeTrue)
+		So(condition.Fulfills("curl/7.58.0", new(ladon.Request)), ShouldBeFalse)
+		So(condition.Fulfills(nil, new(ladon.Request)), ShouldBeFalse)
+	})
+}
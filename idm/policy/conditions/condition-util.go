@@ -22,6 +22,7 @@
 package conditions
 
 import (
+	"net"
 	"strconv"
 	"strings"
 	"time"
@@ -88,7 +89,6 @@ func parseOfficeHours(pattern string) (days uint, minuteBegin int, minuteEnd int
 	}
 
 	// Then transforms hours that have a 15:04 format to minutes from midnight
-	// TODO manage time zone
 
 	minuteBegin = timeStringToMinutes(tokens[1])
 	minuteEnd = timeStringToMinutes(tokens[2])
@@ -103,3 +103,46 @@ func timeStringToMinutes(str string) int {
 	minutes, _ := strconv.Atoi(tokens[1])
 	return hours*60 + minutes
 }
+
+// parseRemoteAddress extracts the client IP from a remote address value. The gateway already resolves
+// the client address against trusted proxies, but the value may still carry a port or be a comma-separated
+// chain: the last entry, appended by the closest proxy, is used as the left ones may be forged.
+func parseRemoteAddress(value interface{}) net.IP {
+	s, ok := value.(string)
+	if !ok {
+		return nil
+	}
+	if i := strings.LastIndex(s, ","); i > -1 {
+		s = s[i+1:]
+	}
+	s = strings.TrimSpace(s)
+	if host, _, e := net.SplitHostPort(s); e == nil {
+		s = host
+	}
+	return net.ParseIP(strings.Trim(s, "[]"))
+}
+
+// ipInRanges checks if the IP belongs to one of the ranges, given either as CIDR blocks or single addresses.
+func ipInRanges(ip net.IP, ranges []string) (bool, error) {
+	for _, r := range ranges {
+		r = strings.TrimSpace(r)
+		if !strings.Contains(r, "/") {
+			single := net.ParseIP(r)
+			if single == nil {
+				return false, &net.ParseError{Type: "IP address", Text: r}
+			}
+			if single.Equal(ip) {
+				return true, nil
+			}
+			continue
+		}
+		_, ipNet, e := net.ParseCIDR(r)
+		if e != nil {
+			return false, e
+		}
+		if ipNet.Contains(ip) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package conditions
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ory/ladon"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common/log"
+)
+
+var (
+	// countryGroups maps aliases that can be used in country lists to their member countries
+	countryGroups = map[string][]string{
+		"EU": {
+			"AT", "BE", "BG", "HR", "CY", "CZ", "DK", "EE", "FI", "FR", "DE", "GR", "HU", "IE",
+			"IT", "LV", "LT", "LU", "MT", "NL", "PL", "PT", "RO", "SK", "SI", "ES", "SE",
+		},
+	}
+)
+
+// CountryMatchCondition is a condition which is fulfilled if the remote address is located in one of
+// the Countries, given as ISO 3166-1 alpha-2 codes or as the "EU" alias. The location is resolved
+// with the GeoIP database loaded at policy service startup.
+type CountryMatchCondition struct {
+	Countries []string `json:"countries"`
+}
+
+// Fulfills returns true if the given value is a remote address located in one of the countries.
+func (c *CountryMatchCondition) Fulfills(value interface{}, _ *ladon.Request) bool {
+	country, ok := resolveCountry(value)
+	return ok && countryInList(country, c.Countries)
+}
+
+// GetName returns the condition's name.
+func (c *CountryMatchCondition) GetName() string {
+	return "CountryMatchCondition"
+}
+
+// CountryNotMatchCondition is a condition which is fulfilled if the remote address is *NOT* located
+// in any of the Countries. Addresses that cannot be found in the GeoIP database (e.g. private
+// ranges) are considered as located outside of the listed countries.
+type CountryNotMatchCondition struct {
+	Countries []string `json:"countries"`
+}
+
+// Fulfills returns true if the given value is a remote address located outside of all the countries.
+func (c *CountryNotMatchCondition) Fulfills(value interface{}, _ *ladon.Request) bool {
+	country, ok := resolveCountry(value)
+	return ok && !countryInList(country, c.Countries)
+}
+
+// GetName returns the condition's name.
+func (c *CountryNotMatchCondition) GetName() string {
+	return "CountryNotMatchCondition"
+}
+
+// resolveCountry finds the country of a remote address. It returns false if the address
+// is invalid or if no GeoIP database is loaded.
+func resolveCountry(value interface{}) (string, bool) {
+	ip := parseRemoteAddress(value)
+	if ip == nil {
+		log.Logger(context.Background()).Error("passed value must be a valid remote address", zap.Any("input param", value))
+		return "", false
+	}
+	db := getGeoIPDatabase()
+	if db == nil {
+		log.Logger(context.Background()).Error("no geoip database loaded, cannot check country conditions")
+		return "", false
+	}
+	return db.Country(ip), true
+}
+
+func countryInList(country string, countries []string) bool {
+	if country == "" {
+		return false
+	}
+	for _, c := range countries {
+		c = strings.ToUpper(strings.TrimSpace(c))
+		if group, ok := countryGroups[c]; ok {
+			if countryInList(country, group) {
+				return true
+			}
+		} else if c == country {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package conditions
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/ory/ladon"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testGeoIPDatabase = `first,last,country
+# Sample ranges
+2.0.0.0,2.15.255.255,FR
+5.10.0.0,5.10.255.255,US
+31.0.0.0,31.0.255.255,de
+2a01:e00::,2a01:e3f:ffff:ffff:ffff:ffff:ffff:ffff,FR
+`
+
+func TestGeoIPDatabase(t *testing.T) {
+
+	Convey("Resolve countries from a ranges list", t, func() {
+
+		db, e := ReadGeoIPDatabase(strings.NewReader(testGeoIPDatabase))
+		So(e, ShouldBeNil)
+		So(db.Country(net.ParseIP("2.3.4.5")), ShouldEqual, "FR")
+		So(db.Country(net.ParseIP("2.15.255.255")), ShouldEqual, "FR")
+		So(db.Country(net.ParseIP("5.10.0.0")), ShouldEqual, "US")
+		So(db.Country(net.ParseIP("31.0.1.1")), ShouldEqual, "DE")
+		So(db.Country(net.ParseIP("2a01:e00::1")), ShouldEqual, "FR")
+		So(db.Country(net.ParseIP("1.1.1.1")), ShouldBeEmpty)
+		So(db.Country(net.ParseIP("4.1.1.1")), ShouldBeEmpty)
+		So(db.Country(net.ParseIP("2001:db8::1")), ShouldBeEmpty)
+
+		_, e = ReadGeoIPDatabase(strings.NewReader("first,last,country\n"))
+		So(e, ShouldNotBeNil)
+	})
+}
+
+func TestCountryConditions(t *testing.T) {
+
+	Convey("Country conditions without database", t, func() {
+
+		SetGeoIPDatabase(nil)
+		So((&CountryMatchCondition{Countries: []string{"FR"}}).Fulfills("2.3.4.5", new(ladon.Request)), ShouldBeFalse)
+		So((&CountryNotMatchCondition{Countries: []string{"FR"}}).Fulfills("2.3.4.5", new(ladon.Request)), ShouldBeFalse)
+	})
+
+	Convey("Canonical country tests", t, func() {
+
+		db, e := ReadGeoIPDatabase(strings.NewReader(testGeoIPDatabase))
+		So(e, ShouldBeNil)
+		SetGeoIPDatabase(db)
+		defer SetGeoIPDatabase(nil)
+
+		for _, c := range []struct {
+			countries []string
+			value     interface{}
+			match     bool
+			notMatch  bool
+		}{
+			{countries: []string{"FR"}, value: "2.3.4.5:8080", match: true, notMatch: false},
+			{countries: []string{"fr", "US"}, value: "5.10.3.3", match: true, notMatch: false},
+			{countries: []string{"EU"}, value: "31.0.0.12", match: true, notMatch: false},
+			{countries: []string{"EU"}, value: "5.10.3.3", match: false, notMatch: true},
+			{countries: []string{"EU"}, value: "[2a01:e00::1]:443", match: true, notMatch: false},
+			// Unknown addresses are outside of any country
+			{countries: []string{"EU"}, value: "192.168.0.1", match: false, notMatch: true},
+			// Invalid values never fulfill the conditions
+			{countries: []string{"EU"}, value: "unknown", match: false, notMatch: false},
+		} {
+			So((&CountryMatchCondition{Countries: c.countries}).Fulfills(c.value, new(ladon.Request)), ShouldEqual, c.match)
+			So((&CountryNotMatchCondition{Countries: c.countries}).Fulfills(c.value, new(ladon.Request)), ShouldEqual, c.notMatch)
+		}
+	})
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package conditions
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	geoIPLock sync.RWMutex
+	geoIP     *GeoIPDatabase
+)
+
+type geoIPRange struct {
+	start   net.IP
+	end     net.IP
+	country string
+}
+
+// GeoIPDatabase resolves IP addresses to ISO 3166-1 alpha-2 country codes. It is built from a CSV
+// file listing one range per line as "first-ip,last-ip,country", e.g. the free db-ip.com country lite
+// database. Both IPv4 and IPv6 ranges are supported.
+type GeoIPDatabase struct {
+	ranges []geoIPRange
+}
+
+// ReadGeoIPDatabase parses a CSV ranges list. Lines that do not start with a valid IP (headers, comments) are ignored.
+func ReadGeoIPDatabase(reader io.Reader) (*GeoIPDatabase, error) {
+
+	r := csv.NewReader(reader)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	db := &GeoIPDatabase{}
+	for {
+		record, e := r.Read()
+		if e == io.EOF {
+			break
+		} else if e != nil {
+			return nil, e
+		}
+		if len(record) < 3 {
+			continue
+		}
+		start := net.ParseIP(strings.TrimSpace(record[0]))
+		end := net.ParseIP(strings.TrimSpace(record[1]))
+		if start == nil || end == nil {
+			continue
+		}
+		db.ranges = append(db.ranges, geoIPRange{
+			start:   start.To16(),
+			end:     end.To16(),
+			country: strings.ToUpper(strings.TrimSpace(record[2])),
+		})
+	}
+	if len(db.ranges) == 0 {
+		return nil, fmt.Errorf("no valid ip range found in geoip database")
+	}
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return bytes.Compare(db.ranges[i].start, db.ranges[j].start) < 0
+	})
+	return db, nil
+}
+
+// Country returns the country code of the range containing the IP, or an empty string if none is found.
+func (d *GeoIPDatabase) Country(ip net.IP) string {
+	ip = ip.To16()
+	if ip == nil {
+		return ""
+	}
+	// Find the last range starting before or at this IP
+	i := sort.Search(len(d.ranges), func(i int) bool {
+		return bytes.Compare(d.ranges[i].start, ip) > 0
+	}) - 1
+	if i < 0 || bytes.Compare(ip, d.ranges[i].end) > 0 {
+		return ""
+	}
+	return d.ranges[i].country
+}
+
+// LoadGeoIPDatabase reads the database from a local file and registers it for the country conditions.
+func LoadGeoIPDatabase(filename string) error {
+	f, e := os.Open(filename)
+	if e != nil {
+		return e
+	}
+	defer f.Close()
+	db, e := ReadGeoIPDatabase(f)
+	if e != nil {
+		return e
+	}
+	SetGeoIPDatabase(db)
+	return nil
+}
+
+// SetGeoIPDatabase registers the database used by the country conditions.
+func SetGeoIPDatabase(db *GeoIPDatabase) {
+	geoIPLock.Lock()
+	defer geoIPLock.Unlock()
+	geoIP = db
+}
+
+func getGeoIPDatabase() *GeoIPDatabase {
+	geoIPLock.RLock()
+	defer geoIPLock.RUnlock()
+	return geoIP
+}
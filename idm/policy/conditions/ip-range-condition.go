@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package conditions
+
+import (
+	"context"
+
+	"github.com/ory/ladon"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common/log"
+)
+
+// IPRangeMatchCondition is a condition which is fulfilled if the remote address belongs
+// to one of the Ranges, given as CIDR blocks (e.g. 10.8.0.0/16) or single IP addresses.
+type IPRangeMatchCondition struct {
+	Ranges []string `json:"ranges"`
+}
+
+// Fulfills returns true if the given value is a remote address within one of the ranges.
+func (c *IPRangeMatchCondition) Fulfills(value interface{}, _ *ladon.Request) bool {
+
+	ip := parseRemoteAddress(value)
+	if ip == nil {
+		log.Logger(context.Background()).Error("passed value must be a valid remote address", zap.Any("input param", value))
+		return false
+	}
+
+	matches, e := ipInRanges(ip, c.Ranges)
+	if e != nil {
+		log.Logger(context.Background()).Error("cannot parse ip ranges", zap.Strings("ranges", c.Ranges), zap.Error(e))
+		return false
+	}
+
+	return matches
+}
+
+// GetName returns the condition's name.
+func (c *IPRangeMatchCondition) GetName() string {
+	return "IPRangeMatchCondition"
+}
+
+// IPRangeNotMatchCondition is a condition which is fulfilled if the remote address does *NOT*
+// belong to any of the Ranges, given as CIDR blocks or single IP addresses.
+type IPRangeNotMatchCondition struct {
+	Ranges []string `json:"ranges"`
+}
+
+// Fulfills returns true if the given value is a remote address outside of all the ranges.
+// An invalid remote address or range never fulfills the condition.
+func (c *IPRangeNotMatchCondition) Fulfills(value interface{}, _ *ladon.Request) bool {
+
+	ip := parseRemoteAddress(value)
+	if ip == nil {
+		log.Logger(context.Background()).Error("passed value must be a valid remote address", zap.Any("input param", value))
+		return false
+	}
+
+	matches, e := ipInRanges(ip, c.Ranges)
+	if e != nil {
+		log.Logger(context.Background()).Error("cannot parse ip ranges", zap.Strings("ranges", c.Ranges), zap.Error(e))
+		return false
+	}
+
+	return !matches
+}
+
+// GetName returns the condition's name.
+func (c *IPRangeNotMatchCondition) GetName() string {
+	return "IPRangeNotMatchCondition"
+}
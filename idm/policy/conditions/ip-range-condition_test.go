@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package conditions
+
+import (
+	"testing"
+
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/manager/memory"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pmker/yux/common/service/context"
+)
+
+func TestIPRangeConditions(t *testing.T) {
+
+	Convey("Canonical ip range tests", t, func() {
+
+		ranges := []string{"10.8.0.0/16", "192.168.1.12", "fd00::/8"}
+		for _, c := range []struct {
+			value interface{}
+			pass  bool
+		}{
+			{value: "10.8.3.4", pass: true},
+			{value: "10.8.3.4:52344", pass: true},
+			{value: "10.8.3.4, 172.16.0.1", pass: false},
+			{value: "192.168.1.12", pass: true},
+			{value: "[fd00::12]:443", pass: true},
+			{value: "10.9.3.4", pass: false},
+			{value: "192.168.1.13", pass: false},
+			{value: "172.16.0.1, 10.8.3.4", pass: true},
+		} {
+			So((&IPRangeMatchCondition{Ranges: ranges}).Fulfills(c.value, new(ladon.Request)), ShouldEqual, c.pass)
+			So((&IPRangeNotMatchCondition{Ranges: ranges}).Fulfills(c.value, new(ladon.Request)), ShouldEqual, !c.pass)
+		}
+	})
+
+	Convey("Invalid values never fulfill the conditions", t, func() {
+
+		for _, c := range []struct {
+			ranges []string
+			value  interface{}
+		}{
+			{ranges: []string{"10.8.0.0/16"}, value: "localhost"},
+			{ranges: []string{"10.8.0.0/16"}, value: 12},
+			{ranges: []string{"10.8.0.0/33"}, value: "10.8.3.4"},
+			{ranges: []string{"not-an-ip"}, value: "10.8.3.4"},
+		} {
+			So((&IPRangeMatchCondition{Ranges: c.ranges}).Fulfills(c.value, new(ladon.Request)), ShouldBeFalse)
+			So((&IPRangeNotMatchCondition{Ranges: c.ranges}).Fulfills(c.value, new(ladon.Request)), ShouldBeFalse)
+		}
+	})
+}
+
+func TestIPRangePolicy(t *testing.T) {
+
+	Convey("Test admin API restricted to VPN ranges", t, func() {
+
+		ladonPolicy := &ladon.DefaultPolicy{
+			ID:          "vpn-only-rule",
+			Description: "Deny admin API outside of the VPN ranges",
+			Subjects:    []string{"profile:admin"},
+			Resources:   []string{"rest:/policy<.*>"},
+			Actions:     []string{"<.*>"},
+			Effect:      ladon.DenyAccess,
+			Conditions: ladon.Conditions{
+				servicecontext.HttpMetaRemoteAddress: &IPRangeNotMatchCondition{
+					Ranges: []string{"10.8.0.0/16"},
+				},
+			},
+		}
+		allowPolicy := &ladon.DefaultPolicy{
+			ID:        "admin-rule",
+			Subjects:  []string{"profile:admin"},
+			Resources: []string{"rest:/policy<.*>"},
+			Actions:   []string{"<.*>"},
+			Effect:    ladon.AllowAccess,
+		}
+
+		warden := &ladon.Ladon{Manager: memory.NewMemoryManager()}
+		require.Nil(t, warden.Manager.Create(ladonPolicy))
+		require.Nil(t, warden.Manager.Create(allowPolicy))
+
+		request := func(remote string) *ladon.Request {
+			return &ladon.Request{
+				Subject:  "profile:admin",
+				Resource: "rest:/policy",
+				Action:   "PUT",
+				Context: ladon.Context{
+					servicecontext.HttpMetaRemoteAddress: remote,
+				},
+			}
+		}
+
+		So(warden.IsAllowed(request("10.8.1.1:44321")), ShouldBeNil)
+		So(warden.IsAllowed(request("81.56.12.3:44321")), ShouldNotBeNil)
+	})
+}
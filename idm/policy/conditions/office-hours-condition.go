@@ -31,9 +31,12 @@ import (
 )
 
 // OfficeHoursCondition is a condition which is fulfilled if the current time is
-// within one of the week periods defined by the Matches string, for instance Monday-Friday/08:00/17:30
+// within one of the week periods defined by the Matches string, for instance Monday-Friday/08:00/17:30.
+// If Timezone is set (an IANA name like "Europe/Paris"), days and hours are evaluated in this
+// timezone, otherwise in the timezone of the passed value.
 type OfficeHoursCondition struct {
-	Matches string `json:"matches"`
+	Matches  string `json:"matches"`
+	Timezone string `json:"timezone,omitempty"`
 }
 
 // Fulfills returns true if the given value is a valid Time and is within one of the defined period.
@@ -58,7 +61,14 @@ func (c *OfficeHoursCondition) Fulfills(value interface{}, _ *ladon.Request) boo
 		return false
 	}
 
-	// TODO manage timezone
+	if c.Timezone != "" {
+		loc, e := time.LoadLocation(c.Timezone)
+		if e != nil {
+			log.Logger(context.Background()).Error("cannot load timezone", zap.String("timezone", c.Timezone), zap.Error(e))
+			return false
+		}
+		t = t.In(loc)
+	}
 
 	// check week day
 	if !isWeekdayValid(days, t.Weekday()) {
@@ -53,6 +53,33 @@ func TestOfficeHoursCondition(t *testing.T) {
 	})
 }
 
+func TestOfficeHoursConditionTimezone(t *testing.T) {
+
+	Convey("Office hours are evaluated in the condition timezone", t, func() {
+
+		for _, c := range []struct {
+			timezone string
+			value    interface{}
+			pass     bool
+		}{
+			// 07:30 UTC is 08:30 in Paris (winter time)
+			{timezone: "Europe/Paris", value: "2018-02-14T07:30+0000", pass: true},
+			{timezone: "", value: "2018-02-14T07:30+0000", pass: false},
+			// Wednesday 23:00 in New York is already Thursday in Paris
+			{timezone: "Europe/Paris", value: "2018-02-14T23:00-0500", pass: false},
+			{timezone: "America/New_York", value: "2018-02-14T09:00+0100", pass: false},
+			{timezone: "America/New_York", value: "2018-02-14T15:00+0100", pass: true},
+			{timezone: "Invalid/Zone", value: "2018-02-14T15:04+0100", pass: false},
+		} {
+			condition := &OfficeHoursCondition{
+				Matches:  "Monday-Wednesday/08:00/17:30",
+				Timezone: c.timezone,
+			}
+			So(condition.Fulfills(c.value, new(ladon.Request)), ShouldEqual, c.pass)
+		}
+	})
+}
+
 func TestOfficeHoursPolicy(t *testing.T) {
 
 	Convey("Test DateWithinPeriodPolicy", t, func() {
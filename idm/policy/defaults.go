@@ -132,6 +132,8 @@ var (
 						"rest:/frontend/<.*>",
 						"rest:/tree/<.*>",
 						"rest:/templates",
+						"rest:/quota/usage",
+						"rest:/auth/token/personal<.*>",
 					},
 					Actions: []string{"GET", "POST", "DELETE", "PUT", "PATCH"},
 					Effect:  ladon.AllowAccess,
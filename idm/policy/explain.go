@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package policy
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ory/ladon"
+
+	"github.com/pmker/yux/common/proto/idm"
+)
+
+// Explain evaluates every policy of the groups against the request, for each of its subjects, and details
+// which parts of each policy matched. The decision follows the policy engine rules: a deny policy applying
+// to any of the subjects wins, otherwise a single allow policy is enough. Dry-run groups of the request
+// are evaluated in place of the stored groups with the same Uuid.
+func Explain(stored []*idm.PolicyGroup, request *idm.PolicyExplainRequest) *idm.PolicyExplainResponse {
+
+	groups, dryRun := mergeDryRunGroups(stored, request.DryRunGroups)
+	reqContext := make(ladon.Context, len(request.Context))
+	for k, v := range request.Context {
+		reqContext[k] = v
+	}
+
+	response := &idm.PolicyExplainResponse{
+		Decision: &idm.PolicyEngineResponse{},
+		Subjects: request.Subjects,
+	}
+	var allow, deny *idm.PolicyExplanation
+	for _, subject := range request.Subjects {
+		ladonRequest := &ladon.Request{
+			Subject:  subject,
+			Resource: request.Resource,
+			Action:   request.Action,
+			Context:  reqContext,
+		}
+		for _, group := range groups {
+			for _, p := range group.Policies {
+				explanation, allowAccess := explainPolicy(ladonRequest, p)
+				explanation.GroupUuid = group.Uuid
+				explanation.GroupName = group.Name
+				explanation.DryRun = dryRun[group]
+				response.Explanations = append(response.Explanations, explanation)
+				if !explanation.Applies {
+					continue
+				}
+				if allowAccess && allow == nil {
+					allow = explanation
+				} else if !allowAccess && deny == nil {
+					deny = explanation
+				}
+			}
+		}
+	}
+
+	if deny != nil {
+		response.Decision.ExplicitDeny = true
+		response.DecidingPolicy = deny
+	} else if allow != nil {
+		response.Decision.Allowed = true
+		response.DecidingPolicy = allow
+	} else {
+		response.Decision.DefaultDeny = true
+	}
+	return response
+}
+
+// explainPolicy matches a single policy like ladon does, but without stopping at the first mismatch.
+func explainPolicy(request *ladon.Request, policy *idm.Policy) (*idm.PolicyExplanation, bool) {
+
+	ladonPolicy := ProtoToLadonPolicy(policy)
+	explanation := &idm.PolicyExplanation{
+		Policy:  policy,
+		Subject: request.Subject,
+	}
+	var err error
+	matcher := ladon.DefaultMatcher
+	if explanation.SubjectMatch, err = matcher.Matches(ladonPolicy, ladonPolicy.GetSubjects(), request.Subject); err == nil {
+		if explanation.ResourceMatch, err = matcher.Matches(ladonPolicy, ladonPolicy.GetResources(), request.Resource); err == nil {
+			explanation.ActionMatch, err = matcher.Matches(ladonPolicy, ladonPolicy.GetActions(), request.Action)
+		}
+	}
+	if err != nil {
+		explanation.Error = err.Error()
+	}
+
+	applies := err == nil && explanation.SubjectMatch && explanation.ResourceMatch && explanation.ActionMatch
+	for key, condition := range ladonPolicy.GetConditions() {
+		value := request.Context[key]
+		conditionExplanation := &idm.PolicyConditionExplanation{
+			Key:       key,
+			Type:      condition.GetName(),
+			Fulfilled: condition.Fulfills(value, request),
+		}
+		if value != nil {
+			conditionExplanation.Value = fmt.Sprintf("%v", value)
+		}
+		applies = applies && conditionExplanation.Fulfilled
+		explanation.Conditions = append(explanation.Conditions, conditionExplanation)
+	}
+	sort.Slice(explanation.Conditions, func(i, j int) bool {
+		return explanation.Conditions[i].Key < explanation.Conditions[j].Key
+	})
+	explanation.Applies = applies
+
+	return explanation, ladonPolicy.AllowAccess()
+}
+
+// mergeDryRunGroups replaces stored groups by the dry-run groups with the same Uuid, and appends the new ones.
+func mergeDryRunGroups(stored []*idm.PolicyGroup, dryRunGroups []*idm.PolicyGroup) ([]*idm.PolicyGroup, map[*idm.PolicyGroup]bool) {
+
+	dryRun := make(map[*idm.PolicyGroup]bool, len(dryRunGroups))
+	replaced := make(map[string]*idm.PolicyGroup, len(dryRunGroups))
+	for _, group := range dryRunGroups {
+		dryRun[group] = true
+		if group.Uuid != "" {
+			replaced[group.Uuid] = group
+		}
+	}
+
+	var groups []*idm.PolicyGroup
+	for _, group := range stored {
+		if dryRunGroup, ok := replaced[group.Uuid]; ok {
+			groups = append(groups, dryRunGroup)
+			delete(replaced, group.Uuid)
+		} else {
+			groups = append(groups, group)
+		}
+	}
+	// Remaining groups are new
+	for _, group := range dryRunGroups {
+		if _, ok := replaced[group.Uuid]; ok || group.Uuid == "" {
+			groups = append(groups, group)
+		}
+	}
+	return groups, dryRun
+}
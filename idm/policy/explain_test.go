@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package policy
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/proto/idm"
+	"github.com/pmker/yux/common/service/context"
+)
+
+func testExplainGroups() []*idm.PolicyGroup {
+	return []*idm.PolicyGroup{
+		{
+			Uuid: "rest-group",
+			Name: "Rest Group",
+			Policies: []*idm.Policy{
+				{
+					Id:        "users-read",
+					Subjects:  []string{"profile:standard"},
+					Resources: []string{"rest:/user<.*>"},
+					Actions:   []string{"GET"},
+					Effect:    idm.PolicyEffect_allow,
+				},
+				{
+					Id:        "users-remote-deny",
+					Subjects:  []string{"role:remote"},
+					Resources: []string{"rest:/user<.*>"},
+					Actions:   []string{"GET", "PUT"},
+					Effect:    idm.PolicyEffect_deny,
+					Conditions: map[string]*idm.PolicyCondition{
+						servicecontext.HttpMetaRemoteAddress: {
+							Type:        "StringMatchCondition",
+							JsonOptions: "{\"matches\":\"^10\\\\.\"}",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestExplain(t *testing.T) {
+
+	Convey("Allow decision is explained per subject", t, func() {
+		response := Explain(testExplainGroups(), &idm.PolicyExplainRequest{
+			Subjects: []string{"user:bob", "profile:standard"},
+			Resource: "rest:/user/bob",
+			Action:   "GET",
+		})
+		So(response.Decision.Allowed, ShouldBeTrue)
+		So(response.DecidingPolicy.Policy.Id, ShouldEqual, "users-read")
+		So(response.DecidingPolicy.Subject, ShouldEqual, "profile:standard")
+		So(response.DecidingPolicy.GroupName, ShouldEqual, "Rest Group")
+		So(response.Explanations, ShouldHaveLength, 4)
+
+		bob := response.Explanations[0]
+		So(bob.Subject, ShouldEqual, "user:bob")
+		So(bob.SubjectMatch, ShouldBeFalse)
+		So(bob.ResourceMatch, ShouldBeTrue)
+		So(bob.ActionMatch, ShouldBeTrue)
+		So(bob.Applies, ShouldBeFalse)
+	})
+
+	Convey("Conditions are evaluated and reported", t, func() {
+		request := &idm.PolicyExplainRequest{
+			Subjects: []string{"profile:standard", "role:remote"},
+			Resource: "rest:/user/bob",
+			Action:   "GET",
+			Context:  map[string]string{servicecontext.HttpMetaRemoteAddress: "10.0.0.12"},
+		}
+		response := Explain(testExplainGroups(), request)
+		So(response.Decision.ExplicitDeny, ShouldBeTrue)
+		So(response.DecidingPolicy.Policy.Id, ShouldEqual, "users-remote-deny")
+		So(response.DecidingPolicy.Conditions, ShouldHaveLength, 1)
+		So(response.DecidingPolicy.Conditions[0].Type, ShouldEqual, "StringMatchCondition")
+		So(response.DecidingPolicy.Conditions[0].Value, ShouldEqual, "10.0.0.12")
+		So(response.DecidingPolicy.Conditions[0].Fulfilled, ShouldBeTrue)
+
+		request.Context[servicecontext.HttpMetaRemoteAddress] = "192.168.0.12"
+		response = Explain(testExplainGroups(), request)
+		So(response.Decision.Allowed, ShouldBeTrue)
+		remote := response.Explanations[3]
+		So(remote.Subject, ShouldEqual, "role:remote")
+		So(remote.SubjectMatch, ShouldBeTrue)
+		So(remote.Conditions[0].Fulfilled, ShouldBeFalse)
+		So(remote.Applies, ShouldBeFalse)
+	})
+
+	Convey("Nothing matching is a default deny", t, func() {
+		response := Explain(testExplainGroups(), &idm.PolicyExplainRequest{
+			Subjects: []string{"profile:standard"},
+			Resource: "rest:/workspace",
+			Action:   "GET",
+		})
+		So(response.Decision.DefaultDeny, ShouldBeTrue)
+		So(response.DecidingPolicy, ShouldBeNil)
+	})
+
+	Convey("Dry-run groups replace stored groups or are added", t, func() {
+		dryRun := testExplainGroups()[0]
+		dryRun.Policies[0].Effect = idm.PolicyEffect_deny
+		added := &idm.PolicyGroup{
+			Name: "New Group",
+			Policies: []*idm.Policy{
+				{Id: "all", Subjects: []string{"<.*>"}, Resources: []string{"<.*>"}, Actions: []string{"<.*>"}, Effect: idm.PolicyEffect_allow},
+			},
+		}
+		response := Explain(testExplainGroups(), &idm.PolicyExplainRequest{
+			Subjects:     []string{"profile:standard"},
+			Resource:     "rest:/user/bob",
+			Action:       "GET",
+			DryRunGroups: []*idm.PolicyGroup{dryRun, added},
+		})
+		So(response.Explanations, ShouldHaveLength, 3)
+		So(response.Decision.ExplicitDeny, ShouldBeTrue)
+		So(response.DecidingPolicy.DryRun, ShouldBeTrue)
+		So(response.Explanations[2].GroupName, ShouldEqual, "New Group")
+		So(response.Explanations[2].Applies, ShouldBeTrue)
+	})
+}
@@ -23,28 +23,72 @@ package grpc
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/micro/go-micro/client"
 	"github.com/ory/ladon"
 
 	"github.com/pmker/yux/common"
 	"github.com/pmker/yux/common/log"
 	"github.com/pmker/yux/common/proto/idm"
 	"github.com/pmker/yux/common/service/context"
+	"github.com/pmker/yux/common/utils"
 	"github.com/pmker/yux/idm/policy"
 )
 
 type Handler struct {
+	decisions *policy.DecisionCache
+}
+
+// NewHandler creates a handler with an empty decisions cache.
+func NewHandler() *Handler {
+	return &Handler{
+		decisions: policy.NewDecisionCache(5 * time.Minute),
+	}
 }
 
 func (h *Handler) IsAllowed(ctx context.Context, request *idm.PolicyEngineRequest, response *idm.PolicyEngineResponse) error {
 
+	decision, err := h.isAllowed(ctx, request)
+	if err != nil {
+		return err
+	}
+	*response = *decision
+
+	return nil
+}
+
+// IsAllowedMany checks all requests at once, responses are returned in the same order.
+func (h *Handler) IsAllowedMany(ctx context.Context, request *idm.IsAllowedManyRequest, response *idm.IsAllowedManyResponse) error {
+
+	for _, r := range request.Requests {
+		decision, err := h.isAllowed(ctx, r)
+		if err != nil {
+			return err
+		}
+		response.Responses = append(response.Responses, decision)
+	}
+
+	return nil
+}
+
+// isAllowed evaluates a request against the stored policies, or returns the cached decision.
+func (h *Handler) isAllowed(ctx context.Context, request *idm.PolicyEngineRequest) (*idm.PolicyEngineResponse, error) {
+
+	cached, generation, ok := h.decisions.Get(request)
+	if ok {
+		return cached, nil
+	}
+
 	dao := servicecontext.GetDAO(ctx).(policy.DAO)
 
 	reqContext := make(map[string]interface{})
 	for k, v := range request.Context {
 		reqContext[k] = v
 	}
+	response := &idm.PolicyEngineResponse{}
 	var allowed bool
 
 	for _, subject := range request.Subjects {
@@ -66,10 +110,11 @@ func (h *Handler) IsAllowed(ctx context.Context, request *idm.PolicyEngineReques
 			// Explicitly Deny : break and return false, ignoring following policies
 			response.ExplicitDeny = true
 			// log.Logger(context.Background()).Error("IsAllowed: explicitly denied", zap.Any("ladonRequest", ladonRequest))
-			return nil
+			h.decisions.Set(request, response, generation)
+			return response, nil
 		} else {
 			// Unexpected Error
-			return err
+			return nil, err
 		}
 	}
 
@@ -78,8 +123,14 @@ func (h *Handler) IsAllowed(ctx context.Context, request *idm.PolicyEngineReques
 	} else {
 		response.DefaultDeny = true
 	}
+	h.decisions.Set(request, response, generation)
 
-	return nil
+	return response, nil
+}
+
+// InvalidateDecisions drops the cached decisions, it is called whenever policies or roles are modified.
+func (h *Handler) InvalidateDecisions() {
+	h.decisions.Invalidate()
 }
 
 func (h *Handler) ListPolicyGroups(ctx context.Context, request *idm.ListPolicyGroupsRequest, response *idm.ListPolicyGroupsResponse) error {
@@ -105,6 +156,11 @@ func (h *Handler) StorePolicyGroup(ctx context.Context, request *idm.StorePolicy
 	}
 
 	response.PolicyGroup = stored
+	h.InvalidateDecisions()
+	client.Publish(ctx, client.NewPublication(common.TOPIC_IDM_EVENT, &idm.ChangeEvent{
+		Type:        idm.ChangeEventType_UPDATE,
+		PolicyGroup: stored,
+	}))
 	log.Auditer(ctx).Info(
 		fmt.Sprintf("Stored policy group [%s]", stored.Name),
 		log.GetAuditId(common.AUDIT_POLICY_GROUP_STORE),
@@ -123,6 +179,11 @@ func (h *Handler) DeletePolicyGroup(ctx context.Context, request *idm.DeletePoli
 	}
 
 	response.Success = true
+	h.InvalidateDecisions()
+	client.Publish(ctx, client.NewPublication(common.TOPIC_IDM_EVENT, &idm.ChangeEvent{
+		Type:        idm.ChangeEventType_DELETE,
+		PolicyGroup: request.PolicyGroup,
+	}))
 	log.Auditer(ctx).Info(
 		fmt.Sprintf("Deleted policy group [%s]", request.PolicyGroup.Name),
 		log.GetAuditId(common.AUDIT_POLICY_GROUP_DELETE),
@@ -131,3 +192,34 @@ func (h *Handler) DeletePolicyGroup(ctx context.Context, request *idm.DeletePoli
 
 	return nil
 }
+
+// ExplainPolicies evaluates the stored policy groups, or the dry-run groups passed in the request, and details
+// how each policy matched the request. If a login is passed, the user subjects are evaluated as well.
+func (h *Handler) ExplainPolicies(ctx context.Context, request *idm.PolicyExplainRequest, response *idm.PolicyExplainResponse) error {
+
+	dao := servicecontext.GetDAO(ctx).(policy.DAO)
+
+	if request.Login != "" {
+		user, err := utils.SearchUniqueUser(ctx, request.Login, "")
+		if err != nil {
+			return err
+		}
+		request.Subjects = append(utils.PolicyRequestSubjectsFromUser(user), request.Subjects...)
+	}
+
+	groups, err := dao.ListPolicyGroups(ctx)
+	if err != nil {
+		return err
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+
+	explained := policy.Explain(groups, request)
+	response.Decision = explained.Decision
+	response.Subjects = explained.Subjects
+	response.Explanations = explained.Explanations
+	response.DecidingPolicy = explained.DecidingPolicy
+
+	return nil
+}
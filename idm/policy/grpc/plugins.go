@@ -33,11 +33,13 @@ import (
 
 	"github.com/ory/ladon"
 	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/config"
 	"github.com/pmker/yux/common/log"
 	"github.com/pmker/yux/common/proto/idm"
 	"github.com/pmker/yux/common/service"
 	"github.com/pmker/yux/common/service/context"
 	"github.com/pmker/yux/idm/policy"
+	"github.com/pmker/yux/idm/policy/conditions"
 )
 
 func init() {
@@ -68,10 +70,24 @@ func init() {
 					TargetVersion: service.ValidVersion("1.2.2"),
 					Up:            Upgrade122,
 				},
+				{
+					TargetVersion: service.ValidVersion("1.3.0"),
+					Up:            Upgrade130,
+				},
 			}),
 			service.WithMicro(func(m micro.Service) error {
-				handler := new(Handler)
+				if dbFile := config.Get("services", common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_POLICY, "geoipDatabase").String(""); dbFile != "" {
+					if e := conditions.LoadGeoIPDatabase(dbFile); e != nil {
+						log.Logger(m.Options().Context).Error("cannot load geoip database, country conditions will not be fulfilled", zap.String("file", dbFile), zap.Error(e))
+					}
+				}
+				handler := NewHandler()
 				idm.RegisterPolicyEngineServiceHandler(m.Options().Server, handler)
+
+				// Drop cached decisions when policies are modified by another instance or when roles are modified
+				if err := m.Options().Server.Subscribe(m.Options().Server.NewSubscriber(common.TOPIC_IDM_EVENT, &Invalidator{handler: handler})); err != nil {
+					return err
+				}
 				return nil
 			}),
 		)
@@ -272,3 +288,31 @@ func Upgrade122(ctx context.Context) error {
 	log.Logger(ctx).Info("Upgraded policy model to v1.2.2")
 	return nil
 }
+
+// Upgrade130 allows logged users to manage their personal access tokens. It is called once at service launch when Cells version become >= 1.3.0.
+func Upgrade130(ctx context.Context) error {
+	dao := servicecontext.GetDAO(ctx).(policy.DAO)
+	if dao == nil {
+		return fmt.Errorf("cannot find DAO for policies initialization")
+	}
+	groups, e := dao.ListPolicyGroups(ctx)
+	if e != nil {
+		return e
+	}
+	for _, group := range groups {
+		if group.Uuid == "rest-apis-default-accesses" {
+			for _, p := range group.Policies {
+				if p.Id == "user-default-policy" {
+					p.Resources = append(p.Resources, "rest:/auth/token/personal<.*>")
+				}
+			}
+			if _, er := dao.StorePolicyGroup(ctx, group); er != nil {
+				log.Logger(ctx).Error("could not update policy group "+group.Uuid, zap.Error(er))
+			} else {
+				log.Logger(ctx).Info("Updated policy group " + group.Uuid)
+			}
+		}
+	}
+	log.Logger(ctx).Info("Upgraded policy model to v1.3.0")
+	return nil
+}
@@ -50,4 +50,32 @@ func init() {
 		return new(conditions.DateAfterCondition)
 	}
 
+	ladon.ConditionFactories[new(conditions.IPRangeMatchCondition).GetName()] = func() ladon.Condition {
+		return new(conditions.IPRangeMatchCondition)
+	}
+
+	ladon.ConditionFactories[new(conditions.IPRangeNotMatchCondition).GetName()] = func() ladon.Condition {
+		return new(conditions.IPRangeNotMatchCondition)
+	}
+
+	ladon.ConditionFactories[new(conditions.CountryMatchCondition).GetName()] = func() ladon.Condition {
+		return new(conditions.CountryMatchCondition)
+	}
+
+	ladon.ConditionFactories[new(conditions.CountryNotMatchCondition).GetName()] = func() ladon.Condition {
+		return new(conditions.CountryNotMatchCondition)
+	}
+
+	ladon.ConditionFactories[new(conditions.ClientTypeCondition).GetName()] = func() ladon.Condition {
+		return new(conditions.ClientTypeCondition)
+	}
+
+	ladon.ConditionFactories[new(conditions.AuthMethodCondition).GetName()] = func() ladon.Condition {
+		return new(conditions.AuthMethodCondition)
+	}
+
+	ladon.ConditionFactories[new(conditions.MFALevelCondition).GetName()] = func() ladon.Condition {
+		return new(conditions.MFALevelCondition)
+	}
+
 }
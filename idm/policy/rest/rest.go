@@ -21,6 +21,8 @@
 package rest
 
 import (
+	"fmt"
+
 	"github.com/emicklei/go-restful"
 
 	"github.com/pmker/yux/common"
@@ -72,3 +74,37 @@ func (h *PolicyHandler) ListPolicies(req *restful.Request, rsp *restful.Response
 
 	rsp.WriteEntity(response)
 }
+
+// ExplainPolicies details how the security policies apply to a request, possibly with unsaved policy groups
+func (h *PolicyHandler) ExplainPolicies(req *restful.Request, rsp *restful.Response) {
+
+	var request idm.PolicyExplainRequest
+	if err := req.ReadEntity(&request); err != nil {
+		service.RestError500(req, rsp, err)
+		return
+	}
+	ctx := req.Request.Context()
+	if request.Resource == "" || request.Action == "" || (request.Login == "" && len(request.Subjects) == 0) {
+		service.RestError500(req, rsp, fmt.Errorf("please provide a resource, an action and a login or some subjects"))
+		return
+	}
+
+	response, err := h.getClient().ExplainPolicies(ctx, &request)
+	if err != nil {
+		service.RestErrorDetect(req, rsp, err)
+		return
+	}
+	languages := i18n.UserLanguagesFromRestRequest(req, config.Default())
+	tr := lang.Bundle().GetTranslationFunc(languages...)
+	// Policies are shared by the explanations of all subjects
+	translated := make(map[*idm.Policy]bool)
+	for _, explanation := range response.Explanations {
+		explanation.GroupName = tr(explanation.GroupName)
+		if explanation.Policy != nil && !translated[explanation.Policy] {
+			explanation.Policy.Description = tr(explanation.Policy.Description)
+			translated[explanation.Policy] = true
+		}
+	}
+
+	rsp.WriteEntity(response)
+}
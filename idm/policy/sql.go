@@ -54,6 +54,11 @@ var (
 		"listJoined":        `SELECT p.uuid,p.name,p.description,p.owner_uuid,p.resource_group,p.last_updated,r.policy_id FROM idm_policy_group as p,idm_policy_rel as r WHERE r.group_uuid=p.uuid`,
 		"listRelPolicies":   `SELECT policy_id FROM idm_policy_rel WHERE group_uuid=?`,
 	}
+
+	// Statements that differ for the postgres driver
+	postgresQueries = map[string]string{
+		"upsertPolicyGroup": `INSERT INTO idm_policy_group (uuid,name,description,owner_uuid,resource_group,last_updated) VALUES (?,?,?,?,?,?) ON CONFLICT (uuid) DO UPDATE SET name=?,description=?,owner_uuid=?,resource_group=?,last_updated=?`,
+	}
 )
 
 // Init of the MySQL DAO
@@ -85,6 +90,9 @@ func (s *sqlimpl) Init(options common.ConfigValues) error {
 	// Preparing the db statements
 	if options.Bool("prepare", true) {
 		for key, query := range queries {
+			if q, ok := postgresQueries[key]; ok && s.Driver() == "postgres" {
+				query = q
+			}
 			if err := s.Prepare(key, query); err != nil {
 				return err
 			}
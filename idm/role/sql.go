@@ -128,9 +128,9 @@ func (s *sqlimpl) Add(role *idm.Role) (*idm.Role, bool, error) {
 			if _, err := stmt.Exec(
 				role.Uuid,
 				role.Label,
-				role.IsTeam,
-				role.GroupRole,
-				role.UserRole,
+				boolToInt(role.IsTeam),
+				boolToInt(role.GroupRole),
+				boolToInt(role.UserRole),
 				role.LastUpdated,
 				strings.Join(role.AutoApplies, ","),
 			); err != nil {
@@ -145,9 +145,9 @@ func (s *sqlimpl) Add(role *idm.Role) (*idm.Role, bool, error) {
 
 			if _, err := stmt.Exec(
 				role.Label,
-				role.IsTeam,
-				role.GroupRole,
-				role.UserRole,
+				boolToInt(role.IsTeam),
+				boolToInt(role.GroupRole),
+				boolToInt(role.UserRole),
 				role.LastUpdated,
 				strings.Join(role.AutoApplies, ","),
 				role.Uuid,
@@ -319,3 +319,11 @@ func (c *queryBuilder) Convert(val *any.Any, driver string) (goqu.Expression, bo
 	return goqu.And(expressions...), true
 
 }
+
+// boolToInt stores flags as 0/1, which all drivers accept for their integer columns
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -47,8 +47,10 @@ func StoreHashDocument(ctx context.Context, link *rest.ShareLink, updateHash ...
 		OwnerId:       claims.Name,
 		TemplateName:  link.ViewTemplateName,
 		RepositoryId:  link.Uuid,
+		StartTime:     link.AccessStart,
 		ExpireTime:    link.AccessEnd,
 		DownloadLimit: link.MaxDownloads,
+		DownloadCount: link.CurrentDownloads,
 		ShareType:     "minisite",
 	}
 
@@ -76,6 +78,12 @@ func StoreHashDocument(ctx context.Context, link *rest.ShareLink, updateHash ...
 	}
 	hashDoc.DownloadDisabled = !DownloadEnabled
 
+	if link.FileDrop != nil && link.FileDrop.Enabled {
+		hashDoc.FileDrop = true
+		hashDoc.FileDropMaxSize = link.FileDrop.MaxFileSize
+		hashDoc.FileDropExtensions = link.FileDrop.AllowedExtensions
+	}
+
 	hashDocMarshaled, _ := json.Marshal(hashDoc)
 	var removeHash string
 	if len(updateHash) > 0 && len(updateHash[0]) > 0 {
@@ -126,6 +134,7 @@ func LoadHashDocumentData(ctx context.Context, shareLink *rest.ShareLink, acls [
 	var linkData *docstore.ShareDocument
 	if err := json.Unmarshal([]byte(linkDoc.Data), &linkData); err == nil {
 		shareLink.ViewTemplateName = linkData.TemplateName
+		shareLink.AccessStart = linkData.StartTime
 		shareLink.AccessEnd = linkData.ExpireTime
 		shareLink.MaxDownloads = linkData.DownloadLimit
 		shareLink.CurrentDownloads = linkData.DownloadCount
@@ -143,12 +152,26 @@ func LoadHashDocumentData(ctx context.Context, shareLink *rest.ShareLink, acls [
 			}
 			shareLink.RestrictToTargetUsers = linkData.RestrictToTargetUsers
 		}
+		if linkData.FileDrop {
+			shareLink.FileDrop = &rest.ShareLinkFileDrop{
+				Enabled:           true,
+				MaxFileSize:       linkData.FileDropMaxSize,
+				AllowedExtensions: linkData.FileDropExtensions,
+			}
+		}
 
 	} else {
 		return err
 	}
 
 	for _, acl := range acls {
+		if linkData.FileDrop {
+			// Read access is only granted for displaying the drop folder
+			if acl.Action.Name == utils.ACL_WRITE.Name {
+				shareLink.Permissions = append(shareLink.Permissions, rest.ShareLinkAccessType_Upload)
+			}
+			continue
+		}
 		if acl.Action.Name == utils.ACL_READ.Name {
 			if shareLink.ViewTemplateName != "pydio_unique_dl" {
 				shareLink.Permissions = append(shareLink.Permissions, rest.ShareLinkAccessType_Preview)
@@ -167,6 +167,10 @@ func (h *SharesHandler) PutCell(req *restful.Request, rsp *restful.Response) {
 		}
 	}
 
+	if err := h.ShareEncryptionKeys(ctx, shareRequest.Room.RootNodes, currentAcls, targetAcls); err != nil {
+		log.Logger(ctx).Error("Share: Error while sharing encryption keys", zap.Error(err))
+	}
+
 	log.Logger(ctx).Debug("Share Policies", zap.Any("before", workspace.Policies))
 	h.UpdatePoliciesFromAcls(ctx, workspace, currentAcls, targetAcls)
 
@@ -241,6 +245,17 @@ func (h *SharesHandler) DeleteCell(req *restful.Request, rsp *restful.Response)
 
 	currWsLabel := ws.Label
 
+	// Remove encryption keys shared through this cell while its roots are still there
+	if acls, roots, err := h.CommonAclsForWorkspace(ctx, id); err == nil {
+		var rootNodes []*tree.Node
+		for _, root := range roots {
+			rootNodes = append(rootNodes, &tree.Node{Uuid: root})
+		}
+		if err := h.ShareEncryptionKeys(ctx, rootNodes, acls, nil); err != nil {
+			log.Logger(ctx).Error("Delete cell: Error while removing shared encryption keys", zap.Error(err))
+		}
+	}
+
 	log.Logger(ctx).Debug("Delete share room", zap.Any("workspaceId", id))
 	// This will load the workspace and its root, and eventually remove the Room root totally
 	if err := h.DeleteWorkspace(ctx, idm.WorkspaceScope_ROOM, id); err != nil {
@@ -278,6 +293,14 @@ func (h *SharesHandler) PutShareLink(req *restful.Request, rsp *restful.Response
 		service.RestErrorDetect(req, rsp, e)
 		return
 	}
+	aclPermissions := link.Permissions
+	if link.FileDrop != nil && link.FileDrop.Enabled {
+		// Visitors of a file drop can only upload. The hidden user still needs to read the root folder
+		// to display it, listings and downloads are hidden by the views layer.
+		link.Permissions = []rest.ShareLinkAccessType{rest.ShareLinkAccessType_Upload}
+		aclPermissions = []rest.ShareLinkAccessType{rest.ShareLinkAccessType_Preview, rest.ShareLinkAccessType_Upload}
+		link.FileDrop.AllowedExtensions = normalizeFileDropExtensions(link.FileDrop.AllowedExtensions)
+	}
 
 	var workspace *idm.Workspace
 	var user *idm.User
@@ -324,6 +347,7 @@ func (h *SharesHandler) PutShareLink(req *restful.Request, rsp *restful.Response
 		link.UserLogin = user.Login
 		link.UserUuid = user.Uuid
 		link.PasswordRequired = putRequest.PasswordEnabled
+		link.CurrentDownloads = 0
 		// Update Workspace Policies to make sure it's readable by the new user
 		workspace.Policies = append(workspace.Policies, &service2.ResourcePolicy{
 			Resource: workspace.UUID,
@@ -340,6 +364,8 @@ func (h *SharesHandler) PutShareLink(req *restful.Request, rsp *restful.Response
 		LoadHashDocumentData(ctx, storedLink, []*idm.ACL{})
 
 		link.PasswordRequired = storedLink.PasswordRequired
+		// Downloads are counted server-side, do not let clients reset them
+		link.CurrentDownloads = storedLink.CurrentDownloads
 		var saveUser bool
 		if putRequest.PasswordEnabled && !storedLink.PasswordRequired {
 			user.Password = putRequest.CreatePassword
@@ -364,7 +390,7 @@ func (h *SharesHandler) PutShareLink(req *restful.Request, rsp *restful.Response
 		}
 	}
 
-	err = h.UpdateACLsForHiddenUser(ctx, user.Uuid, workspace.UUID, link.RootNodes, link.Permissions, !create)
+	err = h.UpdateACLsForHiddenUser(ctx, user.Uuid, workspace.UUID, link.RootNodes, aclPermissions, !create)
 	track("UpdateACLsForHiddenUser")
 	if err != nil {
 		service.RestError500(req, rsp, err)
@@ -709,15 +735,6 @@ func (h *SharesHandler) DiffAcls(ctx context.Context, initial []*idm.ACL, newOne
 // DiffReadRoles detects the roles that have been globally added or removed, whatever the node.
 func (h *SharesHandler) DiffReadRoles(ctx context.Context, initial []*idm.ACL, newOnes []*idm.ACL) (add []string, remove []string) {
 
-	filter := func(acls []*idm.ACL) (roles map[string]bool) {
-		roles = make(map[string]bool)
-		for _, acl := range acls {
-			if acl.Action.Name == utils.ACL_READ.Name {
-				roles[acl.RoleID] = true
-			}
-		}
-		return
-	}
 	diff := func(lefts map[string]bool, rights map[string]bool) (result []string) {
 		for left, _ := range lefts {
 			if _, has := rights[left]; !has {
@@ -726,8 +743,8 @@ func (h *SharesHandler) DiffReadRoles(ctx context.Context, initial []*idm.ACL, n
 		}
 		return
 	}
-	initialRoles := filter(initial)
-	newRoles := filter(newOnes)
+	initialRoles := h.readRoles(initial)
+	newRoles := h.readRoles(newOnes)
 
 	remove = diff(initialRoles, newRoles)
 	add = diff(newRoles, initialRoles)
@@ -735,6 +752,85 @@ func (h *SharesHandler) DiffReadRoles(ctx context.Context, initial []*idm.ACL, n
 	return
 }
 
+// readRoles lists the roles granted read access by these ACLs.
+func (h *SharesHandler) readRoles(acls []*idm.ACL) (roles map[string]bool) {
+	roles = make(map[string]bool)
+	for _, acl := range acls {
+		if acl.Action.Name == utils.ACL_READ.Name {
+			roles[acl.RoleID] = true
+		}
+	}
+	return
+}
+
+// ShareEncryptionKeys shares the keys of files encrypted with the current user key with users that
+// are granted read access to the cell, and removes the keys shared with users that lost it.
+func (h *SharesHandler) ShareEncryptionKeys(ctx context.Context, rootNodes []*tree.Node, initial []*idm.ACL, target []*idm.ACL) error {
+
+	owner, _ := utils.FindUserNameInContext(ctx)
+	if owner == "" {
+		return nil
+	}
+	_, removeRoles := h.DiffReadRoles(ctx, initial, target)
+	var readRoles []string
+	for role := range h.readRoles(target) {
+		readRoles = append(readRoles, role)
+	}
+
+	sharer := views.NewNodeKeySharer(views.NewClientsPool(false))
+	if len(removeRoles) > 0 {
+		logins, err := h.RolesToLogins(ctx, removeRoles)
+		if err != nil {
+			return err
+		}
+		if err := sharer.Unshare(ctx, owner, rootNodes, logins); err != nil {
+			return err
+		}
+	}
+	if len(readRoles) > 0 {
+		logins, err := h.RolesToLogins(ctx, readRoles)
+		if err != nil {
+			return err
+		}
+		return sharer.Share(ctx, owner, rootNodes, logins)
+	}
+	return nil
+}
+
+// RolesToLogins finds the logins of the users owning or belonging to the given roles.
+// Group roles are not expanded.
+func (h *SharesHandler) RolesToLogins(ctx context.Context, roleIds []string) ([]string, error) {
+
+	var subQueries []*any.Any
+	for _, roleId := range roleIds {
+		uuidQ, _ := ptypes.MarshalAny(&idm.UserSingleQuery{Uuid: roleId})
+		roleQ, _ := ptypes.MarshalAny(&idm.UserSingleQuery{HasRole: roleId})
+		subQueries = append(subQueries, uuidQ, roleQ)
+	}
+	userClient := idm.NewUserServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_USER, defaults.NewClient())
+	stream, err := userClient.SearchUser(ctx, &idm.SearchUserRequest{Query: &service2.Query{SubQueries: subQueries, Operation: service2.OperationType_OR}})
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	unique := make(map[string]bool)
+	var logins []string
+	for {
+		resp, e := stream.Recv()
+		if e != nil {
+			break
+		}
+		if resp == nil || resp.User.IsGroup {
+			continue
+		}
+		if _, has := unique[resp.User.Login]; !has {
+			unique[resp.User.Login] = true
+			logins = append(logins, resp.User.Login)
+		}
+	}
+	return logins, nil
+}
+
 // ComputeTargetAcls create ACL objects that should be applied for this cell.
 func (h *SharesHandler) ComputeTargetAcls(ctx context.Context, shareRequest *rest.PutCellRequest, workspaceId string, readonly bool) []*idm.ACL {
 
@@ -1111,6 +1207,12 @@ func (h *SharesHandler) CheckLinkRootNodes(ctx context.Context, link *rest.Share
 		if resp.Node.GetStringMeta(common.META_FLAG_READONLY) != "" {
 			hasReadonly = true
 		}
+		if link.FileDrop.GetEnabled() && resp.Node.IsLeaf() {
+			return errors.Forbidden(common.SERVICE_SHARE, "A file drop link must be set on a folder.")
+		}
+	}
+	if hasReadonly && link.FileDrop.GetEnabled() {
+		return errors.Forbidden(common.SERVICE_SHARE, "This resource is not writeable, you cannot use it as a file drop.")
 	}
 	if hasReadonly {
 		for _, p := range link.Permissions {
@@ -1337,3 +1439,17 @@ func (h *SharesHandler) GetTemplateACLsForMinisite(ctx context.Context, roleId s
 
 	return
 }
+
+// normalizeFileDropExtensions lowercases the extensions allowed in a file drop and strips their leading dots.
+func normalizeFileDropExtensions(extensions []string) (out []string) {
+	seen := make(map[string]bool, len(extensions))
+	for _, ext := range extensions {
+		ext = strings.ToLower(strings.TrimLeft(strings.TrimSpace(ext), "."))
+		if ext == "" || seen[ext] {
+			continue
+		}
+		seen[ext] = true
+		out = append(out, ext)
+	}
+	return
+}
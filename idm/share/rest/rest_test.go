@@ -377,3 +377,13 @@ func TestSharesHandler_AclsToRoomAcls(t *testing.T) {
 
 	})
 }
+
+func TestNormalizeFileDropExtensions(t *testing.T) {
+
+	Convey("Test file drop extensions normalization", t, func() {
+
+		So(normalizeFileDropExtensions(nil), ShouldBeEmpty)
+		So(normalizeFileDropExtensions([]string{".PDF", "pdf", " docx ", "", "..tar.gz"}), ShouldResemble, []string{"pdf", "docx", "tar.gz"})
+
+	})
+}
@@ -35,6 +35,7 @@ import (
 	"github.com/pmker/yux/common"
 	"github.com/pmker/yux/common/log"
 	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/proto/encryption"
 	"github.com/pmker/yux/common/proto/idm"
 	"github.com/pmker/yux/common/proto/rest"
 	"github.com/pmker/yux/common/service"
@@ -251,6 +252,7 @@ func (s *UserHandler) PutUser(req *restful.Request, rsp *restful.Response) {
 		}
 	}
 	var existingAcls []*idm.ACL
+	var resealKeys bool
 	ctxLogin, ctxClaims := utils.FindUserNameInContext(ctx)
 	if update != nil {
 		// Check User Policies
@@ -284,6 +286,7 @@ func (s *UserHandler) PutUser(req *restful.Request, rsp *restful.Response) {
 				service.RestError401(req, rsp, err)
 				return
 			}
+			resealKeys = true
 		}
 		// Load current ACLs for personal role
 		for _, r := range update.Roles {
@@ -358,6 +361,17 @@ func (s *UserHandler) PutUser(req *restful.Request, rsp *restful.Response) {
 		service.RestError500(req, rsp, er)
 		return
 	}
+	if resealKeys {
+		// Keys of USER_PWD encrypted datasources are sealed with the user password
+		keyCli := encryption.NewUserKeyStoreClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_USER_KEY, defaults.NewClient())
+		if _, e := keyCli.UpdateKeysPassword(ctx, &encryption.UpdateKeysPasswordRequest{
+			Owner:       inputUser.Login,
+			OldPassword: inputUser.OldPassword,
+			NewPassword: inputUser.Password,
+		}); e != nil {
+			log.Logger(ctx).Error("cannot re-seal user keys with the new password", inputUser.ZapLogin(), zap.Error(e))
+		}
+	}
 
 	if update == nil {
 		var newRole *idm.Role
@@ -62,6 +62,12 @@ var (
 		"DeleteAttsClean":      `delete from idm_user_attributes where uuid not in (select uuid from idm_user_idx_nodes)`,
 	}
 
+	// Statements that differ for the postgres driver
+	postgresQueries = map[string]string{
+		"AddAttribute": `insert into idm_user_attributes (uuid, name, value) values (?, ?, ?) on conflict (uuid, name) do update set value = excluded.value`,
+		"AddRole":      `insert into idm_user_roles (uuid, role) values (?, ?) on conflict (uuid, role) do nothing`,
+	}
+
 	unPrepared = map[string]func(...interface{}) string{
 		"WhereGroupPath": func(args ...interface{}) string {
 			mpath := []byte(args[0].(string))
@@ -138,6 +144,9 @@ func (s *sqlimpl) Init(options common.ConfigValues) error {
 	// Preparing the db statements
 	if options.Bool("prepare", true) {
 		for key, query := range queries {
+			if q, ok := postgresQueries[key]; ok && s.Driver() == "postgres" {
+				query = q
+			}
 			if err := s.Prepare(key, query); err != nil {
 				return fmt.Errorf("unable to prepare query[%s]: %s - error: %v", key, query, err)
 			}
@@ -577,7 +586,7 @@ func getMPathEquals(tableAlias string, mpath []byte) string {
 	for {
 		var cnt int
 		cnt = (len(mpath) - 1) / indexLen
-		res = append(res, fmt.Sprintf(`%smpath%d LIKE "%s"`, tableAlias, cnt+1, mpath[(cnt*indexLen):]))
+		res = append(res, fmt.Sprintf(`%smpath%d LIKE '%s'`, tableAlias, cnt+1, mpath[(cnt*indexLen):]))
 
 		if idx := cnt * indexLen; idx == 0 {
 			break
@@ -605,10 +614,10 @@ func getMPathLike(tableAlias string, mpath []byte) string {
 		cnt = (len(mpath) - 1) / indexLen
 
 		if !done {
-			res = append(res, fmt.Sprintf(`%smpath%d LIKE "%s"`, tableAlias, cnt+1, mpath[(cnt*indexLen):]))
+			res = append(res, fmt.Sprintf(`%smpath%d LIKE '%s'`, tableAlias, cnt+1, mpath[(cnt*indexLen):]))
 			done = true
 		} else {
-			res = append(res, fmt.Sprintf(`%smpath%d LIKE "%s"`, tableAlias, cnt+1, mpath[(cnt*indexLen):]))
+			res = append(res, fmt.Sprintf(`%smpath%d LIKE '%s'`, tableAlias, cnt+1, mpath[(cnt*indexLen):]))
 		}
 
 		if idx := cnt * indexLen; idx == 0 {
@@ -637,11 +646,11 @@ func getMPathEqualsOrLike(tableAlias string, mpath []byte) string {
 		cnt = (len(mpath) - 1) / indexLen
 
 		if !done {
-			res = append(res, fmt.Sprintf(`%smpath%d LIKE "%s"`, tableAlias, cnt+1, mpath[(cnt*indexLen):len(mpath)-2]))
-			res = append(res, fmt.Sprintf(`%smpath%d LIKE "%s"`, tableAlias, cnt+1, mpath[(cnt*indexLen):]))
+			res = append(res, fmt.Sprintf(`%smpath%d LIKE '%s'`, tableAlias, cnt+1, mpath[(cnt*indexLen):len(mpath)-2]))
+			res = append(res, fmt.Sprintf(`%smpath%d LIKE '%s'`, tableAlias, cnt+1, mpath[(cnt*indexLen):]))
 			done = true
 		} else {
-			res = append(res, fmt.Sprintf(`%smpath%d LIKE "%s"`, tableAlias, cnt+1, mpath[(cnt*indexLen):]))
+			res = append(res, fmt.Sprintf(`%smpath%d LIKE '%s'`, tableAlias, cnt+1, mpath[(cnt*indexLen):]))
 		}
 
 		if idx := cnt * indexLen; idx == 0 {
@@ -0,0 +1,18 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS idm_workspaces (
+    uuid VARCHAR(128) NOT NULL,
+    label VARCHAR(500) NOT NULL,
+    description VARCHAR(1000) NULL,
+    attributes VARCHAR(2000) NULL,
+    slug VARCHAR(500) NOT NULL,
+    scope INTEGER,
+    last_updated INTEGER,
+
+    PRIMARY KEY (uuid),
+    UNIQUE (slug)
+);
+CREATE INDEX IF NOT EXISTS idm_workspaces_label_idx ON idm_workspaces (label);
+CREATE INDEX IF NOT EXISTS idm_workspaces_scope_idx ON idm_workspaces (scope);
+
+-- +migrate Down
+DROP TABLE idm_workspaces;
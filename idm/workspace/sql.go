@@ -45,6 +45,13 @@ var (
 		"ExistsWorkspace":         `select count(uuid) from idm_workspaces where uuid = ?`,
 		"ExistsWorkspaceWithSlug": `select count(uuid) from idm_workspaces where slug = ?`,
 	}
+
+	// Statements that differ for the postgres driver
+	postgresQueries = map[string]string{
+		"AddWorkspace": `insert into idm_workspaces (uuid, label, description, attributes, slug, scope, last_updated) values (?, ?, ?, ?, ?, ?, ?)
+			on conflict (uuid) do update set label = excluded.label, description = excluded.description, attributes = excluded.attributes,
+			slug = excluded.slug, scope = excluded.scope, last_updated = excluded.last_updated`,
+	}
 )
 
 // Impl of the Mysql interface
@@ -78,6 +85,9 @@ func (s *sqlimpl) Init(options common.ConfigValues) error {
 	// Preparing the db statements
 	if options.Bool("prepare", true) {
 		for key, query := range queries {
+			if q, ok := postgresQueries[key]; ok && s.Driver() == "postgres" {
+				query = q
+			}
 			if err := s.Prepare(key, query); err != nil {
 				return err
 			}
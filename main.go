@@ -49,6 +49,8 @@ import (
 	//_ "github.com/pmker/yux/data/key/grpc"
 	//_ "github.com/pmker/yux/data/meta/grpc"
 	//_ "github.com/pmker/yux/data/meta/rest"
+	//_ "github.com/pmker/yux/data/quota/grpc"
+	//_ "github.com/pmker/yux/data/quota/rest"
 	//_ "github.com/pmker/yux/data/source/index/grpc"
 	//_ "github.com/pmker/yux/data/source/objects/grpc"
 	//_ "github.com/pmker/yux/data/source/sync/grpc"
@@ -65,6 +67,9 @@ import (
 	//_ "github.com/pmker/yux/gateway/dav"
 	//_ "github.com/pmker/yux/gateway/micro"
 	//_ "github.com/pmker/yux/gateway/proxy"
+	//_ "github.com/pmker/yux/gateway/s3"
+	//_ "github.com/pmker/yux/gateway/sftp"
+	//_ "github.com/pmker/yux/gateway/tus"
 	//_ "github.com/pmker/yux/gateway/websocket/api"
 	//_ "github.com/pmker/yux/gateway/wopi"
 	//
@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+// Package actions defines the contract every scheduler action must fulfill and
+// provides the registry where actions are declared by the various services.
+package actions
+
+import (
+	"context"
+
+	"github.com/micro/go-micro/client"
+
+	"github.com/pmker/yux/common/proto/jobs"
+)
+
+// ConcreteAction is the base interface for pydio actions. All actions must implement this interface.
+type ConcreteAction interface {
+	// GetName returns the unique identifier of this action
+	GetName() string
+	// Init passes the job, a client and the action parameters to a newly created instance
+	Init(job *jobs.Job, cl client.Client, action *jobs.Action) error
+	// Run processes the actual action code
+	Run(ctx context.Context, channels *RunnableChannels, input jobs.ActionMessage) (jobs.ActionMessage, error)
+}
+
+// ProgressProviderAction is an action that can report its progress through the RunnableChannels.
+type ProgressProviderAction interface {
+	ProvidesProgress() bool
+}
+
+// ControllableAction is an action that can be paused and/or stopped while running.
+type ControllableAction interface {
+	CanPause() bool
+	CanStop() bool
+}
+
+// RunnableChannels defines the communication channels between a running action and its parent task.
+type RunnableChannels struct {
+	// Input Channels
+	Pause  chan interface{}
+	Resume chan interface{}
+	// Output Channels
+	Status    chan jobs.TaskStatus
+	StatusMsg chan string
+	Progress  chan float32
+}
+
+// NewRunnableChannels creates a set of buffered channels.
+func NewRunnableChannels() *RunnableChannels {
+	return &RunnableChannels{
+		Pause:     make(chan interface{}, 1),
+		Resume:    make(chan interface{}, 1),
+		Status:    make(chan jobs.TaskStatus, 100),
+		StatusMsg: make(chan string, 100),
+		Progress:  make(chan float32, 100),
+	}
+}
+
+// BlockUntilResume can be called by an action that supports pausing: if a Pause signal
+// was received, it blocks until a Resume signal arrives or the context is done.
+func (r *RunnableChannels) BlockUntilResume(ctx context.Context) {
+	select {
+	case <-r.Pause:
+	default:
+		return
+	}
+	r.Status <- jobs.TaskStatus_Paused
+	select {
+	case <-r.Resume:
+		r.Status <- jobs.TaskStatus_Running
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package images
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/micro/go-micro/client"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/proto/jobs"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/views"
+	"github.com/pmker/yux/scheduler/actions"
+)
+
+var (
+	cleanThumbsActionName = "actions.images.clean"
+)
+
+func init() {
+	actions.GetActionsManager().Register(cleanThumbsActionName, func() actions.ConcreteAction {
+		return &CleanThumbsTask{}
+	})
+}
+
+// CleanThumbsTask removes the thumbnails of a deleted image from the thumbnails store.
+// It accepts the same "ThumbSizes" parameter as the thumbnails action.
+type CleanThumbsTask struct {
+	ThumbRouter views.Handler
+	thumbSizes  map[string]int
+}
+
+// GetName returns the Unique identifier.
+func (c *CleanThumbsTask) GetName() string {
+	return cleanThumbsActionName
+}
+
+// Init passes the parameters to a newly created CleanThumbsTask.
+func (c *CleanThumbsTask) Init(job *jobs.Job, cl client.Client, action *jobs.Action) error {
+	c.thumbSizes = defaultThumbSizes
+	if sizes, ok := action.Parameters["ThumbSizes"]; ok {
+		parsed, e := parseThumbSizes(sizes)
+		if e != nil {
+			return e
+		}
+		c.thumbSizes = parsed
+	}
+	c.ThumbRouter = NewThumbsRouter()
+	return nil
+}
+
+// Run processes the actual action code.
+func (c *CleanThumbsTask) Run(ctx context.Context, channels *actions.RunnableChannels, input jobs.ActionMessage) (jobs.ActionMessage, error) {
+
+	if len(input.Nodes) == 0 || input.Nodes[0].Uuid == "" || !IsSupported(input.Nodes[0]) {
+		return input.WithIgnore(), nil
+	}
+	node := input.Nodes[0]
+	ctx = context.WithValue(ctx, common.PYDIO_CONTEXT_USER_KEY, common.PYDIO_SYSTEM_USERNAME)
+
+	var removed int
+	for id := range c.thumbSizes {
+		thumbNode := &tree.Node{Path: ThumbnailPath(node.Uuid, id)}
+		if _, e := c.ThumbRouter.DeleteNode(ctx, &tree.DeleteNodeRequest{Node: thumbNode}); e == nil {
+			removed++
+		}
+	}
+
+	output := input
+	output.AppendOutput(&jobs.ActionOutput{
+		Success:    true,
+		StringBody: fmt.Sprintf("Removed %d thumbnail(s) for %s", removed, node.Path),
+	})
+	return output, nil
+}
@@ -0,0 +1,301 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package images
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// EXIF tags read by ReadExif.
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+	tagGPSLatitudeRef   = 0x0001
+	tagGPSLatitude      = 0x0002
+	tagGPSLongitudeRef  = 0x0003
+	tagGPSLongitude     = 0x0004
+
+	// Guards against corrupted files
+	maxIFDEntries = 1024
+)
+
+// ExifData gathers the EXIF fields that are stored as metadata.
+type ExifData struct {
+	Make        string       `json:"Make,omitempty"`
+	Model       string       `json:"Model,omitempty"`
+	DateTime    string       `json:"DateTime,omitempty"`
+	Orientation int          `json:"Orientation,omitempty"`
+	GPS         *GPSPosition `json:"-"`
+}
+
+// GPSPosition is a position in decimal degrees, serialized the way the search engine indexes it.
+type GPSPosition struct {
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lon"`
+}
+
+type ifdEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// ReadExif extracts the EXIF data from a JPEG or TIFF stream.
+func ReadExif(r io.Reader) (*ExifData, error) {
+	br := bufio.NewReader(r)
+	magic, e := br.Peek(4)
+	if e != nil {
+		return nil, e
+	}
+	var data []byte
+	switch {
+	case magic[0] == 0xFF && magic[1] == 0xD8:
+		if data, e = readJpegExif(br); e != nil {
+			return nil, e
+		}
+	case bytes.Equal(magic, []byte("II*\x00")) || bytes.Equal(magic, []byte("MM\x00*")):
+		if data, e = ioutil.ReadAll(br); e != nil {
+			return nil, e
+		}
+	default:
+		return nil, fmt.Errorf("unsupported format for exif extraction")
+	}
+	return parseExif(data)
+}
+
+// readJpegExif walks through the JPEG segments until it finds the APP1 Exif segment.
+func readJpegExif(br *bufio.Reader) ([]byte, error) {
+	if _, e := br.Discard(2); e != nil {
+		return nil, e
+	}
+	for {
+		b, e := br.ReadByte()
+		if e != nil {
+			return nil, e
+		}
+		if b != 0xFF {
+			return nil, fmt.Errorf("invalid jpeg marker")
+		}
+		marker, e := br.ReadByte()
+		for e == nil && marker == 0xFF {
+			marker, e = br.ReadByte()
+		}
+		if e != nil {
+			return nil, e
+		}
+		if marker == 0xD9 || marker == 0xDA {
+			// End of image or start of scan: no more metadata
+			return nil, fmt.Errorf("no exif data found")
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			continue
+		}
+		var length uint16
+		if e := binary.Read(br, binary.BigEndian, &length); e != nil {
+			return nil, e
+		}
+		if length < 2 {
+			return nil, fmt.Errorf("invalid jpeg segment length")
+		}
+		if marker != 0xE1 {
+			if _, e := br.Discard(int(length) - 2); e != nil {
+				return nil, e
+			}
+			continue
+		}
+		segment := make([]byte, int(length)-2)
+		if _, e := io.ReadFull(br, segment); e != nil {
+			return nil, e
+		}
+		if bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], nil
+		}
+	}
+}
+
+func parseExif(data []byte) (*ExifData, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("exif data too short")
+	}
+	t := &tiffReader{data: data}
+	switch string(data[0:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid tiff byte order")
+	}
+	if t.order.Uint16(data[2:4]) != 42 {
+		return nil, fmt.Errorf("invalid tiff header")
+	}
+	ifd0, e := t.readIFD(t.order.Uint32(data[4:8]))
+	if e != nil {
+		return nil, e
+	}
+
+	result := &ExifData{
+		Make:     t.stringValue(ifd0, tagMake),
+		Model:    t.stringValue(ifd0, tagModel),
+		DateTime: t.stringValue(ifd0, tagDateTime),
+	}
+	if o, ok := t.uintValue(ifd0, tagOrientation); ok {
+		result.Orientation = int(o)
+	}
+	if offset, ok := t.uintValue(ifd0, tagExifIFD); ok {
+		if exifIFD, e := t.readIFD(offset); e == nil {
+			if d := t.stringValue(exifIFD, tagDateTimeOriginal); d != "" {
+				result.DateTime = d
+			}
+		}
+	}
+	if offset, ok := t.uintValue(ifd0, tagGPSIFD); ok {
+		if gpsIFD, e := t.readIFD(offset); e == nil {
+			result.GPS = t.gpsPosition(gpsIFD)
+		}
+	}
+	return result, nil
+}
+
+func (t *tiffReader) readIFD(offset uint32) (map[uint16]ifdEntry, error) {
+	if uint64(offset)+2 > uint64(len(t.data)) {
+		return nil, fmt.Errorf("ifd offset out of bounds")
+	}
+	count := int(t.order.Uint16(t.data[offset:]))
+	if count > maxIFDEntries || uint64(offset)+2+uint64(count)*12 > uint64(len(t.data)) {
+		return nil, fmt.Errorf("invalid ifd entries count")
+	}
+	entries := make(map[uint16]ifdEntry, count)
+	for i := 0; i < count; i++ {
+		raw := t.data[int(offset)+2+i*12 : int(offset)+2+(i+1)*12]
+		entry := ifdEntry{
+			typ:   t.order.Uint16(raw[2:4]),
+			count: t.order.Uint32(raw[4:8]),
+		}
+		size := uint64(typeSize(entry.typ)) * uint64(entry.count)
+		if size == 0 {
+			continue
+		}
+		if size <= 4 {
+			entry.value = raw[8 : 8+size]
+		} else {
+			valueOffset := uint64(t.order.Uint32(raw[8:12]))
+			if valueOffset+size > uint64(len(t.data)) {
+				continue
+			}
+			entry.value = t.data[valueOffset : valueOffset+size]
+		}
+		entries[t.order.Uint16(raw[0:2])] = entry
+	}
+	return entries, nil
+}
+
+func (t *tiffReader) stringValue(ifd map[uint16]ifdEntry, tag uint16) string {
+	entry, ok := ifd[tag]
+	if !ok || entry.typ != 2 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(entry.value), "\x00"))
+}
+
+func (t *tiffReader) uintValue(ifd map[uint16]ifdEntry, tag uint16) (uint32, bool) {
+	entry, ok := ifd[tag]
+	if !ok {
+		return 0, false
+	}
+	switch entry.typ {
+	case 3:
+		return uint32(t.order.Uint16(entry.value)), true
+	case 4:
+		return t.order.Uint32(entry.value), true
+	}
+	return 0, false
+}
+
+func (t *tiffReader) rationals(ifd map[uint16]ifdEntry, tag uint16) []float64 {
+	entry, ok := ifd[tag]
+	if !ok || entry.typ != 5 {
+		return nil
+	}
+	var values []float64
+	for i := 0; i+8 <= len(entry.value); i += 8 {
+		num := t.order.Uint32(entry.value[i:])
+		den := t.order.Uint32(entry.value[i+4:])
+		if den == 0 {
+			return nil
+		}
+		values = append(values, float64(num)/float64(den))
+	}
+	return values
+}
+
+// gpsPosition converts the degrees/minutes/seconds GPS tags to decimal degrees.
+func (t *tiffReader) gpsPosition(ifd map[uint16]ifdEntry) *GPSPosition {
+	lat := t.rationals(ifd, tagGPSLatitude)
+	lon := t.rationals(ifd, tagGPSLongitude)
+	if len(lat) != 3 || len(lon) != 3 {
+		return nil
+	}
+	pos := &GPSPosition{
+		Latitude:  lat[0] + lat[1]/60 + lat[2]/3600,
+		Longitude: lon[0] + lon[1]/60 + lon[2]/3600,
+	}
+	if t.stringValue(ifd, tagGPSLatitudeRef) == "S" {
+		pos.Latitude = -pos.Latitude
+	}
+	if t.stringValue(ifd, tagGPSLongitudeRef) == "W" {
+		pos.Longitude = -pos.Longitude
+	}
+	if pos.Latitude < -90 || pos.Latitude > 90 || pos.Longitude < -180 || pos.Longitude > 180 {
+		return nil
+	}
+	return pos
+}
+
+func typeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 6, 7:
+		return 1
+	case 3, 8:
+		return 2
+	case 4, 9, 11:
+		return 4
+	case 5, 10, 12:
+		return 8
+	}
+	return 0
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package images
+
+import (
+	"context"
+
+	"github.com/micro/go-micro/client"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/proto/jobs"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/views"
+	"github.com/pmker/yux/scheduler/actions"
+)
+
+var (
+	exifActionName = "actions.images.exif"
+)
+
+func init() {
+	actions.GetActionsManager().Register(exifActionName, func() actions.ConcreteAction {
+		return &ExifProcessor{}
+	})
+}
+
+// ExifProcessor reads the EXIF data of JPEG and TIFF images and stores them as metadata.
+// A GPS position is stored in the GeoLocation meta so that the search engine can index it.
+type ExifProcessor struct {
+	Router views.Handler
+}
+
+// GetName returns the Unique identifier.
+func (p *ExifProcessor) GetName() string {
+	return exifActionName
+}
+
+// Init passes the parameters to a newly created ExifProcessor.
+func (p *ExifProcessor) Init(job *jobs.Job, cl client.Client, action *jobs.Action) error {
+	p.Router = views.NewStandardRouter(views.RouterOptions{AdminView: true})
+	return nil
+}
+
+// Run processes the actual action code.
+func (p *ExifProcessor) Run(ctx context.Context, channels *actions.RunnableChannels, input jobs.ActionMessage) (jobs.ActionMessage, error) {
+
+	if len(input.Nodes) == 0 || !input.Nodes[0].IsLeaf() || !hasExif(input.Nodes[0]) {
+		return input.WithIgnore(), nil
+	}
+	ctx = context.WithValue(ctx, common.PYDIO_CONTEXT_USER_KEY, common.PYDIO_SYSTEM_USERNAME)
+
+	resp, e := p.Router.ReadNode(ctx, &tree.ReadNodeRequest{Node: input.Nodes[0]})
+	if e != nil {
+		return input.WithError(e), e
+	}
+	node := resp.Node
+	reader, e := p.Router.GetObject(ctx, node, &views.GetRequestData{Length: node.Size})
+	if e != nil {
+		return input.WithError(e), e
+	}
+	data, e := ReadExif(reader)
+	reader.Close()
+	if e != nil {
+		// Many images simply do not carry EXIF data
+		log.Logger(ctx).Debug("No exif data extracted", node.ZapPath(), zap.Error(e))
+		return input.WithIgnore(), nil
+	}
+
+	node.SetMeta(MetadataExif, data)
+	if data.GPS != nil {
+		node.SetMeta(MetadataGeoLocation, data.GPS)
+	}
+	if e := updateMeta(ctx, node); e != nil {
+		return input.WithError(e), e
+	}
+
+	output := input.WithNode(node)
+	output.AppendOutput(&jobs.ActionOutput{
+		Success:    true,
+		StringBody: "Extracted exif data for " + node.Path,
+	})
+	return output, nil
+}
+
+// hasExif checks the extension of the formats ReadExif can parse.
+func hasExif(node *tree.Node) bool {
+	switch nodeExtension(node) {
+	case "jpg", "jpeg", "tif", "tiff":
+		return true
+	}
+	return false
+}
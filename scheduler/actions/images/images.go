@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+// Package images provides scheduler actions to generate thumbnails and extract EXIF data
+// from the image files stored in the datasources.
+package images
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	// Register the decoders supported by image.Decode
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/views"
+)
+
+const (
+	// MetadataImageDimensions stores the original width and height of an image.
+	MetadataImageDimensions = "ImageDimensions"
+	// MetadataThumbnails stores the list of generated thumbnails.
+	MetadataThumbnails = "ImageThumbnails"
+	// MetadataExif stores the main EXIF fields.
+	MetadataExif = "ImageExif"
+	// MetadataGeoLocation stores the GPS position as indexed by the search engine.
+	MetadataGeoLocation = "GeoLocation"
+)
+
+var (
+	// SupportedExtensions lists the files extensions that can be decoded.
+	SupportedExtensions = []string{"jpg", "jpeg", "png", "gif", "webp", "bmp", "tif", "tiff"}
+)
+
+// ImageDimensions is the value of the MetadataImageDimensions meta.
+type ImageDimensions struct {
+	Width  int `json:"Width"`
+	Height int `json:"Height"`
+}
+
+// ThumbnailData describes one generated thumbnail.
+type ThumbnailData struct {
+	Id     string `json:"id"`
+	Size   int    `json:"size"`
+	Format string `json:"format"`
+}
+
+// ThumbnailsMeta is the value of the MetadataThumbnails meta.
+type ThumbnailsMeta struct {
+	Processing bool             `json:"Processing"`
+	Thumbnails []*ThumbnailData `json:"thumbnails"`
+}
+
+// HasSize checks if a thumbnail was generated with this size id.
+func (m *ThumbnailsMeta) HasSize(id string) bool {
+	for _, t := range m.Thumbnails {
+		if t.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// IsSupported checks if the node extension is one of the SupportedExtensions.
+func IsSupported(node *tree.Node) bool {
+	ext := nodeExtension(node)
+	for _, e := range SupportedExtensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeExtension returns the lowercase extension of the node name, without the dot.
+func nodeExtension(node *tree.Node) string {
+	name := node.GetStringMeta(common.META_NAMESPACE_NODENAME)
+	if name == "" {
+		name = path.Base(node.Path)
+	}
+	return strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+}
+
+// ThumbnailPath computes the path of a thumbnail inside the thumbnails binary store.
+func ThumbnailPath(nodeUuid string, sizeId string) string {
+	return fmt.Sprintf("%s/%s-%s.jpg", common.PYDIO_THUMBSTORE_NAMESPACE, nodeUuid, sizeId)
+}
+
+// NewThumbsRouter creates a router writing directly to the thumbnails binary store.
+func NewThumbsRouter() *views.Router {
+	return views.NewRouter(views.NewClientsPool(false), []views.Handler{
+		&views.BinaryStoreHandler{
+			StoreName: common.PYDIO_THUMBSTORE_NAMESPACE,
+			AllowPut:  true,
+		},
+		&views.Executor{},
+	})
+}
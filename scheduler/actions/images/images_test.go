@@ -0,0 +1,197 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/proto/tree"
+)
+
+type testEntry struct {
+	tag, typ uint16
+	count    uint32
+	value    []byte
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	out := make([]byte, 2)
+	binary.LittleEndian.PutUint16(out, v)
+	return append(b, out...)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	out := make([]byte, 4)
+	binary.LittleEndian.PutUint32(out, v)
+	return append(b, out...)
+}
+
+// buildTiff writes a little endian TIFF structure with an IFD0 and a GPS IFD.
+func buildTiff(ifd0 []testEntry, gps []testEntry) []byte {
+	ifdSize := func(entries []testEntry) int { return 2 + 12*len(entries) + 4 }
+	// Layout: header, IFD0 with the GPS pointer, GPS IFD, then the values that do not fit in 4 bytes
+	gpsOffset := 8 + ifdSize(ifd0) + 12
+	dataOffset := gpsOffset + ifdSize(gps)
+	ifd0 = append(ifd0, testEntry{tag: tagGPSIFD, typ: 4, count: 1, value: appendUint32(nil, uint32(gpsOffset))})
+
+	header := []byte("II*\x00")
+	header = appendUint32(header, 8)
+	var ifds, data []byte
+	writeIFD := func(entries []testEntry) {
+		ifds = appendUint16(ifds, uint16(len(entries)))
+		for _, e := range entries {
+			ifds = appendUint16(ifds, e.tag)
+			ifds = appendUint16(ifds, e.typ)
+			ifds = appendUint32(ifds, e.count)
+			if len(e.value) <= 4 {
+				ifds = append(ifds, append(e.value, make([]byte, 4-len(e.value))...)...)
+			} else {
+				ifds = appendUint32(ifds, uint32(dataOffset+len(data)))
+				data = append(data, e.value...)
+			}
+		}
+		ifds = appendUint32(ifds, 0)
+	}
+	writeIFD(ifd0)
+	writeIFD(gps)
+	return append(append(header, ifds...), data...)
+}
+
+func rationals(values ...uint32) []byte {
+	var b []byte
+	for _, v := range values {
+		b = appendUint32(b, v)
+	}
+	return b
+}
+
+func testJpeg(exif []byte) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	buf := &bytes.Buffer{}
+	jpeg.Encode(buf, img, nil)
+	encoded := buf.Bytes()
+	if exif == nil {
+		return encoded
+	}
+	segment := append([]byte("Exif\x00\x00"), exif...)
+	app1 := []byte{0xFF, 0xE1}
+	app1 = append(app1, byte((len(segment)+2)>>8), byte(len(segment)+2))
+	app1 = append(app1, segment...)
+	return append(append([]byte{0xFF, 0xD8}, app1...), encoded[2:]...)
+}
+
+func TestReadExif(t *testing.T) {
+
+	tiff := buildTiff([]testEntry{
+		{tag: tagMake, typ: 2, count: 6, value: []byte("Canon\x00")},
+		{tag: tagOrientation, typ: 3, count: 1, value: []byte{6, 0}},
+	}, []testEntry{
+		{tag: tagGPSLatitudeRef, typ: 2, count: 2, value: []byte("N\x00")},
+		{tag: tagGPSLatitude, typ: 5, count: 3, value: rationals(47, 1, 6, 1, 1292, 100)},
+		{tag: tagGPSLongitudeRef, typ: 2, count: 2, value: []byte("W\x00")},
+		{tag: tagGPSLongitude, typ: 5, count: 3, value: rationals(8, 1, 22, 1, 22, 1)},
+	})
+
+	Convey("Read exif and GPS position from a JPEG", t, func() {
+		data, e := ReadExif(bytes.NewReader(testJpeg(tiff)))
+		So(e, ShouldBeNil)
+		So(data.Make, ShouldEqual, "Canon")
+		So(data.Orientation, ShouldEqual, 6)
+		So(data.GPS, ShouldNotBeNil)
+		So(data.GPS.Latitude, ShouldAlmostEqual, 47.10358888888889, 0.000001)
+		So(data.GPS.Longitude, ShouldAlmostEqual, -8.372777777777777, 0.000001)
+	})
+
+	Convey("Read exif from a TIFF stream", t, func() {
+		data, e := ReadExif(bytes.NewReader(tiff))
+		So(e, ShouldBeNil)
+		So(data.Make, ShouldEqual, "Canon")
+		So(data.GPS, ShouldNotBeNil)
+	})
+
+	Convey("Images without exif or with corrupted exif", t, func() {
+		_, e := ReadExif(bytes.NewReader(testJpeg(nil)))
+		So(e, ShouldNotBeNil)
+		_, e = ReadExif(bytes.NewReader([]byte("not an image")))
+		So(e, ShouldNotBeNil)
+		_, e = ReadExif(bytes.NewReader(testJpeg(tiff[:20])))
+		So(e, ShouldNotBeNil)
+	})
+}
+
+func TestThumbnails(t *testing.T) {
+
+	Convey("Parse thumbnails sizes", t, func() {
+		sizes, e := parseThumbSizes(`{"md":1024,"sm":300}`)
+		So(e, ShouldBeNil)
+		So(sortedSizeIds(sizes), ShouldResemble, []string{"sm", "md"})
+		_, e = parseThumbSizes(`{"sm":0}`)
+		So(e, ShouldNotBeNil)
+		_, e = parseThumbSizes(`{}`)
+		So(e, ShouldNotBeNil)
+		_, e = parseThumbSizes(`300`)
+		So(e, ShouldNotBeNil)
+	})
+
+	Convey("Resize images", t, func() {
+		src := image.NewNRGBA(image.Rect(0, 0, 600, 400))
+		src.Set(0, 0, color.Transparent)
+		thumb := Thumbnail(src, 300)
+		So(thumb.Bounds().Dx(), ShouldEqual, 300)
+		So(thumb.Bounds().Dy(), ShouldEqual, 200)
+		// Smaller images are not enlarged
+		thumb = Thumbnail(src, 1024)
+		So(thumb.Bounds().Dx(), ShouldEqual, 600)
+	})
+
+	Convey("Refuse images too large to be decoded", t, func() {
+		buffer := &bytes.Buffer{}
+		So(png.Encode(buffer, image.NewNRGBA(image.Rect(0, 0, 100, 50))), ShouldBeNil)
+		So(checkImageBounds(buffer.Bytes()), ShouldBeNil)
+		So(checkImageBounds([]byte("not an image")), ShouldNotBeNil)
+
+		defaultPixels := maxThumbPixels
+		maxThumbPixels = 4999
+		defer func() { maxThumbPixels = defaultPixels }()
+		So(checkImageBounds(buffer.Bytes()), ShouldNotBeNil)
+	})
+
+	Convey("Thumbnails sizes are only served if they were generated", t, func() {
+		meta := &ThumbnailsMeta{Thumbnails: []*ThumbnailData{{Id: "sm"}, {Id: "md"}}}
+		So(meta.HasSize("sm"), ShouldBeTrue)
+		So(meta.HasSize("../other"), ShouldBeFalse)
+	})
+
+	Convey("Supported files and thumbnails path", t, func() {
+		So(IsSupported(&tree.Node{Path: "folder/Photo.JPG"}), ShouldBeTrue)
+		So(IsSupported(&tree.Node{Path: "folder/image.webp"}), ShouldBeTrue)
+		So(IsSupported(&tree.Node{Path: "folder/doc.pdf"}), ShouldBeFalse)
+		So(ThumbnailPath("uuid", "sm"), ShouldEqual, "pydio-thumbstore/uuid-sm.jpg")
+	})
+}
@@ -0,0 +1,217 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package images
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/disintegration/imaging"
+	"github.com/micro/go-micro/client"
+	"go.uber.org/zap"
+	"golang.org/x/image/colornames"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/proto/jobs"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/views"
+	"github.com/pmker/yux/scheduler/actions"
+)
+
+var (
+	thumbnailsActionName = "actions.images.thumbnails"
+	defaultThumbSizes    = map[string]int{"sm": 300, "md": 1024}
+	// maxThumbInputSize skips files too large to be loaded in memory for a thumbnail.
+	maxThumbInputSize int64 = 100 * 1024 * 1024
+	// maxThumbPixels skips images whose decoded bitmap would be too large, whatever the size of their file.
+	maxThumbPixels = 100 * 1000 * 1000
+)
+
+func init() {
+	actions.GetActionsManager().Register(thumbnailsActionName, func() actions.ConcreteAction {
+		return &ThumbnailExtractor{}
+	})
+}
+
+// ThumbnailExtractor generates JPEG thumbnails of an image at various sizes and stores them
+// in the thumbnails binary store. The "ThumbSizes" parameter is a JSON map of size ids to widths.
+type ThumbnailExtractor struct {
+	Router      views.Handler
+	ThumbRouter views.Handler
+	thumbSizes  map[string]int
+}
+
+// GetName returns the Unique identifier.
+func (t *ThumbnailExtractor) GetName() string {
+	return thumbnailsActionName
+}
+
+// Init passes the parameters to a newly created ThumbnailExtractor.
+func (t *ThumbnailExtractor) Init(job *jobs.Job, cl client.Client, action *jobs.Action) error {
+	t.thumbSizes = defaultThumbSizes
+	if sizes, ok := action.Parameters["ThumbSizes"]; ok {
+		parsed, e := parseThumbSizes(sizes)
+		if e != nil {
+			return e
+		}
+		t.thumbSizes = parsed
+	}
+	t.Router = views.NewStandardRouter(views.RouterOptions{AdminView: true})
+	t.ThumbRouter = NewThumbsRouter()
+	return nil
+}
+
+// Run processes the actual action code.
+func (t *ThumbnailExtractor) Run(ctx context.Context, channels *actions.RunnableChannels, input jobs.ActionMessage) (jobs.ActionMessage, error) {
+
+	if len(input.Nodes) == 0 || !input.Nodes[0].IsLeaf() || !IsSupported(input.Nodes[0]) {
+		return input.WithIgnore(), nil
+	}
+	ctx = context.WithValue(ctx, common.PYDIO_CONTEXT_USER_KEY, common.PYDIO_SYSTEM_USERNAME)
+
+	resp, e := t.Router.ReadNode(ctx, &tree.ReadNodeRequest{Node: input.Nodes[0]})
+	if e != nil {
+		return input.WithError(e), e
+	}
+	node := resp.Node
+	if node.Size > maxThumbInputSize {
+		log.Logger(ctx).Info("Skipping thumbnails for large file", node.ZapPath(), zap.Int64("size", node.Size))
+		return input.WithIgnore(), nil
+	}
+	reader, e := t.Router.GetObject(ctx, node, &views.GetRequestData{Length: node.Size})
+	if e != nil {
+		return input.WithError(e), e
+	}
+	data, e := ioutil.ReadAll(io.LimitReader(reader, maxThumbInputSize+1))
+	reader.Close()
+	if e != nil {
+		return input.WithError(e), e
+	}
+	if e := checkImageBounds(data); e != nil {
+		log.Logger(ctx).Info("Skipping thumbnails", node.ZapPath(), zap.Error(e))
+		return input.WithIgnore(), nil
+	}
+	src, e := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if e != nil {
+		log.Logger(ctx).Debug("Cannot decode image", node.ZapPath(), zap.Error(e))
+		return input.WithError(e), e
+	}
+
+	thumbsMeta := &ThumbnailsMeta{}
+	for _, id := range sortedSizeIds(t.thumbSizes) {
+		size := t.thumbSizes[id]
+		thumb := Thumbnail(src, size)
+		buffer := &bytes.Buffer{}
+		if e := imaging.Encode(buffer, thumb, imaging.JPEG, imaging.JPEGQuality(85)); e != nil {
+			return input.WithError(e), e
+		}
+		thumbNode := &tree.Node{Path: ThumbnailPath(node.Uuid, id), Type: tree.NodeType_LEAF}
+		if _, e := t.ThumbRouter.PutObject(ctx, thumbNode, buffer, &views.PutRequestData{Size: int64(buffer.Len())}); e != nil {
+			log.Logger(ctx).Error("Cannot store thumbnail", node.ZapPath(), zap.String("size", id), zap.Error(e))
+			return input.WithError(e), e
+		}
+		thumbsMeta.Thumbnails = append(thumbsMeta.Thumbnails, &ThumbnailData{Id: id, Size: thumb.Bounds().Dx(), Format: "jpg"})
+	}
+
+	bounds := src.Bounds()
+	node.SetMeta(MetadataImageDimensions, &ImageDimensions{Width: bounds.Dx(), Height: bounds.Dy()})
+	node.SetMeta(MetadataThumbnails, thumbsMeta)
+	if e := updateMeta(ctx, node); e != nil {
+		return input.WithError(e), e
+	}
+
+	output := input.WithNode(node)
+	output.AppendOutput(&jobs.ActionOutput{
+		Success:    true,
+		StringBody: fmt.Sprintf("Generated %d thumbnail(s) for %s", len(thumbsMeta.Thumbnails), node.Path),
+	})
+	return output, nil
+}
+
+// Thumbnail resizes an image to the given width, or keeps its original width if it is smaller,
+// and flattens transparent areas on a light grey background.
+func Thumbnail(src image.Image, width int) image.Image {
+	if src.Bounds().Dx() > width {
+		src = imaging.Resize(src, width, 0, imaging.Lanczos)
+	}
+	bg := imaging.New(src.Bounds().Dx(), src.Bounds().Dy(), colornames.Lightgrey)
+	return imaging.Overlay(bg, src, image.Pt(0, 0), 1.0)
+}
+
+// checkImageBounds reads the image header to refuse files that would be too expensive to decode.
+func checkImageBounds(data []byte) error {
+	if int64(len(data)) > maxThumbInputSize {
+		return fmt.Errorf("file is larger than %d bytes", maxThumbInputSize)
+	}
+	cfg, _, e := image.DecodeConfig(bytes.NewReader(data))
+	if e != nil {
+		return e
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > maxThumbPixels/cfg.Height {
+		return fmt.Errorf("image dimensions %dx%d exceed %d pixels", cfg.Width, cfg.Height, maxThumbPixels)
+	}
+	return nil
+}
+
+func parseThumbSizes(value string) (map[string]int, error) {
+	sizes := make(map[string]int)
+	if e := json.Unmarshal([]byte(value), &sizes); e != nil {
+		return nil, fmt.Errorf("invalid ThumbSizes parameter %s", value)
+	}
+	for id, size := range sizes {
+		if size <= 0 {
+			return nil, fmt.Errorf("invalid width %d for thumbnail size %s", size, id)
+		}
+	}
+	if len(sizes) == 0 {
+		return nil, fmt.Errorf("ThumbSizes parameter should declare at least one size")
+	}
+	return sizes, nil
+}
+
+func sortedSizeIds(sizes map[string]int) []string {
+	var ids []string
+	for id := range sizes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if sizes[ids[i]] == sizes[ids[j]] {
+			return ids[i] < ids[j]
+		}
+		return sizes[ids[i]] < sizes[ids[j]]
+	})
+	return ids
+}
+
+// updateMeta stores the node metadata and lets the meta service broadcast the change to the search engine.
+func updateMeta(ctx context.Context, node *tree.Node) error {
+	cli := tree.NewNodeReceiverClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_META, defaults.NewClient())
+	_, e := cli.UpdateNode(ctx, &tree.UpdateNodeRequest{From: node, To: node})
+	return e
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package actions
+
+import (
+	"sync"
+)
+
+// Concrete is a generator for a ConcreteAction.
+type Concrete func() ConcreteAction
+
+// ActionsManager stores all the actions registered by the services.
+type ActionsManager struct {
+	sync.RWMutex
+	registeredActions map[string]Concrete
+}
+
+var (
+	defaultManager *ActionsManager
+	managerOnce    sync.Once
+)
+
+// GetActionsManager returns the singleton ActionsManager.
+func GetActionsManager() *ActionsManager {
+	managerOnce.Do(func() {
+		defaultManager = &ActionsManager{
+			registeredActions: make(map[string]Concrete),
+		}
+	})
+	return defaultManager
+}
+
+// Register declares a new action generator under the given name.
+func (m *ActionsManager) Register(name string, a Concrete) {
+	m.Lock()
+	defer m.Unlock()
+	m.registeredActions[name] = a
+}
+
+// ActionById returns a newly created instance of the action registered under this id.
+func (m *ActionsManager) ActionById(actionId string) (ConcreteAction, bool) {
+	m.RLock()
+	defer m.RUnlock()
+	generator, ok := m.registeredActions[actionId]
+	if !ok {
+		return nil, false
+	}
+	return generator(), true
+}
+
+// DefinedActions lists the names of all registered actions.
+func (m *ActionsManager) DefinedActions() []string {
+	m.RLock()
+	defer m.RUnlock()
+	var names []string
+	for name := range m.registeredActions {
+		names = append(names, name)
+	}
+	return names
+}
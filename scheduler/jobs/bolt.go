@@ -0,0 +1,235 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package jobs
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/golang/protobuf/proto"
+	"github.com/micro/go-micro/errors"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/boltdb"
+	"github.com/pmker/yux/common/proto/jobs"
+)
+
+var (
+	jobsBucketKey  = []byte("jobs")
+	tasksBucketKey = []byte("tasks")
+)
+
+type boltdbimpl struct {
+	boltdb.DAO
+}
+
+// Init creates the main buckets if they do not exist yet
+func (b *boltdbimpl) Init(options common.ConfigValues) error {
+
+	return b.DB().Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(jobsBucketKey); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(tasksBucketKey)
+		return err
+	})
+
+}
+
+// PutJob stores the job without its tasks
+func (b *boltdbimpl) PutJob(job *jobs.Job) error {
+
+	return b.DB().Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(jobsBucketKey)
+		j := proto.Clone(job).(*jobs.Job)
+		j.Tasks = nil
+		data, err := proto.Marshal(j)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(job.ID), data)
+	})
+
+}
+
+// GetJob loads a job and optionally its tasks
+func (b *boltdbimpl) GetJob(jobId string, withTasks jobs.TaskStatus) (*jobs.Job, error) {
+
+	j := &jobs.Job{}
+	e := b.DB().View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(jobsBucketKey).Get([]byte(jobId))
+		if data == nil {
+			return errors.NotFound(common.SERVICE_JOBS, "Job %s not found", jobId)
+		}
+		if err := proto.Unmarshal(data, j); err != nil {
+			return err
+		}
+		if withTasks != jobs.TaskStatus_Unknown {
+			j.Tasks = b.tasksForJob(tx, jobId, withTasks)
+		}
+		return nil
+	})
+	if e != nil {
+		return nil, e
+	}
+	return j, nil
+
+}
+
+// DeleteJob removes the job and its tasks bucket
+func (b *boltdbimpl) DeleteJob(jobId string) error {
+
+	return b.DB().Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(jobsBucketKey).Delete([]byte(jobId)); err != nil {
+			return err
+		}
+		tasks := tx.Bucket(tasksBucketKey)
+		if tasks.Bucket([]byte(jobId)) != nil {
+			return tasks.DeleteBucket([]byte(jobId))
+		}
+		return nil
+	})
+
+}
+
+// ListJobs streams all jobs matching the filters
+func (b *boltdbimpl) ListJobs(owner string, eventsOnly bool, timersOnly bool, withTasks jobs.TaskStatus, jobIDs ...string) (chan *jobs.Job, chan bool, error) {
+
+	var results []*jobs.Job
+	e := b.DB().View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(jobsBucketKey).Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			j := &jobs.Job{}
+			if err := proto.Unmarshal(v, j); err != nil {
+				continue
+			}
+			if !matchJobFilters(j, owner, eventsOnly, timersOnly, jobIDs) {
+				continue
+			}
+			if withTasks != jobs.TaskStatus_Unknown {
+				j.Tasks = b.tasksForJob(tx, j.ID, withTasks)
+			}
+			results = append(results, j)
+		}
+		return nil
+	})
+	if e != nil {
+		return nil, nil, e
+	}
+
+	res := make(chan *jobs.Job)
+	done := make(chan bool, 1)
+	go func() {
+		for _, j := range results {
+			res <- j
+		}
+		done <- true
+		close(done)
+	}()
+	return res, done, nil
+
+}
+
+// PutTask stores a task inside its job sub-bucket
+func (b *boltdbimpl) PutTask(task *jobs.Task) error {
+
+	return b.DB().Update(func(tx *bolt.Tx) error {
+		jobBucket, err := tx.Bucket(tasksBucketKey).CreateBucketIfNotExists([]byte(task.JobID))
+		if err != nil {
+			return err
+		}
+		data, err := proto.Marshal(task)
+		if err != nil {
+			return err
+		}
+		return jobBucket.Put([]byte(task.ID), data)
+	})
+
+}
+
+// ListTasks streams the tasks of one or all jobs
+func (b *boltdbimpl) ListTasks(jobId string, taskStatus jobs.TaskStatus) (chan *jobs.Task, chan bool, error) {
+
+	var results []*jobs.Task
+	e := b.DB().View(func(tx *bolt.Tx) error {
+		if jobId != "" {
+			results = b.tasksForJob(tx, jobId, taskStatus)
+			return nil
+		}
+		c := tx.Bucket(tasksBucketKey).Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			results = append(results, b.tasksForJob(tx, string(k), taskStatus)...)
+		}
+		return nil
+	})
+	if e != nil {
+		return nil, nil, e
+	}
+
+	res := make(chan *jobs.Task)
+	done := make(chan bool, 1)
+	go func() {
+		for _, t := range results {
+			res <- t
+		}
+		done <- true
+		close(done)
+	}()
+	return res, done, nil
+
+}
+
+// DeleteTasks removes a set of tasks from the job sub-bucket
+func (b *boltdbimpl) DeleteTasks(jobId string, taskId []string) error {
+
+	return b.DB().Update(func(tx *bolt.Tx) error {
+		jobBucket := tx.Bucket(tasksBucketKey).Bucket([]byte(jobId))
+		if jobBucket == nil {
+			return nil
+		}
+		for _, id := range taskId {
+			if err := jobBucket.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+}
+
+func (b *boltdbimpl) tasksForJob(tx *bolt.Tx, jobId string, status jobs.TaskStatus) []*jobs.Task {
+
+	var tasks []*jobs.Task
+	jobBucket := tx.Bucket(tasksBucketKey).Bucket([]byte(jobId))
+	if jobBucket == nil {
+		return tasks
+	}
+	c := jobBucket.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		t := &jobs.Task{}
+		if err := proto.Unmarshal(v, t); err != nil {
+			continue
+		}
+		if matchTaskStatus(t, status) {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+// Package jobs provides the persistence layer for jobs and tasks definitions of the scheduler.
+//
+// Jobs and tasks can be stored either in a BoltDB file or in a SQL database.
+package jobs
+
+import (
+	"github.com/pmker/yux/common/boltdb"
+	"github.com/pmker/yux/common/dao"
+	"github.com/pmker/yux/common/proto/jobs"
+	"github.com/pmker/yux/common/sql"
+)
+
+// DAO defines the persistence functions for jobs and their tasks.
+type DAO interface {
+	dao.DAO
+
+	// PutJob creates or updates a job definition
+	PutJob(job *jobs.Job) error
+	// GetJob loads a job. If withTasks is not TaskStatus_Unknown, matching tasks are loaded as well
+	GetJob(jobId string, withTasks jobs.TaskStatus) (*jobs.Job, error)
+	// DeleteJob removes a job and all its tasks
+	DeleteJob(jobId string) error
+	// ListJobs streams the jobs definitions, optionally filtered
+	ListJobs(owner string, eventsOnly bool, timersOnly bool, withTasks jobs.TaskStatus, jobIDs ...string) (chan *jobs.Job, chan bool, error)
+
+	// PutTask creates or updates a task for a given job
+	PutTask(task *jobs.Task) error
+	// ListTasks streams the tasks of a job (or of all jobs if jobId is empty), filtered by status
+	ListTasks(jobId string, taskStatus jobs.TaskStatus) (chan *jobs.Task, chan bool, error)
+	// DeleteTasks removes a set of tasks for a given job
+	DeleteTasks(jobId string, taskId []string) error
+}
+
+// NewDAO wraps a generic DAO into a jobs.DAO implementation.
+func NewDAO(o dao.DAO) dao.DAO {
+	switch v := o.(type) {
+	case boltdb.DAO:
+		return &boltdbimpl{DAO: v}
+	case sql.DAO:
+		return &sqlimpl{DAO: v}
+	}
+	return nil
+}
+
+// matchJobFilters checks a job against the ListJobs criteria.
+func matchJobFilters(job *jobs.Job, owner string, eventsOnly bool, timersOnly bool, jobIDs []string) bool {
+	if owner != "" && job.Owner != owner {
+		return false
+	}
+	if eventsOnly && len(job.EventNames) == 0 {
+		return false
+	}
+	if timersOnly && job.Schedule == nil {
+		return false
+	}
+	if len(jobIDs) > 0 {
+		found := false
+		for _, id := range jobIDs {
+			if id == job.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// matchTaskStatus checks if a task corresponds to the given status filter.
+func matchTaskStatus(task *jobs.Task, status jobs.TaskStatus) bool {
+	return status == jobs.TaskStatus_Any || task.Status == status
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package jobs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	// Perform test against SQLite
+	_ "github.com/mattn/go-sqlite3"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/boltdb"
+	"github.com/pmker/yux/common/config"
+	"github.com/pmker/yux/common/proto/jobs"
+	"github.com/pmker/yux/common/sql"
+)
+
+func testDAOs(t *testing.T) (map[string]DAO, func()) {
+
+	tmpDir, _ := ioutil.TempDir("", "jobs-dao")
+	var options config.Map
+
+	bDao := NewDAO(boltdb.NewDAO("boltdb", filepath.Join(tmpDir, "jobs.db"), "")).(DAO)
+	if e := bDao.Init(options); e != nil {
+		t.Fatal(e)
+	}
+	sDao := NewDAO(sql.NewDAO("sqlite3", "file::memory:?mode=memory&cache=shared", "")).(DAO)
+	if e := sDao.Init(options); e != nil {
+		t.Fatal(e)
+	}
+
+	return map[string]DAO{"bolt": bDao, "sql": sDao}, func() {
+		os.RemoveAll(tmpDir)
+	}
+}
+
+func collectJobs(res chan *jobs.Job, done chan bool) (list []*jobs.Job) {
+	for {
+		select {
+		case j := <-res:
+			list = append(list, j)
+		case <-done:
+			return
+		}
+	}
+}
+
+func collectTasks(res chan *jobs.Task, done chan bool) (list []*jobs.Task) {
+	for {
+		select {
+		case t := <-res:
+			list = append(list, t)
+		case <-done:
+			return
+		}
+	}
+}
+
+func TestDAO_Jobs(t *testing.T) {
+
+	daos, closer := testDAOs(t)
+	defer closer()
+
+	for name, dao := range daos {
+
+		Convey(fmt.Sprintf("Test Jobs CRUD (%s)", name), t, func() {
+
+			e := dao.PutJob(&jobs.Job{ID: "timer-job", Owner: "admin", Schedule: &jobs.Schedule{Iso8601Schedule: "R/2012-06-04T19:25:16.828696-07:00/PT5M"}})
+			So(e, ShouldBeNil)
+			e = dao.PutJob(&jobs.Job{ID: "event-job", Owner: "user", EventNames: []string{jobs.NodeChangeEventName(0)}})
+			So(e, ShouldBeNil)
+			e = dao.PutJob(&jobs.Job{ID: "event-job", Owner: "user", Label: "Updated", EventNames: []string{jobs.NodeChangeEventName(0)}})
+			So(e, ShouldBeNil)
+
+			j, e := dao.GetJob("event-job", jobs.TaskStatus_Unknown)
+			So(e, ShouldBeNil)
+			So(j.Label, ShouldEqual, "Updated")
+
+			_, e = dao.GetJob("unknown-job", jobs.TaskStatus_Unknown)
+			So(e, ShouldNotBeNil)
+
+			res, done, e := dao.ListJobs("", false, false, jobs.TaskStatus_Unknown)
+			So(e, ShouldBeNil)
+			So(collectJobs(res, done), ShouldHaveLength, 2)
+
+			res, done, e = dao.ListJobs("", true, false, jobs.TaskStatus_Unknown)
+			So(e, ShouldBeNil)
+			list := collectJobs(res, done)
+			So(list, ShouldHaveLength, 1)
+			So(list[0].ID, ShouldEqual, "event-job")
+
+			res, done, e = dao.ListJobs("", false, true, jobs.TaskStatus_Unknown)
+			So(e, ShouldBeNil)
+			list = collectJobs(res, done)
+			So(list, ShouldHaveLength, 1)
+			So(list[0].ID, ShouldEqual, "timer-job")
+
+			res, done, e = dao.ListJobs("admin", false, false, jobs.TaskStatus_Unknown)
+			So(e, ShouldBeNil)
+			So(collectJobs(res, done), ShouldHaveLength, 1)
+
+			So(dao.DeleteJob("timer-job"), ShouldBeNil)
+			So(dao.DeleteJob("event-job"), ShouldBeNil)
+			res, done, e = dao.ListJobs("", false, false, jobs.TaskStatus_Unknown)
+			So(e, ShouldBeNil)
+			So(collectJobs(res, done), ShouldHaveLength, 0)
+
+		})
+
+	}
+}
+
+func TestDAO_Tasks(t *testing.T) {
+
+	daos, closer := testDAOs(t)
+	defer closer()
+
+	for name, dao := range daos {
+
+		Convey(fmt.Sprintf("Test Tasks CRUD (%s)", name), t, func() {
+
+			So(dao.PutJob(&jobs.Job{ID: "job-with-tasks", Owner: "admin"}), ShouldBeNil)
+			So(dao.PutTask(&jobs.Task{ID: "task1", JobID: "job-with-tasks", Status: jobs.TaskStatus_Finished}), ShouldBeNil)
+			So(dao.PutTask(&jobs.Task{ID: "task2", JobID: "job-with-tasks", Status: jobs.TaskStatus_Running}), ShouldBeNil)
+			So(dao.PutTask(&jobs.Task{ID: "task2", JobID: "job-with-tasks", Status: jobs.TaskStatus_Error}), ShouldBeNil)
+
+			res, done, e := dao.ListTasks("job-with-tasks", jobs.TaskStatus_Any)
+			So(e, ShouldBeNil)
+			So(collectTasks(res, done), ShouldHaveLength, 2)
+
+			res, done, e = dao.ListTasks("", jobs.TaskStatus_Error)
+			So(e, ShouldBeNil)
+			list := collectTasks(res, done)
+			So(list, ShouldHaveLength, 1)
+			So(list[0].ID, ShouldEqual, "task2")
+
+			j, e := dao.GetJob("job-with-tasks", jobs.TaskStatus_Finished)
+			So(e, ShouldBeNil)
+			So(j.Tasks, ShouldHaveLength, 1)
+
+			So(dao.DeleteTasks("job-with-tasks", []string{"task1"}), ShouldBeNil)
+			res, done, e = dao.ListTasks("job-with-tasks", jobs.TaskStatus_Any)
+			So(e, ShouldBeNil)
+			So(collectTasks(res, done), ShouldHaveLength, 1)
+
+			So(dao.DeleteJob("job-with-tasks"), ShouldBeNil)
+			res, done, e = dao.ListTasks("job-with-tasks", jobs.TaskStatus_Any)
+			So(e, ShouldBeNil)
+			So(collectTasks(res, done), ShouldHaveLength, 0)
+
+		})
+
+	}
+}
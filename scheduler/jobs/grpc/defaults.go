@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package grpc
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/micro/protobuf/ptypes"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/log"
+	proto "github.com/pmker/yux/common/proto/jobs"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/common/service/context"
+	"github.com/pmker/yux/common/service/proto"
+	"github.com/pmker/yux/scheduler/jobs"
+)
+
+// InsertDefaultJobs stores the jobs shipped by default, at first run.
+func InsertDefaultJobs(ctx context.Context) error {
+
+	dao := servicecontext.GetDAO(ctx).(jobs.DAO)
+	for _, job := range getDefaultJobs() {
+		log.Logger(ctx).Info("Inserting default job", job.ZapId())
+		if e := dao.PutJob(job); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func getDefaultJobs() []*proto.Job {
+
+	imagesQuery, _ := ptypes.MarshalAny(&tree.Query{
+		Type:      tree.NodeType_LEAF,
+		Extension: "jpg,jpeg,png,gif,webp,bmp,tif,tiff",
+	})
+	imagesFilter := &proto.NodesSelector{
+		Query: &service.Query{
+			SubQueries: []*any.Any{imagesQuery},
+		},
+	}
+	thumbSizes := `{"sm":300,"md":1024}`
+
+	return []*proto.Job{
+		{
+			ID:                "thumbs-job",
+			Owner:             common.PYDIO_SYSTEM_USERNAME,
+			Label:             "Generate images thumbnails and extract exif data",
+			MaxConcurrency:    5,
+			TasksSilentUpdate: true,
+			EventNames: []string{
+				proto.NodeChangeEventName(tree.NodeChangeEvent_CREATE),
+				proto.NodeChangeEventName(tree.NodeChangeEvent_UPDATE_CONTENT),
+			},
+			Actions: []*proto.Action{
+				{
+					ID:          "actions.images.thumbnails",
+					NodesFilter: imagesFilter,
+					Parameters: map[string]string{
+						"ThumbSizes": thumbSizes,
+					},
+					ChainedActions: []*proto.Action{{
+						ID: "actions.images.exif",
+					}},
+				},
+			},
+		},
+		{
+			ID:                "clean-thumbs-job",
+			Owner:             common.PYDIO_SYSTEM_USERNAME,
+			Label:             "Remove the thumbnails of deleted images",
+			MaxConcurrency:    5,
+			TasksSilentUpdate: true,
+			EventNames: []string{
+				proto.NodeChangeEventName(tree.NodeChangeEvent_DELETE),
+			},
+			Actions: []*proto.Action{
+				{
+					ID:          "actions.images.clean",
+					NodesFilter: imagesFilter,
+					Parameters: map[string]string{
+						"ThumbSizes": thumbSizes,
+					},
+				},
+			},
+		},
+	}
+
+}
@@ -0,0 +1,368 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/micro/go-micro/client"
+	"github.com/micro/go-micro/errors"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/log"
+	proto "github.com/pmker/yux/common/proto/jobs"
+	"github.com/pmker/yux/common/service/context"
+	"github.com/pmker/yux/scheduler/jobs"
+)
+
+var (
+	// Tasks running for more than this delay are considered stuck if no Since value is passed.
+	defaultStuckDelay = int32(6 * 60 * 60)
+)
+
+// JobsHandler implements the JobService GRPC API
+type JobsHandler struct{}
+
+// PutJob creates or updates a job and broadcasts the change
+func (j *JobsHandler) PutJob(ctx context.Context, request *proto.PutJobRequest, response *proto.PutJobResponse) error {
+
+	if request.Job == nil || request.Job.ID == "" {
+		return errors.BadRequest(common.SERVICE_JOBS, "please provide a job with an ID")
+	}
+	dao := servicecontext.GetDAO(ctx).(jobs.DAO)
+	if err := dao.PutJob(request.Job); err != nil {
+		return err
+	}
+	response.Job = request.Job
+	log.Logger(ctx).Debug("Job stored", request.Job.ZapId())
+
+	client.Publish(ctx, client.NewPublication(common.TOPIC_JOB_CONFIG_EVENT, &proto.JobChangeEvent{
+		JobUpdated: request.Job,
+	}))
+	return nil
+}
+
+// GetJob loads a job, optionally with its tasks
+func (j *JobsHandler) GetJob(ctx context.Context, request *proto.GetJobRequest, response *proto.GetJobResponse) error {
+
+	dao := servicecontext.GetDAO(ctx).(jobs.DAO)
+	job, err := dao.GetJob(request.JobID, request.LoadTasks)
+	if err != nil {
+		return err
+	}
+	response.Job = job
+	return nil
+}
+
+// DeleteJob removes a job, or all finished jobs flagged as AutoClean if CleanableJobs is set
+func (j *JobsHandler) DeleteJob(ctx context.Context, request *proto.DeleteJobRequest, response *proto.DeleteJobResponse) error {
+
+	dao := servicecontext.GetDAO(ctx).(jobs.DAO)
+
+	var ids []string
+	if request.CleanableJobs {
+		res, done, err := dao.ListJobs("", false, false, proto.TaskStatus_Any)
+		if err != nil {
+			return err
+		}
+	loop:
+		for {
+			select {
+			case job := <-res:
+				if job.AutoClean && len(job.Tasks) > 0 && allTasksFinished(job.Tasks) {
+					ids = append(ids, job.ID)
+				}
+			case <-done:
+				break loop
+			}
+		}
+	} else if request.JobID != "" {
+		ids = append(ids, request.JobID)
+	} else {
+		return errors.BadRequest(common.SERVICE_JOBS, "please provide a JobID or set CleanableJobs")
+	}
+
+	for _, id := range ids {
+		if err := dao.DeleteJob(id); err != nil {
+			return err
+		}
+		response.DeleteCount++
+		client.Publish(ctx, client.NewPublication(common.TOPIC_JOB_CONFIG_EVENT, &proto.JobChangeEvent{
+			JobRemoved: id,
+		}))
+	}
+	response.Success = true
+	return nil
+}
+
+// ListJobs streams jobs definitions
+func (j *JobsHandler) ListJobs(ctx context.Context, request *proto.ListJobsRequest, streamer proto.JobService_ListJobsStream) error {
+
+	defer streamer.Close()
+	dao := servicecontext.GetDAO(ctx).(jobs.DAO)
+	res, done, err := dao.ListJobs(request.Owner, request.EventsOnly, request.TimersOnly, request.LoadTasks)
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case job := <-res:
+			if e := streamer.Send(&proto.ListJobsResponse{Job: job}); e != nil {
+				go drainJobs(res, done)
+				return e
+			}
+		case <-done:
+			return nil
+		}
+	}
+}
+
+// PutTask stores a task and broadcasts the change
+func (j *JobsHandler) PutTask(ctx context.Context, request *proto.PutTaskRequest, response *proto.PutTaskResponse) error {
+
+	if request.Task == nil {
+		return errors.BadRequest(common.SERVICE_JOBS, "please provide a task")
+	}
+	dao := servicecontext.GetDAO(ctx).(jobs.DAO)
+	if err := j.storeTask(ctx, dao, request.Task); err != nil {
+		return err
+	}
+	response.Task = request.Task
+	return nil
+}
+
+// PutTaskStream stores tasks received through a stream
+func (j *JobsHandler) PutTaskStream(ctx context.Context, streamer proto.JobService_PutTaskStreamStream) error {
+
+	defer streamer.Close()
+	dao := servicecontext.GetDAO(ctx).(jobs.DAO)
+	for {
+		request, err := streamer.Recv()
+		if request == nil || err != nil {
+			return nil
+		}
+		if e := j.storeTask(ctx, dao, request.Task); e != nil {
+			log.Logger(ctx).Error("cannot store task", zap.Error(e))
+			continue
+		}
+		if e := streamer.Send(&proto.PutTaskResponse{Task: request.Task}); e != nil {
+			return e
+		}
+	}
+}
+
+// ListTasks streams tasks, for one job or all jobs
+func (j *JobsHandler) ListTasks(ctx context.Context, request *proto.ListTasksRequest, streamer proto.JobService_ListTasksStream) error {
+
+	defer streamer.Close()
+	dao := servicecontext.GetDAO(ctx).(jobs.DAO)
+	status := request.Status
+	if status == proto.TaskStatus_Unknown {
+		status = proto.TaskStatus_Any
+	}
+	res, done, err := dao.ListTasks(request.JobID, status)
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case task := <-res:
+			if e := streamer.Send(&proto.ListTasksResponse{Task: task}); e != nil {
+				go drainTasks(res, done)
+				return e
+			}
+		case <-done:
+			return nil
+		}
+	}
+}
+
+// DeleteTasks removes a set of tasks. If no TaskID is passed, tasks of the job matching the Status
+// filters are pruned, keeping only the PruneLimit most recent ones.
+func (j *JobsHandler) DeleteTasks(ctx context.Context, request *proto.DeleteTasksRequest, response *proto.DeleteTasksResponse) error {
+
+	if request.JobId == "" {
+		return errors.BadRequest(common.SERVICE_JOBS, "please provide a JobId")
+	}
+	dao := servicecontext.GetDAO(ctx).(jobs.DAO)
+
+	if len(request.TaskID) > 0 {
+		if err := dao.DeleteTasks(request.JobId, request.TaskID); err != nil {
+			return err
+		}
+		response.Deleted = request.TaskID
+		return nil
+	}
+
+	res, done, err := dao.ListTasks(request.JobId, proto.TaskStatus_Any)
+	if err != nil {
+		return err
+	}
+	var candidates []*proto.Task
+loop:
+	for {
+		select {
+		case task := <-res:
+			if matchStatuses(task, request.Status) {
+				candidates = append(candidates, task)
+			}
+		case <-done:
+			break loop
+		}
+	}
+	// Most recent first
+	sort.Slice(candidates, func(i, k int) bool {
+		return candidates[i].StartTime > candidates[k].StartTime
+	})
+	if limit := int(request.PruneLimit); limit > 0 {
+		if len(candidates) <= limit {
+			return nil
+		}
+		candidates = candidates[limit:]
+	}
+	var ids []string
+	for _, t := range candidates {
+		ids = append(ids, t.ID)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := dao.DeleteTasks(request.JobId, ids); err != nil {
+		return err
+	}
+	response.Deleted = ids
+	return nil
+}
+
+// DetectStuckTasks finds tasks that are still flagged as Running or Queued although they were started more
+// than request.Since seconds ago, and mark them as Interrupted. If Since is not set, a default delay is used.
+func (j *JobsHandler) DetectStuckTasks(ctx context.Context, request *proto.DetectStuckTasksRequest, response *proto.DetectStuckTasksResponse) error {
+
+	dao := servicecontext.GetDAO(ctx).(jobs.DAO)
+	since := request.Since
+	if since <= 0 {
+		since = defaultStuckDelay
+	}
+	now := int32(time.Now().Unix())
+	limit := now - since
+
+	var stuck []*proto.Task
+	for _, status := range []proto.TaskStatus{proto.TaskStatus_Running, proto.TaskStatus_Queued} {
+		res, done, err := dao.ListTasks("", status)
+		if err != nil {
+			return err
+		}
+	loop:
+		for {
+			select {
+			case task := <-res:
+				if task.StartTime <= limit {
+					stuck = append(stuck, task)
+				}
+			case <-done:
+				break loop
+			}
+		}
+	}
+
+	for _, task := range stuck {
+		task.Status = proto.TaskStatus_Interrupted
+		task.StatusMessage = fmt.Sprintf("Task was interrupted (no activity detected for %v)", time.Duration(now-task.StartTime)*time.Second)
+		task.EndTime = now
+		if err := j.storeTask(ctx, dao, task); err != nil {
+			return err
+		}
+		log.Logger(ctx).Info("Fixed stuck task", task.ZapId(), zap.String(common.KEY_JOB_ID, task.JobID))
+		response.FixedTaskIds = append(response.FixedTaskIds, task.ID)
+	}
+	return nil
+}
+
+func (j *JobsHandler) storeTask(ctx context.Context, dao jobs.DAO, task *proto.Task) error {
+
+	if task.JobID == "" || task.ID == "" {
+		return errors.BadRequest(common.SERVICE_JOBS, "task must have an ID and a JobID")
+	}
+	if err := dao.PutTask(task); err != nil {
+		return err
+	}
+	job, err := dao.GetJob(task.JobID, proto.TaskStatus_Unknown)
+	if err != nil {
+		// Job may have been removed in the meantime
+		return nil
+	}
+	if !job.TasksSilentUpdate {
+		client.Publish(ctx, client.NewPublication(common.TOPIC_JOB_TASK_EVENT, &proto.TaskChangeEvent{
+			TaskUpdated: task,
+			Job:         job,
+		}))
+	}
+	return nil
+}
+
+func allTasksFinished(tasks []*proto.Task) bool {
+	for _, t := range tasks {
+		if t.Status != proto.TaskStatus_Finished {
+			return false
+		}
+	}
+	return true
+}
+
+func matchStatuses(task *proto.Task, statuses []proto.TaskStatus) bool {
+	if len(statuses) == 0 {
+		return true
+	}
+	for _, s := range statuses {
+		if s == proto.TaskStatus_Any || s == task.Status {
+			return true
+		}
+	}
+	return false
+}
+
+// drainJobs consumes the remaining results of a DAO listing, so that its goroutine can terminate
+// when the stream was interrupted.
+func drainJobs(res chan *proto.Job, done chan bool) {
+	for {
+		select {
+		case <-res:
+		case <-done:
+			return
+		}
+	}
+}
+
+// drainTasks consumes the remaining results of a DAO listing, so that its goroutine can terminate
+// when the stream was interrupted.
+func drainTasks(res chan *proto.Task, done chan bool) {
+	for {
+		select {
+		case <-res:
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+// Package grpc provides a GRPC service for storing jobs and tasks definitions.
+package grpc
+
+import (
+	"github.com/micro/go-micro"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/plugins"
+	proto "github.com/pmker/yux/common/proto/jobs"
+	"github.com/pmker/yux/common/service"
+	"github.com/pmker/yux/scheduler/jobs"
+)
+
+func init() {
+	plugins.Register(func() {
+		service.NewService(
+			service.Name(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_JOBS),
+			service.Tag(common.SERVICE_TAG_SCHEDULER),
+			service.Description("Store for scheduler jobs description"),
+			service.Unique(true),
+			service.WithStorage(jobs.NewDAO, "scheduler_jobs"),
+			service.Migrations([]*service.Migration{{
+				TargetVersion: service.FirstRun(),
+				Up:            InsertDefaultJobs,
+			}}),
+			service.WithMicro(func(m micro.Service) error {
+				proto.RegisterJobServiceHandler(m.Options().Server, new(JobsHandler))
+				return nil
+			}),
+		)
+	})
+}
@@ -0,0 +1,25 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS scheduler_jobs (
+    job_id VARCHAR(255) NOT NULL,
+    owner VARCHAR(255) NOT NULL,
+    is_event TINYINT(1) NOT NULL DEFAULT 0,
+    is_timer TINYINT(1) NOT NULL DEFAULT 0,
+    job_data BLOB,
+    PRIMARY KEY (job_id),
+    INDEX (owner)
+);
+
+CREATE TABLE IF NOT EXISTS scheduler_tasks (
+    job_id VARCHAR(255) NOT NULL,
+    task_id VARCHAR(255) NOT NULL,
+    status INT NOT NULL,
+    start_time INT,
+    end_time INT,
+    task_data LONGBLOB,
+    PRIMARY KEY (job_id, task_id),
+    INDEX (status)
+);
+
+-- +migrate Down
+DROP TABLE scheduler_tasks;
+DROP TABLE scheduler_jobs;
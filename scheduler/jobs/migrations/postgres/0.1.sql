@@ -0,0 +1,25 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS scheduler_jobs (
+    job_id VARCHAR(255) NOT NULL,
+    owner VARCHAR(255) NOT NULL,
+    is_event SMALLINT NOT NULL DEFAULT 0,
+    is_timer SMALLINT NOT NULL DEFAULT 0,
+    job_data BYTEA,
+    PRIMARY KEY (job_id)
+);
+CREATE INDEX IF NOT EXISTS scheduler_jobs_owner_idx ON scheduler_jobs (owner);
+
+CREATE TABLE IF NOT EXISTS scheduler_tasks (
+    job_id VARCHAR(255) NOT NULL,
+    task_id VARCHAR(255) NOT NULL,
+    status INTEGER NOT NULL,
+    start_time INTEGER,
+    end_time INTEGER,
+    task_data BYTEA,
+    PRIMARY KEY (job_id, task_id)
+);
+CREATE INDEX IF NOT EXISTS scheduler_tasks_status_idx ON scheduler_tasks (status);
+
+-- +migrate Down
+DROP TABLE scheduler_tasks;
+DROP TABLE scheduler_jobs;
@@ -0,0 +1,26 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS scheduler_jobs (
+    job_id VARCHAR(255) NOT NULL PRIMARY KEY,
+    owner VARCHAR(255) NOT NULL,
+    is_event INT NOT NULL DEFAULT 0,
+    is_timer INT NOT NULL DEFAULT 0,
+    job_data BLOB
+);
+
+CREATE INDEX scheduler_jobs_owner ON scheduler_jobs (owner);
+
+CREATE TABLE IF NOT EXISTS scheduler_tasks (
+    job_id VARCHAR(255) NOT NULL,
+    task_id VARCHAR(255) NOT NULL,
+    status INT NOT NULL,
+    start_time INT,
+    end_time INT,
+    task_data BLOB,
+    PRIMARY KEY (job_id, task_id)
+);
+
+CREATE INDEX scheduler_tasks_status ON scheduler_tasks (status);
+
+-- +migrate Down
+DROP TABLE scheduler_tasks;
+DROP TABLE scheduler_jobs;
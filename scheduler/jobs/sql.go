@@ -0,0 +1,328 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package jobs
+
+import (
+	"fmt"
+
+	"github.com/gobuffalo/packr"
+	"github.com/golang/protobuf/proto"
+	"github.com/micro/go-micro/errors"
+	migrate "github.com/rubenv/sql-migrate"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/proto/jobs"
+	"github.com/pmker/yux/common/sql"
+)
+
+var (
+	queries = map[string]string{
+		"insertJob":            `INSERT INTO scheduler_jobs (job_id, owner, is_event, is_timer, job_data) VALUES (?,?,?,?,?);`,
+		"updateJob":            `UPDATE scheduler_jobs SET owner=?, is_event=?, is_timer=?, job_data=? WHERE job_id=?;`,
+		"getJob":               `SELECT job_data FROM scheduler_jobs WHERE job_id=?;`,
+		"listJobs":             `SELECT job_data FROM scheduler_jobs;`,
+		"deleteJob":            `DELETE FROM scheduler_jobs WHERE job_id=?;`,
+		"deleteJobTasks":       `DELETE FROM scheduler_tasks WHERE job_id=?;`,
+		"insertTask":           `INSERT INTO scheduler_tasks (job_id, task_id, status, start_time, end_time, task_data) VALUES (?,?,?,?,?,?);`,
+		"updateTask":           `UPDATE scheduler_tasks SET status=?, start_time=?, end_time=?, task_data=? WHERE job_id=? AND task_id=?;`,
+		"listTasks":            `SELECT task_data FROM scheduler_tasks ORDER BY start_time;`,
+		"listTasksByStatus":    `SELECT task_data FROM scheduler_tasks WHERE status=? ORDER BY start_time;`,
+		"listJobTasks":         `SELECT task_data FROM scheduler_tasks WHERE job_id=? ORDER BY start_time;`,
+		"listJobTasksByStatus": `SELECT task_data FROM scheduler_tasks WHERE job_id=? AND status=? ORDER BY start_time;`,
+		"deleteTask":           `DELETE FROM scheduler_tasks WHERE job_id=? AND task_id=?;`,
+	}
+)
+
+type sqlimpl struct {
+	sql.DAO
+}
+
+// Init handler for the SQL DAO
+func (s *sqlimpl) Init(options common.ConfigValues) error {
+
+	// super
+	s.DAO.Init(options)
+
+	// Doing the database migrations
+	migrations := &sql.PackrMigrationSource{
+		Box:         packr.NewBox("../../scheduler/jobs/migrations"),
+		Dir:         s.Driver(),
+		TablePrefix: s.Prefix(),
+	}
+
+	_, err := sql.ExecMigration(s.DB(), s.Driver(), migrations, migrate.Up, "scheduler_jobs_")
+	if err != nil {
+		return err
+	}
+
+	// Preparing the db statements
+	if options.Bool("prepare", true) {
+		for key, query := range queries {
+			if err := s.Prepare(key, query); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PutJob inserts or updates a job definition, tasks are stored separately
+func (s *sqlimpl) PutJob(job *jobs.Job) error {
+
+	j := proto.Clone(job).(*jobs.Job)
+	j.Tasks = nil
+	data, err := proto.Marshal(j)
+	if err != nil {
+		return err
+	}
+	var isEvent, isTimer int
+	if len(job.EventNames) > 0 {
+		isEvent = 1
+	}
+	if job.Schedule != nil {
+		isTimer = 1
+	}
+
+	insertStmt := s.GetStmt("insertJob")
+	if insertStmt == nil {
+		return fmt.Errorf("Unknown stmt")
+	}
+	defer insertStmt.Close()
+
+	if _, err = insertStmt.Exec(job.ID, job.Owner, isEvent, isTimer, data); err != nil {
+		updateStmt := s.GetStmt("updateJob")
+		if updateStmt == nil {
+			return fmt.Errorf("Unknown stmt")
+		}
+		defer updateStmt.Close()
+
+		_, err = updateStmt.Exec(job.Owner, isEvent, isTimer, data, job.ID)
+	}
+	return err
+}
+
+// GetJob loads a job and optionally its tasks
+func (s *sqlimpl) GetJob(jobId string, withTasks jobs.TaskStatus) (*jobs.Job, error) {
+
+	getStmt := s.GetStmt("getJob")
+	if getStmt == nil {
+		return nil, fmt.Errorf("Unknown stmt")
+	}
+	defer getStmt.Close()
+
+	rows, err := getStmt.Query(jobId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, errors.NotFound(common.SERVICE_JOBS, "Job %s not found", jobId)
+	}
+	var data []byte
+	if err := rows.Scan(&data); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	j := &jobs.Job{}
+	if err := proto.Unmarshal(data, j); err != nil {
+		return nil, err
+	}
+	if withTasks != jobs.TaskStatus_Unknown {
+		if j.Tasks, err = s.loadTasks(jobId, withTasks); err != nil {
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+// DeleteJob removes a job and all its tasks
+func (s *sqlimpl) DeleteJob(jobId string) error {
+
+	for _, key := range []string{"deleteJobTasks", "deleteJob"} {
+		stmt := s.GetStmt(key)
+		if stmt == nil {
+			return fmt.Errorf("Unknown stmt")
+		}
+		_, err := stmt.Exec(jobId)
+		stmt.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListJobs streams all jobs matching the filters
+func (s *sqlimpl) ListJobs(owner string, eventsOnly bool, timersOnly bool, withTasks jobs.TaskStatus, jobIDs ...string) (chan *jobs.Job, chan bool, error) {
+
+	listStmt := s.GetStmt("listJobs")
+	if listStmt == nil {
+		return nil, nil, fmt.Errorf("Unknown stmt")
+	}
+	defer listStmt.Close()
+
+	rows, err := listStmt.Query()
+	if err != nil {
+		return nil, nil, err
+	}
+	var results []*jobs.Job
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		j := &jobs.Job{}
+		if err := proto.Unmarshal(data, j); err != nil {
+			continue
+		}
+		if matchJobFilters(j, owner, eventsOnly, timersOnly, jobIDs) {
+			results = append(results, j)
+		}
+	}
+	rows.Close()
+
+	if withTasks != jobs.TaskStatus_Unknown {
+		for _, j := range results {
+			if j.Tasks, err = s.loadTasks(j.ID, withTasks); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	res := make(chan *jobs.Job)
+	done := make(chan bool, 1)
+	go func() {
+		for _, j := range results {
+			res <- j
+		}
+		done <- true
+		close(done)
+	}()
+	return res, done, nil
+}
+
+// PutTask inserts or updates a task
+func (s *sqlimpl) PutTask(task *jobs.Task) error {
+
+	data, err := proto.Marshal(task)
+	if err != nil {
+		return err
+	}
+
+	insertStmt := s.GetStmt("insertTask")
+	if insertStmt == nil {
+		return fmt.Errorf("Unknown stmt")
+	}
+	defer insertStmt.Close()
+
+	if _, err = insertStmt.Exec(task.JobID, task.ID, int32(task.Status), task.StartTime, task.EndTime, data); err != nil {
+		updateStmt := s.GetStmt("updateTask")
+		if updateStmt == nil {
+			return fmt.Errorf("Unknown stmt")
+		}
+		defer updateStmt.Close()
+
+		_, err = updateStmt.Exec(int32(task.Status), task.StartTime, task.EndTime, data, task.JobID, task.ID)
+	}
+	return err
+}
+
+// ListTasks streams the tasks of one or all jobs
+func (s *sqlimpl) ListTasks(jobId string, taskStatus jobs.TaskStatus) (chan *jobs.Task, chan bool, error) {
+
+	results, err := s.loadTasks(jobId, taskStatus)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res := make(chan *jobs.Task)
+	done := make(chan bool, 1)
+	go func() {
+		for _, t := range results {
+			res <- t
+		}
+		done <- true
+		close(done)
+	}()
+	return res, done, nil
+}
+
+// DeleteTasks removes a set of tasks for a given job
+func (s *sqlimpl) DeleteTasks(jobId string, taskId []string) error {
+
+	delStmt := s.GetStmt("deleteTask")
+	if delStmt == nil {
+		return fmt.Errorf("Unknown stmt")
+	}
+	defer delStmt.Close()
+
+	for _, id := range taskId {
+		if _, err := delStmt.Exec(jobId, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlimpl) loadTasks(jobId string, status jobs.TaskStatus) ([]*jobs.Task, error) {
+
+	var key string
+	var args []interface{}
+	if jobId != "" {
+		key = "listJobTasks"
+		args = append(args, jobId)
+	} else {
+		key = "listTasks"
+	}
+	if status != jobs.TaskStatus_Any {
+		key += "ByStatus"
+		args = append(args, int32(status))
+	}
+
+	stmt := s.GetStmt(key)
+	if stmt == nil {
+		return nil, fmt.Errorf("Unknown stmt")
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []*jobs.Task
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		t := &jobs.Task{}
+		if err := proto.Unmarshal(data, t); err != nil {
+			continue
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
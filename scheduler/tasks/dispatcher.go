@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package tasks
+
+import (
+	"github.com/micro/go-micro/client"
+)
+
+const (
+	// DefaultMaximumWorkers is the number of tasks that can run in parallel
+	DefaultMaximumWorkers = 20
+)
+
+// Dispatcher runs tasks on a fixed pool of workers.
+type Dispatcher struct {
+	queue      chan *Task
+	maxWorkers int
+	client     client.Client
+	quit       chan bool
+	// done is called each time a task is finished
+	done func(task *Task, err error)
+}
+
+// NewDispatcher creates a dispatcher with a given number of workers.
+func NewDispatcher(maxWorkers int, cl client.Client, done func(task *Task, err error)) *Dispatcher {
+	return &Dispatcher{
+		queue:      make(chan *Task),
+		maxWorkers: maxWorkers,
+		client:     cl,
+		quit:       make(chan bool),
+		done:       done,
+	}
+}
+
+// Run starts the workers.
+func (d *Dispatcher) Run() {
+	for i := 0; i < d.maxWorkers; i++ {
+		go d.work()
+	}
+}
+
+// Stop stops all workers once their current task is finished.
+func (d *Dispatcher) Stop() {
+	close(d.quit)
+}
+
+// Dispatch sends a task to the first available worker, without blocking the caller.
+func (d *Dispatcher) Dispatch(task *Task) {
+	go func() {
+		select {
+		case d.queue <- task:
+		case <-d.quit:
+		}
+	}()
+}
+
+func (d *Dispatcher) work() {
+	for {
+		select {
+		case task := <-d.queue:
+			err := task.Run(d.client)
+			if d.done != nil {
+				d.done(task, err)
+			}
+		case <-d.quit:
+			return
+		}
+	}
+}
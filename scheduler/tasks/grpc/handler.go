@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package grpc
+
+import (
+	"context"
+
+	"github.com/micro/go-micro/client"
+	"github.com/micro/go-micro/errors"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/proto/jobs"
+	"github.com/pmker/yux/scheduler/tasks"
+)
+
+// Handler implements the TaskService to control running tasks.
+type Handler struct {
+	subscriber *tasks.Subscriber
+}
+
+// Control sends commands to tasks or jobs.
+func (h *Handler) Control(ctx context.Context, cmd *jobs.CtrlCommand, response *jobs.CtrlCommandResponse) error {
+
+	jobsClient := jobs.NewJobServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_JOBS, defaults.NewClient())
+
+	switch cmd.Cmd {
+	case jobs.Command_Stop, jobs.Command_Pause, jobs.Command_Resume:
+		task, ok := h.subscriber.GetRunningTask(cmd.TaskId)
+		if !ok {
+			return errors.NotFound(common.SERVICE_TASKS, "Cannot find running task %s", cmd.TaskId)
+		}
+		switch cmd.Cmd {
+		case jobs.Command_Stop:
+			task.Stop()
+		case jobs.Command_Pause:
+			task.Pause()
+		case jobs.Command_Resume:
+			task.Resume()
+		}
+	case jobs.Command_RunOnce:
+		client.Publish(ctx, client.NewPublication(common.TOPIC_TIMER_EVENT, &jobs.JobTriggerEvent{
+			JobID:  cmd.JobId,
+			RunNow: true,
+		}))
+	case jobs.Command_Active, jobs.Command_Inactive:
+		resp, err := jobsClient.GetJob(ctx, &jobs.GetJobRequest{JobID: cmd.JobId})
+		if err != nil {
+			return err
+		}
+		resp.Job.Inactive = cmd.Cmd == jobs.Command_Inactive
+		if _, err := jobsClient.PutJob(ctx, &jobs.PutJobRequest{Job: resp.Job}); err != nil {
+			return err
+		}
+	case jobs.Command_Delete:
+		if task, ok := h.subscriber.GetRunningTask(cmd.TaskId); ok {
+			task.Stop()
+		}
+		if _, err := jobsClient.DeleteTasks(ctx, &jobs.DeleteTasksRequest{JobId: cmd.JobId, TaskID: []string{cmd.TaskId}}); err != nil {
+			return err
+		}
+	default:
+		return errors.BadRequest(common.SERVICE_TASKS, "Unsupported command %s", cmd.Cmd.String())
+	}
+
+	response.Msg = "Command " + cmd.Cmd.String() + " sent"
+	return nil
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+// Package grpc provides the scheduler tasks service, running jobs when their triggering events are received.
+package grpc
+
+import (
+	"time"
+
+	"github.com/micro/go-micro"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/plugins"
+	"github.com/pmker/yux/common/proto/jobs"
+	"github.com/pmker/yux/common/service"
+	"github.com/pmker/yux/scheduler/tasks"
+)
+
+func init() {
+	plugins.Register(func() {
+		service.NewService(
+			service.Name(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_TASKS),
+			service.Tag(common.SERVICE_TAG_SCHEDULER),
+			service.Description("Tasks are running jobs dispatched on multiple workers"),
+			service.Dependency(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_JOBS, []string{}),
+			service.Unique(true),
+			service.WithMicro(func(m micro.Service) error {
+				ctx := m.Options().Context
+				cl := defaults.NewClient()
+
+				subscriber := tasks.NewSubscriber(ctx, cl)
+				if err := subscriber.Subscribe(m.Options().Server); err != nil {
+					return err
+				}
+				jobs.RegisterTaskServiceHandler(m.Options().Server, &Handler{subscriber: subscriber})
+
+				m.Init(micro.AfterStart(func() error {
+					go func() {
+						e := service.Retry(func() error {
+							return subscriber.Init()
+						}, 3*time.Second, 30*time.Second)
+						if e != nil {
+							log.Logger(ctx).Error("Cannot load jobs definitions", zap.Error(e))
+							return
+						}
+						// Tasks only run inside this unique service: tasks still flagged as running after the default delay are stuck
+						jobsClient := jobs.NewJobServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_JOBS, cl)
+						if resp, e := jobsClient.DetectStuckTasks(ctx, &jobs.DetectStuckTasksRequest{}); e == nil && len(resp.FixedTaskIds) > 0 {
+							log.Logger(ctx).Info("Fixed stuck tasks", zap.Strings("ids", resp.FixedTaskIds))
+						}
+					}()
+					return nil
+				}), micro.BeforeStop(func() error {
+					subscriber.Stop()
+					return nil
+				}))
+
+				return nil
+			}),
+		)
+	})
+}
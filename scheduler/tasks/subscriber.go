@@ -0,0 +1,278 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+// Package tasks is the scheduler engine: it listens to timer and application events, matches them against
+// jobs definitions and runs the corresponding tasks while honouring each job MaxConcurrency.
+package tasks
+
+import (
+	"context"
+	"sync"
+
+	"github.com/micro/go-micro/client"
+	"github.com/micro/go-micro/server"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/proto/idm"
+	"github.com/pmker/yux/common/proto/jobs"
+	"github.com/pmker/yux/common/proto/tree"
+)
+
+// Subscriber keeps the list of jobs definitions and triggers tasks when events are received.
+type Subscriber struct {
+	sync.RWMutex
+	RootContext context.Context
+	Client      client.Client
+	Definitions map[string]*jobs.Job
+
+	dispatcher *Dispatcher
+	running    map[string][]*Task
+	pending    map[string][]*Task
+	saver      func(ctx context.Context, task *jobs.Task)
+}
+
+// NewSubscriber creates a Subscriber and starts its dispatcher.
+func NewSubscriber(parentContext context.Context, cl client.Client) *Subscriber {
+
+	s := &Subscriber{
+		RootContext: parentContext,
+		Client:      cl,
+		Definitions: make(map[string]*jobs.Job),
+		running:     make(map[string][]*Task),
+		pending:     make(map[string][]*Task),
+	}
+	s.dispatcher = NewDispatcher(DefaultMaximumWorkers, cl, s.taskFinished)
+	s.dispatcher.Run()
+	return s
+}
+
+// Subscribe registers the events handlers on the given server.
+func (s *Subscriber) Subscribe(srv server.Server) error {
+
+	if err := srv.Subscribe(srv.NewSubscriber(common.TOPIC_JOB_CONFIG_EVENT, s.jobsChangeEvent)); err != nil {
+		return err
+	}
+	if err := srv.Subscribe(srv.NewSubscriber(common.TOPIC_TIMER_EVENT, s.timerEvent)); err != nil {
+		return err
+	}
+	if err := srv.Subscribe(srv.NewSubscriber(common.TOPIC_TREE_CHANGES, s.nodeEvent)); err != nil {
+		return err
+	}
+	return srv.Subscribe(srv.NewSubscriber(common.TOPIC_IDM_EVENT, s.idmEvent))
+}
+
+// Init loads all jobs definitions from the jobs service.
+func (s *Subscriber) Init() error {
+
+	cli := jobs.NewJobServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_JOBS, s.Client)
+	streamer, err := cli.ListJobs(s.RootContext, &jobs.ListJobsRequest{})
+	if err != nil {
+		return err
+	}
+	defer streamer.Close()
+	s.Lock()
+	defer s.Unlock()
+	for {
+		resp, e := streamer.Recv()
+		if e != nil || resp == nil {
+			break
+		}
+		s.Definitions[resp.Job.ID] = resp.Job
+	}
+	return nil
+}
+
+// Stop stops the dispatcher and all running tasks.
+func (s *Subscriber) Stop() {
+	s.Lock()
+	for _, tasks := range s.running {
+		for _, t := range tasks {
+			t.Stop()
+		}
+	}
+	s.Unlock()
+	s.dispatcher.Stop()
+}
+
+// GetRunningTask finds a running or queued task by its ID.
+func (s *Subscriber) GetRunningTask(taskId string) (*Task, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	for _, list := range []map[string][]*Task{s.running, s.pending} {
+		for _, tasks := range list {
+			for _, t := range tasks {
+				if t.GetID() == taskId {
+					return t, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// jobsChangeEvent maintains the definitions list and starts AutoStart jobs when they are first inserted.
+func (s *Subscriber) jobsChangeEvent(ctx context.Context, msg *jobs.JobChangeEvent) error {
+
+	s.Lock()
+	if msg.JobRemoved != "" {
+		delete(s.Definitions, msg.JobRemoved)
+	}
+	var autoStart bool
+	if msg.JobUpdated != nil {
+		_, exists := s.Definitions[msg.JobUpdated.ID]
+		s.Definitions[msg.JobUpdated.ID] = msg.JobUpdated
+		autoStart = !exists && msg.JobUpdated.AutoStart && !msg.JobUpdated.Inactive
+	}
+	s.Unlock()
+
+	if autoStart {
+		log.Logger(ctx).Debug("Starting AutoStart job", msg.JobUpdated.ZapId())
+		s.enqueue(NewTaskFromEvent(s.RootContext, msg.JobUpdated, &jobs.JobTriggerEvent{JobID: msg.JobUpdated.ID, RunNow: true}))
+	}
+	return nil
+}
+
+// timerEvent runs the job designated by the event. If RunNow is set, the job is started even if Inactive.
+func (s *Subscriber) timerEvent(ctx context.Context, event *jobs.JobTriggerEvent) error {
+
+	s.RLock()
+	job, ok := s.Definitions[event.JobID]
+	s.RUnlock()
+	if !ok {
+		// Maybe the definition was not loaded yet
+		cli := jobs.NewJobServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_JOBS, s.Client)
+		resp, err := cli.GetJob(ctx, &jobs.GetJobRequest{JobID: event.JobID})
+		if err != nil {
+			log.Logger(ctx).Error("Received timer event for unknown job", zap.String(common.KEY_JOB_ID, event.JobID), zap.Error(err))
+			return nil
+		}
+		job = resp.Job
+		s.Lock()
+		s.Definitions[job.ID] = job
+		s.Unlock()
+	}
+	if job.Inactive && !event.RunNow {
+		return nil
+	}
+	s.enqueue(NewTaskFromEvent(s.RootContext, job, event))
+	return nil
+}
+
+// nodeEvent triggers the jobs listening to this type of node change.
+func (s *Subscriber) nodeEvent(ctx context.Context, event *tree.NodeChangeEvent) error {
+	for _, job := range s.matchingJobs(jobs.NodeChangeEventName(event.Type)) {
+		s.enqueue(NewTaskFromEvent(s.RootContext, job, event))
+	}
+	return nil
+}
+
+// idmEvent triggers the jobs listening to this type of IDM change.
+func (s *Subscriber) idmEvent(ctx context.Context, event *idm.ChangeEvent) error {
+	objectType := jobs.IdmChangeEventObjectType(event)
+	if objectType == "" {
+		return nil
+	}
+	for _, job := range s.matchingJobs(jobs.IdmChangeEventName(objectType, event.Type)) {
+		s.enqueue(NewTaskFromEvent(s.RootContext, job, event))
+	}
+	return nil
+}
+
+// matchingJobs lists active jobs whose EventNames contain the given event name.
+func (s *Subscriber) matchingJobs(eventName string) (matches []*jobs.Job) {
+	s.RLock()
+	defer s.RUnlock()
+	for _, job := range s.Definitions {
+		if job.Inactive {
+			continue
+		}
+		for _, name := range job.EventNames {
+			if name == eventName {
+				matches = append(matches, job)
+				break
+			}
+		}
+	}
+	return
+}
+
+// enqueue dispatches a task if its job has a free slot, or keeps it pending otherwise.
+func (s *Subscriber) enqueue(task *Task) {
+
+	if s.saver != nil {
+		task.Saver = s.saver
+	}
+	jobId := task.Job.ID
+	max := int(task.Job.MaxConcurrency)
+
+	s.Lock()
+	if max > 0 && len(s.running[jobId]) >= max {
+		s.pending[jobId] = append(s.pending[jobId], task)
+		s.Unlock()
+		log.Logger(s.RootContext).Debug("Job has reached its maximum concurrency, queuing task", task.Job.ZapId())
+		task.Queue()
+		return
+	}
+	s.running[jobId] = append(s.running[jobId], task)
+	s.Unlock()
+
+	s.dispatcher.Dispatch(task)
+}
+
+// taskFinished releases the job slot and dispatches the next pending task, if any.
+func (s *Subscriber) taskFinished(task *Task, err error) {
+
+	jobId := task.Job.ID
+	var next *Task
+
+	s.Lock()
+	running := s.running[jobId][:0]
+	for _, t := range s.running[jobId] {
+		if t != task {
+			running = append(running, t)
+		}
+	}
+	if len(running) == 0 {
+		delete(s.running, jobId)
+	} else {
+		s.running[jobId] = running
+	}
+	if pending := s.pending[jobId]; len(pending) > 0 {
+		next = pending[0]
+		if len(pending) == 1 {
+			delete(s.pending, jobId)
+		} else {
+			s.pending[jobId] = pending[1:]
+		}
+		s.running[jobId] = append(s.running[jobId], next)
+	}
+	s.Unlock()
+
+	if next != nil {
+		s.dispatcher.Dispatch(next)
+	} else if err == nil && task.Job.AutoClean {
+		cli := jobs.NewJobServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_JOBS, s.Client)
+		if _, e := cli.DeleteJob(s.RootContext, &jobs.DeleteJobRequest{JobID: jobId}); e != nil {
+			log.Logger(s.RootContext).Error("Cannot clean job", task.Job.ZapId(), zap.Error(e))
+		}
+	}
+}
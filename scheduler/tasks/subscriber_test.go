@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package tasks
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micro/go-micro/client"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/proto/idm"
+	"github.com/pmker/yux/common/proto/jobs"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/scheduler/actions"
+)
+
+var (
+	blockingActionName = "actions.test.blocking"
+	release            = make(chan bool, 10)
+	runCount           int
+	runLock            sync.Mutex
+)
+
+type blockingAction struct{}
+
+func (b *blockingAction) GetName() string {
+	return blockingActionName
+}
+
+func (b *blockingAction) Init(job *jobs.Job, cl client.Client, action *jobs.Action) error {
+	return nil
+}
+
+func (b *blockingAction) Run(ctx context.Context, channels *actions.RunnableChannels, input jobs.ActionMessage) (jobs.ActionMessage, error) {
+	runLock.Lock()
+	runCount++
+	runLock.Unlock()
+	select {
+	case <-release:
+	case <-ctx.Done():
+	}
+	input.AppendOutput(&jobs.ActionOutput{Success: true})
+	return input, nil
+}
+
+func init() {
+	actions.GetActionsManager().Register(blockingActionName, func() actions.ConcreteAction {
+		return &blockingAction{}
+	})
+}
+
+func countTasks(s *Subscriber, jobId string) (int, int) {
+	s.RLock()
+	defer s.RUnlock()
+	return len(s.running[jobId]), len(s.pending[jobId])
+}
+
+func TestSubscriber_MatchingJobs(t *testing.T) {
+
+	Convey("Events are matched against jobs EventNames", t, func() {
+
+		s := NewSubscriber(context.Background(), nil)
+		defer s.Stop()
+		s.Definitions["on-create"] = &jobs.Job{ID: "on-create", EventNames: []string{jobs.NodeChangeEventName(tree.NodeChangeEvent_CREATE)}}
+		s.Definitions["on-user"] = &jobs.Job{ID: "on-user", EventNames: []string{jobs.IdmChangeEventName(jobs.IdmObjectUser, idm.ChangeEventType_CREATE)}}
+		s.Definitions["inactive"] = &jobs.Job{ID: "inactive", Inactive: true, EventNames: []string{jobs.NodeChangeEventName(tree.NodeChangeEvent_CREATE)}}
+
+		matches := s.matchingJobs(jobs.NodeChangeEventName(tree.NodeChangeEvent_CREATE))
+		So(matches, ShouldHaveLength, 1)
+		So(matches[0].ID, ShouldEqual, "on-create")
+
+		So(s.matchingJobs(jobs.NodeChangeEventName(tree.NodeChangeEvent_DELETE)), ShouldBeEmpty)
+
+		objectType := jobs.IdmChangeEventObjectType(&idm.ChangeEvent{User: &idm.User{Login: "john"}})
+		matches = s.matchingJobs(jobs.IdmChangeEventName(objectType, idm.ChangeEventType_CREATE))
+		So(matches, ShouldHaveLength, 1)
+		So(matches[0].ID, ShouldEqual, "on-user")
+
+		msg := MessageFromEvent(&tree.NodeChangeEvent{Type: tree.NodeChangeEvent_CREATE, Target: &tree.Node{Path: "/file"}})
+		So(msg.Nodes, ShouldHaveLength, 1)
+		So(msg.Event, ShouldNotBeNil)
+
+	})
+}
+
+func TestSubscriber_MaxConcurrency(t *testing.T) {
+
+	Convey("Tasks above MaxConcurrency are queued", t, func() {
+
+		var statuses []jobs.TaskStatus
+		var statusLock sync.Mutex
+		s := NewSubscriber(context.Background(), nil)
+		defer s.Stop()
+		s.saver = func(ctx context.Context, task *jobs.Task) {
+			statusLock.Lock()
+			statuses = append(statuses, task.Status)
+			statusLock.Unlock()
+		}
+		s.Definitions["limited"] = &jobs.Job{
+			ID:             "limited",
+			MaxConcurrency: 1,
+			EventNames:     []string{jobs.NodeChangeEventName(tree.NodeChangeEvent_CREATE)},
+			Actions:        []*jobs.Action{{ID: blockingActionName}},
+		}
+
+		for i := 0; i < 3; i++ {
+			s.nodeEvent(context.Background(), &tree.NodeChangeEvent{Type: tree.NodeChangeEvent_CREATE, Target: &tree.Node{Path: "/file"}})
+		}
+		running, pending := countTasks(s, "limited")
+		So(running, ShouldEqual, 1)
+		So(pending, ShouldEqual, 2)
+
+		for i := 0; i < 3; i++ {
+			release <- true
+		}
+		deadline := time.Now().Add(3 * time.Second)
+		for time.Now().Before(deadline) {
+			if r, p := countTasks(s, "limited"); r == 0 && p == 0 {
+				break
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		running, pending = countTasks(s, "limited")
+		So(running, ShouldEqual, 0)
+		So(pending, ShouldEqual, 0)
+		runLock.Lock()
+		So(runCount, ShouldEqual, 3)
+		runLock.Unlock()
+
+		statusLock.Lock()
+		So(statuses, ShouldContain, jobs.TaskStatus_Queued)
+		So(statuses, ShouldContain, jobs.TaskStatus_Finished)
+		statusLock.Unlock()
+
+	})
+}
@@ -0,0 +1,302 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/micro/go-micro/client"
+	"github.com/pborman/uuid"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/proto/idm"
+	"github.com/pmker/yux/common/proto/jobs"
+	"github.com/pmker/yux/common/proto/tree"
+	"github.com/pmker/yux/scheduler/actions"
+)
+
+// Task wraps a jobs.Task and is in charge of running the job actions and
+// reporting status and progress.
+type Task struct {
+	sync.RWMutex
+	Job     *jobs.Job
+	Message jobs.ActionMessage
+
+	task     *jobs.Task
+	context  context.Context
+	cancel   context.CancelFunc
+	channels *actions.RunnableChannels
+	lastSave time.Time
+
+	// Saver is used to persist the task status, defaults to the JobService PutTask API
+	Saver func(ctx context.Context, task *jobs.Task)
+}
+
+// NewTaskFromEvent creates a Task for the given job, building its initial message from the triggering event.
+func NewTaskFromEvent(ctx context.Context, job *jobs.Job, event interface{}) *Task {
+
+	ctx, cancel := context.WithCancel(ctx)
+	t := &Task{
+		Job:      job,
+		Message:  MessageFromEvent(event),
+		context:  ctx,
+		cancel:   cancel,
+		channels: actions.NewRunnableChannels(),
+		task: &jobs.Task{
+			ID:           uuid.New(),
+			JobID:        job.ID,
+			Status:       jobs.TaskStatus_Queued,
+			TriggerOwner: job.Owner,
+			StartTime:    int32(time.Now().Unix()),
+		},
+	}
+	t.Saver = defaultSaver
+	return t
+}
+
+// MessageFromEvent builds the initial ActionMessage from a triggering event.
+func MessageFromEvent(event interface{}) jobs.ActionMessage {
+
+	message := jobs.ActionMessage{}
+	switch ev := event.(type) {
+	case *tree.NodeChangeEvent:
+		message.Event, _ = ptypes.MarshalAny(ev)
+		if ev.Target != nil {
+			message = message.WithNode(ev.Target)
+		} else if ev.Source != nil {
+			message = message.WithNode(ev.Source)
+		}
+	case *idm.ChangeEvent:
+		message.Event, _ = ptypes.MarshalAny(ev)
+		if ev.User != nil {
+			message = message.WithUser(ev.User)
+		}
+	case *jobs.JobTriggerEvent:
+		message.Event, _ = ptypes.MarshalAny(ev)
+	}
+	return message
+}
+
+func defaultSaver(ctx context.Context, task *jobs.Task) {
+	cli := jobs.NewJobServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_JOBS, defaults.NewClient())
+	if _, e := cli.PutTask(ctx, &jobs.PutTaskRequest{Task: task}); e != nil {
+		log.Logger(ctx).Error("Cannot save task", task.ZapId(), zap.Error(e))
+	}
+}
+
+// GetID returns the underlying task ID.
+func (t *Task) GetID() string {
+	return t.task.ID
+}
+
+// GetStatus returns the current status of the task.
+func (t *Task) GetStatus() jobs.TaskStatus {
+	t.RLock()
+	defer t.RUnlock()
+	return t.task.Status
+}
+
+// Queue saves the task with a Queued status.
+func (t *Task) Queue() {
+	t.SetStatus(jobs.TaskStatus_Queued, "Waiting for a free slot")
+}
+
+// SetStatus updates the status and saves the task.
+func (t *Task) SetStatus(status jobs.TaskStatus, message ...string) {
+	t.Lock()
+	t.task.Status = status
+	if len(message) > 0 {
+		t.task.StatusMessage = message[0]
+	}
+	if status == jobs.TaskStatus_Finished || status == jobs.TaskStatus_Error || status == jobs.TaskStatus_Interrupted {
+		t.task.EndTime = int32(time.Now().Unix())
+	}
+	t.Unlock()
+	t.save(true)
+}
+
+// SetProgress updates the progress, the task is saved at most once per second.
+func (t *Task) SetProgress(progress float32) {
+	t.Lock()
+	t.task.HasProgress = true
+	t.task.Progress = progress
+	t.Unlock()
+	t.save(false)
+}
+
+func (t *Task) save(force bool) {
+	t.Lock()
+	if !force && time.Now().Sub(t.lastSave) < time.Second {
+		t.Unlock()
+		return
+	}
+	t.lastSave = time.Now()
+	clone := *t.task
+	t.Unlock()
+	if t.Saver != nil {
+		t.Saver(t.context, &clone)
+	}
+}
+
+func (t *Task) appendLog(action *jobs.Action, in jobs.ActionMessage, out jobs.ActionMessage) {
+	t.Lock()
+	defer t.Unlock()
+	t.task.ActionsLogs = append(t.task.ActionsLogs, &jobs.ActionLog{
+		Action:        action,
+		InputMessage:  &in,
+		OutputMessage: &out,
+	})
+}
+
+// Stop cancels the task context.
+func (t *Task) Stop() {
+	t.cancel()
+}
+
+// Pause sends a pause signal to the running actions.
+func (t *Task) Pause() {
+	select {
+	case t.channels.Pause <- true:
+	default:
+	}
+}
+
+// Resume sends a resume signal to the running actions.
+func (t *Task) Resume() {
+	select {
+	case t.channels.Resume <- true:
+	default:
+	}
+}
+
+// Run runs all the job actions and their chained actions, and returns when they are all done.
+func (t *Task) Run(cl client.Client) error {
+
+	t.Lock()
+	t.task.StartTime = int32(time.Now().Unix())
+	t.Unlock()
+	t.SetStatus(jobs.TaskStatus_Running, "Starting job "+t.Job.Label)
+
+	stopForward := make(chan bool)
+	go t.forwardChannels(stopForward)
+	defer close(stopForward)
+
+	var err error
+	for _, action := range t.Job.Actions {
+		if e := t.runAction(cl, action, t.Message); e != nil {
+			err = e
+		}
+	}
+
+	select {
+	case <-t.context.Done():
+		t.SetStatus(jobs.TaskStatus_Interrupted, "Task was stopped")
+		return t.context.Err()
+	default:
+	}
+	if err != nil {
+		t.SetStatus(jobs.TaskStatus_Error, err.Error())
+		return err
+	}
+	t.Lock()
+	if t.task.HasProgress {
+		t.task.Progress = 1
+	}
+	t.Unlock()
+	t.SetStatus(jobs.TaskStatus_Finished, "Complete")
+	return nil
+}
+
+// forwardChannels transforms RunnableChannels messages into task updates.
+func (t *Task) forwardChannels(stop chan bool) {
+	for {
+		select {
+		case status := <-t.channels.Status:
+			t.SetStatus(status)
+		case msg := <-t.channels.StatusMsg:
+			t.Lock()
+			t.task.StatusMessage = msg
+			t.Unlock()
+			t.save(false)
+		case progress := <-t.channels.Progress:
+			t.SetProgress(progress)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// runAction resolves the action selectors into one or more messages, runs the action on each of them
+// and recursively runs the chained actions on the outputs.
+func (t *Task) runAction(cl client.Client, action *jobs.Action, input jobs.ActionMessage) error {
+
+	concrete, ok := actions.GetActionsManager().ActionById(action.ID)
+	if !ok {
+		return fmt.Errorf("cannot find action %s", action.ID)
+	}
+	if e := concrete.Init(t.Job, cl, action); e != nil {
+		return e
+	}
+	if ctrl, ok := concrete.(actions.ControllableAction); ok {
+		t.Lock()
+		t.task.CanPause = ctrl.CanPause()
+		t.task.CanStop = ctrl.CanStop()
+		t.Unlock()
+	}
+
+	output := make(chan jobs.ActionMessage)
+	done := make(chan bool, 1)
+	go action.ToMessages(input, cl, t.context, output, done)
+
+	var err error
+	for {
+		select {
+		case message := <-output:
+			select {
+			case <-t.context.Done():
+				continue
+			default:
+			}
+			log.Logger(t.context).Debug("Running action", action.ZapId(), t.Job.ZapId())
+			out, e := concrete.Run(t.context, t.channels, message)
+			t.appendLog(action, message, out)
+			if e != nil {
+				log.Logger(t.context).Error("Error while running action", action.ZapId(), zap.Error(e))
+				err = e
+				continue
+			}
+			for _, chained := range action.ChainedActions {
+				if e := t.runAction(cl, chained, out); e != nil {
+					err = e
+				}
+			}
+		case <-done:
+			return err
+		}
+	}
+}
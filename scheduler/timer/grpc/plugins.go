@@ -0,0 +1,88 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+// Package grpc provides the timer service, publishing events at the schedule defined by the jobs.
+package grpc
+
+import (
+	"time"
+
+	"github.com/micro/go-micro"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/micro"
+	"github.com/pmker/yux/common/plugins"
+	"github.com/pmker/yux/common/proto/jobs"
+	"github.com/pmker/yux/common/service"
+	"github.com/pmker/yux/scheduler/timer"
+)
+
+func init() {
+	plugins.Register(func() {
+		service.NewService(
+			service.Name(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_TIMER),
+			service.Tag(common.SERVICE_TAG_SCHEDULER),
+			service.Description("Triggers events based on a scheduler pattern"),
+			service.Dependency(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_JOBS, []string{}),
+			service.Unique(true),
+			service.WithMicro(func(m micro.Service) error {
+				ctx := m.Options().Context
+
+				producer := timer.NewEventProducer(ctx)
+				if err := m.Options().Server.Subscribe(m.Options().Server.NewSubscriber(common.TOPIC_JOB_CONFIG_EVENT, producer.Handle)); err != nil {
+					return err
+				}
+
+				m.Init(micro.AfterStart(func() error {
+					producer.Start()
+					go func() {
+						e := service.Retry(func() error {
+							cli := jobs.NewJobServiceClient(common.SERVICE_GRPC_NAMESPACE_+common.SERVICE_JOBS, defaults.NewClient())
+							streamer, err := cli.ListJobs(ctx, &jobs.ListJobsRequest{TimersOnly: true})
+							if err != nil {
+								return err
+							}
+							defer streamer.Close()
+							for {
+								resp, er := streamer.Recv()
+								if er != nil || resp == nil {
+									break
+								}
+								producer.StartOrUpdateJob(resp.Job)
+							}
+							return nil
+						}, 3*time.Second, 30*time.Second)
+						if e != nil {
+							log.Logger(ctx).Error("Cannot load scheduled jobs", zap.Error(e))
+						}
+					}()
+					return nil
+				}), micro.BeforeStop(func() error {
+					producer.StopAll()
+					return nil
+				}))
+
+				return nil
+			}),
+		)
+	})
+}
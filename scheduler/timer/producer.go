@@ -0,0 +1,175 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+// Package timer provides a service that triggers jobs at regular intervals, based on their ISO8601 schedule.
+package timer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/micro/go-micro/client"
+	"go.uber.org/zap"
+
+	"github.com/pmker/yux/common"
+	"github.com/pmker/yux/common/log"
+	"github.com/pmker/yux/common/proto/jobs"
+)
+
+// ScheduleWaiter waits for the next occurrence of a schedule and sends the job id on a tick channel.
+type ScheduleWaiter struct {
+	jobId    string
+	schedule *Schedule
+	lastRun  time.Time
+	tick     chan string
+	stop     chan bool
+}
+
+// NewScheduleWaiter creates a waiter for the given job.
+func NewScheduleWaiter(jobId string, schedule *Schedule, tick chan string) *ScheduleWaiter {
+	return &ScheduleWaiter{
+		jobId:    jobId,
+		schedule: schedule,
+		tick:     tick,
+		stop:     make(chan bool, 1),
+	}
+}
+
+// Start loops until the schedule is exhausted or the waiter is stopped.
+func (w *ScheduleWaiter) Start() {
+	go func() {
+		for {
+			now := time.Now()
+			next, ok := w.schedule.Next(now, w.lastRun)
+			if !ok {
+				return
+			}
+			select {
+			case <-time.After(next.Sub(now)):
+				w.lastRun = next
+				select {
+				case w.tick <- w.jobId:
+				case <-w.stop:
+					return
+				}
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop interrupts the waiter.
+func (w *ScheduleWaiter) Stop() {
+	w.stop <- true
+}
+
+// EventProducer holds a ScheduleWaiter for each job having a schedule, and publishes
+// a JobTriggerEvent each time one of them ticks.
+type EventProducer struct {
+	sync.Mutex
+	Context context.Context
+	Waiters map[string]*ScheduleWaiter
+
+	tick    chan string
+	stop    chan bool
+	publish func(ctx context.Context, event *jobs.JobTriggerEvent)
+}
+
+// NewEventProducer creates a producer publishing events on the default broker.
+func NewEventProducer(rootCtx context.Context) *EventProducer {
+	return &EventProducer{
+		Context: rootCtx,
+		Waiters: make(map[string]*ScheduleWaiter),
+		tick:    make(chan string),
+		stop:    make(chan bool, 1),
+		publish: func(ctx context.Context, event *jobs.JobTriggerEvent) {
+			client.Publish(ctx, client.NewPublication(common.TOPIC_TIMER_EVENT, event))
+		},
+	}
+}
+
+// Start listens to waiters ticks and publishes events.
+func (e *EventProducer) Start() {
+	go func() {
+		for {
+			select {
+			case jobId := <-e.tick:
+				log.Logger(e.Context).Debug("Sending timer event for job", zap.String(common.KEY_JOB_ID, jobId))
+				e.publish(e.Context, &jobs.JobTriggerEvent{JobID: jobId})
+			case <-e.stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopAll stops all waiters and the producer itself.
+func (e *EventProducer) StopAll() {
+	e.Lock()
+	defer e.Unlock()
+	for id, w := range e.Waiters {
+		w.Stop()
+		delete(e.Waiters, id)
+	}
+	e.stop <- true
+}
+
+// StopWaiter stops the waiter of a given job, if any.
+func (e *EventProducer) StopWaiter(jobId string) {
+	e.Lock()
+	defer e.Unlock()
+	if w, ok := e.Waiters[jobId]; ok {
+		w.Stop()
+		delete(e.Waiters, jobId)
+	}
+}
+
+// StartOrUpdateJob (re)starts a waiter for this job if it is active and has a valid schedule.
+func (e *EventProducer) StartOrUpdateJob(job *jobs.Job) {
+
+	e.StopWaiter(job.ID)
+	if job.Inactive || job.Schedule == nil {
+		return
+	}
+	schedule, err := NewSchedule(job.Schedule)
+	if err != nil {
+		log.Logger(e.Context).Error("Cannot parse schedule for job", job.ZapId(), zap.Error(err))
+		return
+	}
+	w := NewScheduleWaiter(job.ID, schedule, e.tick)
+	e.Lock()
+	e.Waiters[job.ID] = w
+	e.Unlock()
+	w.Start()
+	log.Logger(e.Context).Debug("Registered timer for job", job.ZapId(), zap.String("schedule", job.Schedule.Iso8601Schedule))
+}
+
+// Handle listens to JobChangeEvents to maintain the waiters list.
+func (e *EventProducer) Handle(ctx context.Context, msg *jobs.JobChangeEvent) error {
+	if msg.JobRemoved != "" {
+		e.StopWaiter(msg.JobRemoved)
+	}
+	if msg.JobUpdated != nil {
+		e.StartOrUpdateJob(msg.JobUpdated)
+	}
+	return nil
+}
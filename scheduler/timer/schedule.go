@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package timer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pmker/yux/common/proto/jobs"
+)
+
+var (
+	durationRegexp = regexp.MustCompile(`^P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+)
+
+// Schedule is a parsed version of a jobs.Schedule, able to compute its next occurrences.
+type Schedule struct {
+	// Maximum number of occurrences, 0 means infinite
+	repeat int
+	// First occurrence
+	start time.Time
+	// Calendar part of the period
+	years, months, days int
+	// Clock part of the period
+	clock time.Duration
+	// Minimum time between two runs
+	minDelta time.Duration
+}
+
+// NewSchedule parses the ISO8601 strings of a jobs.Schedule. Iso8601Schedule must be
+// a repeating interval of the form "Rn/start/period" (for instance "R/2012-06-04T19:25:16.828696-07:00/PT5M").
+// The start part can be omitted ("Rn/period"), in which case the first occurrence is the current time.
+func NewSchedule(s *jobs.Schedule) (*Schedule, error) {
+
+	if s == nil || s.Iso8601Schedule == "" {
+		return nil, fmt.Errorf("empty schedule")
+	}
+	parts := strings.Split(s.Iso8601Schedule, "/")
+	if len(parts) < 2 || len(parts) > 3 || !strings.HasPrefix(parts[0], "R") {
+		return nil, fmt.Errorf("invalid ISO8601 repeating interval %s", s.Iso8601Schedule)
+	}
+
+	sched := &Schedule{}
+	if r := strings.TrimPrefix(parts[0], "R"); r != "" {
+		n, e := strconv.Atoi(r)
+		if e != nil || n < 0 {
+			return nil, fmt.Errorf("invalid repetitions number in %s", s.Iso8601Schedule)
+		}
+		sched.repeat = n
+	}
+
+	period := parts[1]
+	sched.start = time.Now()
+	if len(parts) == 3 {
+		start, e := time.Parse(time.RFC3339Nano, parts[1])
+		if e != nil {
+			return nil, e
+		}
+		sched.start = start
+		period = parts[2]
+	}
+
+	var e error
+	if sched.years, sched.months, sched.days, sched.clock, e = ParseIso8601Duration(period); e != nil {
+		return nil, e
+	}
+	if sched.years == 0 && sched.months == 0 && sched.days == 0 && sched.clock <= 0 {
+		return nil, fmt.Errorf("period cannot be empty in %s", s.Iso8601Schedule)
+	}
+
+	if s.Iso8601MinDelta != "" {
+		y, m, d, c, e := ParseIso8601Duration(s.Iso8601MinDelta)
+		if e != nil {
+			return nil, e
+		}
+		sched.minDelta = time.Duration(y)*365*24*time.Hour + time.Duration(m)*30*24*time.Hour + time.Duration(d)*24*time.Hour + c
+	}
+
+	return sched, nil
+}
+
+// ParseIso8601Duration parses an ISO8601 duration (e.g. "P1DT12H", "PT5M" or "P2W") and returns its calendar
+// parts separately from its clock part, as they cannot be converted to a fixed time.Duration.
+func ParseIso8601Duration(s string) (years int, months int, days int, clock time.Duration, err error) {
+
+	matches := durationRegexp.FindStringSubmatch(s)
+	if matches == nil || s == "P" || strings.HasSuffix(s, "T") {
+		err = fmt.Errorf("invalid ISO8601 duration %s", s)
+		return
+	}
+	atoi := func(v string) int {
+		if v == "" {
+			return 0
+		}
+		i, _ := strconv.Atoi(v)
+		return i
+	}
+	years = atoi(matches[1])
+	months = atoi(matches[2])
+	days = atoi(matches[3])*7 + atoi(matches[4])
+	clock = time.Duration(atoi(matches[5]))*time.Hour + time.Duration(atoi(matches[6]))*time.Minute
+	if matches[7] != "" {
+		sec, _ := strconv.ParseFloat(matches[7], 64)
+		clock += time.Duration(sec * float64(time.Second))
+	}
+	return
+}
+
+// Next computes the first occurrence strictly after the given time. If lastRun is not zero, the
+// occurrence also honours the minimum delta between two runs. The boolean is false if
+// all repetitions are exhausted.
+func (s *Schedule) Next(after time.Time, lastRun time.Time) (time.Time, bool) {
+
+	if !lastRun.IsZero() && s.minDelta > 0 {
+		if min := lastRun.Add(s.minDelta).Add(-time.Nanosecond); min.After(after) {
+			after = min
+		}
+	}
+
+	var k int
+	if after.Before(s.start) {
+		k = 0
+	} else if s.years == 0 && s.months == 0 && s.days == 0 {
+		k = int(after.Sub(s.start)/s.clock) + 1
+	} else {
+		// Rough estimation then walk to the exact occurrence
+		approx := time.Duration(s.years)*365*24*time.Hour + time.Duration(s.months)*28*24*time.Hour + time.Duration(s.days)*24*time.Hour + s.clock
+		k = int(after.Sub(s.start)/approx) - 2
+		if k < 0 {
+			k = 0
+		}
+		for !s.occurrence(k).After(after) {
+			k++
+		}
+	}
+
+	if s.repeat > 0 && k >= s.repeat {
+		return time.Time{}, false
+	}
+	return s.occurrence(k), true
+}
+
+func (s *Schedule) occurrence(k int) time.Time {
+	return s.start.AddDate(k*s.years, k*s.months, k*s.days).Add(time.Duration(k) * s.clock)
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2018. Abstrium SAS <team (at) pydio.com>
+ * This file is part of Pydio Cells.
+ *
+ * Pydio Cells is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * Pydio Cells is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with Pydio Cells.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ * The latest code can be found at <https://pydio.com>.
+ */
+
+package timer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/pmker/yux/common/proto/jobs"
+)
+
+func TestParseIso8601Duration(t *testing.T) {
+
+	Convey("Parse valid durations", t, func() {
+
+		y, m, d, c, e := ParseIso8601Duration("PT5M")
+		So(e, ShouldBeNil)
+		So(y+m+d, ShouldEqual, 0)
+		So(c, ShouldEqual, 5*time.Minute)
+
+		y, m, d, c, e = ParseIso8601Duration("P1Y2M3DT4H5M6.5S")
+		So(e, ShouldBeNil)
+		So(y, ShouldEqual, 1)
+		So(m, ShouldEqual, 2)
+		So(d, ShouldEqual, 3)
+		So(c, ShouldEqual, 4*time.Hour+5*time.Minute+6500*time.Millisecond)
+
+		_, _, d, _, e = ParseIso8601Duration("P2W")
+		So(e, ShouldBeNil)
+		So(d, ShouldEqual, 14)
+
+	})
+
+	Convey("Parse invalid durations", t, func() {
+
+		_, _, _, _, e := ParseIso8601Duration("P")
+		So(e, ShouldNotBeNil)
+		_, _, _, _, e = ParseIso8601Duration("PT")
+		So(e, ShouldNotBeNil)
+		_, _, _, _, e = ParseIso8601Duration("5M")
+		So(e, ShouldNotBeNil)
+
+	})
+}
+
+func TestSchedule_Next(t *testing.T) {
+
+	Convey("Infinite clock-based schedule", t, func() {
+
+		s, e := NewSchedule(&jobs.Schedule{Iso8601Schedule: "R/2012-06-04T19:25:16.828696-07:00/PT5M"})
+		So(e, ShouldBeNil)
+		ref := time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC)
+		next, ok := s.Next(ref, time.Time{})
+		So(ok, ShouldBeTrue)
+		So(next.After(ref), ShouldBeTrue)
+		So(next.Sub(ref), ShouldBeLessThanOrEqualTo, 5*time.Minute)
+		So(next.Sub(s.start)%(5*time.Minute), ShouldEqual, 0)
+
+	})
+
+	Convey("Calendar-based schedule", t, func() {
+
+		s, e := NewSchedule(&jobs.Schedule{Iso8601Schedule: "R/2018-01-31T10:00:00Z/P1M"})
+		So(e, ShouldBeNil)
+		next, ok := s.Next(time.Date(2018, 5, 15, 0, 0, 0, 0, time.UTC), time.Time{})
+		So(ok, ShouldBeTrue)
+		So(next.Month(), ShouldEqual, time.May)
+
+		next, ok = s.Next(time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{})
+		So(ok, ShouldBeTrue)
+		So(next, ShouldEqual, s.start)
+
+	})
+
+	Convey("Limited repetitions", t, func() {
+
+		s, e := NewSchedule(&jobs.Schedule{Iso8601Schedule: "R2/2018-01-01T10:00:00Z/PT1H"})
+		So(e, ShouldBeNil)
+		next, ok := s.Next(time.Date(2018, 1, 1, 10, 30, 0, 0, time.UTC), time.Time{})
+		So(ok, ShouldBeTrue)
+		So(next.Hour(), ShouldEqual, 11)
+		_, ok = s.Next(time.Date(2018, 1, 1, 11, 30, 0, 0, time.UTC), time.Time{})
+		So(ok, ShouldBeFalse)
+
+	})
+
+	Convey("Minimum delta between runs", t, func() {
+
+		s, e := NewSchedule(&jobs.Schedule{Iso8601Schedule: "R/2018-01-01T10:00:00Z/PT1M", Iso8601MinDelta: "PT10M"})
+		So(e, ShouldBeNil)
+		last := time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)
+		next, ok := s.Next(last, last)
+		So(ok, ShouldBeTrue)
+		So(next, ShouldEqual, last.Add(10*time.Minute))
+
+	})
+
+	Convey("Invalid schedules", t, func() {
+
+		_, e := NewSchedule(&jobs.Schedule{Iso8601Schedule: "2018-01-01T10:00:00Z/PT1M"})
+		So(e, ShouldNotBeNil)
+		_, e = NewSchedule(&jobs.Schedule{Iso8601Schedule: "R/2018-01-01T10:00:00Z/PT0S"})
+		So(e, ShouldNotBeNil)
+		_, e = NewSchedule(&jobs.Schedule{Iso8601Schedule: "R/not-a-date/PT1M"})
+		So(e, ShouldNotBeNil)
+
+	})
+}
+
+func TestEventProducer(t *testing.T) {
+
+	Convey("Producer publishes events on tick", t, func() {
+
+		events := make(chan *jobs.JobTriggerEvent, 10)
+		p := NewEventProducer(context.Background())
+		p.publish = func(ctx context.Context, event *jobs.JobTriggerEvent) {
+			events <- event
+		}
+		p.Start()
+		defer p.StopAll()
+
+		p.Handle(context.Background(), &jobs.JobChangeEvent{JobUpdated: &jobs.Job{
+			ID:       "fast-job",
+			Schedule: &jobs.Schedule{Iso8601Schedule: "R/PT0.2S"},
+		}})
+		So(p.Waiters, ShouldContainKey, "fast-job")
+
+		select {
+		case ev := <-events:
+			So(ev.JobID, ShouldEqual, "fast-job")
+		case <-time.After(2 * time.Second):
+			So(false, ShouldBeTrue)
+		}
+
+		p.Handle(context.Background(), &jobs.JobChangeEvent{JobRemoved: "fast-job"})
+		So(p.Waiters, ShouldNotContainKey, "fast-job")
+
+		p.Handle(context.Background(), &jobs.JobChangeEvent{JobUpdated: &jobs.Job{
+			ID:       "inactive-job",
+			Inactive: true,
+			Schedule: &jobs.Schedule{Iso8601Schedule: "R/PT0.2S"},
+		}})
+		So(p.Waiters, ShouldNotContainKey, "inactive-job")
+
+	})
+}